@@ -59,7 +59,12 @@ type BaseOptions struct {
 	OsZoneName     string `default:"$OS_ZONE_NAME" help:"Defaults to env[OS_ZONE_NAME]"`
 	OsEndpointType string `default:"$OS_ENDPOINT_TYPE|internalURL" help:"Defaults to env[OS_ENDPOINT_TYPE] or internalURL" choices:"publicURL|internalURL|adminURL"`
 	ApiVersion     string `default:"$API_VERSION" help:"override default modules service api version"`
-	SUBCOMMAND     string `help:"climc subcommand" subcommand:"true"`
+
+	OsApplicationCredentialId     string `default:"$OS_APPLICATION_CREDENTIAL_ID" help:"Application credential ID, defaults to env[OS_APPLICATION_CREDENTIAL_ID]"`
+	OsApplicationCredentialName   string `default:"$OS_APPLICATION_CREDENTIAL_NAME" help:"Application credential name of OS_USERNAME, defaults to env[OS_APPLICATION_CREDENTIAL_NAME]"`
+	OsApplicationCredentialSecret string `default:"$OS_APPLICATION_CREDENTIAL_SECRET" help:"Application credential secret, defaults to env[OS_APPLICATION_CREDENTIAL_SECRET]"`
+
+	SUBCOMMAND string `help:"climc subcommand" subcommand:"true"`
 }
 
 func getSubcommandsParser() (*structarg.ArgumentParser, error) {
@@ -120,18 +125,26 @@ func newClientSession(options *BaseOptions) (*mcclient.ClientSession, error) {
 	if len(options.OsAuthURL) == 0 {
 		return nil, fmt.Errorf("Missing OS_AUTH_URL")
 	}
-	if len(options.OsUsername) == 0 {
-		return nil, fmt.Errorf("Missing OS_USERNAME")
-	}
-	if len(options.OsPassword) == 0 {
-		return nil, fmt.Errorf("Missing OS_PASSWORD")
+	// an application credential is bound to its project and needs no password
+	useAppCred := len(options.OsApplicationCredentialSecret) > 0
+	if useAppCred {
+		if len(options.OsApplicationCredentialId) == 0 && (len(options.OsApplicationCredentialName) == 0 || len(options.OsUsername) == 0) {
+			return nil, fmt.Errorf("Missing OS_APPLICATION_CREDENTIAL_ID or OS_APPLICATION_CREDENTIAL_NAME with OS_USERNAME")
+		}
+	} else {
+		if len(options.OsUsername) == 0 {
+			return nil, fmt.Errorf("Missing OS_USERNAME")
+		}
+		if len(options.OsPassword) == 0 {
+			return nil, fmt.Errorf("Missing OS_PASSWORD")
+		}
 	}
 	if len(options.OsRegionName) == 0 {
 		return nil, fmt.Errorf("Missing OS_REGION_NAME")
 	}
 	// if len(options.OsProjectId) == 0 && len(options.OsProjectName) == 0 {
 	//    showErrorAndExit(fmt.Errorf("Missing OS_PROEJCT_ID or OS_PROJECT_NAME"))
-	if len(options.OsProjectName) == 0 {
+	if len(options.OsProjectName) == 0 && !useAppCred {
 		return nil, fmt.Errorf("Missing OS_PROJECT_NAME")
 	}
 
@@ -152,6 +165,9 @@ func newClientSession(options *BaseOptions) (*mcclient.ClientSession, error) {
 	authUrlAlter := strings.Replace(options.OsAuthURL, "/", "", -1)
 	authUrlAlter = strings.Replace(authUrlAlter, ":", "", -1)
 	tokenCachePath := filepath.Join(os.TempDir(), fmt.Sprintf("OS_AUTH_CACHE_TOKEN-%s-%s-%s-%s", authUrlAlter, options.OsUsername, options.OsDomainName, options.OsProjectName))
+	if useAppCred {
+		tokenCachePath = filepath.Join(os.TempDir(), fmt.Sprintf("OS_AUTH_CACHE_TOKEN-%s-%s-%s-%s", authUrlAlter, options.OsApplicationCredentialId, options.OsUsername, options.OsApplicationCredentialName))
+	}
 	if options.UseCachedToken {
 		cacheFile, err := os.Open(tokenCachePath)
 		if err == nil && cacheFile != nil {
@@ -174,10 +190,20 @@ func newClientSession(options *BaseOptions) (*mcclient.ClientSession, error) {
 	}
 
 	if cacheToken == nil {
-		token, err := client.Authenticate(options.OsUsername,
-			options.OsPassword,
-			options.OsDomainName,
-			options.OsProjectName)
+		var token mcclient.TokenCredential
+		var err error
+		if useAppCred {
+			token, err = client.AuthenticateApplicationCredential(options.OsApplicationCredentialId,
+				options.OsApplicationCredentialName,
+				options.OsApplicationCredentialSecret,
+				options.OsUsername,
+				options.OsDomainName)
+		} else {
+			token, err = client.Authenticate(options.OsUsername,
+				options.OsPassword,
+				options.OsDomainName,
+				options.OsProjectName)
+		}
 		if err != nil {
 			return nil, err
 		}
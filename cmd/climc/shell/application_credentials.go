@@ -0,0 +1,108 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package shell
+
+import (
+	"fmt"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+func init() {
+	type ApplicationCredentialListOptions struct {
+		options.BaseListOptions
+	}
+	R(&ApplicationCredentialListOptions{}, "application-credential-list", "List application credentials of current user", func(s *mcclient.ClientSession, args *ApplicationCredentialListOptions) error {
+		params, err := args.BaseListOptions.Params()
+		if err != nil {
+			return err
+		}
+		result, err := modules.ApplicationCredentials.List(s, params)
+		if err != nil {
+			return err
+		}
+		printList(result, modules.ApplicationCredentials.GetColumns(s))
+		return nil
+	})
+
+	type ApplicationCredentialCreateOptions struct {
+		NAME       string   `help:"Name of application credential"`
+		Desc       string   `help:"Description"`
+		Secret     string   `help:"Secret, generated if not given"`
+		Role       []string `help:"Roles granted to the credential, default all roles of current user in current project"`
+		ExpiresAt  string   `help:"Expire time, e.g. 2019-12-31T00:00:00Z, default never expire"`
+		AccessRule []string `help:"Restrict to service and optionally HTTP method, e.g. compute or compute:GET"`
+	}
+	R(&ApplicationCredentialCreateOptions{}, "application-credential-create", "Create an application credential bound to current project", func(s *mcclient.ClientSession, args *ApplicationCredentialCreateOptions) error {
+		params := jsonutils.NewDict()
+		params.Add(jsonutils.NewString(args.NAME), "name")
+		if len(args.Desc) > 0 {
+			params.Add(jsonutils.NewString(args.Desc), "description")
+		}
+		if len(args.Secret) > 0 {
+			params.Add(jsonutils.NewString(args.Secret), "secret")
+		}
+		if len(args.Role) > 0 {
+			params.Add(jsonutils.NewStringArray(args.Role), "roles")
+		}
+		if len(args.ExpiresAt) > 0 {
+			params.Add(jsonutils.NewString(args.ExpiresAt), "expires_at")
+		}
+		if len(args.AccessRule) > 0 {
+			rules := make([]api.SAccessRule, len(args.AccessRule))
+			for i, r := range args.AccessRule {
+				parts := strings.SplitN(r, ":", 2)
+				rules[i].Service = parts[0]
+				if len(parts) > 1 {
+					rules[i].Method = parts[1]
+				}
+			}
+			params.Add(jsonutils.Marshal(rules), "access_rules")
+		}
+		result, err := modules.ApplicationCredentials.Create(s, params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		fmt.Println("The secret is shown only once, keep it safe")
+		return nil
+	})
+
+	type ApplicationCredentialOptions struct {
+		ID string `help:"ID or name of application credential"`
+	}
+	R(&ApplicationCredentialOptions{}, "application-credential-show", "Show details of an application credential", func(s *mcclient.ClientSession, args *ApplicationCredentialOptions) error {
+		result, err := modules.ApplicationCredentials.Get(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&ApplicationCredentialOptions{}, "application-credential-delete", "Delete an application credential", func(s *mcclient.ClientSession, args *ApplicationCredentialOptions) error {
+		result, err := modules.ApplicationCredentials.Delete(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+func init() {
+	type BucketListOptions struct {
+		Cloudregion string `help:"List buckets in cloudregion"`
+		Acl         string `help:"List buckets of acl" choices:"private|authenticated-read|public-read|public-read-write"`
+
+		options.BaseListOptions
+	}
+	R(&BucketListOptions{}, "bucket-list", "List buckets", func(s *mcclient.ClientSession, args *BucketListOptions) error {
+		params, err := options.ListStructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.List(s, params)
+		if err != nil {
+			return err
+		}
+		printList(result, modules.Buckets.GetColumns(s))
+		return nil
+	})
+
+	type BucketIdOptions struct {
+		ID string `help:"ID or name of bucket"`
+	}
+	R(&BucketIdOptions{}, "bucket-show", "Show details of a bucket", func(s *mcclient.ClientSession, args *BucketIdOptions) error {
+		result, err := modules.Buckets.Get(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&BucketIdOptions{}, "bucket-delete", "Delete a bucket", func(s *mcclient.ClientSession, args *BucketIdOptions) error {
+		result, err := modules.Buckets.Delete(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&BucketIdOptions{}, "bucket-purge", "Purge a bucket record without deleting it on cloud", func(s *mcclient.ClientSession, args *BucketIdOptions) error {
+		result, err := modules.Buckets.PerformAction(s, args.ID, "purge", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type BucketCreateOptions struct {
+		NAME         string `help:"Name of bucket"`
+		MANAGER      string `help:"Cloud provider id or name"`
+		CLOUDREGION  string `help:"Cloudregion id or name"`
+		StorageClass string `help:"Storage class of bucket"`
+		Acl          string `help:"Canned acl of bucket" choices:"private|authenticated-read|public-read|public-read-write"`
+	}
+	R(&BucketCreateOptions{}, "bucket-create", "Create a bucket", func(s *mcclient.ClientSession, args *BucketCreateOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.Create(s, params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type BucketAclOptions struct {
+		ID  string `help:"ID or name of bucket" json:"-"`
+		ACL string `help:"Canned acl" choices:"private|authenticated-read|public-read|public-read-write"`
+		Key string `help:"Set acl of the object instead of the bucket"`
+	}
+	R(&BucketAclOptions{}, "bucket-set-acl", "Set acl of a bucket or an object", func(s *mcclient.ClientSession, args *BucketAclOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.PerformAction(s, args.ID, "acl", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type BucketTempUrlOptions struct {
+		ID            string `help:"ID or name of bucket" json:"-"`
+		KEY           string `help:"Key of object"`
+		Method        string `help:"Method allowed by the url" choices:"GET|PUT|DELETE" default:"GET"`
+		ExpireSeconds int    `help:"Seconds before the url expires" default:"3600"`
+	}
+	R(&BucketTempUrlOptions{}, "bucket-temp-url", "Generate a presigned url of an object", func(s *mcclient.ClientSession, args *BucketTempUrlOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.PerformAction(s, args.ID, "temp-url", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type BucketObjectListOptions struct {
+		ID        string `help:"ID or name of bucket" json:"-"`
+		Prefix    string `help:"List objects with the key prefix"`
+		Marker    string `help:"List objects after the marker"`
+		Delimiter string `help:"Group keys by the delimiter, e.g. /"`
+		Limit     int    `help:"Max count of objects in a page"`
+	}
+	R(&BucketObjectListOptions{}, "bucket-object-list", "List objects of a bucket", func(s *mcclient.ClientSession, args *BucketObjectListOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.GetSpecific(s, args.ID, "objects", params)
+		if err != nil {
+			return err
+		}
+		objects, _ := result.GetArray("objects")
+		printList(modules.JSON2ListResult(jsonutils.NewArray(objects...)), []string{"Key", "Size_Bytes", "Last_Modified", "Storage_Class", "Etag"})
+		if nextMarker, _ := result.GetString("next_marker"); len(nextMarker) > 0 {
+			printObject(jsonutils.Marshal(map[string]string{"next_marker": nextMarker}))
+		}
+		return nil
+	})
+
+	type BucketObjectDeleteOptions struct {
+		ID   string   `help:"ID or name of bucket" json:"-"`
+		KEYS []string `help:"Keys of objects to delete"`
+	}
+	R(&BucketObjectDeleteOptions{}, "bucket-object-delete", "Delete objects of a bucket", func(s *mcclient.ClientSession, args *BucketObjectDeleteOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.Buckets.PerformAction(s, args.ID, "delete-objects", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shell
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+func init() {
+	type DBInstanceListOptions struct {
+		Cloudregion string `help:"List dbinstances in cloudregion"`
+		Zone        string `help:"List dbinstances in zone"`
+		Vpc         string `help:"List dbinstances in vpc"`
+		Engine      string `help:"List dbinstances of engine" choices:"MySQL|SQLServer|PostgreSQL|PPAS|MariaDB"`
+
+		options.BaseListOptions
+	}
+	R(&DBInstanceListOptions{}, "dbinstance-list", "List dbinstances", func(s *mcclient.ClientSession, args *DBInstanceListOptions) error {
+		params, err := options.ListStructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.DBInstances.List(s, params)
+		if err != nil {
+			return err
+		}
+		printList(result, modules.DBInstances.GetColumns(s))
+		return nil
+	})
+
+	type DBInstanceIdOptions struct {
+		ID string `help:"ID or name of dbinstance"`
+	}
+	R(&DBInstanceIdOptions{}, "dbinstance-show", "Show details of a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+		result, err := modules.DBInstances.Get(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&DBInstanceIdOptions{}, "dbinstance-delete", "Delete a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+		result, err := modules.DBInstances.Delete(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	for _, action := range []string{"start", "stop", "reboot", "purge"} {
+		action := action
+		R(&DBInstanceIdOptions{}, "dbinstance-"+action, action+" a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+			result, err := modules.DBInstances.PerformAction(s, args.ID, action, nil)
+			if err != nil {
+				return err
+			}
+			printObject(result)
+			return nil
+		})
+	}
+
+	type DBInstanceChangeConfigOptions struct {
+		ID           string `help:"ID or name of dbinstance" json:"-"`
+		InstanceType string `help:"Instance type of dbinstance, e.g. rds.mysql.s2.large"`
+		DiskSizeGb   int    `help:"Disk size of dbinstance in GB"`
+		StorageType  string `help:"Storage type of dbinstance"`
+	}
+	R(&DBInstanceChangeConfigOptions{}, "dbinstance-change-config", "Change config of a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceChangeConfigOptions) error {
+		params, err := options.StructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.DBInstances.PerformAction(s, args.ID, "change-config", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&DBInstanceIdOptions{}, "dbinstance-account-list", "List accounts of a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+		result, err := modules.DBInstances.GetSpecific(s, args.ID, "accounts", nil)
+		if err != nil {
+			return err
+		}
+		printList(modules.JSON2ListResult(result), []string{"Name", "Status", "Description", "Privileges"})
+		return nil
+	})
+
+	R(&DBInstanceIdOptions{}, "dbinstance-database-list", "List databases of a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+		result, err := modules.DBInstances.GetSpecific(s, args.ID, "databases", nil)
+		if err != nil {
+			return err
+		}
+		printList(modules.JSON2ListResult(result), []string{"Name", "Status", "Character_Set", "Description"})
+		return nil
+	})
+
+	R(&DBInstanceIdOptions{}, "dbinstance-backup-list", "List recent backups of a dbinstance", func(s *mcclient.ClientSession, args *DBInstanceIdOptions) error {
+		result, err := modules.DBInstances.GetSpecific(s, args.ID, "backups", nil)
+		if err != nil {
+			return err
+		}
+		printList(modules.JSON2ListResult(result), []string{"Id", "Status", "Backup_Mode", "Backup_Size_Mb", "Databases", "Start_Time", "End_Time"})
+		return nil
+	})
+}
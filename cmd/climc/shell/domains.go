@@ -131,6 +131,93 @@ func init() {
 		return nil
 	})
 
+	type DomainConfigOIDCOptions struct {
+		ID string `help:"ID of domain to config" json:"-"`
+		api.SDomainOIDCConfigOptions
+		Mapping string `help:"Mapping rules in JSON" json:"-"`
+	}
+	R(&DomainConfigOIDCOptions{}, "domain-config-oidc", "Config a domain with OpenID Connect driver", func(s *mcclient.ClientSession, args *DomainConfigOIDCOptions) error {
+		config := jsonutils.NewDict()
+		config.Add(jsonutils.NewString("oidc"), "config", "identity", "driver")
+		config.Add(jsonutils.Marshal(args), "config", "oidc")
+		if len(args.Mapping) > 0 {
+			mapping, err := jsonutils.ParseString(args.Mapping)
+			if err != nil {
+				return err
+			}
+			config.Add(mapping, "config", "oidc", "mapping")
+		}
+		objId, err := modules.Domains.GetId(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		nconf, err := modules.Domains.UpdateConfig(s, objId, config)
+		if err != nil {
+			return err
+		}
+		fmt.Println(nconf.PrettyString())
+		return nil
+	})
+
+	type DomainConfigSAMLOptions struct {
+		ID string `help:"ID of domain to config" json:"-"`
+		api.SDomainSAMLConfigOptions
+		Mapping string `help:"Mapping rules in JSON" json:"-"`
+	}
+	R(&DomainConfigSAMLOptions{}, "domain-config-saml", "Config a domain with SAML 2.0 driver", func(s *mcclient.ClientSession, args *DomainConfigSAMLOptions) error {
+		config := jsonutils.NewDict()
+		config.Add(jsonutils.NewString("saml"), "config", "identity", "driver")
+		config.Add(jsonutils.Marshal(args), "config", "saml")
+		if len(args.Mapping) > 0 {
+			mapping, err := jsonutils.ParseString(args.Mapping)
+			if err != nil {
+				return err
+			}
+			config.Add(mapping, "config", "saml", "mapping")
+		}
+		objId, err := modules.Domains.GetId(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		nconf, err := modules.Domains.UpdateConfig(s, objId, config)
+		if err != nil {
+			return err
+		}
+		fmt.Println(nconf.PrettyString())
+		return nil
+	})
+
+	type DomainConfigSecurityOptions struct {
+		ID string `help:"ID of domain to config" json:"-"`
+		api.SDomainSecurityComplianceOptions
+	}
+	R(&DomainConfigSecurityOptions{}, "domain-config-security", "Config password and lockout policies of a domain", func(s *mcclient.ClientSession, args *DomainConfigSecurityOptions) error {
+		objId, err := modules.Domains.GetId(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		// the config is replaced as a whole, keep the other groups
+		conf := jsonutils.NewDict()
+		oconf, err := modules.Domains.GetConfig(s, objId)
+		if err == nil {
+			if dict, ok := oconf.(*jsonutils.JSONDict); ok {
+				conf = dict
+			}
+		}
+		if !conf.Contains("identity", "driver") {
+			conf.Add(jsonutils.NewString(api.IdentityDriverSQL), "identity", "driver")
+		}
+		conf.Set(api.DomainConfigSecurityGroup, jsonutils.Marshal(&args.SDomainSecurityComplianceOptions))
+		config := jsonutils.NewDict()
+		config.Add(conf, "config")
+		nconf, err := modules.Domains.UpdateConfig(s, objId, config)
+		if err != nil {
+			return err
+		}
+		fmt.Println(nconf.PrettyString())
+		return nil
+	})
+
 	type DomainCreateOptions struct {
 		NAME     string `help:"Name of domain"`
 		Desc     string `help:"Description"`
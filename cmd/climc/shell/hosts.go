@@ -296,6 +296,24 @@ func init() {
 		return nil
 	})
 
+	R(&HostDetailOptions{}, "host-drain", "Put host into maintenance mode and migrate its guests away", func(s *mcclient.ClientSession, args *HostDetailOptions) error {
+		result, err := modules.Hosts.PerformAction(s, args.ID, "drain", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&HostDetailOptions{}, "host-undrain", "Bring host out of maintenance mode", func(s *mcclient.ClientSession, args *HostDetailOptions) error {
+		result, err := modules.Hosts.PerformAction(s, args.ID, "undrain", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
 	R(&HostDetailOptions{}, "host-start", "Power on host", func(s *mcclient.ClientSession, args *HostDetailOptions) error {
 		result, err := modules.Hosts.PerformAction(s, args.ID, "start", nil)
 		if err != nil {
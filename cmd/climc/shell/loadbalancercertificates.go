@@ -73,6 +73,14 @@ func init() {
 		printObject(lbcert)
 		return nil
 	})
+	R(&options.LoadbalancerCertificateGetOptions{}, "lbcert-acme-renew", "Renew acme lbcert now", func(s *mcclient.ClientSession, opts *options.LoadbalancerCertificateGetOptions) error {
+		lbcert, err := modules.LoadbalancerCertificates.PerformAction(s, opts.ID, "acme-renew", nil)
+		if err != nil {
+			return err
+		}
+		printObject(lbcert)
+		return nil
+	})
 	R(&options.LoadbalancerCertificateDeleteOptions{}, "lbcert-purge", "Purge lbcert", func(s *mcclient.ClientSession, opts *options.LoadbalancerCertificateDeleteOptions) error {
 		lbcert, err := modules.LoadbalancerCertificates.PerformAction(s, opts.ID, "purge", nil)
 		if err != nil {
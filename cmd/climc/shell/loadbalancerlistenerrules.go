@@ -15,8 +15,6 @@
 package shell
 
 import (
-	"yunion.io/x/jsonutils"
-
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/modules"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
@@ -24,7 +22,10 @@ import (
 
 func init() {
 	R(&options.LoadbalancerListenerRuleCreateOptions{}, "lblistenerrule-create", "Create lblistenerrule", func(s *mcclient.ClientSession, opts *options.LoadbalancerListenerRuleCreateOptions) error {
-		params := jsonutils.Marshal(opts)
+		params, err := opts.Params()
+		if err != nil {
+			return err
+		}
 		lblistenerrule, err := modules.LoadbalancerListenerRules.Create(s, params)
 		if err != nil {
 			return err
@@ -53,7 +54,10 @@ func init() {
 		return nil
 	})
 	R(&options.LoadbalancerListenerRuleUpdateOptions{}, "lblistenerrule-update", "Update lblistenerrule", func(s *mcclient.ClientSession, opts *options.LoadbalancerListenerRuleUpdateOptions) error {
-		params, err := options.StructToParams(opts)
+		params, err := opts.Params()
+		if err != nil {
+			return err
+		}
 		lblistenerrule, err := modules.LoadbalancerListenerRules.Update(s, opts.ID, params)
 		if err != nil {
 			return err
@@ -89,4 +93,28 @@ func init() {
 		printObject(lblistenerrule)
 		return nil
 	})
+	R(&options.LoadbalancerTrafficShiftOptions{}, "lblistenerrule-traffic-shift", "Shift traffic of lblistenerrule to another backend group gradually", func(s *mcclient.ClientSession, opts *options.LoadbalancerTrafficShiftOptions) error {
+		params, err := options.StructToParams(opts)
+		if err != nil {
+			return err
+		}
+		lblistenerrule, err := modules.LoadbalancerListenerRules.PerformAction(s, opts.ID, "traffic-shift", params)
+		if err != nil {
+			return err
+		}
+		printObject(lblistenerrule)
+		return nil
+	})
+	R(&options.LoadbalancerTrafficShiftCancelOptions{}, "lblistenerrule-traffic-shift-cancel", "Cancel running traffic shift of lblistenerrule", func(s *mcclient.ClientSession, opts *options.LoadbalancerTrafficShiftCancelOptions) error {
+		params, err := options.StructToParams(opts)
+		if err != nil {
+			return err
+		}
+		lblistenerrule, err := modules.LoadbalancerListenerRules.PerformAction(s, opts.ID, "traffic-shift-cancel", params)
+		if err != nil {
+			return err
+		}
+		printObject(lblistenerrule)
+		return nil
+	})
 }
@@ -15,8 +15,6 @@
 package shell
 
 import (
-	"yunion.io/x/jsonutils"
-
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/modules"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
@@ -25,8 +23,10 @@ import (
 func init() {
 
 	R(&options.LoadbalancerListenerCreateOptions{}, "lblistener-create", "Create lblistener", func(s *mcclient.ClientSession, opts *options.LoadbalancerListenerCreateOptions) error {
-		// TODO make a generic one
-		params := jsonutils.Marshal(opts)
+		params, err := opts.Params()
+		if err != nil {
+			return err
+		}
 		lblistener, err := modules.LoadbalancerListeners.Create(s, params)
 		if err != nil {
 			return err
@@ -55,7 +55,10 @@ func init() {
 		return nil
 	})
 	R(&options.LoadbalancerListenerUpdateOptions{}, "lblistener-update", "Update lblistener", func(s *mcclient.ClientSession, opts *options.LoadbalancerListenerUpdateOptions) error {
-		params, err := options.StructToParams(opts)
+		params, err := opts.Params()
+		if err != nil {
+			return err
+		}
 		lblistener, err := modules.LoadbalancerListeners.Update(s, opts.ID, params)
 		if err != nil {
 			return err
@@ -99,4 +102,28 @@ func init() {
 		printObject(lblistener)
 		return nil
 	})
+	R(&options.LoadbalancerTrafficShiftOptions{}, "lblistener-traffic-shift", "Shift traffic of lblistener to another backend group gradually", func(s *mcclient.ClientSession, opts *options.LoadbalancerTrafficShiftOptions) error {
+		params, err := options.StructToParams(opts)
+		if err != nil {
+			return err
+		}
+		lblistener, err := modules.LoadbalancerListeners.PerformAction(s, opts.ID, "traffic-shift", params)
+		if err != nil {
+			return err
+		}
+		printObject(lblistener)
+		return nil
+	})
+	R(&options.LoadbalancerTrafficShiftCancelOptions{}, "lblistener-traffic-shift-cancel", "Cancel running traffic shift of lblistener", func(s *mcclient.ClientSession, opts *options.LoadbalancerTrafficShiftCancelOptions) error {
+		params, err := options.StructToParams(opts)
+		if err != nil {
+			return err
+		}
+		lblistener, err := modules.LoadbalancerListeners.PerformAction(s, opts.ID, "traffic-shift-cancel", params)
+		if err != nil {
+			return err
+		}
+		printObject(lblistener)
+		return nil
+	})
 }
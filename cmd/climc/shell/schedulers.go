@@ -57,6 +57,20 @@ func init() {
 			return nil
 		})
 
+	R(&options.SchedulerSimulateOptions{}, "scheduler-simulate", "Simulate how many servers of skus fit if hosts are removed or added",
+		func(s *mcclient.ClientSession, args *options.SchedulerSimulateOptions) error {
+			params, err := args.Params(s)
+			if err != nil {
+				return err
+			}
+			result, err := modules.SchedManager.Simulate(s, params)
+			if err != nil {
+				return err
+			}
+			fmt.Println(result.YAMLString())
+			return nil
+		})
+
 	type SchedulerCandidateListOptions struct {
 		Type   string `help:"Sched type filter" choices:"baremetal|host"`
 		Region string `help:"Cloud region ID"`
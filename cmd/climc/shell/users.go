@@ -246,6 +246,9 @@ func init() {
 		Enabled     bool   `help:"Enabled"`
 		Disabled    bool   `help:"Disabled"`
 
+		MfaRequired bool `help:"Require a second factor to login"`
+		MfaOptional bool `help:"Do not require a second factor to login"`
+
 		DefaultProject string `help:"Default project"`
 		// Option []string `help:"User options"`
 	}
@@ -286,6 +289,11 @@ func init() {
 		} else if !args.Enabled && args.Disabled {
 			params.Add(jsonutils.JSONFalse, "enabled")
 		}
+		if args.MfaRequired && !args.MfaOptional {
+			params.Add(jsonutils.JSONTrue, "mfa_required")
+		} else if !args.MfaRequired && args.MfaOptional {
+			params.Add(jsonutils.JSONFalse, "mfa_required")
+		}
 		if len(args.DefaultProject) > 0 {
 			projId, err := modules.Projects.GetId(s, args.DefaultProject, nil)
 			if err != nil {
@@ -352,4 +360,71 @@ func init() {
 		return nil
 	})
 
+	type UserTotpOptions struct {
+		ID       string `help:"ID or name of the user"`
+		Domain   string `help:"Domain"`
+		Passcode string `help:"Current TOTP passcode or a recovery code"`
+	}
+	userTotpAction := func(s *mcclient.ClientSession, args *UserTotpOptions, action string) error {
+		query := jsonutils.NewDict()
+		if len(args.Domain) > 0 {
+			domainId, err := modules.Domains.GetId(s, args.Domain, nil)
+			if err != nil {
+				return err
+			}
+			query.Add(jsonutils.NewString(domainId), "domain_id")
+		}
+		uid, err := modules.UsersV3.GetId(s, args.ID, query)
+		if err != nil {
+			return err
+		}
+		params := jsonutils.NewDict()
+		if len(args.Passcode) > 0 {
+			params.Add(jsonutils.NewString(args.Passcode), "passcode")
+		}
+		result, err := modules.UsersV3.PerformAction(s, uid, action, params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	}
+	R(&UserTotpOptions{}, "user-totp-enroll", "Generate a TOTP secret for user, output the provisioning uri to render as QR code", func(s *mcclient.ClientSession, args *UserTotpOptions) error {
+		return userTotpAction(s, args, "totp-enroll")
+	})
+	R(&UserTotpOptions{}, "user-totp-confirm", "Enable the enrolled TOTP secret of user with a passcode, output recovery codes", func(s *mcclient.ClientSession, args *UserTotpOptions) error {
+		return userTotpAction(s, args, "totp-confirm")
+	})
+	R(&UserTotpOptions{}, "user-totp-recovery-codes", "Regenerate TOTP recovery codes of user", func(s *mcclient.ClientSession, args *UserTotpOptions) error {
+		return userTotpAction(s, args, "totp-recovery-codes")
+	})
+	R(&UserTotpOptions{}, "user-totp-disable", "Disable TOTP of user", func(s *mcclient.ClientSession, args *UserTotpOptions) error {
+		return userTotpAction(s, args, "totp-disable")
+	})
+
+	type UserUnlockOptions struct {
+		ID     string `help:"ID or name of the user"`
+		Domain string `help:"Domain"`
+	}
+	R(&UserUnlockOptions{}, "user-unlock", "Unlock a user locked out by too many failed logins", func(s *mcclient.ClientSession, args *UserUnlockOptions) error {
+		query := jsonutils.NewDict()
+		if len(args.Domain) > 0 {
+			domainId, err := modules.Domains.GetId(s, args.Domain, nil)
+			if err != nil {
+				return err
+			}
+			query.Add(jsonutils.NewString(domainId), "domain_id")
+		}
+		uid, err := modules.UsersV3.GetId(s, args.ID, query)
+		if err != nil {
+			return err
+		}
+		result, err := modules.UsersV3.PerformAction(s, uid, "unlock", nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
 }
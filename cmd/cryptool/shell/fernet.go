@@ -16,6 +16,7 @@ package shell
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"yunion.io/x/pkg/util/timeutils"
@@ -60,7 +61,7 @@ func init() {
 	type FernetEncryptTokenOptions struct {
 		PATH      string `help:"path that stores fernet keys"`
 		USERID    string `help:"UserId"`
-		METHOD    string `help:"auth method" choices:"password|token"`
+		METHOD    string `help:"auth methods separated by comma, e.g. password,totp"`
 		EXPIREAT  string `help:"expired time"`
 		ProjectId string `help:"project Id"`
 		DomainId  string `help:"domainId"`
@@ -69,7 +70,7 @@ func init() {
 	shellutils.R(&FernetEncryptTokenOptions{}, "fernet-encrypt-token", "Encrypt auth token with fernet keys", func(args *FernetEncryptTokenOptions) error {
 		token := tokens.SAuthToken{}
 		token.UserId = args.USERID
-		token.Method = args.METHOD
+		token.Methods = strings.Split(args.METHOD, ",")
 		token.ProjectId = args.ProjectId
 		token.DomainId = args.DomainId
 		token.ExpiresAt, _ = timeutils.ParseFullIsoTime(args.EXPIREAT)
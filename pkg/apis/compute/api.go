@@ -127,6 +127,12 @@ type ServerConfigs struct {
 	IsolatedDevices      []*IsolatedDeviceConfig `json:"isolated_devices"`
 	BaremetalDiskConfigs []*BaremetalDiskConfig  `json:"baremetal_disk_configs"`
 
+	// NumaSingleNode place all vcpus and memory of guest inside one NUMA node
+	NumaSingleNode bool `json:"numa_single_node"`
+	// DedicatedCpu pin vcpus to dedicated pCPUs and back memory with
+	// hugepages, implies NumaSingleNode
+	DedicatedCpu bool `json:"dedicated_cpu"`
+
 	// DEPRECATE
 	Suggestion bool `json:"suggestion"`
 }
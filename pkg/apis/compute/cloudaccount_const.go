@@ -38,6 +38,7 @@ const (
 	CLOUD_PROVIDER_OPENSTACK = "OpenStack"
 	CLOUD_PROVIDER_UCLOUD    = "Ucloud"
 	CLOUD_PROVIDER_ZSTACK    = "ZStack"
+	CLOUD_PROVIDER_S3        = "S3"
 
 	CLOUD_PROVIDER_HEALTH_NORMAL       = "normal"       // 远端处于健康状态
 	CLOUD_PROVIDER_HEALTH_INSUFFICIENT = "insufficient" // 不足按需资源余额
@@ -60,6 +61,7 @@ var (
 		CLOUD_PROVIDER_OPENSTACK,
 		CLOUD_PROVIDER_UCLOUD,
 		CLOUD_PROVIDER_ZSTACK,
+		CLOUD_PROVIDER_S3,
 	}
 )
 
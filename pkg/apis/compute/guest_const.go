@@ -38,6 +38,8 @@ const (
 	VM_STOP_FAILED     = "stop_fail" // # = running
 	VM_RENEWING        = "renewing"
 	VM_RENEW_FAILED    = "renew_failed"
+	VM_PANICKED        = "panicked" // guest kernel panic reported by pvpanic device
+	VM_IO_ERROR        = "io_error" // paused by qemu on disk io error, e.g. ENOSPC
 
 	VM_BACKUP_STARTING         = "backup_starting"
 	VM_BACKUP_CREATING         = "backup_creating"
@@ -130,6 +132,20 @@ const (
 	HYPERVISOR_DEFAULT = HYPERVISOR_KVM
 )
 
+// qemu monitor events reported by host
+const (
+	QMP_EVENT_SHUTDOWN            = "SHUTDOWN"
+	QMP_EVENT_RESET               = "RESET"
+	QMP_EVENT_STOP                = "STOP"
+	QMP_EVENT_RESUME              = "RESUME"
+	QMP_EVENT_BLOCK_JOB_READY     = "BLOCK_JOB_READY"
+	QMP_EVENT_BLOCK_JOB_COMPLETED = "BLOCK_JOB_COMPLETED"
+	QMP_EVENT_BLOCK_JOB_ERROR     = "BLOCK_JOB_ERROR"
+	QMP_EVENT_BLOCK_IO_ERROR      = "BLOCK_IO_ERROR"
+	QMP_EVENT_GUEST_PANICKED      = "GUEST_PANICKED"
+	QMP_EVENT_DEVICE_DELETED      = "DEVICE_DELETED"
+)
+
 var VM_RUNNING_STATUS = []string{VM_START_START, VM_STARTING, VM_RUNNING, VM_BLOCK_STREAM}
 var VM_CREATING_STATUS = []string{VM_CREATE_NETWORK, VM_CREATE_DISK, VM_START_DEPLOY, VM_DEPLOYING}
 
@@ -204,4 +220,9 @@ const (
 	VM_METADATA_OS_DISTRO           = "os_distribution"
 	VM_METADATA_OS_NAME             = "os_name"
 	VM_METADATA_OS_VERSION          = "os_version"
+
+	VM_METADATA_NUMA_SINGLE_NODE = "numa_single_node"
+	VM_METADATA_DEDICATED_CPU    = "dedicated_cpu"
+	// NUMA node the guest is bound to, reported by host after guest started
+	VM_METADATA_NUMA_NODE = "__numa_node"
 )
@@ -172,6 +172,52 @@ var LB_TLS_CERT_PUBKEY_ALGOS = choices.NewChoices(
 	LB_TLS_CERT_PUBKEY_ALGO_ECDSA,
 )
 
+const (
+	LB_RULE_ACTION_FORWARD        = "forward"
+	LB_RULE_ACTION_REDIRECT       = "redirect"
+	LB_RULE_ACTION_FIXED_RESPONSE = "fixed_response"
+)
+
+var LB_RULE_ACTIONS = choices.NewChoices(
+	LB_RULE_ACTION_FORWARD,
+	LB_RULE_ACTION_REDIRECT,
+	LB_RULE_ACTION_FIXED_RESPONSE,
+)
+
+var LB_RULE_REDIRECT_CODES = []int{301, 302, 303, 307, 308}
+
+var LB_RULE_HTTP_METHODS = choices.NewChoices(
+	"GET",
+	"HEAD",
+	"POST",
+	"PUT",
+	"DELETE",
+	"PATCH",
+	"OPTIONS",
+)
+
+const (
+	LB_CERT_SOURCE_UPLOAD = "upload"
+	LB_CERT_SOURCE_ACME   = "acme"
+)
+
+var LB_CERT_SOURCES = choices.NewChoices(
+	LB_CERT_SOURCE_UPLOAD,
+	LB_CERT_SOURCE_ACME,
+)
+
+const (
+	LB_CERT_STATUS_ACME_RENEWING     = "acme_renewing"
+	LB_CERT_STATUS_ACME_RENEW_FAILED = "acme_renew_failed"
+)
+
+const (
+	LB_TRAFFIC_SHIFT_STATUS_RUNNING     = "running"
+	LB_TRAFFIC_SHIFT_STATUS_COMPLETED   = "completed"
+	LB_TRAFFIC_SHIFT_STATUS_ROLLED_BACK = "rolled_back"
+	LB_TRAFFIC_SHIFT_STATUS_CANCELLED   = "cancelled"
+)
+
 // TODO may want extra for legacy apps
 const (
 	LB_TLS_CIPHER_POLICY_1_0        = "tls_cipher_policy_1_0"
@@ -305,6 +351,18 @@ var LB_BACKEND_ROLES = choices.NewChoices(
 	LB_BACKEND_ROLE_SLAVE,
 )
 
+const (
+	LB_BACKEND_HEALTH_STATUS_UP      = "up"
+	LB_BACKEND_HEALTH_STATUS_DOWN    = "down"
+	LB_BACKEND_HEALTH_STATUS_UNKNOWN = "unknown"
+)
+
+var LB_BACKEND_HEALTH_STATUSES = choices.NewChoices(
+	LB_BACKEND_HEALTH_STATUS_UP,
+	LB_BACKEND_HEALTH_STATUS_DOWN,
+	LB_BACKEND_HEALTH_STATUS_UNKNOWN,
+)
+
 const (
 	LB_CHARGE_TYPE_BY_TRAFFIC   = "traffic"
 	LB_CHARGE_TYPE_BY_BANDWIDTH = "bandwidth"
@@ -0,0 +1,52 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package identity
+
+import "strings"
+
+const (
+	AccessRuleAny = "*"
+)
+
+// SAccessRule restricts a token issued for an application credential to the
+// API of a service, optionally to one HTTP method. Service is a service type
+// such as compute or image, * matches any service or method
+type SAccessRule struct {
+	Service string `json:"service"`
+	Method  string `json:"method,omitempty"`
+}
+
+func (rule SAccessRule) Match(service string, method string) bool {
+	if rule.Service != AccessRuleAny && rule.Service != service {
+		return false
+	}
+	if len(rule.Method) > 0 && rule.Method != AccessRuleAny && !strings.EqualFold(rule.Method, method) {
+		return false
+	}
+	return true
+}
+
+// IsAccessAllowed tells whether a request is allowed by a list of access
+// rules, an empty list imposes no restriction
+func IsAccessAllowed(rules []SAccessRule, service string, method string) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	for i := range rules {
+		if rules[i].Match(service, method) {
+			return true
+		}
+	}
+	return false
+}
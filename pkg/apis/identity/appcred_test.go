@@ -0,0 +1,44 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package identity
+
+import "testing"
+
+func TestIsAccessAllowed(t *testing.T) {
+	rules := []SAccessRule{
+		{Service: "compute", Method: "GET"},
+		{Service: "image"},
+	}
+	cases := []struct {
+		rules   []SAccessRule
+		service string
+		method  string
+		want    bool
+	}{
+		{nil, "compute", "DELETE", true},
+		{rules, "compute", "GET", true},
+		{rules, "compute", "get", true},
+		{rules, "compute", "POST", false},
+		{rules, "image", "DELETE", true},
+		{rules, "identity", "GET", false},
+		{[]SAccessRule{{Service: AccessRuleAny, Method: "GET"}}, "identity", "GET", true},
+		{[]SAccessRule{{Service: AccessRuleAny, Method: "GET"}}, "identity", "PUT", false},
+	}
+	for _, c := range cases {
+		got := IsAccessAllowed(c.rules, c.service, c.method)
+		if got != c.want {
+			t.Errorf("IsAccessAllowed(%v, %s, %s) = %v, want %v", c.rules, c.service, c.method, got, c.want)
+		}
+	}
+}
@@ -46,3 +46,76 @@ type SDomainLDAPConfigOptions struct {
 	GroupMemberAttribute string `json:"group_member_attribute,omitempty"`
 	GroupMembersAreIds   bool   `json:"group_members_are_ids,allowfalse"`
 }
+
+type SDomainOIDCConfigOptions struct {
+	Issuer       string   `json:"issuer,omitempty" help:"OpenID provider issuer URL" required:"true"`
+	ClientId     string   `json:"client_id,omitempty" required:"true"`
+	ClientSecret string   `json:"client_secret,omitempty" required:"true"`
+	Scopes       []string `json:"scopes,omitempty" help:"Extra scopes besides openid" token:"scope"`
+	RedirectUri  string   `json:"redirect_uri,omitempty" help:"Callback URL registered at the provider, i.e. <keystone>/v3/auth/OS-FEDERATION/domains/<domain_id>/oidc/callback" required:"true"`
+
+	UserIdClaim   string `json:"user_id_claim,omitempty" help:"Claim identifying the user at the provider, default sub"`
+	UserNameClaim string `json:"user_name_claim,omitempty" help:"Claim used as local user name unless mapped, default preferred_username"`
+}
+
+type SDomainSAMLConfigOptions struct {
+	EntityId       string `json:"entity_id,omitempty" help:"Entity ID of keystone as service provider" required:"true"`
+	IdpEntityId    string `json:"idp_entity_id,omitempty" help:"Entity ID of the identity provider" required:"true"`
+	IdpSsoUrl      string `json:"idp_sso_url,omitempty" help:"SSO URL of the identity provider with HTTP-Redirect binding" required:"true"`
+	IdpCertificate string `json:"idp_certificate,omitempty" help:"PEM certificate the identity provider signs with" required:"true"`
+	AcsUrl         string `json:"acs_url,omitempty" help:"Assertion consumer URL, i.e. <keystone>/v3/auth/OS-FEDERATION/domains/<domain_id>/saml/acs" required:"true"`
+
+	UserNameAttribute string `json:"user_name_attribute,omitempty" help:"Attribute used as local user name unless mapped, default NameID"`
+}
+
+// SDomainSecurityComplianceOptions are the password and lockout policies
+// of the users of a domain backed by the sql driver, kept in config group
+// security_compliance
+type SDomainSecurityComplianceOptions struct {
+	MfaRequired bool `json:"mfa_required,allowfalse" help:"Require every user of the domain to log in with a second factor"`
+
+	PasswordMinimalLength      int    `json:"password_minimal_length,omitzero" help:"Minimal length of a password"`
+	PasswordMinimalCharClasses int    `json:"password_minimal_char_classes,omitzero" help:"Minimal number of character classes, i.e. digits, lowercases, uppercases and punctuations, a password contains"`
+	PasswordRegex              string `json:"password_regex,omitempty" help:"Regular expression a password must match"`
+	PasswordRegexDescription   string `json:"password_regex_description,omitempty" help:"Description of the password regex shown to users"`
+	UniqueLastPasswordCount    int    `json:"unique_last_password_count,omitzero" help:"Number of recent passwords that cannot be reused"`
+	PasswordExpiresDays        int    `json:"password_expires_days,omitzero" help:"Days before a password expires and has to be changed"`
+	ChangePasswordUponFirstUse bool   `json:"change_password_upon_first_use,allowfalse" help:"Users must change the password set by an admin at next login"`
+	LockoutFailureAttempts     int    `json:"lockout_failure_attempts,omitzero" help:"Number of consecutive failed logins before a user is locked"`
+	LockoutDuration            int    `json:"lockout_duration,omitzero" help:"Seconds a locked user stays locked, 0 means until unlocked by an admin"`
+}
+
+// SFederationMappingRule maps the claims or attributes of a federated user,
+// in the fashion of the keystone OS-FEDERATION mapping. The rules of a
+// domain are kept as a list in option mapping of its oidc or saml config.
+// A rule applies when all its remote conditions hold. Remotes without
+// any_one_of/not_any_of capture the values of their type, referred to by
+// {0}, {1}... in the order they appear.
+type SFederationMappingRule struct {
+	Local  []SFederationMappingLocal  `json:"local"`
+	Remote []SFederationMappingRemote `json:"remote"`
+}
+
+type SFederationMappingLocal struct {
+	User     *SFederationMappingUser     `json:"user,omitempty"`
+	Groups   []string                    `json:"groups,omitempty"`
+	Projects []SFederationMappingProject `json:"projects,omitempty"`
+}
+
+type SFederationMappingUser struct {
+	Name        string `json:"name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Displayname string `json:"displayname,omitempty"`
+}
+
+type SFederationMappingProject struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+type SFederationMappingRemote struct {
+	Type     string   `json:"type"`
+	AnyOneOf []string `json:"any_one_of,omitempty"`
+	NotAnyOf []string `json:"not_any_of,omitempty"`
+	Regex    bool     `json:"regex,omitempty"`
+}
@@ -22,12 +22,22 @@ const (
 
 	AUTH_METHOD_PASSWORD = "password"
 	AUTH_METHOD_TOKEN    = "token"
+	AUTH_METHOD_TOTP     = "totp"
+	AUTH_METHOD_OPENID   = "openid"
+	AUTH_METHOD_SAML2    = "saml2"
+	AUTH_METHOD_APPCRED  = "application_credential"
 
+	// method ids are bit flags so that a token can record several methods
 	AUTH_METHOD_ID_PASSWORD = 1
 	AUTH_METHOD_ID_TOKEN    = 2
+	AUTH_METHOD_ID_TOTP     = 4
+	AUTH_METHOD_ID_OPENID   = 8
+	AUTH_METHOD_ID_SAML2    = 16
+	AUTH_METHOD_ID_APPCRED  = 32
 
 	AUTH_TOKEN_HEADER         = "X-Auth-Token"
 	AUTH_SUBJECT_TOKEN_HEADER = "X-Subject-Token"
+	AUTH_RECEIPT_HEADER       = "Openstack-Auth-Receipt"
 
 	AssignmentUserProject  = "UserProject"
 	AssignmentGroupProject = "GroupProject"
@@ -45,12 +55,31 @@ const (
 
 	IdentityDriverSQL  = "sql"
 	IdentityDriverLDAP = "ldap"
+	IdentityDriverOIDC = "oidc"
+	IdentityDriverSAML = "saml"
+
+	CredentialTypeTotp         = "totp"
+	CredentialTypeRecoveryCode = "recovery_code"
+
+	// SUserOption ids are at most 4 characters
+	UserOptionMfaRequired = "MFAR"
+
+	DomainConfigSecurityGroup     = "security_compliance"
+	DomainConfigOptionMfaRequired = "mfa_required"
+	DefaultTotpIssuer             = "OneCloud"
+	TotpRecoveryCodeCount         = 10
+
+	// a user failing the second factor this many times in a row is refused
+	// for TotpLockoutSeconds
+	TotpMaxFailedAttempts = 5
+	TotpLockoutSeconds    = 300
 )
 
 var (
-	AUTH_METHODS = []string{AUTH_METHOD_PASSWORD, AUTH_METHOD_TOKEN}
+	AUTH_METHODS = []string{AUTH_METHOD_PASSWORD, AUTH_METHOD_TOKEN, AUTH_METHOD_TOTP, AUTH_METHOD_OPENID, AUTH_METHOD_SAML2, AUTH_METHOD_APPCRED}
 
 	SensitiveDomainConfigMap = map[string]string{
 		"ldap": "password",
+		"oidc": "client_secret",
 	}
 )
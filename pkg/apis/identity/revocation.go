@@ -0,0 +1,86 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package identity
+
+import (
+	"time"
+
+	"yunion.io/x/pkg/utils"
+)
+
+// RevocationEventIdOverlap is how many events up to since the revocation
+// feed sends again.  Ids are allocated on insert, so an event may become
+// visible after those of larger ids inserted concurrently
+const RevocationEventIdOverlap = 64
+
+// SRevocationEvent revokes the tokens issued no later than IssuedBefore
+// that match all of its non-empty attributes, i.e. the tokens of a user, of
+// a project or domain, carrying a role, or the token with an audit id
+type SRevocationEvent struct {
+	Id           int64     `json:"id"`
+	UserId       string    `json:"user_id,omitempty"`
+	ProjectId    string    `json:"project_id,omitempty"`
+	DomainId     string    `json:"domain_id,omitempty"`
+	RoleId       string    `json:"role_id,omitempty"`
+	AuditId      string    `json:"audit_id,omitempty"`
+	IssuedBefore time.Time `json:"issued_before"`
+	RevokedAt    time.Time `json:"revoked_at"`
+}
+
+// STokenRevocationInfo is what a revocation event is matched against.
+// DomainIds are the domains of the user and of the scope. An unknown
+// IssuedAt or nil RoleIds never rule a token out, so that holders of
+// partial token info, e.g. token caches, err on the side of revocation
+type STokenRevocationInfo struct {
+	UserId    string
+	ProjectId string
+	DomainIds []string
+	RoleIds   []string
+	AuditIds  []string
+	IssuedAt  time.Time
+}
+
+func (event SRevocationEvent) Match(token STokenRevocationInfo) bool {
+	// IssuedAt of fernet tokens has second precision, tokens issued in the
+	// same second as the event are revoked
+	if !token.IssuedAt.IsZero() && token.IssuedAt.Truncate(time.Second).After(event.IssuedBefore.Truncate(time.Second)) {
+		return false
+	}
+	if len(event.UserId) > 0 && event.UserId != token.UserId {
+		return false
+	}
+	if len(event.ProjectId) > 0 && event.ProjectId != token.ProjectId {
+		return false
+	}
+	if len(event.DomainId) > 0 && !utils.IsInStringArray(event.DomainId, token.DomainIds) {
+		return false
+	}
+	if len(event.RoleId) > 0 && token.RoleIds != nil && !utils.IsInStringArray(event.RoleId, token.RoleIds) {
+		return false
+	}
+	if len(event.AuditId) > 0 && !utils.IsInStringArray(event.AuditId, token.AuditIds) {
+		return false
+	}
+	return true
+}
+
+// IsRevoked tells whether any of the events revokes the token
+func IsRevoked(events []SRevocationEvent, token STokenRevocationInfo) bool {
+	for i := range events {
+		if events[i].Match(token) {
+			return true
+		}
+	}
+	return false
+}
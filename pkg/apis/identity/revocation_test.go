@@ -0,0 +1,58 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package identity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSRevocationEvent_Match(t *testing.T) {
+	now := time.Now()
+	token := STokenRevocationInfo{
+		UserId:    "u1",
+		ProjectId: "p1",
+		DomainIds: []string{"default", "d1"},
+		RoleIds:   []string{"r1"},
+		AuditIds:  []string{"a1"},
+		IssuedAt:  now.Add(-time.Hour),
+	}
+	sec := now.Truncate(time.Second)
+	secToken := STokenRevocationInfo{UserId: "u1", IssuedAt: sec}
+	cases := []struct {
+		name  string
+		event SRevocationEvent
+		token STokenRevocationInfo
+		want  bool
+	}{
+		{"user", SRevocationEvent{UserId: "u1", IssuedBefore: now}, token, true},
+		{"other user", SRevocationEvent{UserId: "u2", IssuedBefore: now}, token, false},
+		{"issued later", SRevocationEvent{UserId: "u1", IssuedBefore: now.Add(-2 * time.Hour)}, token, false},
+		{"project domain", SRevocationEvent{DomainId: "d1", IssuedBefore: now}, token, true},
+		{"assignment", SRevocationEvent{UserId: "u1", ProjectId: "p1", RoleId: "r1", IssuedBefore: now}, token, true},
+		{"other role", SRevocationEvent{UserId: "u1", ProjectId: "p1", RoleId: "r2", IssuedBefore: now}, token, false},
+		{"audit id", SRevocationEvent{AuditId: "a1", IssuedBefore: now}, token, true},
+		{"other audit id", SRevocationEvent{AuditId: "a2", IssuedBefore: now}, token, false},
+		{"same second", SRevocationEvent{UserId: "u1", IssuedBefore: sec.Add(300 * time.Millisecond)}, secToken, true},
+		{"fraction of same second", SRevocationEvent{UserId: "u1", IssuedBefore: sec}, STokenRevocationInfo{UserId: "u1", IssuedAt: sec.Add(700 * time.Millisecond)}, true},
+		{"next second", SRevocationEvent{UserId: "u1", IssuedBefore: sec.Add(-300 * time.Millisecond)}, secToken, false},
+		{"unknown roles", SRevocationEvent{RoleId: "r2", IssuedBefore: now.Add(-2 * time.Hour)}, STokenRevocationInfo{UserId: "u1"}, true},
+	}
+	for _, c := range cases {
+		got := c.event.Match(c.token)
+		if got != c.want {
+			t.Errorf("%s: Match = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/etcd"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 )
 
@@ -53,9 +54,38 @@ func InitDB(options *common_options.DBOptions) {
 	}
 	sqlchemy.SetDB(dbConn)
 
-	lm := lockman.NewInMemoryLockManager()
-	// lm := lockman.NewNoopLockManager()
-	lockman.Init(lm)
+	lockman.Init(newLockManager(options, dialect, sqlStr))
+}
+
+func newLockManager(options *common_options.DBOptions, dialect, sqlStr string) lockman.ILockManager {
+	lockOpts := lockman.SDistributedLockOptions{
+		LeaseSeconds:       options.LockLeaseSeconds,
+		WaitTimeoutSeconds: options.LockWaitTimeoutSeconds,
+		HoldTimeoutSeconds: options.LockHoldTimeoutSeconds,
+	}
+	switch options.LockmanMethod {
+	case "etcd":
+		err := etcd.InitDefaultEtcdClient(&options.SEtcdOptions)
+		if err != nil {
+			log.Fatalf("Init etcd client for lock manager: %s", err)
+		}
+		log.Infof("Use etcd lock manager")
+		return lockman.NewEtcdLockManager(etcd.Default(), lockOpts)
+	case "mysql":
+		if dialect != "mysql" {
+			log.Fatalf("Mysql lock manager does not support %s", dialect)
+		}
+		// GET_LOCK is bound to connection, don't share connection pool with orm
+		lockConn, err := sql.Open(dialect, sqlStr)
+		if err != nil {
+			log.Fatalf("Open db for lock manager: %s", err)
+		}
+		lockConn.SetMaxIdleConns(0)
+		log.Infof("Use mysql lock manager")
+		return lockman.NewMysqlLockManager(lockConn, lockOpts)
+	default:
+		return lockman.NewInMemoryLockManager()
+	}
 }
 
 func CloseDB() {
@@ -75,6 +105,7 @@ func AppDBInit(app *appsrv.Application) {
 	}
 
 	app.AddDefaultHandler("GET", "/db_stats", DBStatsHandler, "db_stats")
+	app.AddDefaultHandler("GET", "/lock_stats", LockStatsHandler, "lock_stats")
 }
 
 func DBStatsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -86,3 +117,10 @@ func DBStatsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request)
 	}
 	fmt.Fprintf(w, result.String())
 }
+
+func LockStatsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	result := jsonutils.NewDict()
+	stats := lockman.GetMetrics()
+	result.Add(jsonutils.Marshal(&stats), "lock_stats")
+	fmt.Fprint(w, result.String())
+}
@@ -0,0 +1,190 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lockman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+)
+
+const (
+	DEFAULT_LOCK_LEASE_SECONDS        = 30
+	DEFAULT_LOCK_WAIT_TIMEOUT_SECONDS = 60
+	DEFAULT_LOCK_HOLD_TIMEOUT_SECONDS = 600
+
+	lockRetryInterval = time.Second
+)
+
+var ErrLockWaitTimeout = errors.New("wait lock timeout")
+
+// iLockBackend acquire a lock shared between processes, acquire block
+// until the lock is got or waitTimeout elapsed, in which case
+// ErrLockWaitTimeout is returned. The returned release function must be
+// safe to call more than once.
+type iLockBackend interface {
+	acquire(key string, waitTimeout time.Duration) (release func() error, err error)
+}
+
+type SDistributedLockOptions struct {
+	// lock is released automatically if holder process lost
+	// connection to backend longer than this
+	LeaseSeconds int
+	// wait time of a single request to backend, lock request is retried after timeout
+	WaitTimeoutSeconds int
+	// lock held longer than this is reported, it's still held as the
+	// holder is running
+	HoldTimeoutSeconds int
+}
+
+func (opts *SDistributedLockOptions) setDefaults() {
+	if opts.LeaseSeconds <= 0 {
+		opts.LeaseSeconds = DEFAULT_LOCK_LEASE_SECONDS
+	}
+	if opts.WaitTimeoutSeconds <= 0 {
+		opts.WaitTimeoutSeconds = DEFAULT_LOCK_WAIT_TIMEOUT_SECONDS
+	}
+	if opts.HoldTimeoutSeconds <= 0 {
+		opts.HoldTimeoutSeconds = DEFAULT_LOCK_HOLD_TIMEOUT_SECONDS
+	}
+}
+
+type sDistributedLockRecord struct {
+	holder  context.Context
+	depth   int
+	release func() error
+	timer   *time.Timer
+}
+
+// SDistributedLockManager serialize contexts of this process with an in memory
+// lock manager, the first lock of a context on a key is then acquired from
+// the backend, and released on the last unlock. So recursive locking of a
+// context works the same way as SInMemoryLockManager.
+type SDistributedLockManager struct {
+	local   ILockManager
+	backend iLockBackend
+	opts    SDistributedLockOptions
+
+	recordLock *sync.Mutex
+	records    map[string]*sDistributedLockRecord
+}
+
+func newDistributedLockManager(backend iLockBackend, opts SDistributedLockOptions) *SDistributedLockManager {
+	opts.setDefaults()
+	return &SDistributedLockManager{
+		local:      NewInMemoryLockManager(),
+		backend:    backend,
+		opts:       opts,
+		recordLock: &sync.Mutex{},
+		records:    make(map[string]*sDistributedLockRecord),
+	}
+}
+
+func (lockman *SDistributedLockManager) LockKey(ctx context.Context, key string) {
+	lockman.local.LockKey(ctx, key)
+
+	lockman.recordLock.Lock()
+	rec, ok := lockman.records[key]
+	if ok && rec.holder == ctx {
+		rec.depth += 1
+		lockman.recordLock.Unlock()
+		return
+	}
+	lockman.recordLock.Unlock()
+
+	release := lockman.acquire(key)
+	rec = &sDistributedLockRecord{holder: ctx, depth: 1, release: release}
+	holdTimeout := time.Duration(lockman.opts.HoldTimeoutSeconds) * time.Second
+	rec.timer = time.AfterFunc(holdTimeout, func() {
+		// releasing it behind the holder breaks mutual exclusion, backend
+		// keeps the lease alive while this process lives
+		log.Errorf("lock %s held by context %p longer than %s", key, ctx, holdTimeout)
+		metrics.holdTimeout()
+	})
+
+	lockman.recordLock.Lock()
+	lockman.records[key] = rec
+	lockman.recordLock.Unlock()
+}
+
+// acquire retry until lock is got from backend, as ILockManager can not fail
+func (lockman *SDistributedLockManager) acquire(key string) func() error {
+	start := metrics.startWait()
+	waitTimeout := time.Duration(lockman.opts.WaitTimeoutSeconds) * time.Second
+	for {
+		release, err := lockman.backend.acquire(key, waitTimeout)
+		if err == nil {
+			metrics.acquired(start)
+			return release
+		}
+		if err == ErrLockWaitTimeout {
+			metrics.waitTimeout()
+			log.Warningf("wait lock %s for %s", key, time.Since(start))
+			continue
+		}
+		metrics.error()
+		log.Errorf("acquire lock %s: %s", key, err)
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (lockman *SDistributedLockManager) UnlockKey(ctx context.Context, key string) {
+	lockman.recordLock.Lock()
+	rec, ok := lockman.records[key]
+	if !ok || rec.holder != ctx {
+		lockman.recordLock.Unlock()
+		log.Warningf("unlock an none exist lock %s????", key)
+		return
+	}
+	rec.depth -= 1
+	if rec.depth <= 0 {
+		delete(lockman.records, key)
+	}
+	lockman.recordLock.Unlock()
+
+	if rec.depth <= 0 {
+		rec.timer.Stop()
+		if err := rec.release(); err != nil {
+			metrics.error()
+			log.Errorf("release lock %s: %s", key, err)
+		}
+		metrics.released()
+	}
+	lockman.local.UnlockKey(ctx, key)
+}
+
+// onceRelease make release function safe to be called again by hold timeout
+func onceRelease(release func() error) func() error {
+	var (
+		once sync.Once
+		err  error
+	)
+	return func() error {
+		once.Do(func() {
+			err = release()
+		})
+		return err
+	}
+}
+
+func lockHolderId() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lockman
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLockBackend is shared by managers to simulate multiple processes
+type fakeLockBackend struct {
+	lock  *sync.Mutex
+	held  map[string]bool
+	calls int
+}
+
+func newFakeLockBackend() *fakeLockBackend {
+	return &fakeLockBackend{lock: &sync.Mutex{}, held: map[string]bool{}}
+}
+
+func (b *fakeLockBackend) acquire(key string, waitTimeout time.Duration) (func() error, error) {
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		b.lock.Lock()
+		if !b.held[key] {
+			b.held[key] = true
+			b.calls += 1
+			b.lock.Unlock()
+			return onceRelease(func() error {
+				b.lock.Lock()
+				defer b.lock.Unlock()
+				delete(b.held, key)
+				return nil
+			}), nil
+		}
+		b.lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil, ErrLockWaitTimeout
+}
+
+func TestDistributedLockManager(t *testing.T) {
+	backend := newFakeLockBackend()
+	opts := SDistributedLockOptions{WaitTimeoutSeconds: 1, HoldTimeoutSeconds: 60}
+	managers := []ILockManager{
+		newDistributedLockManager(backend, opts),
+		newDistributedLockManager(backend, opts),
+	}
+
+	var (
+		wg      sync.WaitGroup
+		counter int
+		inside  int
+		overlap bool
+		mu      sync.Mutex
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			lm := managers[id%2]
+			ctx := context.WithValue(context.Background(), "ID", id)
+			lm.LockKey(ctx, "key")
+			// recursive lock of the same context
+			lm.LockKey(ctx, "key")
+			mu.Lock()
+			inside += 1
+			overlap = overlap || inside > 1
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mu.Lock()
+			inside -= 1
+			counter += 1
+			mu.Unlock()
+			lm.UnlockKey(ctx, "key")
+			lm.UnlockKey(ctx, "key")
+		}(i)
+	}
+	wg.Wait()
+
+	if overlap {
+		t.Errorf("lock is held by more than one context")
+	}
+	if counter != 4 || backend.calls != 4 {
+		t.Errorf("counter %d, backend acquired %d, expect 4", counter, backend.calls)
+	}
+	if len(backend.held) != 0 {
+		t.Errorf("lock not released in backend")
+	}
+}
+
+func TestDistributedLockHoldTimeout(t *testing.T) {
+	backend := newFakeLockBackend()
+	lm := newDistributedLockManager(backend, SDistributedLockOptions{HoldTimeoutSeconds: 1})
+	ctx := context.Background()
+	lm.LockKey(ctx, "key")
+	time.Sleep(1500 * time.Millisecond)
+	backend.lock.Lock()
+	held := backend.held["key"]
+	backend.lock.Unlock()
+	if !held {
+		t.Errorf("lock should be kept by holder after hold timeout")
+	}
+	lm.UnlockKey(ctx, "key")
+	if len(backend.held) != 0 {
+		t.Errorf("lock not released in backend")
+	}
+	if m := GetMetrics(); m.HoldTimeouts == 0 {
+		t.Errorf("hold timeout not counted")
+	}
+}
+
+func TestMysqlLockName(t *testing.T) {
+	if name := mysqlLockName("guest-abc"); name != "lockman:guest-abc" {
+		t.Errorf("unexpected lock name %s", name)
+	}
+	long := mysqlLockName("guests-0123456789abcdef0123456789abcdef-networks-0123456789abcdef0123456789abcdef")
+	if len(long) > MYSQL_LOCK_NAME_MAX_LENGTH {
+		t.Errorf("lock name %s too long", long)
+	}
+}
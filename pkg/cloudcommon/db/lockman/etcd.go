@@ -0,0 +1,126 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lockman
+
+import (
+	"context"
+	"time"
+
+	"go.etcd.io/etcd/clientv3"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/etcd"
+)
+
+const ETCD_LOCK_PREFIX = "/lockman/"
+
+// sEtcdLockBackend hold a lock by creating a key attached to a lease, the
+// lease is kept alive while the lock is held, so the key vanishes if the
+// holder process dies. Waiters watch the key until it is deleted.
+type sEtcdLockBackend struct {
+	client       *etcd.SEtcdClient
+	leaseSeconds int64
+	holderId     string
+}
+
+func NewEtcdLockManager(client *etcd.SEtcdClient, opts SDistributedLockOptions) ILockManager {
+	opts.setDefaults()
+	backend := &sEtcdLockBackend{
+		client:       client,
+		leaseSeconds: int64(opts.LeaseSeconds),
+		holderId:     lockHolderId(),
+	}
+	return newDistributedLockManager(backend, opts)
+}
+
+func (b *sEtcdLockBackend) acquire(key string, waitTimeout time.Duration) (func() error, error) {
+	cli := b.client.GetClient()
+	lockKey := b.client.NamespacedKey(ETCD_LOCK_PREFIX + key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+
+	lease, err := cli.Grant(ctx, b.leaseSeconds)
+	if err != nil {
+		return nil, err
+	}
+	keepCtx, stopKeepAlive := context.WithCancel(context.Background())
+	ch, err := cli.KeepAlive(keepCtx, lease.ID)
+	if err != nil {
+		stopKeepAlive()
+		cli.Revoke(context.Background(), lease.ID)
+		return nil, err
+	}
+	go func() {
+		for range ch {
+		}
+	}()
+	release := onceRelease(func() error {
+		stopKeepAlive()
+		rctx, rcancel := context.WithTimeout(context.Background(), waitTimeout)
+		defer rcancel()
+		// revoke lease delete the lock key attached
+		_, err := cli.Revoke(rctx, lease.ID)
+		return err
+	})
+
+	for {
+		resp, err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)).
+			Then(clientv3.OpPut(lockKey, b.holderId, clientv3.WithLease(lease.ID))).
+			Else(clientv3.OpGet(lockKey)).
+			Commit()
+		if err != nil {
+			release()
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, ErrLockWaitTimeout
+			}
+			return nil, err
+		}
+		if resp.Succeeded {
+			return release, nil
+		}
+		kvs := resp.Responses[0].GetResponseRange().Kvs
+		if len(kvs) > 0 {
+			log.Debugf("lock %s is held by %s, waiting", key, kvs[0].Value)
+		}
+		if err := b.waitDelete(ctx, lockKey, resp.Header.Revision+1); err != nil {
+			release()
+			return nil, err
+		}
+	}
+}
+
+// waitDelete wait until the key is deleted after revision
+func (b *sEtcdLockBackend) waitDelete(ctx context.Context, key string, rev int64) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wch := b.client.GetClient().Watch(wctx, key, clientv3.WithRev(rev))
+	for wresp := range wch {
+		if err := wresp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range wresp.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				return nil
+			}
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrLockWaitTimeout
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lockman
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SLockMetrics counts lock operations against the distributed backend,
+// locks acquired again by the holding context are not counted
+type SLockMetrics struct {
+	Acquired int64 `json:"acquired"`
+	Released int64 `json:"released"`
+	Waiting  int64 `json:"waiting"`
+	Holding  int64 `json:"holding"`
+
+	// backend wait timed out, lock request is retried
+	WaitTimeouts int64 `json:"wait_timeouts"`
+	// lock held longer than hold timeout
+	HoldTimeouts int64 `json:"hold_timeouts"`
+	Errors       int64 `json:"errors"`
+
+	TotalWaitMs int64 `json:"total_wait_ms"`
+	MaxWaitMs   int64 `json:"max_wait_ms"`
+}
+
+var metrics SLockMetrics
+
+// GetMetrics return a snapshot of lock metrics of this process
+func GetMetrics() SLockMetrics {
+	return SLockMetrics{
+		Acquired:     atomic.LoadInt64(&metrics.Acquired),
+		Released:     atomic.LoadInt64(&metrics.Released),
+		Waiting:      atomic.LoadInt64(&metrics.Waiting),
+		Holding:      atomic.LoadInt64(&metrics.Holding),
+		WaitTimeouts: atomic.LoadInt64(&metrics.WaitTimeouts),
+		HoldTimeouts: atomic.LoadInt64(&metrics.HoldTimeouts),
+		Errors:       atomic.LoadInt64(&metrics.Errors),
+		TotalWaitMs:  atomic.LoadInt64(&metrics.TotalWaitMs),
+		MaxWaitMs:    atomic.LoadInt64(&metrics.MaxWaitMs),
+	}
+}
+
+func (m *SLockMetrics) startWait() time.Time {
+	atomic.AddInt64(&m.Waiting, 1)
+	return time.Now()
+}
+
+func (m *SLockMetrics) acquired(start time.Time) {
+	atomic.AddInt64(&m.Waiting, -1)
+	atomic.AddInt64(&m.Acquired, 1)
+	atomic.AddInt64(&m.Holding, 1)
+	waitMs := int64(time.Since(start) / time.Millisecond)
+	atomic.AddInt64(&m.TotalWaitMs, waitMs)
+	for {
+		max := atomic.LoadInt64(&m.MaxWaitMs)
+		if waitMs <= max || atomic.CompareAndSwapInt64(&m.MaxWaitMs, max, waitMs) {
+			break
+		}
+	}
+}
+
+func (m *SLockMetrics) released() {
+	atomic.AddInt64(&m.Released, 1)
+	atomic.AddInt64(&m.Holding, -1)
+}
+
+func (m *SLockMetrics) waitTimeout() {
+	atomic.AddInt64(&m.WaitTimeouts, 1)
+}
+
+func (m *SLockMetrics) holdTimeout() {
+	atomic.AddInt64(&m.HoldTimeouts, 1)
+}
+
+func (m *SLockMetrics) error() {
+	atomic.AddInt64(&m.Errors, 1)
+}
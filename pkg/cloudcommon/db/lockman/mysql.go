@@ -0,0 +1,106 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lockman
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"yunion.io/x/log"
+)
+
+const (
+	// mysql lock name is limited to 64 characters
+	MYSQL_LOCK_NAME_MAX_LENGTH = 64
+	MYSQL_LOCK_PREFIX          = "lockman:"
+)
+
+// sMysqlLockBackend use GET_LOCK of mysql, which is bound to a session, so
+// every held lock occupies a connection of db, the lock is released by mysql
+// when the connection is closed or the session times out. Session wait_timeout
+// is set to lease and the connection is pinged while lock is held. A dedicated
+// db handle should be used to avoid exhausting connections of the ORM.
+type sMysqlLockBackend struct {
+	db           *sql.DB
+	leaseSeconds int
+}
+
+func NewMysqlLockManager(db *sql.DB, opts SDistributedLockOptions) ILockManager {
+	opts.setDefaults()
+	backend := &sMysqlLockBackend{
+		db:           db,
+		leaseSeconds: opts.LeaseSeconds,
+	}
+	return newDistributedLockManager(backend, opts)
+}
+
+func mysqlLockName(key string) string {
+	name := MYSQL_LOCK_PREFIX + key
+	if len(name) > MYSQL_LOCK_NAME_MAX_LENGTH {
+		name = fmt.Sprintf("%s%x", MYSQL_LOCK_PREFIX, md5.Sum([]byte(key)))
+	}
+	return name
+}
+
+func (b *sMysqlLockBackend) acquire(key string, waitTimeout time.Duration) (func() error, error) {
+	conn, err := b.db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.ExecContext(context.Background(), "SET SESSION wait_timeout = ?", b.leaseSeconds)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	name := mysqlLockName(key)
+	var ret sql.NullInt64
+	err = conn.QueryRowContext(context.Background(), "SELECT GET_LOCK(?, ?)", name, int(waitTimeout/time.Second)).Scan(&ret)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !ret.Valid {
+		conn.Close()
+		return nil, fmt.Errorf("GET_LOCK %s error", name)
+	}
+	if ret.Int64 == 0 {
+		conn.Close()
+		return nil, ErrLockWaitTimeout
+	}
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(b.leaseSeconds) * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := conn.PingContext(context.Background()); err != nil {
+					log.Errorf("keepalive lock %s: %s", name, err)
+				}
+			}
+		}
+	}()
+	return onceRelease(func() error {
+		close(stop)
+		defer conn.Close()
+		_, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", name)
+		return err
+	}), nil
+}
@@ -63,6 +63,9 @@ const (
 	ACT_STOP      = "stop"
 	ACT_STOP_FAIL = "stop_fail"
 
+	ACT_RESTART      = "restart"
+	ACT_RESTART_FAIL = "restart_fail"
+
 	ACT_RESIZING    = "resizing"
 	ACT_RESIZE      = "resize"
 	ACT_RESIZE_FAIL = "resize_fail"
@@ -204,6 +207,31 @@ const (
 	ACT_HOST_IMPORT_LIBVIRT_SERVERS_FAIL = "host_import_libvirt_servers_fail"
 	ACT_GUEST_CREATE_FROM_IMPORT_SUCC    = "guest_create_from_import_succ"
 	ACT_GUEST_CREATE_FROM_IMPORT_FAIL    = "guest_create_from_import_fail"
+
+	ACT_HOST_DRAIN          = "host_drain"
+	ACT_HOST_UNDRAIN        = "host_undrain"
+	ACT_REBALANCE_RECOMMEND = "rebalance_recommend"
+
+	ACT_CERT_RENEW      = "cert_renew"
+	ACT_CERT_RENEW_FAIL = "cert_renew_fail"
+
+	ACT_TRAFFIC_SHIFT          = "traffic_shift"
+	ACT_TRAFFIC_SHIFT_ROLLBACK = "traffic_shift_rollback"
+
+	ACT_GUEST_SHUTDOWN       = "guest_shutdown"
+	ACT_GUEST_RESET          = "guest_reset"
+	ACT_GUEST_PAUSE          = "guest_pause"
+	ACT_GUEST_RESUME         = "guest_resume"
+	ACT_GUEST_PANICKED       = "guest_panicked"
+	ACT_GUEST_BLOCK_JOB_DONE = "guest_block_job_done"
+	ACT_GUEST_BLOCK_JOB_FAIL = "guest_block_job_fail"
+	ACT_GUEST_BLOCK_IO_ERROR = "guest_block_io_error"
+	ACT_GUEST_DEVICE_DELETED = "guest_device_deleted"
+
+	ACT_UPDATE_PASSWORD = "update_password"
+	ACT_AUTH_FAIL       = "auth_fail"
+	ACT_LOCK            = "lock"
+	ACT_UNLOCK          = "unlock"
 )
 
 type SOpsLogManager struct {
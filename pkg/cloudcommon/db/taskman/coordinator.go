@@ -17,6 +17,7 @@ package taskman
 import (
 	"context"
 	"reflect"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -44,12 +45,34 @@ var ITaskType reflect.Type
 var IBatchTaskType reflect.Type
 
 var taskTable map[string]reflect.Type
+var taskPolicyTable map[string]STaskPolicy
+
+// STaskPolicy declares how long a stage of a task class may wait for its
+// callback, and how many times the stage issuing the request is rerun
+// before the task is failed by the reaper
+type STaskPolicy struct {
+	// stage which does not finish in this duration is expired, 0 means never
+	StageTimeout time.Duration
+	// times to rerun the previous stage of an expired stage
+	MaxRetries int
+	// wait before the first retry, doubled on every further retry
+	RetryBackoff time.Duration
+}
+
+func (policy STaskPolicy) backoff(retried int) time.Duration {
+	backoff := policy.RetryBackoff
+	for i := 0; i < retried && backoff < time.Hour; i += 1 {
+		backoff *= 2
+	}
+	return backoff
+}
 
 func init() {
 	ITaskType = reflect.TypeOf((*ISingleTask)(nil)).Elem()
 	IBatchTaskType = reflect.TypeOf((*IBatchTask)(nil)).Elem()
 
 	taskTable = make(map[string]reflect.Type)
+	taskPolicyTable = make(map[string]STaskPolicy)
 }
 
 func RegisterTaskAndWorker(task interface{}, workerMan *appsrv.SWorkerManager) {
@@ -69,6 +92,16 @@ func RegisterTask(task interface{}) {
 	RegisterTaskAndWorker(task, nil)
 }
 
+func RegisterTaskWithPolicy(task interface{}, policy STaskPolicy) {
+	RegisterTaskAndWorker(task, nil)
+	taskPolicyTable[gotypes.GetInstanceTypeName(task)] = policy
+}
+
+func getTaskPolicy(taskName string) (STaskPolicy, bool) {
+	policy, ok := taskPolicyTable[taskName]
+	return policy, ok && policy.StageTimeout > 0
+}
+
 func isTaskExist(taskName string) bool {
 	_, ok := taskTable[taskName]
 	return ok
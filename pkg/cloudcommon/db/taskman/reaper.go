@@ -0,0 +1,249 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/timeutils"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const (
+	// stage being retried by the reaper, its retry count is kept when
+	// the rerun previous stage enters it again
+	TASK_RETRY_STAGE_KEY = "__retry_stage"
+
+	// separate task id and retry attempt in task id sent to remote services
+	TASK_ATTEMPT_SEPARATOR = "."
+)
+
+func (manager *STaskManager) queryOpenTasks() *sqlchemy.SQuery {
+	return manager.Query().NotIn("stage", []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+}
+
+// ListItemFilter support query stuck tasks, i.e. open tasks whose stage
+// expired, or not updated for stuck_seconds, and dead tasks
+func (manager *STaskManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*sqlchemy.SQuery, error) {
+	q, err := manager.SResourceBaseManager.ListItemFilter(ctx, q, userCred, query)
+	if err != nil {
+		return nil, err
+	}
+	if jsonutils.QueryBoolean(query, "stuck", false) {
+		q = q.NotIn("stage", []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+		q = q.IsNotNull("stage_deadline").LT("stage_deadline", timeutils.UtcNow())
+	}
+	if stuckSeconds, _ := query.Int("stuck_seconds"); stuckSeconds > 0 {
+		q = q.NotIn("stage", []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+		q = q.LT("updated_at", timeutils.UtcNow().Add(-time.Duration(stuckSeconds)*time.Second))
+	}
+	if query.Contains("dead") {
+		if jsonutils.QueryBoolean(query, "dead", false) {
+			q = q.IsTrue("is_dead")
+		} else {
+			q = q.IsFalse("is_dead")
+		}
+	}
+	if taskName, _ := query.GetString("task_name"); len(taskName) > 0 {
+		q = q.Equals("task_name", taskName)
+	}
+	return q, nil
+}
+
+// ReapExpiredTasks rerun the previous stage of tasks whose stage expired,
+// which usually issues the request whose callback never arrived, tasks
+// exhausted retries are marked dead and failed with the failure handler
+// of current stage
+func (manager *STaskManager) ReapExpiredTasks(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	q := manager.queryOpenTasks().IsNotNull("stage_deadline").LT("stage_deadline", timeutils.UtcNow())
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("fetch expired tasks fail: %s", err)
+		return
+	}
+	for i := range tasks {
+		manager.reapTask(ctx, tasks[i].Id)
+	}
+}
+
+func (manager *STaskManager) reapTask(ctx context.Context, taskId string) {
+	lockman.LockRawObject(ctx, "tasks", taskId)
+	defer lockman.ReleaseRawObject(ctx, "tasks", taskId)
+
+	// reload, the callback may arrive in the meantime
+	task := manager.fetchTask(taskId)
+	if task == nil || task.IsDead || task.StageDeadline.IsZero() || task.StageDeadline.After(timeutils.UtcNow()) {
+		return
+	}
+	if task.Stage == TASK_STAGE_COMPLETE || task.Stage == TASK_STAGE_FAILED {
+		return
+	}
+	policy, _ := getTaskPolicy(task.TaskName)
+	prevStage := task.getPrevStage()
+	if task.RetryCount < policy.MaxRetries && len(prevStage) > 0 {
+		backoff := policy.backoff(task.RetryCount)
+		log.Warningf("Task %s(%s) stage %s expired, retry %d from stage %s after %s",
+			task.TaskName, task.Id, task.Stage, task.RetryCount+1, prevStage, backoff)
+		_, err := db.Update(task, func() error {
+			params := jsonutils.NewDict()
+			params.Update(task.Params)
+			params.Set(TASK_RETRY_STAGE_KEY, jsonutils.NewString(task.Stage))
+			task.Params = params
+			task.Stage = prevStage
+			task.RetryCount += 1
+			task.StageDeadline = timeutils.UtcNow().Add(backoff + policy.StageTimeout)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("update task %s fail: %s", task.Id, err)
+			return
+		}
+		time.AfterFunc(backoff, func() {
+			runTask(taskId, nil)
+		})
+		return
+	}
+	reason := fmt.Sprintf("stage %s timeout after %d retries", task.Stage, task.RetryCount)
+	log.Errorf("Task %s(%s) %s, give up", task.TaskName, task.Id, reason)
+	_, err := db.Update(task, func() error {
+		task.IsDead = true
+		task.StageDeadline = time.Time{}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("update task %s fail: %s", task.Id, err)
+		return
+	}
+	body := jsonutils.NewDict()
+	body.Add(jsonutils.NewString("error"), "__status__")
+	body.Add(jsonutils.NewString(reason), "__reason__")
+	runTask(taskId, body)
+}
+
+// callbackId tag task id with retry attempt, so callbacks of requests
+// issued by an expired attempt can be told apart
+func (self *STask) callbackId() string {
+	if self.RetryCount == 0 {
+		return self.Id
+	}
+	return fmt.Sprintf("%s%s%d", self.Id, TASK_ATTEMPT_SEPARATOR, self.RetryCount)
+}
+
+// parseCallbackId split task id and retry attempt tagged by callbackId,
+// untagged id is the first attempt
+func parseCallbackId(callbackId string) (string, int) {
+	idx := strings.LastIndex(callbackId, TASK_ATTEMPT_SEPARATOR)
+	if idx < 0 {
+		return callbackId, 0
+	}
+	attempt, err := strconv.Atoi(callbackId[idx+1:])
+	if err != nil {
+		return callbackId, 0
+	}
+	return callbackId[:idx], attempt
+}
+
+// isStaleCallback tells whether a remote callback comes from an attempt
+// given up by the reaper, running it would repeat the side effects of
+// current stage
+func (self *STask) isStaleCallback(attempt int) bool {
+	retryStage, _ := self.Params.GetString(TASK_RETRY_STAGE_KEY)
+	if len(retryStage) > 0 && retryStage != self.Stage {
+		// previous stage is waiting to rerun
+		return true
+	}
+	return attempt != self.RetryCount
+}
+
+// getPrevStage return the stage entered before current stage
+func (self *STask) getPrevStage() string {
+	stages, _ := self.Params.GetArray("__stages")
+	if len(stages) == 0 {
+		return ""
+	}
+	name, _ := stages[len(stages)-1].GetString("name")
+	return name
+}
+
+func (self *STask) getStageHistory() []string {
+	names := []string{TASK_INIT_STAGE}
+	stages, _ := self.Params.GetArray("__stages")
+	for _, stage := range stages {
+		name, _ := stage.GetString("name")
+		if len(name) > 0 && !utils.IsInStringArray(name, names) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (self *STask) AllowPerformRetry(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, self, "retry")
+}
+
+// PerformRetry rerun a stuck, dead or failed task from a stage it has
+// entered before, default to the stage before current one
+func (self *STask) PerformRetry(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if self.Stage == TASK_STAGE_COMPLETE {
+		return nil, httperrors.NewInvalidStatusError("task %s has completed", self.Id)
+	}
+	stage, _ := data.GetString("stage")
+	if len(stage) == 0 {
+		stage = self.getPrevStage()
+	}
+	if len(stage) == 0 || stage == TASK_STAGE_FAILED || !utils.IsInStringArray(stage, self.getStageHistory()) {
+		return nil, httperrors.NewInputParameterError("task %s never entered stage %s", self.Id, stage)
+	}
+	taskType, ok := taskTable[self.TaskName]
+	if !ok {
+		return nil, httperrors.NewNotFoundError("task %s not found", self.TaskName)
+	}
+	taskValue := reflect.New(taskType)
+	if !taskValue.MethodByName(stage).IsValid() && !taskValue.MethodByName(utils.Kebab2Camel(stage, "_")).IsValid() {
+		return nil, httperrors.NewInputParameterError("stage %s not found in task %s", stage, self.TaskName)
+	}
+
+	lockman.LockRawObject(ctx, "tasks", self.Id)
+	defer lockman.ReleaseRawObject(ctx, "tasks", self.Id)
+
+	_, err := db.Update(self, func() error {
+		self.Stage = stage
+		self.IsDead = false
+		self.RetryCount = 0
+		self.StageDeadline = stageDeadline(self.TaskName, stage)
+		self.Params = self.Params.CopyExcludes("__failed_reason", TASK_RETRY_STAGE_KEY)
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	log.Infof("Task %s(%s) retry from stage %s by %s", self.TaskName, self.Id, stage, userCred.GetUserName())
+	runTask(self.Id, nil)
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package taskman
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/appctx"
+)
+
+func TestTaskPolicyBackoff(t *testing.T) {
+	policy := STaskPolicy{RetryBackoff: 10 * time.Second}
+	cases := []struct {
+		retried int
+		want    time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{3, 80 * time.Second},
+		// doubling stops once backoff reaches an hour
+		{20, 10 * time.Second * 512},
+	}
+	for _, c := range cases {
+		if got := policy.backoff(c.retried); got != c.want {
+			t.Errorf("retried %d: want %s got %s", c.retried, c.want, got)
+		}
+	}
+}
+
+func TestCallbackId(t *testing.T) {
+	task := &STask{Id: "0b5c5b0e-6a59-4d4b-8a62-4e0c3f7b9d11"}
+	if got := task.callbackId(); got != task.Id {
+		t.Errorf("first attempt should not be tagged, got %s", got)
+	}
+	task.RetryCount = 2
+	id, attempt := parseCallbackId(task.callbackId())
+	if id != task.Id || attempt != 2 {
+		t.Errorf("want %s attempt 2, got %s attempt %d", task.Id, id, attempt)
+	}
+	id, attempt = parseCallbackId(task.Id)
+	if id != task.Id || attempt != 0 {
+		t.Errorf("want %s attempt 0, got %s attempt %d", task.Id, id, attempt)
+	}
+	id, attempt = parseCallbackId("task.name")
+	if id != "task.name" || attempt != 0 {
+		t.Errorf("invalid attempt should be kept in id, got %s attempt %d", id, attempt)
+	}
+}
+
+func TestFetchTaskParamsParentTaskId(t *testing.T) {
+	parent := &STask{Id: "0b5c5b0e-6a59-4d4b-8a62-4e0c3f7b9d11", RetryCount: 1}
+	ctx := context.WithValue(context.Background(), appctx.APP_CONTEXT_KEY_TASK_ID, parent.callbackId())
+	params := fetchTaskParams(ctx, "SubTask", nil, "", "", nil)
+	if got, _ := params.GetString(PARENT_TASK_ID_KEY); got != parent.Id {
+		t.Errorf("want parent task id %s, got %s", parent.Id, got)
+	}
+}
+
+func TestIsStaleCallback(t *testing.T) {
+	cases := []struct {
+		name       string
+		stage      string
+		retryStage string
+		retryCount int
+		attempt    int
+		want       bool
+	}{
+		{"first attempt", "OnDeployComplete", "", 0, 0, false},
+		{"late callback after stage moved on", "OnDeployComplete", "", 0, 1, true},
+		{"waiting previous stage rerun", "OnInit", "OnDeployComplete", 1, 0, true},
+		{"expired attempt", "OnDeployComplete", "OnDeployComplete", 1, 0, true},
+		{"current attempt", "OnDeployComplete", "OnDeployComplete", 1, 1, false},
+	}
+	for _, c := range cases {
+		task := &STask{Stage: c.stage, RetryCount: c.retryCount, Params: jsonutils.NewDict()}
+		if len(c.retryStage) > 0 {
+			task.Params.Set(TASK_RETRY_STAGE_KEY, jsonutils.NewString(c.retryStage))
+		}
+		if got := task.isStaleCallback(c.attempt); got != c.want {
+			t.Errorf("%s: want %v got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestGetStageHistory(t *testing.T) {
+	task := &STask{Params: jsonutils.NewDict()}
+	if prev := task.getPrevStage(); prev != "" {
+		t.Errorf("want no previous stage, got %s", prev)
+	}
+	stages := jsonutils.NewArray()
+	for _, name := range []string{TASK_INIT_STAGE, "OnStartComplete", TASK_INIT_STAGE, "OnDeployComplete"} {
+		stage := jsonutils.NewDict()
+		stage.Set("name", jsonutils.NewString(name))
+		stages.Add(stage)
+	}
+	task.Params.Set("__stages", stages)
+	if prev := task.getPrevStage(); prev != "OnDeployComplete" {
+		t.Errorf("want previous stage OnDeployComplete, got %s", prev)
+	}
+	history := task.getStageHistory()
+	want := []string{TASK_INIT_STAGE, "OnStartComplete", "OnDeployComplete"}
+	if len(history) != len(want) {
+		t.Fatalf("want %v got %v", want, history)
+	}
+	for i := range want {
+		if history[i] != want[i] {
+			t.Errorf("want %v got %v", want, history)
+		}
+	}
+}
@@ -82,6 +82,12 @@ type STask struct {
 
 	Stage string `width:"64" charset:"ascii" nullable:"false" default:"on_init" list:"user"` // Column(VARCHAR(64, charset='ascii'), nullable=False, default='on_init')
 
+	// set for task classes registered with a stage timeout, see STaskPolicy
+	StageDeadline time.Time `nullable:"true" list:"user"`
+	RetryCount    int       `nullable:"false" default:"0" list:"user"`
+	// task expired after retries exhausted, or failed by the reaper
+	IsDead bool `nullable:"false" default:"false" list:"user"`
+
 	taskObject  db.IStandaloneModel   `ignore:"true"`
 	taskObjects []db.IStandaloneModel `ignore:"true"`
 }
@@ -111,7 +117,13 @@ func (manager *STaskManager) AllowPerformAction(ctx context.Context, userCred mc
 }
 
 func (manager *STaskManager) PerformAction(ctx context.Context, userCred mcclient.TokenCredential, taskId string, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
-	runTask(taskId, data)
+	taskId, attempt := parseCallbackId(taskId)
+	if task := manager.fetchTask(taskId); task != nil && task.isStaleCallback(attempt) {
+		log.Warningf("Task %s(%s) ignore callback of attempt %d at stage %s retry %d",
+			task.TaskName, task.Id, attempt, task.Stage, task.RetryCount)
+	} else {
+		runTask(taskId, data)
+	}
 	resp := jsonutils.NewDict()
 	// 'result': 'ok'
 	resp.Add(jsonutils.NewString("ok"), "result")
@@ -185,7 +197,9 @@ func fetchTaskParams(ctx context.Context, taskName string, taskData *jsonutils.J
 	} else {
 		if !reqContext.IsZero() {
 			if len(reqContext.TaskId) > 0 && len(reqContext.TaskNotifyUrl) == 0 {
-				data.Add(jsonutils.NewString(reqContext.TaskId), PARENT_TASK_ID_KEY)
+				// task id of request header is tagged with attempt
+				parentTaskId, _ := parseCallbackId(reqContext.TaskId)
+				data.Add(jsonutils.NewString(parentTaskId), PARENT_TASK_ID_KEY)
 			}
 			if len(reqContext.TaskNotifyUrl) > 0 {
 				data.Add(jsonutils.NewString(reqContext.TaskNotifyUrl), PARENT_TASK_NOTIFY_KEY)
@@ -219,6 +233,7 @@ func (manager *STaskManager) NewTask(ctx context.Context, taskName string, obj d
 		Params:   data,
 		Stage:    TASK_INIT_STAGE,
 	}
+	task.StageDeadline = stageDeadline(taskName, TASK_INIT_STAGE)
 	err := manager.TableSpec().Insert(&task)
 	if err != nil {
 		log.Errorf("Task insert error %s", err)
@@ -261,6 +276,7 @@ func (manager *STaskManager) NewParallelTask(ctx context.Context, taskName strin
 		Params:   data,
 		Stage:    TASK_INIT_STAGE,
 	}
+	task.StageDeadline = stageDeadline(taskName, TASK_INIT_STAGE)
 	err := manager.TableSpec().Insert(&task)
 	if err != nil {
 		log.Errorf("Task insert error %s", err)
@@ -547,6 +563,13 @@ func (self *STask) SetStage(stageName string, data *jsonutils.JSONDict) error {
 			stageData.Add(jsonutils.NewTimeString(time.Now()), "complete_at")
 			stageList.Add(stageData)
 			self.Stage = stageName
+			self.StageDeadline = stageDeadline(self.TaskName, stageName)
+			// retries are counted per stage, keep them only when the
+			// reaper rerun previous stage and come back to the retried one
+			if retryStage, _ := params.GetString(TASK_RETRY_STAGE_KEY); retryStage != stageName {
+				self.RetryCount = 0
+				params = params.CopyExcludes(TASK_RETRY_STAGE_KEY)
+			}
 		}
 		self.Params = params
 		return nil
@@ -557,6 +580,15 @@ func (self *STask) SetStage(stageName string, data *jsonutils.JSONDict) error {
 	return err
 }
 
+// stageDeadline return zero time if stage of task never expires
+func stageDeadline(taskName string, stage string) time.Time {
+	policy, ok := getTaskPolicy(taskName)
+	if !ok || stage == TASK_STAGE_COMPLETE || stage == TASK_STAGE_FAILED {
+		return time.Time{}
+	}
+	return timeutils.UtcNow().Add(policy.StageTimeout)
+}
+
 func (self *STask) GetObjectIdStr() string {
 	if self.ObjId == MULTI_OBJECTS_ID {
 		return strings.Join(TaskObjectManager.GetObjectIds(self), ",")
@@ -598,6 +630,10 @@ func (self *STask) NotifyParentTaskComplete(ctx context.Context, body *jsonutils
 	log.Infof("notify_parent_task_complete: %s params %s", self.TaskName, self.Params)
 	parentTaskId, _ := self.Params.GetString(PARENT_TASK_ID_KEY)
 	parentTaskNotify, _ := self.Params.GetString(PARENT_TASK_NOTIFY_KEY)
+	if len(parentTaskId) > 0 && len(parentTaskNotify) == 0 {
+		// parent id may come from a request header tagged with attempt
+		parentTaskId, _ = parseCallbackId(parentTaskId)
+	}
 	if len(parentTaskId) > 0 {
 		subTask := SubTaskManager.GetSubTask(parentTaskId, self.Id)
 		if subTask != nil {
@@ -716,7 +752,7 @@ func (self *STask) GetObjects() []db.IStandaloneModel {
 
 func (task *STask) GetTaskRequestHeader() http.Header {
 	header := mcclient.GetTokenHeaders(task.GetUserCred())
-	header.Set(mcclient.TASK_ID, task.GetTaskId())
+	header.Set(mcclient.TASK_ID, task.callbackId())
 	return header
 }
 
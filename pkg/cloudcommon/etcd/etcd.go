@@ -152,6 +152,12 @@ func (cli *SEtcdClient) getKey(key string) string {
 	}
 }
 
+// NamespacedKey return the key with namespace prefix, for callers
+// using raw client returned by GetClient
+func (cli *SEtcdClient) NamespacedKey(key string) string {
+	return cli.getKey(key)
+}
+
 func (cli *SEtcdClient) Put(ctx context.Context, key string, val string) error {
 	return cli.put(ctx, key, val, false)
 }
@@ -29,6 +29,7 @@ import (
 	"yunion.io/x/structarg"
 
 	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/etcd"
 	"yunion.io/x/onecloud/pkg/util/atexit"
 )
 
@@ -83,6 +84,12 @@ type DBOptions struct {
 
 	GlobalVirtualResourceNamespace bool `help:"Per project namespace or global namespace for virtual resources"`
 	DebugSqlchemy                  bool `default:"false" help:"Print SQL executed by sqlchemy"`
+
+	LockmanMethod          string `help:"Lock manager, use etcd or mysql to run multiple instances of a service" default:"inmemory" choices:"inmemory|etcd|mysql"`
+	LockLeaseSeconds       int    `help:"Lock is released if its holder lost connection to lock backend longer than this" default:"30"`
+	LockWaitTimeoutSeconds int    `help:"Timeout of a single lock request to lock backend, warning is logged and request is retried" default:"60"`
+	LockHoldTimeoutSeconds int    `help:"Lock held longer than this is reported" default:"600"`
+	etcd.SEtcdOptions
 }
 
 func (this *DBOptions) GetDBConnection() (dialect, connstr string, err error) {
@@ -178,5 +178,29 @@ var (
 			Action:   PolicyActionGet,
 			Result:   rbacutils.OwnerAllow,
 		},
+		{
+			Service:  "identity",
+			Resource: "application_credentials",
+			Action:   PolicyActionList,
+			Result:   rbacutils.OwnerAllow,
+		},
+		{
+			Service:  "identity",
+			Resource: "application_credentials",
+			Action:   PolicyActionGet,
+			Result:   rbacutils.OwnerAllow,
+		},
+		{
+			Service:  "identity",
+			Resource: "application_credentials",
+			Action:   PolicyActionCreate,
+			Result:   rbacutils.OwnerAllow,
+		},
+		{
+			Service:  "identity",
+			Resource: "application_credentials",
+			Action:   PolicyActionDelete,
+			Result:   rbacutils.OwnerAllow,
+		},
 	}
 )
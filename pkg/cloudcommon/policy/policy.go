@@ -204,6 +204,7 @@ func queryKey(isAdmin bool, userCred mcclient.TokenCredential, service string, r
 		sort.Strings(roles)
 	}
 	queryKeys = append(queryKeys, strings.Join(roles, ":"))
+	queryKeys = append(queryKeys, strings.Join(userCred.GetAuthMethods(), ":"))
 	if rbacutils.WILD_MATCH == service || len(service) == 0 {
 		service = rbacutils.WILD_MATCH
 	}
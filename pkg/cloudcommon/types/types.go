@@ -53,6 +53,21 @@ type SDMIMemInfo struct {
 	Total int `json:"total"`
 }
 
+// SNumaNode describe the cpus and memory of a NUMA node of host
+type SNumaNode struct {
+	NodeId    int   `json:"node_id"`
+	Cpus      []int `json:"cpus"`
+	MemSizeMb int   `json:"mem_size_mb"`
+
+	// hugepages of default size reserved on this node
+	HugepageSizeKb int `json:"hugepage_size_kb"`
+	HugepagesTotal int `json:"hugepages_total"`
+}
+
+func (n *SNumaNode) GetHugepageMemSizeMb() int {
+	return n.HugepageSizeKb * n.HugepagesTotal / 1024
+}
+
 type SNicDevInfo struct {
 	Dev   string           `json:"dev"`
 	Mac   net.HardwareAddr `json:"mac"`
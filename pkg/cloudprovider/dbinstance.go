@@ -0,0 +1,95 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudprovider
+
+import (
+	"context"
+	"time"
+)
+
+type SDBInstanceNetwork struct {
+	IP        string
+	NetworkId string
+}
+
+type SDBInstanceChangeConfig struct {
+	InstanceType string
+	VcpuCount    int
+	VmemSizeMb   int
+	DiskSizeGB   int
+	StorageType  string
+}
+
+type ICloudDBInstance interface {
+	ICloudResource
+	IBillingResource
+	IVirtualResource
+
+	GetIRegion() ICloudRegion
+
+	GetEngine() string
+	GetEngineVersion() string
+	// GetInstanceType return sku of the instance, e.g. rds.mysql.s1.small
+	GetInstanceType() string
+	GetCategory() string
+	GetVcpuCount() int
+	GetVmemSizeMB() int
+	GetDiskSizeGB() int
+	GetStorageType() string
+	GetPort() int
+	GetMaintainTime() string
+
+	GetConnectionStr() string
+	GetInternalConnectionStr() string
+
+	GetIZoneId() string
+	GetIVpcId() string
+	GetDBNetwork() (*SDBInstanceNetwork, error)
+
+	GetIDBInstanceAccounts() ([]ICloudDBInstanceAccount, error)
+	GetIDBInstanceDatabases() ([]ICloudDBInstanceDatabase, error)
+	GetIDBInstanceBackups() ([]ICloudDBInstanceBackup, error)
+
+	Start() error
+	Stop() error
+	Reboot() error
+	ChangeConfig(ctx context.Context, config *SDBInstanceChangeConfig) error
+	Delete() error
+}
+
+type ICloudDBInstanceAccount interface {
+	GetName() string
+	GetStatus() string
+	GetDescription() string
+	// GetPrivileges return databases and the privilege the account has on them
+	GetPrivileges() map[string]string
+}
+
+type ICloudDBInstanceDatabase interface {
+	GetName() string
+	GetStatus() string
+	GetCharacterSet() string
+	GetDescription() string
+}
+
+type ICloudDBInstanceBackup interface {
+	GetGlobalId() string
+	GetStatus() string
+	GetBackupMode() string
+	GetBackupSizeMb() int
+	GetDatabases() []string
+	GetStartTime() time.Time
+	GetEndTime() time.Time
+}
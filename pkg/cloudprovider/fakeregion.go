@@ -130,6 +130,30 @@ func (region *SFakeOnPremiseRegion) CreateILoadBalancerAcl(acl *SLoadbalancerAcc
 	return nil, ErrNotSupported
 }
 
+func (region *SFakeOnPremiseRegion) GetIBuckets() ([]ICloudBucket, error) {
+	return nil, ErrNotSupported
+}
+
+func (region *SFakeOnPremiseRegion) GetIBucketById(name string) (ICloudBucket, error) {
+	return nil, ErrNotSupported
+}
+
+func (region *SFakeOnPremiseRegion) CreateIBucket(name string, storageClassStr string, acl string) error {
+	return ErrNotSupported
+}
+
+func (region *SFakeOnPremiseRegion) DeleteIBucket(name string) error {
+	return ErrNotSupported
+}
+
+func (region *SFakeOnPremiseRegion) GetIDBInstances() ([]ICloudDBInstance, error) {
+	return nil, ErrNotSupported
+}
+
+func (region *SFakeOnPremiseRegion) GetIDBInstanceById(instanceId string) (ICloudDBInstance, error) {
+	return nil, ErrNotSupported
+}
+
 func (region *SFakeOnPremiseRegion) GetSkus(zoneId string) ([]ICloudSku, error) {
 	return nil, ErrNotSupported
 }
@@ -0,0 +1,103 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudprovider
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+type TBucketACLType string
+
+const (
+	ACLPrivate           = TBucketACLType("private")
+	ACLAuthRead          = TBucketACLType("authenticated-read")
+	ACLPublicRead        = TBucketACLType("public-read")
+	ACLPublicReadWrite   = TBucketACLType("public-read-write")
+	ACLUnknown           = TBucketACLType("")
+	DEFAULT_MAX_KEYS     = 1000
+	BUCKET_STATS_MAX_KEY = 100000
+)
+
+var BUCKET_ACL_TYPES = []TBucketACLType{
+	ACLPrivate,
+	ACLAuthRead,
+	ACLPublicRead,
+	ACLPublicReadWrite,
+}
+
+func IsValidBucketAcl(acl string) bool {
+	for _, t := range BUCKET_ACL_TYPES {
+		if string(t) == acl {
+			return true
+		}
+	}
+	return false
+}
+
+type SBucketStats struct {
+	SizeBytes   int64
+	ObjectCount int
+}
+
+type SBucketAccessUrl struct {
+	Url         string
+	Description string
+}
+
+type SListObjectResult struct {
+	Objects        []ICloudObject
+	NextMarker     string
+	CommonPrefixes []string
+	IsTruncated    bool
+}
+
+type ICloudBucket interface {
+	ICloudResource
+	IVirtualResource
+
+	GetIRegion() ICloudRegion
+
+	GetCreateAt() time.Time
+	GetStorageClass() string
+	GetLocation() string
+
+	GetAcl() TBucketACLType
+	SetAcl(acl TBucketACLType) error
+
+	GetStats() SBucketStats
+	GetAccessUrls() []SBucketAccessUrl
+
+	ListObjects(prefix string, marker string, delimiter string, maxCount int) (SListObjectResult, error)
+	PutObject(ctx context.Context, key string, body io.Reader, sizeBytes int64, contentType string, acl TBucketACLType) error
+	DeleteObject(ctx context.Context, key string) error
+	// GetTempUrl return a presigned url of method GET, PUT or DELETE on key
+	GetTempUrl(method string, key string, expire time.Duration) (string, error)
+}
+
+type ICloudObject interface {
+	GetIBucket() ICloudBucket
+
+	GetKey() string
+	GetSizeBytes() int64
+	GetLastModified() time.Time
+	GetStorageClass() string
+	GetETag() string
+	GetContentType() string
+
+	GetAcl() TBucketACLType
+	SetAcl(acl TBucketACLType) error
+}
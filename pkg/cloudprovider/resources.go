@@ -100,6 +100,14 @@ type ICloudRegion interface {
 	CreateILoadBalancerAcl(acl *SLoadbalancerAccessControlList) (ICloudLoadbalancerAcl, error)
 	CreateILoadBalancerCertificate(cert *SLoadbalancerCertificate) (ICloudLoadbalancerCertificate, error)
 
+	GetIBuckets() ([]ICloudBucket, error)
+	GetIBucketById(name string) (ICloudBucket, error)
+	CreateIBucket(name string, storageClassStr string, acl string) error
+	DeleteIBucket(name string) error
+
+	GetIDBInstances() ([]ICloudDBInstance, error)
+	GetIDBInstanceById(instanceId string) (ICloudDBInstance, error)
+
 	GetSkus(zoneId string) ([]ICloudSku, error)
 
 	GetProvider() string
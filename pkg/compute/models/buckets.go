@@ -0,0 +1,528 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/compare"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/validators"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const (
+	BUCKET_TEMP_URL_DEFAULT_EXPIRE = 3600
+	BUCKET_TEMP_URL_MAX_EXPIRE     = 7 * 24 * 3600
+)
+
+// bucket name rule shared by most object storages: 3-63 characters of
+// lowercase letters, digits, dots and hyphens, starting and ending with
+// a letter or digit
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+type SBucketManager struct {
+	db.SVirtualResourceBaseManager
+}
+
+var BucketManager *SBucketManager
+
+func init() {
+	BucketManager = &SBucketManager{
+		SVirtualResourceBaseManager: db.NewVirtualResourceBaseManager(
+			SBucket{},
+			"buckets_tbl",
+			"bucket",
+			"buckets",
+		),
+	}
+}
+
+type SBucket struct {
+	db.SVirtualResourceBase
+	SManagedResourceBase
+	SCloudregionResourceBase
+
+	StorageClass string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
+	Location     string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	Acl          string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
+
+	SizeBytes int64 `nullable:"false" default:"0" list:"user"`
+	ObjectCnt int   `nullable:"false" default:"0" list:"user"`
+
+	AccessUrls jsonutils.JSONObject `nullable:"true" list:"user"`
+}
+
+func (manager *SBucketManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*sqlchemy.SQuery, error) {
+	q, err := manager.SVirtualResourceBaseManager.ListItemFilter(ctx, q, userCred, query)
+	if err != nil {
+		return nil, err
+	}
+	userProjId := userCred.GetProjectId()
+	data := query.(*jsonutils.JSONDict)
+	q, err = validators.ApplyModelFilters(q, data, []*validators.ModelFilterOptions{
+		{Key: "cloudregion", ModelKeyword: "cloudregion", ProjectId: userProjId},
+		{Key: "manager", ModelKeyword: "cloudprovider", ProjectId: userProjId},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if acl, _ := query.GetString("acl"); len(acl) > 0 {
+		q = q.Equals("acl", acl)
+	}
+	return q, nil
+}
+
+func (manager *SBucketManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	name, _ := data.GetString("name")
+	if !bucketNameRegexp.MatchString(name) || strings.Contains(name, "..") {
+		return nil, httperrors.NewInputParameterError("invalid bucket name %s", name)
+	}
+	acl, _ := data.GetString("acl")
+	if len(acl) == 0 {
+		data.Set("acl", jsonutils.NewString(string(cloudprovider.ACLPrivate)))
+	} else if !cloudprovider.IsValidBucketAcl(acl) {
+		return nil, httperrors.NewInputParameterError("invalid acl %s", acl)
+	}
+	if _, err := manager.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerProjId, query, data); err != nil {
+		return nil, err
+	}
+
+	managerIdV := validators.NewModelIdOrNameValidator("manager", "cloudprovider", "")
+	if err := managerIdV.Validate(data); err != nil {
+		return nil, err
+	}
+
+	regionV := validators.NewModelIdOrNameValidator("cloudregion", "cloudregion", ownerProjId)
+	if err := regionV.Validate(data); err != nil {
+		return nil, err
+	}
+	region := regionV.Model.(*SCloudregion)
+	return region.GetDriver().ValidateCreateBucketData(ctx, userCred, data)
+}
+
+func (bucket *SBucket) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	bucket.SVirtualResourceBase.PostCreate(ctx, userCred, ownerProjId, query, data)
+
+	bucket.SetStatus(userCred, api.BUCKET_STATUS_START_CREATE, "")
+	if err := bucket.StartBucketCreateTask(ctx, userCred, ""); err != nil {
+		log.Errorf("Failed to create bucket error: %v", err)
+	}
+}
+
+func (bucket *SBucket) StartBucketCreateTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	task, err := taskman.TaskManager.NewTask(ctx, "BucketCreateTask", bucket, userCred, nil, parentTaskId, "", nil)
+	if err != nil {
+		return err
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (bucket *SBucket) GetCustomizeColumns(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) *jsonutils.JSONDict {
+	extra := bucket.SVirtualResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	providerInfo := bucket.SManagedResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	if providerInfo != nil {
+		extra.Update(providerInfo)
+	}
+	regionInfo := bucket.SCloudregionResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	if regionInfo != nil {
+		extra.Update(regionInfo)
+	}
+	return extra
+}
+
+func (bucket *SBucket) GetExtraDetails(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*jsonutils.JSONDict, error) {
+	extra := bucket.GetCustomizeColumns(ctx, userCred, query)
+	return extra, nil
+}
+
+func (bucket *SBucket) GetRegion() *SCloudregion {
+	region, err := CloudregionManager.FetchById(bucket.CloudregionId)
+	if err != nil {
+		log.Errorf("failed to find region for bucket %s", bucket.Name)
+		return nil
+	}
+	return region.(*SCloudregion)
+}
+
+func (bucket *SBucket) GetIRegion() (cloudprovider.ICloudRegion, error) {
+	provider, err := bucket.GetDriver()
+	if err != nil {
+		return nil, fmt.Errorf("No cloudprovider for bucket %s: %s", bucket.Name, err)
+	}
+	region := bucket.GetRegion()
+	if region == nil {
+		return nil, fmt.Errorf("failed to find region for bucket %s", bucket.Name)
+	}
+	return provider.GetIRegionById(region.ExternalId)
+}
+
+func (bucket *SBucket) GetIBucket() (cloudprovider.ICloudBucket, error) {
+	if len(bucket.ExternalId) == 0 {
+		return nil, fmt.Errorf("bucket %s not created on cloud", bucket.Name)
+	}
+	iRegion, err := bucket.GetIRegion()
+	if err != nil {
+		return nil, err
+	}
+	return iRegion.GetIBucketById(bucket.ExternalId)
+}
+
+func (bucket *SBucket) getReadyIBucket() (cloudprovider.ICloudBucket, error) {
+	if bucket.Status != api.BUCKET_STATUS_READY {
+		return nil, httperrors.NewInvalidStatusError("bucket %s status %s is not %s", bucket.Name, bucket.Status, api.BUCKET_STATUS_READY)
+	}
+	iBucket, err := bucket.GetIBucket()
+	if err != nil {
+		if err == cloudprovider.ErrNotFound {
+			return nil, httperrors.NewResourceNotFoundError("bucket %s not found on cloud", bucket.Name)
+		}
+		return nil, httperrors.NewGeneralError(err)
+	}
+	return iBucket, nil
+}
+
+func (bucket *SBucket) AllowPerformAcl(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return bucket.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, bucket, "acl")
+}
+
+// PerformAcl set canned acl of the bucket, or of an object if key is given
+func (bucket *SBucket) PerformAcl(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	acl, _ := data.GetString("acl")
+	if !cloudprovider.IsValidBucketAcl(acl) {
+		return nil, httperrors.NewInputParameterError("invalid acl %s", acl)
+	}
+	iBucket, err := bucket.getReadyIBucket()
+	if err != nil {
+		return nil, err
+	}
+	key, _ := data.GetString("key")
+	if len(key) > 0 {
+		result, err := iBucket.ListObjects(key, "", "", 1)
+		if err != nil {
+			return nil, httperrors.NewGeneralError(err)
+		}
+		if len(result.Objects) == 0 || result.Objects[0].GetKey() != key {
+			return nil, httperrors.NewResourceNotFoundError("object %s not found in bucket %s", key, bucket.Name)
+		}
+		err = result.Objects[0].SetAcl(cloudprovider.TBucketACLType(acl))
+		if err != nil {
+			return nil, httperrors.NewGeneralError(err)
+		}
+		db.OpsLog.LogEvent(bucket, db.ACT_UPDATE, fmt.Sprintf("set acl of object %s to %s", key, acl), userCred)
+		return nil, nil
+	}
+	err = iBucket.SetAcl(cloudprovider.TBucketACLType(acl))
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	diff, err := db.Update(bucket, func() error {
+		bucket.Acl = acl
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	db.OpsLog.LogEvent(bucket, db.ACT_UPDATE, diff, userCred)
+	return nil, nil
+}
+
+func (bucket *SBucket) AllowPerformTempUrl(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return bucket.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, bucket, "temp-url")
+}
+
+// PerformTempUrl return a presigned url to GET, PUT or DELETE an object
+// without credential, which expires in expire_seconds
+func (bucket *SBucket) PerformTempUrl(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	key, _ := data.GetString("key")
+	if len(key) == 0 {
+		return nil, httperrors.NewMissingParameterError("key")
+	}
+	method, _ := data.GetString("method")
+	method = strings.ToUpper(method)
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+	if !utils.IsInStringArray(method, []string{http.MethodGet, http.MethodPut, http.MethodDelete}) {
+		return nil, httperrors.NewInputParameterError("unsupported method %s", method)
+	}
+	expire, _ := data.Int("expire_seconds")
+	if expire <= 0 {
+		expire = BUCKET_TEMP_URL_DEFAULT_EXPIRE
+	}
+	if expire > BUCKET_TEMP_URL_MAX_EXPIRE {
+		return nil, httperrors.NewInputParameterError("expire_seconds should not exceed %d", BUCKET_TEMP_URL_MAX_EXPIRE)
+	}
+	iBucket, err := bucket.getReadyIBucket()
+	if err != nil {
+		return nil, err
+	}
+	tmpUrl, err := iBucket.GetTempUrl(method, key, time.Duration(expire)*time.Second)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.NewString(tmpUrl), "url")
+	ret.Add(jsonutils.NewString(method), "method")
+	ret.Add(jsonutils.NewInt(expire), "expire_seconds")
+	return ret, nil
+}
+
+func (bucket *SBucket) AllowGetDetailsObjects(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) bool {
+	return bucket.IsOwner(userCred) || db.IsAdminAllowGetSpec(userCred, bucket, "objects")
+}
+
+// GetDetailsObjects list objects of bucket page by page, pass next_marker
+// of result as marker to get the next page
+func (bucket *SBucket) GetDetailsObjects(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	prefix, _ := query.GetString("prefix")
+	marker, _ := query.GetString("marker")
+	delimiter, _ := query.GetString("delimiter")
+	limit, _ := query.Int("limit")
+	if limit <= 0 || limit > cloudprovider.DEFAULT_MAX_KEYS {
+		limit = cloudprovider.DEFAULT_MAX_KEYS
+	}
+	iBucket, err := bucket.getReadyIBucket()
+	if err != nil {
+		return nil, err
+	}
+	result, err := iBucket.ListObjects(prefix, marker, delimiter, int(limit))
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	objects := jsonutils.NewArray()
+	for _, obj := range result.Objects {
+		o := jsonutils.NewDict()
+		o.Add(jsonutils.NewString(obj.GetKey()), "key")
+		o.Add(jsonutils.NewInt(obj.GetSizeBytes()), "size_bytes")
+		o.Add(jsonutils.NewTimeString(obj.GetLastModified()), "last_modified")
+		o.Add(jsonutils.NewString(obj.GetStorageClass()), "storage_class")
+		o.Add(jsonutils.NewString(obj.GetETag()), "etag")
+		objects.Add(o)
+	}
+	ret := jsonutils.NewDict()
+	ret.Add(objects, "objects")
+	ret.Add(jsonutils.NewStringArray(result.CommonPrefixes), "common_prefixes")
+	ret.Add(jsonutils.NewBool(result.IsTruncated), "is_truncated")
+	if len(result.NextMarker) > 0 {
+		ret.Add(jsonutils.NewString(result.NextMarker), "next_marker")
+	}
+	return ret, nil
+}
+
+func (bucket *SBucket) AllowPerformDeleteObjects(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return bucket.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, bucket, "delete-objects")
+}
+
+func (bucket *SBucket) PerformDeleteObjects(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	keys := jsonutils.GetQueryStringArray(data, "keys")
+	if len(keys) == 0 {
+		return nil, httperrors.NewMissingParameterError("keys")
+	}
+	iBucket, err := bucket.getReadyIBucket()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		err := iBucket.DeleteObject(ctx, key)
+		if err != nil {
+			return nil, httperrors.NewGeneralError(fmt.Errorf("delete object %s fail %s", key, err))
+		}
+	}
+	db.OpsLog.LogEvent(bucket, db.ACT_UPDATE, fmt.Sprintf("delete objects %s", strings.Join(keys, ",")), userCred)
+	return nil, nil
+}
+
+func (bucket *SBucket) AllowPerformPurge(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, bucket, "purge")
+}
+
+func (bucket *SBucket) PerformPurge(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.JSONTrue, "purge")
+	return nil, bucket.StartBucketDeleteTask(ctx, userCred, params, "")
+}
+
+func (bucket *SBucket) CustomizeDelete(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	bucket.SetStatus(userCred, api.BUCKET_STATUS_START_DELETE, "")
+	return bucket.StartBucketDeleteTask(ctx, userCred, jsonutils.NewDict(), "")
+}
+
+func (bucket *SBucket) StartBucketDeleteTask(ctx context.Context, userCred mcclient.TokenCredential, params *jsonutils.JSONDict, parentTaskId string) error {
+	task, err := taskman.TaskManager.NewTask(ctx, "BucketDeleteTask", bucket, userCred, params, parentTaskId, "", nil)
+	if err != nil {
+		return err
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (bucket *SBucket) Delete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	return nil
+}
+
+func (bucket *SBucket) RealDelete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	return db.DeleteModel(ctx, userCred, bucket)
+}
+
+func (manager *SBucketManager) getBucketsByRegion(region *SCloudregion, provider *SCloudprovider) ([]SBucket, error) {
+	buckets := []SBucket{}
+	q := manager.Query().Equals("cloudregion_id", region.Id).Equals("manager_id", provider.Id)
+	if err := db.FetchModelObjects(manager, q, &buckets); err != nil {
+		log.Errorf("failed to get buckets for region: %v provider: %v error: %v", region, provider, err)
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (manager *SBucketManager) SyncBuckets(ctx context.Context, userCred mcclient.TokenCredential, provider *SCloudprovider, region *SCloudregion, buckets []cloudprovider.ICloudBucket) compare.SyncResult {
+	ownerProjId := provider.ProjectId
+
+	lockman.LockClass(ctx, manager, ownerProjId)
+	defer lockman.ReleaseClass(ctx, manager, ownerProjId)
+
+	syncResult := compare.SyncResult{}
+
+	dbBuckets, err := manager.getBucketsByRegion(region, provider)
+	if err != nil {
+		syncResult.Error(err)
+		return syncResult
+	}
+
+	removed := []SBucket{}
+	commondb := []SBucket{}
+	commonext := []cloudprovider.ICloudBucket{}
+	added := []cloudprovider.ICloudBucket{}
+
+	err = compare.CompareSets(dbBuckets, buckets, &removed, &commondb, &commonext, &added)
+	if err != nil {
+		syncResult.Error(err)
+		return syncResult
+	}
+
+	for i := 0; i < len(removed); i++ {
+		err = removed[i].syncRemoveCloudBucket(ctx, userCred)
+		if err != nil {
+			syncResult.DeleteError(err)
+		} else {
+			syncResult.Delete()
+		}
+	}
+	for i := 0; i < len(commondb); i++ {
+		err = commondb[i].SyncWithCloudBucket(ctx, userCred, commonext[i], provider.ProjectId)
+		if err != nil {
+			syncResult.UpdateError(err)
+		} else {
+			syncMetadata(ctx, userCred, &commondb[i], commonext[i])
+			syncResult.Update()
+		}
+	}
+	for i := 0; i < len(added); i++ {
+		local, err := manager.newFromCloudBucket(ctx, userCred, provider, added[i], region, ownerProjId)
+		if err != nil {
+			syncResult.AddError(err)
+		} else {
+			syncMetadata(ctx, userCred, local, added[i])
+			syncResult.Add()
+		}
+	}
+	return syncResult
+}
+
+func (manager *SBucketManager) newFromCloudBucket(ctx context.Context, userCred mcclient.TokenCredential, provider *SCloudprovider, extBucket cloudprovider.ICloudBucket, region *SCloudregion, projectId string) (*SBucket, error) {
+	bucket := SBucket{}
+	bucket.SetModelManager(manager)
+
+	newName, err := db.GenerateName(manager, projectId, extBucket.GetName())
+	if err != nil {
+		return nil, err
+	}
+	bucket.Name = newName
+	bucket.ExternalId = extBucket.GetGlobalId()
+	bucket.ManagerId = provider.Id
+	bucket.CloudregionId = region.Id
+	bucket.IsEmulated = extBucket.IsEmulated()
+	bucket.CreatedAt = extBucket.GetCreateAt()
+	bucket.setCloudAttrs(extBucket)
+
+	err = manager.TableSpec().Insert(&bucket)
+	if err != nil {
+		log.Errorf("newFromCloudBucket fail %s", err)
+		return nil, err
+	}
+
+	SyncCloudProject(userCred, &bucket, projectId, extBucket, bucket.ManagerId)
+
+	db.OpsLog.LogEvent(&bucket, db.ACT_CREATE, bucket.GetShortDesc(ctx), userCred)
+
+	return &bucket, nil
+}
+
+func (bucket *SBucket) setCloudAttrs(extBucket cloudprovider.ICloudBucket) {
+	bucket.Status = extBucket.GetStatus()
+	bucket.StorageClass = extBucket.GetStorageClass()
+	bucket.Location = extBucket.GetLocation()
+	if acl := extBucket.GetAcl(); acl != cloudprovider.ACLUnknown {
+		bucket.Acl = string(acl)
+	}
+	stats := extBucket.GetStats()
+	bucket.SizeBytes = stats.SizeBytes
+	bucket.ObjectCnt = stats.ObjectCount
+	bucket.AccessUrls = jsonutils.Marshal(extBucket.GetAccessUrls())
+}
+
+func (bucket *SBucket) syncRemoveCloudBucket(ctx context.Context, userCred mcclient.TokenCredential) error {
+	lockman.LockObject(ctx, bucket)
+	defer lockman.ReleaseObject(ctx, bucket)
+
+	err := bucket.ValidateDeleteCondition(ctx)
+	if err != nil { // cannot delete
+		err = bucket.SetStatus(userCred, api.BUCKET_STATUS_UNKNOWN, "sync to delete")
+	} else {
+		err = bucket.RealDelete(ctx, userCred)
+	}
+	return err
+}
+
+func (bucket *SBucket) SyncWithCloudBucket(ctx context.Context, userCred mcclient.TokenCredential, extBucket cloudprovider.ICloudBucket, projectId string) error {
+	diff, err := db.UpdateWithLock(ctx, bucket, func() error {
+		bucket.setCloudAttrs(extBucket)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogSyncUpdate(bucket, diff, userCred)
+
+	SyncCloudProject(userCred, bucket, projectId, extBucket, bucket.ManagerId)
+
+	return nil
+}
@@ -780,6 +780,42 @@ func syncRegionSnapshotPolicies(ctx context.Context, userCred mcclient.TokenCred
 	}
 }
 
+func syncRegionBuckets(ctx context.Context, userCred mcclient.TokenCredential, syncResults SSyncResultSet, provider *SCloudprovider, localRegion *SCloudregion, remoteRegion cloudprovider.ICloudRegion, syncRange *SSyncRange) {
+	buckets, err := remoteRegion.GetIBuckets()
+	if err != nil {
+		if err != cloudprovider.ErrNotImplemented && err != cloudprovider.ErrNotSupported {
+			log.Errorf("GetIBuckets for region %s failed %s", remoteRegion.GetName(), err)
+		}
+		return
+	}
+
+	result := BucketManager.SyncBuckets(ctx, userCred, provider, localRegion, buckets)
+	syncResults.Add(BucketManager, result)
+	msg := result.Result()
+	log.Infof("SyncBuckets for region %s result: %s", localRegion.Name, msg)
+	if result.IsError() {
+		return
+	}
+}
+
+func syncRegionDBInstances(ctx context.Context, userCred mcclient.TokenCredential, syncResults SSyncResultSet, provider *SCloudprovider, localRegion *SCloudregion, remoteRegion cloudprovider.ICloudRegion, syncRange *SSyncRange) {
+	instances, err := remoteRegion.GetIDBInstances()
+	if err != nil {
+		if err != cloudprovider.ErrNotImplemented && err != cloudprovider.ErrNotSupported {
+			log.Errorf("GetIDBInstances for region %s failed %s", remoteRegion.GetName(), err)
+		}
+		return
+	}
+
+	result := DBInstanceManager.SyncDBInstances(ctx, userCred, provider, localRegion, instances)
+	syncResults.Add(DBInstanceManager, result)
+	msg := result.Result()
+	log.Infof("SyncDBInstances for region %s result: %s", localRegion.Name, msg)
+	if result.IsError() {
+		return
+	}
+}
+
 func syncPublicCloudProviderInfo(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -845,6 +881,10 @@ func syncPublicCloudProviderInfo(
 	syncRegionLoadbalancerCertificates(ctx, userCred, syncResults, provider, localRegion, remoteRegion, syncRange)
 	syncRegionLoadbalancers(ctx, userCred, syncResults, provider, localRegion, remoteRegion, syncRange)
 
+	syncRegionBuckets(ctx, userCred, syncResults, provider, localRegion, remoteRegion, syncRange)
+
+	syncRegionDBInstances(ctx, userCred, syncResults, provider, localRegion, remoteRegion, syncRange)
+
 	log.Debugf("storageCachePairs count %d", len(storageCachePairs))
 	for i := range storageCachePairs {
 		if storageCachePairs[i].isNew || syncRange.DeepSync {
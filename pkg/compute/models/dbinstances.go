@@ -0,0 +1,515 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/compare"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/validators"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+type SDBInstanceManager struct {
+	db.SVirtualResourceBaseManager
+}
+
+var DBInstanceManager *SDBInstanceManager
+
+func init() {
+	DBInstanceManager = &SDBInstanceManager{
+		SVirtualResourceBaseManager: db.NewVirtualResourceBaseManager(
+			SDBInstance{},
+			"dbinstances_tbl",
+			"dbinstance",
+			"dbinstances",
+		),
+	}
+}
+
+type SDBInstance struct {
+	db.SVirtualResourceBase
+	SManagedResourceBase
+	SCloudregionResourceBase
+	SBillingResourceBase
+
+	Engine        string `width:"16" charset:"ascii" nullable:"false" list:"user"`
+	EngineVersion string `width:"16" charset:"ascii" nullable:"false" list:"user"`
+	InstanceType  string `width:"64" charset:"ascii" nullable:"true" list:"user"`
+	Category      string `width:"32" charset:"ascii" nullable:"true" list:"user"`
+
+	VcpuCount   int    `nullable:"false" default:"0" list:"user"`
+	VmemSizeMb  int    `nullable:"false" default:"0" list:"user"`
+	DiskSizeGb  int    `nullable:"false" default:"0" list:"user"`
+	StorageType string `width:"32" charset:"ascii" nullable:"true" list:"user"`
+
+	Port         int    `nullable:"false" default:"0" list:"user"`
+	MaintainTime string `width:"64" charset:"ascii" nullable:"true" list:"user"`
+
+	ConnectionStr         string `width:"256" charset:"ascii" nullable:"true" list:"user"`
+	InternalConnectionStr string `width:"256" charset:"ascii" nullable:"true" list:"user"`
+
+	ZoneId    string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	VpcId     string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	NetworkId string `width:"36" charset:"ascii" nullable:"true" list:"user"`
+	IpAddr    string `width:"16" charset:"ascii" nullable:"true" list:"user"`
+}
+
+func (manager *SDBInstanceManager) AllowCreateItem(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return false
+}
+
+func (manager *SDBInstanceManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*sqlchemy.SQuery, error) {
+	q, err := manager.SVirtualResourceBaseManager.ListItemFilter(ctx, q, userCred, query)
+	if err != nil {
+		return nil, err
+	}
+	userProjId := userCred.GetProjectId()
+	data := query.(*jsonutils.JSONDict)
+	q, err = validators.ApplyModelFilters(q, data, []*validators.ModelFilterOptions{
+		{Key: "cloudregion", ModelKeyword: "cloudregion", ProjectId: userProjId},
+		{Key: "manager", ModelKeyword: "cloudprovider", ProjectId: userProjId},
+		{Key: "zone", ModelKeyword: "zone", ProjectId: userProjId},
+		{Key: "vpc", ModelKeyword: "vpc", ProjectId: userProjId},
+		{Key: "network", ModelKeyword: "network", ProjectId: userProjId},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if engine, _ := query.GetString("engine"); len(engine) > 0 {
+		q = q.Equals("engine", engine)
+	}
+	return q, nil
+}
+
+func (self *SDBInstance) GetCustomizeColumns(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) *jsonutils.JSONDict {
+	extra := self.SVirtualResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	providerInfo := self.SManagedResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	if providerInfo != nil {
+		extra.Update(providerInfo)
+	}
+	regionInfo := self.SCloudregionResourceBase.GetCustomizeColumns(ctx, userCred, query)
+	if regionInfo != nil {
+		extra.Update(regionInfo)
+	}
+	if len(self.ZoneId) > 0 {
+		if zone := ZoneManager.FetchZoneById(self.ZoneId); zone != nil {
+			extra.Add(jsonutils.NewString(zone.Name), "zone")
+		}
+	}
+	if len(self.VpcId) > 0 {
+		if vpc, _ := VpcManager.FetchById(self.VpcId); vpc != nil {
+			extra.Add(jsonutils.NewString(vpc.GetName()), "vpc")
+		}
+	}
+	if len(self.NetworkId) > 0 {
+		if network, _ := NetworkManager.FetchById(self.NetworkId); network != nil {
+			extra.Add(jsonutils.NewString(network.GetName()), "network")
+		}
+	}
+	return extra
+}
+
+func (self *SDBInstance) GetExtraDetails(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*jsonutils.JSONDict, error) {
+	extra := self.GetCustomizeColumns(ctx, userCred, query)
+	return extra, nil
+}
+
+func (self *SDBInstance) GetRegion() *SCloudregion {
+	region, err := CloudregionManager.FetchById(self.CloudregionId)
+	if err != nil {
+		log.Errorf("failed to find region for dbinstance %s", self.Name)
+		return nil
+	}
+	return region.(*SCloudregion)
+}
+
+func (self *SDBInstance) GetIRegion() (cloudprovider.ICloudRegion, error) {
+	provider, err := self.GetDriver()
+	if err != nil {
+		return nil, fmt.Errorf("No cloudprovider for dbinstance %s: %s", self.Name, err)
+	}
+	region := self.GetRegion()
+	if region == nil {
+		return nil, fmt.Errorf("failed to find region for dbinstance %s", self.Name)
+	}
+	return provider.GetIRegionById(region.ExternalId)
+}
+
+func (self *SDBInstance) GetIDBInstance() (cloudprovider.ICloudDBInstance, error) {
+	iRegion, err := self.GetIRegion()
+	if err != nil {
+		return nil, err
+	}
+	return iRegion.GetIDBInstanceById(self.ExternalId)
+}
+
+func (self *SDBInstance) getIDBInstanceForDetails() (cloudprovider.ICloudDBInstance, error) {
+	iDBInstance, err := self.GetIDBInstance()
+	if err != nil {
+		if err == cloudprovider.ErrNotFound {
+			return nil, httperrors.NewResourceNotFoundError("dbinstance %s not found on cloud", self.Name)
+		}
+		return nil, httperrors.NewGeneralError(err)
+	}
+	return iDBInstance, nil
+}
+
+func (self *SDBInstance) AllowGetDetailsAccounts(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowGetSpec(userCred, self, "accounts")
+}
+
+func (self *SDBInstance) GetDetailsAccounts(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	iDBInstance, err := self.getIDBInstanceForDetails()
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := iDBInstance.GetIDBInstanceAccounts()
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	ret := jsonutils.NewArray()
+	for _, account := range accounts {
+		a := jsonutils.NewDict()
+		a.Add(jsonutils.NewString(account.GetName()), "name")
+		a.Add(jsonutils.NewString(account.GetStatus()), "status")
+		a.Add(jsonutils.NewString(account.GetDescription()), "description")
+		a.Add(jsonutils.Marshal(account.GetPrivileges()), "privileges")
+		ret.Add(a)
+	}
+	return ret, nil
+}
+
+func (self *SDBInstance) AllowGetDetailsDatabases(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowGetSpec(userCred, self, "databases")
+}
+
+func (self *SDBInstance) GetDetailsDatabases(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	iDBInstance, err := self.getIDBInstanceForDetails()
+	if err != nil {
+		return nil, err
+	}
+	databases, err := iDBInstance.GetIDBInstanceDatabases()
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	ret := jsonutils.NewArray()
+	for _, database := range databases {
+		d := jsonutils.NewDict()
+		d.Add(jsonutils.NewString(database.GetName()), "name")
+		d.Add(jsonutils.NewString(database.GetStatus()), "status")
+		d.Add(jsonutils.NewString(database.GetCharacterSet()), "character_set")
+		d.Add(jsonutils.NewString(database.GetDescription()), "description")
+		ret.Add(d)
+	}
+	return ret, nil
+}
+
+func (self *SDBInstance) AllowGetDetailsBackups(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowGetSpec(userCred, self, "backups")
+}
+
+func (self *SDBInstance) GetDetailsBackups(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	iDBInstance, err := self.getIDBInstanceForDetails()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := iDBInstance.GetIDBInstanceBackups()
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	ret := jsonutils.NewArray()
+	for _, backup := range backups {
+		b := jsonutils.NewDict()
+		b.Add(jsonutils.NewString(backup.GetGlobalId()), "id")
+		b.Add(jsonutils.NewString(backup.GetStatus()), "status")
+		b.Add(jsonutils.NewString(backup.GetBackupMode()), "backup_mode")
+		b.Add(jsonutils.NewInt(int64(backup.GetBackupSizeMb())), "backup_size_mb")
+		b.Add(jsonutils.NewStringArray(backup.GetDatabases()), "databases")
+		b.Add(jsonutils.NewTimeString(backup.GetStartTime()), "start_time")
+		b.Add(jsonutils.NewTimeString(backup.GetEndTime()), "end_time")
+		ret.Add(b)
+	}
+	return ret, nil
+}
+
+func (self *SDBInstance) startDBInstanceTask(ctx context.Context, userCred mcclient.TokenCredential, taskName string, status string, params *jsonutils.JSONDict) error {
+	self.SetStatus(userCred, status, "")
+	task, err := taskman.TaskManager.NewTask(ctx, taskName, self, userCred, params, "", "", nil)
+	if err != nil {
+		return err
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (self *SDBInstance) AllowPerformStart(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, self, "start")
+}
+
+func (self *SDBInstance) PerformStart(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.DBINSTANCE_STATUS_READY, api.DBINSTANCE_STATUS_START_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot start dbinstance in status %s", self.Status)
+	}
+	return nil, self.startDBInstanceTask(ctx, userCred, "DBInstanceStartTask", api.DBINSTANCE_STATUS_START_START, nil)
+}
+
+func (self *SDBInstance) AllowPerformStop(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, self, "stop")
+}
+
+func (self *SDBInstance) PerformStop(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.DBINSTANCE_STATUS_RUNNING, api.DBINSTANCE_STATUS_STOP_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot stop dbinstance in status %s", self.Status)
+	}
+	return nil, self.startDBInstanceTask(ctx, userCred, "DBInstanceStopTask", api.DBINSTANCE_STATUS_START_STOP, nil)
+}
+
+func (self *SDBInstance) AllowPerformReboot(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, self, "reboot")
+}
+
+func (self *SDBInstance) PerformReboot(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.DBINSTANCE_STATUS_RUNNING, api.DBINSTANCE_STATUS_REBOOT_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot reboot dbinstance in status %s", self.Status)
+	}
+	return nil, self.startDBInstanceTask(ctx, userCred, "DBInstanceRebootTask", api.DBINSTANCE_STATUS_START_REBOOT, nil)
+}
+
+func (self *SDBInstance) AllowPerformChangeConfig(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return self.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, self, "change-config")
+}
+
+// PerformChangeConfig change instance_type, disk_size_gb or storage_type of
+// the dbinstance, disk can only be enlarged
+func (self *SDBInstance) PerformChangeConfig(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.DBINSTANCE_STATUS_RUNNING, api.DBINSTANCE_STATUS_CHANGE_CONFIG_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot change config of dbinstance in status %s", self.Status)
+	}
+	config := cloudprovider.SDBInstanceChangeConfig{}
+	config.InstanceType, _ = data.GetString("instance_type")
+	config.StorageType, _ = data.GetString("storage_type")
+	diskSizeGb, _ := data.Int("disk_size_gb")
+	if diskSizeGb > 0 {
+		if int(diskSizeGb) < self.DiskSizeGb {
+			return nil, httperrors.NewInputParameterError("disk_size_gb %d should not be less than current size %d", diskSizeGb, self.DiskSizeGb)
+		}
+		config.DiskSizeGB = int(diskSizeGb)
+	}
+	if len(config.InstanceType) == 0 && len(config.StorageType) == 0 && config.DiskSizeGB == 0 {
+		return nil, httperrors.NewMissingParameterError("instance_type, disk_size_gb or storage_type")
+	}
+	params := jsonutils.Marshal(config).(*jsonutils.JSONDict)
+	return nil, self.startDBInstanceTask(ctx, userCred, "DBInstanceChangeConfigTask", api.DBINSTANCE_STATUS_START_CHANGE_CONFIG, params)
+}
+
+func (self *SDBInstance) AllowPerformPurge(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, self, "purge")
+}
+
+func (self *SDBInstance) PerformPurge(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.JSONTrue, "purge")
+	return nil, self.startDBInstanceTask(ctx, userCred, "DBInstanceDeleteTask", api.DBINSTANCE_STATUS_START_DELETE, params)
+}
+
+func (self *SDBInstance) CustomizeDelete(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	return self.startDBInstanceTask(ctx, userCred, "DBInstanceDeleteTask", api.DBINSTANCE_STATUS_START_DELETE, jsonutils.NewDict())
+}
+
+func (self *SDBInstance) Delete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	return nil
+}
+
+func (self *SDBInstance) RealDelete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	return db.DeleteModel(ctx, userCred, self)
+}
+
+func (manager *SDBInstanceManager) getDBInstancesByRegion(region *SCloudregion, provider *SCloudprovider) ([]SDBInstance, error) {
+	instances := []SDBInstance{}
+	q := manager.Query().Equals("cloudregion_id", region.Id).Equals("manager_id", provider.Id)
+	if err := db.FetchModelObjects(manager, q, &instances); err != nil {
+		log.Errorf("failed to get dbinstances for region: %v provider: %v error: %v", region, provider, err)
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (manager *SDBInstanceManager) SyncDBInstances(ctx context.Context, userCred mcclient.TokenCredential, provider *SCloudprovider, region *SCloudregion, instances []cloudprovider.ICloudDBInstance) compare.SyncResult {
+	ownerProjId := provider.ProjectId
+
+	lockman.LockClass(ctx, manager, ownerProjId)
+	defer lockman.ReleaseClass(ctx, manager, ownerProjId)
+
+	syncResult := compare.SyncResult{}
+
+	dbInstances, err := manager.getDBInstancesByRegion(region, provider)
+	if err != nil {
+		syncResult.Error(err)
+		return syncResult
+	}
+
+	removed := []SDBInstance{}
+	commondb := []SDBInstance{}
+	commonext := []cloudprovider.ICloudDBInstance{}
+	added := []cloudprovider.ICloudDBInstance{}
+
+	err = compare.CompareSets(dbInstances, instances, &removed, &commondb, &commonext, &added)
+	if err != nil {
+		syncResult.Error(err)
+		return syncResult
+	}
+
+	for i := 0; i < len(removed); i++ {
+		err = removed[i].syncRemoveCloudDBInstance(ctx, userCred)
+		if err != nil {
+			syncResult.DeleteError(err)
+		} else {
+			syncResult.Delete()
+		}
+	}
+	for i := 0; i < len(commondb); i++ {
+		err = commondb[i].SyncWithCloudDBInstance(ctx, userCred, commonext[i], provider.ProjectId)
+		if err != nil {
+			syncResult.UpdateError(err)
+		} else {
+			syncMetadata(ctx, userCred, &commondb[i], commonext[i])
+			syncResult.Update()
+		}
+	}
+	for i := 0; i < len(added); i++ {
+		local, err := manager.newFromCloudDBInstance(ctx, userCred, provider, added[i], region, ownerProjId)
+		if err != nil {
+			syncResult.AddError(err)
+		} else {
+			syncMetadata(ctx, userCred, local, added[i])
+			syncResult.Add()
+		}
+	}
+	return syncResult
+}
+
+func (manager *SDBInstanceManager) newFromCloudDBInstance(ctx context.Context, userCred mcclient.TokenCredential, provider *SCloudprovider, extInstance cloudprovider.ICloudDBInstance, region *SCloudregion, projectId string) (*SDBInstance, error) {
+	instance := SDBInstance{}
+	instance.SetModelManager(manager)
+
+	newName, err := db.GenerateName(manager, projectId, extInstance.GetName())
+	if err != nil {
+		return nil, err
+	}
+	instance.Name = newName
+	instance.ExternalId = extInstance.GetGlobalId()
+	instance.ManagerId = provider.Id
+	instance.CloudregionId = region.Id
+	instance.IsEmulated = extInstance.IsEmulated()
+	if createdAt := extInstance.GetCreatedAt(); !createdAt.IsZero() {
+		instance.CreatedAt = createdAt
+	}
+	instance.setCloudAttrs(extInstance)
+
+	err = manager.TableSpec().Insert(&instance)
+	if err != nil {
+		log.Errorf("newFromCloudDBInstance fail %s", err)
+		return nil, err
+	}
+
+	SyncCloudProject(userCred, &instance, projectId, extInstance, instance.ManagerId)
+
+	db.OpsLog.LogEvent(&instance, db.ACT_CREATE, instance.GetShortDesc(ctx), userCred)
+
+	return &instance, nil
+}
+
+func (self *SDBInstance) setCloudAttrs(extInstance cloudprovider.ICloudDBInstance) {
+	self.Status = extInstance.GetStatus()
+	self.Engine = extInstance.GetEngine()
+	self.EngineVersion = extInstance.GetEngineVersion()
+	self.InstanceType = extInstance.GetInstanceType()
+	self.Category = extInstance.GetCategory()
+	self.VcpuCount = extInstance.GetVcpuCount()
+	self.VmemSizeMb = extInstance.GetVmemSizeMB()
+	self.DiskSizeGb = extInstance.GetDiskSizeGB()
+	self.StorageType = extInstance.GetStorageType()
+	self.Port = extInstance.GetPort()
+	self.MaintainTime = extInstance.GetMaintainTime()
+	self.ConnectionStr = extInstance.GetConnectionStr()
+	self.InternalConnectionStr = extInstance.GetInternalConnectionStr()
+	self.BillingType = extInstance.GetBillingType()
+	self.ExpiredAt = extInstance.GetExpiredAt()
+
+	if zoneId := extInstance.GetIZoneId(); len(zoneId) > 0 {
+		if zone, err := ZoneManager.FetchByExternalId(zoneId); err == nil && zone != nil {
+			self.ZoneId = zone.GetId()
+		}
+	}
+	if vpcId := extInstance.GetIVpcId(); len(vpcId) > 0 {
+		if vpc, err := VpcManager.FetchByExternalId(vpcId); err == nil && vpc != nil {
+			self.VpcId = vpc.GetId()
+		}
+	}
+	network, err := extInstance.GetDBNetwork()
+	if err != nil {
+		log.Errorf("failed to get network of dbinstance %s: %v", extInstance.GetName(), err)
+	} else if network != nil {
+		self.IpAddr = network.IP
+		if len(network.NetworkId) > 0 {
+			if localNet, err := NetworkManager.FetchByExternalId(network.NetworkId); err == nil && localNet != nil {
+				self.NetworkId = localNet.GetId()
+			}
+		}
+	}
+}
+
+func (self *SDBInstance) syncRemoveCloudDBInstance(ctx context.Context, userCred mcclient.TokenCredential) error {
+	lockman.LockObject(ctx, self)
+	defer lockman.ReleaseObject(ctx, self)
+
+	err := self.ValidateDeleteCondition(ctx)
+	if err != nil { // cannot delete
+		err = self.SetStatus(userCred, api.DBINSTANCE_STATUS_UNKNOWN, "sync to delete")
+	} else {
+		err = self.RealDelete(ctx, userCred)
+	}
+	return err
+}
+
+func (self *SDBInstance) SyncWithCloudDBInstance(ctx context.Context, userCred mcclient.TokenCredential, extInstance cloudprovider.ICloudDBInstance, projectId string) error {
+	diff, err := db.UpdateWithLock(ctx, self, func() error {
+		self.setCloudAttrs(extInstance)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogSyncUpdate(self, diff, userCred)
+
+	if len(projectId) > 0 {
+		SyncCloudProject(userCred, self, projectId, extInstance, self.ManagerId)
+	}
+
+	return nil
+}
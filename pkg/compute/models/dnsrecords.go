@@ -17,6 +17,7 @@ package models
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -85,6 +86,55 @@ func (man *SDnsRecordManager) ParseInputInfo(data *jsonutils.JSONDict) ([]string
 			records = append(records, fmt.Sprintf("%s:%s", typ, addr))
 		}
 	}
+	{
+		// - MX.i, in the format of host:preference
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("MX.%d", i)
+			if !data.Contains(key) {
+				break
+			}
+			s, err := data.GetString(key)
+			if err != nil {
+				return nil, err
+			}
+			parts := strings.SplitN(s, ":", 2)
+			host := parts[0]
+			if err := man.checkRecordValue("MX", host); err != nil {
+				return nil, err
+			}
+			preference := 10
+			if len(parts) >= 2 {
+				preference, err = strconv.Atoi(parts[1])
+				if err != nil {
+					return nil, httperrors.NewNotAcceptableError("MX: invalid preference number: %s", parts[1])
+				}
+				if preference < 0 || preference > 65535 {
+					return nil, httperrors.NewNotAcceptableError("MX: preference number %d not in range [0,65535]", preference)
+				}
+			}
+			records = append(records, fmt.Sprintf("MX:%s:%d", host, preference))
+		}
+	}
+	{
+		// - TXT.i
+		//
+		// Text is stored query escaped as it may contain the records
+		// separator and non-ascii characters
+		for i := 0; ; i++ {
+			key := fmt.Sprintf("TXT.%d", i)
+			if !data.Contains(key) {
+				break
+			}
+			text, err := data.GetString(key)
+			if err != nil {
+				return nil, err
+			}
+			if err := man.checkRecordValue("TXT", text); err != nil {
+				return nil, err
+			}
+			records = append(records, fmt.Sprintf("TXT:%s", url.QueryEscape(text)))
+		}
+	}
 	{
 		// - SRV.i
 		// - (deprecated) SRV_host and SRV_port
@@ -209,7 +259,7 @@ func (man *SDnsRecordManager) ParseInputInfo(data *jsonutils.JSONDict) ([]string
 func (man *SDnsRecordManager) getRecordsType(recs []string) string {
 	for _, rec := range recs {
 		switch typ := rec[:strings.Index(rec, ":")]; typ {
-		case "A", "AAAA":
+		case "A", "AAAA", "MX", "TXT":
 			return "A"
 		case "CNAME":
 			return "CNAME"
@@ -224,10 +274,15 @@ func (man *SDnsRecordManager) getRecordsType(recs []string) string {
 
 func (man *SDnsRecordManager) checkRecordName(typ, name string) error {
 	switch typ {
-	case "A", "CNAME":
+	case "A", "AAAA", "MX", "CNAME":
 		if !regutils.MatchDomainName(name) {
 			return httperrors.NewNotAcceptableError("%s: invalid domain name: %s", typ, name)
 		}
+	case "TXT":
+		// allow underscore labels like _dmarc and _acme-challenge
+		if !regutils.MatchDomainSRV(name) {
+			return httperrors.NewNotAcceptableError("TXT: invalid txt record name: %s", name)
+		}
 	case "SRV":
 		if !regutils.MatchDomainSRV(name) {
 			return httperrors.NewNotAcceptableError("SRV: invalid srv record name: %s", typ, name)
@@ -253,10 +308,13 @@ func (man *SDnsRecordManager) checkRecordValue(typ, val string) error {
 		if !regutils.MatchIP6Addr(val) {
 			return httperrors.NewNotAcceptableError("AAAA: record value must be ipv6 address: %s", val)
 		}
-	case "CNAME", "PTR", "SRV":
+	case "CNAME", "PTR", "SRV", "MX":
 		fieldMsg := "record value"
-		if typ == "SRV" {
+		switch typ {
+		case "SRV":
 			fieldMsg = "target"
+		case "MX":
+			fieldMsg = "exchange"
 		}
 		if !regutils.MatchDomainName(val) {
 			return httperrors.NewNotAcceptableError("%s: %s must be domain name: %s", typ, fieldMsg, val)
@@ -264,6 +322,10 @@ func (man *SDnsRecordManager) checkRecordValue(typ, val string) error {
 		if regutils.MatchIPAddr(val) {
 			return httperrors.NewNotAcceptableError("%s: %s cannot be ip address: %s", typ, fieldMsg, val)
 		}
+	case "TXT":
+		if len(val) == 0 {
+			return httperrors.NewNotAcceptableError("TXT: record value cannot be empty")
+		}
 	default:
 		// internal error
 		return httperrors.NewNotAcceptableError("%s: unknown record type", typ)
@@ -285,14 +347,15 @@ func (man *SDnsRecordManager) validateModelData(
 	if len(records) == 0 {
 		return nil, httperrors.NewInputParameterError("Empty record")
 	}
-	recType := man.getRecordsType(records)
 	name, err := data.GetString("name")
 	if err != nil {
 		return nil, err
 	}
-	err = man.checkRecordName(recType, name)
-	if err != nil {
-		return nil, err
+	for _, rec := range records {
+		err = man.checkRecordName(rec[:strings.Index(rec, ":")], name)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if data.Contains("ttl") {
 		jo, err := data.Get("ttl")
@@ -329,24 +392,168 @@ func (man *SDnsRecordManager) ValidateCreateData(
 	return man.SAdminSharableVirtualResourceBaseManager.ValidateCreateData(man, data)
 }
 
-func (man *SDnsRecordManager) QueryDns(projectId, name string) *SDnsRecord {
-	q := man.Query().
-		Equals("name", name).
-		IsTrue("enabled")
-	if len(projectId) == 0 {
+// QueryDns returns the enabled record with the name as seen from the view of
+// projectIds.  Records of the first project, private or public, shadow public
+// records of the following ones, which in turn shadow public records of any
+// other project.  This way tenants can run overlapping names
+func (man *SDnsRecordManager) QueryDns(projectIds []string, name string) *SDnsRecord {
+	recs := man.queryViewDns(projectIds, man.Query().Equals("name", name))
+	if len(recs) == 0 {
+		return nil
+	}
+	return &recs[0]
+}
+
+// QueryZoneDns returns enabled records within the zone as seen from the view
+// of projectIds, one for each name
+func (man *SDnsRecordManager) QueryZoneDns(projectIds []string, zone string) []SDnsRecord {
+	q := man.Query()
+	if len(zone) > 0 {
+		q = q.Filter(sqlchemy.OR(
+			sqlchemy.Equals(q.Field("name"), zone),
+			sqlchemy.Endswith(q.Field("name"), "."+zone),
+		))
+	}
+	return man.queryViewDns(projectIds, q)
+}
+
+func (man *SDnsRecordManager) queryViewDns(projectIds []string, q *sqlchemy.SQuery) []SDnsRecord {
+	q = q.IsTrue("enabled")
+	if len(projectIds) == 0 || len(projectIds[0]) == 0 {
 		q = q.IsTrue("is_public")
 	} else {
 		q = q.Filter(sqlchemy.OR(
 			sqlchemy.IsTrue(q.Field("is_public")),
-			sqlchemy.Equals(q.Field("tenant_id"), projectId),
+			sqlchemy.Equals(q.Field("tenant_id"), projectIds[0]),
 		))
 	}
-	rec := &SDnsRecord{}
-	rec.SetModelManager(DnsRecordManager)
-	if err := q.First(rec); err != nil {
+	recs := []SDnsRecord{}
+	if err := db.FetchModelObjects(man, q, &recs); err != nil {
+		log.Errorf("query dns records failed: %v", err)
 		return nil
 	}
-	return rec
+	return viewDnsRecords(projectIds, recs)
+}
+
+// viewDnsRecords picks for each name the record of the highest rank in the
+// view of projectIds
+func viewDnsRecords(projectIds []string, recs []SDnsRecord) []SDnsRecord {
+	rank := func(rec *SDnsRecord) int {
+		for i, projectId := range projectIds {
+			if len(projectId) > 0 && rec.ProjectId == projectId {
+				return i
+			}
+		}
+		return len(projectIds)
+	}
+	ret := []SDnsRecord{}
+	idx := map[string]int{}
+	for i := range recs {
+		name := strings.ToLower(recs[i].Name)
+		if j, ok := idx[name]; !ok {
+			idx[name] = len(ret)
+			ret = append(ret, recs[i])
+		} else if rank(&recs[i]) < rank(&ret[j]) {
+			ret[j] = recs[i]
+		}
+	}
+	return ret
+}
+
+// GetProjectDnsRecord returns the record with the name owned by the project,
+// or nil if not exist
+func (man *SDnsRecordManager) GetProjectDnsRecord(projectId, name string) (*SDnsRecord, error) {
+	q := man.Query().Equals("name", name).Equals("tenant_id", projectId)
+	recs := []SDnsRecord{}
+	if err := db.FetchModelObjects(man, q, &recs); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return &recs[0], nil
+}
+
+// ValidateRecords validates records in the stored "TYPE:value" format as
+// records of one dns name
+func (man *SDnsRecordManager) ValidateRecords(name string, records []string) error {
+	recType := ""
+	for _, rec := range records {
+		i := strings.Index(rec, ":")
+		if i < 0 {
+			return httperrors.NewNotAcceptableError("invalid record: %s", rec)
+		}
+		typ, val := rec[:i], rec[i+1:]
+		if err := man.checkRecordName(typ, name); err != nil {
+			return err
+		}
+		switch typ {
+		case "MX", "SRV":
+			val = strings.SplitN(val, ":", 2)[0]
+		case "TXT":
+			text, err := url.QueryUnescape(val)
+			if err != nil {
+				return httperrors.NewNotAcceptableError("TXT: invalid record value: %s", val)
+			}
+			val = text
+		}
+		if err := man.checkRecordValue(typ, val); err != nil {
+			return err
+		}
+		if t := man.getRecordsType([]string{rec}); recType == "" {
+			recType = t
+		} else if recType != t {
+			return httperrors.NewNotAcceptableError("Cannot mix different types of records, %s != %s", recType, t)
+		}
+	}
+	if (recType == "CNAME" || recType == "PTR") && len(records) > 1 {
+		return httperrors.NewNotAcceptableError("%s cannot have multiple records", recType)
+	}
+	return nil
+}
+
+// SetProjectDnsRecords sets records of the project's record with the name,
+// creating it when not exist, or deleting it when records is empty
+func (man *SDnsRecordManager) SetProjectDnsRecords(ctx context.Context, userCred mcclient.TokenCredential, projectId, name string, records []string, ttl int) error {
+	rec, err := man.GetProjectDnsRecord(projectId, name)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		if rec == nil {
+			return nil
+		}
+		return db.DeleteModel(ctx, userCred, rec)
+	}
+	if err := man.ValidateRecords(name, records); err != nil {
+		return err
+	}
+	if rec == nil {
+		rec = &SDnsRecord{}
+		rec.SetModelManager(man)
+		rec.Name = name
+		rec.ProjectId = projectId
+		rec.Records = strings.Join(records, DNS_RECORDS_SEPARATOR)
+		rec.Ttl = ttl
+		rec.Enabled = true
+		if err := man.TableSpec().Insert(rec); err != nil {
+			return err
+		}
+		db.OpsLog.LogEvent(rec, db.ACT_CREATE, rec.GetShortDesc(ctx), userCred)
+		return nil
+	}
+	diff, err := db.Update(rec, func() error {
+		rec.Records = strings.Join(records, DNS_RECORDS_SEPARATOR)
+		if ttl > 0 {
+			rec.Ttl = ttl
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogEvent(rec, db.ACT_UPDATE, diff, userCred)
+	return nil
 }
 
 type DnsIp struct {
@@ -354,18 +561,35 @@ type DnsIp struct {
 	Ttl  int
 }
 
-func (man *SDnsRecordManager) QueryDnsIps(projectId, name, kind string) []*DnsIp {
-	rec := man.QueryDns(projectId, name)
+// QueryDnsIps returns values of kind from the record found by QueryDns.
+// Returns nil if the name does not exist in the view, and an empty slice if
+// it exists but has no values of kind
+func (man *SDnsRecordManager) QueryDnsIps(projectIds []string, name, kind string) []*DnsIp {
+	rec := man.QueryDns(projectIds, name)
 	if rec == nil {
 		return nil
 	}
+	return rec.getDnsIps(kind)
+}
+
+// getDnsIps returns values of the kind of records, TXT values unescaped
+func (rec *SDnsRecord) getDnsIps(kind string) []*DnsIp {
 	pref := kind + ":"
 	prefLen := len(pref)
 	dnsIps := []*DnsIp{}
 	for _, r := range rec.GetInfo() {
 		if strings.HasPrefix(r, pref) {
+			addr := r[prefLen:]
+			if kind == "TXT" {
+				text, err := url.QueryUnescape(addr)
+				if err != nil {
+					log.Errorf("invalid TXT record of %s: %s", rec.Name, addr)
+					continue
+				}
+				addr = text
+			}
 			dnsIps = append(dnsIps, &DnsIp{
-				Addr: r[prefLen:],
+				Addr: addr,
 				Ttl:  rec.Ttl,
 			})
 		}
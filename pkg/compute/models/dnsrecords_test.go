@@ -16,6 +16,7 @@ package models
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 
 	"yunion.io/x/jsonutils"
@@ -69,6 +70,22 @@ func TestDnsRecordsParseInputInfo(t *testing.T) {
 			}`),
 			out: []string{"PTR:a.com"},
 		},
+		{
+			name: "MX",
+			in: mustJ(`{
+				"MX.0": "mx0.a.com:5",
+				"MX.1": "mx1.a.com",
+			}`),
+			out: []string{"MX:mx0.a.com:5", "MX:mx1.a.com:10"},
+		},
+		{
+			name: "TXT",
+			in: mustJ(`{
+				"TXT.0": "v=spf1 -all",
+				"TXT.1": "a,b",
+			}`),
+			out: []string{"TXT:v%3Dspf1+-all", "TXT:a%2Cb"},
+		},
 		{
 			name: "empty",
 			in:   mustJ(`{}`),
@@ -96,6 +113,27 @@ func TestDnsRecordsParseInputInfo(t *testing.T) {
 			}`),
 			isErr: true,
 		},
+		{
+			name: "MX (bad preference)",
+			in: mustJ(`{
+				"MX.0": "mx0.a.com:65536",
+			}`),
+			isErr: true,
+		},
+		{
+			name: "MX (ip exchange)",
+			in: mustJ(`{
+				"MX.0": "1.2.3.4:10",
+			}`),
+			isErr: true,
+		},
+		{
+			name: "TXT (empty)",
+			in: mustJ(`{
+				"TXT.0": "",
+			}`),
+			isErr: true,
+		},
 		{
 			name: "PTR (reversed)",
 			in: mustJ(`{
@@ -126,3 +164,96 @@ func TestDnsRecordsParseInputInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestDnsRecordsView(t *testing.T) {
+	rec := func(id, name, projectId string) SDnsRecord {
+		r := SDnsRecord{}
+		r.Id = id
+		r.Name = name
+		r.ProjectId = projectId
+		return r
+	}
+	recs := []SDnsRecord{
+		rec("pub-x", "x.a.com", "p2"),
+		rec("net-x", "x.a.com", "net"),
+		rec("src-x", "X.a.com", "src"),
+		rec("pub-y", "y.a.com", "p2"),
+		rec("net-y", "y.a.com", "net"),
+		rec("pub-z", "z.a.com", "p2"),
+	}
+	cases := []struct {
+		name       string
+		projectIds []string
+		out        []string
+	}{
+		{
+			name:       "source project first",
+			projectIds: []string{"src", "net"},
+			out:        []string{"src-x", "net-y", "pub-z"},
+		},
+		{
+			name:       "network project",
+			projectIds: []string{"net"},
+			out:        []string{"net-x", "net-y", "pub-z"},
+		},
+		{
+			name:       "outside of cloud",
+			projectIds: []string{""},
+			out:        []string{"pub-x", "pub-y", "pub-z"},
+		},
+		{
+			name:       "no view",
+			projectIds: nil,
+			out:        []string{"pub-x", "pub-y", "pub-z"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := []string{}
+			for _, r := range viewDnsRecords(c.projectIds, recs) {
+				got = append(got, r.Id)
+			}
+			if !reflect.DeepEqual(c.out, got) {
+				t.Errorf("want %#v, got %#v", c.out, got)
+			}
+		})
+	}
+}
+
+func TestDnsRecordsGetDnsIps(t *testing.T) {
+	rec := &SDnsRecord{
+		Records: strings.Join([]string{
+			"A:1.2.3.4",
+			"AAAA:::1",
+			"MX:mx0.a.com:5",
+			"TXT:v%3Dspf1+-all",
+			"TXT:a%2Cb",
+			"TXT:%zz",
+		}, DNS_RECORDS_SEPARATOR),
+		Ttl: 300,
+	}
+	cases := []struct {
+		kind string
+		out  []string
+	}{
+		{kind: "A", out: []string{"1.2.3.4"}},
+		{kind: "AAAA", out: []string{"::1"}},
+		{kind: "MX", out: []string{"mx0.a.com:5"}},
+		{kind: "TXT", out: []string{"v=spf1 -all", "a,b"}},
+		{kind: "CNAME", out: []string{}},
+	}
+	for _, c := range cases {
+		t.Run(c.kind, func(t *testing.T) {
+			got := []string{}
+			for _, ip := range rec.getDnsIps(c.kind) {
+				if ip.Ttl != rec.Ttl {
+					t.Errorf("want ttl %d, got %d", rec.Ttl, ip.Ttl)
+				}
+				got = append(got, ip.Addr)
+			}
+			if !reflect.DeepEqual(c.out, got) {
+				t.Errorf("want %#v, got %#v", c.out, got)
+			}
+		})
+	}
+}
@@ -272,41 +272,50 @@ func (self *SGuest) AllowPerformLiveMigrate(ctx context.Context, userCred mcclie
 }
 
 func (self *SGuest) PerformLiveMigrate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if err := self.checkLiveMigrate(userCred); err != nil {
+		return nil, err
+	}
+	var preferHostId string
+	preferHost, _ := data.GetString("prefer_host")
+	if len(preferHost) > 0 {
+		if !db.IsAdminAllowPerform(userCred, self, "assign-host") {
+			return nil, httperrors.NewBadRequestError("Only system admin can assign host")
+		}
+		iHost, _ := HostManager.FetchByIdOrName(userCred, preferHost)
+		if iHost == nil {
+			return nil, httperrors.NewBadRequestError("Host %s not found", preferHost)
+		}
+		host := iHost.(*SHost)
+		preferHostId = host.Id
+	}
+	err := self.StartGuestLiveMigrateTask(ctx, userCred, self.Status, preferHostId, "")
+	return nil, err
+}
+
+// checkLiveMigrate reports why the guest cannot be live migrated, shared by
+// live-migrate action, host drain and automatic rebalance
+func (self *SGuest) checkLiveMigrate(userCred mcclient.TokenCredential) error {
 	if self.GetHypervisor() != api.HYPERVISOR_KVM {
-		return nil, httperrors.NewNotAcceptableError("Not allow for hypervisor %s", self.GetHypervisor())
+		return httperrors.NewNotAcceptableError("Not allow for hypervisor %s", self.GetHypervisor())
 	}
 	if len(self.BackupHostId) > 0 {
-		return nil, httperrors.NewBadRequestError("Guest have backup, can't migrate")
+		return httperrors.NewBadRequestError("Guest have backup, can't migrate")
 	}
-	if utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_SUSPEND}) {
-		cdrom := self.getCdrom(false)
-		if cdrom != nil && len(cdrom.ImageId) > 0 {
-			return nil, httperrors.NewBadRequestError("Cannot migrate with cdrom")
-		}
-		devices := self.GetIsolatedDevices()
-		if devices != nil && len(devices) > 0 {
-			return nil, httperrors.NewBadRequestError("Cannot migrate with isolated devices")
-		}
-		if !self.CheckQemuVersion(self.GetQemuVersion(userCred), "1.1.2") {
-			return nil, httperrors.NewBadRequestError("Cannot do live migrate, too low qemu version")
-		}
-		var preferHostId string
-		preferHost, _ := data.GetString("prefer_host")
-		if len(preferHost) > 0 {
-			if !db.IsAdminAllowPerform(userCred, self, "assign-host") {
-				return nil, httperrors.NewBadRequestError("Only system admin can assign host")
-			}
-			iHost, _ := HostManager.FetchByIdOrName(userCred, preferHost)
-			if iHost == nil {
-				return nil, httperrors.NewBadRequestError("Host %s not found", preferHost)
-			}
-			host := iHost.(*SHost)
-			preferHostId = host.Id
-		}
-		err := self.StartGuestLiveMigrateTask(ctx, userCred, self.Status, preferHostId, "")
-		return nil, err
+	if !utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_SUSPEND}) {
+		return httperrors.NewBadRequestError("Cannot live migrate in status %s", self.Status)
 	}
-	return nil, httperrors.NewBadRequestError("Cannot live migrate in status %s", self.Status)
+	cdrom := self.getCdrom(false)
+	if cdrom != nil && len(cdrom.ImageId) > 0 {
+		return httperrors.NewBadRequestError("Cannot migrate with cdrom")
+	}
+	devices := self.GetIsolatedDevices()
+	if devices != nil && len(devices) > 0 {
+		return httperrors.NewBadRequestError("Cannot migrate with isolated devices")
+	}
+	if !self.CheckQemuVersion(self.GetQemuVersion(userCred), "1.1.2") {
+		return httperrors.NewBadRequestError("Cannot do live migrate, too low qemu version")
+	}
+	return nil
 }
 
 func (self *SGuest) StartGuestLiveMigrateTask(ctx context.Context, userCred mcclient.TokenCredential, guestStatus, preferHostId, parentTaskId string) error {
@@ -2232,6 +2241,46 @@ func (self *SGuest) PerformStatus(ctx context.Context, userCred mcclient.TokenCr
 	return nil, nil
 }
 
+var guestEventActions = map[string]string{
+	api.QMP_EVENT_SHUTDOWN:            db.ACT_GUEST_SHUTDOWN,
+	api.QMP_EVENT_RESET:               db.ACT_GUEST_RESET,
+	api.QMP_EVENT_STOP:                db.ACT_GUEST_PAUSE,
+	api.QMP_EVENT_RESUME:              db.ACT_GUEST_RESUME,
+	api.QMP_EVENT_BLOCK_JOB_COMPLETED: db.ACT_GUEST_BLOCK_JOB_DONE,
+	api.QMP_EVENT_BLOCK_JOB_ERROR:     db.ACT_GUEST_BLOCK_JOB_FAIL,
+	api.QMP_EVENT_BLOCK_IO_ERROR:      db.ACT_GUEST_BLOCK_IO_ERROR,
+	api.QMP_EVENT_GUEST_PANICKED:      db.ACT_GUEST_PANICKED,
+	api.QMP_EVENT_DEVICE_DELETED:      db.ACT_GUEST_DEVICE_DELETED,
+}
+
+func (self *SGuest) AllowPerformEvent(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, self, "event")
+}
+
+// PerformEvent record hypervisor event of guest pushed by host, status is changed
+// only when guest is running, status of ongoing tasks is kept
+func (self *SGuest) PerformEvent(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	event, err := data.GetString("event")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("event")
+	}
+	action, ok := guestEventActions[event]
+	if !ok {
+		return nil, httperrors.NewInputParameterError("Unsupported event %s", event)
+	}
+	reason, _ := data.GetString("reason")
+	db.OpsLog.LogEvent(self, action, reason, userCred)
+
+	status, _ := data.GetString("status")
+	if len(status) > 0 && status != self.Status &&
+		utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_BLOCK_STREAM, api.VM_PANICKED, api.VM_IO_ERROR}) {
+		if err := self.SetStatus(userCred, status, reason); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
 func (self *SGuest) StartDiskSnapshot(ctx context.Context, userCred mcclient.TokenCredential, diskId, snapshotId string) error {
 	self.SetStatus(userCred, api.VM_START_SNAPSHOT, "StartDiskSnapshot")
 	params := jsonutils.NewDict()
@@ -2251,7 +2300,7 @@ func (self *SGuest) PerformStop(ctx context.Context, userCred mcclient.TokenCred
 	data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	// XXX if is force, force stop guest
 	var isForce = jsonutils.QueryBoolean(data, "is_force", false)
-	if isForce || utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_STOP_FAILED}) {
+	if isForce || utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_STOP_FAILED, api.VM_PANICKED, api.VM_IO_ERROR}) {
 		return nil, self.StartGuestStopTask(ctx, userCred, isForce, "")
 	} else {
 		return nil, httperrors.NewInvalidStatusError("Cannot stop server in status %s", self.Status)
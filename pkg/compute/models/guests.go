@@ -934,6 +934,14 @@ func (manager *SGuestManager) ValidateCreateData(ctx context.Context, userCred m
 	}
 
 	hypervisor = input.Hypervisor
+	if input.NumaSingleNode || input.DedicatedCpu {
+		if len(hypervisor) > 0 && hypervisor != api.HYPERVISOR_KVM {
+			return nil, httperrors.NewInputParameterError("numa_single_node and dedicated_cpu only supported by %s", api.HYPERVISOR_KVM)
+		}
+		if input.DedicatedCpu {
+			input.NumaSingleNode = true
+		}
+	}
 	if hypervisor != api.HYPERVISOR_CONTAINER {
 		// support sku here
 		var sku *SServerSku
@@ -1288,6 +1296,7 @@ func (guest *SGuest) PostCreate(ctx context.Context, userCred mcclient.TokenCred
 		}
 	}
 	guest.setApptags(ctx, appTags, userCred)
+	guest.setNumaOptions(ctx, userCred, data)
 	guest.SetCreateParams(ctx, userCred, data)
 	osProfileJson, _ := data.Get("__os_profile__")
 	if osProfileJson != nil {
@@ -1307,6 +1316,25 @@ func (guest *SGuest) setApptags(ctx context.Context, appTags []string, userCred
 	}
 }
 
+func (guest *SGuest) setNumaOptions(ctx context.Context, userCred mcclient.TokenCredential, data jsonutils.JSONObject) {
+	for _, key := range []string{api.VM_METADATA_NUMA_SINGLE_NODE, api.VM_METADATA_DEDICATED_CPU} {
+		if jsonutils.QueryBoolean(data, key, false) {
+			err := guest.SetMetadata(ctx, key, "true", userCred)
+			if err != nil {
+				log.Errorf("Server %s set %s: %v", guest.Name, key, err)
+			}
+		}
+	}
+}
+
+func (guest *SGuest) IsNumaSingleNode() bool {
+	return guest.GetMetadata(api.VM_METADATA_NUMA_SINGLE_NODE, nil) == "true" || guest.IsDedicatedCpu()
+}
+
+func (guest *SGuest) IsDedicatedCpu() bool {
+	return guest.GetMetadata(api.VM_METADATA_DEDICATED_CPU, nil) == "true"
+}
+
 func (guest *SGuest) SetCreateParams(ctx context.Context, userCred mcclient.TokenCredential, data jsonutils.JSONObject) {
 	// delete deploy files info
 	createParams := data.(*jsonutils.JSONDict).CopyExcludes("deploy_configs")
@@ -3702,36 +3730,76 @@ func (self *SGuest) GetKeypairPublicKey() string {
 }
 
 func (manager *SGuestManager) GetIpInProjectWithName(projectId, name string, isExitOnly bool) []string {
+	ips, _ := manager.getAddrsInProjectWithName(projectId, name)
+	return manager.getIpsByExit(ips, isExitOnly)
+}
+
+func (manager *SGuestManager) GetIp6InProjectWithName(projectId, name string) []string {
+	_, ip6s := manager.getAddrsInProjectWithName(projectId, name)
+	return ip6s
+}
+
+// getAddrsInProjectWithName returns ipv4 and ipv6 addresses of guests with
+// the name.  Guests of projectId shadow guests of the same name in other
+// projects
+func (manager *SGuestManager) getAddrsInProjectWithName(projectId, name string) ([]string, []string) {
 	guestnics := GuestnetworkManager.Query().SubQuery()
 	guests := manager.Query().SubQuery()
 	networks := NetworkManager.Query().SubQuery()
-	q := guestnics.Query(guestnics.Field("ip_addr")).Join(guests,
+	q := guestnics.Query(guestnics.Field("ip_addr"), guestnics.Field("ip6_addr"), guests.Field("tenant_id")).Join(guests,
 		sqlchemy.AND(
 			sqlchemy.Equals(guests.Field("id"), guestnics.Field("guest_id")),
 			sqlchemy.OR(sqlchemy.IsNull(guests.Field("pending_deleted")),
 				sqlchemy.IsFalse(guests.Field("pending_deleted"))))).
 		Join(networks, sqlchemy.Equals(networks.Field("id"), guestnics.Field("network_id"))).
 		Filter(sqlchemy.Equals(guests.Field("name"), name)).
-		Filter(sqlchemy.NotEquals(guestnics.Field("ip_addr"), "")).
-		Filter(sqlchemy.IsNotNull(guestnics.Field("ip_addr"))).
+		Filter(sqlchemy.OR(
+			sqlchemy.AND(
+				sqlchemy.NotEquals(guestnics.Field("ip_addr"), ""),
+				sqlchemy.IsNotNull(guestnics.Field("ip_addr")),
+			),
+			sqlchemy.AND(
+				sqlchemy.NotEquals(guestnics.Field("ip6_addr"), ""),
+				sqlchemy.IsNotNull(guestnics.Field("ip6_addr")),
+			),
+		)).
 		Filter(sqlchemy.IsNotNull(networks.Field("guest_gateway")))
-	ips := make([]string, 0)
+	ips, ip6s := make([]string, 0), make([]string, 0)
+	ownIps, ownIp6s := make([]string, 0), make([]string, 0)
 	rows, err := q.Rows()
 	if err != nil {
 		log.Errorf("Get guest ip with name query err: %v", err)
-		return ips
+		return ips, ip6s
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var ip string
-		err = rows.Scan(&ip)
+		var (
+			ip, ip6  sql.NullString
+			tenantId string
+		)
+		err = rows.Scan(&ip, &ip6, &tenantId)
 		if err != nil {
 			log.Errorf("Get guest ip with name scan err: %v", err)
-			return ips
+			return ips, ip6s
+		}
+		isOwn := len(projectId) > 0 && tenantId == projectId
+		if len(ip.String) > 0 {
+			ips = append(ips, ip.String)
+			if isOwn {
+				ownIps = append(ownIps, ip.String)
+			}
+		}
+		if len(ip6.String) > 0 {
+			ip6s = append(ip6s, ip6.String)
+			if isOwn {
+				ownIp6s = append(ownIp6s, ip6.String)
+			}
 		}
-		ips = append(ips, ip)
 	}
-	return manager.getIpsByExit(ips, isExitOnly)
+	if len(ownIps) > 0 || len(ownIp6s) > 0 {
+		return ownIps, ownIp6s
+	}
+	return ips, ip6s
 }
 
 func (manager *SGuestManager) getIpsByExit(ips []string, isExitOnly bool) []string {
@@ -4095,6 +4163,8 @@ func (self *SGuest) ToSchedDesc() *schedapi.ScheduleInput {
 	}*/
 
 	config.Hypervisor = self.GetHypervisor()
+	config.NumaSingleNode = self.IsNumaSingleNode()
+	config.DedicatedCpu = self.IsDedicatedCpu()
 	desc.ServerConfig = *config
 	return desc
 }
@@ -0,0 +1,309 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/timeutils"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+	"yunion.io/x/onecloud/pkg/util/rebalanceutils"
+)
+
+const (
+	HOST_REBALANCE_MODE_OFF       = "off"
+	HOST_REBALANCE_MODE_RECOMMEND = "recommend"
+	HOST_REBALANCE_MODE_AUTO      = "auto"
+
+	GUEST_METADATA_REBALANCE_AT = "__rebalance_at"
+)
+
+// RebalanceHosts is run by cronman, it detects imbalance among kvm hosts of
+// each zone from the scheduler cache and moves guests out of overloaded hosts
+// by live migration. In recommend mode the plan is only recorded in opslog.
+func (manager *SHostManager) RebalanceHosts(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	mode := options.Options.HostRebalanceMode
+	if mode != HOST_REBALANCE_MODE_RECOMMEND && mode != HOST_REBALANCE_MODE_AUTO {
+		return
+	}
+	budget := options.Options.HostRebalanceMaxMigrations
+	if mode == HOST_REBALANCE_MODE_AUTO {
+		inflight, err := GuestManager.migratingGuestCount()
+		if err != nil {
+			log.Errorf("RebalanceHosts count migrating guests: %v", err)
+			return
+		}
+		budget -= inflight
+	}
+	if budget <= 0 {
+		log.Debugf("RebalanceHosts: no migration budget left, skip")
+		return
+	}
+
+	s := auth.GetAdminSession(ctx, options.Options.Region, "")
+	hosts, err := manager.getRebalanceHosts(s)
+	if err != nil {
+		log.Errorf("RebalanceHosts fetch hosts: %v", err)
+		return
+	}
+	if len(hosts) < 2 {
+		return
+	}
+	guests, guestMap, err := GuestManager.getRebalanceGuests(userCred, hosts)
+	if err != nil {
+		log.Errorf("RebalanceHosts fetch guests: %v", err)
+		return
+	}
+
+	candidates := func(g *rebalanceutils.SGuest) ([]string, error) {
+		return guestMap[g.Id].getMigrateCandidates(s)
+	}
+	planner := &rebalanceutils.SPlanner{
+		Threshold:       options.Options.HostRebalanceThreshold,
+		MaxMoves:        budget,
+		MaxMovesPerHost: options.Options.HostRebalanceMaxMigrationsPerHost,
+	}
+	moves, err := planner.Plan(hosts, guests, candidates)
+	if err != nil {
+		log.Errorf("RebalanceHosts plan: %v", err)
+		return
+	}
+	for _, move := range moves {
+		guest := guestMap[move.GuestId]
+		notes := fmt.Sprintf("rebalance guest from host %s(load %.2f) to %s(load %.2f)",
+			move.SrcHostId, move.SrcLoad, move.DstHostId, move.DstLoad)
+		if mode == HOST_REBALANCE_MODE_RECOMMEND {
+			log.Infof("RebalanceHosts recommend %s: %s", guest.Name, notes)
+			db.OpsLog.LogEvent(guest, db.ACT_REBALANCE_RECOMMEND, notes, userCred)
+			continue
+		}
+		log.Infof("RebalanceHosts migrate %s: %s", guest.Name, notes)
+		guest.SetMetadata(ctx, GUEST_METADATA_REBALANCE_AT, timeutils.IsoTime(time.Now()), userCred)
+		err := guest.StartGuestLiveMigrateTask(ctx, userCred, guest.Status, move.DstHostId, "")
+		if err != nil {
+			log.Errorf("RebalanceHosts start migrate %s: %v", guest.Name, err)
+		}
+	}
+}
+
+// getRebalanceHosts returns usage of enabled online kvm hosts which are not
+// in maintenance, as seen by scheduler
+func (manager *SHostManager) getRebalanceHosts(s *mcclient.ClientSession) ([]*rebalanceutils.SHost, error) {
+	q := manager.Query().Equals("host_type", api.HOST_TYPE_HYPERVISOR).
+		Equals("host_status", api.HOST_ONLINE)
+	q = q.Filter(sqlchemy.IsTrue(q.Field("enabled")))
+	q = q.Filter(sqlchemy.OR(sqlchemy.IsNull(q.Field("is_maintenance")), sqlchemy.IsFalse(q.Field("is_maintenance"))))
+	dbHosts := make([]SHost, 0)
+	err := db.FetchModelObjects(manager, q, &dbHosts)
+	if err != nil {
+		return nil, err
+	}
+	if len(dbHosts) == 0 {
+		return nil, nil
+	}
+	zones := make(map[string]string)
+	for i := range dbHosts {
+		zones[dbHosts[i].Id] = dbHosts[i].ZoneId
+	}
+
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString("host"), "type")
+	params.Add(jsonutils.NewInt(int64(len(dbHosts))), "limit")
+	ret, err := modules.SchedManager.CandidateList(s, params)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := ret.GetArray("data")
+	hosts := make([]*rebalanceutils.SHost, 0, len(data))
+	for _, obj := range data {
+		id, _ := obj.GetString("id")
+		zoneId, ok := zones[id]
+		if !ok {
+			continue
+		}
+		host := &rebalanceutils.SHost{Id: id, GroupId: zoneId}
+		host.CpuCount, host.UsedCpuCount = candidateResourceUsage(obj, "cpu")
+		host.MemSizeMb, host.UsedMemMb = candidateResourceUsage(obj, "mem")
+		if host.CpuCount <= 0 || host.MemSizeMb <= 0 {
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+func candidateResourceUsage(obj jsonutils.JSONObject, key string) (int64, int64) {
+	total, _ := obj.Float(key, "total")
+	free, _ := obj.Float(key, "free")
+	reserved, _ := obj.Float(key, "reserverd")
+	used := total - free - reserved
+	if used < 0 {
+		used = 0
+	}
+	return int64(total), int64(used)
+}
+
+func (manager *SGuestManager) migratingGuestCount() (int, error) {
+	return manager.Query().Equals("hypervisor", api.HYPERVISOR_KVM).
+		In("status", []string{api.VM_START_MIGRATE, api.VM_MIGRATING}).CountWithError()
+}
+
+// getRebalanceGuests returns running guests on the hosts which can be live
+// migrated and have not been moved by rebalance recently.  Guests in groups
+// are left out, scheduler does not check group anti-affinity when asked for
+// migration candidates
+func (manager *SGuestManager) getRebalanceGuests(userCred mcclient.TokenCredential, hosts []*rebalanceutils.SHost) ([]*rebalanceutils.SGuest, map[string]*SGuest, error) {
+	hostIds := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		hostIds = append(hostIds, h.Id)
+	}
+	q := manager.Query().In("host_id", hostIds).Equals("status", api.VM_RUNNING).
+		Equals("hypervisor", api.HYPERVISOR_KVM)
+	groupguests := GroupguestManager.Query().SubQuery()
+	q = q.Filter(sqlchemy.NotIn(q.Field("id"), groupguests.Query(groupguests.Field("guest_id"))))
+	dbGuests := make([]SGuest, 0)
+	err := db.FetchModelObjects(manager, q, &dbGuests)
+	if err != nil {
+		return nil, nil, err
+	}
+	cooldown := time.Duration(options.Options.HostRebalanceGuestCooldownSeconds) * time.Second
+	guests := make([]*rebalanceutils.SGuest, 0, len(dbGuests))
+	guestMap := make(map[string]*SGuest)
+	for i := range dbGuests {
+		guest := &dbGuests[i]
+		if err := guest.checkLiveMigrate(userCred); err != nil {
+			continue
+		}
+		if at := guest.GetMetadata(GUEST_METADATA_REBALANCE_AT, userCred); len(at) > 0 {
+			t, err := timeutils.ParseTimeStr(at)
+			if err == nil && time.Since(t) < cooldown {
+				continue
+			}
+		}
+		guestMap[guest.Id] = guest
+		guests = append(guests, &rebalanceutils.SGuest{
+			Id:        guest.Id,
+			HostId:    guest.HostId,
+			CpuCount:  int64(guest.VcpuCount),
+			MemSizeMb: int64(guest.VmemSize),
+		})
+	}
+	return guests, guestMap, nil
+}
+
+// getMigrateCandidates asks scheduler which hosts the guest could be migrated
+// to, so that schedtags, resources and the like are respected
+func (self *SGuest) getMigrateCandidates(s *mcclient.ClientSession) ([]string, error) {
+	desc := self.ToSchedDesc()
+	desc.SuggestionLimit = 1000
+	ret, err := modules.SchedManager.Test(s, desc)
+	if err != nil {
+		return nil, err
+	}
+	data, _ := ret.GetArray("data")
+	ids := make([]string, 0, len(data))
+	for _, obj := range data {
+		capacity, _ := obj.Int("capacity")
+		if capacity <= 0 {
+			continue
+		}
+		id, _ := obj.GetString("id")
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (self *SHost) AllowPerformDrain(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, self, "drain")
+}
+
+// PerformDrain puts a kvm host into maintenance mode, so scheduler will not
+// place guests on it, and migrates all its guests away
+func (self *SHost) PerformDrain(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if self.HostType != api.HOST_TYPE_HYPERVISOR {
+		return nil, httperrors.NewNotAcceptableError("Cannot drain host of type %s", self.HostType)
+	}
+	if !self.IsMaintenance {
+		_, err := db.Update(self, func() error {
+			self.IsMaintenance = true
+			return nil
+		})
+		if err != nil {
+			return nil, httperrors.NewInternalServerError("update host maintenance: %v", err)
+		}
+		db.OpsLog.LogEvent(self, db.ACT_HOST_DRAIN, "", userCred)
+		self.ClearSchedDescCache()
+	}
+
+	failed := jsonutils.NewDict()
+	guests := self.GetGuests()
+	for i := range guests {
+		guest := &guests[i]
+		var err error
+		switch {
+		case guest.Status == api.VM_READY && guest.GetHypervisor() == api.HYPERVISOR_KVM && len(guest.BackupHostId) == 0:
+			err = guest.StartMigrateTask(ctx, userCred, false, false, guest.Status, "", "")
+		case utils.IsInStringArray(guest.Status, []string{api.VM_START_MIGRATE, api.VM_MIGRATING}):
+			continue
+		default:
+			err = guest.checkLiveMigrate(userCred)
+			if err == nil {
+				err = guest.StartGuestLiveMigrateTask(ctx, userCred, guest.Status, "", "")
+			}
+		}
+		if err != nil {
+			failed.Add(jsonutils.NewString(err.Error()), guest.Name)
+		}
+	}
+	ret := jsonutils.NewDict()
+	if failed.Length() > 0 {
+		ret.Add(failed, "failed_guests")
+	}
+	return ret, nil
+}
+
+func (self *SHost) AllowPerformUndrain(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, self, "undrain")
+}
+
+// PerformUndrain brings a drained host out of maintenance mode
+func (self *SHost) PerformUndrain(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !self.IsMaintenance {
+		return nil, nil
+	}
+	_, err := db.Update(self, func() error {
+		self.IsMaintenance = false
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("update host maintenance: %v", err)
+	}
+	db.OpsLog.LogEvent(self, db.ACT_HOST_UNDRAIN, "", userCred)
+	self.ClearSchedDescCache()
+	return nil, nil
+}
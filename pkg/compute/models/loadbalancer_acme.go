@@ -0,0 +1,284 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/regutils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/acmeutils"
+)
+
+const acmeIssueTimeout = 15 * time.Minute
+
+// acmeDomains returns common name followed by other names in sans
+func acmeDomains(commonName, sans string) []string {
+	domains := []string{commonName}
+	for _, name := range strings.Fields(sans) {
+		dup := false
+		for _, domain := range domains {
+			if domain == name {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			domains = append(domains, name)
+		}
+	}
+	return domains
+}
+
+func (man *SLoadbalancerCertificateManager) validateAcmeDomains(ctx context.Context, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	commonName, _ := data.GetString("common_name")
+	if commonName == "" {
+		return nil, httperrors.NewMissingParameterError("common_name")
+	}
+	sans, _ := data.GetString("subject_alternative_names")
+	domains := acmeDomains(commonName, sans)
+	for _, domain := range domains {
+		// http-01 challenge cannot be used for wildcard domains
+		if strings.HasPrefix(domain, "*") || !regutils.MatchDomainName(domain) {
+			return nil, httperrors.NewInputParameterError("invalid acme certificate domain %q", domain)
+		}
+	}
+	data.Remove("certificate")
+	data.Remove("private_key")
+	// NOTE same as validateCertKey, names are separated by white space
+	data.Set("subject_alternative_names", jsonutils.NewString(strings.Join(domains, " ")))
+	return data, nil
+}
+
+func newAcmeClient(ctx context.Context) (*acmeutils.Client, error) {
+	key, err := acmeutils.LoadOrGenerateKey(options.Options.AcmeAccountKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("acme account key: %s", err)
+	}
+	httpClient := http.DefaultClient
+	if caFile := options.Options.AcmeDirectoryCaFile; caFile != "" {
+		caData, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("acme ca file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("acme ca file %s: no certificate found", caFile)
+		}
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+	client := acmeutils.NewClient(options.Options.AcmeDirectoryUrl, key, httpClient)
+	if err := client.Register(ctx, options.Options.AcmeAccountEmail); err != nil {
+		return nil, fmt.Errorf("acme register: %s", err)
+	}
+	return client, nil
+}
+
+func (lbcert *SLoadbalancerCertificate) setAcmeChallenges(challenges *jsonutils.JSONDict) error {
+	_, err := db.Update(lbcert, func() error {
+		lbcert.AcmeChallenges = challenges
+		return nil
+	})
+	return err
+}
+
+// AcmeIssue issues certificate for domains of lbcert through ACME http-01
+// challenges and stores the result.  Challenges are served by lbagents on
+// http listeners, which will pick up the new certificate with a graceful
+// haproxy reload
+func (lbcert *SLoadbalancerCertificate) AcmeIssue(ctx context.Context, userCred mcclient.TokenCredential) error {
+	ctx, cancel := context.WithTimeout(ctx, acmeIssueTimeout)
+	defer cancel()
+
+	client, err := newAcmeClient(ctx)
+	if err != nil {
+		return err
+	}
+	domains := acmeDomains(lbcert.CommonName, lbcert.SubjectAlternativeNames)
+	order, err := client.NewOrder(ctx, domains)
+	if err != nil {
+		return fmt.Errorf("acme new order: %s", err)
+	}
+
+	pendingAuthzs := []*acmeutils.Authorization{}
+	challenges := jsonutils.NewDict()
+	for _, authzUrl := range order.Authorizations {
+		authz, err := client.GetAuthorization(ctx, authzUrl)
+		if err != nil {
+			return fmt.Errorf("acme authorization: %s", err)
+		}
+		if authz.Status == acmeutils.STATUS_VALID {
+			continue
+		}
+		chal := authz.Challenge(acmeutils.CHALLENGE_HTTP_01)
+		if chal == nil {
+			return fmt.Errorf("acme authorization %s: no http-01 challenge", authz.Identifier.Value)
+		}
+		challenges.Set(chal.Token, jsonutils.NewString(client.HTTP01KeyAuthorization(chal.Token)))
+		pendingAuthzs = append(pendingAuthzs, authz)
+	}
+
+	issued := false
+	if len(pendingAuthzs) > 0 {
+		if err := lbcert.setAcmeChallenges(challenges); err != nil {
+			return fmt.Errorf("save acme challenges: %s", err)
+		}
+		defer func() {
+			if !issued {
+				lbcert.setAcmeChallenges(nil)
+			}
+		}()
+		// wait for lbagents to sync challenges from api
+		select {
+		case <-time.After(time.Duration(options.Options.AcmeChallengeWaitSeconds) * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		for _, authz := range pendingAuthzs {
+			chal := authz.Challenge(acmeutils.CHALLENGE_HTTP_01)
+			if err := client.Accept(ctx, chal); err != nil {
+				return fmt.Errorf("acme accept challenge of %s: %s", authz.Identifier.Value, err)
+			}
+		}
+		for _, authz := range pendingAuthzs {
+			if _, err := client.WaitAuthorization(ctx, authz.URL); err != nil {
+				return fmt.Errorf("acme %s", err)
+			}
+		}
+	}
+
+	certKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	csr, err := acmeutils.NewCSR(certKey, domains)
+	if err != nil {
+		return err
+	}
+	order, err = client.Finalize(ctx, order, csr)
+	if err != nil {
+		return fmt.Errorf("acme finalize: %s", err)
+	}
+	certPem, err := client.FetchCertificate(ctx, order.Certificate)
+	if err != nil {
+		return fmt.Errorf("acme fetch certificate: %s", err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(certKey),
+	})
+	if err := lbcert.setAcmeCertificate(ctx, userCred, string(certPem), string(keyPem)); err != nil {
+		return err
+	}
+	issued = true
+	return nil
+}
+
+// setAcmeCertificate saves the issued certificate along with its derived
+// attributes and clears challenges in a single update
+func (lbcert *SLoadbalancerCertificate) setAcmeCertificate(ctx context.Context, userCred mcclient.TokenCredential, certPem, keyPem string) error {
+	data := jsonutils.NewDict()
+	data.Set("certificate", jsonutils.NewString(certPem))
+	data.Set("private_key", jsonutils.NewString(keyPem))
+	data, err := LoadbalancerCertificateManager.validateCertKey(ctx, data)
+	if err != nil {
+		return fmt.Errorf("acme issued certificate: %s", err)
+	}
+	diff, err := db.Update(lbcert, func() error {
+		if err := data.Unmarshal(lbcert); err != nil {
+			return err
+		}
+		lbcert.AcmeChallenges = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogEvent(lbcert, db.ACT_UPDATE, diff, userCred)
+	return nil
+}
+
+func (lbcert *SLoadbalancerCertificate) AllowPerformAcmeRenew(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, lbcert, "acme-renew")
+}
+
+func (lbcert *SLoadbalancerCertificate) PerformAcmeRenew(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if lbcert.CertificateSource != api.LB_CERT_SOURCE_ACME {
+		return nil, httperrors.NewUnsupportOperationError("not an acme certificate")
+	}
+	switch lbcert.Status {
+	case api.LB_STATUS_ENABLED, api.LB_CERT_STATUS_ACME_RENEW_FAILED, api.LB_CREATE_FAILED:
+	default:
+		return nil, httperrors.NewInvalidStatusError("cannot renew certificate in status %s", lbcert.Status)
+	}
+	return nil, lbcert.StartAcmeRenewTask(ctx, userCred, "")
+}
+
+func (lbcert *SLoadbalancerCertificate) StartAcmeRenewTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	lbcert.SetStatus(userCred, api.LB_CERT_STATUS_ACME_RENEWING, "")
+	task, err := taskman.TaskManager.NewTask(ctx, "LoadbalancerCertificateAcmeRenewTask", lbcert, userCred, nil, parentTaskId, "", nil)
+	if err != nil {
+		return err
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+// RenewAcmeCertificates starts renewal of acme certificates that expire in
+// AcmeRenewBeforeDays.  Failed renewals are retried in the next round
+func (man *SLoadbalancerCertificateManager) RenewAcmeCertificates(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	renewBefore := time.Now().Add(time.Duration(options.Options.AcmeRenewBeforeDays) * 24 * time.Hour)
+	q := man.Query().
+		Equals("certificate_source", api.LB_CERT_SOURCE_ACME).
+		In("status", []string{api.LB_STATUS_ENABLED, api.LB_CERT_STATUS_ACME_RENEW_FAILED}).
+		LT("not_after", renewBefore)
+	q = q.Filter(sqlchemy.OR(sqlchemy.IsNull(q.Field("pending_deleted")), sqlchemy.IsFalse(q.Field("pending_deleted"))))
+	lbcerts := []SLoadbalancerCertificate{}
+	if err := db.FetchModelObjects(man, q, &lbcerts); err != nil {
+		log.Errorf("RenewAcmeCertificates: fetch certificates: %s", err)
+		return
+	}
+	for i := range lbcerts {
+		lbcert := &lbcerts[i]
+		log.Infof("renewing acme certificate %s(%s) which expires at %s", lbcert.Name, lbcert.Id, lbcert.NotAfter)
+		if err := lbcert.StartAcmeRenewTask(ctx, userCred, ""); err != nil {
+			log.Errorf("RenewAcmeCertificates: start renew task of %s: %s", lbcert.Id, err)
+		}
+	}
+}
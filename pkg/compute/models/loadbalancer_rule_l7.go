@@ -0,0 +1,316 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"net"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/util/regutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerListenerRuleConditions{}), func() gotypes.ISerializable {
+		return &SLoadbalancerListenerRuleConditions{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerListenerRuleRedirect{}), func() gotypes.ISerializable {
+		return &SLoadbalancerListenerRuleRedirect{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerListenerRuleFixedResponse{}), func() gotypes.ISerializable {
+		return &SLoadbalancerListenerRuleFixedResponse{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerListenerRuleRewrite{}), func() gotypes.ISerializable {
+		return &SLoadbalancerListenerRuleRewrite{}
+	})
+}
+
+// http header field names are tokens as defined in rfc7230
+var lbRuleTokenReg = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// lbRuleCheckString makes sure s can be safely quoted in haproxy configs
+func lbRuleCheckString(key, s string, allowNewline bool) error {
+	for _, c := range s {
+		if c == '\n' && allowNewline {
+			continue
+		}
+		if c < 0x20 || c > 0x7e {
+			return httperrors.NewInputParameterError("%s: only printable ascii characters are allowed", key)
+		}
+	}
+	return nil
+}
+
+type SLoadbalancerRuleKeyValues struct {
+	Name string `json:"name"`
+	// Values are alternatives.  Empty values matches presence of Name
+	Values []string `json:"values"`
+}
+
+func (kv *SLoadbalancerRuleKeyValues) validate(key string) error {
+	if !lbRuleTokenReg.MatchString(kv.Name) {
+		return httperrors.NewInputParameterError("%s: invalid name %q", key, kv.Name)
+	}
+	for _, v := range kv.Values {
+		if err := lbRuleCheckString(key, v, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SLoadbalancerListenerRuleConditions are matched in addition to domain
+// and path of the rule.  All conditions must match, while a condition with
+// multiple values matches when any one of them does
+type SLoadbalancerListenerRuleConditions struct {
+	Headers     []SLoadbalancerRuleKeyValues `json:"headers"`
+	QueryParams []SLoadbalancerRuleKeyValues `json:"query_params"`
+	Methods     []string                     `json:"methods"`
+	SourceCidrs []string                     `json:"source_cidrs"`
+}
+
+func (c *SLoadbalancerListenerRuleConditions) validate() error {
+	for i := range c.Headers {
+		if err := c.Headers[i].validate("conditions.headers"); err != nil {
+			return err
+		}
+	}
+	for i := range c.QueryParams {
+		if err := c.QueryParams[i].validate("conditions.query_params"); err != nil {
+			return err
+		}
+	}
+	for i, method := range c.Methods {
+		method = strings.ToUpper(method)
+		if !api.LB_RULE_HTTP_METHODS.Has(method) {
+			return httperrors.NewInputParameterError("conditions.methods: invalid method %q, want %s",
+				method, api.LB_RULE_HTTP_METHODS)
+		}
+		c.Methods[i] = method
+	}
+	for i, cidr := range c.SourceCidrs {
+		if !strings.Contains(cidr, "/") {
+			cidr += "/32"
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil || ipnet.IP.To4() == nil {
+			return httperrors.NewInputParameterError("conditions.source_cidrs: invalid ipv4 cidr %q", cidr)
+		}
+		c.SourceCidrs[i] = ipnet.String()
+	}
+	return nil
+}
+
+func (c *SLoadbalancerListenerRuleConditions) String() string {
+	return jsonutils.Marshal(c).String()
+}
+
+func (c *SLoadbalancerListenerRuleConditions) IsZero() bool {
+	return len(c.Headers) == 0 && len(c.QueryParams) == 0 && len(c.Methods) == 0 && len(c.SourceCidrs) == 0
+}
+
+// SLoadbalancerListenerRuleRedirect redirects requests.  Empty fields are
+// kept the same as in the request
+type SLoadbalancerListenerRuleRedirect struct {
+	Code   int    `json:"code"`
+	Scheme string `json:"scheme"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Path   string `json:"path"`
+}
+
+func (r *SLoadbalancerListenerRuleRedirect) validate() error {
+	if r.Code == 0 {
+		r.Code = 302
+	}
+	codeOk := false
+	for _, code := range api.LB_RULE_REDIRECT_CODES {
+		if r.Code == code {
+			codeOk = true
+			break
+		}
+	}
+	if !codeOk {
+		return httperrors.NewInputParameterError("redirect.code: invalid code %d, want %v", r.Code, api.LB_RULE_REDIRECT_CODES)
+	}
+	switch r.Scheme {
+	case "", "http", "https":
+	default:
+		return httperrors.NewInputParameterError("redirect.scheme: want http or https, got %q", r.Scheme)
+	}
+	if r.Host != "" && !regutils.MatchDomainName(r.Host) && !regutils.MatchIP4Addr(r.Host) {
+		return httperrors.NewInputParameterError("redirect.host: invalid host %q", r.Host)
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return httperrors.NewInputParameterError("redirect.port: invalid port %d", r.Port)
+	}
+	if r.Path != "" {
+		if !strings.HasPrefix(r.Path, "/") {
+			return httperrors.NewInputParameterError("redirect.path: must start with /")
+		}
+		if err := lbRuleCheckString("redirect.path", r.Path, false); err != nil {
+			return err
+		}
+	}
+	if r.Scheme == "" && r.Host == "" && r.Port == 0 && r.Path == "" {
+		return httperrors.NewInputParameterError("redirect: nothing to redirect to")
+	}
+	return nil
+}
+
+func (r *SLoadbalancerListenerRuleRedirect) String() string {
+	return jsonutils.Marshal(r).String()
+}
+
+func (r *SLoadbalancerListenerRuleRedirect) IsZero() bool {
+	return *r == SLoadbalancerListenerRuleRedirect{}
+}
+
+type SLoadbalancerListenerRuleFixedResponse struct {
+	Code        int    `json:"code"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+func (r *SLoadbalancerListenerRuleFixedResponse) validate() error {
+	if r.Code < 200 || r.Code > 599 {
+		return httperrors.NewInputParameterError("fixed_response.code: invalid code %d", r.Code)
+	}
+	if r.ContentType == "" {
+		r.ContentType = "text/plain"
+	}
+	if err := lbRuleCheckString("fixed_response.content_type", r.ContentType, false); err != nil {
+		return err
+	}
+	if len(r.Body) > 1024 {
+		return httperrors.NewInputParameterError("fixed_response.body: too long, at most 1024 bytes")
+	}
+	return lbRuleCheckString("fixed_response.body", r.Body, true)
+}
+
+func (r *SLoadbalancerListenerRuleFixedResponse) String() string {
+	return jsonutils.Marshal(r).String()
+}
+
+func (r *SLoadbalancerListenerRuleFixedResponse) IsZero() bool {
+	return *r == SLoadbalancerListenerRuleFixedResponse{}
+}
+
+type SLoadbalancerRuleKeyValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SLoadbalancerListenerRuleRewrite modifies requests forwarded to backends
+type SLoadbalancerListenerRuleRewrite struct {
+	// PathRegex and PathReplace rewrite request path.  PathReplace can
+	// reference capture groups with \1, \2, etc.
+	PathRegex   string                      `json:"path_regex"`
+	PathReplace string                      `json:"path_replace"`
+	SetHeaders  []SLoadbalancerRuleKeyValue `json:"set_headers"`
+}
+
+func (r *SLoadbalancerListenerRuleRewrite) validate() error {
+	if r.PathRegex != "" {
+		if _, err := regexp.Compile(r.PathRegex); err != nil {
+			return httperrors.NewInputParameterError("rewrite.path_regex: %s", err)
+		}
+		if err := lbRuleCheckString("rewrite.path_regex", r.PathRegex, false); err != nil {
+			return err
+		}
+		if !strings.HasPrefix(r.PathReplace, "/") {
+			return httperrors.NewInputParameterError("rewrite.path_replace: must start with /")
+		}
+		if err := lbRuleCheckString("rewrite.path_replace", r.PathReplace, false); err != nil {
+			return err
+		}
+	}
+	for _, h := range r.SetHeaders {
+		if !lbRuleTokenReg.MatchString(h.Name) {
+			return httperrors.NewInputParameterError("rewrite.set_headers: invalid name %q", h.Name)
+		}
+		if err := lbRuleCheckString("rewrite.set_headers", h.Value, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SLoadbalancerListenerRuleRewrite) String() string {
+	return jsonutils.Marshal(r).String()
+}
+
+func (r *SLoadbalancerListenerRuleRewrite) IsZero() bool {
+	return r.PathRegex == "" && len(r.SetHeaders) == 0
+}
+
+type lbRuleSerializable interface {
+	gotypes.ISerializable
+	validate() error
+}
+
+// validateListenerRuleL7 validates conditions and action params in data and
+// replaces them with normalized ones.  action is the effective action of
+// the rule.  lbr is the rule being updated, nil on create.  It reports
+// whether anything beyond domain/path forwarding is used.
+//
+// Only lbagent renders these for now.  Rules of managed listeners are
+// created through cloudprovider.SLoadbalancerListenerRule, which like the
+// aliyun and qcloud forwarding rules behind it carries domain, path and
+// backend group only, so they are refused there
+func validateListenerRuleL7(data *jsonutils.JSONDict, action string, lbr *SLoadbalancerListenerRule) (bool, error) {
+	conditions := &SLoadbalancerListenerRuleConditions{}
+	rewrite := &SLoadbalancerListenerRuleRewrite{}
+	items := []struct {
+		key string
+		obj lbRuleSerializable
+	}{
+		{"conditions", conditions},
+		{"redirect", &SLoadbalancerListenerRuleRedirect{}},
+		{"fixed_response", &SLoadbalancerListenerRuleFixedResponse{}},
+		{"rewrite", rewrite},
+	}
+	for _, item := range items {
+		v, err := data.Get(item.key)
+		if err != nil {
+			continue
+		}
+		if err := v.Unmarshal(item.obj); err != nil {
+			return false, httperrors.NewInputParameterError("%s: %s", item.key, err)
+		}
+		if err := item.obj.validate(); err != nil {
+			return false, err
+		}
+		data.Set(item.key, jsonutils.Marshal(item.obj))
+	}
+	switch action {
+	case api.LB_RULE_ACTION_REDIRECT:
+		if !data.Contains("redirect") && (lbr == nil || lbr.Redirect == nil) {
+			return false, httperrors.NewMissingParameterError("redirect")
+		}
+	case api.LB_RULE_ACTION_FIXED_RESPONSE:
+		if !data.Contains("fixed_response") && (lbr == nil || lbr.FixedResponse == nil) {
+			return false, httperrors.NewMissingParameterError("fixed_response")
+		}
+	}
+	extended := action != api.LB_RULE_ACTION_FORWARD || !conditions.IsZero() || !rewrite.IsZero()
+	return extended, nil
+}
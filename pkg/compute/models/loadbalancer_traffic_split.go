@@ -0,0 +1,440 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/gotypes"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/validators"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerBackendGroupWeights{}), func() gotypes.ISerializable {
+		return &SLoadbalancerBackendGroupWeights{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&SLoadbalancerTrafficShift{}), func() gotypes.ISerializable {
+		return &SLoadbalancerTrafficShift{}
+	})
+}
+
+type SLoadbalancerBackendGroupWeight struct {
+	BackendGroupId string `json:"backend_group_id"`
+	// Weight is percentage of traffic sent to the backend group
+	Weight int `json:"weight"`
+}
+
+// SLoadbalancerBackendGroupWeights splits traffic of a listener or rule
+// among backend groups.  Weights of all groups sum up to 100
+type SLoadbalancerBackendGroupWeights struct {
+	Groups []SLoadbalancerBackendGroupWeight `json:"groups"`
+}
+
+func (ws *SLoadbalancerBackendGroupWeights) String() string {
+	return jsonutils.Marshal(ws).String()
+}
+
+func (ws *SLoadbalancerBackendGroupWeights) IsZero() bool {
+	return len(ws.Groups) == 0
+}
+
+func (ws *SLoadbalancerBackendGroupWeights) copy() *SLoadbalancerBackendGroupWeights {
+	r := &SLoadbalancerBackendGroupWeights{
+		Groups: make([]SLoadbalancerBackendGroupWeight, len(ws.Groups)),
+	}
+	copy(r.Groups, ws.Groups)
+	return r
+}
+
+func (ws *SLoadbalancerBackendGroupWeights) weight(groupId string) int {
+	for _, g := range ws.Groups {
+		if g.BackendGroupId == groupId {
+			return g.Weight
+		}
+	}
+	return 0
+}
+
+// shiftTo moves step percent of traffic to groupId from other groups in
+// proportion to their current weights.  It returns the new weight of
+// groupId
+func (ws *SLoadbalancerBackendGroupWeights) shiftTo(groupId string, step int) int {
+	idx := -1
+	for i := range ws.Groups {
+		if ws.Groups[i].BackendGroupId == groupId {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		ws.Groups = append(ws.Groups, SLoadbalancerBackendGroupWeight{BackendGroupId: groupId})
+		idx = len(ws.Groups) - 1
+	}
+	cur := ws.Groups[idx].Weight
+	target := cur + step
+	if target > 100 {
+		target = 100
+	}
+	othersOld := 100 - cur
+	othersNew := 100 - target
+	sum := 0
+	for i := range ws.Groups {
+		if i == idx {
+			continue
+		}
+		w := 0
+		if othersOld > 0 {
+			w = ws.Groups[i].Weight * othersNew / othersOld
+		}
+		ws.Groups[i].Weight = w
+		sum += w
+	}
+	// give remainders of integer division to the first group still having
+	// traffic
+	for i := range ws.Groups {
+		if sum >= othersNew {
+			break
+		}
+		if i != idx && ws.Groups[i].Weight > 0 {
+			ws.Groups[i].Weight += othersNew - sum
+			sum = othersNew
+		}
+	}
+	ws.Groups[idx].Weight = target + othersNew - sum
+	return ws.Groups[idx].Weight
+}
+
+// validate resolves backend groups by id or name and makes sure they
+// belong to loadbalancer lbId
+func (ws *SLoadbalancerBackendGroupWeights) validate(userCred mcclient.TokenCredential, lbId string) error {
+	seen := map[string]bool{}
+	total := 0
+	for i := range ws.Groups {
+		g := &ws.Groups[i]
+		obj, err := db.FetchByIdOrName(LoadbalancerBackendGroupManager, userCred, g.BackendGroupId)
+		if err != nil {
+			return httperrors.NewInputParameterError("backend_group_weights: backend group %q: %s", g.BackendGroupId, err)
+		}
+		lbbg := obj.(*SLoadbalancerBackendGroup)
+		if lbbg.LoadbalancerId != lbId {
+			return httperrors.NewInputParameterError("backend_group_weights: backend group %s(%s) belongs to loadbalancer %s instead of %s",
+				lbbg.Name, lbbg.Id, lbbg.LoadbalancerId, lbId)
+		}
+		if seen[lbbg.Id] {
+			return httperrors.NewInputParameterError("backend_group_weights: duplicate backend group %s(%s)", lbbg.Name, lbbg.Id)
+		}
+		seen[lbbg.Id] = true
+		if g.Weight < 0 || g.Weight > 100 {
+			return httperrors.NewInputParameterError("backend_group_weights: weight of %s(%s) must be within 0-100", lbbg.Name, lbbg.Id)
+		}
+		g.BackendGroupId = lbbg.Id
+		total += g.Weight
+	}
+	if len(ws.Groups) > 0 && total != 100 {
+		return httperrors.NewInputParameterError("backend_group_weights: weights sum up to %d instead of 100", total)
+	}
+	return nil
+}
+
+// SLoadbalancerTrafficShift moves traffic to the target backend group step
+// by step.  It's rolled back to initial weights when error rate of the
+// target group exceeds the threshold
+type SLoadbalancerTrafficShift struct {
+	TargetBackendGroupId string `json:"target_backend_group_id"`
+	Step                 int    `json:"step"`
+	IntervalSeconds      int    `json:"interval_seconds"`
+	// ErrorRateThreshold is in percentage.  Error rate is only checked
+	// when the target group has served at least MinRequests requests in
+	// the current step
+	ErrorRateThreshold float64 `json:"error_rate_threshold"`
+	MinRequests        int64   `json:"min_requests"`
+
+	InitialWeights []SLoadbalancerBackendGroupWeight `json:"initial_weights"`
+
+	StepStartedAt time.Time `json:"step_started_at"`
+	BaseRequests  int64     `json:"base_requests"`
+	BaseErrors    int64     `json:"base_errors"`
+
+	Reason string `json:"reason"`
+}
+
+func (s *SLoadbalancerTrafficShift) String() string {
+	return jsonutils.Marshal(s).String()
+}
+
+func (s *SLoadbalancerTrafficShift) IsZero() bool {
+	return s.TargetBackendGroupId == ""
+}
+
+// SLoadbalancerTrafficSplit is embedded in listener and listener rule
+type SLoadbalancerTrafficSplit struct {
+	BackendGroupWeights *SLoadbalancerBackendGroupWeights `nullable:"true" list:"user" create:"optional" update:"user"`
+
+	TrafficShiftStatus string                     `width:"16" charset:"ascii" nullable:"false" default:"" list:"user"`
+	TrafficShift       *SLoadbalancerTrafficShift `nullable:"true" list:"user"`
+}
+
+type iLoadbalancerTrafficSplitModel interface {
+	db.IModel
+	GetOwnerProjectId() string
+
+	getTrafficSplit() *SLoadbalancerTrafficSplit
+	getLoadbalancerId() string
+	getBackendGroupId() string
+}
+
+// validateBackendGroupWeights validates backend_group_weights in data.
+// Traffic split is implemented by lbagent only
+func validateBackendGroupWeights(userCred mcclient.TokenCredential, data *jsonutils.JSONDict, lbId, managerId, listenerType string, split *SLoadbalancerTrafficSplit) error {
+	v, err := data.Get("backend_group_weights")
+	if err != nil {
+		return nil
+	}
+	if managerId != "" {
+		return httperrors.NewUnsupportOperationError("backend_group_weights is not supported by public cloud loadbalancers")
+	}
+	if listenerType == api.LB_LISTENER_TYPE_UDP {
+		return httperrors.NewUnsupportOperationError("backend_group_weights is not supported by udp listener")
+	}
+	if split != nil && split.TrafficShiftStatus == api.LB_TRAFFIC_SHIFT_STATUS_RUNNING {
+		return httperrors.NewInvalidStatusError("traffic shift is running")
+	}
+	ws := &SLoadbalancerBackendGroupWeights{}
+	if err := v.Unmarshal(ws); err != nil {
+		return httperrors.NewInputParameterError("backend_group_weights: %s", err)
+	}
+	if err := ws.validate(userCred, lbId); err != nil {
+		return err
+	}
+	data.Set("backend_group_weights", jsonutils.Marshal(ws))
+	return nil
+}
+
+func loadbalancerBackendGroupTraffic(groupId string) (int64, int64, error) {
+	backends := []SLoadbalancerBackend{}
+	q := LoadbalancerBackendManager.Query().Equals("backend_group_id", groupId)
+	if err := db.FetchModelObjects(LoadbalancerBackendManager, q, &backends); err != nil {
+		return 0, 0, err
+	}
+	var requests, errors int64
+	for i := range backends {
+		requests += backends[i].RequestCount
+		errors += backends[i].ErrorCount
+	}
+	return requests, errors, nil
+}
+
+func startLoadbalancerTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, model iLoadbalancerTrafficSplitModel, data jsonutils.JSONObject) error {
+	split := model.getTrafficSplit()
+	if split.TrafficShiftStatus == api.LB_TRAFFIC_SHIFT_STATUS_RUNNING {
+		return httperrors.NewInvalidStatusError("traffic shift is already running")
+	}
+	dataDict, ok := data.(*jsonutils.JSONDict)
+	if !ok {
+		return httperrors.NewInputParameterError("invalid params")
+	}
+	targetV := validators.NewModelIdOrNameValidator("target_backend_group", "loadbalancerbackendgroup", model.GetOwnerProjectId())
+	stepV := validators.NewRangeValidator("step", 1, 100)
+	stepV.Default(10)
+	intervalV := validators.NewRangeValidator("interval", 10, 86400)
+	intervalV.Default(300)
+	minRequestsV := validators.NewNonNegativeValidator("min_requests")
+	minRequestsV.Default(100)
+	for _, v := range []validators.IValidator{targetV, stepV, intervalV, minRequestsV} {
+		if err := v.Validate(dataDict); err != nil {
+			return err
+		}
+	}
+	threshold := 5.0
+	if dataDict.Contains("error_rate_threshold") {
+		f, err := dataDict.Float("error_rate_threshold")
+		if err != nil || f <= 0 || f > 100 {
+			return httperrors.NewInputParameterError("error_rate_threshold: want percentage within (0, 100]")
+		}
+		threshold = f
+	}
+	target := targetV.Model.(*SLoadbalancerBackendGroup)
+	if target.LoadbalancerId != model.getLoadbalancerId() {
+		return httperrors.NewInputParameterError("backend group %s(%s) belongs to loadbalancer %s instead of %s",
+			target.Name, target.Id, target.LoadbalancerId, model.getLoadbalancerId())
+	}
+
+	var weights *SLoadbalancerBackendGroupWeights
+	if split.BackendGroupWeights != nil && !split.BackendGroupWeights.IsZero() {
+		weights = split.BackendGroupWeights.copy()
+	} else if groupId := model.getBackendGroupId(); groupId != "" {
+		weights = &SLoadbalancerBackendGroupWeights{
+			Groups: []SLoadbalancerBackendGroupWeight{{BackendGroupId: groupId, Weight: 100}},
+		}
+	} else {
+		return httperrors.NewInputParameterError("no backend group to shift traffic from")
+	}
+	if weights.weight(target.Id) >= 100 {
+		return httperrors.NewInputParameterError("all traffic already goes to backend group %s(%s)", target.Name, target.Id)
+	}
+	requests, errors, err := loadbalancerBackendGroupTraffic(target.Id)
+	if err != nil {
+		return httperrors.NewInternalServerError("get traffic of backend group %s: %s", target.Id, err)
+	}
+	shift := &SLoadbalancerTrafficShift{
+		TargetBackendGroupId: target.Id,
+		Step:                 int(stepV.Value),
+		IntervalSeconds:      int(intervalV.Value),
+		ErrorRateThreshold:   threshold,
+		MinRequests:          minRequestsV.Value,
+		InitialWeights:       weights.copy().Groups,
+		StepStartedAt:        time.Now(),
+		BaseRequests:         requests,
+		BaseErrors:           errors,
+	}
+	weights.shiftTo(target.Id, shift.Step)
+	diff, err := db.Update(model, func() error {
+		split.BackendGroupWeights = weights
+		split.TrafficShift = shift
+		split.TrafficShiftStatus = api.LB_TRAFFIC_SHIFT_STATUS_RUNNING
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogEvent(model, db.ACT_TRAFFIC_SHIFT, diff, userCred)
+	logclient.AddActionLogWithContext(ctx, model, logclient.ACT_TRAFFIC_SHIFT, diff, userCred, true)
+	return nil
+}
+
+func cancelLoadbalancerTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, model iLoadbalancerTrafficSplitModel, data jsonutils.JSONObject) error {
+	split := model.getTrafficSplit()
+	if split.TrafficShiftStatus != api.LB_TRAFFIC_SHIFT_STATUS_RUNNING {
+		return httperrors.NewInvalidStatusError("no traffic shift is running")
+	}
+	rollback := jsonutils.QueryBoolean(data, "rollback", false)
+	return finishLoadbalancerTrafficShift(ctx, userCred, model, api.LB_TRAFFIC_SHIFT_STATUS_CANCELLED, rollback, "cancelled by user")
+}
+
+func finishLoadbalancerTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, model iLoadbalancerTrafficSplitModel, status string, rollback bool, reason string) error {
+	split := model.getTrafficSplit()
+	diff, err := db.Update(model, func() error {
+		if rollback {
+			split.BackendGroupWeights = &SLoadbalancerBackendGroupWeights{
+				Groups: split.TrafficShift.InitialWeights,
+			}
+		}
+		shift := *split.TrafficShift
+		shift.Reason = reason
+		split.TrafficShift = &shift
+		split.TrafficShiftStatus = status
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	action, logAction := db.ACT_TRAFFIC_SHIFT, logclient.ACT_TRAFFIC_SHIFT
+	if rollback {
+		action, logAction = db.ACT_TRAFFIC_SHIFT_ROLLBACK, logclient.ACT_TRAFFIC_SHIFT_ROLLBACK
+	}
+	db.OpsLog.LogEvent(model, action, diff, userCred)
+	logclient.AddActionLogWithContext(ctx, model, logAction, diff, userCred, status != api.LB_TRAFFIC_SHIFT_STATUS_ROLLED_BACK)
+	return nil
+}
+
+// advanceLoadbalancerTrafficShift rolls back the shift if the target group
+// is failing, or moves another step of traffic when interval passed
+func advanceLoadbalancerTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, model iLoadbalancerTrafficSplitModel) error {
+	split := model.getTrafficSplit()
+	shift := split.TrafficShift
+	if shift == nil || split.BackendGroupWeights == nil {
+		return finishLoadbalancerTrafficShift(ctx, userCred, model, api.LB_TRAFFIC_SHIFT_STATUS_CANCELLED, false, "traffic shift state lost")
+	}
+	requests, errors, err := loadbalancerBackendGroupTraffic(shift.TargetBackendGroupId)
+	if err != nil {
+		return err
+	}
+	requests -= shift.BaseRequests
+	errors -= shift.BaseErrors
+	if requests > 0 && requests >= shift.MinRequests {
+		rate := float64(errors) * 100 / float64(requests)
+		if rate > shift.ErrorRateThreshold {
+			reason := fmt.Sprintf("error rate %.2f%% (%d/%d) exceeds threshold %.2f%%",
+				rate, errors, requests, shift.ErrorRateThreshold)
+			log.Warningf("traffic shift of %s %s(%s) rolled back: %s", model.Keyword(), model.GetName(), model.GetId(), reason)
+			return finishLoadbalancerTrafficShift(ctx, userCred, model, api.LB_TRAFFIC_SHIFT_STATUS_ROLLED_BACK, true, reason)
+		}
+	}
+	if time.Since(shift.StepStartedAt) < time.Duration(shift.IntervalSeconds)*time.Second {
+		return nil
+	}
+	if split.BackendGroupWeights.weight(shift.TargetBackendGroupId) >= 100 {
+		return finishLoadbalancerTrafficShift(ctx, userCred, model, api.LB_TRAFFIC_SHIFT_STATUS_COMPLETED, false, "")
+	}
+	weights := split.BackendGroupWeights.copy()
+	weights.shiftTo(shift.TargetBackendGroupId, shift.Step)
+	diff, err := db.Update(model, func() error {
+		newShift := *shift
+		newShift.StepStartedAt = time.Now()
+		newShift.BaseRequests += requests
+		newShift.BaseErrors += errors
+		split.BackendGroupWeights = weights
+		split.TrafficShift = &newShift
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	db.OpsLog.LogEvent(model, db.ACT_TRAFFIC_SHIFT, diff, userCred)
+	return nil
+}
+
+// CheckLoadbalancerTrafficShifts advances running traffic shifts of
+// listeners and listener rules
+func CheckLoadbalancerTrafficShifts(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	splitModels := []iLoadbalancerTrafficSplitModel{}
+	{
+		q := LoadbalancerListenerManager.Query().Equals("traffic_shift_status", api.LB_TRAFFIC_SHIFT_STATUS_RUNNING).IsFalse("pending_deleted")
+		listeners := []SLoadbalancerListener{}
+		if err := db.FetchModelObjects(LoadbalancerListenerManager, q, &listeners); err != nil {
+			log.Errorf("CheckLoadbalancerTrafficShifts: fetch listeners: %s", err)
+			return
+		}
+		for i := range listeners {
+			splitModels = append(splitModels, &listeners[i])
+		}
+	}
+	{
+		q := LoadbalancerListenerRuleManager.Query().Equals("traffic_shift_status", api.LB_TRAFFIC_SHIFT_STATUS_RUNNING).IsFalse("pending_deleted")
+		rules := []SLoadbalancerListenerRule{}
+		if err := db.FetchModelObjects(LoadbalancerListenerRuleManager, q, &rules); err != nil {
+			log.Errorf("CheckLoadbalancerTrafficShifts: fetch listener rules: %s", err)
+			return
+		}
+		for i := range rules {
+			splitModels = append(splitModels, &rules[i])
+		}
+	}
+	for _, model := range splitModels {
+		if err := advanceLoadbalancerTrafficShift(ctx, userCred, model); err != nil {
+			log.Errorf("CheckLoadbalancerTrafficShifts: %s %s(%s): %s", model.Keyword(), model.GetName(), model.GetId(), err)
+		}
+	}
+}
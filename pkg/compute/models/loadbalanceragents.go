@@ -476,6 +476,33 @@ func (lbagent *SLoadbalancerAgent) PerformHb(ctx context.Context, userCred mccli
 		log.Infof("lbagent %s(%s) state changed: %s", lbagent.Name, lbagent.Id, diff)
 		db.OpsLog.LogEvent(lbagent, db.ACT_UPDATE, diff, userCred)
 	}
+	if lbagent.HaState == api.LB_HA_STATE_MASTER && data.Contains("backend_health") {
+		healthObj, err := data.GetMap("backend_health")
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid backend_health: %s", err)
+		}
+		health := map[string]string{}
+		for id, v := range healthObj {
+			status, _ := v.GetString()
+			if !api.LB_BACKEND_HEALTH_STATUSES.Has(status) {
+				return nil, httperrors.NewInputParameterError("invalid health status %q of backend %s", status, id)
+			}
+			health[id] = status
+		}
+		if err := LoadbalancerBackendManager.UpdateHealthStatus(health); err != nil {
+			log.Errorf("lbagent %s(%s) update backend health: %s", lbagent.Name, lbagent.Id, err)
+		}
+	}
+	if lbagent.HaState == api.LB_HA_STATE_MASTER && data.Contains("backend_traffic") {
+		traffic := map[string]SLoadbalancerBackendTraffic{}
+		trafficObj, _ := data.Get("backend_traffic")
+		if err := trafficObj.Unmarshal(&traffic); err != nil {
+			return nil, httperrors.NewInputParameterError("invalid backend_traffic: %s", err)
+		}
+		if err := LoadbalancerBackendManager.AddTraffic(traffic); err != nil {
+			log.Errorf("lbagent %s(%s) update backend traffic: %s", lbagent.Name, lbagent.Id, err)
+		}
+	}
 	return nil, nil
 }
 
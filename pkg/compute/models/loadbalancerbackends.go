@@ -17,6 +17,7 @@ package models
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -64,6 +65,14 @@ type SLoadbalancerBackend struct {
 	Weight         int    `width:"36" charset:"ascii" nullable:"false" list:"user" create:"optional" update:"user"`
 	Address        string `width:"36" charset:"ascii" nullable:"false" list:"user" create:"optional"`
 	Port           int    `nullable:"false" list:"user" create:"required" update:"user"`
+
+	// HealthStatus is reported by lbagent from health check of haproxy and gobetween
+	HealthStatus string `width:"16" charset:"ascii" nullable:"false" default:"unknown" list:"user"`
+
+	// RequestCount and ErrorCount are accumulated from traffic reported by
+	// lbagent.  They are used for calculating error rate in traffic shift
+	RequestCount int64 `nullable:"false" default:"0" list:"user"`
+	ErrorCount   int64 `nullable:"false" default:"0" list:"user"`
 }
 
 func (man *SLoadbalancerBackendManager) pendingDeleteSubs(ctx context.Context, userCred mcclient.TokenCredential, q *sqlchemy.SQuery) {
@@ -93,6 +102,52 @@ func (man *SLoadbalancerBackendManager) ListItemFilter(ctx context.Context, q *s
 	return q, nil
 }
 
+// UpdateHealthStatus records health status of backends reported by lbagent.
+//
+// The update bypasses TableSpec().Update on purpose: it would bump
+// updated_at and update_version, causing every lbagent to consider the
+// corpus changed and reload haproxy/gobetween on each status flip
+func (man *SLoadbalancerBackendManager) UpdateHealthStatus(health map[string]string) error {
+	byStatus := map[string][]interface{}{}
+	for id, status := range health {
+		byStatus[status] = append(byStatus[status], id)
+	}
+	tableName := man.TableSpec().Name()
+	for status, ids := range byStatus {
+		args := append([]interface{}{status}, ids...)
+		placeholders := strings.Repeat("?,", len(ids))
+		sql := fmt.Sprintf("UPDATE `%s` SET `health_status` = ? WHERE `id` IN (%s)",
+			tableName, placeholders[:len(placeholders)-1])
+		if _, err := sqlchemy.GetDB().Exec(sql, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SLoadbalancerBackendTraffic is number of requests and errors of a backend
+// since last report
+type SLoadbalancerBackendTraffic struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// AddTraffic accumulates traffic counters of backends reported by lbagent.
+// Like UpdateHealthStatus, it bypasses TableSpec().Update
+func (man *SLoadbalancerBackendManager) AddTraffic(traffic map[string]SLoadbalancerBackendTraffic) error {
+	tableName := man.TableSpec().Name()
+	sql := fmt.Sprintf("UPDATE `%s` SET `request_count` = `request_count` + ?, `error_count` = `error_count` + ? WHERE `id` = ?", tableName)
+	for id, t := range traffic {
+		if t.Requests <= 0 && t.Errors <= 0 {
+			continue
+		}
+		if _, err := sqlchemy.GetDB().Exec(sql, t.Requests, t.Errors, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (man *SLoadbalancerBackendManager) ValidateBackendVpc(lb *SLoadbalancer, guest *SGuest, backendgroup *SLoadbalancerBackendGroup) error {
 	region := lb.GetRegion()
 	if region == nil {
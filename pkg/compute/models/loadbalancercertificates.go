@@ -66,8 +66,15 @@ type SLoadbalancerCertificate struct {
 	SManagedResourceBase
 	SCloudregionResourceBase
 
-	Certificate string `create:"required" list:"user" update:"user"`
-	PrivateKey  string `create:"required" list:"admin" update:"user"`
+	Certificate string `create:"optional" list:"user" update:"user"`
+	PrivateKey  string `create:"optional" list:"admin" update:"user"`
+
+	// CertificateSource tells where the certificate comes from.
+	// Certificates of source "acme" are issued and renewed automatically
+	CertificateSource string `width:"16" charset:"ascii" nullable:"false" default:"upload" list:"user" create:"optional"`
+	// AcmeChallenges maps http-01 challenge tokens to key authorizations.
+	// lbagent serves them during issuance
+	AcmeChallenges *jsonutils.JSONDict `nullable:"true" list:"admin"`
 
 	// derived attributes
 	PublicKeyAlgorithm      string    `create:"optional" list:"user" update:"user"`
@@ -155,7 +162,17 @@ func (man *SLoadbalancerCertificateManager) ListItemFilter(ctx context.Context,
 }
 
 func (man *SLoadbalancerCertificateManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
-	data, err := man.validateCertKey(ctx, data)
+	sourceV := validators.NewStringChoicesValidator("certificate_source", api.LB_CERT_SOURCES)
+	sourceV.Default(api.LB_CERT_SOURCE_UPLOAD)
+	if err := sourceV.Validate(data); err != nil {
+		return nil, err
+	}
+	var err error
+	if sourceV.Value == api.LB_CERT_SOURCE_ACME {
+		data, err = man.validateAcmeDomains(ctx, data)
+	} else {
+		data, err = man.validateCertKey(ctx, data)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -175,6 +192,11 @@ func (man *SLoadbalancerCertificateManager) ValidateCreateData(ctx context.Conte
 		return nil, err
 	}
 	region := regionV.Model.(*SCloudregion)
+	if sourceV.Value == api.LB_CERT_SOURCE_ACME {
+		if managerIdV.Model != nil || region.GetDriver().GetProvider() != api.CLOUD_PROVIDER_ONECLOUD {
+			return nil, httperrors.NewInputParameterError("acme certificate is only supported for onecloud loadbalancers")
+		}
+	}
 	return region.GetDriver().ValidateCreateLoadbalancerCertificateData(ctx, userCred, data)
 }
 
@@ -220,6 +242,12 @@ func (lbcert *SLoadbalancerCertificate) AllowPerformStatus(ctx context.Context,
 }
 
 func (lbcert *SLoadbalancerCertificate) ValidateUpdateData(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	if lbcert.CertificateSource == api.LB_CERT_SOURCE_ACME {
+		if data.Contains("certificate") || data.Contains("private_key") {
+			return nil, httperrors.NewInputParameterError("certificate and private key of acme certificate are managed automatically")
+		}
+		return lbcert.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, data)
+	}
 	if !data.Contains("certificate") {
 		data.Set("certificate", jsonutils.NewString(lbcert.Certificate))
 	}
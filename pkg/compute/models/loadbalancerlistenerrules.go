@@ -61,8 +61,20 @@ type SLoadbalancerListenerRule struct {
 	Domain string `width:"128" charset:"ascii" nullable:"false" list:"user" create:"optional"`
 	Path   string `width:"128" charset:"ascii" nullable:"false" list:"user" create:"optional"`
 
+	// Priority orders evaluation of rules, lower value first.  Rules of
+	// the same priority are ordered from the most specific domain and path
+	Priority   int                                  `nullable:"false" default:"100" list:"user" create:"optional" update:"user"`
+	Conditions *SLoadbalancerListenerRuleConditions `nullable:"true" list:"user" create:"optional" update:"user"`
+
+	Action        string                                  `width:"16" charset:"ascii" nullable:"false" default:"forward" list:"user" create:"optional" update:"user"`
+	Redirect      *SLoadbalancerListenerRuleRedirect      `nullable:"true" list:"user" create:"optional" update:"user"`
+	FixedResponse *SLoadbalancerListenerRuleFixedResponse `nullable:"true" list:"user" create:"optional" update:"user"`
+	Rewrite       *SLoadbalancerListenerRuleRewrite       `nullable:"true" list:"user" create:"optional" update:"user"`
+
 	SLoadbalancerHealthCheck // 目前只有腾讯云HTTP、HTTPS类型的健康检查是和规则绑定的。
 	SLoadbalancerHTTPRateLimiter
+
+	SLoadbalancerTrafficSplit
 }
 
 func loadbalancerListenerRuleCheckUniqueness(ctx context.Context, lbls *SLoadbalancerListener, domain, path string) error {
@@ -70,7 +82,9 @@ func loadbalancerListenerRuleCheckUniqueness(ctx context.Context, lbls *SLoadbal
 		IsFalse("pending_deleted").
 		Equals("listener_id", lbls.Id).
 		Equals("domain", domain).
-		Equals("path", path)
+		Equals("path", path).
+		Equals("action", api.LB_RULE_ACTION_FORWARD).
+		IsNullOrEmpty("conditions")
 	var lblsr SLoadbalancerListenerRule
 	q.First(&lblsr)
 	if len(lblsr.Id) > 0 {
@@ -105,8 +119,15 @@ func (man *SLoadbalancerListenerRuleManager) ListItemFilter(ctx context.Context,
 }
 
 func (man *SLoadbalancerListenerRuleManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	actionV := validators.NewStringChoicesValidator("action", api.LB_RULE_ACTIONS).Default(api.LB_RULE_ACTION_FORWARD)
+	if err := actionV.Validate(data); err != nil {
+		return nil, err
+	}
+	action := actionV.(*validators.ValidatorStringChoices).Value
 	listenerV := validators.NewModelIdOrNameValidator("listener", "loadbalancerlistener", ownerProjId)
 	backendGroupV := validators.NewModelIdOrNameValidator("backend_group", "loadbalancerbackendgroup", ownerProjId)
+	// redirect and fixed response do not need backends
+	backendGroupV.Optional(action != api.LB_RULE_ACTION_FORWARD || data.Contains("backend_group_weights"))
 	domainV := validators.NewDomainNameValidator("domain")
 	pathV := validators.NewURLPathValidator("path")
 	keyV := map[string]validators.IValidator{
@@ -119,6 +140,8 @@ func (man *SLoadbalancerListenerRuleManager) ValidateCreateData(ctx context.Cont
 
 		"http_request_rate":         validators.NewNonNegativeValidator("http_request_rate").Default(0),
 		"http_request_rate_per_src": validators.NewNonNegativeValidator("http_request_rate_per_src").Default(0),
+
+		"priority": validators.NewRangeValidator("priority", 1, 1000).Default(100),
 	}
 	for _, v := range keyV {
 		if err := v.Validate(data); err != nil {
@@ -126,6 +149,17 @@ func (man *SLoadbalancerListenerRuleManager) ValidateCreateData(ctx context.Cont
 		}
 	}
 	listener := listenerV.Model.(*SLoadbalancerListener)
+	extended, err := validateListenerRuleL7(data, action, nil)
+	if err != nil {
+		return nil, err
+	}
+	if extended && listener.ManagerId != "" {
+		return nil, httperrors.NewUnsupportOperationError("rule conditions, redirect, fixed response and rewrite are not supported by %s yet",
+			listener.GetProviderName())
+	}
+	if err := validateBackendGroupWeights(userCred, data, listener.LoadbalancerId, listener.ManagerId, listener.ListenerType, nil); err != nil {
+		return nil, err
+	}
 	data.Set("cloudregion_id", jsonutils.NewString(listener.CloudregionId))
 	data.Set("manager_id", jsonutils.NewString(listener.ManagerId))
 	listenerType := listener.ListenerType
@@ -149,9 +183,11 @@ func (man *SLoadbalancerListenerRuleManager) ValidateCreateData(ctx context.Cont
 			}
 		}
 	}
-	err := loadbalancerListenerRuleCheckUniqueness(ctx, listener, domainV.Value, pathV.Value)
-	if err != nil {
-		return nil, err
+	if !extended {
+		err := loadbalancerListenerRuleCheckUniqueness(ctx, listener, domainV.Value, pathV.Value)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if _, err := man.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerProjId, query, data); err != nil {
 		return nil, err
@@ -216,6 +252,9 @@ func (lbr *SLoadbalancerListenerRule) ValidateUpdateData(ctx context.Context, us
 		"backend_group":             backendGroupV,
 		"http_request_rate":         validators.NewNonNegativeValidator("http_request_rate"),
 		"http_request_rate_per_src": validators.NewNonNegativeValidator("http_request_rate_per_src"),
+
+		"priority": validators.NewRangeValidator("priority", 1, 1000),
+		"action":   validators.NewStringChoicesValidator("action", api.LB_RULE_ACTIONS),
 	}
 	for _, v := range keyV {
 		v.Optional(true)
@@ -223,6 +262,31 @@ func (lbr *SLoadbalancerListenerRule) ValidateUpdateData(ctx context.Context, us
 			return nil, err
 		}
 	}
+	action := lbr.Action
+	if v, _ := data.GetString("action"); v != "" {
+		action = v
+	}
+	if action == api.LB_RULE_ACTION_FORWARD && lbr.BackendGroupId == "" && backendGroupV.Model == nil &&
+		lbr.BackendGroupWeights == nil && !data.Contains("backend_group_weights") {
+		return nil, httperrors.NewMissingParameterError("backend_group")
+	}
+	extended, err := validateListenerRuleL7(data, action, lbr)
+	if err != nil {
+		return nil, err
+	}
+	if extended && lbr.ManagerId != "" {
+		return nil, httperrors.NewUnsupportOperationError("rule conditions, redirect, fixed response and rewrite are not supported by %s yet",
+			lbr.GetProviderName())
+	}
+	if data.Contains("backend_group_weights") {
+		listener := lbr.GetLoadbalancerListener()
+		if listener == nil {
+			return nil, httperrors.NewResourceNotFoundError("listener %s not found", lbr.ListenerId)
+		}
+		if err := validateBackendGroupWeights(userCred, data, listener.LoadbalancerId, lbr.ManagerId, listener.ListenerType, &lbr.SLoadbalancerTrafficSplit); err != nil {
+			return nil, err
+		}
+	}
 	if backendGroup, ok := backendGroupV.Model.(*SLoadbalancerBackendGroup); ok && backendGroup.Id != lbr.BackendGroupId {
 		listenerM, err := LoadbalancerListenerManager.FetchById(lbr.ListenerId)
 		if err != nil {
@@ -273,6 +337,45 @@ func (lbr *SLoadbalancerListenerRule) GetLoadbalancerListener() *SLoadbalancerLi
 	return listener.(*SLoadbalancerListener)
 }
 
+func (lbr *SLoadbalancerListenerRule) getTrafficSplit() *SLoadbalancerTrafficSplit {
+	return &lbr.SLoadbalancerTrafficSplit
+}
+
+func (lbr *SLoadbalancerListenerRule) getLoadbalancerId() string {
+	if listener := lbr.GetLoadbalancerListener(); listener != nil {
+		return listener.LoadbalancerId
+	}
+	return ""
+}
+
+func (lbr *SLoadbalancerListenerRule) getBackendGroupId() string {
+	return lbr.BackendGroupId
+}
+
+func (lbr *SLoadbalancerListenerRule) AllowPerformTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return lbr.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, lbr, "traffic-shift")
+}
+
+// PerformTrafficShift gradually moves traffic matching the rule to
+// target_backend_group, step percent every interval seconds
+func (lbr *SLoadbalancerListenerRule) PerformTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if lbr.ManagerId != "" {
+		return nil, httperrors.NewUnsupportOperationError("traffic shift is not supported by %s", lbr.GetProviderName())
+	}
+	if lbr.Action != api.LB_RULE_ACTION_FORWARD {
+		return nil, httperrors.NewUnsupportOperationError("traffic shift is only supported by rules of action %s", api.LB_RULE_ACTION_FORWARD)
+	}
+	return nil, startLoadbalancerTrafficShift(ctx, userCred, lbr, data)
+}
+
+func (lbr *SLoadbalancerListenerRule) AllowPerformTrafficShiftCancel(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return lbr.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, lbr, "traffic-shift-cancel")
+}
+
+func (lbr *SLoadbalancerListenerRule) PerformTrafficShiftCancel(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return nil, cancelLoadbalancerTrafficShift(ctx, userCred, lbr, data)
+}
+
 func (lbr *SLoadbalancerListenerRule) GetRegion() *SCloudregion {
 	if listener := lbr.GetLoadbalancerListener(); listener != nil {
 		return listener.GetRegion()
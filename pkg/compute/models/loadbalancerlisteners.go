@@ -136,6 +136,8 @@ type SLoadbalancerListener struct {
 
 	SLoadbalancerHealthCheck
 	SLoadbalancerHTTPRateLimiter
+
+	SLoadbalancerTrafficSplit
 }
 
 func (man *SLoadbalancerListenerManager) checkListenerUniqueness(ctx context.Context, lb *SLoadbalancer, listenerType string, listenerPort int64) error {
@@ -261,6 +263,9 @@ func (man *SLoadbalancerListenerManager) ValidateCreateData(ctx context.Context,
 			}
 		}
 	}
+	if err := validateBackendGroupWeights(userCred, data, lb.Id, lb.ManagerId, listenerType, nil); err != nil {
+		return nil, err
+	}
 	{
 		if listenerType == api.LB_LISTENER_TYPE_HTTPS {
 			certV := validators.NewModelIdOrNameValidator("certificate", "loadbalancercertificate", ownerProjId)
@@ -381,6 +386,40 @@ func (lblis *SLoadbalancerListener) StartLoadBalancerListenerStopTask(ctx contex
 	return nil
 }
 
+func (lblis *SLoadbalancerListener) getTrafficSplit() *SLoadbalancerTrafficSplit {
+	return &lblis.SLoadbalancerTrafficSplit
+}
+
+func (lblis *SLoadbalancerListener) getLoadbalancerId() string {
+	return lblis.LoadbalancerId
+}
+
+func (lblis *SLoadbalancerListener) getBackendGroupId() string {
+	return lblis.BackendGroupId
+}
+
+func (lblis *SLoadbalancerListener) AllowPerformTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return lblis.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, lblis, "traffic-shift")
+}
+
+// PerformTrafficShift gradually moves traffic of the listener to
+// target_backend_group, step percent every interval seconds
+func (lblis *SLoadbalancerListener) PerformTrafficShift(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if lblis.ManagerId != "" || lblis.ListenerType == api.LB_LISTENER_TYPE_UDP {
+		return nil, httperrors.NewUnsupportOperationError("traffic shift is not supported by %s %s listener",
+			lblis.GetProviderName(), lblis.ListenerType)
+	}
+	return nil, startLoadbalancerTrafficShift(ctx, userCred, lblis, data)
+}
+
+func (lblis *SLoadbalancerListener) AllowPerformTrafficShiftCancel(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return lblis.IsOwner(userCred) || db.IsAdminAllowPerform(userCred, lblis, "traffic-shift-cancel")
+}
+
+func (lblis *SLoadbalancerListener) PerformTrafficShiftCancel(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return nil, cancelLoadbalancerTrafficShift(ctx, userCred, lblis, data)
+}
+
 func (lblis *SLoadbalancerListener) AllowPerformSyncstatus(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
 	return db.IsAdminAllowPerform(userCred, lblis, "syncstatus")
 }
@@ -465,6 +504,9 @@ func (lblis *SLoadbalancerListener) ValidateUpdateData(ctx context.Context, user
 			return nil, err
 		}
 	}
+	if err := validateBackendGroupWeights(userCred, data, lblis.LoadbalancerId, lblis.ManagerId, lblis.ListenerType, &lblis.SLoadbalancerTrafficSplit); err != nil {
+		return nil, err
+	}
 
 	if err := LoadbalancerListenerManager.validateAcl(aclStatusV, aclTypeV, aclV, data); err != nil {
 		return nil, err
@@ -91,6 +91,8 @@ type ComputeOptions struct {
 	HostOfflineMaxSeconds        int `help:"Maximal seconds interval that a host considered offline during which it did not ping region, default is 3 minues" default:"180"`
 	HostOfflineDetectionInterval int `help:"Interval to check offline hosts, defualt is half a minute" default:"30"`
 
+	TaskReaperIntervalSeconds int `help:"Interval to retry or fail tasks whose stage timed out, default is 1 minute" default:"60"`
+
 	MinimalIpAddrReusedIntervalSeconds int `help:"Minimal seconds when a release IP address can be reallocate" default:"30"`
 
 	CloudSyncWorkerCount         int `help:"how many current synchronization threads" default:"2"`
@@ -105,6 +107,23 @@ type ComputeOptions struct {
 
 	DisconnectedCloudAccountRetryProbeIntervalHours int `help:"interval to wait to probe status of a disconnected cloud account" default:"24"`
 
+	HostRebalanceMode                 string  `help:"Mode of automatic host rebalance, off: disabled, recommend: only log migration plan, auto: do live migrations" choices:"off|recommend|auto" default:"off"`
+	HostRebalanceIntervalSeconds      int     `help:"Interval to check imbalance of hosts, default is 10 minutes" default:"600"`
+	HostRebalanceThreshold            float64 `help:"Host whose load exceeds the average load of its zone by this value is considered overloaded" default:"0.2"`
+	HostRebalanceMaxMigrations        int     `help:"Maximal concurrent migrations started by rebalance" default:"2"`
+	HostRebalanceMaxMigrationsPerHost int     `help:"Maximal migrations out of a single host in one rebalance round" default:"1"`
+	HostRebalanceGuestCooldownSeconds int     `help:"Seconds a guest will not be moved again after migrated by rebalance, default is 1 hour" default:"3600"`
+
+	AcmeDirectoryUrl              string `help:"Directory url of ACME server for issuing loadbalancer certificates" default:"https://acme-v02.api.letsencrypt.org/directory"`
+	AcmeDirectoryCaFile           string `help:"CA certificate file to verify the ACME server, e.g. root of a local pebble test server"`
+	AcmeAccountEmail              string `help:"Contact email of the ACME account"`
+	AcmeAccountKeyFile            string `help:"ACME account key file, generated if not exist" default:"/etc/yunion/acme/account.key"`
+	AcmeChallengeWaitSeconds      int    `help:"Seconds to wait for lbagents to serve http-01 challenges before asking ACME server to validate" default:"60"`
+	AcmeRenewBeforeDays           int    `help:"Renew ACME certificates this many days before expiration" default:"30"`
+	AcmeRenewCheckIntervalSeconds int    `help:"Interval to check ACME certificates due to renew, default is 1 hour" default:"3600"`
+
+	LoadbalancerTrafficShiftCheckSeconds int `help:"Interval to advance and check error rate of loadbalancer traffic shifts" default:"30"`
+
 	IsSlaveNode bool `help:"Region service slave node"`
 
 	SCapabilityOptions
@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 
+	"yunion.io/x/jsonutils"
+
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	"yunion.io/x/onecloud/pkg/cloudprovider"
@@ -139,3 +141,35 @@ func (self *SBaseRegionDriver) RequestApplySnapshotPolicy(ctx context.Context, u
 func (self *SBaseRegionDriver) RequestCancelSnapshotPolicy(ctx context.Context, userCred mcclient.TokenCredential, region cloudprovider.ICloudRegion, task taskman.ITask, diskIds []string) error {
 	return fmt.Errorf("Not Implement RequestApplySnapshotPolicy")
 }
+
+func (self *SBaseRegionDriver) ValidateCreateBucketData(ctx context.Context, userCred mcclient.TokenCredential, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	return nil, fmt.Errorf("Not Implement ValidateCreateBucketData")
+}
+
+func (self *SBaseRegionDriver) RequestCreateBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucket, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestCreateBucket")
+}
+
+func (self *SBaseRegionDriver) RequestDeleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucket, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestDeleteBucket")
+}
+
+func (self *SBaseRegionDriver) RequestStartDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestStartDBInstance")
+}
+
+func (self *SBaseRegionDriver) RequestStopDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestStopDBInstance")
+}
+
+func (self *SBaseRegionDriver) RequestRebootDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestRebootDBInstance")
+}
+
+func (self *SBaseRegionDriver) RequestChangeDBInstanceConfig(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestChangeDBInstanceConfig")
+}
+
+func (self *SBaseRegionDriver) RequestDeleteDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestDeleteDBInstance")
+}
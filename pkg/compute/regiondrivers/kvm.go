@@ -192,6 +192,12 @@ func (self *SKVMRegionDriver) RequestDeleteLoadbalancerAcl(ctx context.Context,
 }
 
 func (self *SKVMRegionDriver) RequestCreateLoadbalancerCertificate(ctx context.Context, userCred mcclient.TokenCredential, lbcert *models.SLoadbalancerCertificate, task taskman.ITask) error {
+	if lbcert.CertificateSource == api.LB_CERT_SOURCE_ACME {
+		taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+			return nil, lbcert.AcmeIssue(ctx, userCred)
+		})
+		return nil
+	}
 	task.ScheduleRun(nil)
 	return nil
 }
@@ -906,3 +906,111 @@ func (self *SManagedVirtualizationRegionDriver) RequestCancelSnapshotPolicy(ctx
 	})
 	return nil
 }
+
+func (self *SManagedVirtualizationRegionDriver) ValidateCreateBucketData(ctx context.Context, userCred mcclient.TokenCredential, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	return nil, httperrors.NewNotImplementedError("creating bucket is not supported currently")
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestCreateBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucket, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		iRegion, err := bucket.GetIRegion()
+		if err != nil {
+			return nil, err
+		}
+		err = iRegion.CreateIBucket(bucket.Name, bucket.StorageClass, bucket.Acl)
+		if err != nil {
+			return nil, err
+		}
+		if err := bucket.SetExternalId(userCred, bucket.Name); err != nil {
+			return nil, err
+		}
+		iBucket, err := iRegion.GetIBucketById(bucket.Name)
+		if err != nil {
+			return nil, err
+		}
+		return nil, bucket.SyncWithCloudBucket(ctx, userCred, iBucket, "")
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestDeleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucket, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		if jsonutils.QueryBoolean(task.GetParams(), "purge", false) || len(bucket.ExternalId) == 0 {
+			return nil, nil
+		}
+		iRegion, err := bucket.GetIRegion()
+		if err != nil {
+			return nil, err
+		}
+		return nil, iRegion.DeleteIBucket(bucket.ExternalId)
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) requestDBInstanceOperation(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask, expect string, operation func(iDBInstance cloudprovider.ICloudDBInstance) error) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		iDBInstance, err := dbinstance.GetIDBInstance()
+		if err != nil {
+			return nil, err
+		}
+		err = operation(iDBInstance)
+		if err != nil {
+			return nil, err
+		}
+		err = cloudprovider.WaitStatusWithDelay(iDBInstance, expect, 10*time.Second, 10*time.Second, 30*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		return nil, dbinstance.SyncWithCloudDBInstance(ctx, userCred, iDBInstance, "")
+	})
+	return nil
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestStartDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return self.requestDBInstanceOperation(ctx, userCred, dbinstance, task, api.DBINSTANCE_STATUS_RUNNING, func(iDBInstance cloudprovider.ICloudDBInstance) error {
+		return iDBInstance.Start()
+	})
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestStopDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return self.requestDBInstanceOperation(ctx, userCred, dbinstance, task, api.DBINSTANCE_STATUS_READY, func(iDBInstance cloudprovider.ICloudDBInstance) error {
+		return iDBInstance.Stop()
+	})
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestRebootDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	return self.requestDBInstanceOperation(ctx, userCred, dbinstance, task, api.DBINSTANCE_STATUS_RUNNING, func(iDBInstance cloudprovider.ICloudDBInstance) error {
+		return iDBInstance.Reboot()
+	})
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestChangeDBInstanceConfig(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	config := cloudprovider.SDBInstanceChangeConfig{}
+	if err := task.GetParams().Unmarshal(&config); err != nil {
+		return err
+	}
+	return self.requestDBInstanceOperation(ctx, userCred, dbinstance, task, api.DBINSTANCE_STATUS_RUNNING, func(iDBInstance cloudprovider.ICloudDBInstance) error {
+		return iDBInstance.ChangeConfig(ctx, &config)
+	})
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestDeleteDBInstance(ctx context.Context, userCred mcclient.TokenCredential, dbinstance *models.SDBInstance, task taskman.ITask) error {
+	taskman.LocalTaskRun(task, func() (jsonutils.JSONObject, error) {
+		if jsonutils.QueryBoolean(task.GetParams(), "purge", false) || len(dbinstance.ExternalId) == 0 {
+			return nil, nil
+		}
+		iDBInstance, err := dbinstance.GetIDBInstance()
+		if err != nil {
+			if err == cloudprovider.ErrNotFound {
+				return nil, nil
+			}
+			return nil, err
+		}
+		err = iDBInstance.Delete()
+		if err != nil {
+			return nil, err
+		}
+		return nil, cloudprovider.WaitDeleted(iDBInstance, 10*time.Second, 30*time.Minute)
+	})
+	return nil
+}
@@ -84,6 +84,8 @@ func InitHandlers(app *appsrv.Application) {
 		models.ElasticipManager,
 		models.SnapshotManager,
 		models.SnapshotPolicyManager,
+		models.BucketManager,
+		models.DBInstanceManager,
 		models.BaremetalagentManager,
 		models.LoadbalancerManager,
 		models.LoadbalancerListenerManager,
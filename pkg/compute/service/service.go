@@ -26,6 +26,7 @@ import (
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
 	"yunion.io/x/onecloud/pkg/cloudcommon/cronman"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	_ "yunion.io/x/onecloud/pkg/compute/guestdrivers"
 	_ "yunion.io/x/onecloud/pkg/compute/hostdrivers"
@@ -39,6 +40,7 @@ import (
 	_ "yunion.io/x/onecloud/pkg/util/azure/provider"
 	_ "yunion.io/x/onecloud/pkg/util/esxi/provider"
 	_ "yunion.io/x/onecloud/pkg/util/huawei/provider"
+	_ "yunion.io/x/onecloud/pkg/util/objectstore/provider"
 	_ "yunion.io/x/onecloud/pkg/util/openstack/provider"
 	_ "yunion.io/x/onecloud/pkg/util/qcloud/provider"
 	_ "yunion.io/x/onecloud/pkg/util/ucloud/provider"
@@ -96,6 +98,10 @@ func StartService() {
 			cron.AddJob1("CleanExpiredPrepaidServers", time.Duration(opts.PrepaidExpireCheckSeconds)*time.Second, models.GuestManager.DeleteExpiredPrepaidServers)
 		}
 		cron.AddJob1("StartHostPingDetectionTask", time.Duration(opts.HostOfflineDetectionInterval)*time.Second, models.HostManager.PingDetectionTask)
+		cron.AddJob1("ReapExpiredTasks", time.Duration(opts.TaskReaperIntervalSeconds)*time.Second, taskman.TaskManager.ReapExpiredTasks)
+		cron.AddJob1("RebalanceHosts", time.Duration(opts.HostRebalanceIntervalSeconds)*time.Second, models.HostManager.RebalanceHosts)
+		cron.AddJob1("RenewAcmeCertificates", time.Duration(opts.AcmeRenewCheckIntervalSeconds)*time.Second, models.LoadbalancerCertificateManager.RenewAcmeCertificates)
+		cron.AddJob1("CheckLoadbalancerTrafficShifts", time.Duration(opts.LoadbalancerTrafficShiftCheckSeconds)*time.Second, models.CheckLoadbalancerTrafficShifts)
 
 		cron.AddJob1WithStartRun("AutoSyncCloudaccountTask", time.Duration(opts.CloudAutoSyncIntervalSeconds)*time.Second, models.CloudaccountManager.AutoSyncCloudaccountTask, true)
 
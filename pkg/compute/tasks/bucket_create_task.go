@@ -0,0 +1,70 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/notifyclient"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type BucketCreateTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(BucketCreateTask{})
+}
+
+func (self *BucketCreateTask) taskFail(ctx context.Context, bucket *models.SBucket, reason string) {
+	bucket.SetStatus(self.GetUserCred(), api.BUCKET_STATUS_CREATE_FAILED, reason)
+	db.OpsLog.LogEvent(bucket, db.ACT_ALLOCATE_FAIL, reason, self.UserCred)
+	logclient.AddActionLogWithStartable(self, bucket, logclient.ACT_CREATE, reason, self.UserCred, false)
+	notifyclient.NotifySystemError(bucket.Id, bucket.Name, api.BUCKET_STATUS_CREATE_FAILED, reason)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *BucketCreateTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	bucket := obj.(*models.SBucket)
+	region := bucket.GetRegion()
+	if region == nil {
+		self.taskFail(ctx, bucket, fmt.Sprintf("failed to find region for bucket %s", bucket.Name))
+		return
+	}
+	bucket.SetStatus(self.GetUserCred(), api.BUCKET_STATUS_CREATING, "")
+	self.SetStage("OnBucketCreateComplete", nil)
+	if err := region.GetDriver().RequestCreateBucket(ctx, self.GetUserCred(), bucket, self); err != nil {
+		self.taskFail(ctx, bucket, err.Error())
+	}
+}
+
+func (self *BucketCreateTask) OnBucketCreateComplete(ctx context.Context, bucket *models.SBucket, data jsonutils.JSONObject) {
+	bucket.SetStatus(self.GetUserCred(), api.BUCKET_STATUS_READY, "")
+	db.OpsLog.LogEvent(bucket, db.ACT_ALLOCATE, bucket.GetShortDesc(ctx), self.UserCred)
+	logclient.AddActionLogWithStartable(self, bucket, logclient.ACT_CREATE, nil, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *BucketCreateTask) OnBucketCreateCompleteFailed(ctx context.Context, bucket *models.SBucket, reason jsonutils.JSONObject) {
+	self.taskFail(ctx, bucket, reason.String())
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/notifyclient"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type DBInstanceStartTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(DBInstanceStartTask{})
+}
+
+func (self *DBInstanceStartTask) taskFail(ctx context.Context, dbinstance *models.SDBInstance, reason string) {
+	dbinstance.SetStatus(self.GetUserCred(), api.DBINSTANCE_STATUS_START_FAILED, reason)
+	db.OpsLog.LogEvent(dbinstance, db.ACT_START_FAIL, reason, self.UserCred)
+	logclient.AddActionLogWithStartable(self, dbinstance, logclient.ACT_VM_START, reason, self.UserCred, false)
+	notifyclient.NotifySystemError(dbinstance.Id, dbinstance.Name, api.DBINSTANCE_STATUS_START_FAILED, reason)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *DBInstanceStartTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	dbinstance := obj.(*models.SDBInstance)
+	region := dbinstance.GetRegion()
+	if region == nil {
+		self.taskFail(ctx, dbinstance, fmt.Sprintf("failed to find region for dbinstance %s", dbinstance.Name))
+		return
+	}
+	dbinstance.SetStatus(self.GetUserCred(), api.DBINSTANCE_STATUS_STARTING, "")
+	self.SetStage("OnDBInstanceStartComplete", nil)
+	if err := region.GetDriver().RequestStartDBInstance(ctx, self.GetUserCred(), dbinstance, self); err != nil {
+		self.taskFail(ctx, dbinstance, err.Error())
+	}
+}
+
+func (self *DBInstanceStartTask) OnDBInstanceStartComplete(ctx context.Context, dbinstance *models.SDBInstance, data jsonutils.JSONObject) {
+	dbinstance.SetStatus(self.GetUserCred(), api.DBINSTANCE_STATUS_RUNNING, "")
+	db.OpsLog.LogEvent(dbinstance, db.ACT_START, dbinstance.GetShortDesc(ctx), self.UserCred)
+	logclient.AddActionLogWithStartable(self, dbinstance, logclient.ACT_VM_START, nil, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *DBInstanceStartTask) OnDBInstanceStartCompleteFailed(ctx context.Context, dbinstance *models.SDBInstance, reason jsonutils.JSONObject) {
+	self.taskFail(ctx, dbinstance, reason.String())
+}
@@ -17,6 +17,7 @@ package tasks
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"yunion.io/x/jsonutils"
 
@@ -32,7 +33,11 @@ type GuestStartTask struct {
 }
 
 func init() {
-	taskman.RegisterTask(GuestStartTask{})
+	taskman.RegisterTaskWithPolicy(GuestStartTask{}, taskman.STaskPolicy{
+		StageTimeout: 10 * time.Minute,
+		MaxRetries:   2,
+		RetryBackoff: 30 * time.Second,
+	})
 }
 
 func (self *GuestStartTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
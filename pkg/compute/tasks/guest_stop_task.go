@@ -16,6 +16,7 @@ package tasks
 
 import (
 	"context"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -32,7 +33,11 @@ type GuestStopTask struct {
 }
 
 func init() {
-	taskman.RegisterTask(GuestStopTask{})
+	taskman.RegisterTaskWithPolicy(GuestStopTask{}, taskman.STaskPolicy{
+		StageTimeout: 10 * time.Minute,
+		MaxRetries:   2,
+		RetryBackoff: 30 * time.Second,
+	})
 }
 
 func (self *GuestStopTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
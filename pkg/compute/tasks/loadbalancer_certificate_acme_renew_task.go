@@ -0,0 +1,63 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/notifyclient"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type LoadbalancerCertificateAcmeRenewTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(LoadbalancerCertificateAcmeRenewTask{})
+}
+
+func (self *LoadbalancerCertificateAcmeRenewTask) taskFail(ctx context.Context, lbcert *models.SLoadbalancerCertificate, reason string) {
+	lbcert.SetStatus(self.GetUserCred(), api.LB_CERT_STATUS_ACME_RENEW_FAILED, reason)
+	db.OpsLog.LogEvent(lbcert, db.ACT_CERT_RENEW_FAIL, reason, self.UserCred)
+	logclient.AddActionLogWithStartable(self, lbcert, logclient.ACT_CERT_RENEW, reason, self.UserCred, false)
+	notifyclient.NotifySystemError(lbcert.Id, lbcert.Name, api.LB_CERT_STATUS_ACME_RENEW_FAILED, reason)
+	self.SetStageFailed(ctx, reason)
+}
+
+func (self *LoadbalancerCertificateAcmeRenewTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	lbcert := obj.(*models.SLoadbalancerCertificate)
+	self.SetStage("OnAcmeRenewComplete", nil)
+	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
+		return nil, lbcert.AcmeIssue(ctx, self.GetUserCred())
+	})
+}
+
+func (self *LoadbalancerCertificateAcmeRenewTask) OnAcmeRenewComplete(ctx context.Context, lbcert *models.SLoadbalancerCertificate, data jsonutils.JSONObject) {
+	lbcert.SetStatus(self.GetUserCred(), api.LB_STATUS_ENABLED, "")
+	db.OpsLog.LogEvent(lbcert, db.ACT_CERT_RENEW, lbcert.NotAfter, self.UserCred)
+	logclient.AddActionLogWithStartable(self, lbcert, logclient.ACT_CERT_RENEW, nil, self.UserCred, true)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *LoadbalancerCertificateAcmeRenewTask) OnAcmeRenewCompleteFailed(ctx context.Context, lbcert *models.SLoadbalancerCertificate, reason jsonutils.JSONObject) {
+	self.taskFail(ctx, lbcert, reason.String())
+}
@@ -54,7 +54,9 @@ const (
 	PluginName string = "yunion"
 
 	// defaultTTL to apply to all answers
-	defaultTTL           = 10
+	defaultTTL = 10
+	// defaultNegativeTTL is the SOA minimum of negative answers
+	defaultNegativeTTL   = 30
 	defaultDbMaxOpenConn = 32
 	defaultDbMaxIdleConn = 32
 )
@@ -85,11 +87,16 @@ type SRegionDNS struct {
 	AdminUser     string
 	AdminPassword string
 	Region        string
+	NegativeTTL   uint32
+	TsigKeys      map[string]*STsigKey
 	K8sManager    *k8s.SKubeClusterManager
 }
 
 func New() *SRegionDNS {
-	r := &SRegionDNS{}
+	r := &SRegionDNS{
+		NegativeTTL: defaultNegativeTTL,
+		TsigKeys:    map[string]*STsigKey{},
+	}
 	return r
 }
 
@@ -139,11 +146,17 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 	opt := plugin.Options{}
 	state := request.Request{W: w, Req: rmsg, Context: ctx}
 	zone := plugin.Zones(r.Zones).Matches(state.Name())
+	if zone == "" {
+		return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, rmsg)
+	}
+	if rmsg.Opcode == dns.OpcodeUpdate {
+		return r.serveUpdate(ctx, state)
+	}
+	authZone := r.authZone(state, zone)
 	switch state.QType() {
 	case dns.TypeA:
 		records, err = plugin.A(r, zone, state, nil, opt)
 	case dns.TypeAAAA:
-		// TODO fallthrough to next
 		records, err = plugin.AAAA(r, zone, state, nil, opt)
 	case dns.TypeTXT:
 		records, err = plugin.TXT(r, zone, state, opt)
@@ -156,7 +169,9 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 	case dns.TypeSRV:
 		records, extra, err = plugin.SRV(r, zone, state, opt)
 	case dns.TypeSOA:
-		records, err = plugin.SOA(r, zone, state, opt)
+		records, err = plugin.SOA(r, authZone, state, opt)
+	case dns.TypeAXFR, dns.TypeIXFR:
+		return r.Transfer(ctx, state)
 	case dns.TypeNS:
 		if state.Name() == zone {
 			records, extra, err = plugin.NS(r, zone, state, opt)
@@ -173,15 +188,18 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 		if r.Fall.Through(state.Name()) {
 			return plugin.NextOrFailure(r.Name(), r.Next, ctx, w, rmsg)
 		}
-		return plugin.BackendError(r, zone, dns.RcodeNameError, state, nil /* err */, opt)
+		return plugin.BackendError(r, authZone, dns.RcodeNameError, state, nil /* err */, opt)
 	} else if err == errRefused {
-		return plugin.BackendError(r, zone, dns.RcodeRefused, state, err, opt)
+		return plugin.BackendError(r, authZone, dns.RcodeRefused, state, err, opt)
 	} else if err == errNotFound {
-		return plugin.BackendError(r, zone, dns.RcodeNameError, state, err, opt)
+		return plugin.BackendError(r, authZone, dns.RcodeNameError, state, err, opt)
+	} else if err != nil {
+		return plugin.BackendError(r, authZone, dns.RcodeServerFailure, state, err, opt)
 	}
 
 	if len(records) == 0 {
-		return plugin.BackendError(r, zone, dns.RcodeNameError, state, err, opt)
+		// NODATA: the name exists but has no records of the type
+		return plugin.BackendError(r, authZone, dns.RcodeSuccess, state, nil, opt)
 	}
 
 	m := new(dns.Msg)
@@ -202,6 +220,17 @@ var (
 	errCallNext = errors.New("continue to next")
 )
 
+// authZone returns the zone whose SOA goes into the authority section of
+// negative answers, so that resolvers cache them against the zone we are
+// really authoritative for
+func (r *SRegionDNS) authZone(state request.Request, zone string) string {
+	primaryZone := dns.Fqdn(r.PrimaryZone)
+	if dns.IsSubDomain(zone, primaryZone) && dns.IsSubDomain(primaryZone, state.Name()) {
+		return primaryZone
+	}
+	return zone
+}
+
 // Services implements the ServiceBackend interface
 func (r *SRegionDNS) Services(state request.Request, exact bool, opt plugin.Options) (services []msg.Service, err error) {
 	switch state.QType() {
@@ -209,26 +238,20 @@ func (r *SRegionDNS) Services(state request.Request, exact bool, opt plugin.Opti
 		t, _ := dnsutil.TrimZone(state.Name(), state.Zone)
 
 		segs := dns.SplitDomainName(t)
-		if len(segs) != 1 {
-			return nil, fmt.Errorf("yunion region: TXT query can onlyu be for dns-version: %s", state.QName())
-		}
-		if segs[0] != "dns-version" {
-			return nil, nil
+		if len(segs) == 1 && segs[0] == "dns-version" {
+			svc := msg.Service{Text: "0.0.1", TTL: 28800, Key: msg.Path(state.QName(), "coredns")}
+			return []msg.Service{svc}, nil
 		}
-		svc := msg.Service{Text: "0.0.1", TTL: 28800, Key: msg.Path(state.QName(), "coredns")}
-		return []msg.Service{svc}, nil
 	case dns.TypeNS:
-		ns := r.nsAddr()
-		svc := msg.Service{Host: ns.A.String(), Key: msg.Path(state.QName(), "coredns")}
-		return []msg.Service{svc}, nil
-	}
-
-	if state.QType() == dns.TypeA && isDefaultNS(state.Name(), state.Zone) {
-		// If this is an A request for "ns.dns", respond with a "fake" record for coredns.
-		// SOA records always use this hardcoded name
-		ns := r.nsAddr()
-		svc := msg.Service{Host: ns.A.String(), Key: msg.Path(state.QName(), "coredns")}
+		svc := msg.Service{Host: r.nsAddr(state), Key: msg.Path(state.QName(), "coredns")}
 		return []msg.Service{svc}, nil
+	case dns.TypeA, dns.TypeAAAA:
+		if isDefaultNS(state.Name(), state.Zone) {
+			// If this is an address request for "ns.dns", respond with a "fake" record for coredns.
+			// SOA records always use this hardcoded name
+			svc := msg.Service{Host: r.nsAddr(state), Key: msg.Path(state.QName(), "coredns")}
+			return []msg.Service{svc}, nil
+		}
 	}
 
 	services, err = r.Records(state, false)
@@ -237,7 +260,12 @@ func (r *SRegionDNS) Services(state request.Request, exact bool, opt plugin.Opti
 
 // Lookup implements the ServiceBackend interface
 func (r *SRegionDNS) Lookup(state request.Request, name string, typ uint16) (*dns.Msg, error) {
-	return r.Upstream.Lookup(state, name, typ)
+	m, err := r.Upstream.Lookup(state, name, typ)
+	if err == nil && m == nil {
+		// no upstream configured
+		return nil, errCallNext
+	}
+	return m, err
 }
 
 // IsNameError implements the ServiceBackend interface
@@ -270,6 +298,7 @@ func (r *SRegionDNS) getGuestIpWithName(req *recordRequest) []string {
 	projectId := req.ProjectId()
 	wantOnlyExit := false
 	ips = models.GuestManager.GetIpInProjectWithName(projectId, name, wantOnlyExit)
+	ips = append(ips, models.GuestManager.GetIp6InProjectWithName(projectId, name)...)
 	return ips
 }
 
@@ -316,54 +345,77 @@ func (r *SRegionDNS) Name() string {
 	return PluginName
 }
 
-func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Service) {
-	ips := models.DnsRecordManager.QueryDnsIps(req.ProjectId(), req.Name(), req.Type())
-	if len(ips) == 0 {
+// queryLocalDnsRecords returns records of the requested type in the view of
+// the request.  found reports whether the name exists in the view at all
+func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Service, found bool) {
+	viewProjectIds := req.ViewProjectIds()
+	ips := models.DnsRecordManager.QueryDnsIps(viewProjectIds, req.Name(), req.Type())
+	if ips == nil {
 		return
 	}
+	found = true
+	if len(ips) == 0 && req.IsAddress() {
+		// let plugin chase the alias
+		ips = models.DnsRecordManager.QueryDnsIps(viewProjectIds, req.Name(), DNSTypeMap[dns.TypeCNAME])
+	}
 
 	for _, ip := range ips {
-		var s = msg.Service{}
-		var ttl uint32 = uint32(ip.Ttl)
-		if ttl == 0 {
-			ttl = defaultTTL
+		s, err := dnsIp2Service(req, ip)
+		if err != nil {
+			ylog.Errorf("%v", err)
+			continue
 		}
-		if req.IsSRV() {
-			parts := strings.SplitN(ip.Addr, ":", 4)
-			if len(parts) < 2 {
-				ylog.Errorf("Invalid SRV records: %q", ip.Addr)
-				continue
-			}
-			host := parts[0]
-			port, err := strconv.Atoi(parts[1])
+		recs = append(recs, s)
+	}
+	return
+}
+
+// dnsIp2Service converts the stored record value to the service answering the
+// request type
+func dnsIp2Service(req *recordRequest, ip *models.DnsIp) (msg.Service, error) {
+	var ttl uint32 = uint32(ip.Ttl)
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	if req.IsSRV() {
+		parts := strings.SplitN(ip.Addr, ":", 4)
+		if len(parts) < 2 {
+			return msg.Service{}, fmt.Errorf("Invalid SRV records: %q", ip.Addr)
+		}
+		host := parts[0]
+		port, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return msg.Service{}, fmt.Errorf("SRV: invalid port: %s", ip.Addr)
+		}
+		priority := 0
+		weight := 100
+		if len(parts) >= 3 {
+			weight, err = strconv.Atoi(parts[2])
 			if err != nil {
-				ylog.Errorf("SRV: invalid port: %s", ip.Addr)
-				continue
+				return msg.Service{}, fmt.Errorf("SRV: invalid weight: %s", ip.Addr)
 			}
-			priority := 0
-			weight := 100
-			if len(parts) >= 3 {
-				var err error
-				weight, err = strconv.Atoi(parts[2])
+			if len(parts) >= 4 {
+				priority, err = strconv.Atoi(parts[3])
 				if err != nil {
-					ylog.Errorf("SRV: invalid weight: %s", ip.Addr)
-					continue
-				}
-				if len(parts) >= 4 {
-					priority, err = strconv.Atoi(parts[3])
-					if err != nil {
-						ylog.Errorf("SRV: invalid priority: %s", ip.Addr)
-						continue
-					}
+					return msg.Service{}, fmt.Errorf("SRV: invalid priority: %s", ip.Addr)
 				}
 			}
-			s = msg.Service{Host: host, Port: port, Weight: weight, Priority: priority, TTL: ttl}
-		} else {
-			s = msg.Service{Host: ip.Addr, TTL: ttl}
 		}
-		recs = append(recs, s)
+		return msg.Service{Host: host, Port: port, Weight: weight, Priority: priority, TTL: ttl}, nil
+	} else if req.IsMX() {
+		parts := strings.SplitN(ip.Addr, ":", 2)
+		if len(parts) < 2 {
+			return msg.Service{}, fmt.Errorf("Invalid MX records: %q", ip.Addr)
+		}
+		preference, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return msg.Service{}, fmt.Errorf("MX: invalid preference: %s", ip.Addr)
+		}
+		return msg.Service{Host: parts[0], Priority: preference, Mail: true, TTL: ttl}, nil
+	} else if req.IsTXT() {
+		return msg.Service{Text: ip.Addr, TTL: ttl}, nil
 	}
-	return
+	return msg.Service{Host: ip.Addr, TTL: ttl}, nil
 }
 
 func (r *SRegionDNS) isMyDomain(req *recordRequest) bool {
@@ -377,11 +429,14 @@ func (r *SRegionDNS) isMyDomain(req *recordRequest) bool {
 
 func (r *SRegionDNS) findRecords(req *recordRequest) ([]msg.Service, error) {
 	// 1. try local dns records table
-	rrs := r.queryLocalDnsRecords(req)
+	rrs, found := r.queryLocalDnsRecords(req)
 	if len(rrs) > 0 {
 		return rrs, nil
 	}
 
+	notFound := func(err error) ([]msg.Service, error) {
+		return notFoundRecords(found, err)
+	}
 	isPlainName := req.IsPlainName()
 	isMyDomain := r.isMyDomain(req)
 	if isPlainName {
@@ -389,25 +444,34 @@ func (r *SRegionDNS) findRecords(req *recordRequest) ([]msg.Service, error) {
 		if isCloudIp {
 			ips := r.findInternalRecordIps(req)
 			if len(ips) > 0 {
-				return ips2DnsRecords(ips), nil
+				return internalRecords(req, ips), nil
 			} else {
-				return nil, errNotFound
+				return notFound(errNotFound)
 			}
 		} else {
-			return nil, errRefused
+			return notFound(errRefused)
 		}
 	} else if isMyDomain {
 		ips := r.findInternalRecordIps(req)
 		if len(ips) > 0 {
-			return ips2DnsRecords(ips), nil
+			return internalRecords(req, ips), nil
 		} else {
-			return nil, errNotFound
+			return notFound(errNotFound)
 		}
 	} else {
-		return nil, errCallNext
+		return notFound(errCallNext)
 	}
 }
 
+// notFoundRecords returns NODATA instead of err when the name exists in dns
+// records table but without records of the requested type
+func notFoundRecords(found bool, err error) ([]msg.Service, error) {
+	if found {
+		return []msg.Service{}, nil
+	}
+	return nil, err
+}
+
 func (r *SRegionDNS) findInternalRecordIps(req *recordRequest) []string {
 	{
 		// 1. try host table
@@ -437,6 +501,15 @@ func (r *SRegionDNS) findInternalRecordIps(req *recordRequest) []string {
 	return ips
 }
 
+// internalRecords returns address records of hosts, guests and k8s services.
+// These names have no other types of records, answer NODATA for them
+func internalRecords(req *recordRequest, ips []string) []msg.Service {
+	if !req.IsAddress() {
+		return []msg.Service{}
+	}
+	return ips2DnsRecords(ips)
+}
+
 func ips2DnsRecords(ips []string) []msg.Service {
 	recs := make([]msg.Service, 0)
 	for _, ip := range ips {
@@ -0,0 +1,252 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/etcd/msg"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
+)
+
+func newTestRequest(name string, qtype uint16) *recordRequest {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	return &recordRequest{
+		state: request.Request{Req: m},
+	}
+}
+
+func TestDnsIp2Service(t *testing.T) {
+	cases := []struct {
+		name  string
+		qtype uint16
+		ip    *models.DnsIp
+		out   msg.Service
+		isErr bool
+	}{
+		{
+			name:  "A",
+			qtype: dns.TypeA,
+			ip:    &models.DnsIp{Addr: "1.2.3.4", Ttl: 300},
+			out:   msg.Service{Host: "1.2.3.4", TTL: 300},
+		},
+		{
+			name:  "AAAA (default ttl)",
+			qtype: dns.TypeAAAA,
+			ip:    &models.DnsIp{Addr: "::1"},
+			out:   msg.Service{Host: "::1", TTL: defaultTTL},
+		},
+		{
+			name:  "MX",
+			qtype: dns.TypeMX,
+			ip:    &models.DnsIp{Addr: "mx0.a.com:5", Ttl: 300},
+			out:   msg.Service{Host: "mx0.a.com", Priority: 5, Mail: true, TTL: 300},
+		},
+		{
+			name:  "TXT",
+			qtype: dns.TypeTXT,
+			ip:    &models.DnsIp{Addr: "v=spf1 -all", Ttl: 300},
+			out:   msg.Service{Text: "v=spf1 -all", TTL: 300},
+		},
+		{
+			name:  "SRV",
+			qtype: dns.TypeSRV,
+			ip:    &models.DnsIp{Addr: "etcd0.a.com:2379", Ttl: 300},
+			out:   msg.Service{Host: "etcd0.a.com", Port: 2379, Weight: 100, TTL: 300},
+		},
+		{
+			name:  "SRV (weight and priority)",
+			qtype: dns.TypeSRV,
+			ip:    &models.DnsIp{Addr: "etcd0.a.com:2379:10:1", Ttl: 300},
+			out:   msg.Service{Host: "etcd0.a.com", Port: 2379, Weight: 10, Priority: 1, TTL: 300},
+		},
+		// bad
+		{
+			name:  "MX (no preference)",
+			qtype: dns.TypeMX,
+			ip:    &models.DnsIp{Addr: "mx0.a.com"},
+			isErr: true,
+		},
+		{
+			name:  "MX (bad preference)",
+			qtype: dns.TypeMX,
+			ip:    &models.DnsIp{Addr: "mx0.a.com:x"},
+			isErr: true,
+		},
+		{
+			name:  "SRV (bad port)",
+			qtype: dns.TypeSRV,
+			ip:    &models.DnsIp{Addr: "etcd0.a.com:x"},
+			isErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := newTestRequest("x.a.com", c.qtype)
+			got, err := dnsIp2Service(req, c.ip)
+			if err != nil {
+				if !c.isErr {
+					t.Errorf("unexpected error: %s", err)
+				}
+			} else {
+				if c.isErr {
+					t.Errorf("should error, got nil")
+				}
+				if !reflect.DeepEqual(c.out, got) {
+					t.Errorf("want %#v, got %#v", c.out, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordRequestViewProjectIds(t *testing.T) {
+	network := func(projectId string) *models.SNetwork {
+		n := &models.SNetwork{}
+		n.ProjectId = projectId
+		return n
+	}
+	cases := []struct {
+		name         string
+		srcProjectId string
+		network      *models.SNetwork
+		out          []string
+	}{
+		{
+			name: "outside of cloud",
+			out:  []string{""},
+		},
+		{
+			name:         "no network",
+			srcProjectId: "src",
+			out:          []string{"src"},
+		},
+		{
+			name:         "own network",
+			srcProjectId: "src",
+			network:      network("src"),
+			out:          []string{"src"},
+		},
+		{
+			name:         "shared network",
+			srcProjectId: "src",
+			network:      network("net"),
+			out:          []string{"src", "net"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := recordRequest{
+				srcProjectId: c.srcProjectId,
+				network:      c.network,
+			}
+			got := req.ViewProjectIds()
+			if !reflect.DeepEqual(c.out, got) {
+				t.Errorf("want %#v, got %#v", c.out, got)
+			}
+		})
+	}
+}
+
+func TestInternalRecords(t *testing.T) {
+	ips := []string{"10.0.0.1", "10.0.0.2"}
+	cases := []struct {
+		name  string
+		qtype uint16
+		out   []msg.Service
+	}{
+		{
+			name:  "A",
+			qtype: dns.TypeA,
+			out: []msg.Service{
+				{Host: "10.0.0.1", TTL: defaultTTL},
+				{Host: "10.0.0.2", TTL: defaultTTL},
+			},
+		},
+		{
+			name:  "AAAA",
+			qtype: dns.TypeAAAA,
+			out: []msg.Service{
+				{Host: "10.0.0.1", TTL: defaultTTL},
+				{Host: "10.0.0.2", TTL: defaultTTL},
+			},
+		},
+		{
+			name:  "MX (NODATA)",
+			qtype: dns.TypeMX,
+			out:   []msg.Service{},
+		},
+		{
+			name:  "TXT (NODATA)",
+			qtype: dns.TypeTXT,
+			out:   []msg.Service{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := internalRecords(newTestRequest("vm0", c.qtype), ips)
+			if !reflect.DeepEqual(c.out, got) {
+				t.Errorf("want %#v, got %#v", c.out, got)
+			}
+		})
+	}
+}
+
+func TestNotFoundRecords(t *testing.T) {
+	cases := []struct {
+		name  string
+		found bool
+		err   error
+		out   []msg.Service
+	}{
+		{
+			name:  "NODATA",
+			found: true,
+			err:   errNotFound,
+			out:   []msg.Service{},
+		},
+		{
+			name: "not found",
+			err:  errNotFound,
+		},
+		{
+			name: "refused",
+			err:  errRefused,
+		},
+		{
+			name: "call next",
+			err:  errCallNext,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := notFoundRecords(c.found, c.err)
+			if c.found {
+				if err != nil {
+					t.Errorf("want NODATA, got error %s", err)
+				}
+			} else if err != c.err {
+				t.Errorf("want error %v, got %v", c.err, err)
+			}
+			if !reflect.DeepEqual(c.out, got) {
+				t.Errorf("want %#v, got %#v", c.out, got)
+			}
+		})
+	}
+}
@@ -15,10 +15,9 @@
 package dns
 
 import (
-	//"net"
 	"strings"
 
-	"github.com/miekg/dns"
+	"github.com/coredns/coredns/request"
 )
 
 const defaultNSName = "ns.dns."
@@ -27,7 +26,8 @@ func isDefaultNS(name, zone string) bool {
 	return strings.Index(name, defaultNSName) == 0 && strings.Index(name, zone) == len(defaultNSName)
 }
 
-func (r *SRegionDNS) nsAddr() *dns.A {
-	//rr := new(dns.A)
-	return nil
+// nsAddr returns address of the name server, i.e. the local address the
+// query was received on
+func (r *SRegionDNS) nsAddr(state request.Request) string {
+	return state.LocalIP()
 }
@@ -51,13 +51,32 @@ func parseRequest(state request.Request) (r *recordRequest, err error) {
 	if guest := models.GuestnetworkManager.GetGuestByAddress(srcIP); guest != nil {
 		r.srcProjectId = guest.ProjectId
 		r.srcInCloud = true
+		if gns, _ := guest.GetNetworks(""); gns != nil {
+			for i := range gns {
+				if gns[i].IpAddr == srcIP {
+					r.network = gns[i].GetNetwork()
+					break
+				}
+			}
+		}
 	} else if network, _ := models.NetworkManager.GetOnPremiseNetworkOfIP(srcIP, "", tristate.None); network != nil {
 		r.srcProjectId = network.ProjectId
 		r.srcInCloud = true
+		r.network = network
 	}
 	return
 }
 
+// ViewProjectIds returns projects whose records are preferred for this
+// request, the project of the source first, then owner of the source network
+func (r recordRequest) ViewProjectIds() []string {
+	projectIds := []string{r.srcProjectId}
+	if r.network != nil && r.network.ProjectId != r.srcProjectId {
+		projectIds = append(projectIds, r.network.ProjectId)
+	}
+	return projectIds
+}
+
 func (r recordRequest) Name() string {
 	//fullName, _ := dnsutil.TrimZone(r.state.Name(), "")
 	name := r.state.Name()
@@ -86,6 +105,20 @@ func (r recordRequest) IsSRV() bool {
 	return r.Type() == DNSTypeMap[dns.TypeSRV]
 }
 
+func (r recordRequest) IsMX() bool {
+	return r.Type() == DNSTypeMap[dns.TypeMX]
+}
+
+func (r recordRequest) IsTXT() bool {
+	return r.Type() == DNSTypeMap[dns.TypeTXT]
+}
+
+// IsAddress returns true for A and AAAA requests
+func (r recordRequest) IsAddress() bool {
+	qtype := r.state.QType()
+	return qtype == dns.TypeA || qtype == dns.TypeAAAA
+}
+
 func (r recordRequest) SrcIP4() string {
 	ip := r.state.IP()
 	return ip
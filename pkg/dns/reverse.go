@@ -43,7 +43,7 @@ func (r *SRegionDNS) getNameForIp(ip string, state request.Request) ([]msg.Servi
 	}
 
 	// 1. try local dns records table
-	records := models.DnsRecordManager.QueryDnsIps(req.ProjectId(), req.Name(), req.Type())
+	records := models.DnsRecordManager.QueryDnsIps(req.ViewProjectIds(), req.Name(), req.Type())
 	for _, rec := range records {
 		return []msg.Service{{Host: rec.Addr, TTL: uint32(rec.Ttl)}}, nil
 	}
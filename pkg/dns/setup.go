@@ -16,6 +16,7 @@ package dns
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
@@ -116,6 +117,26 @@ func parseConfig(c *caddy.Controller) (*SRegionDNS, error) {
 						return nil, c.ArgErr()
 					}
 					rDNS.Region = c.Val()
+				case "negative_ttl":
+					if !c.NextArg() {
+						return nil, c.ArgErr()
+					}
+					ttl, err := strconv.ParseUint(c.Val(), 10, 32)
+					if err != nil {
+						return nil, c.Errf("invalid negative_ttl %q: %v", c.Val(), err)
+					}
+					rDNS.NegativeTTL = uint32(ttl)
+				case "tsig_key":
+					// tsig_key NAME ALGORITHM SECRET PROJECT_ID
+					args := c.RemainingArgs()
+					if len(args) != 4 {
+						return nil, c.ArgErr()
+					}
+					key, err := NewTsigKey(args[0], args[1], args[2], args[3])
+					if err != nil {
+						return nil, c.Errf("invalid tsig_key %q: %v", args[0], err)
+					}
+					rDNS.TsigKeys[key.Name] = key
 				case "upstream":
 					args := c.RemainingArgs()
 					u, err := upstream.New(args)
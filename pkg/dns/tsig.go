@@ -0,0 +1,126 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dns
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultTsigFudge = 300
+
+var (
+	errTsigMissing = errors.New("tsig missing")
+)
+
+// STsigKey is a TSIG key clients sign dynamic updates and zone transfers
+// with.  Changes made with the key are owned by ProjectId
+type STsigKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+	ProjectId string
+}
+
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":                 dns.HmacMD5,
+	"hmac-md5.sig-alg.reg.int": dns.HmacMD5,
+	"hmac-sha1":                dns.HmacSHA1,
+	"hmac-sha256":              dns.HmacSHA256,
+	"hmac-sha512":              dns.HmacSHA512,
+}
+
+func NewTsigKey(name, algorithm, secret, projectId string) (*STsigKey, error) {
+	algo, ok := tsigAlgorithms[strings.TrimSuffix(strings.ToLower(algorithm), ".")]
+	if !ok {
+		return nil, dns.ErrKeyAlg
+	}
+	key := &STsigKey{
+		Name:      strings.ToLower(dns.Fqdn(name)),
+		Algorithm: algo,
+		Secret:    secret,
+		ProjectId: projectId,
+	}
+	// make sure the secret is valid base64
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeSOA)
+	m.SetTsig(key.Name, key.Algorithm, defaultTsigFudge, time.Now().Unix())
+	if _, _, err := dns.TsigGenerate(m, key.Secret, "", false); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verifyTsig returns the key rmsg was signed with.
+//
+// Plugins do not have access to the original wire format of the request, the
+// signature is verified on rmsg packed with and without name compression,
+// which matches what common clients send
+func (r *SRegionDNS) verifyTsig(rmsg *dns.Msg) (*STsigKey, error) {
+	t := rmsg.IsTsig()
+	if t == nil {
+		return nil, errTsigMissing
+	}
+	key, ok := r.TsigKeys[strings.ToLower(t.Hdr.Name)]
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if !strings.EqualFold(t.Algorithm, key.Algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	var err error
+	for _, compress := range []bool{true, false} {
+		m := rmsg.Copy()
+		m.Compress = compress
+		buf, e := m.Pack()
+		if e != nil {
+			return nil, e
+		}
+		err = dns.TsigVerify(buf, key.Secret, "", false)
+		if err == nil || err == dns.ErrTime {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// writeSigned signs m with key and writes it out.  requestMAC and timersOnly
+// are as in dns.TsigGenerate.  Returns MAC of the response
+func writeSigned(w dns.ResponseWriter, m *dns.Msg, key *STsigKey, requestMAC string, timersOnly bool) (string, error) {
+	m.SetTsig(key.Name, key.Algorithm, defaultTsigFudge, time.Now().Unix())
+	buf, mac, err := dns.TsigGenerate(m, key.Secret, requestMAC, timersOnly)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(buf); err != nil {
+		return "", err
+	}
+	return mac, nil
+}
+
+// tsigErrorRcode maps errors of verifyTsig to the response code
+func tsigErrorRcode(err error) int {
+	switch err {
+	case errTsigMissing:
+		return dns.RcodeRefused
+	default:
+		return dns.RcodeNotAuth
+	}
+}
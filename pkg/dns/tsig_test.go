@@ -0,0 +1,109 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestVerifyTsig(t *testing.T) {
+	key, err := NewTsigKey("k0", "hmac-sha256", "c2VjcmV0", "p0")
+	if err != nil {
+		t.Fatalf("new tsig key: %s", err)
+	}
+	r := &SRegionDNS{
+		TsigKeys: map[string]*STsigKey{key.Name: key},
+	}
+	signed := func(name, algorithm, secret string, timeSigned int64, compress bool) *dns.Msg {
+		m := new(dns.Msg)
+		m.SetUpdate("a.com.")
+		m.Insert([]dns.RR{&dns.A{
+			Hdr: dns.RR_Header{Name: "x.a.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   []byte{1, 2, 3, 4},
+		}})
+		m.Compress = compress
+		m.SetTsig(name, algorithm, defaultTsigFudge, timeSigned)
+		buf, _, err := dns.TsigGenerate(m, secret, "", false)
+		if err != nil {
+			t.Fatalf("sign message: %s", err)
+		}
+		rmsg := new(dns.Msg)
+		if err := rmsg.Unpack(buf); err != nil {
+			t.Fatalf("unpack message: %s", err)
+		}
+		return rmsg
+	}
+	now := time.Now().Unix()
+	cases := []struct {
+		name string
+		msg  *dns.Msg
+		err  error
+	}{
+		{
+			name: "compressed",
+			msg:  signed("k0.", dns.HmacSHA256, key.Secret, now, true),
+		},
+		{
+			name: "uncompressed",
+			msg:  signed("k0.", dns.HmacSHA256, key.Secret, now, false),
+		},
+		{
+			name: "key name case",
+			msg:  signed("K0.", dns.HmacSHA256, key.Secret, now, true),
+		},
+		// bad
+		{
+			name: "missing",
+			msg:  new(dns.Msg).SetUpdate("a.com."),
+			err:  errTsigMissing,
+		},
+		{
+			name: "unknown key",
+			msg:  signed("k1.", dns.HmacSHA256, key.Secret, now, true),
+			err:  dns.ErrSecret,
+		},
+		{
+			name: "algorithm mismatch",
+			msg:  signed("k0.", dns.HmacSHA1, key.Secret, now, true),
+			err:  dns.ErrKeyAlg,
+		},
+		{
+			name: "bad signature",
+			msg:  signed("k0.", dns.HmacSHA256, "b3RoZXI=", now, true),
+			err:  dns.ErrSig,
+		},
+		{
+			name: "expired",
+			msg:  signed("k0.", dns.HmacSHA256, key.Secret, now-2*defaultTsigFudge, true),
+			err:  dns.ErrTime,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := r.verifyTsig(c.msg)
+			if err != c.err {
+				t.Fatalf("want error %v, got %v", c.err, err)
+			}
+			if err == nil && got != key {
+				t.Errorf("want key %#v, got %#v", key, got)
+			}
+			if err != nil && tsigErrorRcode(err) == dns.RcodeSuccess {
+				t.Errorf("error %v mapped to success", err)
+			}
+		})
+	}
+}
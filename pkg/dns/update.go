@@ -0,0 +1,474 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+
+	ylog "yunion.io/x/log"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+var (
+	errUnsupportedType = errors.New("unsupported record type")
+
+	// dnsUpdateLock serializes updates so that one update sees no partial
+	// changes of another
+	dnsUpdateLock sync.Mutex
+)
+
+// rrToRecord converts rr to the "TYPE:value" format of dnsrecords
+func rrToRecord(rr dns.RR) (string, error) {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return fmt.Sprintf("A:%s", rr.A.String()), nil
+	case *dns.AAAA:
+		return fmt.Sprintf("AAAA:%s", rr.AAAA.String()), nil
+	case *dns.CNAME:
+		return fmt.Sprintf("CNAME:%s", trimDot(rr.Target)), nil
+	case *dns.PTR:
+		return fmt.Sprintf("PTR:%s", trimDot(rr.Ptr)), nil
+	case *dns.MX:
+		return fmt.Sprintf("MX:%s:%d", trimDot(rr.Mx), rr.Preference), nil
+	case *dns.SRV:
+		return fmt.Sprintf("SRV:%s:%d:%d:%d", trimDot(rr.Target), rr.Port, rr.Weight, rr.Priority), nil
+	case *dns.TXT:
+		return fmt.Sprintf("TXT:%s", url.QueryEscape(strings.Join(rr.Txt, ""))), nil
+	}
+	return "", errUnsupportedType
+}
+
+// recordToRR is the reverse of rrToRecord
+func recordToRR(name string, ttl uint32, rec string) (dns.RR, error) {
+	i := strings.Index(rec, ":")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid record %q", rec)
+	}
+	typ, val := rec[:i], rec[i+1:]
+	hdr := dns.RR_Header{Name: name, Rrtype: dns.StringToType[typ], Class: dns.ClassINET, Ttl: ttl}
+	switch typ {
+	case "A":
+		ip := net.ParseIP(val).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid A record %q", rec)
+		}
+		return &dns.A{Hdr: hdr, A: ip}, nil
+	case "AAAA":
+		ip := net.ParseIP(val)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("invalid AAAA record %q", rec)
+		}
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}, nil
+	case "CNAME":
+		return &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(val)}, nil
+	case "PTR":
+		return &dns.PTR{Hdr: hdr, Ptr: dns.Fqdn(val)}, nil
+	case "MX":
+		parts := strings.SplitN(val, ":", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid MX record %q", rec)
+		}
+		preference, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MX record %q: %v", rec, err)
+		}
+		return &dns.MX{Hdr: hdr, Mx: dns.Fqdn(parts[0]), Preference: uint16(preference)}, nil
+	case "SRV":
+		parts := strings.SplitN(val, ":", 4)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid SRV record %q", rec)
+		}
+		nums := []uint16{0, 100, 0}
+		for j, part := range parts[1:] {
+			n, err := strconv.ParseUint(part, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SRV record %q: %v", rec, err)
+			}
+			nums[j] = uint16(n)
+		}
+		return &dns.SRV{Hdr: hdr, Target: dns.Fqdn(parts[0]), Port: nums[0], Weight: nums[1], Priority: nums[2]}, nil
+	case "TXT":
+		text, err := url.QueryUnescape(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TXT record %q: %v", rec, err)
+		}
+		txt := []string{}
+		for len(text) > 255 {
+			txt = append(txt, text[:255])
+			text = text[255:]
+		}
+		txt = append(txt, text)
+		return &dns.TXT{Hdr: hdr, Txt: txt}, nil
+	}
+	return nil, errUnsupportedType
+}
+
+// normalizeRecord returns rec in the form rrToRecord produces, so that
+// records can be compared as strings
+func normalizeRecord(rec string) string {
+	rr, err := recordToRR(".", 0, rec)
+	if err != nil {
+		return rec
+	}
+	if norm, err := rrToRecord(rr); err == nil {
+		return norm
+	}
+	return rec
+}
+
+func trimDot(name string) string {
+	return strings.TrimSuffix(name, ".")
+}
+
+func recordsOfType(records []string, rrtype uint16) []string {
+	pref := dns.TypeToString[rrtype] + ":"
+	ret := []string{}
+	for _, rec := range records {
+		if strings.HasPrefix(rec, pref) {
+			ret = append(ret, rec)
+		}
+	}
+	return ret
+}
+
+func removeRecords(records []string, remove func(rec string) bool) []string {
+	ret := []string{}
+	for _, rec := range records {
+		if !remove(rec) {
+			ret = append(ret, rec)
+		}
+	}
+	return ret
+}
+
+// sUpdateName holds records of one name owned by the project of the update.
+// origRecords and origTtl are what is stored before the update, for rollback
+type sUpdateName struct {
+	records []string
+	ttl     int
+	changed bool
+
+	origRecords []string
+	origTtl     int
+}
+
+type sDnsUpdate struct {
+	key   *STsigKey
+	zone  string
+	names map[string]*sUpdateName
+	order []string
+
+	setRecords func(ctx context.Context, userCred mcclient.TokenCredential, projectId, name string, records []string, ttl int) error
+}
+
+func newDnsUpdate(key *STsigKey, zone string) *sDnsUpdate {
+	return &sDnsUpdate{
+		key:        key,
+		zone:       zone,
+		names:      map[string]*sUpdateName{},
+		setRecords: models.DnsRecordManager.SetProjectDnsRecords,
+	}
+}
+
+func (u *sDnsUpdate) get(name string) (*sUpdateName, error) {
+	name = trimDot(strings.ToLower(name))
+	if n, ok := u.names[name]; ok {
+		return n, nil
+	}
+	n := &sUpdateName{}
+	rec, err := models.DnsRecordManager.GetProjectDnsRecord(u.key.ProjectId, name)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		for _, r := range rec.GetInfo() {
+			if len(r) > 0 {
+				n.records = append(n.records, normalizeRecord(r))
+				n.origRecords = append(n.origRecords, r)
+			}
+		}
+		n.ttl = rec.Ttl
+		n.origTtl = rec.Ttl
+	}
+	u.names[name] = n
+	u.order = append(u.order, name)
+	return n, nil
+}
+
+// checkPrerequisites checks the prerequisite section as in rfc2136 3.2
+func (u *sDnsUpdate) checkPrerequisites(rrs []dns.RR) (int, error) {
+	type rrset struct {
+		name    string
+		rrtype  uint16
+		records []string
+	}
+	rrsets := []*rrset{}
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if hdr.Ttl != 0 {
+			return dns.RcodeFormatError, nil
+		}
+		if !dns.IsSubDomain(u.zone, hdr.Name) {
+			return dns.RcodeNotZone, nil
+		}
+		n, err := u.get(hdr.Name)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError, nil
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(n.records) == 0 {
+					return dns.RcodeNameError, nil
+				}
+			} else if len(recordsOfType(n.records, hdr.Rrtype)) == 0 {
+				return dns.RcodeNXRrset, nil
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return dns.RcodeFormatError, nil
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if len(n.records) > 0 {
+					return dns.RcodeYXDomain, nil
+				}
+			} else if len(recordsOfType(n.records, hdr.Rrtype)) > 0 {
+				return dns.RcodeYXRrset, nil
+			}
+		case dns.ClassINET:
+			rec, err := rrToRecord(rr)
+			if err != nil {
+				return dns.RcodeNXRrset, nil
+			}
+			var set *rrset
+			for _, s := range rrsets {
+				if s.rrtype == hdr.Rrtype && strings.EqualFold(s.name, hdr.Name) {
+					set = s
+					break
+				}
+			}
+			if set == nil {
+				set = &rrset{name: hdr.Name, rrtype: hdr.Rrtype}
+				rrsets = append(rrsets, set)
+			}
+			set.records = append(set.records, rec)
+		default:
+			return dns.RcodeFormatError, nil
+		}
+	}
+	// value dependent rrsets must match exactly
+	for _, set := range rrsets {
+		n, _ := u.get(set.name)
+		current := recordsOfType(n.records, set.rrtype)
+		for _, rec := range set.records {
+			if !utils.IsInStringArray(rec, current) {
+				return dns.RcodeNXRrset, nil
+			}
+		}
+		for _, rec := range current {
+			if !utils.IsInStringArray(rec, set.records) {
+				return dns.RcodeNXRrset, nil
+			}
+		}
+	}
+	return dns.RcodeSuccess, nil
+}
+
+// prescan checks the update section as in rfc2136 3.4.1
+func (u *sDnsUpdate) prescan(rrs []dns.RR) int {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if !dns.IsSubDomain(u.zone, hdr.Name) {
+			return dns.RcodeNotZone
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			if _, err := rrToRecord(rr); err != nil {
+				return dns.RcodeNotImplemented
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// apply applies the update section as in rfc2136 3.4.2
+func (u *sDnsUpdate) apply(rrs []dns.RR) error {
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		n, err := u.get(hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Class {
+		case dns.ClassINET:
+			rec, _ := rrToRecord(rr)
+			hasCname := len(recordsOfType(n.records, dns.TypeCNAME)) > 0
+			if hdr.Rrtype == dns.TypeCNAME {
+				if len(n.records) > 0 && !hasCname {
+					continue
+				}
+				n.records = nil
+			} else if hasCname {
+				continue
+			}
+			if !utils.IsInStringArray(rec, n.records) {
+				n.records = append(n.records, rec)
+			}
+			n.ttl = int(hdr.Ttl)
+			n.changed = true
+		case dns.ClassANY:
+			if hdr.Rrtype == dns.TypeANY {
+				n.records = nil
+			} else {
+				pref := dns.TypeToString[hdr.Rrtype] + ":"
+				n.records = removeRecords(n.records, func(rec string) bool {
+					return strings.HasPrefix(rec, pref)
+				})
+			}
+			n.changed = true
+		case dns.ClassNONE:
+			rec, err := rrToRecord(rr)
+			if err != nil {
+				continue
+			}
+			n.records = removeRecords(n.records, func(r string) bool {
+				return r == rec
+			})
+			n.changed = true
+		}
+	}
+	return nil
+}
+
+// commit saves changed names.  The update section must be applied all or
+// nothing as in rfc2136 3.4, names already saved are restored when saving one
+// of them fails
+func (u *sDnsUpdate) commit(ctx context.Context) (int, error) {
+	for _, name := range u.order {
+		n := u.names[name]
+		if !n.changed || len(n.records) == 0 {
+			continue
+		}
+		if err := models.DnsRecordManager.ValidateRecords(name, n.records); err != nil {
+			return dns.RcodeRefused, err
+		}
+	}
+	userCred := &mcclient.SSimpleToken{
+		User:      trimDot(u.key.Name),
+		UserId:    trimDot(u.key.Name),
+		ProjectId: u.key.ProjectId,
+	}
+	committed := []string{}
+	for _, name := range u.order {
+		n := u.names[name]
+		if !n.changed {
+			continue
+		}
+		err := u.setRecords(ctx, userCred, u.key.ProjectId, name, n.records, n.ttl)
+		if err != nil {
+			u.rollback(ctx, userCred, committed)
+			return dns.RcodeServerFailure, err
+		}
+		committed = append(committed, name)
+	}
+	return dns.RcodeSuccess, nil
+}
+
+func (u *sDnsUpdate) rollback(ctx context.Context, userCred mcclient.TokenCredential, names []string) {
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		n := u.names[name]
+		err := u.setRecords(ctx, userCred, u.key.ProjectId, name, n.origRecords, n.origTtl)
+		if err != nil {
+			ylog.Errorf("dns update: rollback records of %s failed: %v", name, err)
+		}
+	}
+}
+
+// serveUpdate handles rfc2136 dynamic updates signed with one of the tsig
+// keys.  Records are saved as dnsrecords owned by project of the key
+func (r *SRegionDNS) serveUpdate(ctx context.Context, state request.Request) (int, error) {
+	rmsg := state.Req
+	key, err := r.verifyTsig(rmsg)
+	if err != nil {
+		ylog.Warningf("dns update from %s: tsig verification failed: %v", state.IP(), err)
+		m := new(dns.Msg)
+		m.SetRcode(rmsg, tsigErrorRcode(err))
+		state.W.WriteMsg(m)
+		return dns.RcodeSuccess, err
+	}
+
+	rcode, err := r.doUpdate(ctx, state, key)
+	if err != nil {
+		ylog.Errorf("dns update from %s with key %s: %v", state.IP(), key.Name, err)
+	}
+	m := new(dns.Msg)
+	m.SetRcode(rmsg, rcode)
+	if _, e := writeSigned(state.W, m, key, rmsg.IsTsig().MAC, false); e != nil {
+		return dns.RcodeServerFailure, e
+	}
+	return dns.RcodeSuccess, err
+}
+
+func (r *SRegionDNS) doUpdate(ctx context.Context, state request.Request, key *STsigKey) (int, error) {
+	rmsg := state.Req
+	if len(rmsg.Question) != 1 || rmsg.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError, nil
+	}
+	zone := strings.ToLower(dns.Fqdn(rmsg.Question[0].Name))
+	if plugin.Zones(r.Zones).Matches(zone) == "" {
+		return dns.RcodeNotAuth, nil
+	}
+	dnsUpdateLock.Lock()
+	defer dnsUpdateLock.Unlock()
+
+	u := newDnsUpdate(key, zone)
+	if rcode, err := u.checkPrerequisites(rmsg.Answer); rcode != dns.RcodeSuccess {
+		return rcode, err
+	}
+	if rcode := u.prescan(rmsg.Ns); rcode != dns.RcodeSuccess {
+		return rcode, nil
+	}
+	if err := u.apply(rmsg.Ns); err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	return u.commit(ctx)
+}
@@ -0,0 +1,346 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dns
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+func TestRecordToRR(t *testing.T) {
+	longText := strings.Repeat("a", 300)
+	cases := []struct {
+		rec  string
+		rr   string
+		norm string
+	}{
+		{rec: "A:1.2.3.4", rr: "x.a.com.\t300\tIN\tA\t1.2.3.4"},
+		{rec: "AAAA:::1", rr: "x.a.com.\t300\tIN\tAAAA\t::1"},
+		{rec: "CNAME:y.a.com", rr: "x.a.com.\t300\tIN\tCNAME\ty.a.com."},
+		{rec: "PTR:y.a.com", rr: "x.a.com.\t300\tIN\tPTR\ty.a.com."},
+		{rec: "MX:mx0.a.com:5", rr: "x.a.com.\t300\tIN\tMX\t5 mx0.a.com."},
+		{rec: "SRV:etcd0.a.com:2379:10:1", rr: "x.a.com.\t300\tIN\tSRV\t1 10 2379 etcd0.a.com."},
+		{rec: "SRV:etcd0.a.com:2379", rr: "x.a.com.\t300\tIN\tSRV\t0 100 2379 etcd0.a.com.", norm: "SRV:etcd0.a.com:2379:100:0"},
+		{rec: "TXT:v%3Dspf1+-all", rr: "x.a.com.\t300\tIN\tTXT\t\"v=spf1 -all\""},
+		{rec: "TXT:" + longText, rr: fmt.Sprintf("x.a.com.\t300\tIN\tTXT\t\"%s\" \"%s\"", longText[:255], longText[255:])},
+	}
+	for _, c := range cases {
+		t.Run(c.rec, func(t *testing.T) {
+			rr, err := recordToRR("x.a.com.", 300, c.rec)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := rr.String(); got != c.rr {
+				t.Errorf("want rr %q, got %q", c.rr, got)
+			}
+			norm := c.norm
+			if norm == "" {
+				norm = c.rec
+			}
+			got, err := rrToRecord(rr)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != norm {
+				t.Errorf("want record %q, got %q", norm, got)
+			}
+			if got := normalizeRecord(c.rec); got != norm {
+				t.Errorf("want normalized %q, got %q", norm, got)
+			}
+		})
+	}
+}
+
+func TestRecordToRRInvalid(t *testing.T) {
+	cases := []string{
+		"1.2.3.4",
+		"A:::1",
+		"AAAA:1.2.3.4",
+		"MX:mx0.a.com",
+		"MX:mx0.a.com:65536",
+		"SRV:etcd0.a.com",
+		"SRV:etcd0.a.com:x",
+		"TXT:%zz",
+		"HINFO:x",
+	}
+	for _, c := range cases {
+		t.Run(c, func(t *testing.T) {
+			if rr, err := recordToRR("x.a.com.", 300, c); err == nil {
+				t.Errorf("should error, got %s", rr)
+			}
+		})
+	}
+}
+
+func TestRRToRecordUnsupported(t *testing.T) {
+	rr := &dns.HINFO{
+		Hdr: dns.RR_Header{Name: "x.a.com.", Rrtype: dns.TypeHINFO, Class: dns.ClassINET},
+		Cpu: "x",
+		Os:  "y",
+	}
+	if _, err := rrToRecord(rr); err != errUnsupportedType {
+		t.Errorf("want %v, got %v", errUnsupportedType, err)
+	}
+}
+
+func newTestUpdate(names map[string][]string) *sDnsUpdate {
+	u := newDnsUpdate(&STsigKey{Name: "k0.", ProjectId: "p0"}, "a.com.")
+	for name, records := range names {
+		u.names[name] = &sUpdateName{
+			records:     records,
+			ttl:         300,
+			origRecords: records,
+			origTtl:     300,
+		}
+		u.order = append(u.order, name)
+	}
+	return u
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("invalid rr %q: %s", s, err)
+	}
+	return rr
+}
+
+func emptyRR(name string, rrtype, class uint16, ttl uint32) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype, Class: class, Ttl: ttl}}
+}
+
+func TestCheckPrerequisites(t *testing.T) {
+	names := map[string][]string{
+		"x.a.com": {"A:1.2.3.4", "A:1.2.3.5", "TXT:hello"},
+		"y.a.com": {},
+	}
+	cases := []struct {
+		name  string
+		rrs   []dns.RR
+		rcode int
+	}{
+		{
+			name:  "name in use",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeANY, dns.ClassANY, 0)},
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "name in use (not)",
+			rrs:   []dns.RR{emptyRR("y.a.com.", dns.TypeANY, dns.ClassANY, 0)},
+			rcode: dns.RcodeNameError,
+		},
+		{
+			name:  "rrset exists",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeTXT, dns.ClassANY, 0)},
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "rrset exists (not)",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeMX, dns.ClassANY, 0)},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name:  "name not in use",
+			rrs:   []dns.RR{emptyRR("y.a.com.", dns.TypeANY, dns.ClassNONE, 0)},
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "name not in use (in use)",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeANY, dns.ClassNONE, 0)},
+			rcode: dns.RcodeYXDomain,
+		},
+		{
+			name:  "rrset does not exist (exists)",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeA, dns.ClassNONE, 0)},
+			rcode: dns.RcodeYXRrset,
+		},
+		{
+			name: "rrset exists (value dependent)",
+			rrs: []dns.RR{
+				mustRR(t, "x.a.com. 0 IN A 1.2.3.5"),
+				mustRR(t, "X.a.com. 0 IN A 1.2.3.4"),
+			},
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "rrset exists (value dependent, partial)",
+			rrs:   []dns.RR{mustRR(t, "x.a.com. 0 IN A 1.2.3.4")},
+			rcode: dns.RcodeNXRrset,
+		},
+		{
+			name: "rrset exists (value dependent, mismatch)",
+			rrs: []dns.RR{
+				mustRR(t, "x.a.com. 0 IN A 1.2.3.4"),
+				mustRR(t, "x.a.com. 0 IN A 1.2.3.6"),
+			},
+			rcode: dns.RcodeNXRrset,
+		},
+		// bad
+		{
+			name:  "non-zero ttl",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeANY, dns.ClassANY, 300)},
+			rcode: dns.RcodeFormatError,
+		},
+		{
+			name:  "not zone",
+			rrs:   []dns.RR{emptyRR("x.b.com.", dns.TypeANY, dns.ClassANY, 0)},
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name:  "bad class",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeANY, dns.ClassCHAOS, 0)},
+			rcode: dns.RcodeFormatError,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := newTestUpdate(names)
+			rcode, err := u.checkPrerequisites(c.rrs)
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if rcode != c.rcode {
+				t.Errorf("want %s, got %s", dns.RcodeToString[c.rcode], dns.RcodeToString[rcode])
+			}
+		})
+	}
+}
+
+func TestPrescan(t *testing.T) {
+	cases := []struct {
+		name  string
+		rrs   []dns.RR
+		rcode int
+	}{
+		{
+			name: "add and delete",
+			rrs: []dns.RR{
+				mustRR(t, "x.a.com. 300 IN A 1.2.3.4"),
+				emptyRR("x.a.com.", dns.TypeTXT, dns.ClassANY, 0),
+				emptyRR("y.a.com.", dns.TypeANY, dns.ClassANY, 0),
+				&dns.A{Hdr: dns.RR_Header{Name: "z.a.com.", Rrtype: dns.TypeA, Class: dns.ClassNONE}},
+			},
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "not zone",
+			rrs:   []dns.RR{mustRR(t, "x.b.com. 300 IN A 1.2.3.4")},
+			rcode: dns.RcodeNotZone,
+		},
+		{
+			name:  "unsupported type",
+			rrs:   []dns.RR{mustRR(t, "x.a.com. 300 IN HINFO x y")},
+			rcode: dns.RcodeNotImplemented,
+		},
+		{
+			name:  "delete with ttl",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeA, dns.ClassANY, 300)},
+			rcode: dns.RcodeFormatError,
+		},
+		{
+			name:  "delete rr with ttl",
+			rrs:   []dns.RR{&dns.A{Hdr: dns.RR_Header{Name: "x.a.com.", Rrtype: dns.TypeA, Class: dns.ClassNONE, Ttl: 300}}},
+			rcode: dns.RcodeFormatError,
+		},
+		{
+			name:  "bad class",
+			rrs:   []dns.RR{emptyRR("x.a.com.", dns.TypeA, dns.ClassCHAOS, 0)},
+			rcode: dns.RcodeFormatError,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u := newTestUpdate(nil)
+			if rcode := u.prescan(c.rrs); rcode != c.rcode {
+				t.Errorf("want %s, got %s", dns.RcodeToString[c.rcode], dns.RcodeToString[rcode])
+			}
+		})
+	}
+}
+
+func TestUpdateCommit(t *testing.T) {
+	cases := []struct {
+		name   string
+		failOn string
+		rcode  int
+		out    map[string][]string
+	}{
+		{
+			name:  "all",
+			rcode: dns.RcodeSuccess,
+			out: map[string][]string{
+				"x.a.com": {"A:1.2.3.6"},
+				"y.a.com": {"A:1.2.3.7"},
+				"z.a.com": nil,
+			},
+		},
+		{
+			name:   "nothing",
+			failOn: "z.a.com",
+			rcode:  dns.RcodeServerFailure,
+			out: map[string][]string{
+				"x.a.com": {"A:1.2.3.4"},
+				"y.a.com": nil,
+				"z.a.com": {"A:1.2.3.5"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stored := map[string][]string{
+				"x.a.com": {"A:1.2.3.4"},
+				"y.a.com": nil,
+				"z.a.com": {"A:1.2.3.5"},
+			}
+			u := newTestUpdate(nil)
+			for _, name := range []string{"x.a.com", "y.a.com", "z.a.com"} {
+				u.names[name] = &sUpdateName{
+					records:     stored[name],
+					origRecords: stored[name],
+				}
+				u.order = append(u.order, name)
+			}
+			u.setRecords = func(ctx context.Context, userCred mcclient.TokenCredential, projectId, name string, records []string, ttl int) error {
+				if name == c.failOn {
+					return fmt.Errorf("set records of %s failed", name)
+				}
+				stored[name] = records
+				return nil
+			}
+			err := u.apply([]dns.RR{
+				mustRR(t, "x.a.com. 300 IN A 1.2.3.6"),
+				&dns.A{Hdr: dns.RR_Header{Name: "x.a.com.", Rrtype: dns.TypeA, Class: dns.ClassNONE}, A: []byte{1, 2, 3, 4}},
+				mustRR(t, "y.a.com. 300 IN A 1.2.3.7"),
+				emptyRR("z.a.com.", dns.TypeANY, dns.ClassANY, 0),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			rcode, err := u.commit(context.Background())
+			if rcode != c.rcode {
+				t.Errorf("want %s, got %s (%v)", dns.RcodeToString[c.rcode], dns.RcodeToString[rcode], err)
+			}
+			if !reflect.DeepEqual(c.out, stored) {
+				t.Errorf("want %#v, got %#v", c.out, stored)
+			}
+		})
+	}
+}
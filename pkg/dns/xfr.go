@@ -16,23 +16,104 @@ package dns
 
 import (
 	"context"
+	"strings"
 	"time"
 
+	"github.com/coredns/coredns/plugin"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
+
+	ylog "yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
 )
 
+// transferChunkSize is the number of records in each message of a transfer
+const transferChunkSize = 256
+
 // Serial implements the Transferer interface
 func (r *SRegionDNS) Serial(state request.Request) uint32 {
 	return uint32(time.Now().Unix())
 }
 
 // MinTTL implements the Transferer interface
+//
+// It is also the SOA minimum field resolvers use as TTL of negative answers
 func (r *SRegionDNS) MinTTL(state request.Request) uint32 {
-	return 30
+	return r.NegativeTTL
 }
 
-// Transferer implements the Transferer interface
+// Transfer implements the Transferer interface
+//
+// Transfer of the primary zone must be signed with one of the tsig keys.  The
+// zone contains dnsrecords as seen from the project of the key
 func (r *SRegionDNS) Transfer(ctx context.Context, state request.Request) (int, error) {
-	return dns.RcodeServerFailure, nil
+	rmsg := state.Req
+	key, err := r.verifyTsig(rmsg)
+	if err != nil {
+		ylog.Warningf("zone transfer from %s: tsig verification failed: %v", state.IP(), err)
+		m := new(dns.Msg)
+		m.SetRcode(rmsg, tsigErrorRcode(err))
+		state.W.WriteMsg(m)
+		return dns.RcodeSuccess, err
+	}
+	requestMAC := rmsg.IsTsig().MAC
+
+	zone := strings.ToLower(dns.Fqdn(r.PrimaryZone))
+	if state.Proto() != "tcp" || state.Name() != zone {
+		m := new(dns.Msg)
+		m.SetRcode(rmsg, dns.RcodeRefused)
+		if _, err := writeSigned(state.W, m, key, requestMAC, false); err != nil {
+			return dns.RcodeServerFailure, err
+		}
+		return dns.RcodeSuccess, nil
+	}
+
+	opt := plugin.Options{}
+	soa, err := plugin.SOA(r, zone, state, opt)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	ns, extra, err := plugin.NS(r, zone, state.NewWithQuestion(zone, dns.TypeNS), opt)
+	if err != nil {
+		return dns.RcodeServerFailure, err
+	}
+	rrs := append([]dns.RR{}, soa...)
+	rrs = append(rrs, ns...)
+	rrs = append(rrs, extra...)
+	for _, rec := range models.DnsRecordManager.QueryZoneDns([]string{key.ProjectId}, strings.TrimSuffix(zone, ".")) {
+		ttl := uint32(rec.Ttl)
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		for _, info := range rec.GetInfo() {
+			if len(info) == 0 {
+				continue
+			}
+			rr, err := recordToRR(dns.Fqdn(rec.Name), ttl, info)
+			if err != nil {
+				ylog.Errorf("zone transfer: skip record %s: %v", rec.Name, err)
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+	}
+	rrs = append(rrs, soa...)
+
+	// each envelope is signed over MAC of the previous one, rfc2845 4.4
+	for i := 0; i < len(rrs); i += transferChunkSize {
+		end := i + transferChunkSize
+		if end > len(rrs) {
+			end = len(rrs)
+		}
+		m := new(dns.Msg)
+		m.SetReply(rmsg)
+		m.Authoritative = true
+		m.Answer = rrs[i:end]
+		requestMAC, err = writeSigned(state.W, m, key, requestMAC, i > 0)
+		if err != nil {
+			return dns.RcodeServerFailure, err
+		}
+	}
+	return dns.RcodeSuccess, nil
 }
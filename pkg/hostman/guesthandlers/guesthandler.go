@@ -48,6 +48,8 @@ var (
 		"suspend": guestSuspend,
 
 		"snapshot":             guestSnapshot,
+		"disks-snapshot":       guestDisksSnapshot,
+		"disk-backup":          guestDiskBackup,
 		"delete-snapshot":      guestDeleteSnapshot,
 		"reload-disk-snapshot": guestReloadDiskSnapshot,
 		// "remove-statefile":     guestRemoveStatefile,
@@ -61,6 +63,16 @@ var (
 		"drive-mirror":        guestDriveMirror,
 		"hotplug-cpu-mem":     guestHotplugCpuMem,
 		"create-from-libvirt": guestCreateFromLibvirt,
+
+		// qemu guest agent actions, executed synchronously
+		"qga-ping":               guestQgaPing,
+		"qga-exec":               guestQgaExec,
+		"qga-exec-status":        guestQgaExecStatus,
+		"qga-file-read":          guestQgaFileRead,
+		"qga-file-write":         guestQgaFileWrite,
+		"qga-set-password":       guestQgaSetPassword,
+		"qga-network-interfaces": guestQgaNetworkInterfaces,
+		"qga-fsfreeze":           guestQgaFsfreeze,
 	}
 )
 
@@ -474,6 +486,95 @@ func guestSnapshot(ctx context.Context, sid string, body jsonutils.JSONObject) (
 	return nil, nil
 }
 
+func guestDisksSnapshot(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	if !guestman.GetGuestManager().IsGuestExist(sid) {
+		return nil, httperrors.NewNotFoundError("Guest %s not found", sid)
+	}
+	snapshotDisks, err := body.GetArray("disks")
+	if err != nil || len(snapshotDisks) == 0 {
+		return nil, httperrors.NewMissingParameterError("disks")
+	}
+
+	guest := guestman.GetGuestManager().Servers[sid]
+	disks, _ := guest.Desc.GetArray("disks")
+	params := &guestman.SDisksSnapshot{
+		Sid:       sid,
+		Snapshots: make([]*guestman.SDiskSnapshot, 0, len(snapshotDisks)),
+		FreezeFs:  jsonutils.QueryBoolean(body, "freeze_fs", true),
+	}
+	for _, snapshotDisk := range snapshotDisks {
+		diskId, err := snapshotDisk.GetString("disk_id")
+		if err != nil {
+			return nil, httperrors.NewMissingParameterError("disk_id")
+		}
+		snapshotId, err := snapshotDisk.GetString("snapshot_id")
+		if err != nil {
+			return nil, httperrors.NewMissingParameterError("snapshot_id")
+		}
+		var disk storageman.IDisk
+		for _, d := range disks {
+			id, _ := d.GetString("disk_id")
+			if diskId == id {
+				diskPath, _ := d.GetString("path")
+				disk = storageman.GetManager().GetDiskByPath(diskPath)
+				break
+			}
+		}
+		if disk == nil {
+			return nil, httperrors.NewNotFoundError("Disk %s not found", diskId)
+		}
+		params.Snapshots = append(params.Snapshots, &guestman.SDiskSnapshot{
+			Sid:        sid,
+			SnapshotId: snapshotId,
+			Disk:       disk,
+		})
+	}
+
+	hostutils.DelayTask(ctx, guestman.GetGuestManager().DoDisksSnapshot, params)
+	return nil, nil
+}
+
+func guestDiskBackup(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	if !guestman.GetGuestManager().IsGuestExist(sid) {
+		return nil, httperrors.NewNotFoundError("Guest %s not found", sid)
+	}
+	diskId, err := body.GetString("disk_id")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("disk_id")
+	}
+	backupPath, err := body.GetString("backup_path")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("backup_path")
+	}
+	parentPath, _ := body.GetString("parent_path")
+	if len(parentPath) > 0 && !fileutils2.Exists(parentPath) {
+		return nil, httperrors.NewBadRequestError("parent_path %s not found", parentPath)
+	}
+
+	var disk storageman.IDisk
+	guest := guestman.GetGuestManager().Servers[sid]
+	disks, _ := guest.Desc.GetArray("disks")
+	for _, d := range disks {
+		id, _ := d.GetString("disk_id")
+		if diskId == id {
+			diskPath, _ := d.GetString("path")
+			disk = storageman.GetManager().GetDiskByPath(diskPath)
+			break
+		}
+	}
+	if disk == nil {
+		return nil, httperrors.NewNotFoundError("Disk not found")
+	}
+
+	hostutils.DelayTask(ctx, guestman.GetGuestManager().DiskBackup, &guestman.SDiskBackup{
+		Sid:        sid,
+		Disk:       disk,
+		BackupPath: backupPath,
+		ParentPath: parentPath,
+	})
+	return nil, nil
+}
+
 func guestDeleteSnapshot(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
 	deleteSnapshot, err := body.GetString("delete_snapshot")
 	if err != nil {
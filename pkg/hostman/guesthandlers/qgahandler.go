@@ -0,0 +1,199 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guesthandlers
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/hostman/guestman"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	QGA_EXEC_DEFAULT_TIMEOUT = 30
+	QGA_FILE_READ_MAX_SIZE   = 4 * 1024 * 1024
+)
+
+func guestQgaPing(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	if err := qga.GuestPing(); err != nil {
+		return nil, httperrors.NewInternalServerError("guest agent ping: %s", err)
+	}
+	return nil, nil
+}
+
+func guestQgaExec(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	path, err := body.GetString("path")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("path")
+	}
+	args := jsonutils.GetQueryStringArray(body, "args")
+	env := jsonutils.GetQueryStringArray(body, "env")
+	input, _ := body.GetString("input")
+	if !jsonutils.QueryBoolean(body, "wait", true) {
+		pid, err := qga.GuestExec(path, args, env, []byte(input), true)
+		if err != nil {
+			return nil, httperrors.NewInternalServerError("guest exec: %s", err)
+		}
+		return map[string]int{"pid": pid}, nil
+	}
+	timeout, err := body.Int("timeout")
+	if err != nil || timeout <= 0 {
+		timeout = QGA_EXEC_DEFAULT_TIMEOUT
+	}
+	status, err := qga.GuestExecWait(path, args, env, []byte(input), time.Duration(timeout)*time.Second)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("guest exec: %s", err)
+	}
+	return status, nil
+}
+
+func guestQgaExecStatus(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	pid, err := body.Int("pid")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("pid")
+	}
+	status, err := qga.GuestExecStatus(int(pid))
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("guest exec status: %s", err)
+	}
+	return status, nil
+}
+
+func guestQgaFileRead(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	path, err := body.GetString("path")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("path")
+	}
+	content, err := qga.GuestFileReadAll(path, QGA_FILE_READ_MAX_SIZE)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("guest file read: %s", err)
+	}
+	// file content may be binary, keep it encoded as guest-file-read does
+	return map[string]interface{}{
+		"content_b64": base64.StdEncoding.EncodeToString(content),
+		"size":        len(content),
+	}, nil
+}
+
+func guestQgaFileWrite(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	path, err := body.GetString("path")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("path")
+	}
+	var content []byte
+	if body.Contains("content_b64") {
+		b64, _ := body.GetString("content_b64")
+		content, err = base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid content_b64: %s", err)
+		}
+	} else {
+		str, err := body.GetString("content")
+		if err != nil {
+			return nil, httperrors.NewMissingParameterError("content")
+		}
+		content = []byte(str)
+	}
+	if err := qga.GuestFileWriteAll(path, content); err != nil {
+		return nil, httperrors.NewInternalServerError("guest file write: %s", err)
+	}
+	return nil, nil
+}
+
+func guestQgaSetPassword(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	username, err := body.GetString("username")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("username")
+	}
+	password, err := body.GetString("password")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("password")
+	}
+	crypted := jsonutils.QueryBoolean(body, "crypted", false)
+	if err := qga.GuestSetUserPassword(username, password, crypted); err != nil {
+		return nil, httperrors.NewInternalServerError("guest set password: %s", err)
+	}
+	return nil, nil
+}
+
+func guestQgaNetworkInterfaces(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := qga.GuestNetworkGetInterfaces()
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("guest network get interfaces: %s", err)
+	}
+	return map[string]interface{}{"interfaces": ifaces}, nil
+}
+
+func guestQgaFsfreeze(ctx context.Context, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	qga, err := guestman.GetGuestManager().GetGuestAgent(sid)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		count  int
+		status string
+	)
+	action, _ := body.GetString("action")
+	switch action {
+	case "freeze":
+		mountpoints := jsonutils.GetQueryStringArray(body, "mountpoints")
+		count, err = qga.GuestFsfreezeFreeze(mountpoints)
+		status = monitor.QGA_FSFREEZE_STATUS_FROZEN
+	case "thaw":
+		count, err = qga.GuestFsfreezeThaw()
+		status = monitor.QGA_FSFREEZE_STATUS_THAWED
+	case "", "status":
+		status, err = qga.GuestFsfreezeStatus()
+	default:
+		return nil, httperrors.NewInputParameterError("unsupported fsfreeze action %s", action)
+	}
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("guest fsfreeze %s: %s", action, err)
+	}
+	return map[string]interface{}{"status": status, "count": count}, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/hostman/options"
+)
+
+const (
+	BALLOON_DEVICE_ID = "balloon0"
+
+	// USER_HZ of /proc/<pid>/stat
+	PROC_CLOCK_TICKS = 100
+
+	BALLOON_QUERY_TIMEOUT = 10 * time.Second
+)
+
+type sGuestCpuSample struct {
+	ticks int64
+	at    time.Time
+}
+
+// SMemoryReclaimer inflate balloon of idle guests when host is under
+// memory pressure, and give memory back to busy guests after pressure gone
+type SMemoryReclaimer struct {
+	manager *SGuestManager
+	samples map[string]*sGuestCpuSample
+}
+
+func NewMemoryReclaimer(manager *SGuestManager) *SMemoryReclaimer {
+	return &SMemoryReclaimer{
+		manager: manager,
+		samples: map[string]*sGuestCpuSample{},
+	}
+}
+
+func (r *SMemoryReclaimer) Start() {
+	if !options.HostOptions.EnableMemoryBalloon || options.HostOptions.MemoryReclaimInterval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			time.Sleep(time.Duration(options.HostOptions.MemoryReclaimInterval) * time.Second)
+			r.safeReclaim()
+		}
+	}()
+}
+
+// safeReclaim keep reclaimer loop alive after a failed round
+func (r *SMemoryReclaimer) safeReclaim() {
+	defer func() {
+		if r := recover(); r != nil {
+			debug.PrintStack()
+			log.Errorf("Memory reclaimer failed %s", r)
+		}
+	}()
+	r.reclaim()
+}
+
+func (r *SMemoryReclaimer) runningGuests() []*SKVMGuestInstance {
+	r.manager.ServersLock.Lock()
+	defer r.manager.ServersLock.Unlock()
+	guests := make([]*SKVMGuestInstance, 0, len(r.manager.Servers))
+	for _, guest := range r.manager.Servers {
+		guests = append(guests, guest)
+	}
+	return guests
+}
+
+func (r *SMemoryReclaimer) reclaim() {
+	pressure := r.manager.GetHost().IsMemoryPressure()
+	samples := map[string]*sGuestCpuSample{}
+	for _, guest := range r.runningGuests() {
+		if !guest.IsRunning() || !guest.IsMonitorAlive() || !guest.isBalloonReclaimable() {
+			continue
+		}
+		sample, err := getProcCpuSample(guest.GetPid())
+		if err != nil {
+			log.Errorf("Get guest %s cpu usage: %s", guest.GetName(), err)
+			continue
+		}
+		samples[guest.Id] = sample
+		last, ok := r.samples[guest.Id]
+		if !ok {
+			// need two samples to know whether guest is idle
+			continue
+		}
+		idle := isGuestIdle(last, sample)
+		if pressure && idle {
+			r.resizeBalloon(guest, -options.HostOptions.MemoryReclaimStepPercent)
+		} else if !pressure && !idle {
+			r.resizeBalloon(guest, options.HostOptions.MemoryReclaimStepPercent)
+		}
+	}
+	r.samples = samples
+}
+
+// isBalloonReclaimable tells whether inflating the balloon gives memory back
+// to host.  Memory of hugepages backed guests, including NUMA dedicated ones,
+// is reserved up front and stays so
+func (s *SKVMGuestInstance) isBalloonReclaimable() bool {
+	return !s.isHugepagesBacked() && s.getNumaPin() == nil
+}
+
+// resizeBalloon change guest actual memory by stepPercent of configured memory,
+// negative step inflate the balloon and positive step deflate it
+func (r *SMemoryReclaimer) resizeBalloon(guest *SKVMGuestInstance, stepPercent int) {
+	mem, _ := guest.Desc.Int("mem")
+	if mem <= 0 {
+		return
+	}
+	c := make(chan int64, 1)
+	guest.Monitor.GetBalloon(func(actualMb int64) { c <- actualMb })
+	var actual int64
+	select {
+	case actual = <-c:
+	case <-time.After(BALLOON_QUERY_TIMEOUT):
+		log.Errorf("Guest %s query balloon timeout", guest.GetName())
+		return
+	}
+	if actual < 0 {
+		return
+	}
+	target := balloonTarget(mem, actual, stepPercent, options.HostOptions.MemoryReclaimMinPercent)
+	if target == actual {
+		return
+	}
+	log.Infof("Guest %s balloon actual memory %dMB => %dMB", guest.GetName(), actual, target)
+	guest.Monitor.SetBalloon(target, func(res string) {
+		if len(res) > 0 {
+			log.Errorf("Guest %s set balloon %dMB: %s", guest.GetName(), target, res)
+		}
+	})
+}
+
+// balloonTarget move actual memory by stepPercent of configured memory,
+// bounded by minPercent of configured memory and configured memory itself
+func balloonTarget(mem, actual int64, stepPercent, minPercent int) int64 {
+	target := actual + mem*int64(stepPercent)/100
+	if minMem := mem * int64(minPercent) / 100; target < minMem {
+		target = minMem
+	}
+	if target > mem {
+		target = mem
+	}
+	return target
+}
+
+func isGuestIdle(last, cur *sGuestCpuSample) bool {
+	elapsed := cur.at.Sub(last.at).Seconds()
+	if elapsed <= 0 {
+		return false
+	}
+	usage := float64(cur.ticks-last.ticks) / PROC_CLOCK_TICKS / elapsed * 100
+	return usage < float64(options.HostOptions.GuestIdleCpuUsagePercent)
+}
+
+// getProcCpuSample read utime and stime of process from /proc/<pid>/stat
+func getProcCpuSample(pid int) (*sGuestCpuSample, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	ticks, err := parseProcStatTicks(string(content))
+	if err != nil {
+		return nil, err
+	}
+	return &sGuestCpuSample{ticks: ticks, at: time.Now()}, nil
+}
+
+// parseProcStatTicks return utime plus stime in /proc/<pid>/stat content
+func parseProcStatTicks(stat string) (int64, error) {
+	// skip pid and comm, comm may contain spaces
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return 0, fmt.Errorf("invalid proc stat %s", stat)
+	}
+	// fields start from state, utime and stime are field 14 and 15 of stat
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid proc stat %s", stat)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
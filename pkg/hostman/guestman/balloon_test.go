@@ -0,0 +1,168 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package guestman
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/hostman/options"
+)
+
+func TestBalloonTarget(t *testing.T) {
+	cases := []struct {
+		name        string
+		mem         int64
+		actual      int64
+		stepPercent int
+		minPercent  int
+		want        int64
+	}{
+		{"inflate", 4096, 4096, -10, 50, 3687},
+		{"inflate to min", 4096, 2200, -10, 50, 2048},
+		{"stay at min", 4096, 2048, -10, 50, 2048},
+		{"deflate", 4096, 2048, 10, 50, 2457},
+		{"deflate to configured", 4096, 4000, 10, 50, 4096},
+		{"stay at configured", 4096, 4096, 10, 50, 4096},
+	}
+	for _, c := range cases {
+		got := balloonTarget(c.mem, c.actual, c.stepPercent, c.minPercent)
+		if got != c.want {
+			t.Errorf("%s: want %d got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestParseProcStatTicks(t *testing.T) {
+	cases := []struct {
+		name    string
+		stat    string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "plain comm",
+			stat: "1234 (qemu-kvm) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 4 0 100 0 0",
+			want: 300,
+		},
+		{
+			name: "comm with spaces and parentheses",
+			stat: "1234 (qemu (vm 1)) S 1 1234 1234 0 -1 4194560 100 0 0 0 7 3 0 0 20 0 4 0 100 0 0",
+			want: 10,
+		},
+		{
+			name:    "no comm",
+			stat:    "1234 qemu-kvm S 1",
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			stat:    "1234 (qemu-kvm) S 1 1234",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		got, err := parseProcStatTicks(c.stat)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if got != c.want {
+			t.Errorf("%s: want %d got %d", c.name, c.want, got)
+		}
+	}
+}
+
+func TestIsGuestIdle(t *testing.T) {
+	options.HostOptions.GuestIdleCpuUsagePercent = 5
+	now := time.Now()
+	cases := []struct {
+		name string
+		last *sGuestCpuSample
+		cur  *sGuestCpuSample
+		want bool
+	}{
+		{
+			name: "idle",
+			last: &sGuestCpuSample{ticks: 1000, at: now},
+			cur:  &sGuestCpuSample{ticks: 1200, at: now.Add(60 * time.Second)},
+			want: true,
+		},
+		{
+			name: "busy",
+			last: &sGuestCpuSample{ticks: 1000, at: now},
+			cur:  &sGuestCpuSample{ticks: 7000, at: now.Add(60 * time.Second)},
+			want: false,
+		},
+		{
+			name: "no elapsed time",
+			last: &sGuestCpuSample{ticks: 1000, at: now},
+			cur:  &sGuestCpuSample{ticks: 1000, at: now},
+			want: false,
+		},
+	}
+	for _, c := range cases {
+		if got := isGuestIdle(c.last, c.cur); got != c.want {
+			t.Errorf("%s: want %v got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestIsBalloonReclaimable(t *testing.T) {
+	cases := []struct {
+		name      string
+		hugepages string
+		numaPin   *SNumaPin
+		want      bool
+	}{
+		{
+			name:      "plain",
+			hugepages: "transparent",
+			want:      true,
+		},
+		{
+			name:      "native hugepages",
+			hugepages: "native",
+			want:      false,
+		},
+		{
+			name:      "numa node",
+			hugepages: "transparent",
+			numaPin:   &SNumaPin{NodeId: 1, Cpus: []int{4, 5, 6, 7}},
+			want:      false,
+		},
+		{
+			name:      "numa dedicated",
+			hugepages: "disable",
+			numaPin:   &SNumaPin{NodeId: 0, Cpus: []int{2, 3}, Dedicated: true},
+			want:      false,
+		},
+	}
+	for _, c := range cases {
+		options.HostOptions.HugepagesOption = c.hugepages
+		guest := &SKVMGuestInstance{Id: c.name, Desc: jsonutils.NewDict()}
+		if c.numaPin != nil {
+			guest.Desc.Set("numa_pin", jsonutils.Marshal(c.numaPin))
+		}
+		if got := guest.isBalloonReclaimable(); got != c.want {
+			t.Errorf("%s: want %v got %v", c.name, c.want, got)
+		}
+	}
+}
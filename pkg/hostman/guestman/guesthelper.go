@@ -80,6 +80,19 @@ type SDiskSnapshot struct {
 	Disk       storageman.IDisk
 }
 
+type SDisksSnapshot struct {
+	Sid       string
+	Snapshots []*SDiskSnapshot
+	FreezeFs  bool
+}
+
+type SDiskBackup struct {
+	Sid        string
+	Disk       storageman.IDisk
+	BackupPath string
+	ParentPath string
+}
+
 type SDeleteDiskSnapshot struct {
 	Sid             string
 	DeleteSnapshot  string
@@ -34,6 +34,7 @@ import (
 	"yunion.io/x/onecloud/pkg/cloudcommon/sshkeys"
 	"yunion.io/x/onecloud/pkg/hostman/guestfs"
 	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
 	"yunion.io/x/onecloud/pkg/hostman/options"
 	"yunion.io/x/onecloud/pkg/hostman/storageman"
 	"yunion.io/x/onecloud/pkg/httperrors"
@@ -63,6 +64,7 @@ type SGuestManager struct {
 	ServersLock      *sync.Mutex
 
 	GuestStartWorker *appsrv.SWorkerManager
+	MemoryReclaimer  *SMemoryReclaimer
 
 	isLoaded bool
 }
@@ -76,6 +78,8 @@ func NewGuestManager(host hostutils.IHost, serversPath string) *SGuestManager {
 	manager.ServersLock = &sync.Mutex{}
 	manager.GuestStartWorker = appsrv.NewWorkerManager("GuestStart", 1, appsrv.DEFAULT_BACKLOG, false)
 	manager.StartCpusetBalancer()
+	manager.MemoryReclaimer = NewMemoryReclaimer(manager)
+	manager.MemoryReclaimer.Start()
 	manager.LoadExistingGuests()
 	manager.host.StartDHCPServer()
 	return manager
@@ -199,7 +203,23 @@ func (m *SGuestManager) StartCpusetBalancer() {
 }
 
 func (m *SGuestManager) cpusetBalance() {
-	cgrouputils.RebalanceProcesses(nil)
+	pinnedPids := m.getNumaPinnedPids()
+	if len(pinnedPids) == 0 {
+		cgrouputils.RebalanceProcesses(nil)
+		return
+	}
+	allPids, err := cgrouputils.GetAllPids()
+	if err != nil {
+		log.Errorf("cpuset balance get pids: %s", err)
+		return
+	}
+	pids := make([]string, 0, len(allPids))
+	for _, pid := range allPids {
+		if !pinnedPids[pid] {
+			pids = append(pids, pid)
+		}
+	}
+	cgrouputils.RebalanceProcesses(pids)
 }
 
 func (m *SGuestManager) IsGuestDir(f os.FileInfo) bool {
@@ -306,6 +326,18 @@ func (m *SGuestManager) Monitor(sid, cmd string, callback func(string)) error {
 	}
 }
 
+func (m *SGuestManager) GetGuestAgent(sid string) (*monitor.QemuGuestAgent, error) {
+	guest, ok := m.Servers[sid]
+	if !ok {
+		return nil, httperrors.NewNotFoundError("Guest %s not found", sid)
+	}
+	qga, err := guest.GetGuestAgent()
+	if err != nil {
+		return nil, httperrors.NewInvalidStatusError("%s", err)
+	}
+	return qga, nil
+}
+
 // Delay process
 func (m *SGuestManager) GuestDeploy(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
 	deployParams, ok := params.(*SGuestDeploy)
@@ -634,6 +666,24 @@ func (m *SGuestManager) DoSnapshot(ctx context.Context, params interface{}) (jso
 	return guest.ExecDiskSnapshotTask(ctx, snapshotParams.Disk, snapshotParams.SnapshotId)
 }
 
+func (m *SGuestManager) DoDisksSnapshot(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	snapshotParams, ok := params.(*SDisksSnapshot)
+	if !ok {
+		return nil, hostutils.ParamsError
+	}
+	guest := guestManger.Servers[snapshotParams.Sid]
+	return guest.ExecDisksSnapshotTask(ctx, snapshotParams.Snapshots, snapshotParams.FreezeFs)
+}
+
+func (m *SGuestManager) DiskBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	backupParams, ok := params.(*SDiskBackup)
+	if !ok {
+		return nil, hostutils.ParamsError
+	}
+	guest := guestManger.Servers[backupParams.Sid]
+	return guest.ExecDiskBackupTask(ctx, backupParams.Disk, backupParams.BackupPath, backupParams.ParentPath)
+}
+
 func (m *SGuestManager) DeleteSnapshot(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
 	delParams, ok := params.(*SDeleteDiskSnapshot)
 	if !ok {
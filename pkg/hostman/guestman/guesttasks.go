@@ -18,21 +18,28 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 
+	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
 	"yunion.io/x/onecloud/pkg/hostman/options"
 	"yunion.io/x/onecloud/pkg/hostman/storageman"
 	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/nbd"
 	"yunion.io/x/onecloud/pkg/util/procutils"
 	"yunion.io/x/onecloud/pkg/util/qemuimg"
+	"yunion.io/x/onecloud/pkg/util/qemutils"
 	"yunion.io/x/onecloud/pkg/util/timeutils2"
 )
 
@@ -1130,3 +1137,576 @@ func (task *SGuestHotplugCpuMemTask) onFail(reason string) {
 func (task *SGuestHotplugCpuMemTask) onSucc() {
 	hostutils.TaskComplete(task.ctx, nil)
 }
+
+/**
+ *  GuestDisksSnapshotTask
+**/
+
+const DISK_SNAPSHOT_MONITOR_TIMEOUT = 60 * time.Second
+
+// SGuestDisksSnapshotTask take snapshots of several disks of a running
+// guest at the same point in time. Guest file systems are frozen through
+// qemu guest agent if possible, file based disks are switched to new
+// overlays in one qmp transaction, then file systems are thawed.
+type SGuestDisksSnapshotTask struct {
+	*SKVMGuestInstance
+
+	ctx       context.Context
+	snapshots []*SDiskSnapshot
+	freezeFs  bool
+
+	fsFreezeSent bool
+	fsFrozen     bool
+	devices      map[string]string
+	created      []*SDiskSnapshot
+}
+
+func NewGuestDisksSnapshotTask(
+	ctx context.Context, s *SKVMGuestInstance, snapshots []*SDiskSnapshot, freezeFs bool,
+) *SGuestDisksSnapshotTask {
+	return &SGuestDisksSnapshotTask{
+		SKVMGuestInstance: s,
+		ctx:               ctx,
+		snapshots:         snapshots,
+		freezeFs:          freezeFs,
+		devices:           make(map[string]string),
+		created:           make([]*SDiskSnapshot, 0),
+	}
+}
+
+func (s *SGuestDisksSnapshotTask) Start() {
+	s.Monitor.GetBlocks(s.onGetBlocksSucc)
+}
+
+func (s *SGuestDisksSnapshotTask) isQemuManaged(disk storageman.IDisk) bool {
+	return disk.GetType() != api.STORAGE_RBD
+}
+
+func (s *SGuestDisksSnapshotTask) onGetBlocksSucc(blocks *jsonutils.JSONArray) {
+	if blocks == nil {
+		s.taskFailed("Get guest blocks failed")
+		return
+	}
+	for _, snapshot := range s.snapshots {
+		if !s.isQemuManaged(snapshot.Disk) {
+			continue
+		}
+		for _, block := range blocks.Value() {
+			file, _ := block.GetString("inserted", "file")
+			if file == snapshot.Disk.GetPath() {
+				device, _ := block.GetString("device")
+				s.devices[snapshot.Disk.GetId()] = device
+				break
+			}
+		}
+		if _, ok := s.devices[snapshot.Disk.GetId()]; !ok {
+			s.taskFailed(fmt.Sprintf("Device of disk %s not found", snapshot.Disk.GetId()))
+			return
+		}
+	}
+	s.freezeGuestFs()
+	s.createSnapshots()
+}
+
+func (s *SGuestDisksSnapshotTask) freezeGuestFs() {
+	if !s.freezeFs {
+		return
+	}
+	qga, err := s.GetGuestAgent()
+	if err != nil {
+		log.Warningf("Guest %s freeze fs failed, take crash consistent snapshot: %s", s.GetName(), err)
+		return
+	}
+	// guest may finish freezing even if the reply is lost, so it is
+	// thawed whatever the freeze returns
+	s.fsFreezeSent = true
+	if _, err = qga.GuestFsfreezeFreeze(nil); err != nil {
+		log.Warningf("Guest %s freeze fs failed, take crash consistent snapshot: %s", s.GetName(), err)
+		return
+	}
+	s.fsFrozen = true
+}
+
+func (s *SGuestDisksSnapshotTask) thawGuestFs() {
+	if !s.fsFreezeSent {
+		return
+	}
+	s.fsFreezeSent = false
+	qga, err := s.GetGuestAgent()
+	if err == nil {
+		_, err = qga.GuestFsfreezeThaw()
+	}
+	if err != nil {
+		log.Errorf("Guest %s thaw fs failed: %s", s.GetName(), err)
+	}
+}
+
+func (s *SGuestDisksSnapshotTask) createSnapshots() {
+	var overlays = make(map[string]string)
+	for _, snapshot := range s.snapshots {
+		if err := snapshot.Disk.CreateSnapshot(snapshot.SnapshotId); err != nil {
+			s.onSnapshotFailed(fmt.Sprintf("Create snapshot of disk %s: %s", snapshot.Disk.GetId(), err))
+			return
+		}
+		s.created = append(s.created, snapshot)
+		if device, ok := s.devices[snapshot.Disk.GetId()]; ok {
+			overlays[device] = snapshot.Disk.GetPath()
+		}
+	}
+	if len(overlays) == 0 {
+		s.onBlockdevSnapshotSucc("")
+		return
+	}
+
+	// file systems stay frozen until qemu replies, don't wait forever
+	var once sync.Once
+	timer := time.AfterFunc(DISK_SNAPSHOT_MONITOR_TIMEOUT, func() {
+		once.Do(s.onBlockdevSnapshotTimeout)
+	})
+	s.Monitor.BlockdevSnapshotSync(overlays, func(res string) {
+		timer.Stop()
+		handled := false
+		once.Do(func() {
+			handled = true
+			s.onBlockdevSnapshotSucc(res)
+		})
+		if !handled {
+			log.Errorf("Guest %s blockdev snapshot replied after timeout: %s", s.GetName(), res)
+		}
+	})
+}
+
+// onBlockdevSnapshotTimeout thaw guest and give up, snapshot files are
+// not rolled back as qemu may still switch to the overlays
+func (s *SGuestDisksSnapshotTask) onBlockdevSnapshotTimeout() {
+	s.thawGuestFs()
+	s.taskFailed("Blockdev snapshot timeout")
+}
+
+func (s *SGuestDisksSnapshotTask) onBlockdevSnapshotSucc(res string) {
+	if len(res) > 0 {
+		s.onSnapshotFailed(fmt.Sprintf("Blockdev snapshot error: %s", res))
+		return
+	}
+	s.thawGuestFs()
+	s.Monitor.GetBlocks(s.onSnapshotComplete)
+}
+
+// rollback move snapshot files back as the disk, qemu still writes to
+// the original file because the transaction didn't switch it
+func (s *SGuestDisksSnapshotTask) onSnapshotFailed(reason string) {
+	s.thawGuestFs()
+	for _, snapshot := range s.created {
+		if !s.isQemuManaged(snapshot.Disk) {
+			if err := snapshot.Disk.DeleteSnapshot(snapshot.SnapshotId, "", false); err != nil {
+				log.Errorf("Rollback snapshot %s error: %s", snapshot.SnapshotId, err)
+			}
+			continue
+		}
+		snapshotPath := path.Join(snapshot.Disk.GetSnapshotDir(), snapshot.SnapshotId)
+		_, err := procutils.NewCommand("mv", "-f", snapshotPath, snapshot.Disk.GetPath()).Run()
+		if err != nil {
+			log.Errorf("Rollback snapshot %s error: %s", snapshot.SnapshotId, err)
+		}
+	}
+	s.taskFailed(reason)
+}
+
+func (s *SGuestDisksSnapshotTask) getBackingChain(image jsonutils.JSONObject) []string {
+	var chain = make([]string, 0)
+	for image != nil {
+		filename, _ := image.GetString("filename")
+		chain = append(chain, filename)
+		image, _ = image.Get("backing-image")
+	}
+	return chain
+}
+
+func (s *SGuestDisksSnapshotTask) onSnapshotComplete(blocks *jsonutils.JSONArray) {
+	var chains = make(map[string][]string)
+	if blocks != nil {
+		for _, block := range blocks.Value() {
+			device, _ := block.GetString("device")
+			image, _ := block.Get("inserted", "image")
+			chains[device] = s.getBackingChain(image)
+		}
+	}
+
+	snapshots := jsonutils.NewArray()
+	for _, snapshot := range s.snapshots {
+		res := jsonutils.NewDict()
+		res.Set("disk_id", jsonutils.NewString(snapshot.Disk.GetId()))
+		res.Set("snapshot_id", jsonutils.NewString(snapshot.SnapshotId))
+		if s.isQemuManaged(snapshot.Disk) {
+			location := path.Join(snapshot.Disk.GetSnapshotDir(), snapshot.SnapshotId)
+			res.Set("location", jsonutils.NewString(location))
+			if chain, ok := chains[s.devices[snapshot.Disk.GetId()]]; ok {
+				res.Set("backing_chain", jsonutils.NewStringArray(chain))
+			}
+		}
+		snapshots.Add(res)
+	}
+	body := jsonutils.NewDict()
+	body.Set("snapshots", snapshots)
+	body.Set("fs_frozen", jsonutils.NewBool(s.fsFrozen))
+	hostutils.TaskComplete(s.ctx, body)
+}
+
+func (s *SGuestDisksSnapshotTask) taskFailed(reason string) {
+	log.Errorf("SGuestDisksSnapshotTask error: %s", reason)
+	hostutils.TaskFailed(s.ctx, reason)
+}
+
+/**
+ *  GuestDiskBackupTask
+**/
+
+const (
+	DISK_BACKUP_BITMAP     = "backup"
+	DISK_BACKUP_TMP_BITMAP = "backup-tmp"
+	DISK_BACKUP_COPY_CHUNK = 4 * 1024 * 1024
+
+	DISK_BACKUP_MONITOR_TIMEOUT = 60 * time.Second
+)
+
+// SGuestDiskBackupTask copy a point in time view of a running disk into
+// a qcow2 file on backup storage. A fleecing overlay keeps the view
+// stable while guest keeps writing, the view is exported by qemu built-in
+// nbd server. With a parent backup only clusters marked in the persistent
+// dirty bitmap are copied and the new file is backed by the parent.
+type SGuestDiskBackupTask struct {
+	*SKVMGuestInstance
+
+	ctx        context.Context
+	disk       storageman.IDisk
+	backupPath string
+	parentPath string
+
+	device     string
+	nodeName   string
+	sizeBytes  int64
+	fleeceNode string
+	fleecePath string
+	exported   bool
+	copied     int64
+}
+
+func NewGuestDiskBackupTask(
+	ctx context.Context, s *SKVMGuestInstance, disk storageman.IDisk, backupPath, parentPath string,
+) *SGuestDiskBackupTask {
+	return &SGuestDiskBackupTask{
+		SKVMGuestInstance: s,
+		ctx:               ctx,
+		disk:              disk,
+		backupPath:        backupPath,
+		parentPath:        parentPath,
+	}
+}
+
+func (s *SGuestDiskBackupTask) isIncremental() bool {
+	return len(s.parentPath) > 0
+}
+
+func (s *SGuestDiskBackupTask) Start() {
+	go s.run()
+}
+
+// waitMonitor issue monitor command by f on current monitor and wait until
+// done called with the result, give up if monitor disconnected or no reply
+// in time
+func (s *SGuestDiskBackupTask) waitMonitor(f func(m monitor.Monitor, done func(interface{}))) (interface{}, error) {
+	m := s.Monitor
+	if m == nil || !m.IsConnected() {
+		return nil, fmt.Errorf("Monitor of guest %s disconnected", s.GetName())
+	}
+	c := make(chan interface{}, 1)
+	f(m, func(res interface{}) {
+		select {
+		case c <- res:
+		default:
+		}
+	})
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timeout := time.After(DISK_BACKUP_MONITOR_TIMEOUT)
+	for {
+		select {
+		case res := <-c:
+			return res, nil
+		case <-ticker.C:
+			if !m.IsConnected() {
+				return nil, fmt.Errorf("Monitor of guest %s disconnected", s.GetName())
+			}
+		case <-timeout:
+			return nil, fmt.Errorf("Wait monitor reply timeout")
+		}
+	}
+}
+
+// wait monitor command complete, monitor callbacks return empty string on success
+func (s *SGuestDiskBackupTask) wait(f func(monitor.Monitor, monitor.StringCallback)) error {
+	res, err := s.waitMonitor(func(m monitor.Monitor, done func(interface{})) {
+		f(m, func(r string) { done(r) })
+	})
+	if err != nil {
+		return err
+	}
+	if r, _ := res.(string); len(r) > 0 {
+		return fmt.Errorf("%s", r)
+	}
+	return nil
+}
+
+func (s *SGuestDiskBackupTask) run() {
+	err := s.prepareExport()
+	if err == nil {
+		err = s.copyToBackup()
+	}
+	s.cleanup(err == nil)
+	if err != nil {
+		log.Errorf("SGuestDiskBackupTask error: %s", err)
+		procutils.NewCommand("rm", "-f", s.backupPath).Run()
+		hostutils.TaskFailed(s.ctx, err.Error())
+		return
+	}
+	body := jsonutils.NewDict()
+	body.Set("disk_id", jsonutils.NewString(s.disk.GetId()))
+	body.Set("backup_path", jsonutils.NewString(s.backupPath))
+	body.Set("parent_path", jsonutils.NewString(s.parentPath))
+	body.Set("incremental", jsonutils.NewBool(s.isIncremental()))
+	body.Set("size", jsonutils.NewInt(s.sizeBytes))
+	body.Set("copied_size", jsonutils.NewInt(s.copied))
+	hostutils.TaskComplete(s.ctx, body)
+}
+
+func (s *SGuestDiskBackupTask) findDevice() error {
+	res, err := s.waitMonitor(func(m monitor.Monitor, done func(interface{})) {
+		m.GetBlocks(func(blocks *jsonutils.JSONArray) { done(blocks) })
+	})
+	if err != nil {
+		return err
+	}
+	blocks, _ := res.(*jsonutils.JSONArray)
+	if blocks == nil {
+		return fmt.Errorf("Get guest blocks failed")
+	}
+	for _, block := range blocks.Value() {
+		file, _ := block.GetString("inserted", "file")
+		if file == s.disk.GetPath() {
+			s.device, _ = block.GetString("device")
+			s.nodeName, _ = block.GetString("inserted", "node-name")
+			s.sizeBytes, _ = block.Int("inserted", "image", "virtual-size")
+			break
+		}
+	}
+	if len(s.device) == 0 || len(s.nodeName) == 0 {
+		return fmt.Errorf("Device of disk %s not found", s.disk.GetId())
+	}
+	return nil
+}
+
+func (s *SGuestDiskBackupTask) prepareExport() error {
+	if err := s.findDevice(); err != nil {
+		return err
+	}
+	s.fleeceNode = fmt.Sprintf("fleece-%s", s.device)
+	s.fleecePath = path.Join(s.HomeDir(), s.fleeceNode+".qcow2")
+	_, err := procutils.NewCommand(qemutils.GetQemuImg(), "create", "-f", "qcow2",
+		s.fleecePath, strconv.FormatInt(s.sizeBytes, 10)).Run()
+	if err != nil {
+		return fmt.Errorf("Create fleecing image: %s", err)
+	}
+	fleeceOpts := map[string]interface{}{
+		"driver":    "qcow2",
+		"node-name": s.fleeceNode,
+		"file":      map[string]interface{}{"driver": "file", "filename": s.fleecePath},
+		"backing":   s.nodeName,
+	}
+	if err := s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.BlockdevAdd(fleeceOpts, cb) }); err != nil {
+		return fmt.Errorf("Add fleecing node: %s", err)
+	}
+
+	actions := []*monitor.TransactionAction{{
+		Type: "blockdev-backup",
+		Data: map[string]interface{}{
+			"device": s.nodeName, "target": s.fleeceNode, "sync": "none", "job-id": s.fleeceNode,
+		},
+	}}
+	if s.isIncremental() {
+		// freeze changes since last backup in a temporary bitmap,
+		// and keep tracking further changes in the persistent one
+		actions = append(actions,
+			&monitor.TransactionAction{
+				Type: "block-dirty-bitmap-add",
+				Data: map[string]interface{}{
+					"node": s.nodeName, "name": DISK_BACKUP_TMP_BITMAP, "disabled": true,
+				},
+			},
+			&monitor.TransactionAction{
+				Type: "block-dirty-bitmap-merge",
+				Data: map[string]interface{}{
+					"node": s.nodeName, "target": DISK_BACKUP_TMP_BITMAP,
+					"bitmaps": []string{DISK_BACKUP_BITMAP},
+				},
+			},
+			&monitor.TransactionAction{
+				Type: "block-dirty-bitmap-clear",
+				Data: map[string]interface{}{"node": s.nodeName, "name": DISK_BACKUP_BITMAP},
+			},
+		)
+	} else {
+		// a full backup restart change tracking from scratch
+		s.wait(func(m monitor.Monitor, cb monitor.StringCallback) {
+			m.BlockDirtyBitmapRemove(s.nodeName, DISK_BACKUP_BITMAP, cb)
+		})
+		actions = append(actions, &monitor.TransactionAction{
+			Type: "block-dirty-bitmap-add",
+			Data: map[string]interface{}{
+				"node": s.nodeName, "name": DISK_BACKUP_BITMAP, "persistent": true,
+			},
+		})
+	}
+	if err := s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.Transaction(actions, cb) }); err != nil {
+		return fmt.Errorf("Start fleecing: %s", err)
+	}
+
+	// reuse the nbd server qemu is running, e.g. one of an earlier backup
+	if s.getNbdServerPort() == 0 {
+		port := s.manager.GetFreePortByBase(BUILT_IN_NBD_SERVER_PORT_BASE)
+		if err := s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.StartNbdServer(port, false, false, cb) }); err != nil {
+			return fmt.Errorf("Start nbd server: %s", err)
+		}
+		s.setNbdServerPort(port)
+	}
+	var bitmap string
+	if s.isIncremental() {
+		bitmap = DISK_BACKUP_TMP_BITMAP
+	}
+	if err := s.wait(func(m monitor.Monitor, cb monitor.StringCallback) {
+		m.NbdServerAdd(s.fleeceNode, s.fleeceNode, false, bitmap, cb)
+	}); err != nil {
+		return fmt.Errorf("Export fleecing node: %s", err)
+	}
+	s.exported = true
+	return nil
+}
+
+func (s *SGuestDiskBackupTask) copyToBackup() error {
+	src, err := nbd.Connect("tcp", fmt.Sprintf("127.0.0.1:%d", s.getNbdServerPort()), s.fleeceNode, time.Minute)
+	if err != nil {
+		return fmt.Errorf("Connect nbd export: %s", err)
+	}
+	defer src.Close()
+
+	var bitmap string
+	if s.isIncremental() {
+		bitmap = DISK_BACKUP_TMP_BITMAP
+	}
+	extents, err := qemuimg.MapNbdExport("127.0.0.1", s.getNbdServerPort(), s.fleeceNode, bitmap)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"create", "-f", "qcow2"}
+	if s.isIncremental() {
+		args = append(args, "-b", s.parentPath, "-F", "qcow2")
+	}
+	args = append(args, s.backupPath, strconv.FormatInt(src.Size(), 10))
+	if _, err := procutils.NewCommand(qemutils.GetQemuImg(), args...).Run(); err != nil {
+		return fmt.Errorf("Create backup image: %s", err)
+	}
+
+	sock := s.backupPath + ".sock"
+	qemuNbd := exec.Command(qemutils.GetQemuNbd(), "-f", "qcow2", "-k", sock, s.backupPath)
+	if err := qemuNbd.Start(); err != nil {
+		return fmt.Errorf("Start qemu-nbd: %s", err)
+	}
+	defer func() {
+		qemuNbd.Process.Kill()
+		qemuNbd.Wait()
+		os.Remove(sock)
+	}()
+	var dst *nbd.Client
+	for i := 0; i < 50 && dst == nil; i++ {
+		time.Sleep(200 * time.Millisecond)
+		dst, err = nbd.Connect("unix", sock, "", time.Minute)
+	}
+	if dst == nil {
+		return fmt.Errorf("Connect qemu-nbd: %s", err)
+	}
+	defer dst.Close()
+
+	for _, extent := range extents {
+		// dirty bitmap report changed clusters as no data,
+		// without bitmap copy all allocated non zero clusters
+		if s.isIncremental() == extent.Data || (!s.isIncremental() && extent.Zero) {
+			continue
+		}
+		if err := nbd.CopyRange(dst, src, extent.Start, extent.Length, DISK_BACKUP_COPY_CHUNK); err != nil {
+			return err
+		}
+		s.copied += extent.Length
+	}
+	return dst.Flush()
+}
+
+func (s *SGuestDiskBackupTask) waitFleecingJobGone() {
+	for i := 0; i < 30; i++ {
+		res, err := s.waitMonitor(func(m monitor.Monitor, done func(interface{})) {
+			m.GetBlockJobs(func(jobs *jsonutils.JSONArray) { done(jobs) })
+		})
+		if err != nil {
+			log.Errorf("Wait fleecing job %s gone: %s", s.fleeceNode, err)
+			return
+		}
+		jobs, _ := res.(*jsonutils.JSONArray)
+		var found bool
+		if jobs != nil {
+			for _, job := range jobs.Value() {
+				device, _ := job.GetString("device")
+				if device == s.fleeceNode {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (s *SGuestDiskBackupTask) cleanup(succ bool) {
+	if len(s.fleeceNode) == 0 || !s.IsMonitorAlive() {
+		return
+	}
+	logErr := func(err error) {
+		if err != nil {
+			log.Errorf("Disk backup cleanup %s: %s", s.fleeceNode, err)
+		}
+	}
+	if s.exported {
+		logErr(s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.NbdServerRemove(s.fleeceNode, cb) }))
+	}
+	s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.BlockJobCancel(s.fleeceNode, cb) })
+	s.waitFleecingJobGone()
+	logErr(s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.BlockdevDel(s.fleeceNode, cb) }))
+	os.Remove(s.fleecePath)
+
+	if s.isIncremental() {
+		if !succ {
+			// give back changes not backed up to the persistent bitmap
+			actions := []*monitor.TransactionAction{{
+				Type: "block-dirty-bitmap-merge",
+				Data: map[string]interface{}{
+					"node": s.nodeName, "target": DISK_BACKUP_BITMAP,
+					"bitmaps": []string{DISK_BACKUP_TMP_BITMAP},
+				},
+			}}
+			logErr(s.wait(func(m monitor.Monitor, cb monitor.StringCallback) { m.Transaction(actions, cb) }))
+		}
+		s.wait(func(m monitor.Monitor, cb monitor.StringCallback) {
+			m.BlockDirtyBitmapRemove(s.nodeName, DISK_BACKUP_TMP_BITMAP, cb)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/util/cgrouputils"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/numautils"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+	"yunion.io/x/onecloud/pkg/util/sysutils"
+)
+
+var (
+	numaPinLock = sync.Mutex{}
+	// numaPinStarting records guests whose numa_pin is saved but qemu is
+	// not running yet, guarded by numaPinLock
+	numaPinStarting = map[string]bool{}
+
+	// vcpu thread name of qemu started with debug-threads=on
+	vcpuThreadRegexp = regexp.MustCompile(`^CPU (\d+)/KVM$`)
+)
+
+// SNumaPin is the NUMA node and host cpus a guest is bound to, it is saved
+// in guest desc and chosen again on every start
+type SNumaPin struct {
+	NodeId    int   `json:"node_id"`
+	Cpus      []int `json:"cpus"`
+	Dedicated bool  `json:"dedicated"`
+}
+
+func (s *SKVMGuestInstance) isMetadataTrue(key string) bool {
+	meta, _ := s.Desc.Get("metadata")
+	if meta == nil {
+		return false
+	}
+	val, _ := meta.GetString(key)
+	return val == "true"
+}
+
+func (s *SKVMGuestInstance) isDedicatedCpu() bool {
+	return s.isMetadataTrue(api.VM_METADATA_DEDICATED_CPU)
+}
+
+func (s *SKVMGuestInstance) isNumaSingleNode() bool {
+	return s.isMetadataTrue(api.VM_METADATA_NUMA_SINGLE_NODE) || s.isDedicatedCpu()
+}
+
+func (s *SKVMGuestInstance) getNumaPin() *SNumaPin {
+	if !s.Desc.Contains("numa_pin") {
+		return nil
+	}
+	pin := new(SNumaPin)
+	if err := s.Desc.Unmarshal(pin, "numa_pin"); err != nil {
+		log.Errorf("guest %s unmarshal numa_pin: %s", s.GetName(), err)
+		return nil
+	}
+	return pin
+}
+
+func getNumaTopologyNode(topology []*types.SNumaNode, nodeId int) *types.SNumaNode {
+	for _, t := range topology {
+		if t.NodeId == nodeId {
+			return t
+		}
+	}
+	return nil
+}
+
+// allocNumaPin choose NUMA node and host cpus for guest before starting,
+// a guest keeps its previous node if it still fits.  Cpus of running guests
+// and of those being started are taken, the latter until endNumaPinStarting
+func (m *SGuestManager) allocNumaPin(s *SKVMGuestInstance) error {
+	if !s.isNumaSingleNode() {
+		if s.Desc.Contains("numa_pin") {
+			s.Desc.Remove("numa_pin")
+			return s.SaveDesc(s.Desc)
+		}
+		return nil
+	}
+
+	numaPinLock.Lock()
+	defer numaPinLock.Unlock()
+
+	topology := m.host.GetNumaNodes()
+	if len(topology) == 0 {
+		return fmt.Errorf("numa topology of host unknown")
+	}
+	nodes := numautils.NewNodes(topology)
+
+	usedCpus := map[int]bool{}
+	usages := make([]numautils.SGuestUsage, 0)
+	m.ServersLock.Lock()
+	for _, guest := range m.Servers {
+		if guest.Id == s.Id || !(guest.IsRunning() || numaPinStarting[guest.Id]) {
+			continue
+		}
+		pin := guest.getNumaPin()
+		if pin == nil {
+			continue
+		}
+		cpu, _ := guest.Desc.Int("cpu")
+		mem, _ := guest.Desc.Int("mem")
+		usages = append(usages, numautils.SGuestUsage{
+			SRequest: numautils.SRequest{CpuCount: int(cpu), MemSizeMb: int(mem), Dedicated: pin.Dedicated},
+			NodeId:   pin.NodeId,
+		})
+		if pin.Dedicated {
+			for _, c := range pin.Cpus {
+				usedCpus[c] = true
+			}
+		}
+	}
+	m.ServersLock.Unlock()
+	numautils.PlaceGuests(nodes, usages, 0)
+
+	cpu, _ := s.Desc.Int("cpu")
+	mem, _ := s.Desc.Int("mem")
+	req := numautils.SRequest{CpuCount: int(cpu), MemSizeMb: int(mem), Dedicated: s.isDedicatedCpu()}
+	var node *numautils.SNode
+	if prev := s.getNumaPin(); prev != nil && prev.Dedicated == req.Dedicated {
+		if n := numautils.GetNode(nodes, prev.NodeId); n != nil && n.Fit(req, 0) {
+			node = n
+		}
+	}
+	if node == nil {
+		node = numautils.BestFit(nodes, req, 0)
+	}
+	if node == nil {
+		return fmt.Errorf("no numa node could fit %d cpus and %dMB memory", req.CpuCount, req.MemSizeMb)
+	}
+
+	pin := &SNumaPin{NodeId: node.NodeId, Dedicated: req.Dedicated, Cpus: []int{}}
+	for _, c := range getNumaTopologyNode(topology, node.NodeId).Cpus {
+		if usedCpus[c] {
+			continue
+		}
+		pin.Cpus = append(pin.Cpus, c)
+		if req.Dedicated && len(pin.Cpus) == req.CpuCount {
+			break
+		}
+	}
+	if req.Dedicated && len(pin.Cpus) < req.CpuCount {
+		return fmt.Errorf("numa node %d has only %d free cpus", node.NodeId, len(pin.Cpus))
+	}
+	log.Infof("guest %s bound to numa node %d cpus %s", s.GetName(), pin.NodeId, sysutils.FormatCpuList(pin.Cpus))
+	s.Desc.Set("numa_pin", jsonutils.Marshal(pin))
+	if err := s.SaveDesc(s.Desc); err != nil {
+		return err
+	}
+	numaPinStarting[s.Id] = true
+	return nil
+}
+
+// endNumaPinStarting drops the reservation of allocNumaPin once the start
+// is over.  The pins of a started guest are then held by its running qemu,
+// those of a failed start are released
+func (m *SGuestManager) endNumaPinStarting(s *SKVMGuestInstance) {
+	numaPinLock.Lock()
+	defer numaPinLock.Unlock()
+	delete(numaPinStarting, s.Id)
+}
+
+// getNumaPinnedPids return pids of running guests bound to NUMA nodes, which
+// should be left untouched by cpuset balancer
+func (m *SGuestManager) getNumaPinnedPids() map[string]bool {
+	pids := map[string]bool{}
+	m.ServersLock.Lock()
+	defer m.ServersLock.Unlock()
+	for _, guest := range m.Servers {
+		if guest.getNumaPin() == nil {
+			continue
+		}
+		if pid := guest.GetPid(); pid > 0 {
+			pids[strconv.Itoa(pid)] = true
+		}
+	}
+	return pids
+}
+
+func (s *SKVMGuestInstance) getNumaDesc(pin *SNumaPin, cpu, mem int64) string {
+	var cmd string
+	if pin.Dedicated {
+		cmd += fmt.Sprintf(" -object memory-backend-file,id=mem0,size=%dM,mem-path=%s,share=on,prealloc=on,host-nodes=%d,policy=bind",
+			mem, s.getHugepagesPath(), pin.NodeId)
+	} else {
+		cmd += fmt.Sprintf(" -object memory-backend-ram,id=mem0,size=%dM,host-nodes=%d,policy=bind", mem, pin.NodeId)
+	}
+	cmd += fmt.Sprintf(" -numa node,nodeid=0,cpus=0-%d,memdev=mem0", cpu-1)
+	return cmd
+}
+
+// isHugepagesBacked report whether guest memory is from a hugetlbfs mounted
+// for guest only
+func (s *SKVMGuestInstance) isHugepagesBacked() bool {
+	if options.HostOptions.HugepagesOption == "native" {
+		return true
+	}
+	pin := s.getNumaPin()
+	return pin != nil && pin.Dedicated
+}
+
+func (s *SKVMGuestInstance) getHugepagesPath() string {
+	return fmt.Sprintf("/dev/hugepages/%s", s.Id)
+}
+
+// setCgroupNumaPin bind guest process to cpus and memory of its NUMA node,
+// vcpu threads of dedicated guest are further pinned one to one
+func (s *SKVMGuestInstance) setCgroupNumaPin(pin *SNumaPin) {
+	pid := strconv.Itoa(s.cgroupPid)
+	cpuset := cgrouputils.NewCGroupCPUSetMemsTask(pid, 0,
+		sysutils.FormatCpuList(pin.Cpus), strconv.Itoa(pin.NodeId))
+	if !cpuset.SetTask() {
+		log.Errorf("guest %s set cpuset to numa node %d failed", s.GetName(), pin.NodeId)
+		return
+	}
+	if pin.Dedicated {
+		s.pinVcpuThreads(pin)
+	}
+}
+
+func (s *SKVMGuestInstance) pinVcpuThreads(pin *SNumaPin) {
+	taskDir := fmt.Sprintf("/proc/%d/task", s.cgroupPid)
+	tasks, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		log.Errorf("guest %s read tasks: %s", s.GetName(), err)
+		return
+	}
+	for _, task := range tasks {
+		comm, err := fileutils2.FileGetContents(fmt.Sprintf("%s/%s/comm", taskDir, task.Name()))
+		if err != nil {
+			continue
+		}
+		m := vcpuThreadRegexp.FindStringSubmatch(strings.TrimSpace(comm))
+		if len(m) == 0 {
+			continue
+		}
+		idx, _ := strconv.Atoi(m[1])
+		if idx >= len(pin.Cpus) {
+			continue
+		}
+		output, err := procutils.NewCommand("taskset", "-pc", strconv.Itoa(pin.Cpus[idx]), task.Name()).Run()
+		if err != nil {
+			log.Errorf("guest %s pin vcpu %d to cpu %d failed: %s %s", s.GetName(), idx, pin.Cpus[idx], err, output)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"yunion.io/x/jsonutils"
@@ -63,12 +64,19 @@ type SKVMGuestInstance struct {
 	QemuVersion string
 	VncPassword string
 
-	Desc    *jsonutils.JSONDict
-	Monitor monitor.Monitor
-	manager *SGuestManager
+	Desc       *jsonutils.JSONDict
+	Monitor    monitor.Monitor
+	guestAgent *monitor.QemuGuestAgent
+	manager    *SGuestManager
+
+	guestAgentLock sync.Mutex
 
 	startupTask *SGuestResumeTask
 	stopping    bool
+
+	// abnormal status reported by qmp events, cleared after guest resumed
+	eventStatus     string
+	eventStatusLock sync.Mutex
 }
 
 func NewKVMGuestInstance(id string, manager *SGuestManager) *SKVMGuestInstance {
@@ -235,6 +243,12 @@ func (s *SKVMGuestInstance) asyncScriptStart(ctx context.Context, params interfa
 	time.Sleep(100 * time.Millisecond)
 	var isStarted, tried = false, 0
 	var err error
+	// qemu may have exited while host agent was down
+	s.setNbdServerPort(0)
+	if err = s.manager.allocNumaPin(s); err != nil {
+		// retry does not help if no numa node could hold the guest
+		tried = MAX_TRY
+	}
 	for !isStarted && tried < MAX_TRY {
 		tried += 1
 
@@ -262,12 +276,19 @@ func (s *SKVMGuestInstance) asyncScriptStart(ctx context.Context, params interfa
 			log.Infof("VM started ...")
 		}
 	}
+	s.manager.endNumaPinStarting(s)
 
 	// is on_async_script_start
 	if isStarted {
 		log.Infof("Async start server %s success!", s.GetName())
 		meta := jsonutils.NewDict()
-		meta.Set("hotplug_cpu_mem", jsonutils.NewString("enable"))
+		if pin := s.getNumaPin(); pin != nil {
+			// vcpus and memory are fixed to the numa node
+			meta.Set("hotplug_cpu_mem", jsonutils.NewString("disable"))
+			meta.Set(api.VM_METADATA_NUMA_NODE, jsonutils.NewString(strconv.Itoa(pin.NodeId)))
+		} else {
+			meta.Set("hotplug_cpu_mem", jsonutils.NewString("enable"))
+		}
 		go s.SyncMetadata(meta)
 		s.StartMonitor(ctx)
 		return nil, nil
@@ -349,6 +370,31 @@ func (s *SKVMGuestInstance) IsMonitorAlive() bool {
 	return s.Monitor != nil && s.Monitor.IsConnected()
 }
 
+func (s *SKVMGuestInstance) GetQgaSocketPath() string {
+	return path.Join(s.HomeDir(), "qga.sock")
+}
+
+func (s *SKVMGuestInstance) GetGuestAgent() (*monitor.QemuGuestAgent, error) {
+	if !s.IsRunning() {
+		return nil, fmt.Errorf("Guest %s not running", s.GetName())
+	}
+	s.guestAgentLock.Lock()
+	defer s.guestAgentLock.Unlock()
+	if s.guestAgent == nil {
+		s.guestAgent = monitor.NewQemuGuestAgent(s.GetQgaSocketPath())
+	}
+	return s.guestAgent, nil
+}
+
+func (s *SKVMGuestInstance) closeGuestAgent() {
+	s.guestAgentLock.Lock()
+	defer s.guestAgentLock.Unlock()
+	if s.guestAgent != nil {
+		s.guestAgent.Close()
+		s.guestAgent = nil
+	}
+}
+
 // func (s *SKVMGuestInstance) ListStateFilePaths() []string {
 // 	files, err := ioutil.ReadDir(s.HomeDir())
 // 	if err == nil {
@@ -379,22 +425,6 @@ func (s *SKVMGuestInstance) delayStartMonitor(ctx context.Context) {
 	}
 }
 
-func (s *SKVMGuestInstance) onReceiveQMPEvent(event *monitor.Event) {
-	if event.Event == `"BLOCK_JOB_READY"` && s.IsMaster() {
-		if itype, ok := event.Data["type"]; ok {
-			stype, _ := itype.(string)
-			if stype == "mirror" {
-				if s.IsMirrorJobSucc() {
-					_, err := hostutils.UpdateServerStatus(context.Background(), s.GetId(), "running")
-					if err != nil {
-						log.Errorf("onReceiveQMPEvent update server status error: %s", err)
-					}
-				}
-			}
-		}
-	}
-}
-
 func (s *SKVMGuestInstance) onMonitorConnected(ctx context.Context) {
 	log.Infof("Monitor connected ...")
 	s.Monitor.GetVersion(func(v string) {
@@ -437,6 +467,9 @@ func (s *SKVMGuestInstance) onMonitorDisConnect(err error) {
 		s.SyncStatus()
 	}
 	s.clearCgroup(0)
+	s.closeGuestAgent()
+	s.setNbdServerPort(0)
+	s.setEventStatus("")
 	s.Monitor = nil
 }
 
@@ -473,6 +506,7 @@ func (s *SKVMGuestInstance) startQemuBuiltInNbdServer(ctx context.Context) {
 			log.Errorf("Start Qemu Builtin nbd server error %s", res)
 			hostutils.TaskFailed(ctx, res)
 		} else {
+			s.setNbdServerPort(nbdServerPort)
 			res := jsonutils.NewDict()
 			res.Set("nbd_server_port", jsonutils.NewInt(int64(nbdServerPort)))
 			hostutils.TaskComplete(ctx, res)
@@ -481,6 +515,27 @@ func (s *SKVMGuestInstance) startQemuBuiltInNbdServer(ctx context.Context) {
 	s.Monitor.StartNbdServer(nbdServerPort, true, true, onNbdServerStarted)
 }
 
+// getNbdServerPort return port of the nbd server running in qemu, 0 if none.
+// It is kept in desc, as qemu keeps the server across host agent restarts
+func (s *SKVMGuestInstance) getNbdServerPort() int {
+	port, _ := s.Desc.Int("nbd_server_port")
+	return int(port)
+}
+
+func (s *SKVMGuestInstance) setNbdServerPort(port int) {
+	if port == s.getNbdServerPort() {
+		return
+	}
+	if port > 0 {
+		s.Desc.Set("nbd_server_port", jsonutils.NewInt(int64(port)))
+	} else {
+		s.Desc.Remove("nbd_server_port")
+	}
+	if err := s.SaveDesc(s.Desc); err != nil {
+		log.Errorf("guest %s save nbd server port: %s", s.GetName(), err)
+	}
+}
+
 func (s *SKVMGuestInstance) clearCgroup(pid int) {
 	if pid == 0 && s.cgroupPid > 0 {
 		pid = s.cgroupPid
@@ -592,6 +647,11 @@ func (s *SKVMGuestInstance) DoResumeTask(ctx context.Context) {
 }
 
 func (s *SKVMGuestInstance) SyncStatus() {
+	if eventStatus := s.getEventStatus(); s.IsRunning() && len(eventStatus) > 0 {
+		// guest paused on panic or io error, wait RESUME event
+		hostutils.UpdateServerStatus(context.Background(), s.Id, eventStatus)
+		return
+	}
 	if s.IsRunning() {
 		s.Monitor.GetBlockJobCounts(s.CheckBlockOrRunning)
 		return
@@ -701,6 +761,7 @@ func (s *SKVMGuestInstance) ExitCleanup(clear bool) {
 		s.Monitor.Disconnect()
 		s.Monitor = nil
 	}
+	s.closeGuestAgent()
 }
 
 func (s *SKVMGuestInstance) CleanupCpuset() {
@@ -1023,6 +1084,9 @@ func (s *SKVMGuestInstance) setCgroupCpu() {
 	)
 
 	cgrouputils.CgroupSet(strconv.Itoa(s.cgroupPid), int(cpu)*cpuWeight)
+	if pin := s.getNumaPin(); pin != nil {
+		s.setCgroupNumaPin(pin)
+	}
 }
 
 func (s *SKVMGuestInstance) CreateFromDesc(desc jsonutils.JSONObject) error {
@@ -1196,6 +1260,43 @@ func (s *SKVMGuestInstance) ExecDiskSnapshotTask(
 	}
 }
 
+func (s *SKVMGuestInstance) ExecDisksSnapshotTask(
+	ctx context.Context, snapshots []*SDiskSnapshot, freezeFs bool,
+) (jsonutils.JSONObject, error) {
+	if s.IsRunning() {
+		NewGuestDisksSnapshotTask(ctx, s, snapshots, freezeFs).Start()
+		return nil, nil
+	}
+	res := jsonutils.NewArray()
+	for _, snapshot := range snapshots {
+		if _, err := s.StaticSaveSnapshot(ctx, snapshot.Disk, snapshot.SnapshotId); err != nil {
+			return nil, err
+		}
+		location := path.Join(snapshot.Disk.GetSnapshotDir(), snapshot.SnapshotId)
+		snapshotRes := jsonutils.NewDict()
+		snapshotRes.Set("disk_id", jsonutils.NewString(snapshot.Disk.GetId()))
+		snapshotRes.Set("snapshot_id", jsonutils.NewString(snapshot.SnapshotId))
+		snapshotRes.Set("location", jsonutils.NewString(location))
+		res.Add(snapshotRes)
+	}
+	body := jsonutils.NewDict()
+	body.Set("snapshots", res)
+	return body, nil
+}
+
+func (s *SKVMGuestInstance) ExecDiskBackupTask(
+	ctx context.Context, disk storageman.IDisk, backupPath, parentPath string,
+) (jsonutils.JSONObject, error) {
+	if !s.IsRunning() || !s.IsMonitorAlive() {
+		return nil, fmt.Errorf("Guest %s not running", s.GetName())
+	}
+	if !version.GE(s.QemuVersion, "4.2.0") {
+		return nil, fmt.Errorf("Qemu %s dosen't support incremental backup", s.QemuVersion)
+	}
+	NewGuestDiskBackupTask(ctx, s, disk, backupPath, parentPath).Start()
+	return nil, nil
+}
+
 func (s *SKVMGuestInstance) StaticSaveSnapshot(
 	ctx context.Context, disk storageman.IDisk, snapshotId string,
 ) (jsonutils.JSONObject, error) {
@@ -0,0 +1,191 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+)
+
+// same event of same device is reported at most once in this interval,
+// BLOCK_IO_ERROR is emitted for every failed request if error action is report
+const QMP_EVENT_REPORT_INTERVAL = 10 * time.Second
+
+var (
+	qmpEventReportedAt     = map[string]time.Time{}
+	qmpEventReportedAtLock = &sync.Mutex{}
+)
+
+func qmpEventString(data map[string]interface{}, key string) string {
+	if v, ok := data[key]; ok {
+		str, _ := v.(string)
+		return str
+	}
+	return ""
+}
+
+func qmpEventBool(data map[string]interface{}, key string) bool {
+	if v, ok := data[key]; ok {
+		b, _ := v.(bool)
+		return b
+	}
+	return false
+}
+
+func (s *SKVMGuestInstance) onReceiveQMPEvent(event *monitor.Event) {
+	var (
+		name   = strings.Trim(event.Event, `"`)
+		data   = event.Data
+		status string
+		reason string
+	)
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	switch name {
+	case api.QMP_EVENT_BLOCK_JOB_READY:
+		s.onBlockJobReady(data)
+		return
+	case api.QMP_EVENT_SHUTDOWN, api.QMP_EVENT_RESET:
+		reason = qmpEventString(data, "reason")
+		if len(reason) == 0 && qmpEventBool(data, "guest") {
+			reason = "guest initiated"
+		}
+	case api.QMP_EVENT_STOP:
+		reason = s.queryRunState()
+		if reason == "io-error" {
+			status = api.VM_IO_ERROR
+		}
+	case api.QMP_EVENT_RESUME:
+		if len(s.setEventStatus("")) > 0 {
+			s.SyncStatus()
+		}
+	case api.QMP_EVENT_BLOCK_JOB_COMPLETED:
+		jobType := qmpEventString(data, "type")
+		reason = fmt.Sprintf("%s job of %s completed", jobType, qmpEventString(data, "device"))
+		if errMsg := qmpEventString(data, "error"); len(errMsg) > 0 {
+			reason = fmt.Sprintf("%s: %s", reason, errMsg)
+		}
+		if jobType == "stream" {
+			// leave block_stream status after streaming finished
+			s.SyncStatus()
+		}
+	case api.QMP_EVENT_BLOCK_JOB_ERROR:
+		reason = fmt.Sprintf("%s %s error of %s, action %s", qmpEventString(data, "type"),
+			qmpEventString(data, "operation"), qmpEventString(data, "device"), qmpEventString(data, "action"))
+	case api.QMP_EVENT_BLOCK_IO_ERROR:
+		device := qmpEventString(data, "device")
+		if len(device) == 0 {
+			device = qmpEventString(data, "node-name")
+		}
+		if !shouldReportQmpEvent(s.Id, name, device) {
+			return
+		}
+		reason = fmt.Sprintf("%s %s error, action %s", device,
+			qmpEventString(data, "operation"), qmpEventString(data, "action"))
+		if qmpEventBool(data, "nospace") {
+			reason += ", no space left on device"
+		} else if errMsg := qmpEventString(data, "reason"); len(errMsg) > 0 {
+			reason = fmt.Sprintf("%s, %s", reason, errMsg)
+		}
+	case api.QMP_EVENT_GUEST_PANICKED:
+		action := qmpEventString(data, "action")
+		reason = fmt.Sprintf("guest kernel panic, action %s", action)
+		if action == "pause" {
+			status = api.VM_PANICKED
+		}
+	case api.QMP_EVENT_DEVICE_DELETED:
+		device := qmpEventString(data, "device")
+		if len(device) == 0 {
+			device = qmpEventString(data, "path")
+		}
+		reason = fmt.Sprintf("device %s deleted", device)
+	default:
+		return
+	}
+	if len(status) > 0 {
+		s.setEventStatus(status)
+	}
+	_, err := hostutils.ReportServerEvent(context.Background(), s.Id, name, status, reason)
+	if err != nil {
+		log.Errorf("Guest %s report event %s error: %s", s.GetName(), name, err)
+	}
+}
+
+func (s *SKVMGuestInstance) getEventStatus() string {
+	s.eventStatusLock.Lock()
+	defer s.eventStatusLock.Unlock()
+	return s.eventStatus
+}
+
+// setEventStatus replace status reported by qmp events and return the old one
+func (s *SKVMGuestInstance) setEventStatus(status string) string {
+	s.eventStatusLock.Lock()
+	defer s.eventStatusLock.Unlock()
+	old := s.eventStatus
+	s.eventStatus = status
+	return old
+}
+
+func (s *SKVMGuestInstance) onBlockJobReady(data map[string]interface{}) {
+	if s.IsMaster() && qmpEventString(data, "type") == "mirror" && s.IsMirrorJobSucc() {
+		_, err := hostutils.UpdateServerStatus(context.Background(), s.GetId(), "running")
+		if err != nil {
+			log.Errorf("onReceiveQMPEvent update server status error: %s", err)
+		}
+	}
+}
+
+// queryRunState return qemu run state, e.g. paused, io-error, guest-panicked
+func (s *SKVMGuestInstance) queryRunState() string {
+	if !s.IsMonitorAlive() {
+		return ""
+	}
+	c := make(chan string, 1)
+	s.Monitor.QueryStatus(func(status string) { c <- status })
+	select {
+	case status := <-c:
+		return status
+	case <-time.After(10 * time.Second):
+		return ""
+	}
+}
+
+func shouldReportQmpEvent(sid, event, device string) bool {
+	qmpEventReportedAtLock.Lock()
+	defer qmpEventReportedAtLock.Unlock()
+	// entries out of the interval throttle nothing, drop them so keys of
+	// deleted guests and devices don't pile up
+	for k, t := range qmpEventReportedAt {
+		if time.Since(t) >= QMP_EVENT_REPORT_INTERVAL {
+			delete(qmpEventReportedAt, k)
+		}
+	}
+	key := strings.Join([]string{sid, event, device}, "/")
+	if _, ok := qmpEventReportedAt[key]; ok {
+		return false
+	}
+	qmpEventReportedAt[key] = time.Now()
+	return true
+}
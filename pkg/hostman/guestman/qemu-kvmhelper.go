@@ -272,12 +272,23 @@ func (s *SKVMGuestInstance) getVnicDesc(nic jsonutils.JSONObject) string {
 
 func (s *SKVMGuestInstance) getQgaDesc() string {
 	cmd := " -chardev socket,path="
-	cmd += path.Join(s.HomeDir(), "qga.sock")
+	cmd += s.GetQgaSocketPath()
 	cmd += ",server,nowait,id=qga0"
 	cmd += " -device virtserialport,chardev=qga0,name=org.qemu.guest_agent.0"
 	return cmd
 }
 
+func (s *SKVMGuestInstance) getBalloonDesc() string {
+	if !options.HostOptions.EnableMemoryBalloon || s.getOsname() == OS_NAME_MACOS {
+		return ""
+	}
+	cmd := fmt.Sprintf(" -device virtio-balloon-pci,id=%s,bus=%s", BALLOON_DEVICE_ID, s.GetPciBus())
+	if options.HostOptions.BalloonFreePageReporting {
+		cmd += ",free-page-reporting=on"
+	}
+	return cmd
+}
+
 func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (string, error) {
 	var (
 		uuid, _  = s.Desc.GetString("uuid")
@@ -319,7 +330,8 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 		cmd += fmt.Sprintf("%s %s\n", downscript, ifname)
 	}
 
-	if options.HostOptions.HugepagesOption == "native" {
+	numaPin := s.getNumaPin()
+	if s.isHugepagesBacked() {
 		cmd += fmt.Sprintf("mkdir -p /dev/hugepages/%s\n", uuid)
 		cmd += fmt.Sprintf("mount -t hugetlbfs -o size=%dM hugetlbfs-%s /dev/hugepages/%s\n",
 			mem, uuid, uuid)
@@ -428,13 +440,22 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 	cmd += fmt.Sprintf(" -machine %s,accel=%s", s.getMachine(), accel)
 	cmd += " -k en-us"
 	// #cmd += " -g 800x600"
-	cmd += fmt.Sprintf(" -smp %d,maxcpus=128", cpu)
-	cmd += fmt.Sprintf(" -name %s", name)
-	// #cmd += fmt.Sprintf(" -uuid %s", self.desc["uuid"])
-	cmd += fmt.Sprintf(" -m %dM,slots=4,maxmem=262144M", mem)
+	if numaPin != nil {
+		// no cpu and memory hotplug for guest bound to numa node,
+		// debug-threads names vcpu threads for pinning
+		cmd += fmt.Sprintf(" -smp %d,maxcpus=%d", cpu, cpu)
+		cmd += fmt.Sprintf(" -name %s,debug-threads=on", name)
+		cmd += fmt.Sprintf(" -m %dM", mem)
+		cmd += s.getNumaDesc(numaPin, cpu, mem)
+	} else {
+		cmd += fmt.Sprintf(" -smp %d,maxcpus=128", cpu)
+		cmd += fmt.Sprintf(" -name %s", name)
+		// #cmd += fmt.Sprintf(" -uuid %s", self.desc["uuid"])
+		cmd += fmt.Sprintf(" -m %dM,slots=4,maxmem=262144M", mem)
 
-	if options.HostOptions.HugepagesOption == "native" {
-		cmd += fmt.Sprintf(" -mem-prealloc -mem-path %s", fmt.Sprintf("/dev/hugepages/%s", uuid))
+		if options.HostOptions.HugepagesOption == "native" {
+			cmd += fmt.Sprintf(" -mem-prealloc -mem-path %s", fmt.Sprintf("/dev/hugepages/%s", uuid))
+		}
 	}
 
 	bootOrder, _ := s.Desc.GetString("boot_order")
@@ -572,6 +593,10 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 	}
 
 	cmd += s.getQgaDesc()
+	cmd += s.getBalloonDesc()
+	if options.HostOptions.EnablePvpanic {
+		cmd += " -device pvpanic"
+	}
 	if fileutils2.Exists("/dev/random") {
 		cmd += " -object rng-random,filename=/dev/random,id=rng0"
 		cmd += " -device virtio-rng-pci,rng=rng0,max-bytes=1024,period=1000"
@@ -640,7 +665,7 @@ func (s *SKVMGuestInstance) generateStopScript(data *jsonutils.JSONDict) string
 	cmd += "  rm -f $VNC_FILE\n"
 	cmd += "fi\n"
 
-	if options.HostOptions.HugepagesOption == "native" {
+	if s.isHugepagesBacked() {
 		cmd += fmt.Sprintf("if [ -f /dev/hugepages/%s ]; then\n", uuid)
 		cmd += fmt.Sprintf("  umount /dev/hugepages/%s\n", uuid)
 		cmd += fmt.Sprintf("  rm -rf /dev/hugepages/%s\n", uuid)
@@ -32,6 +32,7 @@ import (
 
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/sshkeys"
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
 	"yunion.io/x/onecloud/pkg/hostman/guestfs/fsdriver"
 	"yunion.io/x/onecloud/pkg/hostman/hostinfo/hostbridge"
 	"yunion.io/x/onecloud/pkg/hostman/hostutils"
@@ -283,6 +284,7 @@ func (h *SHostInfo) detectHostInfo() error {
 
 	h.detectKvmModuleSupport()
 	h.detectNestSupport()
+	h.detectNumaTopology()
 
 	if err := h.detectiveSyssoftwareInfo(); err != nil {
 		return err
@@ -367,6 +369,16 @@ func (h *SHostInfo) GetMemory() int {
 	return h.Mem.Total // - options.reserved_memory
 }
 
+// IsMemoryPressure report whether available memory of host
+// is below options.MemoryPressureThreshold percent of total memory
+func (h *SHostInfo) IsMemoryPressure() bool {
+	if err := h.Mem.Refresh(); err != nil {
+		log.Errorf("Refresh memory info: %s", err)
+		return false
+	}
+	return h.Mem.Free*100 < h.Mem.Total*options.HostOptions.MemoryPressureThreshold
+}
+
 func (h *SHostInfo) EnableNativeHugepages() error {
 	content, err := ioutil.ReadFile("/proc/sys/vm/nr_hugepages")
 	if err != nil {
@@ -494,6 +506,19 @@ func (h *SHostInfo) detectiveKernelVersion() {
 	h.sysinfo.KernelVersion = string(out)
 }
 
+func (h *SHostInfo) detectNumaTopology() {
+	nodes, err := sysutils.DetectNumaTopology()
+	if err != nil {
+		log.Errorf("detect numa topology: %s", err)
+		return
+	}
+	h.sysinfo.NumaNodes = nodes
+}
+
+func (h *SHostInfo) GetNumaNodes() []*types.SNumaNode {
+	return h.sysinfo.NumaNodes
+}
+
 func (h *SHostInfo) detectiveSyssoftwareInfo() error {
 	h.detectiveOsDist()
 	h.detectiveKernelVersion()
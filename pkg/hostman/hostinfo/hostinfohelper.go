@@ -155,6 +155,17 @@ func DetectMemoryInfo() (*SMemory, error) {
 	return smem, nil
 }
 
+// Refresh update free and used memory size
+func (m *SMemory) Refresh() error {
+	info, err := mem.VirtualMemory()
+	if err != nil {
+		return err
+	}
+	m.Free = int(info.Available / 1024 / 1024)
+	m.Used = m.Total - m.Free
+	return nil
+}
+
 func (m *SMemory) GetHugepagesizeMb() int {
 	file, err := os.Open("/proc/meminfo")
 	if err != nil {
@@ -313,6 +324,8 @@ type SSysInfo struct {
 	KvmModule      string `json:"kvm_module"`
 
 	StorageType string `json:"storage_type"`
+
+	NumaNodes []*types.SNumaNode `json:"numa_nodes,omitempty"`
 }
 
 func StartDetachStorages(hs []jsonutils.JSONObject) {
@@ -24,6 +24,7 @@ import (
 
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
 	"yunion.io/x/onecloud/pkg/cloudcommon/workmanager"
 	"yunion.io/x/onecloud/pkg/hostman/hostinfo/hostbridge"
 	"yunion.io/x/onecloud/pkg/hostman/isolated_device"
@@ -43,6 +44,8 @@ type IHost interface {
 
 	IsKvmSupport() bool
 	IsNestedVirtualization() bool
+	IsMemoryPressure() bool
+	GetNumaNodes() []*types.SNumaNode
 
 	PutHostOnline() error
 	StartDHCPServer()
@@ -137,6 +140,19 @@ func UpdateServerStatus(ctx context.Context, sid, status string) (jsonutils.JSON
 	return modules.Servers.PerformAction(GetComputeSession(ctx), sid, "status", stats)
 }
 
+// ReportServerEvent push hypervisor event of guest to region, status is optional
+func ReportServerEvent(ctx context.Context, sid, event, status, reason string) (jsonutils.JSONObject, error) {
+	var params = jsonutils.NewDict()
+	params.Set("event", jsonutils.NewString(event))
+	if len(status) > 0 {
+		params.Set("status", jsonutils.NewString(status))
+	}
+	if len(reason) > 0 {
+		params.Set("reason", jsonutils.NewString(reason))
+	}
+	return modules.Servers.PerformAction(GetComputeSession(ctx), sid, "event", params)
+}
+
 func ResponseOk(ctx context.Context, w http.ResponseWriter) {
 	Response(ctx, w, map[string]string{"result": "ok"})
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -370,6 +371,70 @@ func (m *HmpMonitor) ReloadDiskBlkdev(device, path string, callback StringCallba
 	m.Query(fmt.Sprintf("reload_disk_snapshot_blkdev -n %s %s", device, path), callback)
 }
 
+// Hmp has no transaction command, devices are switched one by one
+// and stop at the first error
+func (m *HmpMonitor) BlockdevSnapshotSync(snapshots map[string]string, callback StringCallback) {
+	var cmds = make([]string, 0, len(snapshots))
+	for device, snapshotFile := range snapshots {
+		cmds = append(cmds, fmt.Sprintf("snapshot_blkdev -n %s %s qcow2", device, snapshotFile))
+	}
+	var next func(string)
+	next = func(res string) {
+		if len(res) > 0 || len(cmds) == 0 {
+			callback(res)
+			return
+		}
+		cmd := cmds[0]
+		cmds = cmds[1:]
+		m.Query(cmd, next)
+	}
+	next("")
+}
+
+func (m *HmpMonitor) notSupported(cmd string, callback StringCallback) {
+	callback(fmt.Sprintf("%s not supported by hmp monitor", cmd))
+}
+
+func (m *HmpMonitor) Transaction(actions []*TransactionAction, callback StringCallback) {
+	m.notSupported("transaction", callback)
+}
+
+func (m *HmpMonitor) BlockdevAdd(options map[string]interface{}, callback StringCallback) {
+	m.notSupported("blockdev-add", callback)
+}
+
+func (m *HmpMonitor) BlockdevDel(nodeName string, callback StringCallback) {
+	m.notSupported("blockdev-del", callback)
+}
+
+func (m *HmpMonitor) BlockJobCancel(device string, callback StringCallback) {
+	m.Query(fmt.Sprintf("block_job_cancel %s", device), callback)
+}
+
+func (m *HmpMonitor) BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback) {
+	m.notSupported("block-dirty-bitmap-add", callback)
+}
+
+func (m *HmpMonitor) BlockDirtyBitmapRemove(node, name string, callback StringCallback) {
+	m.notSupported("block-dirty-bitmap-remove", callback)
+}
+
+func (m *HmpMonitor) NbdServerAdd(device, name string, writable bool, bitmap string, callback StringCallback) {
+	if len(bitmap) > 0 {
+		m.notSupported("nbd-server-add with bitmap", callback)
+		return
+	}
+	cmd := "nbd_server_add"
+	if writable {
+		cmd += " -w"
+	}
+	m.Query(fmt.Sprintf("%s %s %s", cmd, device, name), callback)
+}
+
+func (m *HmpMonitor) NbdServerRemove(name string, callback StringCallback) {
+	m.Query(fmt.Sprintf("nbd_server_remove %s", name), callback)
+}
+
 func (m *HmpMonitor) DriveMirror(callback StringCallback, drive, target, syncMode string, unmap bool) {
 	cmd := "drive_mirror -n"
 	if syncMode == "full" {
@@ -437,6 +502,33 @@ func (m *HmpMonitor) GeMemtSlotIndex(callback func(index int)) {
 	m.Query("info memory-devices", cb)
 }
 
+func (m *HmpMonitor) SetBalloon(sizeMb int64, callback StringCallback) {
+	m.Query(fmt.Sprintf("balloon %d", sizeMb), callback)
+}
+
+func (m *HmpMonitor) GetBalloon(callback func(actualMb int64)) {
+	var cb = func(output string) {
+		// balloon: actual=1024
+		idx := strings.Index(output, "actual=")
+		if idx < 0 {
+			callback(-1)
+			return
+		}
+		fields := strings.Fields(output[idx+len("actual="):])
+		if len(fields) == 0 {
+			callback(-1)
+			return
+		}
+		actual, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			callback(-1)
+			return
+		}
+		callback(actual)
+	}
+	m.Query("info balloon", cb)
+}
+
 func (m *HmpMonitor) ObjectAdd(objectType string, params map[string]string, callback StringCallback) {
 	var paramsKvs = []string{}
 	for k, v := range params {
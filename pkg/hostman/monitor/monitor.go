@@ -43,6 +43,9 @@ type Monitor interface {
 	GetCpuCount(func(count int))
 	AddCpu(cpuIndex int, callback StringCallback)
 	GeMemtSlotIndex(func(index int))
+	// balloon target and actual guest memory size in MB, -1 on failure
+	SetBalloon(sizeMb int64, callback StringCallback)
+	GetBalloon(callback func(actualMb int64))
 
 	GetBlocks(callback func(*jsonutils.JSONArray))
 	EjectCdrom(dev string, callback StringCallback)
@@ -64,8 +67,19 @@ type Monitor interface {
 	GetMigrateStatus(callback StringCallback)
 
 	ReloadDiskBlkdev(device, path string, callback StringCallback)
+	// snapshots map block device to its pre-created qcow2 overlay file
+	BlockdevSnapshotSync(snapshots map[string]string, callback StringCallback)
 	SetVncPassword(proto, password string, callback StringCallback)
 	StartNbdServer(port int, exportAllDevice, writable bool, callback StringCallback)
+	NbdServerAdd(device, name string, writable bool, bitmap string, callback StringCallback)
+	NbdServerRemove(name string, callback StringCallback)
+
+	BlockdevAdd(options map[string]interface{}, callback StringCallback)
+	BlockdevDel(nodeName string, callback StringCallback)
+	BlockJobCancel(device string, callback StringCallback)
+	BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback)
+	BlockDirtyBitmapRemove(node, name string, callback StringCallback)
+	Transaction(actions []*TransactionAction, callback StringCallback)
 
 	ResizeDisk(driveName string, sizeMB int64, callback StringCallback)
 }
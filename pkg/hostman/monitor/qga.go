@@ -0,0 +1,454 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/log"
+)
+
+// https://qemu.weilnetz.de/doc/qemu-ga-ref.html
+/*
+The guest agent speaks the same json protocol as qmp, but without
+greeting and events. A stale reply may be left in the channel when a
+previous client gone away, so every new connection is synchronized by
+guest-sync before real commands are issued.
+*/
+
+const (
+	QGA_DEFAULT_TIMEOUT = 10 * time.Second
+	QGA_FILE_CHUNK_SIZE = 48 * 1024
+
+	QGA_FSFREEZE_STATUS_THAWED = "thawed"
+	QGA_FSFREEZE_STATUS_FROZEN = "frozen"
+)
+
+type QemuGuestAgent struct {
+	socketPath string
+	timeout    time.Duration
+
+	mutex  *sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewQemuGuestAgent(socketPath string) *QemuGuestAgent {
+	return &QemuGuestAgent{
+		socketPath: socketPath,
+		timeout:    QGA_DEFAULT_TIMEOUT,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+func (qga *QemuGuestAgent) SetTimeout(timeout time.Duration) {
+	qga.timeout = timeout
+}
+
+func (qga *QemuGuestAgent) Close() {
+	qga.mutex.Lock()
+	defer qga.mutex.Unlock()
+	qga.closeConn()
+}
+
+func (qga *QemuGuestAgent) closeConn() {
+	if qga.conn != nil {
+		qga.conn.Close()
+		qga.conn = nil
+		qga.reader = nil
+	}
+}
+
+func (qga *QemuGuestAgent) connect() error {
+	if qga.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", qga.socketPath, qga.timeout)
+	if err != nil {
+		return errors.Wrapf(err, "dial qga socket %s", qga.socketPath)
+	}
+	qga.conn = conn
+	qga.reader = bufio.NewReader(conn)
+	if err := qga.sync(); err != nil {
+		qga.closeConn()
+		return errors.Wrap(err, "guest-sync")
+	}
+	return nil
+}
+
+// sync drop replies left by previous clients until the reply of our
+// guest-sync arrives
+func (qga *QemuGuestAgent) sync() error {
+	id := rand.Int63n(1 << 31)
+	cmd := &Command{
+		Execute: "guest-sync",
+		Args:    map[string]interface{}{"id": id},
+	}
+	if err := qga.write(cmd); err != nil {
+		return err
+	}
+	for {
+		res, err := qga.readResponse()
+		if err != nil {
+			return err
+		}
+		if res.ErrorVal != nil {
+			continue
+		}
+		var retId int64
+		if err := json.Unmarshal(res.Return, &retId); err == nil && retId == id {
+			return nil
+		}
+	}
+}
+
+func (qga *QemuGuestAgent) write(cmd *Command) error {
+	c, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	// arguments may carry passwords or file contents
+	log.Debugf("QGA Write: %s", cmd.Execute)
+	qga.conn.SetDeadline(time.Now().Add(qga.timeout))
+	_, err = qga.conn.Write(append(c, '\n'))
+	return err
+}
+
+func (qga *QemuGuestAgent) readResponse() (*Response, error) {
+	qga.conn.SetDeadline(time.Now().Add(qga.timeout))
+	for {
+		line, err := qga.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var objmap map[string]*json.RawMessage
+		if err := json.Unmarshal(line, &objmap); err != nil {
+			// garbage left from a delimited sync, skip it
+			continue
+		}
+		if val, ok := objmap["error"]; ok {
+			res := &Response{ErrorVal: &Error{}}
+			json.Unmarshal(*val, res.ErrorVal)
+			return res, nil
+		} else if val, ok := objmap["return"]; ok {
+			return &Response{Return: []byte(*val)}, nil
+		}
+	}
+}
+
+// Exec issue a command to guest agent and wait for its result,
+// commands are serialized because qga handle only one request at a time
+func (qga *QemuGuestAgent) Exec(cmd *Command) ([]byte, error) {
+	qga.mutex.Lock()
+	defer qga.mutex.Unlock()
+
+	if err := qga.connect(); err != nil {
+		return nil, err
+	}
+	if err := qga.write(cmd); err != nil {
+		qga.closeConn()
+		return nil, errors.Wrapf(err, "write %s", cmd.Execute)
+	}
+	res, err := qga.readResponse()
+	if err != nil {
+		qga.closeConn()
+		return nil, errors.Wrapf(err, "read %s", cmd.Execute)
+	}
+	if res.ErrorVal != nil {
+		return nil, res.ErrorVal
+	}
+	return res.Return, nil
+}
+
+func (qga *QemuGuestAgent) execAndUnmarshal(cmd *Command, ret interface{}) error {
+	res, err := qga.Exec(cmd)
+	if err != nil {
+		return err
+	}
+	if ret == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res, ret); err != nil {
+		return errors.Wrapf(err, "unmarshal %s result %s", cmd.Execute, res)
+	}
+	return nil
+}
+
+func (qga *QemuGuestAgent) GuestPing() error {
+	return qga.execAndUnmarshal(&Command{Execute: "guest-ping"}, nil)
+}
+
+type GuestExecStatus struct {
+	Exited       bool   `json:"exited"`
+	Exitcode     int    `json:"exitcode"`
+	Signal       int    `json:"signal"`
+	OutData      string `json:"out-data"`
+	ErrData      string `json:"err-data"`
+	OutTruncated bool   `json:"out-truncated"`
+	ErrTruncated bool   `json:"err-truncated"`
+}
+
+// GuestExec start a process in guest and return its pid,
+// the output is captured only if captureOutput is true
+func (qga *QemuGuestAgent) GuestExec(path string, args, env []string, input []byte, captureOutput bool) (int, error) {
+	params := map[string]interface{}{
+		"path":           path,
+		"capture-output": captureOutput,
+	}
+	if len(args) > 0 {
+		params["arg"] = args
+	}
+	if len(env) > 0 {
+		params["env"] = env
+	}
+	if len(input) > 0 {
+		params["input-data"] = base64.StdEncoding.EncodeToString(input)
+	}
+	var ret struct {
+		Pid int `json:"pid"`
+	}
+	err := qga.execAndUnmarshal(&Command{Execute: "guest-exec", Args: params}, &ret)
+	if err != nil {
+		return -1, err
+	}
+	return ret.Pid, nil
+}
+
+// GuestExecStatus return the status of process started by guest-exec,
+// out-data and err-data are decoded from base64
+func (qga *QemuGuestAgent) GuestExecStatus(pid int) (*GuestExecStatus, error) {
+	var status = new(GuestExecStatus)
+	cmd := &Command{
+		Execute: "guest-exec-status",
+		Args:    map[string]interface{}{"pid": pid},
+	}
+	if err := qga.execAndUnmarshal(cmd, status); err != nil {
+		return nil, err
+	}
+	for _, data := range []*string{&status.OutData, &status.ErrData} {
+		if len(*data) > 0 {
+			decoded, err := base64.StdEncoding.DecodeString(*data)
+			if err != nil {
+				return nil, errors.Wrap(err, "decode exec output")
+			}
+			*data = string(decoded)
+		}
+	}
+	return status, nil
+}
+
+// GuestExecWait run command in guest and poll until it exited or timeout
+func (qga *QemuGuestAgent) GuestExecWait(path string, args, env []string, input []byte, timeout time.Duration) (*GuestExecStatus, error) {
+	pid, err := qga.GuestExec(path, args, env, input, true)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := qga.GuestExecStatus(pid)
+		if err != nil {
+			return nil, err
+		}
+		if status.Exited {
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("guest exec %s pid %d timeout", path, pid)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func (qga *QemuGuestAgent) GuestFileOpen(path, mode string) (int, error) {
+	var handle int
+	cmd := &Command{
+		Execute: "guest-file-open",
+		Args:    map[string]interface{}{"path": path, "mode": mode},
+	}
+	if err := qga.execAndUnmarshal(cmd, &handle); err != nil {
+		return -1, err
+	}
+	return handle, nil
+}
+
+func (qga *QemuGuestAgent) GuestFileClose(handle int) error {
+	cmd := &Command{
+		Execute: "guest-file-close",
+		Args:    map[string]interface{}{"handle": handle},
+	}
+	return qga.execAndUnmarshal(cmd, nil)
+}
+
+// GuestFileRead read at most count bytes from file handle,
+// return the data and whether EOF reached
+func (qga *QemuGuestAgent) GuestFileRead(handle, count int) ([]byte, bool, error) {
+	var ret struct {
+		Count  int    `json:"count"`
+		BufB64 string `json:"buf-b64"`
+		Eof    bool   `json:"eof"`
+	}
+	cmd := &Command{
+		Execute: "guest-file-read",
+		Args:    map[string]interface{}{"handle": handle, "count": count},
+	}
+	if err := qga.execAndUnmarshal(cmd, &ret); err != nil {
+		return nil, false, err
+	}
+	data, err := base64.StdEncoding.DecodeString(ret.BufB64)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "decode file content")
+	}
+	return data, ret.Eof, nil
+}
+
+func (qga *QemuGuestAgent) GuestFileWrite(handle int, data []byte) (int, error) {
+	var ret struct {
+		Count int  `json:"count"`
+		Eof   bool `json:"eof"`
+	}
+	cmd := &Command{
+		Execute: "guest-file-write",
+		Args: map[string]interface{}{
+			"handle":  handle,
+			"buf-b64": base64.StdEncoding.EncodeToString(data),
+		},
+	}
+	if err := qga.execAndUnmarshal(cmd, &ret); err != nil {
+		return 0, err
+	}
+	return ret.Count, nil
+}
+
+// GuestFileReadAll read whole content of guest file, limit is the
+// max bytes allowed to read, non-positive limit means no limit
+func (qga *QemuGuestAgent) GuestFileReadAll(path string, limit int) ([]byte, error) {
+	handle, err := qga.GuestFileOpen(path, "r")
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", path)
+	}
+	defer qga.GuestFileClose(handle)
+
+	var content = make([]byte, 0)
+	for {
+		data, eof, err := qga.GuestFileRead(handle, QGA_FILE_CHUNK_SIZE)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", path)
+		}
+		content = append(content, data...)
+		if limit > 0 && len(content) > limit {
+			return nil, fmt.Errorf("file %s exceed size limit %d", path, limit)
+		}
+		if eof || len(data) == 0 {
+			break
+		}
+	}
+	return content, nil
+}
+
+// GuestFileWriteAll truncate or create guest file and write content in chunks
+func (qga *QemuGuestAgent) GuestFileWriteAll(path string, content []byte) error {
+	handle, err := qga.GuestFileOpen(path, "w")
+	if err != nil {
+		return errors.Wrapf(err, "open %s", path)
+	}
+	defer qga.GuestFileClose(handle)
+
+	for len(content) > 0 {
+		size := len(content)
+		if size > QGA_FILE_CHUNK_SIZE {
+			size = QGA_FILE_CHUNK_SIZE
+		}
+		count, err := qga.GuestFileWrite(handle, content[:size])
+		if err != nil {
+			return errors.Wrapf(err, "write %s", path)
+		}
+		if count <= 0 {
+			return fmt.Errorf("write %s: no bytes written", path)
+		}
+		content = content[count:]
+	}
+	cmd := &Command{
+		Execute: "guest-file-flush",
+		Args:    map[string]interface{}{"handle": handle},
+	}
+	return qga.execAndUnmarshal(cmd, nil)
+}
+
+func (qga *QemuGuestAgent) GuestSetUserPassword(username, password string, crypted bool) error {
+	cmd := &Command{
+		Execute: "guest-set-user-password",
+		Args: map[string]interface{}{
+			"username": username,
+			"password": base64.StdEncoding.EncodeToString([]byte(password)),
+			"crypted":  crypted,
+		},
+	}
+	return qga.execAndUnmarshal(cmd, nil)
+}
+
+type GuestIpAddress struct {
+	IpAddressType string `json:"ip-address-type"`
+	IpAddress     string `json:"ip-address"`
+	Prefix        int    `json:"prefix"`
+}
+
+type GuestNetworkInterface struct {
+	Name            string           `json:"name"`
+	HardwareAddress string           `json:"hardware-address"`
+	IpAddresses     []GuestIpAddress `json:"ip-addresses"`
+}
+
+func (qga *QemuGuestAgent) GuestNetworkGetInterfaces() ([]GuestNetworkInterface, error) {
+	var ifaces = make([]GuestNetworkInterface, 0)
+	err := qga.execAndUnmarshal(&Command{Execute: "guest-network-get-interfaces"}, &ifaces)
+	if err != nil {
+		return nil, err
+	}
+	return ifaces, nil
+}
+
+func (qga *QemuGuestAgent) GuestFsfreezeStatus() (string, error) {
+	var status string
+	err := qga.execAndUnmarshal(&Command{Execute: "guest-fsfreeze-status"}, &status)
+	return status, err
+}
+
+// GuestFsfreezeFreeze freeze guest file systems, if mountpoints is empty
+// all freezable file systems are frozen. Return the number of frozen fs.
+func (qga *QemuGuestAgent) GuestFsfreezeFreeze(mountpoints []string) (int, error) {
+	var count int
+	cmd := &Command{Execute: "guest-fsfreeze-freeze"}
+	if len(mountpoints) > 0 {
+		cmd.Execute = "guest-fsfreeze-freeze-list"
+		cmd.Args = map[string]interface{}{"mountpoints": mountpoints}
+	}
+	err := qga.execAndUnmarshal(cmd, &count)
+	return count, err
+}
+
+func (qga *QemuGuestAgent) GuestFsfreezeThaw() (int, error) {
+	var count int
+	err := qga.execAndUnmarshal(&Command{Execute: "guest-fsfreeze-thaw"}, &count)
+	return count, err
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+// fakeGuestAgent answer guest-sync with the requested id and
+// reply other commands from the replies table
+func fakeGuestAgent(t *testing.T, l net.Listener, replies map[string]string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// stale reply from a previous client
+	conn.Write([]byte(`{"return": {}}` + "\n"))
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var cmd struct {
+			Execute   string                 `json:"execute"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+			t.Errorf("invalid command %s", scanner.Bytes())
+			return
+		}
+		var reply string
+		if cmd.Execute == "guest-sync" {
+			id, _ := json.Marshal(cmd.Arguments["id"])
+			reply = `{"return": ` + string(id) + `}`
+		} else if r, ok := replies[cmd.Execute]; ok {
+			reply = r
+		} else {
+			reply = `{"error": {"class": "CommandNotFound", "desc": "not found"}}`
+		}
+		conn.Write([]byte(reply + "\n"))
+	}
+}
+
+func TestQemuGuestAgent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qga")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := path.Join(dir, "qga.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go fakeGuestAgent(t, l, map[string]string{
+		"guest-ping":                   `{"return": {}}`,
+		"guest-exec":                   `{"return": {"pid": 42}}`,
+		"guest-exec-status":            `{"return": {"exited": true, "exitcode": 0, "out-data": "aGVsbG8K"}}`,
+		"guest-fsfreeze-freeze":        `{"return": 2}`,
+		"guest-network-get-interfaces": `{"return": [{"name": "eth0", "hardware-address": "00:22:aa:bb:cc:dd", "ip-addresses": [{"ip-address-type": "ipv4", "ip-address": "10.0.0.2", "prefix": 24}]}]}`,
+	})
+
+	qga := NewQemuGuestAgent(sock)
+	defer qga.Close()
+	if err := qga.GuestPing(); err != nil {
+		t.Fatalf("ping: %s", err)
+	}
+	pid, err := qga.GuestExec("/bin/echo", []string{"hello"}, nil, nil, true)
+	if err != nil || pid != 42 {
+		t.Fatalf("exec pid %d: %v", pid, err)
+	}
+	status, err := qga.GuestExecStatus(pid)
+	if err != nil {
+		t.Fatalf("exec status: %s", err)
+	}
+	if !status.Exited || status.OutData != "hello\n" {
+		t.Errorf("unexpected exec status %#v", status)
+	}
+	if count, err := qga.GuestFsfreezeFreeze(nil); err != nil || count != 2 {
+		t.Errorf("fsfreeze count %d: %v", count, err)
+	}
+	ifaces, err := qga.GuestNetworkGetInterfaces()
+	if err != nil {
+		t.Fatalf("get interfaces: %s", err)
+	}
+	if len(ifaces) != 1 || ifaces[0].IpAddresses[0].IpAddress != "10.0.0.2" {
+		t.Errorf("unexpected interfaces %#v", ifaces)
+	}
+	if _, err := qga.GuestFsfreezeStatus(); err == nil {
+		t.Errorf("expect error for unsupported command")
+	}
+}
@@ -72,6 +72,11 @@ type Command struct {
 	Args    interface{} `json:"arguments,omitempty"`
 }
 
+type TransactionAction struct {
+	Type string                 `json:"type"`
+	Data map[string]interface{} `json:"data"`
+}
+
 type Version struct {
 	Package string `json:"package"`
 	QEMU    struct {
@@ -670,6 +675,95 @@ func (m *QmpMonitor) ReloadDiskBlkdev(device, path string, callback StringCallba
 	m.Query(cmd, cb)
 }
 
+// BlockdevSnapshotSync switch all given devices to their existing overlay
+// files in one transaction, so snapshots of multiple disks are taken at
+// the same point in time
+func (m *QmpMonitor) BlockdevSnapshotSync(snapshots map[string]string, callback StringCallback) {
+	var actions = make([]*TransactionAction, 0, len(snapshots))
+	for device, snapshotFile := range snapshots {
+		actions = append(actions, &TransactionAction{
+			Type: "blockdev-snapshot-sync",
+			Data: map[string]interface{}{
+				"device":        device,
+				"snapshot-file": snapshotFile,
+				"mode":          "existing",
+				"format":        "qcow2",
+			},
+		})
+	}
+	m.Transaction(actions, callback)
+}
+
+func (m *QmpMonitor) Transaction(actions []*TransactionAction, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "transaction",
+			Args:    map[string]interface{}{"actions": actions},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) simpleQuery(execute string, args map[string]interface{}, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{Execute: execute, Args: args}
+	)
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) BlockdevAdd(options map[string]interface{}, callback StringCallback) {
+	m.simpleQuery("blockdev-add", options, callback)
+}
+
+func (m *QmpMonitor) BlockdevDel(nodeName string, callback StringCallback) {
+	m.simpleQuery("blockdev-del", map[string]interface{}{"node-name": nodeName}, callback)
+}
+
+func (m *QmpMonitor) BlockJobCancel(device string, callback StringCallback) {
+	m.simpleQuery("block-job-cancel", map[string]interface{}{"device": device}, callback)
+}
+
+func (m *QmpMonitor) BlockDirtyBitmapAdd(node, name string, persistent bool, callback StringCallback) {
+	args := map[string]interface{}{
+		"node":       node,
+		"name":       name,
+		"persistent": persistent,
+	}
+	m.simpleQuery("block-dirty-bitmap-add", args, callback)
+}
+
+func (m *QmpMonitor) BlockDirtyBitmapRemove(node, name string, callback StringCallback) {
+	args := map[string]interface{}{
+		"node": node,
+		"name": name,
+	}
+	m.simpleQuery("block-dirty-bitmap-remove", args, callback)
+}
+
+// NbdServerAdd export a block node on the running nbd server,
+// the bitmap, if given, is exposed as qemu:dirty-bitmap:<bitmap> meta context
+func (m *QmpMonitor) NbdServerAdd(device, name string, writable bool, bitmap string, callback StringCallback) {
+	args := map[string]interface{}{
+		"device":   device,
+		"name":     name,
+		"writable": writable,
+	}
+	if len(bitmap) > 0 {
+		args["bitmap"] = bitmap
+	}
+	m.simpleQuery("nbd-server-add", args, callback)
+}
+
+func (m *QmpMonitor) NbdServerRemove(name string, callback StringCallback) {
+	m.simpleQuery("nbd-server-remove", map[string]interface{}{"name": name}, callback)
+}
+
 func (m *QmpMonitor) DriveMirror(callback StringCallback, drive, target, syncMode string, unmap bool) {
 	var (
 		cb = func(res *Response) {
@@ -769,6 +863,41 @@ func (m *QmpMonitor) AddCpu(cpuIndex int, callback StringCallback) {
 	m.Query(cmd, cb)
 }
 
+func (m *QmpMonitor) SetBalloon(sizeMb int64, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "balloon",
+			Args:    map[string]interface{}{"value": sizeMb * 1024 * 1024},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) GetBalloon(callback func(actualMb int64)) {
+	var cb = func(res *Response) {
+		if res.ErrorVal != nil {
+			callback(-1)
+			return
+		}
+		jr, err := jsonutils.Parse(res.Return)
+		if err != nil {
+			log.Errorf("Query balloon error %s", err)
+			callback(-1)
+			return
+		}
+		actual, err := jr.Int("actual")
+		if err != nil {
+			callback(-1)
+			return
+		}
+		callback(actual / 1024 / 1024)
+	}
+	m.Query(&Command{Execute: "query-balloon"}, cb)
+}
+
 func (m *QmpMonitor) ObjectAdd(objectType string, params map[string]string, callback StringCallback) {
 	var paramsKvs = []string{}
 	for k, v := range params {
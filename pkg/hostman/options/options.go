@@ -102,6 +102,16 @@ type SHostOptions struct {
 	WindowsDefaultAdminUser bool `default:"true" help:"Default account for Windows system is Administrator"`
 
 	HostCpuPassthrough bool `default:"true" help:"if it is true, set qemu cpu type as -cpu host, otherwise, qemu64. default is true"`
+
+	EnablePvpanic bool `default:"false" help:"Add pvpanic device to kvm guests to report guest kernel panic, changes guest hardware so migration to hosts without it may fail"`
+
+	EnableMemoryBalloon      bool `default:"false" help:"Add virtio balloon device to kvm guests, changes guest hardware so migration to hosts without it may fail"`
+	BalloonFreePageReporting bool `default:"false" help:"Enable balloon free page reporting, requires qemu 5.1 and guest kernel 5.7 or later"`
+	MemoryReclaimInterval    int  `default:"60" help:"Interval in seconds to check host memory pressure and reclaim memory of idle guests, 0 to disable"`
+	MemoryPressureThreshold  int  `default:"10" help:"Host is under memory pressure when available memory is below this percent of total memory"`
+	MemoryReclaimStepPercent int  `default:"10" help:"Percent of guest memory reclaimed by balloon in each round"`
+	MemoryReclaimMinPercent  int  `default:"50" help:"Guest memory will not be ballooned below this percent of its configured size"`
+	GuestIdleCpuUsagePercent int  `default:"5" help:"Guest is considered idle when its cpu usage is below this percent of one core"`
 }
 
 var HostOptions SHostOptions
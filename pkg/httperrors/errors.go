@@ -211,6 +211,11 @@ func NewInvalidCredentialError(msg string, params ...interface{}) *httputils.JSO
 	return NewJsonClientError(401, "InvalidCredentialError", msg, err)
 }
 
+func NewTotpRequiredError(msg string, params ...interface{}) *httputils.JSONClientError {
+	msg, err := errorMessage(msg, params...)
+	return NewJsonClientError(401, "TotpRequiredError", msg, err)
+}
+
 func NewForbiddenError(msg string, params ...interface{}) *httputils.JSONClientError {
 	msg, err := errorMessage(msg, params...)
 	return NewJsonClientError(403, "ForbiddenError", msg, err)
@@ -15,6 +15,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -91,8 +92,8 @@ func (manager *SImageSubformatManager) GetAllSubImages(id string) []SImageSubfor
 	return subImgs
 }
 
-func (self *SImageSubformat) DoConvert(image *SImage) error {
-	err := self.Save(image)
+func (self *SImageSubformat) DoConvert(ctx context.Context, image *SImage, progress qemuimg.ProgressFunc) error {
+	err := self.Save(ctx, image, progress)
 	if err != nil {
 		log.Errorf("fail to convert image %s", err)
 		return err
@@ -113,7 +114,7 @@ func (self *SImageSubformat) DoConvert(image *SImage) error {
 	return nil
 }
 
-func (self *SImageSubformat) Save(image *SImage) error {
+func (self *SImageSubformat) Save(ctx context.Context, image *SImage, progress qemuimg.ProgressFunc) error {
 	if self.Status == api.IMAGE_STATUS_ACTIVE {
 		return nil
 	}
@@ -135,9 +136,11 @@ func (self *SImageSubformat) Save(image *SImage) error {
 		log.Errorf("image.getQemuImage fail %s", err)
 		return err
 	}
-	nimg, err := img.Clone(location, qemuimg.String2ImageFormat(self.Format), true)
+	nimg, err := img.CloneWithContext(ctx, location, qemuimg.String2ImageFormat(self.Format), true, progress)
 	if err != nil {
 		log.Errorf("img.Clone fail %s", err)
+		// partial output is removed, convert again next time
+		self.setStatus(api.IMAGE_STATUS_QUEUED)
 		return err
 	}
 	checksum, err := fileutils2.MD5(location)
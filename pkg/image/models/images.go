@@ -24,6 +24,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"yunion.io/x/jsonutils"
@@ -112,6 +113,9 @@ type SImage struct {
 	MinDiskMB  int32  `name:"min_disk" nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
 	MinRamMB   int32  `name:"min_ram" nullable:"false" default:"0" list:"user" create:"optional" update:"user"`
 	Protected  *bool  `nullable:"true" list:"user" get:"user" create:"optional" update:"user"`
+
+	// percent done of converting subformats
+	Progress float32 `nullable:"false" default:"0" list:"user"`
 }
 
 func (manager *SImageManager) CustomizeHandlerInfo(info *appsrv.SHandlerInfo) {
@@ -590,6 +594,9 @@ func (self *SImage) startDeleteImageTask(ctx context.Context, userCred mcclient.
 	}
 	params.Add(jsonutils.NewString(self.Status), "image_status")
 
+	if CancelImageConvert(self.Id) {
+		log.Infof("image %s converting is aborted by deletion", self.Name)
+	}
 	self.SetStatus(userCred, api.IMAGE_STATUS_DEACTIVATED, "")
 
 	task, err := taskman.TaskManager.NewTask(ctx, "ImageDeleteTask", self, userCred, params, parentTaskId, "", nil)
@@ -871,7 +878,7 @@ func (self *SImage) MakeSubImages() error {
 	}
 	log.Debugf("[MakeSubImages] convert image to %#v", options.Options.TargetImageFormats)
 	for _, format := range options.Options.TargetImageFormats {
-		if !qemuimg.IsSupportedImageFormat(format) {
+		if !qemuimg.IsSupportedTargetImageFormat(format) {
 			continue
 		}
 		if format != self.DiskFormat {
@@ -888,20 +895,74 @@ func (self *SImage) MakeSubImages() error {
 	return nil
 }
 
-func (self *SImage) ConvertAllSubformats() error {
-	subimgs := ImageSubformatManager.GetAllSubImages(self.Id)
-	for i := 0; i < len(subimgs); i += 1 {
-		if !utils.IsInStringArray(subimgs[i].Format, options.Options.TargetImageFormats) {
-			continue
+var (
+	imageConvertCancels     = map[string]context.CancelFunc{}
+	imageConvertCancelsLock = &sync.Mutex{}
+)
+
+// CancelImageConvert abort converting subformats of image, return false
+// if image is not being converted
+func CancelImageConvert(imageId string) bool {
+	imageConvertCancelsLock.Lock()
+	defer imageConvertCancelsLock.Unlock()
+	cancel, ok := imageConvertCancels[imageId]
+	if ok {
+		cancel()
+		delete(imageConvertCancels, imageId)
+	}
+	return ok
+}
+
+// ConvertAllSubformats convert image to every target format, the progress
+// is saved to image, context.Canceled is returned if the conversion is
+// aborted by CancelImageConvert
+func (self *SImage) ConvertAllSubformats(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	imageConvertCancelsLock.Lock()
+	imageConvertCancels[self.Id] = cancel
+	imageConvertCancelsLock.Unlock()
+	defer func() {
+		imageConvertCancelsLock.Lock()
+		delete(imageConvertCancels, self.Id)
+		imageConvertCancelsLock.Unlock()
+		cancel()
+	}()
+
+	subimgs := make([]SImageSubformat, 0)
+	for _, subimg := range ImageSubformatManager.GetAllSubImages(self.Id) {
+		if utils.IsInStringArray(subimg.Format, options.Options.TargetImageFormats) {
+			subimgs = append(subimgs, subimg)
 		}
-		err := subimgs[i].DoConvert(self)
+	}
+	self.setProgress(0)
+	for i := 0; i < len(subimgs); i += 1 {
+		done := float64(i)
+		err := subimgs[i].DoConvert(ctx, self, func(percent float64) {
+			self.setProgress((done + percent/100) * 100 / float64(len(subimgs)))
+		})
 		if err != nil {
 			return err
 		}
 	}
+	self.setProgress(100)
 	return nil
 }
 
+// setProgress save progress only when the whole percent changes
+func (self *SImage) setProgress(percent float64) {
+	progress := float32(math.Floor(percent))
+	if progress == self.Progress {
+		return
+	}
+	_, err := db.Update(self, func() error {
+		self.Progress = progress
+		return nil
+	})
+	if err != nil {
+		log.Errorf("update image %s progress fail %s", self.Id, err)
+	}
+}
+
 func (self *SImage) getLocalLocation() string {
 	if len(self.Location) > len(LocalFilePrefix) {
 		return self.Location[len(LocalFilePrefix):]
@@ -36,7 +36,7 @@ type SImageOptions struct {
 
 	EnableTorrentService bool `help:"Enable torrent service" default:"false"`
 
-	TargetImageFormats []string `help:"target image formats that the system will automatically convert to" default:"qcow2,vmdk,vhd"`
+	TargetImageFormats []string `help:"target image formats that the system will automatically convert to, supported formats are qcow2,vmdk,vhd,vhdx,raw,ova" default:"qcow2,vmdk,vhd"`
 
 	TorrentClientPath string `help:"path to torrent executable" default:"/opt/yunion/bin/torrent"`
 }
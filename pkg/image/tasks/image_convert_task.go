@@ -45,7 +45,11 @@ func (self *ImageConvertTask) OnInit(ctx context.Context, obj db.IStandaloneMode
 	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
 		imgOldStatus := image.Status
 		image.SetStatus(self.UserCred, api.IMAGE_STATUS_CONVERTING, "start convert")
-		err := image.ConvertAllSubformats()
+		err := image.ConvertAllSubformats(ctx)
+		if err == context.Canceled {
+			// image is being deleted, leave status to delete task
+			return nil, fmt.Errorf("convert aborted")
+		}
 		var msg string
 		if err != nil {
 			msg = fmt.Sprintf("convert failed: %s", err)
@@ -43,6 +43,10 @@ func GetDriver(domainId string, conf models.TDomainConfigs) (IIdentityBackend, e
 			switch driver {
 			case "ldap":
 				return NewLDAPDriver(domainId, conf)
+			case "oidc":
+				return NewOIDCDriver(domainId, conf)
+			case "saml":
+				return NewSAMLDriver(domainId, conf)
 			}
 		}
 	}
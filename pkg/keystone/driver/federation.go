@@ -0,0 +1,188 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package driver
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+// IFederatedBackend is implemented by drivers that sign users in at an
+// external identity provider instead of checking passwords
+type IFederatedBackend interface {
+	IIdentityBackend
+
+	// AuthMethod is the token method of users signed in through the driver
+	AuthMethod() string
+	// GetSSORedirectUri returns where the user agent signs in, which sends
+	// state back to the callback. nonce binds the callback to this request.
+	GetSSORedirectUri(ctx context.Context, nonce string, state string) (string, error)
+	// AuthenticateSSO validates the callback parameters sent by the provider
+	AuthenticateSSO(ctx context.Context, nonce string, params url.Values) (*models.SUserExtended, error)
+}
+
+// SFederatedUserInfo is a user asserted by an identity provider
+type SFederatedUserInfo struct {
+	UniqueId   string
+	Attributes map[string][]string
+}
+
+type SFederatedDomainDriver struct {
+	SBaseDomainDriver
+
+	protocol string
+	rules    []api.SFederationMappingRule
+}
+
+func NewFederatedDomainDriver(domainId string, conf models.TDomainConfigs, protocol string) (SFederatedDomainDriver, error) {
+	drv := SFederatedDomainDriver{
+		SBaseDomainDriver: NewBaseDomainDriver(domainId, conf),
+		protocol:          protocol,
+	}
+	if mapping, ok := conf[protocol]["mapping"]; ok {
+		err := mapping.Unmarshal(&drv.rules)
+		if err != nil {
+			return drv, errors.WithMessage(err, "Unmarshal mapping")
+		}
+	}
+	return drv, nil
+}
+
+func (self *SFederatedDomainDriver) Authenticate(ctx context.Context, ident mcclient.SAuthenticationIdentity) (*models.SUserExtended, error) {
+	return nil, errors.New("password authentication not supported, sign in with web SSO")
+}
+
+func firstValue(attrs map[string][]string, key string) string {
+	if values := attrs[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// syncFederatedUser maps the asserted user to the local user, created on
+// the first sign-in, and applies the mapped groups and project roles
+func (self *SFederatedDomainDriver) syncFederatedUser(ctx context.Context, remoteId string, userNameAttr string, info SFederatedUserInfo) (*models.SUserExtended, error) {
+	mapped, err := evalMappingRules(self.rules, info.Attributes)
+	if err != nil {
+		return nil, errors.WithMessage(err, "evalMappingRules")
+	}
+	userName := mapped.UserName
+	if len(userName) == 0 {
+		userName = firstValue(info.Attributes, userNameAttr)
+	}
+	if len(userName) == 0 {
+		userName = info.UniqueId
+	}
+
+	idp, err := models.IdentityProviderManager.RegisterIdp(ctx, self.domainId, self.protocol, remoteId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "models.IdentityProviderManager.RegisterIdp")
+	}
+	// the unique ID identifies the user, names asserted by the provider
+	// only name users signing in for the first time
+	userId, err := models.FederatedUserManager.FetchUserId(idp.Id, self.protocol, info.UniqueId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "models.FederatedUserManager.FetchUserId")
+	}
+	var nonLocalUser *models.SNonlocalUser
+	if len(userId) > 0 {
+		nonLocalUser, err = models.NonlocalUserManager.FetchByUserId(userId)
+		if err != nil {
+			return nil, errors.WithMessage(err, "models.NonlocalUserManager.FetchByUserId")
+		}
+		if nonLocalUser == nil {
+			return nil, errors.Errorf("federated user %s not found", userId)
+		}
+		userName = nonLocalUser.Name
+	} else {
+		nonLocalUser, err = models.NonlocalUserManager.Register(ctx, self.domainId, userName)
+		if err != nil {
+			return nil, errors.WithMessage(err, "models.NonlocalUserManager.Register")
+		}
+	}
+	// link before updating the user, which may be of another identity
+	err = models.FederatedUserManager.Register(ctx, nonLocalUser.UserId, idp.Id, self.protocol, info.UniqueId, mapped.Displayname)
+	if err != nil {
+		return nil, errors.WithMessage(err, "models.FederatedUserManager.Register")
+	}
+
+	ui := SUserInfo{
+		Id:      userName,
+		Name:    userName,
+		Enabled: true,
+		Extra: map[string]string{
+			"email":       mapped.Email,
+			"displayname": mapped.Displayname,
+		},
+	}
+	// keep a user disabled by the admin disabled
+	if usr, err := models.UserManager.FetchUserExtended(nonLocalUser.UserId, "", "", ""); err == nil {
+		ui.Enabled = usr.Enabled
+	}
+	err = registerNonlocalUser(ctx, ui, nonLocalUser)
+	if err != nil {
+		return nil, errors.WithMessage(err, "registerNonlocalUser")
+	}
+
+	userCred := models.GetDefaultAdminCred()
+	groupIds := make([]string, 0)
+	for _, name := range mapped.Groups {
+		grp, err := models.GroupManager.RegisterExternalGroup(ctx, self.domainId, name, name)
+		if err != nil {
+			log.Errorf("models.GroupManager.RegisterExternalGroup fail %s", err)
+		} else {
+			groupIds = append(groupIds, grp.Id)
+		}
+	}
+	models.UsergroupManager.SyncUserGroups(ctx, userCred, nonLocalUser.UserId, groupIds)
+
+	err = models.AssignmentManager.AddFederatedUserProjectRoles(ctx, userCred, nonLocalUser.UserId, self.domainId, mapped.Projects)
+	if err != nil {
+		return nil, errors.WithMessage(err, "models.AssignmentManager.AddFederatedUserProjectRoles")
+	}
+
+	return models.UserManager.FetchUserExtended(nonLocalUser.UserId, "", "", "")
+}
+
+// claims2Attributes flattens OpenID claims to the attribute form mapping
+// rules work on
+func claims2Attributes(claims *jsonutils.JSONDict) map[string][]string {
+	attrs := make(map[string][]string)
+	claimMap, _ := claims.GetMap()
+	for key, val := range claimMap {
+		items := []jsonutils.JSONObject{val}
+		if arr, ok := val.(*jsonutils.JSONArray); ok {
+			items, _ = arr.GetArray()
+		}
+		values := make([]string, 0, len(items))
+		for _, item := range items {
+			if str, err := item.GetString(); err == nil {
+				values = append(values, str)
+			} else {
+				values = append(values, item.String())
+			}
+		}
+		attrs[key] = values
+	}
+	return attrs
+}
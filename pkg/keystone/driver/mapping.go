@@ -0,0 +1,221 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+)
+
+// SMappedIdentity is the local identity a federated user maps to
+type SMappedIdentity struct {
+	UserName    string
+	Email       string
+	Displayname string
+	Groups      []string
+	// roles keyed by project name
+	Projects map[string][]string
+}
+
+var placeholderPattern = regexp.MustCompile(`\{(\d+)\}`)
+
+func matchRemoteValue(pattern string, value string, isRegex bool) (bool, error) {
+	if !isRegex {
+		return pattern == value, nil
+	}
+	matched, err := regexp.MatchString(pattern, value)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid regex %s", pattern)
+	}
+	return matched, nil
+}
+
+func matchAnyRemoteValue(patterns []string, values []string, isRegex bool) (bool, error) {
+	for _, p := range patterns {
+		for _, v := range values {
+			matched, err := matchRemoteValue(p, v, isRegex)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchRemotes returns the values captured by the direct remotes if all
+// the conditions of the rule hold
+func matchRemotes(remotes []api.SFederationMappingRemote, attrs map[string][]string) ([][]string, bool, error) {
+	direct := make([][]string, 0)
+	for _, remote := range remotes {
+		values, ok := attrs[remote.Type]
+		if len(remote.NotAnyOf) > 0 {
+			matched, err := matchAnyRemoteValue(remote.NotAnyOf, values, remote.Regex)
+			if err != nil {
+				return nil, false, err
+			}
+			if matched {
+				return nil, false, nil
+			}
+			continue
+		}
+		if !ok || len(values) == 0 {
+			return nil, false, nil
+		}
+		if len(remote.AnyOneOf) > 0 {
+			matched, err := matchAnyRemoteValue(remote.AnyOneOf, values, remote.Regex)
+			if err != nil {
+				return nil, false, err
+			}
+			if !matched {
+				return nil, false, nil
+			}
+			continue
+		}
+		direct = append(direct, values)
+	}
+	return direct, true, nil
+}
+
+// expandTemplate substitutes the {N} placeholders of tmpl. A template that
+// is a sole placeholder expands to every captured value, otherwise
+// placeholders take the first value.
+func expandTemplate(tmpl string, direct [][]string) ([]string, error) {
+	if m := placeholderPattern.FindStringSubmatch(tmpl); m != nil && m[0] == tmpl {
+		idx, _ := strconv.Atoi(m[1])
+		if idx >= len(direct) {
+			return nil, fmt.Errorf("placeholder %s out of range", tmpl)
+		}
+		return append([]string{}, direct[idx]...), nil
+	}
+	var outOfRange error
+	ret := placeholderPattern.ReplaceAllStringFunc(tmpl, func(p string) string {
+		idx, _ := strconv.Atoi(p[1 : len(p)-1])
+		if idx >= len(direct) {
+			outOfRange = fmt.Errorf("placeholder %s out of range", p)
+			return ""
+		}
+		return direct[idx][0]
+	})
+	if outOfRange != nil {
+		return nil, outOfRange
+	}
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return []string{ret}, nil
+}
+
+func expandFirst(tmpl string, direct [][]string) (string, error) {
+	if len(tmpl) == 0 {
+		return "", nil
+	}
+	values, err := expandTemplate(tmpl, direct)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[0], nil
+}
+
+func (ident *SMappedIdentity) applyLocal(local api.SFederationMappingLocal, direct [][]string) error {
+	if local.User != nil {
+		for _, field := range []struct {
+			tmpl string
+			val  *string
+		}{
+			{local.User.Name, &ident.UserName},
+			{local.User.Email, &ident.Email},
+			{local.User.Displayname, &ident.Displayname},
+		} {
+			if len(*field.val) > 0 {
+				continue
+			}
+			val, err := expandFirst(field.tmpl, direct)
+			if err != nil {
+				return err
+			}
+			*field.val = val
+		}
+	}
+	for _, tmpl := range local.Groups {
+		groups, err := expandTemplate(tmpl, direct)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			if !utils.IsInStringArray(g, ident.Groups) {
+				ident.Groups = append(ident.Groups, g)
+			}
+		}
+	}
+	for _, proj := range local.Projects {
+		names, err := expandTemplate(proj.Name, direct)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			for _, role := range proj.Roles {
+				if !utils.IsInStringArray(role, ident.Projects[name]) {
+					ident.Projects[name] = append(ident.Projects[name], role)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// evalMappingRules merges the locals of every rule that applies to attrs.
+// The user is rejected if there are rules but none applies.
+func evalMappingRules(rules []api.SFederationMappingRule, attrs map[string][]string) (*SMappedIdentity, error) {
+	ident := &SMappedIdentity{
+		Groups:   make([]string, 0),
+		Projects: make(map[string][]string),
+	}
+	if len(rules) == 0 {
+		return ident, nil
+	}
+	matched := false
+	for i, rule := range rules {
+		direct, ok, err := matchRemotes(rule.Remote, attrs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i)
+		}
+		if !ok {
+			continue
+		}
+		matched = true
+		for _, local := range rule.Local {
+			err := ident.applyLocal(local, direct)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule %d", i)
+			}
+		}
+	}
+	if !matched {
+		return nil, fmt.Errorf("no mapping rule applies")
+	}
+	return ident, nil
+}
@@ -0,0 +1,288 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package driver
+
+import (
+	"context"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
+	"yunion.io/x/onecloud/pkg/util/samlutils"
+)
+
+const testMapping = `[
+	{
+		"remote": [{"type": "preferred_username"}, {"type": "groups"}],
+		"local": [{"user": {"name": "{0}"}, "groups": ["{1}"]}]
+	},
+	{
+		"remote": [{"type": "groups", "any_one_of": ["^ops"], "regex": true}],
+		"local": [{"projects": [{"name": "ops", "roles": ["project_owner"]}]}]
+	},
+	{
+		"remote": [{"type": "department"}, {"type": "groups", "not_any_of": ["contractor"]}],
+		"local": [{"projects": [{"name": "dept-{0}", "roles": ["member"]}]}]
+	}
+]`
+
+func testRules(t *testing.T) []api.SFederationMappingRule {
+	obj, err := jsonutils.ParseString(testMapping)
+	if err != nil {
+		t.Fatalf("parse mapping %s", err)
+	}
+	rules := make([]api.SFederationMappingRule, 0)
+	err = obj.Unmarshal(&rules)
+	if err != nil {
+		t.Fatalf("unmarshal mapping %s", err)
+	}
+	return rules
+}
+
+func TestEvalMappingRules(t *testing.T) {
+	rules := testRules(t)
+	cases := []struct {
+		attrs map[string][]string
+		want  *SMappedIdentity
+	}{
+		{
+			attrs: map[string][]string{
+				"preferred_username": {"alice"},
+				"groups":             {"dev", "ops-admin"},
+				"department":         {"rd"},
+			},
+			want: &SMappedIdentity{
+				UserName: "alice",
+				Groups:   []string{"dev", "ops-admin"},
+				Projects: map[string][]string{
+					"ops":     {"project_owner"},
+					"dept-rd": {"member"},
+				},
+			},
+		},
+		{
+			attrs: map[string][]string{
+				"preferred_username": {"bob"},
+				"groups":             {"contractor"},
+				"department":         {"rd"},
+			},
+			want: &SMappedIdentity{
+				UserName: "bob",
+				Groups:   []string{"contractor"},
+				Projects: map[string][]string{},
+			},
+		},
+		{
+			attrs: map[string][]string{
+				"email": {"carol@example.com"},
+			},
+			want: nil,
+		},
+	}
+	for _, c := range cases {
+		got, err := evalMappingRules(rules, c.attrs)
+		if c.want == nil {
+			if err == nil {
+				t.Errorf("%v: expect rejected, got %#v", c.attrs, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %s", c.attrs, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: want %#v got %#v", c.attrs, c.want, got)
+		}
+	}
+
+	ident, err := evalMappingRules(nil, map[string][]string{"sub": {"x"}})
+	if err != nil || len(ident.UserName) > 0 || len(ident.Groups) > 0 {
+		t.Errorf("no rules should map nothing: %#v %s", ident, err)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	direct := [][]string{{"a", "b"}, {"c"}}
+	cases := []struct {
+		tmpl string
+		want []string
+	}{
+		{"{0}", []string{"a", "b"}},
+		{"x-{0}-{1}", []string{"x-a-c"}},
+		{"plain", []string{"plain"}},
+	}
+	for _, c := range cases {
+		got, err := expandTemplate(c.tmpl, direct)
+		if err != nil {
+			t.Errorf("%s: %s", c.tmpl, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: want %v got %v", c.tmpl, c.want, got)
+		}
+	}
+	if _, err := expandTemplate("{2}", direct); err == nil {
+		t.Errorf("out of range placeholder accepted")
+	}
+}
+
+// TestOIDCMapping runs the mapping on claims from the mock OpenID provider
+func TestOIDCMapping(t *testing.T) {
+	idp, err := oidcutils.NewMockProvider("keystone", "secret", map[string]interface{}{
+		"sub":                "u-1001",
+		"preferred_username": "alice",
+		"groups":             []string{"ops"},
+	})
+	if err != nil {
+		t.Fatalf("NewMockProvider %s", err)
+	}
+	defer idp.Close()
+
+	ctx := context.Background()
+	cli := oidcutils.NewOIDCClient("keystone", "secret", "http://localhost/callback", nil, nil)
+	err = cli.FetchConfiguration(ctx, idp.Issuer())
+	if err != nil {
+		t.Fatalf("FetchConfiguration %s", err)
+	}
+	noRedirect := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := noRedirect.Get(cli.AuthCodeUrl("state", "nonce"))
+	if err != nil {
+		t.Fatalf("authorize %s", err)
+	}
+	resp.Body.Close()
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	claims, err := cli.Authenticate(ctx, loc.Query().Get("code"), "nonce")
+	if err != nil {
+		t.Fatalf("Authenticate %s", err)
+	}
+
+	attrs := claims2Attributes(claims)
+	if firstValue(attrs, "sub") != "u-1001" {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	ident, err := evalMappingRules(testRules(t), attrs)
+	if err != nil {
+		t.Fatalf("evalMappingRules %s", err)
+	}
+	if ident.UserName != "alice" || !reflect.DeepEqual(ident.Projects["ops"], []string{"project_owner"}) {
+		t.Errorf("unexpected identity %#v", ident)
+	}
+}
+
+var inputPattern = regexp.MustCompile(`name="([^"]+)" value="([^"]*)"`)
+
+// TestSAMLMapping runs the mapping on an assertion of the mock SAML IdP
+func TestSAMLMapping(t *testing.T) {
+	idp, err := samlutils.NewMockIdP("alice@example.com", map[string][]string{
+		"preferred_username": {"alice"},
+		"groups":             {"dev"},
+		"department":         {"rd"},
+	})
+	if err != nil {
+		t.Fatalf("NewMockIdP %s", err)
+	}
+	defer idp.Close()
+
+	sp, err := samlutils.NewServiceProvider("https://keystone", "https://keystone/acs", idp.EntityId(), idp.SsoUrl(), idp.CertificatePem())
+	if err != nil {
+		t.Fatalf("NewServiceProvider %s", err)
+	}
+	reqId := samlutils.GenerateId()
+	loginUrl, err := sp.AuthnRequestUrl(reqId, "state")
+	if err != nil {
+		t.Fatalf("AuthnRequestUrl %s", err)
+	}
+	resp, err := http.Get(loginUrl)
+	if err != nil {
+		t.Fatalf("sso %s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	form := url.Values{}
+	for _, m := range inputPattern.FindAllStringSubmatch(string(body), -1) {
+		form.Set(html.UnescapeString(m[1]), html.UnescapeString(m[2]))
+	}
+	assertion, err := sp.ParseResponse(form.Get("SAMLResponse"), reqId)
+	if err != nil {
+		t.Fatalf("ParseResponse %s", err)
+	}
+	if assertion.NameId != "alice@example.com" {
+		t.Errorf("unexpected NameID %s", assertion.NameId)
+	}
+	ident, err := evalMappingRules(testRules(t), assertion.Attributes)
+	if err != nil {
+		t.Fatalf("evalMappingRules %s", err)
+	}
+	if ident.UserName != "alice" || !reflect.DeepEqual(ident.Groups, []string{"dev"}) || len(ident.Projects["dept-rd"]) != 1 {
+		t.Errorf("unexpected identity %#v", ident)
+	}
+}
+
+func TestOIDCClientCache(t *testing.T) {
+	idp, err := oidcutils.NewMockProvider("keystone", "secret", nil)
+	if err != nil {
+		t.Fatalf("NewMockProvider %s", err)
+	}
+	defer idp.Close()
+
+	newDriver := func(domainId string, clientId string) *SOIDCDriver {
+		return &SOIDCDriver{
+			SFederatedDomainDriver: SFederatedDomainDriver{
+				SBaseDomainDriver: SBaseDomainDriver{domainId: domainId},
+			},
+			oidcConfig: &api.SDomainOIDCConfigOptions{
+				Issuer:      idp.Issuer(),
+				ClientId:    clientId,
+				RedirectUri: "https://keystone/callback",
+			},
+		}
+	}
+	ctx := context.Background()
+	cli, err := newDriver("d0", "keystone").getClient(ctx)
+	if err != nil {
+		t.Fatalf("getClient %s", err)
+	}
+	cli2, err := newDriver("d0", "keystone").getClient(ctx)
+	if err != nil {
+		t.Fatalf("getClient %s", err)
+	}
+	if cli != cli2 {
+		t.Errorf("client of the same config not cached")
+	}
+	cli3, err := newDriver("d0", "other").getClient(ctx)
+	if err != nil {
+		t.Fatalf("getClient %s", err)
+	}
+	if cli3 == cli {
+		t.Errorf("cached client of a changed config reused")
+	}
+	cli4, err := newDriver("d1", "other").getClient(ctx)
+	if err != nil {
+		t.Fatalf("getClient %s", err)
+	}
+	if cli4 == cli3 {
+		t.Errorf("cached client of another domain reused")
+	}
+}
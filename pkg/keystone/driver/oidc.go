@@ -0,0 +1,157 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package driver
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
+)
+
+type SOIDCDriver struct {
+	SFederatedDomainDriver
+	oidcConfig *api.SDomainOIDCConfigOptions
+}
+
+func NewOIDCDriver(domainId string, conf models.TDomainConfigs) (IIdentityBackend, error) {
+	base, err := NewFederatedDomainDriver(domainId, conf, api.IdentityDriverOIDC)
+	if err != nil {
+		return nil, errors.WithMessage(err, "NewFederatedDomainDriver")
+	}
+	drv := SOIDCDriver{
+		SFederatedDomainDriver: base,
+	}
+	drv.virtual = &drv
+	err = drv.prepareConfig()
+	if err != nil {
+		return nil, errors.WithMessage(err, "prepareConfig")
+	}
+	return &drv, nil
+}
+
+func (self *SOIDCDriver) prepareConfig() error {
+	if self.oidcConfig == nil {
+		conf := api.SDomainOIDCConfigOptions{}
+		confJson := jsonutils.Marshal(self.config[api.IdentityDriverOIDC])
+		err := confJson.Unmarshal(&conf)
+		if err != nil {
+			return errors.WithMessage(err, "json.Unmarshal")
+		}
+		if len(conf.Issuer) == 0 || len(conf.ClientId) == 0 || len(conf.RedirectUri) == 0 {
+			return errors.New("issuer, client_id and redirect_uri are required")
+		}
+		if len(conf.UserIdClaim) == 0 {
+			conf.UserIdClaim = "sub"
+		}
+		if len(conf.UserNameClaim) == 0 {
+			conf.UserNameClaim = "preferred_username"
+		}
+		self.oidcConfig = &conf
+	}
+	return nil
+}
+
+func (self *SOIDCDriver) AuthMethod() string {
+	return api.AUTH_METHOD_OPENID
+}
+
+// the provider configuration is fetched again after oidcClientCacheTTL
+const oidcClientCacheTTL = time.Hour
+
+type sOIDCClientCache struct {
+	config    string
+	client    *oidcutils.SOIDCClient
+	fetchedAt time.Time
+}
+
+var (
+	// drivers are created for each request, clients are cached per domain
+	// to save the discovery and keys requests to the provider
+	oidcClients     = make(map[string]*sOIDCClientCache)
+	oidcClientsLock sync.Mutex
+)
+
+func (self *SOIDCDriver) getClient(ctx context.Context) (*oidcutils.SOIDCClient, error) {
+	config := jsonutils.Marshal(self.oidcConfig).String()
+	oidcClientsLock.Lock()
+	cache, ok := oidcClients[self.domainId]
+	oidcClientsLock.Unlock()
+	if ok && cache.config == config && time.Since(cache.fetchedAt) < oidcClientCacheTTL {
+		return cache.client, nil
+	}
+
+	cli := oidcutils.NewOIDCClient(
+		self.oidcConfig.ClientId,
+		self.oidcConfig.ClientSecret,
+		self.oidcConfig.RedirectUri,
+		self.oidcConfig.Scopes,
+		nil,
+	)
+	err := cli.FetchConfiguration(ctx, self.oidcConfig.Issuer)
+	if err != nil {
+		return nil, errors.WithMessage(err, "FetchConfiguration")
+	}
+	oidcClientsLock.Lock()
+	oidcClients[self.domainId] = &sOIDCClientCache{
+		config:    config,
+		client:    cli,
+		fetchedAt: time.Now(),
+	}
+	oidcClientsLock.Unlock()
+	return cli, nil
+}
+
+func (self *SOIDCDriver) GetSSORedirectUri(ctx context.Context, nonce string, state string) (string, error) {
+	cli, err := self.getClient(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "getClient")
+	}
+	return cli.AuthCodeUrl(state, nonce), nil
+}
+
+func (self *SOIDCDriver) AuthenticateSSO(ctx context.Context, nonce string, params url.Values) (*models.SUserExtended, error) {
+	if errCode := params.Get("error"); len(errCode) > 0 {
+		return nil, errors.Errorf("provider error %s: %s", errCode, params.Get("error_description"))
+	}
+	code := params.Get("code")
+	if len(code) == 0 {
+		return nil, errors.New("missing authorization code")
+	}
+	cli, err := self.getClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getClient")
+	}
+	claims, err := cli.Authenticate(ctx, code, nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "Authenticate")
+	}
+	attrs := claims2Attributes(claims)
+	info := SFederatedUserInfo{
+		UniqueId:   firstValue(attrs, self.oidcConfig.UserIdClaim),
+		Attributes: attrs,
+	}
+	if len(info.UniqueId) == 0 {
+		return nil, errors.Errorf("missing claim %s", self.oidcConfig.UserIdClaim)
+	}
+	return self.syncFederatedUser(ctx, self.oidcConfig.Issuer, self.oidcConfig.UserNameClaim, info)
+}
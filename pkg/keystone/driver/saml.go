@@ -0,0 +1,91 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package driver
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+	"yunion.io/x/onecloud/pkg/util/samlutils"
+)
+
+type SSAMLDriver struct {
+	SFederatedDomainDriver
+	samlConfig *api.SDomainSAMLConfigOptions
+	sp         *samlutils.SServiceProvider
+}
+
+func NewSAMLDriver(domainId string, conf models.TDomainConfigs) (IIdentityBackend, error) {
+	base, err := NewFederatedDomainDriver(domainId, conf, api.IdentityDriverSAML)
+	if err != nil {
+		return nil, errors.WithMessage(err, "NewFederatedDomainDriver")
+	}
+	drv := SSAMLDriver{
+		SFederatedDomainDriver: base,
+	}
+	drv.virtual = &drv
+	err = drv.prepareConfig()
+	if err != nil {
+		return nil, errors.WithMessage(err, "prepareConfig")
+	}
+	return &drv, nil
+}
+
+func (self *SSAMLDriver) prepareConfig() error {
+	if self.samlConfig == nil {
+		conf := api.SDomainSAMLConfigOptions{}
+		confJson := jsonutils.Marshal(self.config[api.IdentityDriverSAML])
+		err := confJson.Unmarshal(&conf)
+		if err != nil {
+			return errors.WithMessage(err, "json.Unmarshal")
+		}
+		sp, err := samlutils.NewServiceProvider(conf.EntityId, conf.AcsUrl, conf.IdpEntityId, conf.IdpSsoUrl, conf.IdpCertificate)
+		if err != nil {
+			return errors.WithMessage(err, "NewServiceProvider")
+		}
+		self.samlConfig = &conf
+		self.sp = sp
+	}
+	return nil
+}
+
+func (self *SSAMLDriver) AuthMethod() string {
+	return api.AUTH_METHOD_SAML2
+}
+
+func (self *SSAMLDriver) GetSSORedirectUri(ctx context.Context, nonce string, state string) (string, error) {
+	return self.sp.AuthnRequestUrl(nonce, state)
+}
+
+func (self *SSAMLDriver) AuthenticateSSO(ctx context.Context, nonce string, params url.Values) (*models.SUserExtended, error) {
+	samlResp := params.Get("SAMLResponse")
+	if len(samlResp) == 0 {
+		return nil, errors.New("missing SAMLResponse")
+	}
+	assertion, err := self.sp.ParseResponse(samlResp, nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseResponse")
+	}
+	info := SFederatedUserInfo{
+		UniqueId:   assertion.NameId,
+		Attributes: assertion.Attributes,
+	}
+	return self.syncFederatedUser(ctx, self.samlConfig.IdpEntityId, self.samlConfig.UserNameAttribute, info)
+}
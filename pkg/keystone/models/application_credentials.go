@@ -0,0 +1,303 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/seclib2"
+)
+
+type SApplicationCredentialManager struct {
+	db.SStandaloneResourceBaseManager
+}
+
+var ApplicationCredentialManager *SApplicationCredentialManager
+
+func init() {
+	ApplicationCredentialManager = &SApplicationCredentialManager{
+		SStandaloneResourceBaseManager: db.NewStandaloneResourceBaseManager(
+			SApplicationCredential{},
+			"application_credential",
+			"application_credential",
+			"application_credentials",
+		),
+	}
+}
+
+/*
+ Application credential
+
+ A secret owned by a user, bound to the project of the token that created
+ it, so that automation can authenticate without the password of the user.
+ Only the bcrypt hash of the secret is kept, the secret itself is shown once
+ at creation. Roles is a snapshot of the role ids granted to the tokens,
+ always intersected with the current roles of the user, and AccessRules
+ limit the services and methods the tokens may call.
+*/
+
+type SApplicationCredential struct {
+	db.SStandaloneResourceBase
+
+	UserId      string               `width:"64" charset:"ascii" nullable:"false" index:"true" list:"user"`
+	ProjectId   string               `width:"64" charset:"ascii" nullable:"false" list:"user"`
+	SecretHash  string               `width:"64" charset:"ascii" nullable:"false"`
+	ExpiresAt   time.Time            `nullable:"true" list:"user" create:"optional"`
+	Roles       *jsonutils.JSONArray `nullable:"true" list:"user"`
+	AccessRules *jsonutils.JSONArray `nullable:"true" list:"user"`
+
+	// plain secret, only known right after creation
+	secret string
+}
+
+func (manager *SApplicationCredentialManager) GetOwnerId(userCred mcclient.IIdentityProvider) string {
+	return userCred.GetUserId()
+}
+
+func (manager *SApplicationCredentialManager) FilterByOwner(q *sqlchemy.SQuery, owner string) *sqlchemy.SQuery {
+	if len(owner) > 0 {
+		q = q.Equals("user_id", owner)
+	}
+	return q
+}
+
+func (self *SApplicationCredential) GetOwnerProjectId() string {
+	return self.UserId
+}
+
+func (manager *SApplicationCredentialManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	if utils.IsInStringArray(api.AUTH_METHOD_APPCRED, userCred.GetAuthMethods()) {
+		return nil, httperrors.NewForbiddenError("application credential cannot create application credential")
+	}
+	if len(userCred.GetProjectId()) == 0 {
+		return nil, httperrors.NewInputParameterError("a project scoped token is required")
+	}
+	userRoles, err := AssignmentManager.FetchUserProjectRoles(userCred.GetUserId(), userCred.GetProjectId())
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	roleIds := make([]string, 0)
+	roles := jsonutils.GetQueryStringArray(data, "roles")
+	for _, role := range roles {
+		roleId := ""
+		for i := range userRoles {
+			if userRoles[i].Id == role || userRoles[i].Name == role {
+				roleId = userRoles[i].Id
+				break
+			}
+		}
+		if len(roleId) == 0 {
+			return nil, httperrors.NewForbiddenError("role %s not assigned to user in project", role)
+		}
+		if !utils.IsInStringArray(roleId, roleIds) {
+			roleIds = append(roleIds, roleId)
+		}
+	}
+	if len(roles) == 0 {
+		for i := range userRoles {
+			roleIds = append(roleIds, userRoles[i].Id)
+		}
+	}
+	if len(roleIds) == 0 {
+		return nil, httperrors.NewForbiddenError("user has no role in project")
+	}
+	data.Set("roles", jsonutils.NewStringArray(roleIds))
+
+	if data.Contains("expires_at") {
+		expiresAt, err := data.GetTime("expires_at")
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid expires_at: %s", err)
+		}
+		if !expiresAt.After(time.Now()) {
+			return nil, httperrors.NewInputParameterError("expires_at must be in the future")
+		}
+		data.Set("expires_at", jsonutils.NewTimeString(expiresAt))
+	}
+
+	if data.Contains("access_rules") {
+		rules := make([]api.SAccessRule, 0)
+		err := data.Unmarshal(&rules, "access_rules")
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid access_rules: %s", err)
+		}
+		for i := range rules {
+			err = validateAccessRule(&rules[i])
+			if err != nil {
+				return nil, err
+			}
+		}
+		data.Set("access_rules", jsonutils.Marshal(rules))
+	}
+
+	return manager.SStandaloneResourceBaseManager.ValidateCreateData(ctx, userCred, ownerProjId, query, data)
+}
+
+func validateAccessRule(rule *api.SAccessRule) error {
+	if len(rule.Service) == 0 {
+		return httperrors.NewInputParameterError("access rule without service")
+	}
+	rule.Method = strings.ToUpper(rule.Method)
+	switch rule.Method {
+	case "", api.AccessRuleAny, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return nil
+	default:
+		return httperrors.NewInputParameterError("invalid access rule method %s", rule.Method)
+	}
+}
+
+func generateApplicationCredentialSecret() (string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (self *SApplicationCredential) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	secret, _ := data.GetString("secret")
+	if len(secret) == 0 {
+		var err error
+		secret, err = generateApplicationCredentialSecret()
+		if err != nil {
+			return errors.WithMessage(err, "generateApplicationCredentialSecret")
+		}
+	}
+	hash, err := seclib2.BcryptPassword(secret)
+	if err != nil {
+		return errors.WithMessage(err, "seclib2.BcryptPassword")
+	}
+	self.UserId = userCred.GetUserId()
+	self.ProjectId = userCred.GetProjectId()
+	self.SecretHash = hash
+	self.secret = secret
+	if roles, _ := data.GetArray("roles"); len(roles) > 0 {
+		self.Roles = jsonutils.NewArray(roles...)
+	}
+	if rules, _ := data.GetArray("access_rules"); len(rules) > 0 {
+		self.AccessRules = jsonutils.NewArray(rules...)
+	}
+	return self.SStandaloneResourceBase.CustomizeCreate(ctx, userCred, ownerProjId, query, data)
+}
+
+func (self *SApplicationCredential) GetExtraDetails(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*jsonutils.JSONDict, error) {
+	extra, err := self.SStandaloneResourceBase.GetExtraDetails(ctx, userCred, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(self.secret) > 0 {
+		extra.Add(jsonutils.NewString(self.secret), "secret")
+	}
+	return extra, nil
+}
+
+func (self *SApplicationCredential) IsExpired() bool {
+	return !self.ExpiresAt.IsZero() && self.ExpiresAt.Before(time.Now())
+}
+
+func (self *SApplicationCredential) GetRoleIds() []string {
+	if self.Roles == nil {
+		return nil
+	}
+	return self.Roles.GetStringArray()
+}
+
+func (self *SApplicationCredential) GetAccessRules() []api.SAccessRule {
+	rules := make([]api.SAccessRule, 0)
+	if self.AccessRules != nil {
+		err := self.AccessRules.Unmarshal(&rules)
+		if err != nil {
+			log.Errorf("unmarshal access rules of %s fail %s", self.Id, err)
+		}
+	}
+	return rules
+}
+
+func (self *SApplicationCredential) VerifySecret(secret string) error {
+	return seclib2.BcryptVerifyPassword(secret, self.SecretHash)
+}
+
+// FilterRoles keeps the roles granted to the credential out of the current
+// roles of its user
+func (self *SApplicationCredential) FilterRoles(roles []SRole) []SRole {
+	roleIds := self.GetRoleIds()
+	ret := make([]SRole, 0, len(roles))
+	for i := range roles {
+		if utils.IsInStringArray(roles[i].Id, roleIds) {
+			ret = append(ret, roles[i])
+		}
+	}
+	return ret
+}
+
+func (manager *SApplicationCredentialManager) FetchApplicationCredential(id string) (*SApplicationCredential, error) {
+	obj, err := manager.FetchById(id)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*SApplicationCredential), nil
+}
+
+// FetchApplicationCredentialByName looks up a credential by id, or by name
+// among the credentials of a user
+func (manager *SApplicationCredentialManager) FetchApplicationCredentialByName(id string, name string, userId string) (*SApplicationCredential, error) {
+	if len(id) > 0 {
+		return manager.FetchApplicationCredential(id)
+	}
+	if len(name) == 0 || len(userId) == 0 {
+		return nil, httperrors.NewInputParameterError("missing application credential id or name and user")
+	}
+	q := manager.Query().Equals("name", name).Equals("user_id", userId)
+	cred := SApplicationCredential{}
+	cred.SetModelManager(manager)
+	err := q.First(&cred)
+	if err != nil {
+		return nil, err
+	}
+	return &cred, nil
+}
+
+func (manager *SApplicationCredentialManager) deleteByUser(userId string) error {
+	q := manager.Query().Equals("user_id", userId)
+	creds := make([]SApplicationCredential, 0)
+	err := db.FetchModelObjects(manager, q, &creds)
+	if err != nil {
+		return errors.WithMessage(err, "FetchModelObjects")
+	}
+	for i := range creds {
+		_, err = db.Update(&creds[i], func() error {
+			return creds[i].MarkDelete()
+		})
+		if err != nil {
+			return errors.WithMessage(err, "MarkDelete")
+		}
+	}
+	return nil
+}
@@ -251,6 +251,7 @@ func (manager *SAssignmentManager) projectAddUser(ctx context.Context, userCred
 func (manager *SAssignmentManager) projectRemoveUser(ctx context.Context, userCred mcclient.TokenCredential, project *SProject, user *SUser, role *SRole) error {
 	err := manager.remove(api.AssignmentUserProject, user.Id, project.Id, role.Id)
 	if err == nil {
+		RevocationEventManager.RevokeAssignment(user.Id, project.Id, role.Id)
 		db.OpsLog.LogEvent(user, db.ACT_DETACH, project.GetShortDesc(ctx), userCred)
 		db.OpsLog.LogEvent(project, db.ACT_DETACH, user.GetShortDesc(ctx), userCred)
 	}
@@ -269,6 +270,9 @@ func (manager *SAssignmentManager) projectAddGroup(ctx context.Context, userCred
 func (manager *SAssignmentManager) projectRemoveGroup(ctx context.Context, userCred mcclient.TokenCredential, project *SProject, group *SGroup, role *SRole) error {
 	err := manager.remove(api.AssignmentGroupProject, group.Id, project.Id, role.Id)
 	if err == nil {
+		for _, userId := range UsergroupManager.getGroupUserIds(group.Id) {
+			RevocationEventManager.RevokeAssignment(userId, project.Id, role.Id)
+		}
 		db.OpsLog.LogEvent(group, db.ACT_DETACH, project.GetShortDesc(ctx), userCred)
 		db.OpsLog.LogEvent(project, db.ACT_DETACH, group.GetShortDesc(ctx), userCred)
 	}
@@ -15,10 +15,13 @@
 package models
 
 import (
-	"yunion.io/x/jsonutils"
-
 	"context"
 	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/keystone/keys"
@@ -135,8 +138,7 @@ func (self *SCredential) GetExtraDetails(ctx context.Context, userCred mcclient.
 }
 
 func credentialExtra(cred *SCredential, extra *jsonutils.JSONDict) *jsonutils.JSONDict {
-	blob := keys.CredentialKeyManager.Decrypt([]byte(cred.EncryptedBlob), time.Duration(-1))
-	extra.Add(jsonutils.NewString(string(blob)), "blob")
+	extra.Add(jsonutils.NewString(cred.getBlob()), "blob")
 
 	usr, _ := UserManager.FetchUserExtended(cred.UserId, "", "", "")
 	if usr != nil {
@@ -146,3 +148,66 @@ func credentialExtra(cred *SCredential, extra *jsonutils.JSONDict) *jsonutils.JS
 	}
 	return extra
 }
+
+func (manager *SCredentialManager) fetchCredentials(userId string, credType string) ([]SCredential, error) {
+	q := manager.Query().Equals("user_id", userId).Equals("type", credType)
+	creds := make([]SCredential, 0)
+	err := db.FetchModelObjects(manager, q, &creds)
+	if err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (manager *SCredentialManager) saveCredential(userId string, credType string, blob string, extra *jsonutils.JSONDict) (*SCredential, error) {
+	blobEnc, err := keys.CredentialKeyManager.Encrypt([]byte(blob))
+	if err != nil {
+		return nil, errors.WithMessage(err, "Encrypt")
+	}
+	cred := SCredential{}
+	cred.SetModelManager(manager)
+	cred.Name = credType
+	cred.UserId = userId
+	cred.Type = credType
+	cred.Extra = extra
+	cred.EncryptedBlob = string(blobEnc)
+	cred.KeyHash = keys.CredentialKeyManager.PrimaryKeyHash()
+	err = manager.TableSpec().Insert(&cred)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Insert")
+	}
+	return &cred, nil
+}
+
+func (manager *SCredentialManager) deleteCredentials(userId string, credType string) error {
+	creds, err := manager.fetchCredentials(userId, credType)
+	if err != nil {
+		return errors.WithMessage(err, "fetchCredentials")
+	}
+	for i := range creds {
+		_, err = db.Update(&creds[i], func() error {
+			return creds[i].MarkDelete()
+		})
+		if err != nil {
+			return errors.WithMessage(err, "MarkDelete")
+		}
+	}
+	return nil
+}
+
+func (self *SCredential) getBlob() string {
+	return string(keys.CredentialKeyManager.Decrypt([]byte(self.EncryptedBlob), time.Duration(-1)))
+}
+
+func (self *SCredential) setBlob(blob string) error {
+	blobEnc, err := keys.CredentialKeyManager.Encrypt([]byte(blob))
+	if err != nil {
+		return errors.WithMessage(err, "Encrypt")
+	}
+	_, err = db.Update(self, func() error {
+		self.EncryptedBlob = string(blobEnc)
+		self.KeyHash = keys.CredentialKeyManager.PrimaryKeyHash()
+		return nil
+	})
+	return err
+}
@@ -234,6 +234,20 @@ func (domain *SDomain) ValidateDeleteCondition(ctx context.Context) error {
 	return domain.SEnabledIdentityBaseResource.ValidateDeleteCondition(ctx)
 }
 
+func (domain *SDomain) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	domain.SEnabledIdentityBaseResource.PostUpdate(ctx, userCred, query, data)
+
+	if data.Contains("enabled") && domain.Enabled.IsFalse() {
+		RevocationEventManager.RevokeDomain(domain.Id)
+	}
+}
+
+func (domain *SDomain) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
+	domain.SEnabledIdentityBaseResource.PostDelete(ctx, userCred)
+
+	RevocationEventManager.RevokeDomain(domain.Id)
+}
+
 func (domain *SDomain) GetDriver() string {
 	drv, _ := domain.getDriver()
 	return drv
@@ -250,6 +264,21 @@ func (domain *SDomain) getDriver() (string, error) {
 	return api.IdentityDriverSQL, nil
 }
 
+// IsMfaRequired tells whether every user of the domain must log in with
+// a second factor, set by config security_compliance.mfa_required
+func (domain *SDomain) IsMfaRequired() bool {
+	opts, err := WhitelistedConfigManager.fetchConfigs(domain.Id, []string{api.DomainConfigSecurityGroup}, []string{api.DomainConfigOptionMfaRequired})
+	if err != nil {
+		log.Errorf("fetch domain %s mfa config fail %s", domain.Id, err)
+		return false
+	}
+	if len(opts) == 1 {
+		required, _ := opts[0].Value.Bool()
+		return required
+	}
+	return false
+}
+
 func (domain *SDomain) IsReadOnly() bool {
 	if domain.GetDriver() == api.IdentityDriverSQL {
 		return false
@@ -295,6 +324,32 @@ func (domain *SDomain) UpdateConfig(ctx context.Context, userCred mcclient.Token
 	if err != nil {
 		return nil, httperrors.NewInputParameterError("invalid input data")
 	}
+	if grpConf, ok := opts[api.DomainConfigSecurityGroup]; ok {
+		policy := api.SDomainSecurityComplianceOptions{}
+		err = jsonutils.Marshal(grpConf).Unmarshal(&policy)
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("invalid %s config: %s", api.DomainConfigSecurityGroup, err)
+		}
+		err = validateSecurityCompliance(policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// sensitive options are never shown, so keep them unless given anew or
+	// their group is dropped
+	oldSensitive, err := SensitiveConfigManager.fetchConfigs(domain.Id, nil, nil)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	for i := range oldSensitive {
+		grpConf, ok := opts[oldSensitive[i].Group]
+		if !ok {
+			continue
+		}
+		if _, ok := grpConf[oldSensitive[i].Option]; !ok {
+			grpConf[oldSensitive[i].Option] = oldSensitive[i].Value
+		}
+	}
 	whiteListedOpts, sensitiveOpts := opts.getConfigOptions(domain.Id, api.SensitiveDomainConfigMap)
 	err = WhitelistedConfigManager.syncConfig(ctx, userCred, domain.Id, whiteListedOpts)
 	if err != nil {
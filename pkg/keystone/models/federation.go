@@ -0,0 +1,195 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+// RegisterIdp records the identity provider a domain federates with over
+// protocol, remoteId being the issuer or entity ID of the provider. The
+// mapping rules of the protocol are kept in the domain config, so the
+// mapping ID refers to the domain.
+func (manager *SIdentityProviderManager) RegisterIdp(ctx context.Context, domainId string, protocol string, remoteId string) (*SIdentityProvider, error) {
+	lockman.LockClass(ctx, manager, domainId)
+	defer lockman.ReleaseClass(ctx, manager, domainId)
+
+	idp := SIdentityProvider{}
+	idp.SetModelManager(manager)
+	q := manager.Query().Equals("domain_id", domainId).Equals("name", protocol)
+	err := q.First(&idp)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.WithMessage(err, "Query")
+	}
+	if err == sql.ErrNoRows {
+		idp.Name = protocol
+		idp.DomainId = domainId
+		idp.Enabled = tristate.True
+		idp.Description = fmt.Sprintf("%s identity provider %s", protocol, remoteId)
+		err = manager.TableSpec().Insert(&idp)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Insert")
+		}
+	}
+
+	remote := SIdpRemoteIds{
+		IdpId:    idp.Id,
+		RemoteId: remoteId,
+	}
+	remote.SetModelManager(IdpRemoteIdsManager)
+	err = IdpRemoteIdsManager.TableSpec().InsertOrUpdate(&remote)
+	if err != nil {
+		return nil, errors.WithMessage(err, "IdpRemoteIdsManager.InsertOrUpdate")
+	}
+
+	proto := SFederationProtocol{
+		Id:        protocol,
+		IdpId:     idp.Id,
+		MappingId: domainId,
+	}
+	proto.SetModelManager(FederationProtocolManager)
+	err = FederationProtocolManager.TableSpec().InsertOrUpdate(&proto)
+	if err != nil {
+		return nil, errors.WithMessage(err, "FederationProtocolManager.InsertOrUpdate")
+	}
+	return &idp, nil
+}
+
+var (
+	ErrFederatedUserConflict = errors.New("federated identity conflicts with an existing user")
+)
+
+// FetchUserId returns the user linked to the unique ID at the identity
+// provider, or empty if not linked yet
+func (manager *SFederatedUserManager) FetchUserId(idpId string, protocol string, uniqueId string) (string, error) {
+	fedUser := SFederatedUser{}
+	fedUser.SetModelManager(manager)
+	q := manager.Query().Equals("idp_id", idpId).Equals("protocol_id", protocol).Equals("unique_id", uniqueId)
+	err := q.First(&fedUser)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.WithMessage(err, "Query")
+	}
+	return fedUser.UserId, nil
+}
+
+// Register links a user to its unique ID at the identity provider. A link
+// is never moved to another user, and a user is linked to at most one
+// unique ID of the provider, so that an identity asserting the name of an
+// existing user cannot take over the account
+func (manager *SFederatedUserManager) Register(ctx context.Context, userId string, idpId string, protocol string, uniqueId string, displayName string) error {
+	key := fmt.Sprintf("%s-%s", idpId, protocol)
+	lockman.LockRawObject(ctx, manager.Keyword(), key)
+	defer lockman.ReleaseRawObject(ctx, manager.Keyword(), key)
+
+	fedUsers := make([]SFederatedUser, 0)
+	q := manager.Query().Equals("idp_id", idpId).Equals("protocol_id", protocol)
+	q = q.Filter(sqlchemy.OR(
+		sqlchemy.Equals(q.Field("unique_id"), uniqueId),
+		sqlchemy.Equals(q.Field("user_id"), userId),
+	))
+	err := db.FetchModelObjects(manager, q, &fedUsers)
+	if err != nil {
+		return errors.WithMessage(err, "FetchModelObjects")
+	}
+	for i := range fedUsers {
+		if fedUsers[i].UserId != userId || fedUsers[i].UniqueId != uniqueId {
+			return errors.Wrapf(ErrFederatedUserConflict, "%s is linked to %s", fedUsers[i].UniqueId, fedUsers[i].UserId)
+		}
+	}
+	if len(fedUsers) > 0 {
+		fedUser := &fedUsers[0]
+		if fedUser.DisplayName == displayName {
+			return nil
+		}
+		_, err = db.Update(fedUser, func() error {
+			fedUser.DisplayName = displayName
+			return nil
+		})
+		if err != nil {
+			return errors.WithMessage(err, "Update")
+		}
+		return nil
+	}
+	fedUser := SFederatedUser{}
+	fedUser.SetModelManager(manager)
+	fedUser.UserId = userId
+	fedUser.IdpId = idpId
+	fedUser.ProtocolId = protocol
+	fedUser.UniqueId = uniqueId
+	fedUser.DisplayName = displayName
+	err = manager.TableSpec().Insert(&fedUser)
+	if err != nil {
+		return errors.WithMessage(err, "Insert")
+	}
+	return nil
+}
+
+// AddFederatedUserProjectRoles grants the roles mapped to a federated user
+// on projects of its domain. Roles granted otherwise are left untouched and
+// projects or roles that do not exist are skipped.
+func (manager *SAssignmentManager) AddFederatedUserProjectRoles(ctx context.Context, userCred mcclient.TokenCredential, userId string, domainId string, projectRoles map[string][]string) error {
+	user := UserManager.fetchUserById(userId)
+	if user == nil {
+		return errors.Wrap(sql.ErrNoRows, "fetchUserById")
+	}
+	for projName, roleNames := range projectRoles {
+		project, err := ProjectManager.FetchProjectByName(projName, domainId, "")
+		if err != nil {
+			log.Errorf("federated user %s: project %s: %s", user.Name, projName, err)
+			continue
+		}
+		roles, err := manager.FetchUserProjectRoles(user.Id, project.Id)
+		if err != nil {
+			return errors.WithMessage(err, "FetchUserProjectRoles")
+		}
+		for _, roleName := range roleNames {
+			role, err := RoleManager.FetchRoleByName(roleName, api.DEFAULT_DOMAIN_ID, "")
+			if err != nil {
+				log.Errorf("federated user %s: role %s: %s", user.Name, roleName, err)
+				continue
+			}
+			granted := false
+			for i := range roles {
+				if roles[i].Id == role.Id {
+					granted = true
+					break
+				}
+			}
+			if granted {
+				continue
+			}
+			err = manager.projectAddUser(ctx, userCred, project, user, role)
+			if err != nil {
+				return errors.WithMessage(err, "projectAddUser")
+			}
+		}
+	}
+	return nil
+}
@@ -73,6 +73,34 @@ func (user *SLocalUser) GetName() string {
 	return user.Name
 }
 
+func (manager *SLocalUserManager) fetchById(localId int) (*SLocalUser, error) {
+	localUser := SLocalUser{}
+	localUser.SetModelManager(manager)
+
+	q := manager.Query().Equals("id", localId)
+	err := q.First(&localUser)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Query")
+	}
+	return &localUser, nil
+}
+
+// fetchLocalUser returns nil if the user is not a local user
+func (manager *SLocalUserManager) fetchLocalUser(userId string, domainId string) (*SLocalUser, error) {
+	localUser := SLocalUser{}
+	localUser.SetModelManager(manager)
+
+	q := manager.Query().Equals("user_id", userId).Equals("domain_id", domainId)
+	err := q.First(&localUser)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "Query")
+	}
+	return &localUser, nil
+}
+
 func (manager *SLocalUserManager) register(userId string, domainId string, name string) (*SLocalUser, error) {
 	localUser := SLocalUser{}
 	localUser.SetModelManager(manager)
@@ -96,3 +96,17 @@ func (manager *SNonlocalUserManager) Register(ctx context.Context, domainId stri
 
 	return nonlocalUser, nil
 }
+
+// FetchByUserId returns the nonlocal user of userId, or nil if not exist
+func (manager *SNonlocalUserManager) FetchByUserId(userId string) (*SNonlocalUser, error) {
+	nonlocalUser := SNonlocalUser{}
+	nonlocalUser.SetModelManager(manager)
+	err := manager.Query().Equals("user_id", userId).First(&nonlocalUser)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.WithMessage(err, "Query")
+	}
+	return &nonlocalUser, nil
+}
@@ -0,0 +1,369 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/seclib2"
+)
+
+var (
+	ErrInvalidPassword = errors.New("invalid password")
+	ErrPasswordExpired = errors.New("password expired, change it before login")
+	ErrUserLocked      = errors.New("user is locked due to too many failed logins")
+
+	// ErrInvalidUserOrPassword is all unauthenticated callers learn of a
+	// failed password check, so that they cannot tell which users exist
+	ErrInvalidUserOrPassword = errors.New("invalid user or password")
+)
+
+// fetchSecurityCompliance loads the password and lockout policies of a
+// domain from config group security_compliance
+func fetchSecurityCompliance(domainId string) api.SDomainSecurityComplianceOptions {
+	policy := api.SDomainSecurityComplianceOptions{}
+	opts, err := WhitelistedConfigManager.fetchConfigs(domainId, []string{api.DomainConfigSecurityGroup}, nil)
+	if err != nil {
+		log.Errorf("fetch domain %s security compliance config fail %s", domainId, err)
+		return policy
+	}
+	conf := config2map(opts)
+	if grpConf, ok := conf[api.DomainConfigSecurityGroup]; ok {
+		err = jsonutils.Marshal(grpConf).Unmarshal(&policy)
+		if err != nil {
+			log.Errorf("invalid security compliance config of domain %s: %s", domainId, err)
+		}
+	}
+	return policy
+}
+
+func validateSecurityCompliance(policy api.SDomainSecurityComplianceOptions) error {
+	if policy.PasswordMinimalLength < 0 || policy.UniqueLastPasswordCount < 0 || policy.PasswordExpiresDays < 0 {
+		return httperrors.NewInputParameterError("password policy values must not be negative")
+	}
+	if policy.PasswordMinimalCharClasses < 0 || policy.PasswordMinimalCharClasses > 4 {
+		return httperrors.NewInputParameterError("password_minimal_char_classes must be between 0 and 4")
+	}
+	if policy.LockoutFailureAttempts < 0 || policy.LockoutDuration < 0 {
+		return httperrors.NewInputParameterError("lockout values must not be negative")
+	}
+	if len(policy.PasswordRegex) > 0 {
+		_, err := regexp.Compile(policy.PasswordRegex)
+		if err != nil {
+			return httperrors.NewInputParameterError("invalid password_regex: %s", err)
+		}
+	}
+	return nil
+}
+
+// validatePassword checks a new password against the complexity policies
+// of the domain and, for an existing local user, against its recent passwords
+func validatePassword(domainId string, localUserId int, passwd string) error {
+	policy := fetchSecurityCompliance(domainId)
+	recentHashes := make([]string, 0)
+	if localUserId > 0 && policy.UniqueLastPasswordCount > 0 {
+		passes, err := PasswordManager.fetchRecent(localUserId, policy.UniqueLastPasswordCount)
+		if err != nil {
+			return httperrors.NewGeneralError(err)
+		}
+		for i := range passes {
+			recentHashes = append(recentHashes, passes[i].PasswordHash)
+		}
+	}
+	return checkPasswordPolicy(policy, passwd, recentHashes)
+}
+
+// checkPasswordPolicy checks passwd against policy and the bcrypt hashes of
+// the recent passwords
+func checkPasswordPolicy(policy api.SDomainSecurityComplianceOptions, passwd string, recentHashes []string) error {
+	if policy.PasswordMinimalLength > 0 && len(passwd) < policy.PasswordMinimalLength {
+		return httperrors.NewInputParameterError("password must be at least %d characters", policy.PasswordMinimalLength)
+	}
+	if policy.PasswordMinimalCharClasses > 0 && seclib2.AnalyzePasswordStrenth(passwd).CharClasses() < policy.PasswordMinimalCharClasses {
+		return httperrors.NewInputParameterError("password must contain at least %d of digits, lowercases, uppercases and punctuations", policy.PasswordMinimalCharClasses)
+	}
+	if len(policy.PasswordRegex) > 0 {
+		re, err := regexp.Compile(policy.PasswordRegex)
+		if err != nil {
+			log.Errorf("invalid password_regex %s", err)
+		} else if !re.MatchString(passwd) {
+			desc := policy.PasswordRegexDescription
+			if len(desc) == 0 {
+				desc = fmt.Sprintf("password must match %s", policy.PasswordRegex)
+			}
+			return httperrors.NewInputParameterError("%s", desc)
+		}
+	}
+	if policy.UniqueLastPasswordCount > 0 {
+		for i := range recentHashes {
+			if i >= policy.UniqueLastPasswordCount {
+				break
+			}
+			if seclib2.BcryptVerifyPassword(passwd, recentHashes[i]) == nil {
+				return httperrors.NewInputParameterError("password must differ from the last %d passwords", policy.UniqueLastPasswordCount)
+			}
+		}
+	}
+	return nil
+}
+
+// passwordExpiresAt tells when a password set now expires. A password set
+// by an admin expires immediately if users have to change it upon first use
+func passwordExpiresAt(domainId string, selfService bool) time.Time {
+	policy := fetchSecurityCompliance(domainId)
+	if !selfService && policy.ChangePasswordUponFirstUse {
+		return time.Now()
+	}
+	if policy.PasswordExpiresDays > 0 {
+		return time.Now().Add(time.Duration(policy.PasswordExpiresDays) * 24 * time.Hour)
+	}
+	return time.Time{}
+}
+
+func (localUser *SLocalUser) isLocked(policy api.SDomainSecurityComplianceOptions) bool {
+	return localUser.isLockedAt(policy, time.Now())
+}
+
+func (localUser *SLocalUser) isLockedAt(policy api.SDomainSecurityComplianceOptions, now time.Time) bool {
+	if policy.LockoutFailureAttempts <= 0 || localUser.FailedAuthCount < policy.LockoutFailureAttempts {
+		return false
+	}
+	if policy.LockoutDuration > 0 && now.After(localUser.FailedAuthAt.Add(time.Duration(policy.LockoutDuration)*time.Second)) {
+		return false
+	}
+	return true
+}
+
+// countFailedAuth counts a failed login at now and tells whether the user
+// gets locked by it. The count restarts once a lockout has elapsed
+func (localUser *SLocalUser) countFailedAuth(policy api.SDomainSecurityComplianceOptions, now time.Time) bool {
+	if policy.LockoutFailureAttempts > 0 && localUser.FailedAuthCount >= policy.LockoutFailureAttempts {
+		localUser.FailedAuthCount = 0
+	}
+	localUser.FailedAuthCount += 1
+	localUser.FailedAuthAt = now.UTC()
+	return localUser.isLockedAt(policy, now)
+}
+
+// recordFailedAuth counts a failed login, of either factor, and tells
+// whether the user gets locked by it
+func (localUser *SLocalUser) recordFailedAuth(policy api.SDomainSecurityComplianceOptions) (bool, error) {
+	locked := false
+	_, err := db.Update(localUser, func() error {
+		locked = localUser.countFailedAuth(policy, time.Now())
+		return nil
+	})
+	if err != nil {
+		return false, errors.WithMessage(err, "Update")
+	}
+	return locked, nil
+}
+
+func (localUser *SLocalUser) clearFailedAuth() error {
+	if localUser.FailedAuthCount == 0 {
+		return nil
+	}
+	_, err := db.Update(localUser, func() error {
+		localUser.FailedAuthCount = 0
+		return nil
+	})
+	return err
+}
+
+// getUserCred stands for the user in the opslog of a login, when no token
+// is available yet
+func (user *SUserExtended) getUserCred() mcclient.TokenCredential {
+	token := mcclient.SSimpleToken{}
+	token.UserId = user.Id
+	token.User = user.Name
+	token.DomainId = user.DomainId
+	token.Domain = user.DomainName
+	return &token
+}
+
+func (user *SUserExtended) logEvent(action string, notes string) {
+	usr := UserManager.fetchUserById(user.Id)
+	if usr == nil {
+		return
+	}
+	db.OpsLog.LogEvent(usr, action, notes, user.getUserCred())
+}
+
+func (user *SUserExtended) logFailedAuth(localUser *SLocalUser, policy api.SDomainSecurityComplianceOptions, reason string) {
+	locked, err := localUser.recordFailedAuth(policy)
+	if err != nil {
+		log.Errorf("record failed auth of user %s fail %s", user.Id, err)
+	}
+	user.logEvent(db.ACT_AUTH_FAIL, fmt.Sprintf("%s, %d consecutive failures", reason, localUser.FailedAuthCount))
+	if locked {
+		user.logEvent(db.ACT_LOCK, fmt.Sprintf("%d consecutive failed logins", localUser.FailedAuthCount))
+	}
+}
+
+// recordFailedTotp counts a failed second factor of a local user like a
+// failed password, so that the lockout policy also bounds passcode guesses
+func (user *SUserExtended) recordFailedTotp() {
+	if !user.IsLocal {
+		return
+	}
+	localUser, err := LocalUserManager.fetchById(user.LocalId)
+	if err != nil {
+		log.Errorf("fetch local user of %s fail %s", user.Id, err)
+		return
+	}
+	user.logFailedAuth(localUser, fetchSecurityCompliance(user.DomainId), "invalid passcode")
+}
+
+// ClearFailedAuth restarts counting failed logins of a local user, once the
+// user passed all the factors required
+func (user *SUserExtended) ClearFailedAuth() {
+	if !user.IsLocal {
+		return
+	}
+	localUser, err := LocalUserManager.fetchById(user.LocalId)
+	if err == nil {
+		err = localUser.clearFailedAuth()
+	}
+	if err != nil {
+		log.Errorf("clear failed auth of user %s fail %s", user.Id, err)
+	}
+}
+
+// localUserVerifyPassword checks the password of a local user. Failed
+// logins are cleared by ClearFailedAuth after the second factor, if any
+func (user *SUserExtended) localUserVerifyPassword(passwd string) error {
+	localUser, err := LocalUserManager.fetchById(user.LocalId)
+	if err != nil {
+		return errors.WithMessage(err, "LocalUserManager.fetchById")
+	}
+	policy := fetchSecurityCompliance(user.DomainId)
+	if localUser.isLocked(policy) {
+		user.logEvent(db.ACT_AUTH_FAIL, "user locked")
+		return ErrUserLocked
+	}
+	pass, err := PasswordManager.fetchLatest(user.LocalId)
+	if err != nil {
+		return errors.WithMessage(err, "PasswordManager.fetchLatest")
+	}
+	if pass == nil || seclib2.BcryptVerifyPassword(passwd, pass.PasswordHash) != nil {
+		user.logFailedAuth(localUser, policy, "invalid password")
+		return ErrInvalidPassword
+	}
+	if pass.IsExpired() {
+		user.logEvent(db.ACT_AUTH_FAIL, "password expired")
+		return ErrPasswordExpired
+	}
+	return nil
+}
+
+// ChangePassword is the self service change of the password, which also
+// works when the current password has expired. Users required to use MFA
+// also prove the second factor with passcode, once they have enrolled
+func (user *SUserExtended) ChangePassword(ctx context.Context, origPasswd string, passwd string, passcode string) error {
+	if !user.IsLocal {
+		log.Errorf("change password of user %s: not managed locally", user.Id)
+		return httperrors.NewInvalidCredentialError("%s", ErrInvalidUserOrPassword)
+	}
+	err := user.localUserVerifyPassword(origPasswd)
+	if err != nil && err != ErrPasswordExpired {
+		log.Errorf("change password of user %s: %s", user.Id, err)
+		return httperrors.NewInvalidCredentialError("%s", ErrInvalidUserOrPassword)
+	}
+	if user.IsMfaRequired() && user.IsTotpEnabled() {
+		if len(passcode) == 0 {
+			return httperrors.NewInvalidCredentialError("totp passcode required")
+		}
+		err = user.VerifyTotp(ctx, passcode)
+		if err != nil {
+			return httperrors.NewInvalidCredentialError("%s", err)
+		}
+	}
+	user.ClearFailedAuth()
+	err = validatePassword(user.DomainId, user.LocalId, passwd)
+	if err != nil {
+		return err
+	}
+	usr := UserManager.fetchUserById(user.Id)
+	if usr == nil {
+		return httperrors.NewUserNotFoundError("user %s not found", user.Id)
+	}
+	return usr.setPassword(user.getUserCred(), user.LocalId, passwd, true)
+}
+
+func (user *SUser) setPassword(userCred mcclient.TokenCredential, localUserId int, passwd string, selfService bool) error {
+	expiresAt := passwordExpiresAt(user.DomainId, selfService)
+	err := PasswordManager.savePassword(localUserId, passwd, selfService, expiresAt)
+	if err != nil {
+		return errors.WithMessage(err, "savePassword")
+	}
+	notes := "reset by admin"
+	if selfService {
+		notes = "self service"
+	}
+	if !expiresAt.IsZero() {
+		notes = fmt.Sprintf("%s, expires at %s", notes, expiresAt.UTC().Format(time.RFC3339))
+	}
+	db.OpsLog.LogEvent(user, db.ACT_UPDATE_PASSWORD, notes, userCred)
+	RevocationEventManager.RevokeUser(user.Id)
+	return nil
+}
+
+func (user *SUser) AllowPerformUnlock(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return db.IsAdminAllowPerform(userCred, user, "unlock")
+}
+
+// PerformUnlock clears the failed logins of a user locked out by the
+// lockout policy
+func (user *SUser) PerformUnlock(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	localUser, err := LocalUserManager.fetchLocalUser(user.Id, user.DomainId)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	if localUser == nil {
+		return nil, httperrors.NewForbiddenError("user %s is not a local user", user.Name)
+	}
+	err = localUser.clearFailedAuth()
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	db.OpsLog.LogEvent(user, db.ACT_UNLOCK, "", userCred)
+	return nil, nil
+}
+
+// lockoutInfo returns whether the user is locked and when the password
+// in effect expires, for the details of a user
+func (user *SUser) lockoutInfo() (bool, time.Time) {
+	localUser, err := LocalUserManager.fetchLocalUser(user.Id, user.DomainId)
+	if err != nil || localUser == nil {
+		return false, time.Time{}
+	}
+	locked := localUser.isLocked(fetchSecurityCompliance(user.DomainId))
+	pass, _ := PasswordManager.fetchLatest(localUser.Id)
+	if pass == nil {
+		return locked, time.Time{}
+	}
+	return locked, pass.ExpiresAt
+}
@@ -0,0 +1,202 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"testing"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/util/seclib2"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	hash := func(passwd string) string {
+		h, err := seclib2.BcryptPassword(passwd)
+		if err != nil {
+			t.Fatalf("BcryptPassword %s", err)
+		}
+		return h
+	}
+	recentHashes := []string{hash("Recent-1"), hash("Recent-2"), hash("Recent-3")}
+	cases := []struct {
+		name   string
+		policy api.SDomainSecurityComplianceOptions
+		passwd string
+		isErr  bool
+	}{
+		{
+			name:   "no policy",
+			passwd: "a",
+		},
+		{
+			name:   "minimal length",
+			policy: api.SDomainSecurityComplianceOptions{PasswordMinimalLength: 8},
+			passwd: "12345678",
+		},
+		{
+			name:   "minimal length (short)",
+			policy: api.SDomainSecurityComplianceOptions{PasswordMinimalLength: 8},
+			passwd: "1234567",
+			isErr:  true,
+		},
+		{
+			name:   "char classes",
+			policy: api.SDomainSecurityComplianceOptions{PasswordMinimalCharClasses: 3},
+			passwd: "abcDEF123",
+		},
+		{
+			name:   "char classes (too few)",
+			policy: api.SDomainSecurityComplianceOptions{PasswordMinimalCharClasses: 3},
+			passwd: "abcdef123",
+			isErr:  true,
+		},
+		{
+			name:   "regex",
+			policy: api.SDomainSecurityComplianceOptions{PasswordRegex: "^[a-z]+[0-9]+$"},
+			passwd: "abc123",
+		},
+		{
+			name:   "regex (mismatch)",
+			policy: api.SDomainSecurityComplianceOptions{PasswordRegex: "^[a-z]+[0-9]+$"},
+			passwd: "123abc",
+			isErr:  true,
+		},
+		{
+			name:   "regex (invalid, ignored)",
+			policy: api.SDomainSecurityComplianceOptions{PasswordRegex: "["},
+			passwd: "abc",
+		},
+		{
+			name:   "history",
+			policy: api.SDomainSecurityComplianceOptions{UniqueLastPasswordCount: 3},
+			passwd: "Recent-4",
+		},
+		{
+			name:   "history (reused)",
+			policy: api.SDomainSecurityComplianceOptions{UniqueLastPasswordCount: 3},
+			passwd: "Recent-3",
+			isErr:  true,
+		},
+		{
+			name:   "history (older than count)",
+			policy: api.SDomainSecurityComplianceOptions{UniqueLastPasswordCount: 2},
+			passwd: "Recent-3",
+		},
+		{
+			name:   "history (disabled)",
+			passwd: "Recent-1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkPasswordPolicy(c.policy, c.passwd, recentHashes)
+			if c.isErr && err == nil {
+				t.Errorf("should error, got nil")
+			} else if !c.isErr && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestLocalUserIsLocked(t *testing.T) {
+	now := time.Now()
+	policy := api.SDomainSecurityComplianceOptions{
+		LockoutFailureAttempts: 3,
+		LockoutDuration:        60,
+	}
+	cases := []struct {
+		name     string
+		policy   api.SDomainSecurityComplianceOptions
+		failed   int
+		failedAt time.Time
+		locked   bool
+	}{
+		{
+			name:     "no lockout policy",
+			failed:   100,
+			failedAt: now,
+		},
+		{
+			name:     "below attempts",
+			policy:   policy,
+			failed:   2,
+			failedAt: now,
+		},
+		{
+			name:     "locked",
+			policy:   policy,
+			failed:   3,
+			failedAt: now.Add(-59 * time.Second),
+			locked:   true,
+		},
+		{
+			name:     "lockout elapsed",
+			policy:   policy,
+			failed:   3,
+			failedAt: now.Add(-61 * time.Second),
+		},
+		{
+			name: "locked until unlocked",
+			policy: api.SDomainSecurityComplianceOptions{
+				LockoutFailureAttempts: 3,
+			},
+			failed:   3,
+			failedAt: now.Add(-24 * time.Hour),
+			locked:   true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			localUser := SLocalUser{
+				FailedAuthCount: c.failed,
+				FailedAuthAt:    c.failedAt,
+			}
+			if got := localUser.isLockedAt(c.policy, now); got != c.locked {
+				t.Errorf("want locked %v, got %v", c.locked, got)
+			}
+		})
+	}
+}
+
+func TestLocalUserCountFailedAuth(t *testing.T) {
+	policy := api.SDomainSecurityComplianceOptions{
+		LockoutFailureAttempts: 3,
+		LockoutDuration:        60,
+	}
+	now := time.Now()
+	localUser := SLocalUser{}
+	for i := 1; i <= 3; i++ {
+		locked := localUser.countFailedAuth(policy, now)
+		if localUser.FailedAuthCount != i {
+			t.Fatalf("failure %d: want count %d, got %d", i, i, localUser.FailedAuthCount)
+		}
+		if locked != (i == 3) {
+			t.Fatalf("failure %d: want locked %v, got %v", i, i == 3, locked)
+		}
+	}
+	if !localUser.isLockedAt(policy, now.Add(time.Second)) {
+		t.Fatalf("not locked after %d failures", policy.LockoutFailureAttempts)
+	}
+
+	// a failure after the lockout elapsed starts counting again
+	later := now.Add(2 * time.Minute)
+	if localUser.countFailedAuth(policy, later) {
+		t.Errorf("locked again by the first failure after lockout")
+	}
+	if localUser.FailedAuthCount != 1 || !localUser.FailedAuthAt.Equal(later.UTC()) {
+		t.Errorf("want count 1 at %s, got %d at %s", later, localUser.FailedAuthCount, localUser.FailedAuthAt)
+	}
+}
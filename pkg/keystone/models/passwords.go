@@ -19,8 +19,6 @@ import (
 
 	"github.com/pkg/errors"
 
-	"yunion.io/x/sqlchemy"
-
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/util/seclib2"
 )
@@ -71,24 +69,45 @@ type SPassword struct {
 	ExpiresAtInt int64     `nullable:"true"`
 }
 
-func (manager *SPasswordManager) fetchByLocaluserId(localUserId int) ([]SPassword, error) {
+// fetchRecent returns the passwords of a local user, most recent first,
+// including the expired ones. limit 0 means all of them
+func (manager *SPasswordManager) fetchRecent(localUserId int, limit int) ([]SPassword, error) {
 	passes := make([]SPassword, 0)
-	passwords := manager.Query().SubQuery()
-
-	q := passwords.Query().Equals("local_user_id", localUserId).Filter(sqlchemy.OR(
-		sqlchemy.IsNullOrEmpty(passwords.Field("expires_at_int")),
-		sqlchemy.Equals(passwords.Field("expires_at_int"), 0),
-		sqlchemy.GE(passwords.Field("expires_at_int"), time.Now().UnixNano()/1000),
-	))
+	q := manager.Query().Equals("local_user_id", localUserId)
+	q = q.Desc("created_at_int").Desc("id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
 	err := db.FetchModelObjects(manager, q, &passes)
 	if err != nil {
 		return nil, err
 	}
-
 	return passes, nil
 }
 
-func (manager *SPasswordManager) savePassword(localUserId int, password string) error {
+// fetchLatest returns the password currently in effect, nil if the user
+// has no password
+func (manager *SPasswordManager) fetchLatest(localUserId int) (*SPassword, error) {
+	passes, err := manager.fetchRecent(localUserId, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(passes) == 0 {
+		return nil, nil
+	}
+	return &passes[0], nil
+}
+
+func (passwd *SPassword) IsExpired() bool {
+	if passwd.ExpiresAtInt > 0 {
+		return passwd.ExpiresAtInt <= time.Now().UnixNano()/1000
+	}
+	return false
+}
+
+// savePassword adds a record of the new password, the previous ones are kept
+// for the history check. A zero expiresAt means the password never expires
+func (manager *SPasswordManager) savePassword(localUserId int, password string, selfService bool, expiresAt time.Time) error {
 	hash, err := seclib2.BcryptPassword(password)
 	if err != nil {
 		return errors.WithMessage(err, "seclib2.BcryptPassword")
@@ -96,7 +115,12 @@ func (manager *SPasswordManager) savePassword(localUserId int, password string)
 	rec := SPassword{}
 	rec.LocalUserId = localUserId
 	rec.PasswordHash = hash
+	rec.SelfService = selfService
 	rec.CreatedAtInt = time.Now().UnixNano() / 1000
+	if !expiresAt.IsZero() {
+		rec.ExpiresAt = expiresAt
+		rec.ExpiresAtInt = expiresAt.UnixNano() / 1000
+	}
 	err = manager.TableSpec().Insert(&rec)
 	if err != nil {
 		return errors.WithMessage(err, "Insert")
@@ -105,9 +129,9 @@ func (manager *SPasswordManager) savePassword(localUserId int, password string)
 }
 
 func (manager *SPasswordManager) delete(localUserId int) error {
-	recs, err := manager.fetchByLocaluserId(localUserId)
+	recs, err := manager.fetchRecent(localUserId, 0)
 	if err != nil {
-		return errors.WithMessage(err, "manager.fetchByLocaluserId")
+		return errors.WithMessage(err, "manager.fetchRecent")
 	}
 	for i := range recs {
 		_, err = db.Update(&recs[i], func() error {
@@ -279,6 +279,20 @@ func (proj *SProject) ValidateUpdateData(ctx context.Context, userCred mcclient.
 	return proj.SEnabledIdentityBaseResource.ValidateUpdateData(ctx, userCred, query, data)
 }
 
+func (proj *SProject) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	proj.SEnabledIdentityBaseResource.PostUpdate(ctx, userCred, query, data)
+
+	if data.Contains("enabled") && proj.Enabled.IsFalse() {
+		RevocationEventManager.RevokeProject(proj.Id)
+	}
+}
+
+func (proj *SProject) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
+	proj.SEnabledIdentityBaseResource.PostDelete(ctx, userCred)
+
+	RevocationEventManager.RevokeProject(proj.Id)
+}
+
 func (proj *SProject) GetCustomizeColumns(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) *jsonutils.JSONDict {
 	extra := proj.SEnabledIdentityBaseResource.GetCustomizeColumns(ctx, userCred, query)
 	return projectExtra(proj, extra)
@@ -0,0 +1,252 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/log"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/keystone/options"
+)
+
+type SRevocationEventManager struct {
+	db.SResourceBaseManager
+
+	notifyLock sync.Mutex
+	notify     chan struct{}
+}
+
+var RevocationEventManager *SRevocationEventManager
+
+func init() {
+	RevocationEventManager = &SRevocationEventManager{
+		SResourceBaseManager: db.NewResourceBaseManager(
+			SRevocationEvent{},
+			"revocation_event",
+			"revocation_event",
+			"revocation_events",
+		),
+		notify: make(chan struct{}),
+	}
+}
+
+/*
++---------------+-------------+------+-----+---------+----------------+
+| Field         | Type        | Null | Key | Default | Extra          |
++---------------+-------------+------+-----+---------+----------------+
+| id            | bigint(20)  | NO   | PRI | NULL    | auto_increment |
+| domain_id     | varchar(64) | YES  | MUL | NULL    |                |
+| project_id    | varchar(64) | YES  | MUL | NULL    |                |
+| user_id       | varchar(64) | YES  | MUL | NULL    |                |
+| role_id       | varchar(64) | YES  | MUL | NULL    |                |
+| audit_id      | varchar(32) | YES  | MUL | NULL    |                |
+| issued_before | datetime    | NO   | MUL | NULL    |                |
+| revoked_at    | datetime    | NO   | MUL | NULL    |                |
++---------------+-------------+------+-----+---------+----------------+
+*/
+
+type SRevocationEvent struct {
+	db.SResourceBase
+
+	Id           int64     `primary:"true" auto_increment:"true"`
+	DomainId     string    `width:"64" charset:"ascii" nullable:"true" index:"true"`
+	ProjectId    string    `width:"64" charset:"ascii" nullable:"true" index:"true"`
+	UserId       string    `width:"64" charset:"ascii" nullable:"true" index:"true"`
+	RoleId       string    `width:"64" charset:"ascii" nullable:"true" index:"true"`
+	AuditId      string    `width:"32" charset:"ascii" nullable:"true" index:"true"`
+	IssuedBefore time.Time `nullable:"false" index:"true"`
+	RevokedAt    time.Time `nullable:"false" index:"true"`
+}
+
+func (event *SRevocationEvent) toApi() api.SRevocationEvent {
+	return api.SRevocationEvent{
+		Id:           event.Id,
+		UserId:       event.UserId,
+		ProjectId:    event.ProjectId,
+		DomainId:     event.DomainId,
+		RoleId:       event.RoleId,
+		AuditId:      event.AuditId,
+		IssuedBefore: event.IssuedBefore,
+		RevokedAt:    event.RevokedAt,
+	}
+}
+
+// revoke records an event revoking the tokens issued so far that match all
+// the given non-empty attributes
+func (manager *SRevocationEventManager) revoke(userId, projectId, domainId, roleId, auditId string) error {
+	now := time.Now().UTC()
+	event := SRevocationEvent{}
+	event.UserId = userId
+	event.ProjectId = projectId
+	event.DomainId = domainId
+	event.RoleId = roleId
+	event.AuditId = auditId
+	// token timestamps have second precision, and the database may round
+	// up the fractional seconds, which would revoke tokens issued right after
+	event.IssuedBefore = now.Truncate(time.Second)
+	event.RevokedAt = now
+	err := manager.TableSpec().Insert(&event)
+	if err != nil {
+		return errors.WithMessage(err, "Insert")
+	}
+	manager.broadcast()
+	return nil
+}
+
+func (manager *SRevocationEventManager) RevokeUser(userId string) {
+	err := manager.revoke(userId, "", "", "", "")
+	if err != nil {
+		log.Errorf("revoke tokens of user %s fail %s", userId, err)
+	}
+}
+
+func (manager *SRevocationEventManager) RevokeProject(projectId string) {
+	err := manager.revoke("", projectId, "", "", "")
+	if err != nil {
+		log.Errorf("revoke tokens of project %s fail %s", projectId, err)
+	}
+}
+
+func (manager *SRevocationEventManager) RevokeDomain(domainId string) {
+	err := manager.revoke("", "", domainId, "", "")
+	if err != nil {
+		log.Errorf("revoke tokens of domain %s fail %s", domainId, err)
+	}
+}
+
+func (manager *SRevocationEventManager) RevokeRole(roleId string) {
+	err := manager.revoke("", "", "", roleId, "")
+	if err != nil {
+		log.Errorf("revoke tokens of role %s fail %s", roleId, err)
+	}
+}
+
+// RevokeAssignment revokes the tokens of a user scoped to a project or
+// domain that carry a role
+func (manager *SRevocationEventManager) RevokeAssignment(userId, projectId, roleId string) {
+	err := manager.revoke(userId, projectId, "", roleId, "")
+	if err != nil {
+		log.Errorf("revoke tokens of user %s project %s role %s fail %s", userId, projectId, roleId, err)
+	}
+}
+
+// RevokeToken revokes a single token by its audit id
+func (manager *SRevocationEventManager) RevokeToken(auditId string) error {
+	return manager.revoke("", "", "", "", auditId)
+}
+
+func (manager *SRevocationEventManager) broadcast() {
+	manager.notifyLock.Lock()
+	defer manager.notifyLock.Unlock()
+
+	close(manager.notify)
+	manager.notify = make(chan struct{})
+}
+
+func (manager *SRevocationEventManager) waitChan() <-chan struct{} {
+	manager.notifyLock.Lock()
+	defer manager.notifyLock.Unlock()
+
+	return manager.notify
+}
+
+// fetchEvents returns the events after sinceId that may still match an
+// unexpired token, older events are useless
+func (manager *SRevocationEventManager) fetchEvents(sinceId int64) ([]api.SRevocationEvent, error) {
+	since := time.Now().UTC().Add(-time.Duration(options.Options.TokenExpirationSeconds) * time.Second)
+	q := manager.Query().GT("id", sinceId).GE("issued_before", since)
+	q = q.Asc("id")
+	events := make([]SRevocationEvent, 0)
+	err := db.FetchModelObjects(manager, q, &events)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]api.SRevocationEvent, len(events))
+	for i := range events {
+		ret[i] = events[i].toApi()
+	}
+	return ret, nil
+}
+
+func hasEventsAfter(events []api.SRevocationEvent, sinceId int64) bool {
+	return len(events) > 0 && events[len(events)-1].Id > sinceId
+}
+
+// FetchEvents is the revocation feed. Without events after sinceId, it
+// waits up to wait for new ones, so that consumers get them pushed by long
+// polling. Events from other keystone instances show up at the latest
+// when the wait times out. The events of the last RevocationEventIdOverlap
+// ids up to sinceId are always returned again
+func (manager *SRevocationEventManager) FetchEvents(sinceId int64, wait time.Duration) ([]api.SRevocationEvent, error) {
+	readId := sinceId - api.RevocationEventIdOverlap
+	if readId < 0 {
+		readId = 0
+	}
+	ch := manager.waitChan()
+	events, err := manager.fetchEvents(readId)
+	if err != nil {
+		return nil, err
+	}
+	if hasEventsAfter(events, sinceId) || wait <= 0 {
+		return events, nil
+	}
+	select {
+	case <-ch:
+	case <-time.After(wait):
+	}
+	return manager.fetchEvents(readId)
+}
+
+// FetchTokenEvents returns the events that may revoke a token issued at
+// issuedAt, i.e. the events issued after it for the user, the project or
+// the audit ids of the token, and those with none of these attributes,
+// which revoke by domain or role
+func (manager *SRevocationEventManager) FetchTokenEvents(userId, projectId string, auditIds []string, issuedAt time.Time) ([]api.SRevocationEvent, error) {
+	q := manager.Query()
+	if !issuedAt.IsZero() {
+		q = q.GE("issued_before", issuedAt.UTC().Truncate(time.Second))
+	}
+	conds := []sqlchemy.ICondition{
+		sqlchemy.Equals(q.Field("user_id"), userId),
+		sqlchemy.AND(
+			sqlchemy.IsNullOrEmpty(q.Field("user_id")),
+			sqlchemy.IsNullOrEmpty(q.Field("project_id")),
+			sqlchemy.IsNullOrEmpty(q.Field("audit_id")),
+		),
+	}
+	if len(projectId) > 0 {
+		conds = append(conds, sqlchemy.Equals(q.Field("project_id"), projectId))
+	}
+	if len(auditIds) > 0 {
+		conds = append(conds, sqlchemy.In(q.Field("audit_id"), auditIds))
+	}
+	q = q.Filter(sqlchemy.OR(conds...))
+	events := make([]SRevocationEvent, 0)
+	err := db.FetchModelObjects(manager, q, &events)
+	if err != nil {
+		return nil, errors.WithMessage(err, "FetchModelObjects")
+	}
+	ret := make([]api.SRevocationEvent, len(events))
+	for i := range events {
+		ret[i] = events[i].toApi()
+	}
+	return ret, nil
+}
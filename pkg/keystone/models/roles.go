@@ -190,6 +190,12 @@ func (role *SRole) ValidateDeleteCondition(ctx context.Context) error {
 	return role.SIdentityBaseResource.ValidateDeleteCondition(ctx)
 }
 
+func (role *SRole) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
+	role.SIdentityBaseResource.PostDelete(ctx, userCred)
+
+	RevocationEventManager.RevokeRole(role.Id)
+}
+
 func (role *SRole) GetCustomizeColumns(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) *jsonutils.JSONDict {
 	extra := role.SIdentityBaseResource.GetCustomizeColumns(ctx, userCred, query)
 	return roleExtra(role, extra)
@@ -0,0 +1,515 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/seclib2"
+)
+
+/*
+ TOTP second factor
+
+ The secret of a user is kept in a credential of type totp, whose extra
+ field records whether the enrollment has been confirmed with a valid
+ passcode, the time step of the last accepted passcode, which cannot be used
+ again, and the consecutive failures. One time recovery codes are kept
+ bcrypt hashed, as a json array, in a credential of type recovery_code.
+*/
+
+var (
+	ErrTotpLocked     = errors.New("too many failed passcodes, try again later")
+	ErrTotpReused     = errors.New("passcode already used")
+	ErrTotpNotEnabled = errors.New("totp not enabled")
+)
+
+// totpLockName is the lockman resource name of the per user lock guarding
+// the totp state and recovery codes
+const totpLockName = "totp"
+
+func fetchTotpCredential(userId string) (*SCredential, error) {
+	creds, err := CredentialManager.fetchCredentials(userId, api.CredentialTypeTotp)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, nil
+	}
+	return &creds[0], nil
+}
+
+func (cred *SCredential) isTotpConfirmed() bool {
+	if cred.Extra == nil {
+		return false
+	}
+	return jsonutils.QueryBoolean(cred.Extra, "confirmed", false)
+}
+
+// isTotpLocked tells whether the second factor is refused after
+// TotpMaxFailedAttempts consecutive failures within TotpLockoutSeconds
+func (cred *SCredential) isTotpLocked(now time.Time) bool {
+	if cred.Extra == nil {
+		return false
+	}
+	failed, _ := cred.Extra.Int("failed_count")
+	if failed < api.TotpMaxFailedAttempts {
+		return false
+	}
+	failedAt, _ := cred.Extra.GetTime("failed_at")
+	return now.Before(failedAt.Add(api.TotpLockoutSeconds * time.Second))
+}
+
+func (cred *SCredential) totpLastCounter() int64 {
+	if cred.Extra == nil {
+		return 0
+	}
+	counter, _ := cred.Extra.Int("last_counter")
+	return counter
+}
+
+// updateTotpState updates the extra field of the totp credential
+func (cred *SCredential) updateTotpState(update func(extra *jsonutils.JSONDict)) error {
+	_, err := db.Update(cred, func() error {
+		extra := jsonutils.NewDict()
+		if cred.Extra != nil {
+			extra.Update(cred.Extra)
+		}
+		update(extra)
+		cred.Extra = extra
+		return nil
+	})
+	return err
+}
+
+func (cred *SCredential) recordTotpSuccess(counter int64) error {
+	return cred.updateTotpState(func(extra *jsonutils.JSONDict) {
+		if counter > 0 {
+			extra.Set("last_counter", jsonutils.NewInt(counter))
+		}
+		extra.Set("failed_count", jsonutils.NewInt(0))
+	})
+}
+
+// recordTotpFailure counts a failed passcode, the count restarts once a
+// lockout has elapsed
+func (cred *SCredential) recordTotpFailure(now time.Time) error {
+	failed := int64(0)
+	if cred.Extra != nil && !cred.isTotpLocked(now) {
+		failed, _ = cred.Extra.Int("failed_count")
+		if failed >= api.TotpMaxFailedAttempts {
+			failed = 0
+		}
+	}
+	return cred.updateTotpState(func(extra *jsonutils.JSONDict) {
+		extra.Set("failed_count", jsonutils.NewInt(failed+1))
+		extra.Set("failed_at", jsonutils.NewTimeString(now.UTC()))
+	})
+}
+
+// IsTotpEnabled tells whether the user has confirmed a totp secret
+func (user *SUserExtended) IsTotpEnabled() bool {
+	return isTotpEnabled(user.Id)
+}
+
+func isTotpEnabled(userId string) bool {
+	cred, err := fetchTotpCredential(userId)
+	if err != nil {
+		log.Errorf("fetchTotpCredential fail %s", err)
+		return false
+	}
+	return cred != nil && cred.isTotpConfirmed()
+}
+
+func isUserMfaRequired(userId string) bool {
+	val, err := UserOptionManager.fetchOption(userId, api.UserOptionMfaRequired)
+	if err != nil {
+		log.Errorf("fetch user %s mfa option fail %s", userId, err)
+		return false
+	}
+	return val == "true"
+}
+
+// IsMfaRequired tells whether the user must authenticate with a second
+// factor, either by its own option or by the security policy of its domain.
+// Users who have not enrolled yet do so with the receipt of the first factor
+func (user *SUserExtended) IsMfaRequired() bool {
+	if isUserMfaRequired(user.Id) {
+		return true
+	}
+	domain, err := DomainManager.FetchDomainById(user.DomainId)
+	if err != nil {
+		log.Errorf("FetchDomainById %s fail %s", user.DomainId, err)
+		return false
+	}
+	return domain.IsMfaRequired()
+}
+
+// withTotpCredential calls f with the confirmed totp credential of the user
+// while holding the totp lock of the user.  Verifications of other users,
+// and with a distributed lock manager those on other keystone instances,
+// are not blocked
+func (user *SUserExtended) withTotpCredential(ctx context.Context, f func(cred *SCredential) error) error {
+	lockman.LockRawObject(ctx, totpLockName, user.Id)
+	defer lockman.ReleaseRawObject(ctx, totpLockName, user.Id)
+
+	cred, err := fetchTotpCredential(user.Id)
+	if err != nil {
+		return errors.WithMessage(err, "fetchTotpCredential")
+	}
+	if cred == nil || !cred.isTotpConfirmed() {
+		return ErrTotpNotEnabled
+	}
+	return f(cred)
+}
+
+// VerifyTotp checks a passcode against the confirmed totp secret of the
+// user, falling back to the unused recovery codes, which are consumed.
+// A passcode is accepted only once, and the user is locked out of the second
+// factor for a while after too many failures
+func (user *SUserExtended) VerifyTotp(ctx context.Context, passcode string) error {
+	now := time.Now()
+	var verifyErr error
+	err := user.withTotpCredential(ctx, func(cred *SCredential) error {
+		if cred.isTotpLocked(now) {
+			return ErrTotpLocked
+		}
+		counter, err := seclib2.VerifyTotpCounter(cred.getBlob(), passcode, now)
+		if err == nil && counter <= cred.totpLastCounter() {
+			err = ErrTotpReused
+		}
+		if err != nil {
+			verifyErr = err
+			return nil
+		}
+		return errors.WithMessage(cred.recordTotpSuccess(counter), "recordTotpSuccess")
+	})
+	if err == ErrTotpLocked {
+		user.logEvent(db.ACT_AUTH_FAIL, "totp locked")
+	}
+	if err != nil || verifyErr == nil {
+		return err
+	}
+	// the bcrypt comparisons of recovery codes are slow, they are done
+	// without holding the lock
+	if useRecoveryCode(ctx, user.Id, passcode) == nil {
+		return user.withTotpCredential(ctx, func(cred *SCredential) error {
+			return errors.WithMessage(cred.recordTotpSuccess(0), "recordTotpSuccess")
+		})
+	}
+	err = user.withTotpCredential(ctx, func(cred *SCredential) error {
+		return cred.recordTotpFailure(now)
+	})
+	if err != nil {
+		log.Errorf("record failed totp of user %s fail %s", user.Id, err)
+	}
+	if user.IsLocal {
+		user.recordFailedTotp()
+	} else {
+		user.logEvent(db.ACT_AUTH_FAIL, fmt.Sprintf("invalid passcode: %s", verifyErr))
+	}
+	return verifyErr
+}
+
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 5)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(buf)
+	return fmt.Sprintf("%s-%s", code[:5], code[5:]), nil
+}
+
+func resetRecoveryCodes(userId string) ([]string, error) {
+	codes := make([]string, api.TotpRecoveryCodeCount)
+	hashes := make([]string, api.TotpRecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, errors.WithMessage(err, "generateRecoveryCode")
+		}
+		hash, err := seclib2.BcryptPassword(code)
+		if err != nil {
+			return nil, errors.WithMessage(err, "BcryptPassword")
+		}
+		codes[i] = code
+		hashes[i] = hash
+	}
+	err := CredentialManager.deleteCredentials(userId, api.CredentialTypeRecoveryCode)
+	if err != nil {
+		return nil, errors.WithMessage(err, "deleteCredentials")
+	}
+	_, err = CredentialManager.saveCredential(userId, api.CredentialTypeRecoveryCode, jsonutils.NewStringArray(hashes).String(), nil)
+	if err != nil {
+		return nil, errors.WithMessage(err, "saveCredential")
+	}
+	return codes, nil
+}
+
+func recoveryCodeHashes(userId string, cred *SCredential) []string {
+	blob, err := jsonutils.ParseString(cred.getBlob())
+	if err != nil {
+		log.Errorf("invalid recovery codes of user %s: %s", userId, err)
+		return nil
+	}
+	arr, err := blob.GetArray()
+	if err != nil {
+		log.Errorf("invalid recovery codes of user %s: %s", userId, err)
+		return nil
+	}
+	return jsonutils.JSONArray2StringArray(arr)
+}
+
+// useRecoveryCode consumes the recovery code.  The code is matched against
+// the bcrypt hashes first, then removed while holding the totp lock of the
+// user, unless a concurrent login has already used it
+func useRecoveryCode(ctx context.Context, userId string, code string) error {
+	creds, err := CredentialManager.fetchCredentials(userId, api.CredentialTypeRecoveryCode)
+	if err != nil {
+		return errors.WithMessage(err, "fetchCredentials")
+	}
+	hash := ""
+	for i := range creds {
+		for _, h := range recoveryCodeHashes(userId, &creds[i]) {
+			if seclib2.BcryptVerifyPassword(code, h) == nil {
+				hash = h
+				break
+			}
+		}
+		if len(hash) > 0 {
+			break
+		}
+	}
+	if len(hash) == 0 {
+		return fmt.Errorf("invalid passcode")
+	}
+
+	lockman.LockRawObject(ctx, totpLockName, userId)
+	defer lockman.ReleaseRawObject(ctx, totpLockName, userId)
+
+	creds, err = CredentialManager.fetchCredentials(userId, api.CredentialTypeRecoveryCode)
+	if err != nil {
+		return errors.WithMessage(err, "fetchCredentials")
+	}
+	for i := range creds {
+		hashes := recoveryCodeHashes(userId, &creds[i])
+		for j := range hashes {
+			if hashes[j] != hash {
+				continue
+			}
+			left := append(hashes[:j:j], hashes[j+1:]...)
+			err = creds[i].setBlob(jsonutils.NewStringArray(left).String())
+			if err != nil {
+				return errors.WithMessage(err, "setBlob")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid passcode")
+}
+
+func (user *SUser) allowTotpAction(userCred mcclient.TokenCredential, action string) bool {
+	return userCred.GetUserId() == user.Id || db.IsAdminAllowPerform(userCred, user, action)
+}
+
+func (user *SUser) verifyTotpInput(ctx context.Context, userCred mcclient.TokenCredential, data jsonutils.JSONObject, action string) error {
+	// admins may act on behalf of a user who lost the device
+	if userCred.GetUserId() != user.Id && db.IsAdminAllowPerform(userCred, user, action) {
+		return nil
+	}
+	passcode, _ := data.GetString("passcode")
+	if len(passcode) == 0 {
+		return httperrors.NewInputParameterError("missing passcode")
+	}
+	usrExt, err := UserManager.FetchUserExtended(user.Id, "", "", "")
+	if err != nil {
+		return httperrors.NewGeneralError(err)
+	}
+	err = usrExt.VerifyTotp(ctx, passcode)
+	if err != nil {
+		return httperrors.NewInvalidCredentialError("invalid passcode")
+	}
+	return nil
+}
+
+func (user *SUser) AllowPerformTotpEnroll(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return user.allowTotpAction(userCred, "totp-enroll")
+}
+
+// PerformTotpEnroll generates a new totp secret, which takes effect after
+// PerformTotpConfirm, and returns the otpauth:// uri to render as QR code
+func (user *SUser) PerformTotpEnroll(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return user.enrollTotp()
+}
+
+func (user *SUser) enrollTotp() (jsonutils.JSONObject, error) {
+	if isTotpEnabled(user.Id) {
+		return nil, httperrors.NewConflictError("totp already enabled")
+	}
+	err := CredentialManager.deleteCredentials(user.Id, api.CredentialTypeTotp)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("delete pending totp fail %s", err)
+	}
+	secret, err := seclib2.GenerateTotpSecret()
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("generate totp secret fail %s", err)
+	}
+	extra := jsonutils.NewDict()
+	extra.Add(jsonutils.JSONFalse, "confirmed")
+	_, err = CredentialManager.saveCredential(user.Id, api.CredentialTypeTotp, secret, extra)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("save totp secret fail %s", err)
+	}
+	account := user.Name
+	domain := user.GetDomain()
+	if domain != nil {
+		account = fmt.Sprintf("%s@%s", user.Name, domain.Name)
+	}
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.NewString(secret), "secret")
+	ret.Add(jsonutils.NewString(seclib2.TotpProvisioningUri(api.DefaultTotpIssuer, account, secret)), "provisioning_uri")
+	return ret, nil
+}
+
+func (user *SUser) AllowPerformTotpConfirm(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return user.allowTotpAction(userCred, "totp-confirm")
+}
+
+// PerformTotpConfirm activates the enrolled secret once the user proves
+// possession of it, and returns a fresh set of recovery codes
+func (user *SUser) PerformTotpConfirm(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	passcode, _ := data.GetString("passcode")
+	return user.confirmTotp(userCred, passcode)
+}
+
+func (user *SUser) confirmTotp(userCred mcclient.TokenCredential, passcode string) (jsonutils.JSONObject, error) {
+	cred, err := fetchTotpCredential(user.Id)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	if cred == nil {
+		return nil, httperrors.NewInvalidStatusError("totp not enrolled")
+	}
+	if cred.isTotpConfirmed() {
+		return nil, httperrors.NewConflictError("totp already enabled")
+	}
+	if len(passcode) == 0 {
+		return nil, httperrors.NewInputParameterError("missing passcode")
+	}
+	counter, err := seclib2.VerifyTotpCounter(cred.getBlob(), passcode, time.Now())
+	if err != nil {
+		return nil, httperrors.NewInvalidCredentialError("invalid passcode")
+	}
+	_, err = db.Update(cred, func() error {
+		extra := jsonutils.NewDict()
+		extra.Add(jsonutils.JSONTrue, "confirmed")
+		extra.Add(jsonutils.NewInt(counter), "last_counter")
+		cred.Extra = extra
+		return nil
+	})
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	codes, err := resetRecoveryCodes(user.Id)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("generate recovery codes fail %s", err)
+	}
+	db.OpsLog.LogEvent(user, db.ACT_ENABLE, "totp", userCred)
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.NewStringArray(codes), "recovery_codes")
+	return ret, nil
+}
+
+// EnrollTotp is the self service enrollment of a user who passed the first
+// factor but cannot get a token before setting up the required totp
+func (user *SUserExtended) EnrollTotp() (jsonutils.JSONObject, error) {
+	usr := UserManager.fetchUserById(user.Id)
+	if usr == nil {
+		return nil, httperrors.NewUserNotFoundError("user %s not found", user.Id)
+	}
+	return usr.enrollTotp()
+}
+
+// ConfirmTotp confirms the self service enrollment of EnrollTotp
+func (user *SUserExtended) ConfirmTotp(passcode string) (jsonutils.JSONObject, error) {
+	usr := UserManager.fetchUserById(user.Id)
+	if usr == nil {
+		return nil, httperrors.NewUserNotFoundError("user %s not found", user.Id)
+	}
+	return usr.confirmTotp(user.getUserCred(), passcode)
+}
+
+func (user *SUser) AllowPerformTotpRecoveryCodes(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return user.allowTotpAction(userCred, "totp-recovery-codes")
+}
+
+// PerformTotpRecoveryCodes replaces all recovery codes of the user
+func (user *SUser) PerformTotpRecoveryCodes(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !isTotpEnabled(user.Id) {
+		return nil, httperrors.NewInvalidStatusError("totp not enabled")
+	}
+	err := user.verifyTotpInput(ctx, userCred, data, "totp-recovery-codes")
+	if err != nil {
+		return nil, err
+	}
+	codes, err := resetRecoveryCodes(user.Id)
+	if err != nil {
+		return nil, httperrors.NewInternalServerError("generate recovery codes fail %s", err)
+	}
+	db.OpsLog.LogEvent(user, db.ACT_UPDATE, "totp recovery codes", userCred)
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.NewStringArray(codes), "recovery_codes")
+	return ret, nil
+}
+
+func (user *SUser) AllowPerformTotpDisable(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) bool {
+	return user.allowTotpAction(userCred, "totp-disable")
+}
+
+// PerformTotpDisable removes the totp secret and recovery codes. Users
+// who are required to use MFA enroll again with the receipt handed out
+// after their next first factor
+func (user *SUser) PerformTotpDisable(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if isTotpEnabled(user.Id) {
+		err := user.verifyTotpInput(ctx, userCred, data, "totp-disable")
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := CredentialManager.deleteCredentials(user.Id, api.CredentialTypeTotp)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	err = CredentialManager.deleteCredentials(user.Id, api.CredentialTypeRecoveryCode)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	db.OpsLog.LogEvent(user, db.ACT_DISABLE, "totp", userCred)
+	return nil, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/log"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+)
+
+type SUsedNonceManager struct {
+	db.SModelBaseManager
+}
+
+var (
+	UsedNonceManager *SUsedNonceManager
+)
+
+func init() {
+	UsedNonceManager = &SUsedNonceManager{
+		SModelBaseManager: db.NewModelBaseManager(
+			SUsedNonce{},
+			"used_nonce",
+			"used_nonce",
+			"used_nonces",
+		),
+	}
+}
+
+/*
++------------+-------------+------+-----+---------+-------+
+| Field      | Type        | Null | Key | Default | Extra |
++------------+-------------+------+-----+---------+-------+
+| nonce      | varchar(64) | NO   | PRI | NULL    |       |
+| expires_at | datetime    | NO   | MUL | NULL    |       |
++------------+-------------+------+-----+---------+-------+
+*/
+
+// SUsedNonce records a nonce consumed by a web SSO callback, shared by all
+// keystone instances so that a callback is accepted only once
+type SUsedNonce struct {
+	db.SModelBase
+
+	Nonce     string    `width:"64" charset:"ascii" nullable:"false" primary:"true"`
+	ExpiresAt time.Time `nullable:"false" index:"true"`
+}
+
+// Consume records the nonce as used until expiresAt, after which the
+// nonce is invalid anyway. Returns false if the nonce has been used
+func (manager *SUsedNonceManager) Consume(nonce string, expiresAt time.Time) (bool, error) {
+	manager.purgeExpired()
+
+	usedNonce := SUsedNonce{
+		Nonce:     nonce,
+		ExpiresAt: expiresAt.UTC(),
+	}
+	usedNonce.SetModelManager(manager)
+	err := manager.TableSpec().Insert(&usedNonce)
+	if err == nil {
+		return true, nil
+	}
+	// the primary key refuses a nonce inserted by another instance
+	cnt, e := manager.Query().Equals("nonce", nonce).CountWithError()
+	if e != nil {
+		return false, errors.WithMessage(e, "Query")
+	}
+	if cnt > 0 {
+		return false, nil
+	}
+	return false, errors.WithMessage(err, "Insert")
+}
+
+func (manager *SUsedNonceManager) purgeExpired() {
+	// rows are deleted for real, a soft deleted nonce would stay used
+	sql := fmt.Sprintf("DELETE FROM `%s` WHERE `expires_at` < ?", manager.TableSpec().Name())
+	if _, err := sqlchemy.GetDB().Exec(sql, time.Now().UTC()); err != nil {
+		log.Errorf("purge expired nonces fail %s", err)
+	}
+}
@@ -87,6 +87,21 @@ func (manager *SUsergroupManager) getUserGroupIds(userId string) []string {
 	return groupIds
 }
 
+func (manager *SUsergroupManager) getGroupUserIds(groupId string) []string {
+	members := make([]SUsergroupMembership, 0)
+	q := manager.Query().Equals("group_id", groupId)
+	err := db.FetchModelObjects(manager, q, &members)
+	if err != nil {
+		log.Errorf("getGroupUserIds fail %s", err)
+		return nil
+	}
+	userIds := make([]string, len(members))
+	for i := range members {
+		userIds[i] = members[i].UserId
+	}
+	return userIds
+}
+
 func (manager *SUsergroupManager) SyncUserGroups(ctx context.Context, userCred mcclient.TokenCredential, userId string, groupIds []string) {
 	oldGroupIds := manager.getUserGroupIds(userId)
 	sort.Strings(oldGroupIds)
@@ -120,6 +135,8 @@ func (manager *SUsergroupManager) remove(ctx context.Context, userCred mcclient.
 		return errors.WithMessage(err, "MarkDelete")
 	}
 	db.OpsLog.LogEvent(usr, db.ACT_DETACH, grp.GetShortDesc(ctx), userCred)
+	// roles granted through the group are gone
+	RevocationEventManager.RevokeUser(usr.Id)
 	return nil
 }
 
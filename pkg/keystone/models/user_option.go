@@ -14,7 +14,13 @@
 
 package models
 
-import "yunion.io/x/onecloud/pkg/cloudcommon/db"
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+)
 
 type SUserOptionManager struct {
 	db.SModelBaseManager
@@ -53,3 +59,29 @@ type SUserOption struct {
 	OptionId    string `width:"4" charset:"ascii" nullable:"false" primary:"true"`
 	OptionValue string `nullable:"true"`
 }
+
+func (manager *SUserOptionManager) fetchOption(userId string, optionId string) (string, error) {
+	opt := SUserOption{}
+	opt.SetModelManager(manager)
+	err := manager.Query().Equals("user_id", userId).Equals("option_id", optionId).First(&opt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return opt.OptionValue, nil
+}
+
+func (manager *SUserOptionManager) saveOption(userId string, optionId string, value string) error {
+	opt := SUserOption{}
+	opt.UserId = userId
+	opt.OptionId = optionId
+	opt.OptionValue = value
+	opt.SetModelManager(manager)
+	err := manager.TableSpec().InsertOrUpdate(&opt)
+	if err != nil {
+		return errors.WithMessage(err, "InsertOrUpdate")
+	}
+	return nil
+}
@@ -32,7 +32,6 @@ import (
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/keystone/options"
 	"yunion.io/x/onecloud/pkg/mcclient"
-	"yunion.io/x/onecloud/pkg/util/seclib2"
 )
 
 type SUserManager struct {
@@ -139,7 +138,8 @@ func (manager *SUserManager) initSysUser() error {
 	if err != nil {
 		return errors.WithMessage(err, "insert")
 	}
-	err = usr.initLocalData(options.Options.BootstrapAdminUserPassword)
+	// the bootstrap password is not subject to change upon first use
+	err = usr.initLocalData(options.Options.BootstrapAdminUserPassword, true)
 	if err != nil {
 		return errors.WithMessage(err, "initLocalData")
 	}
@@ -235,23 +235,6 @@ func (user *SUserExtended) VerifyPassword(passwd string) error {
 	}
 }
 
-func (user *SUserExtended) localUserVerifyPassword(passwd string) error {
-	passes, err := PasswordManager.fetchByLocaluserId(user.LocalId)
-	if err != nil {
-		return err
-	}
-	if len(passes) == 0 {
-		return nil
-	}
-	for i := range passes {
-		err = seclib2.BcryptVerifyPassword(passwd, passes[i].PasswordHash)
-		if err == nil {
-			return nil
-		}
-	}
-	return fmt.Errorf("invalid password")
-}
-
 func (manager *SUserManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (*sqlchemy.SQuery, error) {
 	q, err := manager.SEnabledIdentityBaseResourceManager.ListItemFilter(ctx, q, userCred, query)
 	if err != nil {
@@ -289,12 +272,42 @@ func (manager *SUserManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQu
 	return q, nil
 }
 
+func (manager *SUserManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerProjId string, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
+	data, err := manager.SEnabledIdentityBaseResourceManager.ValidateCreateData(ctx, userCred, ownerProjId, query, data)
+	if err != nil {
+		return nil, err
+	}
+	passwd, _ := data.GetString("password")
+	if len(passwd) > 0 {
+		domainId, _ := data.GetString("domain_id")
+		err = validatePassword(domainId, 0, passwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
 func (user *SUser) ValidateUpdateData(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
 	if data.Contains("name") {
 		if user.IsAdminUser() {
 			return nil, httperrors.NewForbiddenError("cannot alter name of system user")
 		}
 	}
+	passwd, _ := data.GetString("password")
+	if len(passwd) > 0 {
+		usrExt, err := UserManager.FetchUserExtended(user.Id, "", "", "")
+		if err != nil {
+			return nil, httperrors.NewGeneralError(err)
+		}
+		if !usrExt.IsLocal {
+			return nil, httperrors.NewForbiddenError("cannot set password of non-local user")
+		}
+		err = validatePassword(user.DomainId, usrExt.LocalId, passwd)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return user.SEnabledIdentityBaseResource.ValidateUpdateData(ctx, userCred, query, data)
 }
 
@@ -349,16 +362,23 @@ func userExtra(user *SUser, extra *jsonutils.JSONDict) *jsonutils.JSONDict {
 	extra.Add(jsonutils.NewInt(int64(prjCnt)), "project_count")
 	credCnt, _ := user.GetCredentialCount()
 	extra.Add(jsonutils.NewInt(int64(credCnt)), "credential_count")
+	extra.Add(jsonutils.NewBool(isTotpEnabled(user.Id)), "totp_enabled")
+	extra.Add(jsonutils.NewBool(isUserMfaRequired(user.Id)), "mfa_required")
+	locked, expiresAt := user.lockoutInfo()
+	extra.Add(jsonutils.NewBool(locked), "is_locked")
+	if !expiresAt.IsZero() {
+		extra.Add(jsonutils.NewTimeString(expiresAt), "password_expires_at")
+	}
 	return extra
 }
 
-func (user *SUser) initLocalData(passwd string) error {
+func (user *SUser) initLocalData(passwd string, selfService bool) error {
 	localUsr, err := LocalUserManager.register(user.Id, user.DomainId, user.Name)
 	if err != nil {
 		return errors.WithMessage(err, "register localuser")
 	}
 	if len(passwd) > 0 {
-		err = PasswordManager.savePassword(localUsr.Id, passwd)
+		err = PasswordManager.savePassword(localUsr.Id, passwd, selfService, passwordExpiresAt(user.DomainId, selfService))
 		if err != nil {
 			return errors.WithMessage(err, "save password")
 		}
@@ -370,7 +390,7 @@ func (user *SUser) PostCreate(ctx context.Context, userCred mcclient.TokenCreden
 	user.SEnabledIdentityBaseResource.PostCreate(ctx, userCred, ownerProjId, query, data)
 
 	passwd, _ := data.GetString("password")
-	err := user.initLocalData(passwd)
+	err := user.initLocalData(passwd, false)
 	if err != nil {
 		log.Errorf("fail to register localUser %s", err)
 		return
@@ -387,12 +407,27 @@ func (user *SUser) PostUpdate(ctx context.Context, userCred mcclient.TokenCreden
 			log.Errorf("UserManager.FetchUserExtended fail %s", err)
 			return
 		}
-		err = PasswordManager.savePassword(usrExt.LocalId, passwd)
+		// a user changing the own password is not forced to change it again
+		selfService := userCred.GetUserId() == user.Id
+		err = user.setPassword(userCred, usrExt.LocalId, passwd, selfService)
 		if err != nil {
 			log.Errorf("fail to set password %s", err)
 			return
 		}
 	}
+
+	if data.Contains("enabled") && user.Enabled.IsFalse() {
+		RevocationEventManager.RevokeUser(user.Id)
+	}
+
+	if data.Contains("mfa_required") {
+		required := jsonutils.QueryBoolean(data, "mfa_required", false)
+		err := UserOptionManager.saveOption(user.Id, api.UserOptionMfaRequired, fmt.Sprintf("%v", required))
+		if err != nil {
+			log.Errorf("fail to set mfa option %s", err)
+			return
+		}
+	}
 }
 
 func (user *SUser) ValidateDeleteCondition(ctx context.Context) error {
@@ -413,6 +448,13 @@ func (user *SUser) ValidateDeleteCondition(ctx context.Context) error {
 func (user *SUser) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
 	user.SEnabledIdentityBaseResource.PostDelete(ctx, userCred)
 
+	RevocationEventManager.RevokeUser(user.Id)
+
+	err := ApplicationCredentialManager.deleteByUser(user.Id)
+	if err != nil {
+		log.Errorf("ApplicationCredentialManager.deleteByUser fail %s", err)
+	}
+
 	localUser, err := LocalUserManager.delete(user.Id, user.DomainId)
 	if err != nil {
 		log.Errorf("LocalUserManager.delete fail %s", err)
@@ -29,6 +29,11 @@ type SKeystoneOptions struct {
 	TokenKeyRepository      string `help:"fernet key repo directory" token:"key_repository" default:"/etc/yunion/keystone/fernet-keys"`
 	CredentialKeyRepository string `help:"fernet key repo directory for credential" token:"credential_key_repository"`
 
+	WebSSOTrustedDashboard []string `help:"origin URLs allowed to receive tokens of web single sign-on" token:"trusted_dashboard"`
+	WebSSOTimeoutSeconds   int      `default:"600" help:"seconds allowed to sign in at the identity provider"`
+
+	RevocationEventsWorkerCount int `default:"1024" help:"workers serving long polling requests of revocation events, one for each service process watching the feed"`
+
 	AdminUserName        string `help:"Administrative user name" default:"sysadmin"`
 	AdminUserDomainId    string `help:"Domain id of administrative user" default:"default"`
 	AdminProjectName     string `help:"Administrative project name" default:"system"`
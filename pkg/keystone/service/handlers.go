@@ -55,6 +55,8 @@ func initHandlers(app *appsrv.Application) {
 		models.ImpliedRoleManager,
 		models.UserOptionManager,
 		models.IdpRemoteIdsManager,
+		models.RevocationEventManager,
+		models.UsedNonceManager,
 	} {
 		db.RegisterModelManager(manager)
 	}
@@ -72,6 +74,7 @@ func initHandlers(app *appsrv.Application) {
 		models.AssignmentManager,
 		models.PolicyManager,
 		models.CredentialManager,
+		models.ApplicationCredentialManager,
 	} {
 		db.RegisterModelManager(manager)
 		handler := db.NewModelHandler(manager)
@@ -30,21 +30,39 @@ import (
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
 
-func authUserByTokenV2(ctx context.Context, input mcclient.SAuthenticationInputV2) (*models.SUserExtended, error) {
+func authUserByTokenV2(ctx context.Context, input mcclient.SAuthenticationInputV2) (*models.SUserExtended, []string, error) {
 	return authUserByToken(ctx, input.Auth.Token.Id)
 }
 
-func authUserByTokenV3(ctx context.Context, input mcclient.SAuthenticationInputV3) (*models.SUserExtended, error) {
+func authUserByTokenV3(ctx context.Context, input mcclient.SAuthenticationInputV3) (*models.SUserExtended, []string, error) {
 	return authUserByToken(ctx, input.Auth.Identity.Token.Id)
 }
 
-func authUserByToken(ctx context.Context, tokenStr string) (*models.SUserExtended, error) {
+// authUserByToken also returns the methods the token was issued with, so
+// that a rescoped token keeps the factors of the original authentication
+func authUserByToken(ctx context.Context, tokenStr string) (*models.SUserExtended, []string, error) {
 	token := SAuthToken{}
 	err := token.ParseFernetToken(tokenStr)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if len(token.AppCredId) > 0 {
+		// would otherwise gain all roles of the user
+		return nil, nil, errors.New("token of application credential cannot be rescoped")
+	}
+	err = token.checkRevoked()
+	if err != nil {
+		return nil, nil, err
 	}
-	return models.UserManager.FetchUserExtended(token.UserId, "", "", "")
+	user, err := models.UserManager.FetchUserExtended(token.UserId, "", "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	methods := token.Methods
+	if !utils.IsInStringArray(api.AUTH_METHOD_TOKEN, methods) {
+		methods = append(methods, api.AUTH_METHOD_TOKEN)
+	}
+	return user, methods, nil
 }
 
 func authUserByPasswordV2(ctx context.Context, input mcclient.SAuthenticationInputV2) (*models.SUserExtended, error) {
@@ -80,25 +98,125 @@ func authUserByIdentity(ctx context.Context, ident mcclient.SAuthenticationIdent
 	return usrExt, nil
 }
 
+func authUserByApplicationCredential(ctx context.Context, ident mcclient.SAuthenticationIdentity) (*models.SUserExtended, *models.SApplicationCredential, error) {
+	input := ident.ApplicationCredential
+	var userId string
+	if len(input.Id) == 0 {
+		user, err := models.UserManager.FetchUserExtended(input.User.Id, input.User.Name, input.User.Domain.Id, input.User.Domain.Name)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "FetchUserExtended")
+		}
+		userId = user.Id
+	}
+	appCred, err := models.ApplicationCredentialManager.FetchApplicationCredentialByName(input.Id, input.Name, userId)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "FetchApplicationCredential")
+	}
+	if appCred.IsExpired() {
+		return nil, nil, errors.New("application credential expired")
+	}
+	err = appCred.VerifySecret(input.Secret)
+	if err != nil {
+		return nil, nil, errors.New("invalid application credential secret")
+	}
+	user, err := models.UserManager.FetchUserExtended(appCred.UserId, "", "", "")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "FetchUserExtended")
+	}
+	return user, appCred, nil
+}
+
+func authUserByTotp(ctx context.Context, user *models.SUserExtended, ident mcclient.SAuthenticationIdentity) error {
+	totpUser := ident.Totp.User
+	if len(totpUser.Id) > 0 && totpUser.Id != user.Id {
+		return errors.New("totp user mismatch")
+	}
+	if len(totpUser.Id) == 0 && len(totpUser.Name) > 0 && totpUser.Name != user.Name {
+		return errors.New("totp user mismatch")
+	}
+	err := user.VerifyTotp(ctx, totpUser.Passcode)
+	if err != nil {
+		return errors.Wrap(err, "VerifyTotp")
+	}
+	return nil
+}
+
+// authUserByReceipt completes the authentication of a receipt with the
+// second factor
+func authUserByReceipt(ctx context.Context, ident mcclient.SAuthenticationIdentity) (*models.SUserExtended, []string, error) {
+	receipt, err := decodeAuthReceipt(ident.Receipt)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := models.UserManager.FetchUserExtended(receipt.UserId, "", "", "")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "FetchUserExtended")
+	}
+	err = authUserByTotp(ctx, user, ident)
+	if err != nil {
+		return nil, nil, err
+	}
+	methods := receipt.Methods
+	if !utils.IsInStringArray(api.AUTH_METHOD_TOTP, methods) {
+		methods = append(methods, api.AUTH_METHOD_TOTP)
+	}
+	return user, methods, nil
+}
+
 func AuthenticateV3(ctx context.Context, input mcclient.SAuthenticationInputV3) (*mcclient.TokenCredentialV3, error) {
 	var user *models.SUserExtended
 	var err error
-	if len(input.Auth.Identity.Methods) != 1 {
-		return nil, errors.New("invalid auth methods")
-	}
-	method := input.Auth.Identity.Methods[0]
-	if method == api.AUTH_METHOD_TOKEN {
+	var appCred *models.SApplicationCredential
+	methods := input.Auth.Identity.Methods
+	if utils.IsInStringArray(api.AUTH_METHOD_TOKEN, methods) {
+		if len(methods) != 1 {
+			return nil, errors.New("invalid auth methods")
+		}
 		// auth by token
-		user, err = authUserByTokenV3(ctx, input)
+		user, methods, err = authUserByTokenV3(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+	} else if len(input.Auth.Identity.Receipt) > 0 {
+		if len(methods) != 1 || methods[0] != api.AUTH_METHOD_TOTP {
+			return nil, errors.New("invalid auth methods")
+		}
+		// auth by receipt of the first factor and totp
+		user, methods, err = authUserByReceipt(ctx, input.Auth.Identity)
+		if err != nil {
+			return nil, err
+		}
+	} else if utils.IsInStringArray(api.AUTH_METHOD_APPCRED, methods) {
+		if len(methods) != 1 {
+			return nil, errors.New("invalid auth methods")
+		}
+		// auth by application credential, no second factor for automation
+		user, appCred, err = authUserByApplicationCredential(ctx, input.Auth.Identity)
 		if err != nil {
 			return nil, err
 		}
 	} else {
+		// totp is only a second factor on top of one primary method
+		withTotp := utils.IsInStringArray(api.AUTH_METHOD_TOTP, methods)
+		if (withTotp && len(methods) != 2) || (!withTotp && len(methods) != 1) {
+			return nil, errors.New("invalid auth methods")
+		}
 		// auth by other methods, password, openid, saml, etc...
 		user, err = authUserByIdentityV3(ctx, input)
 		if err != nil {
 			return nil, err
 		}
+		if user != nil {
+			if withTotp {
+				err = authUserByTotp(ctx, user, input.Auth.Identity)
+				if err != nil {
+					return nil, err
+				}
+			} else if user.IsMfaRequired() {
+				return nil, newMfaRequiredError(user, methods)
+			}
+			user.ClearFailedAuth()
+		}
 	}
 	// user not found
 	if user == nil {
@@ -112,11 +230,15 @@ func AuthenticateV3(ctx context.Context, input mcclient.SAuthenticationInputV3)
 	}
 	token := SAuthToken{}
 	token.UserId = user.Id
-	token.Method = method
+	token.Methods = methods
 	token.AuditIds = []string{utils.GenRequestId(16)}
 	now := time.Now().UTC()
 	token.ExpiresAt = now.Add(time.Duration(options.Options.TokenExpirationSeconds) * time.Second)
 
+	if appCred != nil {
+		return token.getAppCredTokenV3(user, appCred, input)
+	}
+
 	if len(input.Auth.Scope.Project.Id) == 0 && len(input.Auth.Scope.Project.Name) == 0 && len(input.Auth.Scope.Domain.Id) == 0 && len(input.Auth.Scope.Domain.Name) == 0 {
 		// unscoped auth
 		return token.getTokenV3(user, nil, nil)
@@ -147,24 +269,55 @@ func AuthenticateV3(ctx context.Context, input mcclient.SAuthenticationInputV3)
 	return token.getTokenV3(user, projExt, domain)
 }
 
+// getAppCredTokenV3 issues a token always scoped to the project of the
+// application credential, expiring no later than the credential
+func (t *SAuthToken) getAppCredTokenV3(user *models.SUserExtended, appCred *models.SApplicationCredential, input mcclient.SAuthenticationInputV3) (*mcclient.TokenCredentialV3, error) {
+	project, err := models.ProjectManager.FetchProjectById(appCred.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	scope := input.Auth.Scope
+	if len(scope.Domain.Id) > 0 || len(scope.Domain.Name) > 0 ||
+		(len(scope.Project.Id) > 0 && scope.Project.Id != project.Id) ||
+		(len(scope.Project.Name) > 0 && scope.Project.Name != project.Name) {
+		return nil, errors.New("application credential cannot be rescoped")
+	}
+	projExt, err := project.FetchExtend()
+	if err != nil {
+		return nil, err
+	}
+	t.ProjectId = project.Id
+	t.AppCredId = appCred.Id
+	if !appCred.ExpiresAt.IsZero() && appCred.ExpiresAt.Before(t.ExpiresAt) {
+		t.ExpiresAt = appCred.ExpiresAt.UTC()
+	}
+	return t.getTokenV3(user, projExt, nil)
+}
+
 func AuthenticateV2(ctx context.Context, input mcclient.SAuthenticationInputV2) (*mcclient.TokenCredentialV2, error) {
 	var user *models.SUserExtended
 	var err error
-	var method string
+	var methods []string
 	if len(input.Auth.Token.Id) > 0 {
 		// auth by token
-		user, err = authUserByTokenV2(ctx, input)
+		user, methods, err = authUserByTokenV2(ctx, input)
 		if err != nil {
 			return nil, err
 		}
-		method = api.AUTH_METHOD_TOKEN
 	} else {
 		// auth by password
 		user, err = authUserByPasswordV2(ctx, input)
 		if err != nil {
 			return nil, err
 		}
-		method = api.AUTH_METHOD_PASSWORD
+		// v2 has no way to carry a second factor
+		if user != nil && user.IsMfaRequired() {
+			return nil, errors.New("totp passcode required, use identity v3")
+		}
+		if user != nil {
+			user.ClearFailedAuth()
+		}
+		methods = []string{api.AUTH_METHOD_PASSWORD}
 	}
 	// user not found
 	if user == nil {
@@ -176,7 +329,7 @@ func AuthenticateV2(ctx context.Context, input mcclient.SAuthenticationInputV2)
 	}
 	token := SAuthToken{}
 	token.UserId = user.Id
-	token.Method = method
+	token.Methods = methods
 	token.AuditIds = []string{utils.GenRequestId(16)}
 	now := time.Now().UTC()
 	token.ExpiresAt = now.Add(time.Duration(options.Options.TokenExpirationSeconds) * time.Second)
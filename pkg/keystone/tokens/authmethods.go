@@ -21,31 +21,49 @@ import (
 func authMethodStr2Id(method string) byte {
 	for i := range api.AUTH_METHODS {
 		if api.AUTH_METHODS[i] == method {
-			return byte(i) + 1
+			return byte(1) << uint(i)
 		}
 	}
 	return 0
 }
 
 func authMethodId2Str(mid byte) string {
-	if mid >= 1 && int(mid) <= len(api.AUTH_METHODS) {
-		return api.AUTH_METHODS[mid-1]
+	for i := range api.AUTH_METHODS {
+		if mid == byte(1)<<uint(i) {
+			return api.AUTH_METHODS[i]
+		}
 	}
 	return ""
 }
 
-func authMethodsStr2Id(methods []string) []byte {
-	ret := make([]byte, len(methods))
+// authMethodsStr2Id packs methods into a single byte of method bit flags
+func authMethodsStr2Id(methods []string) byte {
+	ret := byte(0)
 	for i := range methods {
-		ret[i] = authMethodStr2Id(methods[i])
+		ret |= authMethodStr2Id(methods[i])
 	}
 	return ret
 }
 
-func authMethodsId2Str(mids []byte) []string {
-	ret := make([]string, len(mids))
-	for i := range mids {
-		ret[i] = authMethodId2Str(mids[i])
+func authMethodsId2Str(mids byte) []string {
+	ret := make([]string, 0)
+	for i := range api.AUTH_METHODS {
+		if mids&(byte(1)<<uint(i)) != 0 {
+			ret = append(ret, api.AUTH_METHODS[i])
+		}
 	}
 	return ret
 }
+
+// legacyAuthMethods are AUTH_METHODS before methods were recorded as bit
+// flags
+var legacyAuthMethods = []string{api.AUTH_METHOD_PASSWORD, api.AUTH_METHOD_TOKEN}
+
+// legacyAuthMethodId2Str decodes the method of legacy payloads, which is the
+// index+1 of the method in legacyAuthMethods
+func legacyAuthMethodId2Str(mid byte) []string {
+	if mid >= 1 && int(mid) <= len(legacyAuthMethods) {
+		return []string{legacyAuthMethods[mid-1]}
+	}
+	return []string{}
+}
@@ -0,0 +1,262 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tokens
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/keystone/driver"
+	"yunion.io/x/onecloud/pkg/keystone/keys"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+	"yunion.io/x/onecloud/pkg/keystone/options"
+	"yunion.io/x/onecloud/pkg/util/samlutils"
+)
+
+// SWebSSOState travels through the identity provider encrypted with the
+// token keys, so that the callback needs no server side session
+type SWebSSOState struct {
+	DomainId string `json:"domain_id"`
+	Nonce    string `json:"nonce"`
+	Origin   string `json:"origin"`
+}
+
+// webSSOStateCookie binds the state to the user agent that started the
+// sign-in, so that a callback with the state of another one is refused
+const webSSOStateCookie = "websso_state"
+
+func webSSOStateHash(stateStr string) string {
+	sum := sha256.Sum256([]byte(stateStr))
+	return hex.EncodeToString(sum[:])
+}
+
+func setWebSSOStateCookie(w http.ResponseWriter, r *http.Request, domainId string, stateStr string) {
+	cookie := &http.Cookie{
+		Name:     webSSOStateCookie,
+		Value:    webSSOStateHash(stateStr),
+		Path:     fmt.Sprintf("/v3/auth/OS-FEDERATION/domains/%s/", domainId),
+		MaxAge:   options.Options.WebSSOTimeoutSeconds,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		// SAML responses are posted back across sites
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+}
+
+func clearWebSSOStateCookie(w http.ResponseWriter, domainId string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:   webSSOStateCookie,
+		Path:   fmt.Sprintf("/v3/auth/OS-FEDERATION/domains/%s/", domainId),
+		MaxAge: -1,
+	})
+}
+
+func checkWebSSOStateCookie(r *http.Request, stateStr string) bool {
+	cookie, err := r.Cookie(webSSOStateCookie)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(webSSOStateHash(stateStr))) == 1
+}
+
+// consumeNonce makes a sign-in callback usable only once, across keystone
+// instances
+func consumeNonce(nonce string) bool {
+	ok, err := models.UsedNonceManager.Consume(nonce, time.Now().Add(webSSOTimeout()))
+	if err != nil {
+		log.Errorf("consume nonce fail %s", err)
+		return false
+	}
+	return ok
+}
+
+func webSSOTimeout() time.Duration {
+	return time.Duration(options.Options.WebSSOTimeoutSeconds) * time.Second
+}
+
+func fetchFederatedDriver(domainId string) (driver.IFederatedBackend, error) {
+	domain, err := models.DomainManager.FetchDomainById(domainId)
+	if err != nil {
+		return nil, httperrors.NewResourceNotFoundError("domain %s not found", domainId)
+	}
+	if domain.Enabled.IsFalse() {
+		return nil, httperrors.NewForbiddenError("domain %s disabled", domainId)
+	}
+	conf, err := domain.GetConfig(true)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetConfig")
+	}
+	drv, err := driver.GetDriver(domain.Id, conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "driver.GetDriver")
+	}
+	fedDrv, ok := drv.(driver.IFederatedBackend)
+	if !ok {
+		return nil, httperrors.NewUnsupportOperationError("domain %s does not support web SSO", domainId)
+	}
+	return fedDrv, nil
+}
+
+func webSSOLogin(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params, _, _ := appsrv.FetchEnv(ctx, w, r)
+	domainId := params["<domain_id>"]
+	origin := r.URL.Query().Get("origin")
+	if len(origin) > 0 && !utils.IsInStringArray(origin, options.Options.WebSSOTrustedDashboard) {
+		httperrors.ForbiddenError(w, "origin %s is not a trusted dashboard", origin)
+		return
+	}
+	drv, err := fetchFederatedDriver(domainId)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	state := SWebSSOState{
+		DomainId: domainId,
+		// the nonce also serves as SAML request ID, which must not start
+		// with a digit
+		Nonce:  "_" + utils.GenRequestId(20),
+		Origin: origin,
+	}
+	stateStr, err := keys.TokenKeysManager.Encrypt([]byte(jsonutils.Marshal(state).String()))
+	if err != nil {
+		httperrors.InternalServerError(w, "encrypt state %s", err)
+		return
+	}
+	redirectUri, err := drv.GetSSORedirectUri(ctx, state.Nonce, string(stateStr))
+	if err != nil {
+		httperrors.InternalServerError(w, "GetSSORedirectUri %s", err)
+		return
+	}
+	setWebSSOStateCookie(w, r, domainId, string(stateStr))
+	http.Redirect(w, r, redirectUri, http.StatusFound)
+}
+
+func decodeWebSSOState(stateStr string) (*SWebSSOState, error) {
+	stateJson := keys.TokenKeysManager.Decrypt([]byte(stateStr), webSSOTimeout())
+	if stateJson == nil {
+		return nil, errors.New("invalid or expired state")
+	}
+	obj, err := jsonutils.Parse(stateJson)
+	if err != nil {
+		return nil, errors.Wrap(err, "jsonutils.Parse")
+	}
+	state := SWebSSOState{}
+	err = obj.Unmarshal(&state)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+	return &state, nil
+}
+
+// webSSOCallback receives the user agent back from the identity provider,
+// by GET with state for OpenID Connect and by POST with RelayState for SAML
+func webSSOCallback(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	params, _, _ := appsrv.FetchEnv(ctx, w, r)
+	domainId := params["<domain_id>"]
+	err := r.ParseForm()
+	if err != nil {
+		httperrors.InvalidInputError(w, "invalid form %s", err)
+		return
+	}
+	stateStr := r.Form.Get("state")
+	if len(stateStr) == 0 {
+		stateStr = r.Form.Get("RelayState")
+	}
+	state, err := decodeWebSSOState(stateStr)
+	if err != nil {
+		httperrors.UnauthorizedError(w, "unauthorized %s", err)
+		return
+	}
+	if state.DomainId != domainId {
+		httperrors.UnauthorizedError(w, "unauthorized state of another domain")
+		return
+	}
+	if !checkWebSSOStateCookie(r, stateStr) {
+		httperrors.UnauthorizedError(w, "unauthorized state of another user agent")
+		return
+	}
+	clearWebSSOStateCookie(w, domainId)
+	if !consumeNonce(state.Nonce) {
+		httperrors.UnauthorizedError(w, "unauthorized state already used")
+		return
+	}
+	drv, err := fetchFederatedDriver(domainId)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	user, err := drv.AuthenticateSSO(ctx, state.Nonce, r.Form)
+	if err != nil {
+		log.Errorf("web SSO of domain %s fail %s", domainId, err)
+		httperrors.UnauthorizedError(w, "unauthorized %s", err)
+		return
+	}
+	if !user.Enabled {
+		httperrors.UnauthorizedError(w, "user not enabled")
+		return
+	}
+	if user.IsMfaRequired() {
+		// the identity provider cannot collect our second factor, hand out
+		// a receipt to be redeemed with a totp passcode instead of a token
+		err := newMfaRequiredError(user, []string{drv.AuthMethod()})
+		if e, ok := err.(*SMfaRequiredError); ok && len(state.Origin) > 0 {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, samlutils.AutoPostForm(state.Origin, map[string]string{"receipt": e.Receipt}))
+			return
+		}
+		if !writeMfaRequiredError(w, err) {
+			httperrors.InternalServerError(w, "%s", err)
+		}
+		return
+	}
+
+	token := SAuthToken{}
+	token.UserId = user.Id
+	token.Methods = []string{drv.AuthMethod()}
+	token.AuditIds = []string{utils.GenRequestId(16)}
+	token.ExpiresAt = time.Now().UTC().Add(time.Duration(options.Options.TokenExpirationSeconds) * time.Second)
+	v3token, err := token.getTokenV3(user, nil, nil)
+	if err != nil {
+		httperrors.InternalServerError(w, "getTokenV3 %s", err)
+		return
+	}
+
+	if len(state.Origin) > 0 {
+		// hand the unscoped token over to the dashboard, as keystone does
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, samlutils.AutoPostForm(state.Origin, map[string]string{"token": v3token.Id}))
+		return
+	}
+	w.Header().Set(api.AUTH_SUBJECT_TOKEN_HEADER, v3token.Id)
+	v3token.Id = ""
+	appsrv.SendJSON(w, jsonutils.Marshal(v3token))
+}
@@ -17,6 +17,9 @@ package tokens
 import (
 	"context"
 	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -26,15 +29,37 @@ import (
 	"yunion.io/x/onecloud/pkg/cloudcommon/policy"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/keystone/models"
+	"yunion.io/x/onecloud/pkg/keystone/options"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 )
 
+const (
+	maxRevocationWait = 60 * time.Second
+)
+
 func AddHandler(app *appsrv.Application) {
+	// each process watching the revocation feed keeps a worker waiting,
+	// size the pool for all hosts, lbagents and services of the region.
+	// Waiting workers hold no db connection, the pool is not sized by them
+	revocationWorkerMan := appsrv.NewWorkerManager("revocation_events_worker",
+		options.Options.RevocationEventsWorkerCount, appsrv.DEFAULT_BACKLOG, false)
+
 	app.AddHandler2("POST", "/v2.0/tokens", authenticateTokensV2, nil, "auth_tokens_v2", nil)
 	app.AddHandler2("POST", "/v3/auth/tokens", authenticateTokensV3, nil, "auth_tokens_v3", nil)
 	app.AddHandler2("GET", "/v2.0/tokens/<token>", authenticateToken(verifyTokensV2), nil, "verify_tokens_v2", nil)
 	app.AddHandler2("GET", "/v3/auth/tokens", authenticateToken(verifyTokensV3), nil, "verify_tokens_v3", nil)
+	app.AddHandler2("DELETE", "/v3/auth/tokens", authenticateToken(revokeTokensV3), nil, "revoke_tokens_v3", nil)
+	// long polling requests are served by dedicated workers
+	app.AddHandler2("GET", "/v3/OS-REVOKE/events", authenticateToken(fetchRevocationEvents), nil, "revocation_events", nil).
+		SetProcessTimeout(2 * maxRevocationWait).SetWorkerManager(revocationWorkerMan)
+	app.AddHandler2("POST", "/v3/auth/password", changePassword, nil, "change_password", nil)
+	app.AddHandler2("POST", "/v3/auth/OS-TOTP/enroll", totpEnrollByReceipt, nil, "totp_enroll_by_receipt", nil)
+	app.AddHandler2("POST", "/v3/auth/OS-TOTP/confirm", totpConfirmByReceipt, nil, "totp_confirm_by_receipt", nil)
+
+	app.AddHandler2("GET", "/v3/auth/OS-FEDERATION/domains/<domain_id>/websso", webSSOLogin, nil, "websso_login", nil)
+	app.AddHandler2("GET", "/v3/auth/OS-FEDERATION/domains/<domain_id>/oidc/callback", webSSOCallback, nil, "websso_oidc_callback", nil)
+	app.AddHandler2("POST", "/v3/auth/OS-FEDERATION/domains/<domain_id>/saml/acs", webSSOCallback, nil, "websso_saml_acs", nil)
 }
 
 func authenticateTokensV2(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -64,8 +89,14 @@ func authenticateTokensV3(ctx context.Context, w http.ResponseWriter, r *http.Re
 		httperrors.InvalidInputError(w, "unrecognized input %s", err)
 		return
 	}
-	log.Debugf("%s", jsonutils.Marshal(&input))
+	if receipt := r.Header.Get(api.AUTH_RECEIPT_HEADER); len(receipt) > 0 {
+		input.Auth.Identity.Receipt = receipt
+	}
+	log.Debugf("%s", jsonutils.Marshal(redactAuthInputV3(input)))
 	token, err := AuthenticateV3(ctx, input)
+	if writeMfaRequiredError(w, err) {
+		return
+	}
 	if err != nil {
 		httperrors.UnauthorizedError(w, "unauthorized %s", err)
 		return
@@ -79,6 +110,58 @@ func authenticateTokensV3(ctx context.Context, w http.ResponseWriter, r *http.Re
 	appsrv.SendJSON(w, jsonutils.Marshal(token))
 }
 
+// redactAuthInputV3 returns a copy of input with secrets masked for logging
+func redactAuthInputV3(input mcclient.SAuthenticationInputV3) *mcclient.SAuthenticationInputV3 {
+	redact := func(secret *string) {
+		if len(*secret) > 0 {
+			*secret = "******"
+		}
+	}
+	ident := &input.Auth.Identity
+	redact(&ident.Password.User.Password)
+	redact(&ident.Token.Id)
+	redact(&ident.Totp.User.Passcode)
+	redact(&ident.ApplicationCredential.Secret)
+	redact(&ident.Receipt)
+	return &input
+}
+
+// changePassword lets a local user change the password with the original
+// one, so that a user whose password has expired is able to log in again
+func changePassword(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	_, _, body := appsrv.FetchEnv(ctx, w, r)
+	input := mcclient.SChangePasswordInput{}
+	err := body.Unmarshal(&input)
+	if err != nil {
+		httperrors.InvalidInputError(w, "unrecognized input %s", err)
+		return
+	}
+	if len(input.User.Password) == 0 {
+		httperrors.InputParameterError(w, "missing password")
+		return
+	}
+	user, err := models.UserManager.FetchUserExtended(
+		input.User.Id,
+		input.User.Name,
+		input.User.Domain.Id,
+		input.User.Domain.Name,
+	)
+	if err == nil && !user.Enabled {
+		err = errors.New("user not enabled")
+	}
+	if err != nil {
+		log.Errorf("change password of user %s: %s", input.User.Name, err)
+		httperrors.InvalidCredentialError(w, "%s", models.ErrInvalidUserOrPassword)
+		return
+	}
+	err = user.ChangePassword(ctx, input.User.OriginalPassword, input.User.Password, input.User.Passcode)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	appsrv.SendJSON(w, jsonutils.NewDict())
+}
+
 func verifyTokensV2(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	params, _, _ := appsrv.FetchEnv(ctx, w, r)
 	tokenStr := params["<token>"]
@@ -151,6 +234,55 @@ func verifyTokensV3(ctx context.Context, w http.ResponseWriter, r *http.Request)
 	appsrv.SendJSON(w, jsonutils.Marshal(v3token))
 }
 
+// revokeTokensV3 revokes the subject token, either by its owner, e.g. on
+// logout, or by an admin
+func revokeTokensV3(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tokenStr := r.Header.Get(api.AUTH_SUBJECT_TOKEN_HEADER)
+	token := SAuthToken{}
+	err := token.ParseFernetToken(tokenStr)
+	if err != nil || len(token.AuditIds) == 0 {
+		httperrors.InvalidCredentialError(w, "invalid token")
+		return
+	}
+	userCred := policy.FetchUserCredential(ctx)
+	if userCred.GetUserId() != token.UserId && !userCred.IsAdminAllow(api.SERVICE_TYPE, "tokens", "delete") {
+		httperrors.ForbiddenError(w, "not allow to revoke token")
+		return
+	}
+	err = models.RevocationEventManager.RevokeToken(token.AuditIds[0])
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	appsrv.SendJSON(w, jsonutils.NewDict())
+}
+
+// fetchRevocationEvents is the feed of revocation events for the token
+// caches of services. With wait, it holds the request until new events
+// after since show up, at most maxRevocationWait
+func fetchRevocationEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	_, query, _ := appsrv.FetchEnv(ctx, w, r)
+	userCred := policy.FetchUserCredential(ctx)
+	if !userCred.IsAdminAllow(api.SERVICE_TYPE, "tokens", "perform", "auth") {
+		httperrors.ForbiddenError(w, "not allow to fetch revocation events")
+		return
+	}
+	since, _ := query.Int("since")
+	waitSeconds, _ := query.Int("wait")
+	wait := time.Duration(waitSeconds) * time.Second
+	if wait > maxRevocationWait {
+		wait = maxRevocationWait
+	}
+	events, err := models.RevocationEventManager.FetchEvents(since, wait)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	ret := jsonutils.NewDict()
+	ret.Add(jsonutils.Marshal(events), "events")
+	appsrv.SendJSON(w, ret)
+}
+
 func verifyCommon(ctx context.Context, w http.ResponseWriter, tokenStr string) (*SAuthToken, error) {
 	adminToken := policy.FetchUserCredential(ctx)
 	if !adminToken.IsAdminAllow(api.SERVICE_TYPE, "tokens", "perform", "auth") {
@@ -161,6 +293,10 @@ func verifyCommon(ctx context.Context, w http.ResponseWriter, tokenStr string) (
 	if err != nil {
 		return nil, httperrors.NewInvalidCredentialError("invalid token")
 	}
+	err = token.checkRevoked()
+	if err != nil {
+		return nil, err
+	}
 	return &token, nil
 }
 
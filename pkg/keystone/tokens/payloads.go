@@ -28,9 +28,18 @@ import (
 type TScopedPayloadVersion byte
 
 const (
-	SProjectScopedPayloadVersion = TScopedPayloadVersion(2)
-	SDomainScopedPayloadVersion  = TScopedPayloadVersion(1)
-	SUnscopedPayloadVersion      = TScopedPayloadVersion(0)
+	SProjectScopedPayloadVersion = TScopedPayloadVersion(12)
+	SDomainScopedPayloadVersion  = TScopedPayloadVersion(11)
+	SUnscopedPayloadVersion      = TScopedPayloadVersion(10)
+
+	SAppCredScopedPayloadVersion = TScopedPayloadVersion(9)
+
+	// Legacy payloads record a single auth method as its index+1 in
+	// AUTH_METHODS instead of bit flags of methods.  They are decoded
+	// only, so that tokens issued before upgrade keep working
+	SLegacyProjectScopedPayloadVersion = TScopedPayloadVersion(2)
+	SLegacyDomainScopedPayloadVersion  = TScopedPayloadVersion(1)
+	SLegacyUnscopedPayloadVersion      = TScopedPayloadVersion(0)
 )
 
 var (
@@ -92,7 +101,7 @@ func (p *SProjectScopedPayload) Unmarshal(tk []byte) error {
 	if err != nil {
 		return err
 	}
-	if p.Version != SProjectScopedPayloadVersion {
+	if p.Version != SProjectScopedPayloadVersion && p.Version != SLegacyProjectScopedPayloadVersion {
 		return ErrVerMismatch
 	}
 	return nil
@@ -100,7 +109,11 @@ func (p *SProjectScopedPayload) Unmarshal(tk []byte) error {
 
 func (p *SProjectScopedPayload) Decode(token *SAuthToken) {
 	token.UserId = p.UserId.getUuid()
-	token.Method = authMethodId2Str(p.Method)
+	if p.Version == SLegacyProjectScopedPayloadVersion {
+		token.Methods = legacyAuthMethodId2Str(p.Method)
+	} else {
+		token.Methods = authMethodsId2Str(p.Method)
+	}
 	token.ProjectId = p.ProjectId.getUuid()
 	token.ExpiresAt = time.Unix(int64(p.ExpiresAt), 0).UTC()
 	token.AuditIds = auditBytes2Strings(p.AuditIds)
@@ -134,7 +147,7 @@ func (p *SDomainScopedPayload) Unmarshal(tk []byte) error {
 	if err != nil {
 		return err
 	}
-	if p.Version != SDomainScopedPayloadVersion {
+	if p.Version != SDomainScopedPayloadVersion && p.Version != SLegacyDomainScopedPayloadVersion {
 		return ErrVerMismatch
 	}
 	return nil
@@ -142,7 +155,11 @@ func (p *SDomainScopedPayload) Unmarshal(tk []byte) error {
 
 func (p *SDomainScopedPayload) Decode(token *SAuthToken) {
 	token.UserId = p.UserId.getUuid()
-	token.Method = authMethodId2Str(p.Method)
+	if p.Version == SLegacyDomainScopedPayloadVersion {
+		token.Methods = legacyAuthMethodId2Str(p.Method)
+	} else {
+		token.Methods = authMethodsId2Str(p.Method)
+	}
 	token.DomainId = p.DomainId.getUuid()
 	token.ExpiresAt = time.Unix(int64(p.ExpiresAt), 0).UTC()
 	token.AuditIds = auditBytes2Strings(p.AuditIds)
@@ -165,7 +182,7 @@ func (p *SUnscopedPayload) Unmarshal(tk []byte) error {
 	if err != nil {
 		return err
 	}
-	if p.Version != SUnscopedPayloadVersion {
+	if p.Version != SUnscopedPayloadVersion && p.Version != SLegacyUnscopedPayloadVersion {
 		return ErrVerMismatch
 	}
 	return nil
@@ -173,7 +190,11 @@ func (p *SUnscopedPayload) Unmarshal(tk []byte) error {
 
 func (p *SUnscopedPayload) Decode(token *SAuthToken) {
 	token.UserId = p.UserId.getUuid()
-	token.Method = authMethodId2Str(p.Method)
+	if p.Version == SLegacyUnscopedPayloadVersion {
+		token.Methods = legacyAuthMethodId2Str(p.Method)
+	} else {
+		token.Methods = authMethodsId2Str(p.Method)
+	}
 	token.ExpiresAt = time.Unix(int64(p.ExpiresAt), 0).UTC()
 	token.AuditIds = auditBytes2Strings(p.AuditIds)
 }
@@ -182,6 +203,42 @@ func (p *SUnscopedPayload) Encode() ([]byte, error) {
 	return msgpackEncoder(p)
 }
 
+// SAppCredScopedPayload is a project scoped token issued for an application
+// credential, whose roles and access rules are those of the credential
+type SAppCredScopedPayload struct {
+	Version   TScopedPayloadVersion
+	UserId    SUuidPayload
+	Method    byte
+	ProjectId SUuidPayload
+	ExpiresAt float64
+	AuditIds  []string
+	AppCredId SUuidPayload
+}
+
+func (p *SAppCredScopedPayload) Unmarshal(tk []byte) error {
+	err := msgpack.Unmarshal(tk, p)
+	if err != nil {
+		return err
+	}
+	if p.Version != SAppCredScopedPayloadVersion {
+		return ErrVerMismatch
+	}
+	return nil
+}
+
+func (p *SAppCredScopedPayload) Decode(token *SAuthToken) {
+	token.UserId = p.UserId.getUuid()
+	token.Methods = authMethodsId2Str(p.Method)
+	token.ProjectId = p.ProjectId.getUuid()
+	token.ExpiresAt = time.Unix(int64(p.ExpiresAt), 0).UTC()
+	token.AuditIds = auditBytes2Strings(p.AuditIds)
+	token.AppCredId = p.AppCredId.getUuid()
+}
+
+func (p *SAppCredScopedPayload) Encode() ([]byte, error) {
+	return msgpackEncoder(p)
+}
+
 func auditString2Bytes(str string) string {
 	bt, _ := base64.URLEncoding.DecodeString(str + "==")
 	return string(bt)
@@ -0,0 +1,106 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package tokens
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/keystone/keys"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+)
+
+// SAuthReceipt records the first factor a user passed when a second factor
+// is required but not collected at the same time, e.g. web SSO.  It travels
+// encrypted with the token keys and is redeemed with a totp passcode within
+// the web SSO timeout.  Users who have not enrolled totp use it to enroll
+// first
+type SAuthReceipt struct {
+	UserId  string   `json:"user_id"`
+	Methods []string `json:"methods"`
+}
+
+func newAuthReceipt(userId string, methods []string) (string, error) {
+	receipt := SAuthReceipt{
+		UserId:  userId,
+		Methods: methods,
+	}
+	receiptStr, err := keys.TokenKeysManager.Encrypt([]byte(jsonutils.Marshal(receipt).String()))
+	if err != nil {
+		return "", errors.Wrap(err, "Encrypt")
+	}
+	return string(receiptStr), nil
+}
+
+func decodeAuthReceipt(receiptStr string) (*SAuthReceipt, error) {
+	receiptJson := keys.TokenKeysManager.Decrypt([]byte(receiptStr), webSSOTimeout())
+	if receiptJson == nil {
+		return nil, errors.New("invalid or expired receipt")
+	}
+	obj, err := jsonutils.Parse(receiptJson)
+	if err != nil {
+		return nil, errors.Wrap(err, "jsonutils.Parse")
+	}
+	receipt := SAuthReceipt{}
+	err = obj.Unmarshal(&receipt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+	if len(receipt.UserId) == 0 || len(receipt.Methods) == 0 {
+		return nil, errors.New("invalid receipt")
+	}
+	return &receipt, nil
+}
+
+// SMfaRequiredError is returned when the first factor passed but a totp
+// passcode is required
+type SMfaRequiredError struct {
+	Receipt  string
+	Enrolled bool
+}
+
+func (e *SMfaRequiredError) Error() string {
+	if !e.Enrolled {
+		return "totp enrollment required"
+	}
+	return "totp passcode required"
+}
+
+func newMfaRequiredError(user *models.SUserExtended, methods []string) error {
+	receipt, err := newAuthReceipt(user.Id, methods)
+	if err != nil {
+		return errors.Wrap(err, "newAuthReceipt")
+	}
+	return &SMfaRequiredError{
+		Receipt:  receipt,
+		Enrolled: user.IsTotpEnabled(),
+	}
+}
+
+// writeMfaRequiredError sends the receipt to redeem, or to enroll with, as
+// a TotpRequiredError.  It returns false if err is of other kinds
+func writeMfaRequiredError(w http.ResponseWriter, err error) bool {
+	e, ok := err.(*SMfaRequiredError)
+	if !ok {
+		return false
+	}
+	w.Header().Set(api.AUTH_RECEIPT_HEADER, e.Receipt)
+	httperrors.JsonClientError(w, httperrors.NewTotpRequiredError("%s", e))
+	return true
+}
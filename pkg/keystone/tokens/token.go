@@ -19,10 +19,14 @@ import (
 	"time"
 
 	"strings"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/keystone/keys"
 	"yunion.io/x/onecloud/pkg/keystone/models"
 	"yunion.io/x/onecloud/pkg/keystone/options"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/fernetool"
 )
 
 var (
@@ -31,17 +35,22 @@ var (
 
 type SAuthToken struct {
 	UserId    string
-	Method    string
+	Methods   []string
 	ProjectId string
 	DomainId  string
 	ExpiresAt time.Time
 	AuditIds  []string
+	AppCredId string
+
+	// IssuedAt is the fernet timestamp, not part of the payload
+	IssuedAt time.Time
 
 	// Token string
 }
 
 func (t *SAuthToken) Decode(tk []byte) error {
 	for _, payload := range []ITokenPayload{
+		&SAppCredScopedPayload{},
 		&SProjectScopedPayload{},
 		&SDomainScopedPayload{},
 		&SUnscopedPayload{},
@@ -60,7 +69,7 @@ func (t *SAuthToken) getProjectScopedPayload() ITokenPayload {
 	p.Version = SProjectScopedPayloadVersion
 	p.UserId.parse(t.UserId)
 	p.ProjectId.parse(t.ProjectId)
-	p.Method = authMethodStr2Id(t.Method)
+	p.Method = authMethodsStr2Id(t.Methods)
 	p.ExpiresAt = float64(t.ExpiresAt.Unix())
 	p.AuditIds = auditStrings2Bytes(t.AuditIds)
 	return &p
@@ -71,7 +80,7 @@ func (t *SAuthToken) getDomainScopedPayload() ITokenPayload {
 	p.Version = SDomainScopedPayloadVersion
 	p.UserId.parse(t.UserId)
 	p.DomainId.parse(t.DomainId)
-	p.Method = authMethodStr2Id(t.Method)
+	p.Method = authMethodsStr2Id(t.Methods)
 	p.ExpiresAt = float64(t.ExpiresAt.Unix())
 	p.AuditIds = auditStrings2Bytes(t.AuditIds)
 	return &p
@@ -81,13 +90,28 @@ func (t *SAuthToken) getUnscopedPayload() ITokenPayload {
 	p := SUnscopedPayload{}
 	p.Version = SUnscopedPayloadVersion
 	p.UserId.parse(t.UserId)
-	p.Method = authMethodStr2Id(t.Method)
+	p.Method = authMethodsStr2Id(t.Methods)
+	p.ExpiresAt = float64(t.ExpiresAt.Unix())
+	p.AuditIds = auditStrings2Bytes(t.AuditIds)
+	return &p
+}
+
+func (t *SAuthToken) getAppCredScopedPayload() ITokenPayload {
+	p := SAppCredScopedPayload{}
+	p.Version = SAppCredScopedPayloadVersion
+	p.UserId.parse(t.UserId)
+	p.ProjectId.parse(t.ProjectId)
+	p.Method = authMethodsStr2Id(t.Methods)
 	p.ExpiresAt = float64(t.ExpiresAt.Unix())
 	p.AuditIds = auditStrings2Bytes(t.AuditIds)
+	p.AppCredId.parse(t.AppCredId)
 	return &p
 }
 
 func (t *SAuthToken) getPayload() ITokenPayload {
+	if len(t.AppCredId) > 0 {
+		return t.getAppCredScopedPayload()
+	}
 	if len(t.ProjectId) > 0 {
 		return t.getProjectScopedPayload()
 	}
@@ -107,6 +131,74 @@ func (t *SAuthToken) ParseFernetToken(tokenStr string) error {
 	if err != nil {
 		return err
 	}
+	t.IssuedAt, err = fernetool.Timestamp([]byte(tokenStr))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkRevoked fails if the token has been revoked by a revocation event
+func (t *SAuthToken) checkRevoked() error {
+	events, err := models.RevocationEventManager.FetchTokenEvents(t.UserId, t.ProjectId, t.AuditIds, t.IssuedAt)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	info := api.STokenRevocationInfo{
+		UserId:    t.UserId,
+		ProjectId: t.ProjectId,
+		AuditIds:  t.AuditIds,
+		IssuedAt:  t.IssuedAt,
+	}
+	if needRevocationScope(events) {
+		err = t.fillRevocationScope(&info)
+		if err != nil {
+			return err
+		}
+	}
+	if api.IsRevoked(events, info) {
+		return httperrors.NewInvalidCredentialError("token revoked")
+	}
+	return nil
+}
+
+// needRevocationScope tells whether any of the events revokes by domain or
+// role, which takes the domains and roles of the token to match
+func needRevocationScope(events []api.SRevocationEvent) bool {
+	for i := range events {
+		if len(events[i].DomainId) > 0 || len(events[i].RoleId) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *SAuthToken) fillRevocationScope(info *api.STokenRevocationInfo) error {
+	user, err := models.UserManager.FetchUserExtended(t.UserId, "", "", "")
+	if err != nil {
+		return err
+	}
+	info.DomainIds = []string{user.DomainId}
+	if len(t.ProjectId) > 0 {
+		proj, err := models.ProjectManager.FetchProjectById(t.ProjectId)
+		if err != nil {
+			return err
+		}
+		info.DomainIds = append(info.DomainIds, proj.DomainId)
+	} else if len(t.DomainId) > 0 {
+		info.DomainIds = append(info.DomainIds, t.DomainId)
+	}
+	roles, err := t.getRoles()
+	if err != nil {
+		return err
+	}
+	info.RoleIds = make([]string, len(roles))
+	for i := range roles {
+		info.RoleIds[i] = roles[i].Id
+	}
 	return nil
 }
 
@@ -134,6 +226,7 @@ func (t *SAuthToken) GetSimpleUserCred(token string) (mcclient.TokenCredential,
 		Domain:   userExt.DomainName,
 		DomainId: userExt.DomainId,
 		Expires:  t.ExpiresAt,
+		AuditIds: t.AuditIds,
 	}
 	var roles []models.SRole
 	if len(t.ProjectId) > 0 {
@@ -155,6 +248,14 @@ func (t *SAuthToken) GetSimpleUserCred(token string) (mcclient.TokenCredential,
 		ret.ProjectDomain = domain.Name
 		roles, err = models.AssignmentManager.FetchUserProjectRoles(t.UserId, t.DomainId)
 	}
+	appCred, err := t.fetchAppCred()
+	if err != nil {
+		return nil, err
+	}
+	if appCred != nil {
+		roles = appCred.FilterRoles(roles)
+		ret.AccessRules = appCred.GetAccessRules()
+	}
 	roleStrs := make([]string, len(roles))
 	for i := range roles {
 		roleStrs[i] = roles[i].Name
@@ -163,6 +264,25 @@ func (t *SAuthToken) GetSimpleUserCred(token string) (mcclient.TokenCredential,
 	return &ret, nil
 }
 
+// fetchAppCred returns the application credential a token was issued for,
+// which must still exist and not be expired for the token to be valid
+func (t *SAuthToken) fetchAppCred() (*models.SApplicationCredential, error) {
+	if len(t.AppCredId) == 0 {
+		return nil, nil
+	}
+	appCred, err := models.ApplicationCredentialManager.FetchApplicationCredential(t.AppCredId)
+	if err != nil {
+		return nil, httperrors.NewInvalidCredentialError("invalid application credential %s", err)
+	}
+	if appCred.UserId != t.UserId || appCred.ProjectId != t.ProjectId {
+		return nil, httperrors.NewInvalidCredentialError("application credential mismatch")
+	}
+	if appCred.IsExpired() {
+		return nil, httperrors.NewInvalidCredentialError("application credential expired")
+	}
+	return appCred, nil
+}
+
 func (t *SAuthToken) getRoles() ([]models.SRole, error) {
 	var roleProjectId string
 	if len(t.ProjectId) > 0 {
@@ -170,10 +290,21 @@ func (t *SAuthToken) getRoles() ([]models.SRole, error) {
 	} else if len(t.DomainId) > 0 {
 		roleProjectId = t.DomainId
 	}
-	if len(roleProjectId) > 0 {
-		return models.AssignmentManager.FetchUserProjectRoles(t.UserId, roleProjectId)
+	if len(roleProjectId) == 0 {
+		return nil, nil
+	}
+	roles, err := models.AssignmentManager.FetchUserProjectRoles(t.UserId, roleProjectId)
+	if err != nil {
+		return nil, err
+	}
+	appCred, err := t.fetchAppCred()
+	if err != nil {
+		return nil, err
+	}
+	if appCred != nil {
+		roles = appCred.FilterRoles(roles)
 	}
-	return nil, nil
+	return roles, nil
 }
 
 func (t *SAuthToken) getTokenV3(
@@ -185,7 +316,7 @@ func (t *SAuthToken) getTokenV3(
 	token.Token.ExpiresAt = t.ExpiresAt
 	token.Token.IssuedAt = t.ExpiresAt.Add(-time.Duration(options.Options.TokenExpirationSeconds) * time.Second)
 	token.Token.AuditIds = t.AuditIds
-	token.Token.Methods = []string{t.Method}
+	token.Token.Methods = t.Methods
 	token.Token.User.Id = user.Id
 	token.Token.User.Name = user.Name
 	token.Token.User.Domain.Id = user.DomainId
@@ -202,6 +333,18 @@ func (t *SAuthToken) getTokenV3(
 		return nil, err
 	}
 
+	if len(t.AppCredId) > 0 {
+		appCred, err := t.fetchAppCred()
+		if err != nil {
+			return nil, err
+		}
+		token.Token.ApplicationCredential = &mcclient.KeystoneApplicationCredentialV3{
+			Id:          appCred.Id,
+			Name:        appCred.Name,
+			AccessRules: appCred.GetAccessRules(),
+		}
+	}
+
 	if len(roles) > 0 {
 		if project != nil {
 			token.Token.IsDomain = false
@@ -237,6 +380,10 @@ func (t *SAuthToken) getTokenV2(
 	user *models.SUserExtended,
 	project *models.SProject,
 ) (*mcclient.TokenCredentialV2, error) {
+	if len(t.AppCredId) > 0 {
+		// v2 tokens have no way to carry the access rules
+		return nil, httperrors.NewUnsupportOperationError("application credential not supported by identity v2")
+	}
 	token := mcclient.TokenCredentialV2{}
 	token.User.Name = user.Name
 	token.User.Id = user.Id
@@ -15,12 +15,22 @@
 package tokens
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang-plus/uuid"
 
+	"yunion.io/x/jsonutils"
+
 	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/keystone/keys"
+	"yunion.io/x/onecloud/pkg/keystone/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/util/fernetool"
 )
 
@@ -39,7 +49,7 @@ func TestSAuthToken_Encode(t *testing.T) {
 	for i := 0; i < 10; i += 1 {
 		token := SAuthToken{}
 		token.UserId = newUuid()
-		token.Method = api.AUTH_METHOD_PASSWORD
+		token.Methods = []string{api.AUTH_METHOD_PASSWORD, api.AUTH_METHOD_TOTP}
 		token.ProjectId = newUuid()
 		token.ExpiresAt = time.Now()
 		token.AuditIds = []string{newUuid()}
@@ -64,5 +74,223 @@ func TestSAuthToken_Encode(t *testing.T) {
 		if token.UserId != token2.UserId {
 			t.Fatalf("recovery uuid fail %s != %s", token.UserId, token2.UserId)
 		}
+		if !reflect.DeepEqual(token.Methods, token2.Methods) {
+			t.Fatalf("recovery methods fail %s != %s", token.Methods, token2.Methods)
+		}
+	}
+}
+
+func TestSAuthToken_AppCred(t *testing.T) {
+	token := SAuthToken{}
+	token.UserId = newUuid()
+	token.Methods = []string{api.AUTH_METHOD_APPCRED}
+	token.ProjectId = newUuid()
+	token.ExpiresAt = time.Now()
+	token.AuditIds = []string{newUuid()}
+	token.AppCredId = newUuid()
+
+	tk, err := token.Encode()
+	if err != nil {
+		t.Fatalf("SAuthToken encode fail %s", err)
+	}
+	token2 := SAuthToken{}
+	err = token2.Decode(tk)
+	if err != nil {
+		t.Fatalf("SAuthToken decode fail %s", err)
+	}
+	if token.AppCredId != token2.AppCredId || token.ProjectId != token2.ProjectId {
+		t.Fatalf("recovery application credential fail %#v != %#v", token, token2)
+	}
+	if !reflect.DeepEqual(token.Methods, token2.Methods) {
+		t.Fatalf("recovery methods fail %s != %s", token.Methods, token2.Methods)
+	}
+
+	token.AppCredId = ""
+	tk, err = token.Encode()
+	if err != nil {
+		t.Fatalf("SAuthToken encode fail %s", err)
+	}
+	token3 := SAuthToken{}
+	err = token3.Decode(tk)
+	if err != nil {
+		t.Fatalf("SAuthToken decode fail %s", err)
+	}
+	if len(token3.AppCredId) > 0 || token3.ProjectId != token.ProjectId {
+		t.Fatalf("project scoped token decoded as %#v", token3)
+	}
+}
+
+func TestSAuthToken_LegacyMethod(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload ITokenPayload
+		methods []string
+	}{
+		{
+			name: "project scoped",
+			payload: &SProjectScopedPayload{
+				Version: SLegacyProjectScopedPayloadVersion,
+				Method:  1,
+			},
+			methods: []string{api.AUTH_METHOD_PASSWORD},
+		},
+		{
+			name: "domain scoped",
+			payload: &SDomainScopedPayload{
+				Version: SLegacyDomainScopedPayloadVersion,
+				Method:  2,
+			},
+			methods: []string{api.AUTH_METHOD_TOKEN},
+		},
+		{
+			name: "unscoped",
+			payload: &SUnscopedPayload{
+				Version: SLegacyUnscopedPayloadVersion,
+				Method:  3,
+			},
+			methods: []string{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tk, err := c.payload.Encode()
+			if err != nil {
+				t.Fatalf("payload encode fail %s", err)
+			}
+			token := SAuthToken{}
+			err = token.Decode(tk)
+			if err != nil {
+				t.Fatalf("SAuthToken decode fail %s", err)
+			}
+			if !reflect.DeepEqual(token.Methods, c.methods) {
+				t.Fatalf("legacy methods fail %s != %s", token.Methods, c.methods)
+			}
+		})
+	}
+}
+
+func TestAuthReceipt(t *testing.T) {
+	err := keys.TokenKeysManager.InitKeys("", 2)
+	if err != nil {
+		t.Fatalf("TokenKeysManager InitKeys fail %s", err)
+	}
+	options.Options.WebSSOTimeoutSeconds = 300
+
+	userId := newUuid()
+	receiptStr, err := newAuthReceipt(userId, []string{api.AUTH_METHOD_OPENID})
+	if err != nil {
+		t.Fatalf("newAuthReceipt fail %s", err)
+	}
+	receipt, err := decodeAuthReceipt(receiptStr)
+	if err != nil {
+		t.Fatalf("decodeAuthReceipt fail %s", err)
+	}
+	if receipt.UserId != userId || !reflect.DeepEqual(receipt.Methods, []string{api.AUTH_METHOD_OPENID}) {
+		t.Fatalf("recovery receipt fail %#v", receipt)
+	}
+
+	token := SAuthToken{}
+	if token.Decode(keys.TokenKeysManager.Decrypt([]byte(receiptStr), time.Hour)) == nil {
+		t.Fatalf("receipt decoded as token %#v", token)
+	}
+	if _, err := decodeAuthReceipt(receiptStr[:len(receiptStr)-4]); err == nil {
+		t.Fatalf("corrupted receipt accepted")
+	}
+}
+
+func TestWriteMfaRequiredError(t *testing.T) {
+	w := httptest.NewRecorder()
+	if writeMfaRequiredError(w, errors.New("unauthorized")) {
+		t.Fatalf("other errors written as mfa required")
+	}
+	w = httptest.NewRecorder()
+	if !writeMfaRequiredError(w, &SMfaRequiredError{Receipt: "receipt"}) {
+		t.Fatalf("mfa required error not written")
+	}
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("want status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if receipt := w.Header().Get(api.AUTH_RECEIPT_HEADER); receipt != "receipt" {
+		t.Errorf("want receipt header, got %q", receipt)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "TotpRequiredError") || !strings.Contains(body, "totp enrollment required") {
+		t.Errorf("unexpected body %s", body)
+	}
+}
+
+func TestRedactAuthInputV3(t *testing.T) {
+	input := mcclient.SAuthenticationInputV3{}
+	input.Auth.Identity.Methods = []string{api.AUTH_METHOD_PASSWORD, api.AUTH_METHOD_TOTP}
+	input.Auth.Identity.Password.User.Name = "alice"
+	input.Auth.Identity.Password.User.Password = "pass-secret"
+	input.Auth.Identity.Totp.User.Passcode = "123456"
+	input.Auth.Identity.ApplicationCredential.Secret = "appcred-secret"
+	input.Auth.Identity.Receipt = "receipt-secret"
+
+	logged := jsonutils.Marshal(redactAuthInputV3(input)).String()
+	for _, secret := range []string{"pass-secret", "123456", "appcred-secret", "receipt-secret"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("%s logged in %s", secret, logged)
+		}
+	}
+	if !strings.Contains(logged, "alice") {
+		t.Errorf("user name missing in %s", logged)
+	}
+	if input.Auth.Identity.Password.User.Password != "pass-secret" {
+		t.Errorf("input modified")
+	}
+}
+
+func TestWebSSOStateCookie(t *testing.T) {
+	options.Options.WebSSOTimeoutSeconds = 300
+	login := httptest.NewRequest("GET", "https://keystone/v3/auth/OS-FEDERATION/domains/d1/websso", nil)
+	w := httptest.NewRecorder()
+	setWebSSOStateCookie(w, login, "d1", "state1")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want 1 cookie, got %d", len(cookies))
+	}
+	if !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].Path != "/v3/auth/OS-FEDERATION/domains/d1/" {
+		t.Errorf("unexpected cookie %#v", cookies[0])
+	}
+
+	cases := []struct {
+		name   string
+		cookie *http.Cookie
+		state  string
+		want   bool
+	}{
+		{"same state", cookies[0], "state1", true},
+		{"other state", cookies[0], "state2", false},
+		{"no cookie", nil, "state1", false},
+	}
+	for _, c := range cases {
+		callback := httptest.NewRequest("GET", "https://keystone/v3/auth/OS-FEDERATION/domains/d1/oidc/callback", nil)
+		if c.cookie != nil {
+			callback.AddCookie(c.cookie)
+		}
+		if got := checkWebSSOStateCookie(callback, c.state); got != c.want {
+			t.Errorf("%s: want %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestNeedRevocationScope(t *testing.T) {
+	cases := []struct {
+		name   string
+		events []api.SRevocationEvent
+		want   bool
+	}{
+		{"none", nil, false},
+		{"user and audit id", []api.SRevocationEvent{{UserId: "u1"}, {AuditId: "a1"}}, false},
+		{"domain", []api.SRevocationEvent{{UserId: "u1"}, {DomainId: "d1"}}, true},
+		{"role", []api.SRevocationEvent{{UserId: "u1", ProjectId: "p1", RoleId: "r1"}}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := needRevocationScope(c.events); got != c.want {
+				t.Errorf("want %#v, got %#v", c.want, got)
+			}
+		})
 	}
 }
@@ -0,0 +1,79 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tokens
+
+import (
+	"context"
+	"net/http"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/keystone/models"
+)
+
+// fetchReceiptUser returns the user of the receipt in the request header.
+// The receipt proves the first factor of a user required to use MFA
+func fetchReceiptUser(r *http.Request) (*models.SUserExtended, error) {
+	receipt, err := decodeAuthReceipt(r.Header.Get(api.AUTH_RECEIPT_HEADER))
+	if err != nil {
+		return nil, httperrors.NewUnauthorizedError("%s", err)
+	}
+	user, err := models.UserManager.FetchUserExtended(receipt.UserId, "", "", "")
+	if err != nil {
+		return nil, httperrors.NewUnauthorizedError("invalid user")
+	}
+	if !user.Enabled {
+		return nil, httperrors.NewUnauthorizedError("user not enabled")
+	}
+	return user, nil
+}
+
+// totpEnrollByReceipt lets a user who has not enrolled totp, yet is required
+// to use it, generate the secret without a token
+func totpEnrollByReceipt(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	user, err := fetchReceiptUser(r)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	ret, err := user.EnrollTotp()
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	appsrv.SendJSON(w, ret)
+}
+
+// totpConfirmByReceipt confirms the secret of totpEnrollByReceipt, after
+// which the receipt is redeemed with a passcode for a token
+func totpConfirmByReceipt(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	_, _, body := appsrv.FetchEnv(ctx, w, r)
+	user, err := fetchReceiptUser(r)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	passcode := ""
+	if body != nil {
+		passcode, _ = body.GetString("passcode")
+	}
+	ret, err := user.ConfirmTotp(passcode)
+	if err != nil {
+		httperrors.GeneralServerError(w, err)
+		return
+	}
+	appsrv.SendJSON(w, ret)
+}
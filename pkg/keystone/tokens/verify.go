@@ -27,6 +27,10 @@ func FernetTokenVerifier(tokenStr string) (mcclient.TokenCredential, error) {
 	if err != nil {
 		return nil, httperrors.NewInvalidCredentialError("invalid token %s", err)
 	}
+	err = token.checkRevoked()
+	if err != nil {
+		return nil, err
+	}
 	userCred, err := token.GetSimpleUserCred(tokenStr)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,113 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lbagent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"yunion.io/x/log"
+
+	agentmodels "yunion.io/x/onecloud/pkg/lbagent/models"
+	"yunion.io/x/onecloud/pkg/util/acmeutils"
+)
+
+// AcmeChallengeServer answers ACME http-01 challenges of loadbalancer
+// certificates.  Haproxy http listeners forward challenge requests of their
+// own pending certificates to it
+type AcmeChallengeServer struct {
+	opts *Options
+
+	mu sync.RWMutex
+	// challenges maps domain to tokens and their key authorizations
+	challenges map[string]map[string]string
+}
+
+func NewAcmeChallengeServer(opts *Options) (*AcmeChallengeServer, error) {
+	s := &AcmeChallengeServer{
+		opts:       opts,
+		challenges: map[string]map[string]string{},
+	}
+	return s, nil
+}
+
+func (s *AcmeChallengeServer) Run(ctx context.Context) {
+	defer func() {
+		log.Infof("acme challenge server bye")
+		wg := ctx.Value("wg").(*sync.WaitGroup)
+		wg.Done()
+	}()
+	srv := &http.Server{
+		Addr:    agentmodels.AcmeChallengeServerAddr,
+		Handler: s,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("acme challenge server: %s", err)
+	}
+}
+
+// SetCorpus updates challenges to serve with those from certificates in
+// corpus.  A token is only answered for domains of the certificate it
+// belongs to
+func (s *AcmeChallengeServer) SetCorpus(corpus *agentmodels.LoadbalancerCorpus) {
+	challenges := map[string]map[string]string{}
+	for _, lbcert := range corpus.LoadbalancerCertificates {
+		if len(lbcert.AcmeChallenges) == 0 {
+			continue
+		}
+		for _, domain := range lbcert.AcmeDomains() {
+			tokens, ok := challenges[domain]
+			if !ok {
+				tokens = map[string]string{}
+				challenges[domain] = tokens
+			}
+			for token, keyAuth := range lbcert.AcmeChallenges {
+				tokens[token] = keyAuth
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.challenges = challenges
+}
+
+func (s *AcmeChallengeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, acmeutils.HTTP01_PATH_PREFIX) {
+		http.NotFound(w, r)
+		return
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	token := r.URL.Path[len(acmeutils.HTTP01_PATH_PREFIX):]
+	s.mu.RLock()
+	keyAuth, ok := s.challenges[host][token]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+}
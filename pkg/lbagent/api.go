@@ -45,6 +45,14 @@ type ApiHelper struct {
 
 	haState         string
 	haStateProvider HaStateProvider
+
+	// backend health status last reported to region
+	backendHealthReported backendHealth
+	// haproxy counters last seen and traffic not yet reported to region
+	haproxyCounters       haproxyCounters
+	backendTrafficPending backendTraffic
+
+	acmeChallengeServer *AcmeChallengeServer
 }
 
 func NewApiHelper(opts *Options) (*ApiHelper, error) {
@@ -102,6 +110,10 @@ func (h *ApiHelper) SetHaStateProvider(hsp HaStateProvider) {
 	h.haStateProvider = hsp
 }
 
+func (h *ApiHelper) SetAcmeChallengeServer(s *AcmeChallengeServer) {
+	h.acmeChallengeServer = s
+}
+
 func (h *ApiHelper) adminClientSession(ctx context.Context) *mcclient.ClientSession {
 	region := h.opts.CommonOptions.Region
 	apiVersion := "v2"
@@ -263,6 +275,50 @@ func (h *ApiHelper) newAgentHbParams(ctx context.Context) (*jsonutils.JSONDict,
 	return params, nil
 }
 
+// backendHealthChanges returns health status of backends changed since last
+// report.  Only the master reports as it's the one serving traffic
+func (h *ApiHelper) backendHealthChanges(ctx context.Context) backendHealth {
+	if h.haState != api.LB_HA_STATE_MASTER {
+		// report in full when we become master again
+		h.backendHealthReported = nil
+		return nil
+	}
+	bh, err := h.collectBackendHealth(ctx)
+	if err != nil {
+		log.Warningf("collect backend health: %s", err)
+		return nil
+	}
+	changes := bh.diff(h.backendHealthReported)
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// backendTrafficToReport returns traffic of backends accumulated since
+// last successful report
+func (h *ApiHelper) backendTrafficToReport(ctx context.Context) backendTraffic {
+	if h.haState != api.LB_HA_STATE_MASTER {
+		h.haproxyCounters = nil
+		h.backendTrafficPending = nil
+		return nil
+	}
+	counters, err := h.collectHaproxyCounters(ctx)
+	if err != nil {
+		log.Warningf("collect backend traffic: %s", err)
+		return nil
+	}
+	if h.backendTrafficPending == nil {
+		h.backendTrafficPending = backendTraffic{}
+	}
+	h.backendTrafficPending.add(counters.delta(h.haproxyCounters))
+	h.haproxyCounters = counters
+	if len(h.backendTrafficPending) == 0 {
+		return nil
+	}
+	return h.backendTrafficPending
+}
+
 func (h *ApiHelper) doHb(ctx context.Context) (*models.LoadbalancerAgent, error) {
 	// TODO check if things changed recently
 	s := h.adminClientSession(ctx)
@@ -270,11 +326,30 @@ func (h *ApiHelper) doHb(ctx context.Context) (*models.LoadbalancerAgent, error)
 	if err != nil {
 		return nil, fmt.Errorf("heartbeat: making params: %s", err)
 	}
+	healthChanges := h.backendHealthChanges(ctx)
+	if healthChanges != nil {
+		params.Set("backend_health", jsonutils.Marshal(healthChanges))
+	}
+	traffic := h.backendTrafficToReport(ctx)
+	if traffic != nil {
+		params.Set("backend_traffic", jsonutils.Marshal(traffic))
+	}
 	data, err := modules.LoadbalancerAgents.PerformAction(s, h.opts.ApiLbagentId, "hb", params)
 	if err != nil {
 		err := fmt.Errorf("heartbeat api error: %s", err)
 		return nil, err
 	}
+	if healthChanges != nil {
+		if h.backendHealthReported == nil {
+			h.backendHealthReported = backendHealth{}
+		}
+		for id, status := range healthChanges {
+			h.backendHealthReported[id] = status
+		}
+	}
+	if traffic != nil {
+		h.backendTrafficPending = nil
+	}
 	agent := &models.LoadbalancerAgent{}
 	err = data.Unmarshal(agent)
 	if err != nil {
@@ -388,6 +463,9 @@ func (h *ApiHelper) doUseCorpus(ctx context.Context) {
 		return
 	}
 	log.Infof("make effect new corpus and params")
+	if h.acmeChallengeServer != nil {
+		h.acmeChallengeServer.SetCorpus(h.corpus)
+	}
 	cmdData := &LbagentCmdUseCorpusData{
 		Corpus:      h.corpus,
 		AgentParams: h.agentParams,
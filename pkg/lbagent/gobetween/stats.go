@@ -0,0 +1,77 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gobetween
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// BackendStats mirrors backend stats returned by gobetween api
+// "GET /servers/:name/stats"
+type BackendStats struct {
+	Live               bool   `json:"live"`
+	Discovered         bool   `json:"discovered"`
+	TotalConnections   int64  `json:"total_connections"`
+	ActiveConnections  uint   `json:"active_connections"`
+	RefusedConnections uint64 `json:"refused_connections"`
+}
+
+type Backend struct {
+	Host     string       `json:"host"`
+	Port     string       `json:"port"`
+	Priority int          `json:"priority"`
+	Weight   int          `json:"weight"`
+	Stats    BackendStats `json:"stats"`
+}
+
+type ServerStats struct {
+	ActiveConnections uint       `json:"active_connections"`
+	Backends          []*Backend `json:"backends"`
+}
+
+// GetServerStats fetches stats of server with the specified name from
+// gobetween api listening at bind
+func GetServerStats(ctx context.Context, api *ApiConfig, name string) (*ServerStats, error) {
+	u := url.URL{
+		Scheme: "http",
+		Host:   api.Bind,
+		Path:   fmt.Sprintf("/servers/%s/stats", url.PathEscape(name)),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if api.BasicAuth != nil {
+		req.SetBasicAuth(api.BasicAuth.Login, api.BasicAuth.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server %s stats: %s", name, resp.Status)
+	}
+	stats := &ServerStats{}
+	if err := json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, fmt.Errorf("server %s stats: decode: %s", name, err)
+	}
+	return stats, nil
+}
@@ -22,6 +22,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -56,9 +58,41 @@ func NewHaproxyHelper(opts *Options) (*HaproxyHelper, error) {
 			return nil, fmt.Errorf("sysctl: %s", err)
 		}
 	}
+	if err := helper.checkHaproxyVersion(); err != nil {
+		return nil, err
+	}
 	return helper, nil
 }
 
+// haproxy 2.2 is required by directives of listener rules, e.g.
+// "http-request return" and "http-request replace-path".  A config check
+// failure blocks reloads of all loadbalancers of the agent, so refuse to
+// start with older haproxy
+const (
+	haproxyMinVersionMajor = 2
+	haproxyMinVersionMinor = 2
+)
+
+var haproxyVersionReg = regexp.MustCompile(`(?i)ha-?proxy version (\d+)\.(\d+)`)
+
+func (h *HaproxyHelper) checkHaproxyVersion() error {
+	output, err := exec.Command(h.opts.HaproxyBin, "-v").Output()
+	if err != nil {
+		return fmt.Errorf("%s -v: %s", h.opts.HaproxyBin, err)
+	}
+	m := haproxyVersionReg.FindStringSubmatch(string(output))
+	if m == nil {
+		return fmt.Errorf("unknown haproxy version: %s", output)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major < haproxyMinVersionMajor || (major == haproxyMinVersionMajor && minor < haproxyMinVersionMinor) {
+		return fmt.Errorf("haproxy %d.%d found, %d.%d or later required",
+			major, minor, haproxyMinVersionMajor, haproxyMinVersionMinor)
+	}
+	return nil
+}
+
 func (h *HaproxyHelper) Run(ctx context.Context) {
 	defer func() {
 		wg := ctx.Value("wg").(*sync.WaitGroup)
@@ -276,7 +310,7 @@ func (h *HaproxyHelper) haproxyPidFile() string {
 }
 
 func (h *HaproxyHelper) haproxyStatsSocketFile() string {
-	return filepath.Join(h.opts.haproxyRunDir, "haproxy.sock")
+	return h.opts.haproxyStatsSocketFile()
 }
 
 func (h *HaproxyHelper) reloadHaproxy(ctx context.Context) error {
@@ -0,0 +1,238 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lbagent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/lbagent/gobetween"
+	agentmodels "yunion.io/x/onecloud/pkg/lbagent/models"
+	agentutils "yunion.io/x/onecloud/pkg/lbagent/utils"
+)
+
+const backendHealthQueryTimeout = 3 * time.Second
+
+type backendHealth map[string]string
+
+// set records status of backend.  A backend may appear in multiple haproxy
+// proxies and it's considered down if any of them says so
+func (bh backendHealth) set(id, status string) {
+	switch bh[id] {
+	case "", api.LB_BACKEND_HEALTH_STATUS_UNKNOWN:
+		bh[id] = status
+	case api.LB_BACKEND_HEALTH_STATUS_UP:
+		if status == api.LB_BACKEND_HEALTH_STATUS_DOWN {
+			bh[id] = status
+		}
+	}
+}
+
+// diff returns entries of bh that differ from those in old.  Backends no
+// longer present in bh are reported as unknown
+func (bh backendHealth) diff(old backendHealth) backendHealth {
+	r := backendHealth{}
+	for id, status := range bh {
+		if old[id] != status {
+			r[id] = status
+		}
+	}
+	for id, status := range old {
+		if _, ok := bh[id]; !ok && status != api.LB_BACKEND_HEALTH_STATUS_UNKNOWN {
+			r[id] = api.LB_BACKEND_HEALTH_STATUS_UNKNOWN
+		}
+	}
+	return r
+}
+
+func haproxyServerHealthStatus(status string) string {
+	switch {
+	case strings.HasPrefix(status, "UP"):
+		// UP, UP 1/3, UP (agent), etc.
+		return api.LB_BACKEND_HEALTH_STATUS_UP
+	case strings.HasPrefix(status, "DOWN"),
+		strings.HasPrefix(status, "MAINT"),
+		status == "DRAIN",
+		status == "NOLB":
+		return api.LB_BACKEND_HEALTH_STATUS_DOWN
+	default:
+		// "no check" when health check is not enabled
+		return api.LB_BACKEND_HEALTH_STATUS_UNKNOWN
+	}
+}
+
+func (h *ApiHelper) collectHaproxyBackendHealth(ctx context.Context, bh backendHealth) error {
+	sockPath := h.opts.haproxyStatsSocketFile()
+	if _, err := os.Stat(sockPath); os.IsNotExist(err) {
+		// haproxy not running yet
+		return nil
+	}
+	stats, err := agentutils.HaproxyShowStat(sockPath, backendHealthQueryTimeout)
+	if err != nil {
+		return fmt.Errorf("haproxy show stat: %s", err)
+	}
+	for _, stat := range stats {
+		// server name is backend id
+		if h.corpus.LoadbalancerBackends[stat.ServerName] == nil {
+			continue
+		}
+		bh.set(stat.ServerName, haproxyServerHealthStatus(stat.Status))
+	}
+	return nil
+}
+
+type backendTrafficEntry struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// backendTraffic is number of requests and errors keyed by backend id
+type backendTraffic map[string]backendTrafficEntry
+
+func (bt backendTraffic) add(other backendTraffic) {
+	for id, e := range other {
+		cur := bt[id]
+		cur.Requests += e.Requests
+		cur.Errors += e.Errors
+		bt[id] = cur
+	}
+}
+
+// haproxyCounters are cumulative counters of servers keyed by proxy and
+// server name, as a backend can appear in multiple proxies
+type haproxyCounters map[string]agentutils.HaproxyServerStat
+
+// delta returns traffic of backends since old.  Servers absent in old are
+// taken as baseline.  Counters smaller than old ones mean haproxy was
+// reloaded, in which case they count from zero
+func (hc haproxyCounters) delta(old haproxyCounters) backendTraffic {
+	r := backendTraffic{}
+	if old == nil {
+		return r
+	}
+	for key, stat := range hc {
+		prev, ok := old[key]
+		if !ok {
+			continue
+		}
+		e := backendTrafficEntry{
+			Requests: stat.Requests - prev.Requests,
+			Errors:   stat.Errors - prev.Errors,
+		}
+		if e.Requests < 0 || e.Errors < 0 {
+			e.Requests, e.Errors = stat.Requests, stat.Errors
+		}
+		if e.Requests == 0 && e.Errors == 0 {
+			continue
+		}
+		r.add(backendTraffic{stat.ServerName: e})
+	}
+	return r
+}
+
+func (h *ApiHelper) collectHaproxyCounters(ctx context.Context) (haproxyCounters, error) {
+	hc := haproxyCounters{}
+	if h.corpus == nil {
+		return hc, nil
+	}
+	sockPath := h.opts.haproxyStatsSocketFile()
+	if _, err := os.Stat(sockPath); os.IsNotExist(err) {
+		return hc, nil
+	}
+	stats, err := agentutils.HaproxyShowStat(sockPath, backendHealthQueryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("haproxy show stat: %s", err)
+	}
+	for _, stat := range stats {
+		if h.corpus.LoadbalancerBackends[stat.ServerName] == nil {
+			continue
+		}
+		hc[stat.ProxyName+"/"+stat.ServerName] = stat
+	}
+	return hc, nil
+}
+
+func (h *ApiHelper) collectGobetweenBackendHealth(ctx context.Context, bh backendHealth) error {
+	apiConfig := agentmodels.GobetweenApiConfig()
+	for _, listener := range h.corpus.LoadbalancerListeners {
+		if listener.ListenerType != api.LB_LISTENER_TYPE_UDP {
+			continue
+		}
+		if listener.Status != api.LB_STATUS_ENABLED || listener.BackendGroupId == "" {
+			continue
+		}
+		backends := map[string]string{}
+		for _, backend := range h.corpus.LoadbalancerBackends {
+			if backend.BackendGroupId == listener.BackendGroupId {
+				addr := fmt.Sprintf("%s:%d", backend.Address, backend.Port)
+				backends[addr] = backend.Id
+			}
+		}
+		if len(backends) == 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, backendHealthQueryTimeout)
+		stats, err := gobetween.GetServerStats(ctx, &apiConfig, listener.Id)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("gobetween: listener %s(%s): %s", listener.Name, listener.Id, err)
+		}
+		healthCheck := listener.HealthCheck == api.LB_BOOL_ON
+		for _, backend := range stats.Backends {
+			id, ok := backends[fmt.Sprintf("%s:%s", backend.Host, backend.Port)]
+			if !ok {
+				continue
+			}
+			status := api.LB_BACKEND_HEALTH_STATUS_UNKNOWN
+			if healthCheck {
+				if backend.Stats.Live {
+					status = api.LB_BACKEND_HEALTH_STATUS_UP
+				} else {
+					status = api.LB_BACKEND_HEALTH_STATUS_DOWN
+				}
+			}
+			bh.set(id, status)
+		}
+	}
+	return nil
+}
+
+// collectBackendHealth gathers health status of backends from haproxy stats
+// socket and gobetween api.  Backends known only to corpus are reported as
+// unknown
+func (h *ApiHelper) collectBackendHealth(ctx context.Context) (backendHealth, error) {
+	bh := backendHealth{}
+	if h.corpus == nil {
+		return bh, nil
+	}
+	if err := h.collectHaproxyBackendHealth(ctx, bh); err != nil {
+		return nil, err
+	}
+	if err := h.collectGobetweenBackendHealth(ctx, bh); err != nil {
+		log.Warningf("collect backend health: %s", err)
+	}
+	for id := range h.corpus.LoadbalancerBackends {
+		if _, ok := bh[id]; !ok {
+			bh[id] = api.LB_BACKEND_HEALTH_STATUS_UNKNOWN
+		}
+	}
+	return bh, nil
+}
@@ -33,6 +33,19 @@ type GenGobetweenConfigOptions struct {
 	Config *gobetween.Config
 }
 
+// GobetweenApiConfig returns api config of gobetween which is also used
+// by lbagent for querying stats of backends
+func GobetweenApiConfig() gobetween.ApiConfig {
+	return gobetween.ApiConfig{
+		Enabled: true,
+		Bind:    "localhost:777",
+		BasicAuth: &gobetween.ApiBasicAuthConfig{
+			Login:    "Yunion",
+			Password: "LBStats",
+		},
+	}
+}
+
 func (b *LoadbalancerCorpus) GenGobetweenConfigs(dir string, opts *GenGobetweenConfigOptions) error {
 	//agentParams := opts.AgentParams
 	// TODO
@@ -42,14 +55,7 @@ func (b *LoadbalancerCorpus) GenGobetweenConfigs(dir string, opts *GenGobetweenC
 	//  - respawn
 	opts.Config = &gobetween.Config{
 		Servers: map[string]gobetween.Server{},
-		Api: gobetween.ApiConfig{
-			Enabled: true,
-			Bind:    "localhost:777",
-			BasicAuth: &gobetween.ApiBasicAuthConfig{
-				Login:    "Yunion",
-				Password: "LBStats",
-			},
-		},
+		Api:     GobetweenApiConfig(),
 	}
 	for _, lb := range opts.LoadbalancersEnabled {
 		for _, listener := range lb.listeners {
@@ -25,12 +25,23 @@ import (
 	"text/template"
 
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/sets"
 
 	agentutils "yunion.io/x/onecloud/pkg/lbagent/utils"
+	"yunion.io/x/onecloud/pkg/mcclient/models"
+	"yunion.io/x/onecloud/pkg/util/acmeutils"
 )
 
 var haproxyConfigErrNop = errors.New("nop haproxy config snippet")
 
+const (
+	// AcmeChallengeServerAddr is where lbagent serves acme http-01
+	// challenges
+	AcmeChallengeServerAddr = "127.0.0.1:778"
+
+	haproxyAcmeChallengeBackend = "acme_challenge"
+)
+
 type GenHaproxyConfigsResult struct {
 	LoadbalancersEnabled []*Loadbalancer
 }
@@ -73,6 +84,10 @@ func (b *LoadbalancerCorpus) GenHaproxyConfigs(dir string, opts *AgentParams) (*
 			}
 		}
 		for _, lbcert := range b.LoadbalancerCertificates {
+			if lbcert.Certificate == "" {
+				// acme certificate not issued yet
+				continue
+			}
 			d := []byte(lbcert.Certificate)
 			if d[len(d)-1] != '\n' {
 				d = append(d, '\n')
@@ -86,6 +101,20 @@ func (b *LoadbalancerCorpus) GenHaproxyConfigs(dir string, opts *AgentParams) (*
 			}
 		}
 	}
+	{
+		p := filepath.Join(dir, "02-acme.cfg")
+		lines := []string{
+			fmt.Sprintf("backend %s", haproxyAcmeChallengeBackend),
+			"	mode http",
+			fmt.Sprintf("	server lbagent %s", AcmeChallengeServerAddr),
+			"",
+		}
+		s := strings.Join(lines, "\n")
+		err := ioutil.WriteFile(p, []byte(s), agentutils.FileModeFile)
+		if err != nil {
+			return nil, fmt.Errorf("write 02-acme.cfg: %s", err)
+		}
+	}
 	for _, lbacl := range b.LoadbalancerAcls {
 		cidrs := []string{}
 		if lbacl.AclEntries != nil {
@@ -369,8 +398,199 @@ func (b *LoadbalancerCorpus) genHaproxyConfigHttpRate(data map[string]interface{
 	return nil
 }
 
+// haproxyRuleConditions returns anonymous acls that all must match for
+// the rule to take effect
+func haproxyRuleConditions(rule *LoadbalancerListenerRule) []string {
+	conds := []string{}
+	if rule.Domain != "" {
+		conds = append(conds, fmt.Sprintf("{ hdr_dom(host) %q }", rule.Domain))
+	}
+	if rule.Path != "" {
+		conds = append(conds, fmt.Sprintf("{ path_beg %q }", rule.Path))
+	}
+	c := rule.Conditions
+	if c == nil {
+		return conds
+	}
+	matchValues := func(fetch string, values []string) string {
+		if len(values) == 0 {
+			return fmt.Sprintf("{ %s -m found }", fetch)
+		}
+		cond := fmt.Sprintf("{ %s -m str", fetch)
+		for _, v := range values {
+			cond += fmt.Sprintf(" %q", v)
+		}
+		return cond + " }"
+	}
+	for _, h := range c.Headers {
+		conds = append(conds, matchValues(fmt.Sprintf("req.hdr(%s)", h.Name), h.Values))
+	}
+	for _, q := range c.QueryParams {
+		conds = append(conds, matchValues(fmt.Sprintf("url_param(%s)", q.Name), q.Values))
+	}
+	if len(c.Methods) > 0 {
+		conds = append(conds, fmt.Sprintf("{ method %s }", strings.Join(c.Methods, " ")))
+	}
+	if len(c.SourceCidrs) > 0 {
+		conds = append(conds, fmt.Sprintf("{ src %s }", strings.Join(c.SourceCidrs, " ")))
+	}
+	return conds
+}
+
+// haproxyRuleRewrites returns http-request rules modifying requests before
+// they are forwarded to backends
+func haproxyRuleRewrites(rule *LoadbalancerListenerRule) []string {
+	lines := []string{}
+	r := rule.Rewrite
+	if r == nil {
+		return lines
+	}
+	if r.PathRegex != "" {
+		lines = append(lines, fmt.Sprintf("http-request replace-path %q %q", r.PathRegex, r.PathReplace))
+	}
+	for _, h := range r.SetHeaders {
+		// values are log-format strings
+		v := strings.Replace(h.Value, "%", "%%", -1)
+		lines = append(lines, fmt.Sprintf("http-request set-header %s %q", h.Name, v))
+	}
+	return lines
+}
+
+// genHaproxyConfigRuleResponse generates a backend without servers that
+// responds to requests by itself
+func (b *LoadbalancerCorpus) genHaproxyConfigRuleResponse(data map[string]interface{}, listener *LoadbalancerListener, rule *LoadbalancerListenerRule) error {
+	var line string
+	switch rule.Action {
+	case "redirect":
+		r := rule.Redirect
+		if r == nil {
+			return fmt.Errorf("rule %s(%s): missing redirect", rule.Name, rule.Id)
+		}
+		if r.Scheme != "" && r.Host == "" && r.Port == 0 && r.Path == "" {
+			line = fmt.Sprintf("http-request redirect scheme %s code %d", r.Scheme, r.Code)
+			break
+		}
+		scheme := r.Scheme
+		if scheme == "" {
+			scheme = listener.ListenerType
+		}
+		host := r.Host
+		if host == "" {
+			if r.Port > 0 {
+				host = "%[req.hdr(host),field(1,:)]"
+			} else {
+				host = "%[req.hdr(host)]"
+			}
+		}
+		if r.Port > 0 {
+			host += fmt.Sprintf(":%d", r.Port)
+		}
+		path := "%[capture.req.uri]"
+		if r.Path != "" {
+			path = strings.Replace(r.Path, "%", "%%", -1)
+		}
+		line = fmt.Sprintf("http-request redirect location %q code %d", scheme+"://"+host+path, r.Code)
+	case "fixed_response":
+		r := rule.FixedResponse
+		if r == nil {
+			return fmt.Errorf("rule %s(%s): missing fixed response", rule.Name, rule.Id)
+		}
+		line = fmt.Sprintf("http-request return status %d content-type %q", r.Code, r.ContentType)
+		if r.Body != "" {
+			line += fmt.Sprintf(" string %q", r.Body)
+		}
+	default:
+		return fmt.Errorf("rule %s(%s): unknown action %q", rule.Name, rule.Id, rule.Action)
+	}
+	data["mode"] = "http"
+	data["http_request_rules"] = []string{line}
+	return nil
+}
+
+// haproxyTrafficSplitVar holds a random number within [0, 100) for choosing
+// among weighted backend groups
+const haproxyTrafficSplitVar = "txn.lb_split"
+
+type haproxySplitTarget struct {
+	backendGroup *LoadbalancerBackendGroup
+	// cond matches share of traffic of the backend group.  It's empty for
+	// the last one which takes the rest
+	cond string
+}
+
+// haproxySplitTargets returns backend groups to send traffic to.  With
+// weights, each group of non-zero weight is assigned a range of the random
+// number.  Otherwise it's the single group backendGroupId
+func (lb *Loadbalancer) haproxySplitTargets(weights *models.LoadbalancerBackendGroupWeights, backendGroupId string) []haproxySplitTarget {
+	targets := []haproxySplitTarget{}
+	if weights != nil && len(weights.Groups) > 0 {
+		lo := 0
+		for _, g := range weights.Groups {
+			if g.Weight <= 0 {
+				continue
+			}
+			hi := lo + g.Weight
+			if backendGroup := lb.backendGroups[g.BackendGroupId]; backendGroup != nil {
+				targets = append(targets, haproxySplitTarget{
+					backendGroup: backendGroup,
+					cond:         fmt.Sprintf("{ var(%s) -m int %d:%d }", haproxyTrafficSplitVar, lo, hi-1),
+				})
+			}
+			lo = hi
+		}
+	} else if backendGroup := lb.backendGroups[backendGroupId]; backendGroup != nil {
+		targets = append(targets, haproxySplitTarget{backendGroup: backendGroup})
+	}
+	if len(targets) > 0 {
+		targets[len(targets)-1].cond = ""
+	}
+	return targets
+}
+
+func haproxyTrafficSplitEnabled(weights *models.LoadbalancerBackendGroupWeights) bool {
+	return weights != nil && len(weights.Groups) > 0
+}
+
+// haproxyAcmeChallengeConds returns conditions matching http-01 challenge
+// requests of pending acme certificates used by listeners of lb, both the
+// token path and host must match
+func (lb *Loadbalancer) haproxyAcmeChallengeConds() []string {
+	paths := sets.NewString()
+	hosts := sets.NewString()
+	for _, listener := range lb.listeners {
+		lbcert := listener.certificate
+		if lbcert == nil || len(lbcert.AcmeChallenges) == 0 {
+			continue
+		}
+		for token := range lbcert.AcmeChallenges {
+			paths.Insert(acmeutils.HTTP01_PATH_PREFIX + token)
+		}
+		hosts.Insert(lbcert.AcmeDomains()...)
+	}
+	if paths.Len() == 0 || hosts.Len() == 0 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("{ path %s }", strings.Join(paths.List(), " ")),
+		fmt.Sprintf("{ hdr(host),field(1,:) -i %s }", strings.Join(hosts.List(), " ")),
+	}
+}
+
+func haproxyUseBackend(id string, conds []string) string {
+	line := fmt.Sprintf("use_backend %s", id)
+	if len(conds) > 0 {
+		line += " if " + strings.Join(conds, " ")
+	}
+	return line
+}
+
 func (b *LoadbalancerCorpus) genHaproxyConfigHttp(buf *bytes.Buffer, listener *LoadbalancerListener, opts *AgentParams) error {
 	lb := listener.loadbalancer
+	if listener.ListenerType == "https" && listener.certificate != nil && listener.certificate.Certificate == "" {
+		log.Warningf("listener %s(%s): certificate %s not issued yet",
+			listener.Name, listener.Id, listener.certificate.Id)
+		return haproxyConfigErrNop
+	}
 	rules := listener.rules.OrderedEnabledList()
 	data := b.genHaproxyConfigCommon(lb, listener, opts)
 	ruleBackendIdGen := func(id string) string {
@@ -384,55 +604,80 @@ func (b *LoadbalancerCorpus) genHaproxyConfigHttp(buf *bytes.Buffer, listener *L
 		data["xforwardedfor"] = listener.XForwardedFor
 		data["gzip"] = listener.Gzip
 	}
-	{ // use_backend rule.Id if xx
-		ruleLines := []string{}
-		for _, rule := range rules {
-			ruleLine := fmt.Sprintf("use_backend %s", ruleBackendIdGen(rule.Id))
-			if rule.Domain != "" || rule.Path != "" {
-				ruleLine += " if"
-				if rule.Domain != "" {
-					ruleLine += fmt.Sprintf(" { hdr_dom(host) %q }", rule.Domain)
-				}
-				if rule.Path != "" {
-					ruleLine += fmt.Sprintf(" { path_beg %q }", rule.Path)
-				}
-			}
-			ruleLines = append(ruleLines, ruleLine)
+	// use_backend rule.Id if xx
+	ruleLines := []string{}
+	backends := []interface{}{}
+	splitUsed := false
+	if listener.ListenerType == "http" {
+		// acme http-01 challenges for pending certificates of this
+		// loadbalancer.  Others go to backends as usual
+		if conds := lb.haproxyAcmeChallengeConds(); len(conds) > 0 {
+			ruleLines = append(ruleLines, haproxyUseBackend(haproxyAcmeChallengeBackend, conds))
 		}
-		data["rules"] = ruleLines
 	}
-	{
-		backends := []interface{}{}
-		// rules backend group
-		for _, rule := range rules {
-			// NOTE dup is ok
-			if rule.BackendGroupId == "" {
-				// just in case
-				continue
+	// rules backend group
+	for _, rule := range rules {
+		// NOTE dup is ok
+		conds := haproxyRuleConditions(rule)
+		switch rule.Action {
+		case "redirect", "fixed_response":
+			backendData := map[string]interface{}{
+				"comment": fmt.Sprintf("rule %s(%s) %s", rule.Name, rule.Id, rule.Action),
+				"id":      ruleBackendIdGen(rule.Id),
+			}
+			if err := b.genHaproxyConfigRuleResponse(backendData, listener, rule); err != nil {
+				return err
+			}
+			if err := b.genHaproxyConfigHttpRate(backendData, rule.HTTPRequestRate, rule.HTTPRequestRatePerSrc); err != nil {
+				return err
+			}
+			backends = append(backends, backendData)
+			ruleLines = append(ruleLines, haproxyUseBackend(ruleBackendIdGen(rule.Id), conds))
+			continue
+		}
+		split := haproxyTrafficSplitEnabled(rule.BackendGroupWeights)
+		for _, target := range lb.haproxySplitTargets(rule.BackendGroupWeights, rule.BackendGroupId) {
+			backendGroup := target.backendGroup
+			id := ruleBackendIdGen(rule.Id)
+			if split {
+				id += "-" + backendGroup.Id
 			}
-			backendGroup := lb.backendGroups[rule.BackendGroupId]
 			backendData := map[string]interface{}{
 				"comment": fmt.Sprintf("rule %s(%s) backendGroup %s(%s)",
 					rule.Name, rule.Id,
 					backendGroup.Name, backendGroup.Id),
-				"id": ruleBackendIdGen(rule.Id),
+				"id": id,
 			}
 			if err := b.genHaproxyConfigBackend(backendData, lb, listener, backendGroup); err != nil {
 				return err
 			}
+			backendData["http_request_rules"] = haproxyRuleRewrites(rule)
 			if err := b.genHaproxyConfigHttpRate(backendData, rule.HTTPRequestRate, rule.HTTPRequestRatePerSrc); err != nil {
 				return err
 			}
 			backends = append(backends, backendData)
+			targetConds := conds
+			if target.cond != "" {
+				targetConds = append(conds[:len(conds):len(conds)], target.cond)
+				splitUsed = true
+			}
+			ruleLines = append(ruleLines, haproxyUseBackend(id, targetConds))
 		}
-		// default backend group
-		if listener.BackendGroupId != "" {
-			backendGroup := lb.backendGroups[listener.BackendGroupId]
+	}
+	// default backend group
+	{
+		split := haproxyTrafficSplitEnabled(listener.BackendGroupWeights)
+		for _, target := range lb.haproxySplitTargets(listener.BackendGroupWeights, listener.BackendGroupId) {
+			backendGroup := target.backendGroup
+			id := fmt.Sprintf("backends_listener_default-%s", listener.Id)
+			if split {
+				id += "-" + backendGroup.Id
+			}
 			backendData := map[string]interface{}{
 				"comment": fmt.Sprintf("listener %s(%s) default backendGroup %s(%s)",
 					listener.Name, listener.Id,
 					backendGroup.Name, backendGroup.Id),
-				"id": fmt.Sprintf("backends_listener_default-%s", listener.Id),
+				"id": id,
 			}
 			if err := b.genHaproxyConfigBackend(backendData, lb, listener, backendGroup); err != nil {
 				return err
@@ -441,14 +686,25 @@ func (b *LoadbalancerCorpus) genHaproxyConfigHttp(buf *bytes.Buffer, listener *L
 				return err
 			}
 			backends = append(backends, backendData)
-			data["default_backend"] = backendData
-		}
-		if len(backends) == 0 {
-			// no backendgroup specified, nothing to serve
-			return haproxyConfigErrNop
+			if target.cond != "" {
+				ruleLines = append(ruleLines, haproxyUseBackend(id, []string{target.cond}))
+				splitUsed = true
+			} else {
+				data["default_backend"] = backendData
+			}
 		}
-		data["backends"] = backends
 	}
+	if len(backends) == 0 {
+		// no backendgroup specified, nothing to serve
+		return haproxyConfigErrNop
+	}
+	if splitUsed {
+		ruleLines = append([]string{
+			fmt.Sprintf("http-request set-var(%s) rand(100)", haproxyTrafficSplitVar),
+		}, ruleLines...)
+	}
+	data["rules"] = ruleLines
+	data["backends"] = backends
 	err := haproxyConfigTmpl.ExecuteTemplate(buf, "httpListen", data)
 	return err
 }
@@ -456,23 +712,45 @@ func (b *LoadbalancerCorpus) genHaproxyConfigHttp(buf *bytes.Buffer, listener *L
 func (b *LoadbalancerCorpus) genHaproxyConfigTcp(buf *bytes.Buffer, listener *LoadbalancerListener, opts *AgentParams) error {
 	lb := listener.loadbalancer
 	data := b.genHaproxyConfigCommon(lb, listener, opts)
-	if listener.BackendGroupId != "" {
-		backendGroup := lb.backendGroups[listener.BackendGroupId]
+	targets := lb.haproxySplitTargets(listener.BackendGroupWeights, listener.BackendGroupId)
+	if len(targets) == 0 {
+		return haproxyConfigErrNop
+	}
+	split := haproxyTrafficSplitEnabled(listener.BackendGroupWeights)
+	splitRules := []string{}
+	backends := []interface{}{}
+	for _, target := range targets {
+		backendGroup := target.backendGroup
+		id := fmt.Sprintf("backends_listener-%s", listener.Id)
+		if split {
+			id += "-" + backendGroup.Id
+		}
 		backendData := map[string]interface{}{
 			"comment": fmt.Sprintf("listener %s(%s) backendGroup %s(%s)",
 				listener.Name, listener.Id,
 				backendGroup.Name, backendGroup.Id),
-			"id": fmt.Sprintf("backends_listener-%s", listener.Id),
+			"id": id,
 		}
 		err := b.genHaproxyConfigBackend(backendData, lb, listener, backendGroup)
 		if err != nil {
 			return err
 		}
-		data["backend"] = backendData
-		err = haproxyConfigTmpl.ExecuteTemplate(buf, "tcpListen", data)
-		return err
+		if target.cond != "" {
+			splitRules = append(splitRules, haproxyUseBackend(id, []string{target.cond}))
+			backends = append(backends, backendData)
+		} else {
+			data["backend"] = backendData
+		}
 	}
-	return haproxyConfigErrNop
+	if len(splitRules) > 0 {
+		splitRules = append([]string{
+			fmt.Sprintf("tcp-request content set-var(%s) rand(100)", haproxyTrafficSplitVar),
+		}, splitRules...)
+		data["split_rules"] = splitRules
+		data["backends"] = backends
+	}
+	err := haproxyConfigTmpl.ExecuteTemplate(buf, "tcpListen", data)
+	return err
 }
 
 var haproxyConfigTmpl = template.Must(template.New("").Parse(`
@@ -485,8 +763,12 @@ listen {{ .id }}
 	{{- if .log }}	{{ println "option tcplog" }} {{- end }}
 	{{- if .acl }}	{{ println .acl }} {{- end}}
 	{{- if .client_idle_timeout }}	timeout client {{ println .client_idle_timeout }} {{- end}}
+	{{- range .split_rules }}	{{ println . }} {{- end }}
 	default_backend {{ .backend.id }}
 {{ template "backend" .backend }}
+{{- range .backends }}
+{{- template "backend" . }}
+{{- end }}
 {{- end }}
 
 {{ define "httpListen" -}}
@@ -521,9 +803,10 @@ backend {{ .id }}
 {{- end }}
 backend {{ .id }}
 	mode {{ .mode }}
-	balance {{ .balanceAlgorithm }}
 	{{- println }}
+	{{- if .balanceAlgorithm }}	balance {{ println .balanceAlgorithm }} {{- end }}
 	{{- range .rate_rules }}	{{ println . }} {{- end }}
+	{{- range .http_request_rules }}	{{ println . }} {{- end }}
 	{{- if .backend_connect_timeout }}	timeout connect {{ println .backend_connect_timeout }} {{- end}}
 	{{- if .backend_idle_timeout }}	timeout server {{ println .backend_idle_timeout }} {{- end}}
 	{{- if .timeout_check }}	{{ println .timeout_check }} {{- end }}
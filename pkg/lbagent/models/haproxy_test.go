@@ -0,0 +1,82 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/mcclient/models"
+)
+
+func TestLoadbalancer_haproxyAcmeChallengeConds(t *testing.T) {
+	newListener := func(lbcert *models.LoadbalancerCertificate) *LoadbalancerListener {
+		listener := &LoadbalancerListener{
+			LoadbalancerListener: &models.LoadbalancerListener{},
+		}
+		if lbcert != nil {
+			listener.certificate = &LoadbalancerCertificate{LoadbalancerCertificate: lbcert}
+		}
+		return listener
+	}
+	cases := []struct {
+		name      string
+		listeners LoadbalancerListeners
+		want      []string
+	}{
+		{
+			name: "no certificate",
+			listeners: LoadbalancerListeners{
+				"http": newListener(nil),
+			},
+		},
+		{
+			name: "issued certificate",
+			listeners: LoadbalancerListeners{
+				"https": newListener(&models.LoadbalancerCertificate{
+					CommonName: "a.com",
+				}),
+			},
+		},
+		{
+			name: "pending certificates",
+			listeners: LoadbalancerListeners{
+				"http": newListener(nil),
+				"https0": newListener(&models.LoadbalancerCertificate{
+					CommonName:              "A.com",
+					SubjectAlternativeNames: "A.com www.a.com",
+					AcmeChallenges:          map[string]string{"tok1": "tok1.x"},
+				}),
+				"https1": newListener(&models.LoadbalancerCertificate{
+					CommonName:     "b.com",
+					AcmeChallenges: map[string]string{"tok0": "tok0.x"},
+				}),
+			},
+			want: []string{
+				"{ path /.well-known/acme-challenge/tok0 /.well-known/acme-challenge/tok1 }",
+				"{ hdr(host),field(1,:) -i a.com b.com www.a.com }",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lb := &Loadbalancer{listeners: c.listeners}
+			got := lb.haproxyAcmeChallengeConds()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want %q, got %q", c.want, got)
+			}
+		})
+	}
+}
@@ -15,6 +15,8 @@
 package models
 
 import (
+	"strings"
+
 	"yunion.io/x/onecloud/pkg/mcclient/models"
 )
 
@@ -60,3 +62,14 @@ type LoadbalancerAcl struct {
 type LoadbalancerCertificate struct {
 	*models.LoadbalancerCertificate
 }
+
+// AcmeDomains returns lower-cased domains the acme certificate is issued for
+func (lbcert *LoadbalancerCertificate) AcmeDomains() []string {
+	domains := []string{}
+	for _, domain := range append([]string{lbcert.CommonName}, strings.Fields(lbcert.SubjectAlternativeNames)...) {
+		if domain != "" {
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+	return domains
+}
@@ -184,6 +184,13 @@ func (lst OrderedLoadbalancerListenerRuleList) Len() int {
 }
 
 func (lst OrderedLoadbalancerListenerRuleList) Less(i, j int) bool {
+	// the list is sorted in reverse order, lower priority value comes
+	// first
+	pi := lst[i].Priority
+	pj := lst[j].Priority
+	if pi != pj {
+		return pi > pj
+	}
 	ldi := len(lst[i].Domain)
 	ldj := len(lst[j].Domain)
 	if ldi < ldj {
@@ -209,7 +216,7 @@ func (set LoadbalancerListenerRules) OrderedEnabledList() OrderedLoadbalancerLis
 			rules = append(rules, rule)
 		}
 	}
-	// more specific rules come first
+	// rules of higher priority, then more specific ones come first
 	sort.Sort(sort.Reverse(rules))
 	return rules
 }
@@ -100,3 +100,44 @@ func TestLoadbalancerListenerRules_OrderedEnabledList(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadbalancerListenerRules_OrderedEnabledListPriority(t *testing.T) {
+	set := LoadbalancerListenerRules(map[string]*LoadbalancerListenerRule{
+		"p100 a.com/img": {
+			LoadbalancerListenerRule: &models.LoadbalancerListenerRule{
+				Domain:   "a.com",
+				Path:     "/img",
+				Priority: 100,
+			},
+		},
+		"p100 a.com": {
+			LoadbalancerListenerRule: &models.LoadbalancerListenerRule{
+				Domain:   "a.com",
+				Priority: 100,
+			},
+		},
+		"p10": {
+			LoadbalancerListenerRule: &models.LoadbalancerListenerRule{
+				Priority: 10,
+			},
+		},
+		"p200 m.a.com/img": {
+			LoadbalancerListenerRule: &models.LoadbalancerListenerRule{
+				Domain:   "m.a.com",
+				Path:     "/img",
+				Priority: 200,
+			},
+		},
+	})
+	for name, rule := range set {
+		rule.Status = "enabled"
+		rule.Name = name
+	}
+	rules := set.OrderedEnabledList()
+	want := []string{"p10", "p100 a.com/img", "p100 a.com", "p200 m.a.com/img"}
+	for i, rule := range rules {
+		if rule.Name != want[i] {
+			t.Errorf("rule %d: want %s, got %s", i, want[i], rule.Name)
+		}
+	}
+}
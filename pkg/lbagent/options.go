@@ -85,3 +85,7 @@ func (opts *Options) initDirs() error {
 
 	return nil
 }
+
+func (opts *Options) haproxyStatsSocketFile() string {
+	return filepath.Join(opts.haproxyRunDir, "haproxy.sock")
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HaproxyServerStat is a server line from output of haproxy "show stat"
+type HaproxyServerStat struct {
+	ProxyName  string
+	ServerName string
+	Status     string
+
+	// Requests and Errors are cumulative counters since haproxy start.
+	// Requests is number of http responses in http mode, or sessions in
+	// tcp mode.  Errors includes 5xx responses, connection and response
+	// errors
+	Requests int64
+	Errors   int64
+}
+
+// HaproxyShowStat queries haproxy stats socket for status of servers.
+// FRONTEND and BACKEND summary lines are not included
+func HaproxyShowStat(sockPath string, timeout time.Duration) ([]HaproxyServerStat, error) {
+	conn, err := net.DialTimeout("unix", sockPath, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write([]byte("show stat\n")); err != nil {
+		return nil, err
+	}
+	return ParseHaproxyShowStat(conn)
+}
+
+// ParseHaproxyShowStat parses csv output of haproxy "show stat"
+func ParseHaproxyShowStat(r io.Reader) ([]HaproxyServerStat, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil && header == "" {
+		return nil, fmt.Errorf("read stat header: %s", err)
+	}
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "# ") {
+		return nil, fmt.Errorf("bad stat header: %q", header)
+	}
+	cols := strings.Split(header[2:], ",")
+	iPx, iSv, iStatus := -1, -1, -1
+	for i, col := range cols {
+		switch col {
+		case "pxname":
+			iPx = i
+		case "svname":
+			iSv = i
+		case "status":
+			iStatus = i
+		}
+	}
+	if iPx < 0 || iSv < 0 || iStatus < 0 {
+		return nil, fmt.Errorf("stat header missing pxname, svname or status: %q", header)
+	}
+	colIdx := map[string]int{}
+	for i, col := range cols {
+		colIdx[col] = i
+	}
+	counter := func(rec []string, col string) int64 {
+		i, ok := colIdx[col]
+		if !ok || i >= len(rec) {
+			return 0
+		}
+		v, _ := strconv.ParseInt(rec[i], 10, 64)
+		return v
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	r_ := []HaproxyServerStat{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(rec) <= iStatus || len(rec) <= iPx || len(rec) <= iSv {
+			continue
+		}
+		switch rec[iSv] {
+		case "FRONTEND", "BACKEND":
+			continue
+		}
+		stat := HaproxyServerStat{
+			ProxyName:  rec[iPx],
+			ServerName: rec[iSv],
+			Status:     rec[iStatus],
+		}
+		for _, col := range []string{"hrsp_1xx", "hrsp_2xx", "hrsp_3xx", "hrsp_4xx", "hrsp_5xx", "hrsp_other"} {
+			stat.Requests += counter(rec, col)
+		}
+		if stat.Requests == 0 {
+			stat.Requests = counter(rec, "stot")
+		}
+		stat.Errors = counter(rec, "hrsp_5xx") + counter(rec, "econ") + counter(rec, "eresp")
+		r_ = append(r_, stat)
+	}
+	return r_, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHaproxyShowStat(t *testing.T) {
+	out := `# pxname,svname,qcur,qmax,scur,smax,slim,stot,bin,bout,dreq,dresp,ereq,econ,eresp,wretr,wredis,status,weight,
+listener-l0,FRONTEND,,,0,0,2000,0,0,0,0,0,0,,,,,OPEN,,
+backends_listener-l0,b0,0,0,0,0,,0,0,0,,0,,0,0,0,0,UP,1,
+backends_listener-l0,b1,0,0,0,0,,0,0,0,,0,,0,0,0,0,DOWN 1/2,1,
+backends_listener-l0,b2,0,0,0,0,,0,0,0,,0,,0,0,0,0,no check,1,
+backends_listener-l0,BACKEND,0,0,0,0,200,0,0,0,0,0,,0,0,0,0,UP,2,
+
+`
+	got, err := ParseHaproxyShowStat(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	want := []HaproxyServerStat{
+		{ProxyName: "backends_listener-l0", ServerName: "b0", Status: "UP"},
+		{ProxyName: "backends_listener-l0", ServerName: "b1", Status: "DOWN 1/2"},
+		{ProxyName: "backends_listener-l0", ServerName: "b2", Status: "no check"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+
+	if _, err := ParseHaproxyShowStat(strings.NewReader("Unknown command\n")); err == nil {
+		t.Errorf("expecting error for bad header")
+	}
+}
+
+func TestParseHaproxyShowStatCounters(t *testing.T) {
+	out := `# pxname,svname,stot,econ,eresp,status,hrsp_1xx,hrsp_2xx,hrsp_3xx,hrsp_4xx,hrsp_5xx,hrsp_other,
+backends_listener-l0,b0,20,1,2,UP,0,10,2,3,4,1,
+backends_listener-l1,b1,7,1,0,UP,,,,,,,
+`
+	got, err := ParseHaproxyShowStat(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	want := []HaproxyServerStat{
+		{ProxyName: "backends_listener-l0", ServerName: "b0", Status: "UP", Requests: 20, Errors: 7},
+		{ProxyName: "backends_listener-l1", ServerName: "b1", Status: "UP", Requests: 7, Errors: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %#v, got %#v", want, got)
+	}
+}
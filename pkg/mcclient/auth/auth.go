@@ -23,6 +23,7 @@ import (
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/util/cache"
 
+	api "yunion.io/x/onecloud/pkg/apis/identity"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
 
@@ -31,6 +32,10 @@ var (
 	defaultTimeout    int       = 600 // maybe time.Duration better
 	defaultCacheCount int64     = 100000
 	initCh            chan bool = make(chan bool)
+
+	revocationWaitTimeout   = 30 * time.Second
+	revocationRetryDelay    = 2 * time.Second
+	revocationRetryDelayMax = time.Minute
 )
 
 type AuthInfo struct {
@@ -99,6 +104,26 @@ func (c *TokenCacheVerify) DeleteToken(token string) bool {
 	return c.Delete(token)
 }
 
+// Revoke drops the cached tokens that any of the events may revoke, they
+// will be verified by keystone again on next use
+func (c *TokenCacheVerify) Revoke(events []api.SRevocationEvent) int {
+	cnt := 0
+	for _, item := range c.Items() {
+		cred := item.Value.(*cacheItem).credential
+		info := api.STokenRevocationInfo{
+			UserId:    cred.GetUserId(),
+			ProjectId: cred.GetProjectId(),
+			DomainIds: []string{cred.GetDomainId(), cred.GetProjectDomainId()},
+			AuditIds:  cred.GetAuditIds(),
+		}
+		if api.IsRevoked(events, info) {
+			c.DeleteToken(item.Key)
+			cnt += 1
+		}
+	}
+	return cnt
+}
+
 func (c *TokenCacheVerify) Verify(cli *mcclient.Client, adminToken, token string) (mcclient.TokenCredential, error) {
 	cred, found := c.GetToken(token)
 	if found {
@@ -149,6 +174,51 @@ func (a *authManager) verify(token string) (mcclient.TokenCredential, error) {
 	return cred, nil
 }
 
+// watchRevocationEvents follows the revocation feed of keystone by long
+// polling and invalidates the revoked tokens in cache
+func (a *authManager) watchRevocationEvents() {
+	var since int64
+	applied := map[int64]bool{}
+	retryDelay := revocationRetryDelay
+	for {
+		events, err := a.client.FetchRevocationEvents(a.adminCredential.GetTokenString(), since, revocationWaitTimeout)
+		if err != nil {
+			log.Warningf("fetch revocation events fail %s, try it again after %v", err, retryDelay)
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+			if retryDelay > revocationRetryDelayMax {
+				retryDelay = revocationRetryDelayMax
+			}
+			continue
+		}
+		retryDelay = revocationRetryDelay
+		// events up to since are sent again in case some of them were
+		// committed late, apply only those not seen yet
+		newEvents := make([]api.SRevocationEvent, 0, len(events))
+		for _, event := range events {
+			if !applied[event.Id] {
+				applied[event.Id] = true
+				newEvents = append(newEvents, event)
+			}
+			if event.Id > since {
+				since = event.Id
+			}
+		}
+		for id := range applied {
+			if id <= since-api.RevocationEventIdOverlap {
+				delete(applied, id)
+			}
+		}
+		if len(newEvents) == 0 {
+			continue
+		}
+		cnt := a.tokenCacheVerify.Revoke(newEvents)
+		if cnt > 0 {
+			log.Infof("Remove %d revoked cache tokens", cnt)
+		}
+	}
+}
+
 func (a *authManager) authAdmin() error {
 	var token mcclient.TokenCredential
 	var err error
@@ -214,6 +284,9 @@ func (a *authManager) init() error {
 	expire := a.adminCredential.GetExpires()
 	duration := expire.Sub(time.Now())
 	time.AfterFunc(time.Duration(duration.Nanoseconds()/2), a.reAuth)
+	if a.client.AuthVersion() == "v3" {
+		go a.watchRevocationEvents()
+	}
 	initCh <- true
 	return nil
 }
@@ -23,6 +23,7 @@ import (
 	api "yunion.io/x/onecloud/pkg/apis/identity"
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
@@ -65,6 +66,10 @@ func AuthenticateWithDelayDecision(f appsrv.FilterHandler, delayDecision bool) a
 					httperrors.UnauthorizedError(w, "InvalidToken")
 					return
 				}
+			} else if !api.IsAccessAllowed(token.GetAccessRules(), consts.GetServiceType(), r.Method) {
+				// token of an application credential limited by access rules
+				httperrors.ForbiddenError(w, "%s %s not allowed by access rules", r.Method, consts.GetServiceType())
+				return
 			}
 		}
 		ctx = context.WithValue(ctx, AUTH_TOKEN, token)
@@ -44,6 +44,33 @@ type SAuthenticationIdentity struct {
 	Token struct {
 		Id string `json:"id,omitempty"`
 	} `json:"token,omitempty"`
+	Totp struct {
+		User struct {
+			Id       string `json:"id,omitempty"`
+			Name     string `json:"name,omitempty"`
+			Passcode string `json:"passcode,omitempty"`
+			Domain   struct {
+				Id   string `json:"id,omitempty"`
+				Name string `json:"name,omitempty"`
+			}
+		} `json:"user,omitempty"`
+	} `json:"totp,omitempty"`
+	ApplicationCredential struct {
+		Id     string `json:"id,omitempty"`
+		Name   string `json:"name,omitempty"`
+		Secret string `json:"secret,omitempty"`
+		User   struct {
+			Id     string `json:"id,omitempty"`
+			Name   string `json:"name,omitempty"`
+			Domain struct {
+				Id   string `json:"id,omitempty"`
+				Name string `json:"name,omitempty"`
+			}
+		} `json:"user,omitempty"`
+	} `json:"application_credential,omitempty"`
+	// Receipt of the passed first factor, which is redeemed with the totp
+	// method. Also accepted in header Openstack-Auth-Receipt
+	Receipt string `json:"receipt,omitempty"`
 }
 
 type SAuthenticationInputV3 struct {
@@ -65,3 +92,20 @@ type SAuthenticationInputV3 struct {
 		} `json:"scope,omitempty"`
 	} `json:"auth,omitempty"`
 }
+
+// SChangePasswordInput is the body of POST /v3/auth/password, with which
+// a local user changes the password, even an expired one, without a token.
+// Passcode is the totp passcode of users required to use MFA
+type SChangePasswordInput struct {
+	User struct {
+		Id               string `json:"id,omitempty"`
+		Name             string `json:"name,omitempty"`
+		OriginalPassword string `json:"original_password"`
+		Password         string `json:"password"`
+		Passcode         string `json:"passcode,omitempty"`
+		Domain           struct {
+			Id   string `json:"id,omitempty"`
+			Name string `json:"name,omitempty"`
+		}
+	} `json:"user"`
+}
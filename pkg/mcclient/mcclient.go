@@ -127,7 +127,7 @@ func (this *Client) jsonRequest(ctx context.Context, endpoint string, token stri
 	return httputils.JSONRequest(this.httpconn, ctx, method, joinUrl(endpoint, url), getDefaultHeader(header, token), body, this.debug)
 }
 
-func (this *Client) _authV3(domainName, uname, passwd, projectId, projectName, token string) (TokenCredential, error) {
+func (this *Client) _authV3(domainName, uname, passwd, passcode, projectId, projectName, token string) (TokenCredential, error) {
 	/*body := jsonutils.NewDict()
 	if len(uname) > 0 && len(passwd) > 0 { // Password authentication
 		body.Add(jsonutils.NewArray(jsonutils.NewString("password")), "auth", "identity", "methods")
@@ -159,6 +159,13 @@ func (this *Client) _authV3(domainName, uname, passwd, projectId, projectName, t
 		} else {
 			input.Auth.Identity.Password.User.Domain.Name = api.DEFAULT_DOMAIN_ID
 		}
+		if len(passcode) > 0 {
+			// second factor, verified together with the password
+			input.Auth.Identity.Methods = append(input.Auth.Identity.Methods, api.AUTH_METHOD_TOTP)
+			input.Auth.Identity.Totp.User.Name = uname
+			input.Auth.Identity.Totp.User.Passcode = passcode
+			input.Auth.Identity.Totp.User.Domain = input.Auth.Identity.Password.User.Domain
+		}
 	} else if len(token) > 0 {
 		input.Auth.Identity.Methods = []string{api.AUTH_METHOD_TOKEN}
 		input.Auth.Identity.Token.Id = token
@@ -174,6 +181,10 @@ func (this *Client) _authV3(domainName, uname, passwd, projectId, projectName, t
 			input.Auth.Scope.Project.Domain.Id = api.DEFAULT_DOMAIN_ID
 		}
 	}
+	return this._authV3Input(input)
+}
+
+func (this *Client) _authV3Input(input SAuthenticationInputV3) (TokenCredential, error) {
 	hdr, rbody, err := this.jsonRequest(context.Background(), this.authUrl, "", "POST", "/auth/tokens", nil, jsonutils.Marshal(&input))
 	if err != nil {
 		return nil, err
@@ -223,11 +234,99 @@ func (this *Client) _authV2(uname, passwd, tenantId, tenantName, token string) (
 
 func (this *Client) Authenticate(uname, passwd, domainName, tenantName string) (TokenCredential, error) {
 	if this.AuthVersion() == "v3" {
-		return this._authV3(domainName, uname, passwd, "", tenantName, "")
+		return this._authV3(domainName, uname, passwd, "", "", tenantName, "")
 	}
 	return this._authV2(uname, passwd, "", tenantName, "")
 }
 
+// AuthenticateWithPasscode authenticates with password plus a TOTP passcode,
+// which is only supported by the v3 identity API
+func (this *Client) AuthenticateWithPasscode(uname, passwd, passcode, domainName, tenantName string) (TokenCredential, error) {
+	if this.AuthVersion() != "v3" {
+		return nil, fmt.Errorf("totp authentication requires identity v3")
+	}
+	return this._authV3(domainName, uname, passwd, passcode, "", tenantName, "")
+}
+
+// AuthenticateApplicationCredential authenticates with the secret of an
+// application credential, given by id, or by name together with its owner.
+// The token is always scoped to the project of the credential
+func (this *Client) AuthenticateApplicationCredential(credId, credName, secret, uname, domainName string) (TokenCredential, error) {
+	if this.AuthVersion() != "v3" {
+		return nil, fmt.Errorf("application credential authentication requires identity v3")
+	}
+	input := SAuthenticationInputV3{}
+	input.Auth.Identity.Methods = []string{api.AUTH_METHOD_APPCRED}
+	input.Auth.Identity.ApplicationCredential.Id = credId
+	input.Auth.Identity.ApplicationCredential.Name = credName
+	input.Auth.Identity.ApplicationCredential.Secret = secret
+	if len(credId) == 0 {
+		input.Auth.Identity.ApplicationCredential.User.Name = uname
+		if len(domainName) > 0 {
+			input.Auth.Identity.ApplicationCredential.User.Domain.Name = domainName
+		} else {
+			input.Auth.Identity.ApplicationCredential.User.Domain.Id = api.DEFAULT_DOMAIN_ID
+		}
+	}
+	return this._authV3Input(input)
+}
+
+// ChangePassword changes the password of a local user with the original
+// one, which works even after the original password has expired. passcode
+// is the totp passcode of users required to use MFA
+func (this *Client) ChangePassword(uname, domainName, origPasswd, passwd, passcode string) error {
+	if this.AuthVersion() != "v3" {
+		return fmt.Errorf("changing password requires identity v3")
+	}
+	input := SChangePasswordInput{}
+	input.User.Name = uname
+	if len(domainName) > 0 {
+		input.User.Domain.Name = domainName
+	} else {
+		input.User.Domain.Id = api.DEFAULT_DOMAIN_ID
+	}
+	input.User.OriginalPassword = origPasswd
+	input.User.Password = passwd
+	input.User.Passcode = passcode
+	_, _, err := this.jsonRequest(context.Background(), this.authUrl, "", "POST", "/auth/password", nil, jsonutils.Marshal(&input))
+	return err
+}
+
+// RevokeToken revokes subjectToken before it expires, token is either the
+// subject token itself or a token of an admin
+func (this *Client) RevokeToken(token, subjectToken string) error {
+	if this.AuthVersion() != "v3" {
+		return fmt.Errorf("revoking token requires identity v3")
+	}
+	header := http.Header{}
+	header.Add(api.AUTH_TOKEN_HEADER, token)
+	header.Add(api.AUTH_SUBJECT_TOKEN_HEADER, subjectToken)
+	_, _, err := this.jsonRequest(context.Background(), this.authUrl, "", "DELETE", "/auth/tokens", header, nil)
+	return err
+}
+
+// FetchRevocationEvents returns the token revocation events after since.
+// Without such events, keystone holds the request for up to wait until new
+// events show up
+func (this *Client) FetchRevocationEvents(adminToken string, since int64, wait time.Duration) ([]api.SRevocationEvent, error) {
+	if this.AuthVersion() != "v3" {
+		return nil, fmt.Errorf("revocation events requires identity v3")
+	}
+	header := http.Header{}
+	header.Add(api.AUTH_TOKEN_HEADER, adminToken)
+	url := fmt.Sprintf("/OS-REVOKE/events?since=%d&wait=%d", since, int(wait.Seconds()))
+	_, rbody, err := this.jsonRequest(context.Background(), this.authUrl, "", "GET", url, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]api.SRevocationEvent, 0)
+	err = rbody.Unmarshal(&events, "events")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid response of revocation events: %v", err)
+	}
+	return events, nil
+}
+
 func (this *Client) unmarshalV3Token(rbody jsonutils.JSONObject, tokenId string) (cred TokenCredential, err error) {
 	cred = &TokenCredentialV3{Id: tokenId}
 	err = rbody.Unmarshal(cred)
@@ -296,7 +395,7 @@ func (this *Client) SetTenant(tenantId, tenantName string, token TokenCredential
 
 func (this *Client) SetProject(tenantId, tenantName string, token TokenCredential) (TokenCredential, error) {
 	if this.AuthVersion() == "v3" {
-		return this._authV3("", "", "", tenantId, tenantName, token.GetTokenString())
+		return this._authV3("", "", "", "", tenantId, tenantName, token.GetTokenString())
 	} else {
 		return this._authV2("", "", "", tenantName, token.GetTokenString())
 	}
@@ -106,6 +106,22 @@ type LoadbalancerListener struct {
 	LoadbalancerHTTPSListener
 
 	LoadbalancerHTTPRateLimiter
+
+	LoadbalancerTrafficSplit
+}
+
+type LoadbalancerBackendGroupWeight struct {
+	BackendGroupId string
+	Weight         int
+}
+
+type LoadbalancerBackendGroupWeights struct {
+	Groups []LoadbalancerBackendGroupWeight
+}
+
+type LoadbalancerTrafficSplit struct {
+	BackendGroupWeights *LoadbalancerBackendGroupWeights
+	TrafficShiftStatus  string
 }
 
 type LoadbalancerListenerRule struct {
@@ -119,7 +135,53 @@ type LoadbalancerListenerRule struct {
 	Domain string
 	Path   string
 
+	Priority      int
+	Conditions    *LoadbalancerListenerRuleConditions
+	Action        string
+	Redirect      *LoadbalancerListenerRuleRedirect
+	FixedResponse *LoadbalancerListenerRuleFixedResponse
+	Rewrite       *LoadbalancerListenerRuleRewrite
+
 	LoadbalancerHTTPRateLimiter
+
+	LoadbalancerTrafficSplit
+}
+
+type LoadbalancerRuleKeyValues struct {
+	Name   string
+	Values []string
+}
+
+type LoadbalancerListenerRuleConditions struct {
+	Headers     []LoadbalancerRuleKeyValues
+	QueryParams []LoadbalancerRuleKeyValues
+	Methods     []string
+	SourceCidrs []string
+}
+
+type LoadbalancerListenerRuleRedirect struct {
+	Code   int
+	Scheme string
+	Host   string
+	Port   int
+	Path   string
+}
+
+type LoadbalancerListenerRuleFixedResponse struct {
+	Code        int
+	ContentType string
+	Body        string
+}
+
+type LoadbalancerRuleKeyValue struct {
+	Name  string
+	Value string
+}
+
+type LoadbalancerListenerRuleRewrite struct {
+	PathRegex   string
+	PathReplace string
+	SetHeaders  []LoadbalancerRuleKeyValue
 }
 
 type LoadbalancerBackendGroup struct {
@@ -174,6 +236,9 @@ type LoadbalancerCertificate struct {
 	NotAfter                time.Time
 	CommonName              string
 	SubjectAlternativeNames string
+
+	CertificateSource string
+	AcmeChallenges    map[string]string
 }
 
 type LoadbalancerAgent struct {
@@ -19,7 +19,9 @@ import (
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/utils"
 
+	api "yunion.io/x/onecloud/pkg/apis/identity"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/util/httputils"
@@ -53,8 +55,8 @@ func (this *DomainManager) _updateConfig(s *mcclient.ClientSession, domain strin
 	if e != nil {
 		return nil, httperrors.NewInputParameterError("Malformed domain configuration %s", driver)
 	}
-	if driver != "ldap" {
-		return nil, httperrors.NewInputParameterError("Invalid driver: %s, ONLY ldap is supported", driver)
+	if !utils.IsInStringArray(driver, []string{api.IdentityDriverSQL, api.IdentityDriverLDAP, api.IdentityDriverOIDC, api.IdentityDriverSAML}) {
+		return nil, httperrors.NewInputParameterError("Invalid driver: %s, ONLY sql, ldap, oidc and saml are supported", driver)
 	}
 	url := fmt.Sprintf("/domains/%s/config", domain)
 	ret, e := this._patch(s, url, config, "config")
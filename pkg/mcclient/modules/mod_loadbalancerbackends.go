@@ -36,6 +36,7 @@ func init() {
 				"address",
 				"port",
 				"weight",
+				"health_status",
 			},
 			[]string{"tenant"},
 		),
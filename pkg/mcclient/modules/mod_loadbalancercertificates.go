@@ -36,6 +36,7 @@ func init() {
 				"not_after",
 				"common_name",
 				"subject_alternative_names",
+				"certificate_source",
 			},
 			[]string{"tenant"},
 		),
@@ -34,7 +34,10 @@ func init() {
 				"status",
 				"domain",
 				"path",
+				"priority",
+				"action",
 				"backend_id",
+				"traffic_shift_status",
 			},
 			[]string{"tenant"},
 		),
@@ -38,6 +38,7 @@ func init() {
 				"egress_mbps",
 				"acl_status",
 				"acl_type",
+				"traffic_shift_status",
 			},
 			[]string{"tenant"},
 		),
@@ -96,6 +96,15 @@ func (this *SchedulerManager) DoForecast(s *mcclient.ClientSession, params jsonu
 	return obj, err
 }
 
+func (this *SchedulerManager) Simulate(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	url := newSchedURL("simulate")
+	_, obj, err := this.jsonRequest(s, "POST", url, nil, params)
+	if err != nil {
+		return nil, err
+	}
+	return obj, err
+}
+
 func (this *SchedulerManager) Cleanup(s *mcclient.ClientSession, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	url := newSchedURL("cleanup")
 	return this._post(s, url, params, "")
@@ -23,6 +23,8 @@ import (
 type DNSRecordOptions struct {
 	A     []string `help:"DNS A record" metavar:"A_RECORD" positional:"false"`
 	AAAA  []string `help:"DNS AAAA record" metavar:"AAAA_RECORD" positional:"false"`
+	MX    []string `help:"DNS MX record, in the format of exchange:preference" metavar:"MX_RECORD" positional:"false"`
+	TXT   []string `help:"DNS TXT record" metavar:"TXT_RECORD" positional:"false"`
 	CNAME string   `help:"DNS CNAME record" metavar:"CNAME_RECORD" positional:"false"`
 	PTR   string   `help:"DNS PTR record" metavar:"PTR_RECORD" positional:"false"`
 
@@ -32,13 +34,19 @@ type DNSRecordOptions struct {
 }
 
 func parseDNSRecords(opts *DNSRecordOptions, params *jsonutils.JSONDict) {
-	if len(opts.A) > 0 || len(opts.AAAA) > 0 {
+	if len(opts.A) > 0 || len(opts.AAAA) > 0 || len(opts.MX) > 0 || len(opts.TXT) > 0 {
 		for i, a := range opts.A {
 			params.Add(jsonutils.NewString(a), fmt.Sprintf("A.%d", i))
 		}
 		for i, a := range opts.AAAA {
 			params.Add(jsonutils.NewString(a), fmt.Sprintf("AAAA.%d", i))
 		}
+		for i, mx := range opts.MX {
+			params.Add(jsonutils.NewString(mx), fmt.Sprintf("MX.%d", i))
+		}
+		for i, txt := range opts.TXT {
+			params.Add(jsonutils.NewString(txt), fmt.Sprintf("TXT.%d", i))
+		}
 	} else if len(opts.CNAME) > 0 {
 		params.Add(jsonutils.NewString(opts.CNAME), "CNAME")
 	} else if len(opts.SRV) > 0 || (len(opts.SRVHost) > 0 && opts.SRVPort > 0) {
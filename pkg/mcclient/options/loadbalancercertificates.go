@@ -17,6 +17,7 @@ package options
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"yunion.io/x/jsonutils"
 )
@@ -50,10 +51,13 @@ func loadbalancerCertificateLoadFiles(cert, pkey string, allowEmpty bool) (*json
 type LoadbalancerCertificateCreateOptions struct {
 	NAME string
 
-	Cert    string `required:"true" json:"-" help:"path to certificate file"`
-	Pkey    string `required:"true" json:"-" help:"path to private key file"`
+	Cert    string `json:"-" help:"path to certificate file"`
+	Pkey    string `json:"-" help:"path to private key file"`
 	Region  string `json:"cloudregion"`
 	Manager string
+
+	Acme    bool     `json:"-" help:"issue and renew the certificate automatically through ACME"`
+	Domains []string `json:"-" help:"domains of acme certificate, the first one is used as common name"`
 }
 
 func (opts *LoadbalancerCertificateCreateOptions) Params() (*jsonutils.JSONDict, error) {
@@ -61,6 +65,15 @@ func (opts *LoadbalancerCertificateCreateOptions) Params() (*jsonutils.JSONDict,
 	if err != nil {
 		return nil, err
 	}
+	if opts.Acme {
+		if len(opts.Domains) == 0 {
+			return nil, fmt.Errorf("--domains is required for acme certificate")
+		}
+		params.Set("certificate_source", jsonutils.NewString("acme"))
+		params.Set("common_name", jsonutils.NewString(opts.Domains[0]))
+		params.Set("subject_alternative_names", jsonutils.NewString(strings.Join(opts.Domains, " ")))
+		return params, nil
+	}
 	paramsCertKey, err := loadbalancerCertificateLoadFiles(opts.Cert, opts.Pkey, false)
 	if err != nil {
 		return nil, err
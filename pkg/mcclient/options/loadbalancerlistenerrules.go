@@ -14,12 +14,73 @@
 
 package options
 
+import (
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+)
+
+// LoadbalancerListenerRuleL7Options are l7 conditions and actions of
+// listener rule in json format
+type LoadbalancerListenerRuleL7Options struct {
+	Priority *int   `json:"-" help:"lower value is evaluated first, 1-1000"`
+	Action   string `json:"-" choices:"forward|redirect|fixed_response"`
+
+	Conditions    string `json:"-" help:"conditions in json, with keys headers, query_params, methods and source_cidrs"`
+	Redirect      string `json:"-" help:"redirect in json, with keys code, scheme, host, port and path"`
+	FixedResponse string `json:"-" help:"fixed response in json, with keys code, content_type and body"`
+	Rewrite       string `json:"-" help:"rewrite in json, with keys path_regex, path_replace and set_headers"`
+}
+
+func (opts *LoadbalancerListenerRuleL7Options) update(params *jsonutils.JSONDict) error {
+	if opts.Priority != nil {
+		params.Set("priority", jsonutils.NewInt(int64(*opts.Priority)))
+	}
+	if opts.Action != "" {
+		params.Set("action", jsonutils.NewString(opts.Action))
+	}
+	jsonM := map[string]string{
+		"conditions":     opts.Conditions,
+		"redirect":       opts.Redirect,
+		"fixed_response": opts.FixedResponse,
+		"rewrite":        opts.Rewrite,
+	}
+	for k, v := range jsonM {
+		if v == "" {
+			continue
+		}
+		obj, err := jsonutils.ParseString(v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+		params.Set(k, obj)
+	}
+	return nil
+}
+
 type LoadbalancerListenerRuleCreateOptions struct {
 	NAME         string
 	Listener     string `required:"true"`
 	BackendGroup string
 	Domain       string
 	Path         string
+
+	LoadbalancerListenerRuleL7Options
+	LoadbalancerBackendGroupWeightsOptions
+}
+
+func (opts *LoadbalancerListenerRuleCreateOptions) Params() (*jsonutils.JSONDict, error) {
+	params, err := StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerListenerRuleL7Options.update(params); err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerBackendGroupWeightsOptions.update(params); err != nil {
+		return nil, err
+	}
+	return params, nil
 }
 
 type LoadbalancerListenerRuleListOptions struct {
@@ -36,6 +97,23 @@ type LoadbalancerListenerRuleUpdateOptions struct {
 	Name string
 
 	BackendGroup string
+
+	LoadbalancerListenerRuleL7Options
+	LoadbalancerBackendGroupWeightsOptions
+}
+
+func (opts *LoadbalancerListenerRuleUpdateOptions) Params() (*jsonutils.JSONDict, error) {
+	params, err := StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerListenerRuleL7Options.update(params); err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerBackendGroupWeightsOptions.update(params); err != nil {
+		return nil, err
+	}
+	return params, nil
 }
 
 type LoadbalancerListenerRuleGetOptions struct {
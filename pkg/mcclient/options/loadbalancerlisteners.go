@@ -14,6 +14,66 @@
 
 package options
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+)
+
+// LoadbalancerBackendGroupWeightsOptions splits traffic of listener or rule
+// among backend groups
+type LoadbalancerBackendGroupWeightsOptions struct {
+	BackendGroupWeight    []string `json:"-" help:"backend group and percentage of traffic sent to it, e.g. blue:90 green:10"`
+	NoBackendGroupWeights bool     `json:"-" help:"clear backend group weights"`
+}
+
+func (opts *LoadbalancerBackendGroupWeightsOptions) update(params *jsonutils.JSONDict) error {
+	if opts.NoBackendGroupWeights {
+		params.Set("backend_group_weights", jsonutils.Marshal(map[string][]interface{}{"groups": {}}))
+		return nil
+	}
+	if len(opts.BackendGroupWeight) == 0 {
+		return nil
+	}
+	groups := jsonutils.NewArray()
+	for _, s := range opts.BackendGroupWeight {
+		i := strings.LastIndex(s, ":")
+		if i <= 0 {
+			return fmt.Errorf("backend group weight %q: want <backend_group>:<weight>", s)
+		}
+		weight, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return fmt.Errorf("backend group weight %q: %s", s, err)
+		}
+		group := jsonutils.NewDict()
+		group.Set("backend_group_id", jsonutils.NewString(s[:i]))
+		group.Set("weight", jsonutils.NewInt(int64(weight)))
+		groups.Add(group)
+	}
+	weights := jsonutils.NewDict()
+	weights.Set("groups", groups)
+	params.Set("backend_group_weights", weights)
+	return nil
+}
+
+type LoadbalancerTrafficShiftOptions struct {
+	ID string `json:"-"`
+
+	TargetBackendGroup string   `required:"true" help:"backend group to shift traffic to"`
+	Step               *int     `help:"percentage of traffic moved in each step, default 10"`
+	Interval           *int     `help:"seconds between steps, default 300"`
+	ErrorRateThreshold *float64 `help:"roll back when error rate of target backend group exceeds this percentage, default 5"`
+	MinRequests        *int     `help:"check error rate only after target backend group served this many requests in a step, default 100"`
+}
+
+type LoadbalancerTrafficShiftCancelOptions struct {
+	ID string `json:"-"`
+
+	Rollback bool `help:"restore backend group weights before the shift"`
+}
+
 type LoadbalancerListenerCreateOptions struct {
 	NAME string
 
@@ -65,6 +125,19 @@ type LoadbalancerListenerCreateOptions struct {
 
 	HTTPRequestRate       *int
 	HTTPRequestRatePerSrc *int
+
+	LoadbalancerBackendGroupWeightsOptions
+}
+
+func (opts *LoadbalancerListenerCreateOptions) Params() (*jsonutils.JSONDict, error) {
+	params, err := StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerBackendGroupWeightsOptions.update(params); err != nil {
+		return nil, err
+	}
+	return params, nil
 }
 
 type LoadbalancerListenerListOptions struct {
@@ -163,6 +236,19 @@ type LoadbalancerListenerUpdateOptions struct {
 
 	HTTPRequestRate       *int
 	HTTPRequestRatePerSrc *int
+
+	LoadbalancerBackendGroupWeightsOptions
+}
+
+func (opts *LoadbalancerListenerUpdateOptions) Params() (*jsonutils.JSONDict, error) {
+	params, err := StructToParams(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.LoadbalancerBackendGroupWeightsOptions.update(params); err != nil {
+		return nil, err
+	}
+	return params, nil
 }
 
 type LoadbalancerListenerGetOptions struct {
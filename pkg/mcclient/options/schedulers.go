@@ -15,6 +15,12 @@
 package options
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+
 	"yunion.io/x/onecloud/pkg/apis/scheduler"
 	"yunion.io/x/onecloud/pkg/mcclient"
 )
@@ -93,3 +99,65 @@ func (o SchedulerForecastOptions) Params(s *mcclient.ClientSession) (*scheduler.
 	input.ScheduleBaseConfig = *opts
 	return input, nil
 }
+
+type SchedulerSimulateOptions struct {
+	SchedulerTestBaseOptions
+
+	Skus       []string `help:"Server sku to simulate, sku name or <CPU_COUNT>:<MEM_SIZE_MB>" metavar:"SKU" required:"true"`
+	RemoveHost []string `help:"ID or name of host to be removed in simulation"`
+	AddHost    []string `help:"Hypothetical hosts copied from a template host, format <TEMPLATE_HOST>:<COUNT>"`
+}
+
+func (o SchedulerSimulateOptions) Params(s *mcclient.ClientSession) (jsonutils.JSONObject, error) {
+	data, err := o.data(s)
+	if err != nil {
+		return nil, err
+	}
+	input := new(scheduler.ScheduleInput)
+	input.ServerConfig = *data
+	input.ScheduleBaseConfig = *o.options()
+	params := input.JSON(input)
+
+	skus := jsonutils.NewArray()
+	for _, sku := range o.Skus {
+		skuObj := jsonutils.NewDict()
+		parts := strings.Split(sku, ":")
+		if len(parts) == 2 {
+			cpu, err := strconv.Atoi(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid sku cpu count %q", parts[0])
+			}
+			mem, err := strconv.Atoi(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid sku memory size %q", parts[1])
+			}
+			skuObj.Add(jsonutils.NewInt(int64(cpu)), "cpu_count")
+			skuObj.Add(jsonutils.NewInt(int64(mem)), "mem_size_mb")
+		}
+		skuObj.Add(jsonutils.NewString(sku), "name")
+		skus.Add(skuObj)
+	}
+	params.Add(skus, "skus")
+	if len(o.RemoveHost) > 0 {
+		params.Add(jsonutils.NewStringArray(o.RemoveHost), "remove_hosts")
+	}
+	if len(o.AddHost) > 0 {
+		hosts := jsonutils.NewArray()
+		for _, h := range o.AddHost {
+			pos := strings.LastIndex(h, ":")
+			if pos <= 0 {
+				return nil, fmt.Errorf("invalid add host %q, format <TEMPLATE_HOST>:<COUNT>", h)
+			}
+			cnt, err := strconv.Atoi(h[pos+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid add host count %q", h[pos+1:])
+			}
+			hostObj := jsonutils.NewDict()
+			hostObj.Add(jsonutils.NewString(h[:pos]), "template")
+			hostObj.Add(jsonutils.NewInt(int64(cnt)), "count")
+			hosts.Add(hostObj)
+		}
+		params.Add(hosts, "add_hosts")
+	}
+	return params, nil
+}
@@ -130,6 +130,9 @@ type ServerConfigs struct {
 	ResourceType string `help:"Resource type" choices:"shared|prepaid|dedicated"`
 	Backup       bool   `help:"Create server with backup server"`
 
+	NumaSingleNode bool `help:"Place all vcpus and memory of server inside one NUMA node"`
+	DedicatedCpu   bool `help:"Pin vcpus to dedicated host cpus and back memory with hugepages, implies --numa-single-node"`
+
 	Schedtag       []string `help:"Schedule policy, key = aggregate name, value = require|exclude|prefer|avoid" metavar:"<KEY:VALUE>"`
 	Disk           []string `help:"Disk descriptions" nargs:"+"`
 	DiskSchedtag   []string `help:"Disk schedtag description, e.g. '0:<tag>:<strategy>'"`
@@ -154,6 +157,8 @@ func (o ServerConfigs) Data() (*computeapi.ServerConfigs, error) {
 		Project:          o.Project,
 		Backup:           o.Backup,
 		Count:            o.Count,
+		NumaSingleNode:   o.NumaSingleNode,
+		DedicatedCpu:     o.DedicatedCpu,
 	}
 	for i, d := range o.Disk {
 		disk, err := cmdline.ParseDiskConfig(d, i)
@@ -19,6 +19,8 @@ import (
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/gotypes"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
 )
 
 type ExternalService struct {
@@ -59,6 +61,9 @@ type TokenCredential interface {
 
 	GetUserName() string
 	GetRoles() []string
+	GetAuthMethods() []string
+	GetAccessRules() []api.SAccessRule
+	GetAuditIds() []string
 	GetExpires() time.Time
 	IsValid() bool
 	ValidDuration() time.Duration
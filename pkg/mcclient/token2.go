@@ -129,6 +129,18 @@ func (token *TokenCredentialV2) GetRoles() []string {
 	return roles
 }
 
+func (token *TokenCredentialV2) GetAuthMethods() []string {
+	return nil
+}
+
+func (token *TokenCredentialV2) GetAccessRules() []api.SAccessRule {
+	return nil
+}
+
+func (token *TokenCredentialV2) GetAuditIds() []string {
+	return nil
+}
+
 func (this *TokenCredentialV2) GetExpires() time.Time {
 	return this.Token.Expires
 }
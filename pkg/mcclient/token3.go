@@ -22,6 +22,8 @@ import (
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/identity"
 )
 
 const REGION_ZONE_SEP = '-'
@@ -67,6 +69,12 @@ type KeystoneUserV3 struct {
 
 type KeystoneServiceCatalogV3 []KeystoneServiceV3
 
+type KeystoneApplicationCredentialV3 struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	AccessRules []api.SAccessRule `json:"access_rules,omitempty"`
+}
+
 type KeystoneTokenV3 struct {
 	AuditIds  []string                 `json:"audit_ids"`
 	ExpiresAt time.Time                `json:"expires_at"`
@@ -77,6 +85,8 @@ type KeystoneTokenV3 struct {
 	Roles     []KeystoneRoleV3         `json:"roles"`
 	User      KeystoneUserV3           `json:"user"`
 	Catalog   KeystoneServiceCatalogV3 `json:"catalog"`
+
+	ApplicationCredential *KeystoneApplicationCredentialV3 `json:"application_credential,omitempty"`
 }
 
 type TokenCredentialV3 struct {
@@ -136,6 +146,21 @@ func (token *TokenCredentialV3) GetRoles() []string {
 	return roles
 }
 
+func (token *TokenCredentialV3) GetAuthMethods() []string {
+	return token.Token.Methods
+}
+
+func (token *TokenCredentialV3) GetAccessRules() []api.SAccessRule {
+	if token.Token.ApplicationCredential == nil {
+		return nil
+	}
+	return token.Token.ApplicationCredential.AccessRules
+}
+
+func (token *TokenCredentialV3) GetAuditIds() []string {
+	return token.Token.AuditIds
+}
+
 func (this *TokenCredentialV3) GetExpires() time.Time {
 	return this.Token.ExpiresAt
 }
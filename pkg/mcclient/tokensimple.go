@@ -38,8 +38,11 @@ type SSimpleToken struct {
 	ProjectDomain   string
 	ProjectDomainId string
 
-	Roles   string
-	Expires time.Time
+	Roles       string
+	AuthMethods []string
+	AccessRules []api.SAccessRule
+	AuditIds    []string
+	Expires     time.Time
 }
 
 func (self *SSimpleToken) GetTokenString() string {
@@ -96,6 +99,18 @@ func (self *SSimpleToken) GetRoles() []string {
 	return strings.Split(self.Roles, ",")
 }
 
+func (self *SSimpleToken) GetAuthMethods() []string {
+	return self.AuthMethods
+}
+
+func (self *SSimpleToken) GetAccessRules() []api.SAccessRule {
+	return self.AccessRules
+}
+
+func (self *SSimpleToken) GetAuditIds() []string {
+	return self.AuditIds
+}
+
 func (self *SSimpleToken) GetExpires() time.Time {
 	return self.Expires
 }
@@ -170,8 +185,11 @@ func SimplifyToken(token TokenCredential) TokenCredential {
 		ProjectDomain:   token.GetProjectDomain(),
 		ProjectDomainId: token.GetProjectDomainId(),
 
-		Roles:   strings.Join(token.GetRoles(), ","),
-		Expires: token.GetExpires(),
+		Roles:       strings.Join(token.GetRoles(), ","),
+		AuthMethods: token.GetAuthMethods(),
+		AccessRules: token.GetAccessRules(),
+		AuditIds:    token.GetAuditIds(),
+		Expires:     token.GetExpires(),
 	}
 }
 
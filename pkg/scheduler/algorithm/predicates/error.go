@@ -30,6 +30,8 @@ const (
 	ErrNoAvailableNetwork    = `no available network on this host`
 	ErrNoEnoughAvailableGPUs = `no enough available GPUs`
 	ErrNotSupportNest        = `nested function not supported`
+	ErrNoNumaTopology        = `numa topology of host unknown`
+	ErrNoNumaNodeFit         = `no numa node could fit`
 
 	ErrRequireMvs                      = `require mvs`
 	ErrRequireNoMvs                    = `require not mvs`
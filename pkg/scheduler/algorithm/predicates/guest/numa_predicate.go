@@ -0,0 +1,80 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/util/numautils"
+)
+
+// NumaPredicate filter hosts that have a NUMA node which could hold all
+// vcpus and memory of the guest, it only works when numa_single_node or
+// dedicated_cpu is requested.
+type NumaPredicate struct {
+	predicates.BasePredicate
+}
+
+func (p *NumaPredicate) Name() string {
+	return "host_numa"
+}
+
+func (p *NumaPredicate) Clone() core.FitPredicate {
+	return &NumaPredicate{}
+}
+
+func (p *NumaPredicate) PreExecute(u *core.Unit, cs []core.Candidater) (bool, error) {
+	if u.IsPublicCloudProvider() {
+		return false, nil
+	}
+
+	data := u.SchedData()
+	if !data.NumaSingleNode && !data.DedicatedCpu {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func numaRequest(u *core.Unit) numautils.SRequest {
+	d := u.SchedData()
+	return numautils.SRequest{
+		CpuCount:  d.Ncpu,
+		MemSizeMb: d.Memory,
+		Dedicated: d.DedicatedCpu,
+	}
+}
+
+func (p *NumaPredicate) Execute(u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	h := predicates.NewPredicateHelper(p, u, c)
+	hc, err := h.HostCandidate()
+	if err != nil {
+		return false, nil, err
+	}
+
+	if len(hc.NumaNodes) == 0 {
+		h.Exclude(predicates.ErrNoNumaTopology)
+		return h.GetResult()
+	}
+
+	count := numautils.FitCount(hc.NumaNodes, numaRequest(u), hc.CPUCmtbound)
+	if count == 0 {
+		h.Exclude(predicates.ErrNoNumaNodeFit)
+		return h.GetResult()
+	}
+
+	h.SetCapacity(int64(count))
+	return h.GetResult()
+}
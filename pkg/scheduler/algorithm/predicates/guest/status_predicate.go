@@ -65,6 +65,10 @@ func (p *StatusPredicate) Execute(u *core.Unit, c core.Candidater) (bool, []core
 		h.Exclude2("enable_status", curEnableStatus, true)
 	}
 
+	if hc.IsMaintenance {
+		h.Exclude2("maintenance", hc.IsMaintenance, false)
+	}
+
 	if hc.Zone.Status != ExpectedEnableStatus {
 		h.Exclude2("zone_status", hc.Zone.Status, ExpectedEnableStatus)
 	}
@@ -0,0 +1,69 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+	"yunion.io/x/onecloud/pkg/util/numautils"
+)
+
+// NumaPriority prefer hosts whose best fit NUMA node is left with the least
+// resource after the guest placed, so that fragments are filled first and
+// whole nodes are kept for larger guests.
+type NumaPriority struct {
+	priorities.BasePriority
+}
+
+func (p *NumaPriority) Name() string {
+	return "host_numa"
+}
+
+func (p *NumaPriority) Clone() core.Priority {
+	return &NumaPriority{}
+}
+
+func (p *NumaPriority) PreExecute(u *core.Unit, cs []core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	d := u.SchedData()
+	return d.NumaSingleNode || d.DedicatedCpu, nil, nil
+}
+
+func (p *NumaPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	hc, err := p.HostCandidate(c)
+	if err != nil {
+		return core.HostPriority{}, err
+	}
+
+	d := u.SchedData()
+	req := numautils.SRequest{
+		CpuCount:  d.Ncpu,
+		MemSizeMb: d.Memory,
+		Dedicated: d.DedicatedCpu,
+	}
+	node := numautils.BestFit(hc.NumaNodes, req, hc.CPUCmtbound)
+	if node != nil {
+		// left ratio of cpu and memory sum up to at most 2
+		h.SetScore(int(10 * (1 - node.LeftRatio(req)/2)))
+	}
+
+	return h.GetResult()
+}
+
+func (p *NumaPriority) ScoreIntervals() score.Intervals {
+	return score.NewIntervals(0, 3, 7)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/priorities"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+	"yunion.io/x/onecloud/pkg/scheduler/core/score"
+	"yunion.io/x/onecloud/pkg/scheduler/data_manager/metrics"
+	o "yunion.io/x/onecloud/pkg/scheduler/options"
+)
+
+const (
+	utilizationCpuWeight  = 0.35
+	utilizationMemWeight  = 0.35
+	utilizationDiskWeight = 0.15
+	utilizationNetWeight  = 0.15
+
+	// hosts loaded above this are scored as the minimum to avoid hot spots
+	utilizationHotThreshold = 0.9
+)
+
+// UtilizationPriority score hosts by their real p95 utilization of cpu,
+// memory, disk iops and network throughput in the recent lookback window.
+// Hosts without fresh metrics fall back to committed cpu and memory rates.
+type UtilizationPriority struct {
+	priorities.BasePriority
+}
+
+func (p *UtilizationPriority) Name() string {
+	return "host_utilization"
+}
+
+func (p *UtilizationPriority) Clone() core.Priority {
+	return &UtilizationPriority{}
+}
+
+func (p *UtilizationPriority) Map(u *core.Unit, c core.Candidater) (core.HostPriority, error) {
+	h := priorities.NewPriorityHelper(p, u, c)
+
+	hc, err := p.HostCandidate(c)
+	if err != nil {
+		return core.HostPriority{}, err
+	}
+
+	var load float64
+	if m, ok := metrics.GetHostMetrics(hc.Id); ok {
+		opts := o.GetOptions()
+		load = metricsLoad(m, opts.MetricsDiskIopsCapacity, opts.MetricsNetBpsCapacity)
+	} else {
+		load = committedLoad(hc)
+	}
+	h.SetScore(loadToScore(load))
+
+	return h.GetResult()
+}
+
+func (p *UtilizationPriority) ScoreIntervals() score.Intervals {
+	return score.NewIntervals(0, 3, 7)
+}
+
+func ratio(used float64, capacity float64) float64 {
+	if capacity <= 0 {
+		return 0
+	}
+	r := used / capacity
+	if r > 1 {
+		return 1
+	}
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func metricsLoad(m *metrics.SHostMetrics, iopsCapacity int, bpsCapacity int64) float64 {
+	return utilizationCpuWeight*ratio(m.CpuUsageP95, 100) +
+		utilizationMemWeight*ratio(m.MemUsageP95, 100) +
+		utilizationDiskWeight*ratio(m.DiskIopsP95, float64(iopsCapacity)) +
+		utilizationNetWeight*ratio(m.NetBpsP95, float64(bpsCapacity))
+}
+
+func committedLoad(hc *candidate.HostDesc) float64 {
+	cpuRate := ratio(float64(hc.RunningCPUCount), float64(hc.TotalCPUCount))
+	memRate := ratio(float64(hc.RunningMemSize), float64(hc.TotalMemSize))
+	return (cpuRate + memRate) / 2
+}
+
+func loadToScore(load float64) int {
+	if load >= utilizationHotThreshold {
+		return -1
+	}
+	return int(10 * (1 - load))
+}
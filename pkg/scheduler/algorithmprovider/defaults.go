@@ -44,6 +44,7 @@ func defaultPredicates() sets.String {
 		factory.RegisterFitPredicate("m-GuestDiskschedtagFilter", &predicates.DiskSchedtagPredicate{}),
 		factory.RegisterFitPredicate("n-ServerSkuFilter", &predicates.InstanceTypePredicate{}),
 		factory.RegisterFitPredicate("o-GuestNetschedtagFilter", &predicates.NetworkSchedtagPredicate{}),
+		factory.RegisterFitPredicate("p-GuestNumaFilter", &predicateguest.NumaPredicate{}),
 	)
 }
 
@@ -53,5 +54,7 @@ func defaultPriorities() sets.String {
 		factory.RegisterPriority("guest-lowload", &priorityguest.LowLoadPriority{}, 1),
 		factory.RegisterPriority("guest-creating", &priorityguest.CreatingPriority{}, 1),
 		factory.RegisterPriority("guest-capacity", &priorityguest.CapacityPriority{}, 1),
+		factory.RegisterPriority("guest-utilization", &priorityguest.UtilizationPriority{}, 1),
+		factory.RegisterPriority("guest-numa", &priorityguest.NumaPriority{}, 1),
 	)
 }
@@ -17,7 +17,7 @@ package api
 import (
 	"net/http"
 
-	//"yunion.io/x/jsonutils"
+	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 
 	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
@@ -47,7 +47,10 @@ func FetchSchedInfo(req *http.Request) (*SchedInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	return FetchSchedInfoByJSON(body)
+}
 
+func FetchSchedInfoByJSON(body jsonutils.JSONObject) (*SchedInfo, error) {
 	input, err := cmdline.FetchScheduleInputByJSON(body)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,62 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// SimulateSku is a server spec to simulate, if only Name is given the
+// cpu and memory size is taken from server sku of the same name
+type SimulateSku struct {
+	Name      string `json:"name"`
+	CpuCount  int    `json:"cpu_count"`
+	MemSizeMb int    `json:"mem_size_mb"`
+}
+
+// SimulateHost adds Count hypothetical hosts which are copies of the
+// existing Template host without any guest on them
+type SimulateHost struct {
+	Template string `json:"template"`
+	Count    int    `json:"count"`
+}
+
+// SimulateArgs is posted to scheduler simulate api together with the
+// fields of a normal schedule input describing disks, networks and so on
+type SimulateArgs struct {
+	Skus        []SimulateSku  `json:"skus"`
+	RemoveHosts []string       `json:"remove_hosts"`
+	AddHosts    []SimulateHost `json:"add_hosts"`
+}
+
+type SimulateZoneResult struct {
+	ZoneId    string `json:"zone_id"`
+	Zone      string `json:"zone"`
+	Count     int64  `json:"count"`
+	HostCount int    `json:"host_count"`
+}
+
+type SimulateSkuResult struct {
+	Sku SimulateSku `json:"sku"`
+	// maximal count of servers of the sku could be packed into candidates
+	Count int64                 `json:"count"`
+	Zones []*SimulateZoneResult `json:"zones"`
+	// the earliest predicate in pipeline which filtered out any candidate
+	FirstFailedFilter string            `json:"first_failed_filter"`
+	Filters           []*ForecastFilter `json:"filters"`
+}
+
+type SimulateResult struct {
+	HostCount    int                  `json:"host_count"`
+	RemovedHosts []string             `json:"removed_hosts"`
+	AddedHosts   []string             `json:"added_hosts"`
+	Results      []*SimulateSkuResult `json:"results"`
+}
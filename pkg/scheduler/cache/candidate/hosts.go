@@ -17,6 +17,7 @@ package candidate
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	gosync "sync"
 	"sync/atomic"
@@ -31,10 +32,12 @@ import (
 
 	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	computedb "yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
 	computemodels "yunion.io/x/onecloud/pkg/compute/models"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
 	"yunion.io/x/onecloud/pkg/scheduler/db/models"
 	o "yunion.io/x/onecloud/pkg/scheduler/options"
+	"yunion.io/x/onecloud/pkg/util/numautils"
 )
 
 type HostDesc struct {
@@ -78,6 +81,9 @@ type HostDesc struct {
 	IsMaintenance             bool                  `json:"is_maintenance"`
 	GuestReservedResource     *ReservedResource     `json:"guest_reserved_resource"`
 	GuestReservedResourceUsed *ReservedResource     `json:"guest_reserved_used"`
+
+	// NUMA nodes with resource used by guests bound to a single node
+	NumaNodes []*numautils.SNode `json:"numa_nodes"`
 }
 
 type ReservedResource struct {
@@ -821,7 +827,8 @@ func (b *HostBuilder) setMetadataInfo(hostIDs []string, errMessageChannel chan e
 		errMessageChannel <- err
 		return
 	}
-	guestMetadataNames := []string{"app_tags"}
+	guestMetadataNames := []string{"app_tags", computeapi.VM_METADATA_NUMA_SINGLE_NODE,
+		computeapi.VM_METADATA_DEDICATED_CPU, computeapi.VM_METADATA_NUMA_NODE}
 	guestMetadatas, err := models.FetchMetadatas(models.GuestResourceName, b.guestIDs, guestMetadataNames)
 	if err != nil {
 		errMessageChannel <- err
@@ -983,6 +990,7 @@ func (b *HostBuilder) buildOne(host *computemodels.SHost) (interface{}, error) {
 
 	desc.Metadata = make(map[string]string)
 
+	desc.IsMaintenance = host.IsMaintenance
 	desc.CPUCmtbound = host.GetCPUOvercommitBound()
 	desc.MemCmtbound = host.GetMemoryOvercommitBound()
 
@@ -999,6 +1007,7 @@ func (b *HostBuilder) buildOne(host *computemodels.SHost) (interface{}, error) {
 		b.fillMetadata,
 		b.fillIsolatedDevices,
 		b.fillCPUIOLoads,
+		b.fillNumaNodes,
 	}
 
 	for _, f := range fillFuncs {
@@ -1125,6 +1134,64 @@ func (b *HostBuilder) fillGuestsResourceInfo(desc *HostDesc, host *computemodels
 	return nil
 }
 
+func (b *HostBuilder) guestMetadata(guest computemodels.SGuest, key string) string {
+	metadatas, ok := b.guestMetadatasDict[guest.GetId()]
+	if !ok {
+		return ""
+	}
+	for _, obj := range metadatas {
+		metadata, ok := obj.(*models.Metadata)
+		if !ok {
+			log.Errorf("%v", utils.ConvertError(obj, "*models.Metadata"))
+			return ""
+		}
+		if metadata.Key == key {
+			return metadata.Value
+		}
+	}
+	return ""
+}
+
+func (b *HostBuilder) fillNumaNodes(desc *HostDesc, host *computemodels.SHost) error {
+	if host.SysInfo == nil || !host.SysInfo.Contains("numa_nodes") {
+		return nil
+	}
+	topology := make([]*types.SNumaNode, 0)
+	if err := host.SysInfo.Unmarshal(&topology, "numa_nodes"); err != nil {
+		log.Errorf("host %s unmarshal numa_nodes: %v", host.Name, err)
+		return nil
+	}
+	nodes := numautils.NewNodes(topology)
+
+	guestsOnHost := b.hostGuests[host.Id]
+	usages := make([]numautils.SGuestUsage, 0)
+	for _, gst := range guestsOnHost {
+		guest := gst.(computemodels.SGuest)
+		if IsGuestPendingDelete(guest) {
+			continue
+		}
+		dedicated := b.guestMetadata(guest, computeapi.VM_METADATA_DEDICATED_CPU) == "true"
+		if !dedicated && b.guestMetadata(guest, computeapi.VM_METADATA_NUMA_SINGLE_NODE) != "true" {
+			continue
+		}
+		usage := numautils.SGuestUsage{
+			SRequest: numautils.SRequest{
+				CpuCount:  guest.VcpuCount,
+				MemSizeMb: guest.VmemSize,
+				Dedicated: dedicated,
+			},
+			NodeId: numautils.NODE_UNKNOWN,
+		}
+		if nodeId, err := strconv.Atoi(b.guestMetadata(guest, computeapi.VM_METADATA_NUMA_NODE)); err == nil {
+			usage.NodeId = nodeId
+		}
+		usages = append(usages, usage)
+	}
+	numautils.PlaceGuests(nodes, usages, desc.CPUCmtbound)
+	desc.NumaNodes = nodes
+	return nil
+}
+
 func (b *HostBuilder) guestAppTags(guest computemodels.SGuest) []string {
 	metadatas, ok := b.guestMetadatasDict[guest.GetId()]
 	if !ok {
@@ -0,0 +1,75 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package candidate
+
+import (
+	"yunion.io/x/onecloud/pkg/util/numautils"
+)
+
+// CloneEmpty returns a hypothetical host with the same hardware, zone,
+// schedtags, networks and storages as h but without any guest on it.
+// Storages are shared with h, so free local storage is the same as h.
+// The clone is only used by what-if simulation and never put into cache.
+func (h *HostDesc) CloneEmpty(id, name string) *HostDesc {
+	host := *h.SHost
+	host.Id = id
+	host.Name = name
+	base := *h.BaseHostDesc
+	base.SHost = &host
+	base.Tenants = make(map[string]int64)
+
+	desc := *h
+	desc.BaseHostDesc = &base
+
+	desc.GuestCount = 0
+	desc.CreatingGuestCount = 0
+	desc.RunningGuestCount = 0
+	desc.RunningCPUCount = 0
+	desc.CreatingCPUCount = 0
+	desc.RequiredCPUCount = 0
+	desc.FakeDeletedCPUCount = 0
+	desc.CPUBoundCount = 0
+	desc.CPULoad = nil
+	desc.RunningMemSize = 0
+	desc.CreatingMemSize = 0
+	desc.RequiredMemSize = 0
+	desc.FakeDeletedMemSize = 0
+	desc.IOBoundCount = 0
+	desc.IOLoad = nil
+	desc.Groups = NewGroupCounts()
+	desc.GuestReservedResourceUsed = &ReservedResource{}
+	desc.FreeCPUCount = desc.TotalCPUCount - desc.GetReservedCPUCount()
+	desc.FreeMemSize = desc.TotalMemSize - desc.GetReservedMemSize()
+
+	desc.IsolatedDevices = make([]*IsolatedDeviceDesc, 0, len(h.IsolatedDevices))
+	for _, dev := range h.IsolatedDevices {
+		d := *dev
+		d.GuestID = ""
+		d.HostID = id
+		desc.IsolatedDevices = append(desc.IsolatedDevices, &d)
+	}
+	if h.NumaNodes != nil {
+		desc.NumaNodes = make([]*numautils.SNode, 0, len(h.NumaNodes))
+		for _, node := range h.NumaNodes {
+			desc.NumaNodes = append(desc.NumaNodes, &numautils.SNode{
+				NodeId:            node.NodeId,
+				CpuCount:          node.CpuCount,
+				MemSizeMb:         node.MemSizeMb,
+				HugepageMemSizeMb: node.HugepageMemSizeMb,
+			})
+		}
+	}
+	return &desc
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/wait"
+
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/util/influxdb"
+)
+
+var (
+	metricsManager *SMetricsManager
+)
+
+// SHostMetrics is the p95 utilization of a host in the lookback window,
+// calculated from the metrics reported by telegraf deployed on host
+type SHostMetrics struct {
+	HostId string
+
+	// CpuUsageP95 and MemUsageP95 are in percent
+	CpuUsageP95 float64
+	MemUsageP95 float64
+	// DiskIopsP95 is the sum of read and write operations per second of all disks
+	DiskIopsP95 float64
+	// NetBpsP95 is the sum of received and sent bits per second of all nics
+	NetBpsP95 float64
+
+	// UpdatedAt is the time of the latest cpu sample of host
+	UpdatedAt time.Time
+}
+
+type SMetricsConfig struct {
+	Database        string
+	RetentionPolicy string
+	RefreshInterval time.Duration
+	Lookback        time.Duration
+	StaleThreshold  time.Duration
+}
+
+type SMetricsManager struct {
+	config SMetricsConfig
+
+	lock  sync.RWMutex
+	hosts map[string]*SHostMetrics
+
+	getUrls func() ([]string, error)
+}
+
+func getInfluxdbUrls() ([]string, error) {
+	return auth.GetServiceURLs("influxdb", options.Options.Region, "", "internal")
+}
+
+func newMetricsManager(config SMetricsConfig) *SMetricsManager {
+	return &SMetricsManager{
+		config:  config,
+		hosts:   make(map[string]*SHostMetrics),
+		getUrls: getInfluxdbUrls,
+	}
+}
+
+func Start(config SMetricsConfig) {
+	metricsManager = newMetricsManager(config)
+	metricsManager.sync()
+}
+
+// GetHostMetrics return utilization metrics of host, false is returned if
+// metrics of host are absent or stale
+func GetHostMetrics(hostId string) (*SHostMetrics, bool) {
+	if metricsManager == nil {
+		return nil, false
+	}
+	return metricsManager.GetHostMetrics(hostId)
+}
+
+func (m *SMetricsManager) GetHostMetrics(hostId string) (*SHostMetrics, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	metrics, ok := m.hosts[hostId]
+	if !ok {
+		return nil, false
+	}
+	if time.Since(metrics.UpdatedAt) > m.config.StaleThreshold {
+		return nil, false
+	}
+	return metrics, true
+}
+
+func (m *SMetricsManager) sync() {
+	wait.Forever(m.syncOnce, m.config.RefreshInterval)
+}
+
+func (m *SMetricsManager) syncOnce() {
+	urls, err := m.getUrls()
+	if err != nil || len(urls) == 0 {
+		log.Warningf("MetricsManager no influxdb service found: %v", err)
+		return
+	}
+	for _, url := range urls {
+		hosts, err := m.fetch(influxdb.NewInfluxdb(url))
+		if err != nil {
+			log.Errorf("MetricsManager fetch host metrics from %s error: %v", url, err)
+			continue
+		}
+		m.lock.Lock()
+		m.hosts = hosts
+		m.lock.Unlock()
+		log.Debugf("MetricsManager fetched metrics of %d hosts from %s", len(hosts), url)
+		return
+	}
+}
+
+func (m *SMetricsManager) measurement(name string) string {
+	if len(m.config.RetentionPolicy) > 0 {
+		return fmt.Sprintf(`"%s"."%s"."%s"`, m.config.Database, m.config.RetentionPolicy, name)
+	}
+	return fmt.Sprintf(`"%s".."%s"`, m.config.Database, name)
+}
+
+// counterRateQuery return p95 of per second rate of the sum of counter
+// fields across all devices of a host
+func (m *SMetricsManager) counterRateQuery(measurement string, fields []string, where string) string {
+	rates := make([]string, len(fields))
+	for i, field := range fields {
+		rates[i] = fmt.Sprintf(`NON_NEGATIVE_DERIVATIVE(LAST("%s"), 1s)`, field)
+	}
+	perDevice := fmt.Sprintf(`SELECT %s AS "rate" FROM %s WHERE %s GROUP BY time(1m), "host_id", "name", "interface"`,
+		strings.Join(rates, " + "), m.measurement(measurement), where)
+	perHost := fmt.Sprintf(`SELECT SUM("rate") AS "rate" FROM (%s) GROUP BY time(1m), "host_id"`, perDevice)
+	return fmt.Sprintf(`SELECT PERCENTILE("rate", 95) FROM (%s) GROUP BY "host_id"`, perHost)
+}
+
+func (m *SMetricsManager) queries() []string {
+	where := fmt.Sprintf(`time > now() - %ds AND "res_type" = 'host'`, int64(m.config.Lookback.Seconds()))
+	return []string{
+		fmt.Sprintf(`SELECT LAST("usage_active") FROM %s WHERE %s GROUP BY "host_id"`, m.measurement("cpu"), where),
+		fmt.Sprintf(`SELECT PERCENTILE("usage_active", 95) FROM %s WHERE %s GROUP BY "host_id"`, m.measurement("cpu"), where),
+		fmt.Sprintf(`SELECT PERCENTILE("used_percent", 95) FROM %s WHERE %s GROUP BY "host_id"`, m.measurement("mem"), where),
+		m.counterRateQuery("diskio", []string{"reads", "writes"}, where),
+		m.counterRateQuery("net", []string{"bytes_recv", "bytes_sent"}, where),
+	}
+}
+
+func (m *SMetricsManager) fetch(db *influxdb.SInfluxdb) (map[string]*SHostMetrics, error) {
+	queries := m.queries()
+	results, err := db.Query(strings.Join(queries, "; "))
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(queries) {
+		return nil, fmt.Errorf("expect %d results, got %d", len(queries), len(results))
+	}
+
+	hosts := make(map[string]*SHostMetrics)
+	// only hosts with recent cpu samples are taken into account
+	for _, series := range results[0] {
+		hostId := series.Tags["host_id"]
+		if len(hostId) == 0 || len(series.Values) == 0 || len(series.Values[0]) == 0 {
+			continue
+		}
+		timeStr, _ := series.Values[0][0].GetString()
+		updatedAt, err := time.Parse(time.RFC3339Nano, timeStr)
+		if err != nil {
+			log.Errorf("MetricsManager invalid time %q of host %s: %v", timeStr, hostId, err)
+			continue
+		}
+		hosts[hostId] = &SHostMetrics{HostId: hostId, UpdatedAt: updatedAt}
+	}
+	setters := []func(*SHostMetrics, float64){
+		func(h *SHostMetrics, v float64) { h.CpuUsageP95 = v },
+		func(h *SHostMetrics, v float64) { h.MemUsageP95 = v },
+		func(h *SHostMetrics, v float64) { h.DiskIopsP95 = v },
+		func(h *SHostMetrics, v float64) { h.NetBpsP95 = v * 8 },
+	}
+	for i, setter := range setters {
+		for _, series := range results[i+1] {
+			host, ok := hosts[series.Tags["host_id"]]
+			if !ok || len(series.Values) == 0 || len(series.Values[0]) < 2 {
+				continue
+			}
+			val, err := toFloat(series.Values[0][1])
+			if err != nil {
+				continue
+			}
+			setter(host, val)
+		}
+	}
+	return hosts, nil
+}
+
+func toFloat(val jsonutils.JSONObject) (float64, error) {
+	if val == nil {
+		return 0, fmt.Errorf("nil value")
+	}
+	if floatVal, err := val.Float(); err == nil {
+		return floatVal, nil
+	}
+	intVal, err := val.Int()
+	if err != nil {
+		return 0, err
+	}
+	return float64(intVal), nil
+}
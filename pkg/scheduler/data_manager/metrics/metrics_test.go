@@ -0,0 +1,103 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsManagerFetch(t *testing.T) {
+	now := time.Now().UTC()
+	fresh := now.Add(-time.Minute).Format(time.RFC3339Nano)
+	stale := now.Add(-time.Hour).Format(time.RFC3339Nano)
+
+	var statements []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statements = strings.Split(r.URL.Query().Get("q"), "; ")
+		series := func(hostId string, val string) string {
+			return fmt.Sprintf(`{"name":"m","tags":{"host_id":"%s"},"columns":["time","v"],"values":[["1970-01-01T00:00:00Z",%s]]}`, hostId, val)
+		}
+		fmt.Fprintf(w, `{"results":[`+
+			`{"statement_id":0,"series":[{"name":"cpu","tags":{"host_id":"host1"},"columns":["time","last"],"values":[["%s",10]]},{"name":"cpu","tags":{"host_id":"host2"},"columns":["time","last"],"values":[["%s",10]]}]},`+
+			`{"statement_id":1,"series":[%s,%s]},`+
+			`{"statement_id":2,"series":[%s]},`+
+			`{"statement_id":3,"series":[%s]},`+
+			`{"statement_id":4,"series":[%s,%s]}]}`,
+			fresh, stale,
+			series("host1", "85.5"), series("host2", "20"),
+			series("host1", "60"),
+			series("host1", "1200"),
+			series("host1", "1000"), series("host3", "1000"))
+	}))
+	defer server.Close()
+
+	m := newMetricsManager(SMetricsConfig{
+		Database:        "telegraf",
+		RetentionPolicy: "autogen",
+		Lookback:        15 * time.Minute,
+		StaleThreshold:  5 * time.Minute,
+	})
+	m.getUrls = func() ([]string, error) {
+		return []string{server.URL}, nil
+	}
+	m.syncOnce()
+
+	if len(statements) != 5 {
+		t.Fatalf("expect 5 statements in one request, got %d", len(statements))
+	}
+	if !strings.Contains(statements[1], `"telegraf"."autogen"."cpu"`) || !strings.Contains(statements[1], "now() - 900s") {
+		t.Errorf("unexpected cpu statement %s", statements[1])
+	}
+
+	host1, ok := m.GetHostMetrics("host1")
+	if !ok {
+		t.Fatalf("metrics of host1 should be fresh")
+	}
+	if host1.CpuUsageP95 != 85.5 || host1.MemUsageP95 != 60 || host1.DiskIopsP95 != 1200 || host1.NetBpsP95 != 8000 {
+		t.Errorf("unexpected metrics of host1 %#v", host1)
+	}
+	if _, ok := m.GetHostMetrics("host2"); ok {
+		t.Errorf("metrics of host2 should be stale")
+	}
+	if _, ok := m.GetHostMetrics("host3"); ok {
+		t.Errorf("host3 without cpu sample should be absent")
+	}
+
+	// keep last metrics when influxdb is unreachable
+	m.getUrls = func() ([]string, error) {
+		return []string{"http://127.0.0.1:1"}, nil
+	}
+	m.syncOnce()
+	if _, ok := m.GetHostMetrics("host1"); !ok {
+		t.Errorf("metrics of host1 should be kept on fetch failure")
+	}
+}
+
+func TestMetricsManagerQueries(t *testing.T) {
+	m := newMetricsManager(SMetricsConfig{Database: "telegraf", Lookback: time.Minute})
+	for _, q := range m.queries() {
+		if strings.Contains(q, ";") {
+			t.Errorf("statement should not contain separator: %s", q)
+		}
+	}
+	if !strings.Contains(m.measurement("cpu"), `"telegraf".."cpu"`) {
+		t.Errorf("unexpected measurement %s", m.measurement("cpu"))
+	}
+}
@@ -27,6 +27,7 @@ import (
 
 	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
 	schedapi "yunion.io/x/onecloud/pkg/apis/scheduler"
+	"yunion.io/x/onecloud/pkg/appsrv"
 	computemodels "yunion.io/x/onecloud/pkg/compute/models"
 	"yunion.io/x/onecloud/pkg/scheduler/api"
 	"yunion.io/x/onecloud/pkg/scheduler/core"
@@ -81,6 +82,8 @@ func schedulerActionHandler(c *gin.Context) {
 		doCleanAllHostCache(c)
 	case "sync-sku":
 		doSyncSku(c)
+	case "simulate":
+		doSchedulerSimulate(c)
 	//case "reserved-resources":
 	//doReservedResources(c)
 	default:
@@ -135,6 +138,34 @@ func transToSchedTestResult(result *core.SchedResultItemList, limit int64) inter
 	}
 }
 
+func doSchedulerSimulate(c *gin.Context) {
+	if !schedman.IsReady() {
+		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
+		return
+	}
+	body, err := appsrv.FetchJSON(c.Request)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	schedInfo, err := api.FetchSchedInfoByJSON(body)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	args := new(api.SimulateArgs)
+	if err := body.Unmarshal(args); err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	result, err := schedman.Simulate(schedInfo, args)
+	if err != nil {
+		c.AbortWithError(http.StatusBadRequest, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 func doSchedulerForecast(c *gin.Context) {
 	if !schedman.IsReady() {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("Global scheduler not init"))
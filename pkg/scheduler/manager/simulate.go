@@ -0,0 +1,233 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	computeapi "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+// Simulate answers what-if questions of capacity planning. It copies guest
+// candidates from cache, removes or adds hypothetical hosts as args asked,
+// then runs the predicate pipeline for each sku and sums up how many
+// servers of the sku could be packed into the candidates.
+func Simulate(info *api.SchedInfo, args *api.SimulateArgs) (*api.SimulateResult, error) {
+	return schedManager.simulate(info, args)
+}
+
+func (sm *SchedulerManager) simulate(info *api.SchedInfo, args *api.SimulateArgs) (*api.SimulateResult, error) {
+	if len(args.Skus) == 0 {
+		return nil, fmt.Errorf("No sku to simulate")
+	}
+	info.IsSuggestion = true
+	info.ShowSuggestionDetails = true
+
+	gs, err := newGuestScheduler(sm, info)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := gs.Candidates()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, removed, added, err := simulateHosts(cached, args)
+	if err != nil {
+		return nil, err
+	}
+	ret := &api.SimulateResult{
+		HostCount:    len(candidates),
+		RemovedHosts: removed,
+		AddedHosts:   added,
+		Results:      make([]*api.SimulateSkuResult, 0),
+	}
+	for _, sku := range args.Skus {
+		skuRet, err := sm.simulateSku(info, sku, candidates)
+		if err != nil {
+			return nil, fmt.Errorf("Simulate sku %s: %v", sku.Name, err)
+		}
+		ret.Results = append(ret.Results, skuRet)
+	}
+	return ret, nil
+}
+
+// simulateHosts removes hosts and adds empty clones of template hosts as
+// args asked, returns the candidates and names of removed and added hosts
+func simulateHosts(cached []core.Candidater, args *api.SimulateArgs) ([]core.Candidater, []string, []string, error) {
+	removed := make([]string, 0)
+	added := make([]string, 0)
+	candidates := make([]core.Candidater, 0, len(cached))
+	for _, c := range cached {
+		name := fmt.Sprintf("%v", c.Get("Name"))
+		if utilsInStrings(args.RemoveHosts, c.IndexKey(), name) {
+			removed = append(removed, name)
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	for _, add := range args.AddHosts {
+		var template *candidate.HostDesc
+		for _, c := range cached {
+			if utilsInStrings([]string{add.Template}, c.IndexKey(), fmt.Sprintf("%v", c.Get("Name"))) {
+				template, _ = c.(*candidate.HostDesc)
+				break
+			}
+		}
+		if template == nil {
+			return nil, nil, nil, fmt.Errorf("Template host %q not found in candidates", add.Template)
+		}
+		for i := 0; i < add.Count; i++ {
+			name := fmt.Sprintf("%s-simulated-%d", template.Name, i)
+			clone := template.CloneEmpty(fmt.Sprintf("simulated-%s-%d", template.Id, i), name)
+			candidates = append(candidates, clone)
+			added = append(added, name)
+		}
+	}
+	return candidates, removed, added, nil
+}
+
+func (sm *SchedulerManager) simulateSku(info *api.SchedInfo, sku api.SimulateSku, candidates []core.Candidater) (*api.SimulateSkuResult, error) {
+	if sku.CpuCount <= 0 || sku.MemSizeMb <= 0 {
+		hypervisor := info.Hypervisor
+		if hypervisor == api.HostHypervisorForKvm {
+			hypervisor = computeapi.HYPERVISOR_KVM
+		}
+		dbSku, err := models.ServerSkuManager.FetchSkuByNameAndHypervisor(sku.Name, hypervisor, false)
+		if err != nil {
+			return nil, err
+		}
+		sku.CpuCount = dbSku.CpuCoreCount
+		sku.MemSizeMb = dbSku.MemorySizeMB
+	}
+	ret := &api.SimulateSkuResult{
+		Sku:     sku,
+		Zones:   make([]*api.SimulateZoneResult, 0),
+		Filters: make([]*api.ForecastFilter, 0),
+	}
+	if len(candidates) == 0 {
+		return ret, nil
+	}
+
+	input := *info.ScheduleInput
+	input.Ncpu = sku.CpuCount
+	input.Memory = sku.MemSizeMb
+	input.Count = 1
+	skuInfo := *info
+	skuInfo.ScheduleInput = &input
+
+	gs, err := newGuestScheduler(sm, &skuInfo)
+	if err != nil {
+		return nil, err
+	}
+	predicates, err := gs.Predicates()
+	if err != nil {
+		return nil, err
+	}
+	genericScheduler, err := core.NewGenericScheduler(gs)
+	if err != nil {
+		return nil, err
+	}
+	unit := gs.Unit()
+	if _, err := genericScheduler.Schedule(unit, candidates); err != nil {
+		return nil, err
+	}
+
+	failed := make(map[string]bool)
+	for stage, fcs := range unit.FailedCandidateMap {
+		filter := &api.ForecastFilter{
+			Filter:   stage,
+			Messages: make([]string, 0, len(fcs.Candidates)),
+		}
+		for _, fc := range fcs.Candidates {
+			failed[fc.Candidate.IndexKey()] = true
+			reasons := make([]string, 0, len(fc.Reasons))
+			for _, r := range fc.Reasons {
+				reasons = append(reasons, r.GetReason())
+			}
+			filter.Messages = append(filter.Messages,
+				fmt.Sprintf("%v: %s", fc.Candidate.Get("Name"), strings.Join(reasons, ", ")))
+			filter.Count++
+		}
+		ret.Filters = append(ret.Filters, filter)
+	}
+	order := predicatesOrder(predicates)
+	sort.Slice(ret.Filters, func(i, j int) bool {
+		return order[ret.Filters[i].Filter] < order[ret.Filters[j].Filter]
+	})
+	if len(ret.Filters) > 0 {
+		ret.FirstFailedFilter = ret.Filters[0].Filter
+	}
+
+	sumCapacity(ret, candidates, failed, unit.GetCapacity)
+	return ret, nil
+}
+
+// sumCapacity adds up capacity of candidates passed all predicates by zone,
+// capacity of candidates which is unlimited by any predicate is ignored
+func sumCapacity(ret *api.SimulateSkuResult, candidates []core.Candidater, failed map[string]bool, capacity func(id string) int64) {
+	zones := make(map[string]*api.SimulateZoneResult)
+	for _, c := range candidates {
+		zone := c.Getter().Zone()
+		zoneRet, ok := zones[zone.Id]
+		if !ok {
+			zoneRet = &api.SimulateZoneResult{ZoneId: zone.Id, Zone: zone.Name}
+			zones[zone.Id] = zoneRet
+			ret.Zones = append(ret.Zones, zoneRet)
+		}
+		zoneRet.HostCount++
+		if failed[c.IndexKey()] {
+			continue
+		}
+		count := capacity(c.IndexKey())
+		if count <= 0 || count >= core.MaxCapacity {
+			continue
+		}
+		zoneRet.Count += count
+		ret.Count += count
+	}
+}
+
+// predicatesOrder returns the position of each predicate in pipeline, the
+// pipeline runs predicates sorted by their registered keys
+func predicatesOrder(predicates map[string]core.FitPredicate) map[string]int {
+	keys := make([]string, 0, len(predicates))
+	for key := range predicates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	order := make(map[string]int)
+	for i, key := range keys {
+		order[predicates[key].Name()] = i
+	}
+	return order
+}
+
+func utilsInStrings(ss []string, keys ...string) bool {
+	for _, s := range ss {
+		for _, key := range keys {
+			if s == key {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/scheduler/api"
+	"yunion.io/x/onecloud/pkg/scheduler/cache/candidate"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+func newSimulateTestHost(id, name, zoneId string, cpu, mem int64) *candidate.HostDesc {
+	host := &computemodels.SHost{}
+	host.Id = id
+	host.Name = name
+	host.ZoneId = zoneId
+	zone := &computemodels.SZone{}
+	zone.Id = zoneId
+	zone.Name = zoneId + "-name"
+	return &candidate.HostDesc{
+		BaseHostDesc:          &candidate.BaseHostDesc{SHost: host, Zone: zone},
+		TotalCPUCount:         cpu,
+		TotalMemSize:          mem,
+		RunningCPUCount:       cpu / 2,
+		RunningMemSize:        mem / 2,
+		GuestCount:            3,
+		GuestReservedResource: candidate.NewReservedResource(0, 0, 0),
+	}
+}
+
+func simulateTestHosts() []core.Candidater {
+	return []core.Candidater{
+		newSimulateTestHost("h1", "host1", "z1", 32, 65536),
+		newSimulateTestHost("h2", "host2", "z1", 32, 65536),
+		newSimulateTestHost("h3", "host3", "z2", 64, 131072),
+	}
+}
+
+func candidateIds(candidates []core.Candidater) []string {
+	ids := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		ids = append(ids, c.IndexKey())
+	}
+	return ids
+}
+
+func TestSimulateHosts(t *testing.T) {
+	cases := []struct {
+		name    string
+		args    *api.SimulateArgs
+		ids     []string
+		removed []string
+		added   []string
+		wantErr bool
+	}{
+		{
+			name:    "unchanged",
+			args:    &api.SimulateArgs{},
+			ids:     []string{"h1", "h2", "h3"},
+			removed: []string{},
+			added:   []string{},
+		},
+		{
+			name:    "remove by id and name",
+			args:    &api.SimulateArgs{RemoveHosts: []string{"h1", "host3"}},
+			ids:     []string{"h2"},
+			removed: []string{"host1", "host3"},
+			added:   []string{},
+		},
+		{
+			name: "add clones of template",
+			args: &api.SimulateArgs{
+				AddHosts: []api.SimulateHost{{Template: "host3", Count: 2}},
+			},
+			ids:     []string{"h1", "h2", "h3", "simulated-h3-0", "simulated-h3-1"},
+			removed: []string{},
+			added:   []string{"host3-simulated-0", "host3-simulated-1"},
+		},
+		{
+			name: "removed host can still be template",
+			args: &api.SimulateArgs{
+				RemoveHosts: []string{"h1"},
+				AddHosts:    []api.SimulateHost{{Template: "h1", Count: 1}},
+			},
+			ids:     []string{"h2", "h3", "simulated-h1-0"},
+			removed: []string{"host1"},
+			added:   []string{"host1-simulated-0"},
+		},
+		{
+			name: "template not found",
+			args: &api.SimulateArgs{
+				AddHosts: []api.SimulateHost{{Template: "host9", Count: 1}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		candidates, removed, added, err := simulateHosts(simulateTestHosts(), c.args)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: want error", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err)
+			continue
+		}
+		if ids := candidateIds(candidates); !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: want candidates %v got %v", c.name, c.ids, ids)
+		}
+		if !reflect.DeepEqual(removed, c.removed) {
+			t.Errorf("%s: want removed %v got %v", c.name, c.removed, removed)
+		}
+		if !reflect.DeepEqual(added, c.added) {
+			t.Errorf("%s: want added %v got %v", c.name, c.added, added)
+		}
+	}
+}
+
+func TestSimulateHostsCloneEmpty(t *testing.T) {
+	args := &api.SimulateArgs{AddHosts: []api.SimulateHost{{Template: "h1", Count: 1}}}
+	candidates, _, _, err := simulateHosts(simulateTestHosts(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := candidates[len(candidates)-1].(*candidate.HostDesc)
+	if clone.GuestCount != 0 || clone.RunningCPUCount != 0 || clone.RunningMemSize != 0 {
+		t.Errorf("clone should have no guest, got %d guests %d cpu %d mem",
+			clone.GuestCount, clone.RunningCPUCount, clone.RunningMemSize)
+	}
+	if clone.FreeCPUCount != 32 || clone.FreeMemSize != 65536 {
+		t.Errorf("clone should have all resources free, got %d cpu %d mem", clone.FreeCPUCount, clone.FreeMemSize)
+	}
+	if clone.Getter().Zone().Id != "z1" {
+		t.Errorf("clone should be in zone of template, got %s", clone.Getter().Zone().Id)
+	}
+	template := candidates[0].(*candidate.HostDesc)
+	if template.Id != "h1" || template.GuestCount != 3 {
+		t.Errorf("template should not be changed by clone, got %s with %d guests", template.Id, template.GuestCount)
+	}
+}
+
+func TestSumCapacity(t *testing.T) {
+	type zoneCount struct {
+		hosts int
+		count int64
+	}
+	cases := []struct {
+		name     string
+		failed   map[string]bool
+		capacity map[string]int64
+		count    int64
+		zones    map[string]zoneCount
+	}{
+		{
+			name:     "all passed",
+			failed:   map[string]bool{},
+			capacity: map[string]int64{"h1": 4, "h2": 2, "h3": 10},
+			count:    16,
+			zones:    map[string]zoneCount{"z1": {2, 6}, "z2": {1, 10}},
+		},
+		{
+			name:     "failed host counted as host but not capacity",
+			failed:   map[string]bool{"h2": true},
+			capacity: map[string]int64{"h1": 4, "h2": 2, "h3": 10},
+			count:    14,
+			zones:    map[string]zoneCount{"z1": {2, 4}, "z2": {1, 10}},
+		},
+		{
+			name:     "unlimited and empty capacity ignored",
+			failed:   map[string]bool{},
+			capacity: map[string]int64{"h1": core.MaxCapacity, "h2": 0, "h3": 3},
+			count:    3,
+			zones:    map[string]zoneCount{"z1": {2, 0}, "z2": {1, 3}},
+		},
+	}
+	for _, c := range cases {
+		ret := &api.SimulateSkuResult{Zones: make([]*api.SimulateZoneResult, 0)}
+		sumCapacity(ret, simulateTestHosts(), c.failed, func(id string) int64 { return c.capacity[id] })
+		if ret.Count != c.count {
+			t.Errorf("%s: want count %d got %d", c.name, c.count, ret.Count)
+		}
+		if len(ret.Zones) != len(c.zones) {
+			t.Errorf("%s: want %d zones got %d", c.name, len(c.zones), len(ret.Zones))
+		}
+		for _, zone := range ret.Zones {
+			want := c.zones[zone.ZoneId]
+			if zone.HostCount != want.hosts || zone.Count != want.count {
+				t.Errorf("%s: zone %s want %d hosts count %d, got %d hosts count %d",
+					c.name, zone.ZoneId, want.hosts, want.count, zone.HostCount, zone.Count)
+			}
+			if zone.Zone != zone.ZoneId+"-name" {
+				t.Errorf("%s: invalid zone name %s", c.name, zone.Zone)
+			}
+		}
+	}
+}
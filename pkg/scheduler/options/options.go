@@ -96,6 +96,15 @@ type SchedOptions struct {
 	WireDBCachePeriod string `help:"Wire database cache period" default:"5m"`
 
 	SkuRefreshInterval string `help:"Server SKU refresh interval" default:"12h"`
+
+	// host utilization metrics options
+	MetricsDatabase         string `help:"Influxdb database of telegraf host metrics" default:"telegraf"`
+	MetricsRetentionPolicy  string `help:"Influxdb retention policy telegraf writes to" default:"autogen"`
+	MetricsRefreshInterval  string `help:"Host utilization metrics refresh interval" default:"1m"`
+	MetricsLookbackWindow   string `help:"Lookback window to calculate p95 of host utilization" default:"15m"`
+	MetricsStaleThreshold   string `help:"Host metrics older than this are stale and fall back to committed capacity" default:"5m"`
+	MetricsDiskIopsCapacity int    `help:"Disk IOPS regarded as fully utilized when scoring host" default:"5000"`
+	MetricsNetBpsCapacity   int64  `help:"Network bits per second regarded as fully utilized when scoring host" default:"1000000000"`
 }
 
 var (
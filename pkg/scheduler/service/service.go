@@ -30,6 +30,7 @@ import (
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	computemodels "yunion.io/x/onecloud/pkg/compute/models"
+	metricsman "yunion.io/x/onecloud/pkg/scheduler/data_manager/metrics"
 	skuman "yunion.io/x/onecloud/pkg/scheduler/data_manager/sku"
 	"yunion.io/x/onecloud/pkg/scheduler/db/models"
 	schedhandler "yunion.io/x/onecloud/pkg/scheduler/handler"
@@ -61,6 +62,13 @@ func StartService() error {
 
 		stopEverything := make(chan struct{})
 		go skuman.Start(utils.ToDuration(opts.SkuRefreshInterval))
+		go metricsman.Start(metricsman.SMetricsConfig{
+			Database:        opts.MetricsDatabase,
+			RetentionPolicy: opts.MetricsRetentionPolicy,
+			RefreshInterval: utils.ToDuration(opts.MetricsRefreshInterval),
+			Lookback:        utils.ToDuration(opts.MetricsLookbackWindow),
+			StaleThreshold:  utils.ToDuration(opts.MetricsStaleThreshold),
+		})
 		schedman.InitAndStart(stopEverything)
 	}
 
@@ -0,0 +1,525 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmeutils
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	STATUS_PENDING     = "pending"
+	STATUS_PROCESSING  = "processing"
+	STATUS_READY       = "ready"
+	STATUS_VALID       = "valid"
+	STATUS_INVALID     = "invalid"
+	CHALLENGE_HTTP_01  = "http-01"
+	IDENTIFIER_DNS     = "dns"
+	PROBLEM_BAD_NONCE  = "urn:ietf:params:acme:error:badNonce"
+	HTTP01_PATH_PREFIX = "/.well-known/acme-challenge/"
+
+	contentTypeJOSE = "application/jose+json"
+)
+
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+	RevokeCert string `json:"revokeCert"`
+	KeyChange  string `json:"keyChange"`
+}
+
+// Problem is an ACME error document as defined in RFC 8555 section 6.7
+type Problem struct {
+	Type       string `json:"type"`
+	Detail     string `json:"detail"`
+	Status     int    `json:"status"`
+	httpStatus int
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("acme: %d %s: %s", p.httpStatus, p.Type, p.Detail)
+}
+
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type Order struct {
+	URL string `json:"-"`
+
+	Status         string       `json:"status"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Problem     `json:"error,omitempty"`
+}
+
+type Challenge struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Token  string   `json:"token"`
+	Status string   `json:"status"`
+	Error  *Problem `json:"error,omitempty"`
+}
+
+type Authorization struct {
+	URL string `json:"-"`
+
+	Status     string      `json:"status"`
+	Identifier Identifier  `json:"identifier"`
+	Challenges []Challenge `json:"challenges"`
+	Wildcard   bool        `json:"wildcard,omitempty"`
+}
+
+// Challenge returns challenge of the specified type
+func (authz *Authorization) Challenge(typ string) *Challenge {
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == typ {
+			return &authz.Challenges[i]
+		}
+	}
+	return nil
+}
+
+// Client talks to an ACME server with an ECDSA P-256 account key
+type Client struct {
+	DirectoryURL string
+	Key          *ecdsa.PrivateKey
+	HTTPClient   *http.Client
+	// PollInterval is the interval to poll status of authorizations and
+	// orders
+	PollInterval time.Duration
+
+	dir    *Directory
+	kid    string
+	nonces []string
+}
+
+func NewClient(directoryURL string, key *ecdsa.PrivateKey, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		DirectoryURL: directoryURL,
+		Key:          key,
+		HTTPClient:   httpClient,
+		PollInterval: 3 * time.Second,
+	}
+}
+
+func (c *Client) Discover(ctx context.Context) (*Directory, error) {
+	if c.dir != nil {
+		return c.dir, nil
+	}
+	req, err := http.NewRequest("GET", c.DirectoryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	dir := &Directory{}
+	if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+		return nil, fmt.Errorf("acme: decode directory: %s", err)
+	}
+	c.dir = dir
+	return dir, nil
+}
+
+// Register creates an account or finds the existing one bound to the
+// account key.  Terms of service is agreed on behalf of the caller
+func (c *Client) Register(ctx context.Context, email string) error {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return err
+	}
+	req := map[string]interface{}{
+		"termsOfServiceAgreed": true,
+	}
+	if email != "" {
+		req["contact"] = []string{"mailto:" + email}
+	}
+	resp, err := c.post(ctx, dir.NewAccount, req, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	kid := resp.Header.Get("Location")
+	if kid == "" {
+		return fmt.Errorf("acme: new account: no account url in response")
+	}
+	c.kid = kid
+	return nil
+}
+
+func (c *Client) NewOrder(ctx context.Context, domains []string) (*Order, error) {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]Identifier, len(domains))
+	for i, domain := range domains {
+		ids[i] = Identifier{Type: IDENTIFIER_DNS, Value: domain}
+	}
+	req := map[string]interface{}{
+		"identifiers": ids,
+	}
+	order := &Order{}
+	resp, err := c.postJSON(ctx, dir.NewOrder, req, order)
+	if err != nil {
+		return nil, err
+	}
+	order.URL = resp.Header.Get("Location")
+	return order, nil
+}
+
+func (c *Client) GetOrder(ctx context.Context, url string) (*Order, error) {
+	order := &Order{}
+	if _, err := c.postJSON(ctx, url, nil, order); err != nil {
+		return nil, err
+	}
+	order.URL = url
+	return order, nil
+}
+
+func (c *Client) GetAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	authz := &Authorization{}
+	if _, err := c.postJSON(ctx, url, nil, authz); err != nil {
+		return nil, err
+	}
+	authz.URL = url
+	return authz, nil
+}
+
+// Accept tells the server that the challenge is ready for validation
+func (c *Client) Accept(ctx context.Context, chal *Challenge) error {
+	_, err := c.postJSON(ctx, chal.URL, struct{}{}, chal)
+	return err
+}
+
+// WaitAuthorization polls the authorization until it's valid or invalid
+func (c *Client) WaitAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	for {
+		authz, err := c.GetAuthorization(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		switch authz.Status {
+		case STATUS_VALID:
+			return authz, nil
+		case STATUS_PENDING, STATUS_PROCESSING:
+		default:
+			for _, chal := range authz.Challenges {
+				if chal.Error != nil {
+					return nil, fmt.Errorf("authorization %s %s: %s", authz.Identifier.Value, authz.Status, chal.Error)
+				}
+			}
+			return nil, fmt.Errorf("authorization %s %s", authz.Identifier.Value, authz.Status)
+		}
+		if err := c.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Finalize submits the certificate signing request in DER form and waits
+// for the order to become valid
+func (c *Client) Finalize(ctx context.Context, order *Order, csr []byte) (*Order, error) {
+	req := map[string]string{
+		"csr": base64.RawURLEncoding.EncodeToString(csr),
+	}
+	o := &Order{}
+	if _, err := c.postJSON(ctx, order.Finalize, req, o); err != nil {
+		return nil, err
+	}
+	o.URL = order.URL
+	for {
+		switch o.Status {
+		case STATUS_VALID:
+			return o, nil
+		case STATUS_PENDING, STATUS_PROCESSING, STATUS_READY:
+		default:
+			if o.Error != nil {
+				return nil, fmt.Errorf("order %s: %s", o.Status, o.Error)
+			}
+			return nil, fmt.Errorf("order %s", o.Status)
+		}
+		if err := c.sleep(ctx); err != nil {
+			return nil, err
+		}
+		var err error
+		if o, err = c.GetOrder(ctx, order.URL); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// FetchCertificate downloads the PEM encoded certificate chain
+func (c *Client) FetchCertificate(ctx context.Context, url string) ([]byte, error) {
+	resp, err := c.post(ctx, url, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// HTTP01KeyAuthorization returns content to be served at
+// HTTP01ChallengePath(token)
+func (c *Client) HTTP01KeyAuthorization(token string) string {
+	return token + "." + JWKThumbprint(&c.Key.PublicKey)
+}
+
+func HTTP01ChallengePath(token string) string {
+	return HTTP01_PATH_PREFIX + token
+}
+
+func (c *Client) sleep(ctx context.Context) error {
+	t := time.NewTimer(c.PollInterval)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) postJSON(ctx context.Context, url string, payload interface{}, v interface{}) (*http.Response, error) {
+	resp, err := c.post(ctx, url, payload, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("acme: decode response of %s: %s", url, err)
+	}
+	return resp, nil
+}
+
+// post sends a JWS signed request.  A nil payload makes it a POST-as-GET
+// request.  The request is retried once on badNonce error
+func (c *Client) post(ctx context.Context, url string, payload interface{}, useJWK bool) (*http.Response, error) {
+	var payloadBytes []byte
+	if payload != nil {
+		var err error
+		payloadBytes, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var lastErr error
+	for i := 0; i < 2; i++ {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+		body, err := c.signJWS(url, nonce, payloadBytes, useJWK)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentTypeJOSE)
+		resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		c.saveNonce(resp)
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+		lastErr = responseError(resp)
+		resp.Body.Close()
+		if p, ok := lastErr.(*Problem); !ok || p.Type != PROBLEM_BAD_NONCE {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("HEAD", dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", fmt.Errorf("acme: no nonce from %s", dir.NewNonce)
+	}
+	return nonce, nil
+}
+
+func (c *Client) saveNonce(resp *http.Response) {
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.nonces = append(c.nonces, nonce)
+	}
+}
+
+func (c *Client) signJWS(url, nonce string, payload []byte, useJWK bool) ([]byte, error) {
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+	if useJWK || c.kid == "" {
+		protected["jwk"] = jwk(&c.Key.PublicKey)
+	} else {
+		protected["kid"] = c.kid
+	}
+	protectedBytes, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	protected64 := b64(protectedBytes)
+	payload64 := b64(payload)
+	digest := sha256.Sum256([]byte(protected64 + "." + payload64))
+	r, s, err := ecdsa.Sign(rand.Reader, c.Key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	copyPadded(sig[:32], r)
+	copyPadded(sig[32:], s)
+	return json.Marshal(map[string]string{
+		"protected": protected64,
+		"payload":   payload64,
+		"signature": b64(sig),
+	})
+}
+
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+func jwk(pub *ecdsa.PublicKey) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	copyPadded(x, pub.X)
+	copyPadded(y, pub.Y)
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(x),
+		"y":   b64(y),
+	}
+}
+
+// JWKThumbprint computes RFC 7638 thumbprint of the public key
+func JWKThumbprint(pub *ecdsa.PublicKey) string {
+	k := jwk(pub)
+	// members in lexicographic order without whitespace
+	s := fmt.Sprintf(`{"crv":%q,"kty":%q,"x":%q,"y":%q}`, k["crv"], k["kty"], k["x"], k["y"])
+	d := sha256.Sum256([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(d[:])
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	p := &Problem{}
+	if err := json.Unmarshal(body, p); err != nil || p.Type == "" {
+		return fmt.Errorf("acme: %s %s: %s", resp.Request.URL, resp.Status, body)
+	}
+	p.httpStatus = resp.StatusCode
+	return p
+}
+
+// NewCSR generates a certificate signing request in DER form for the
+// domains.  The first domain is used as common name
+func NewCSR(key crypto.Signer, domains []string) ([]byte, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domain for csr")
+	}
+	tmpl := &x509.CertificateRequest{
+		DNSNames: domains,
+	}
+	tmpl.Subject.CommonName = domains[0]
+	return x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+}
+
+// LoadOrGenerateKey loads ECDSA P-256 key from file, or generates one and
+// saves it to the file if it does not exist yet
+func LoadOrGenerateKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		p, _ := pem.Decode(data)
+		if p == nil {
+			return nil, fmt.Errorf("%s: no pem data", path)
+		}
+		return x509.ParseECPrivateKey(p.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
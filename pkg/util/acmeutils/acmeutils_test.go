@@ -0,0 +1,263 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmeutils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAcmeServer implements just enough of RFC 8555 to drive Client
+// through a complete http-01 issuance
+type fakeAcmeServer struct {
+	t       *testing.T
+	srv     *httptest.Server
+	mu      sync.Mutex
+	nonce   int
+	key     *ecdsa.PublicKey
+	valid   bool
+	csr     *x509.CertificateRequest
+	caKey   *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newFakeAcmeServer(t *testing.T) *fakeAcmeServer {
+	s := &fakeAcmeServer{t: t}
+	s.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeAcmeServer) url(p string) string {
+	return s.srv.URL + p
+}
+
+func (s *fakeAcmeServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonce++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.nonce))
+	if r.URL.Path == "/dir" {
+		json.NewEncoder(w).Encode(Directory{
+			NewNonce:   s.url("/nonce"),
+			NewAccount: s.url("/account"),
+			NewOrder:   s.url("/order"),
+		})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		return
+	}
+	payload, err := s.verify(r)
+	if err != nil {
+		s.t.Errorf("%s: %s", r.URL.Path, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	order := Order{
+		Status:         STATUS_PENDING,
+		Authorizations: []string{s.url("/authz")},
+		Finalize:       s.url("/finalize"),
+	}
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", s.url("/account/1"))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"valid"}`))
+	case "/order":
+		w.Header().Set("Location", s.url("/order/1"))
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(order)
+	case "/order/1":
+		order.Status = STATUS_VALID
+		order.Certificate = s.url("/cert")
+		json.NewEncoder(w).Encode(order)
+	case "/authz":
+		authz := Authorization{
+			Status:     STATUS_PENDING,
+			Identifier: Identifier{Type: IDENTIFIER_DNS, Value: "example.com"},
+			Challenges: []Challenge{
+				{Type: "dns-01", URL: s.url("/chal/dns"), Token: "tok-dns", Status: STATUS_PENDING},
+				{Type: CHALLENGE_HTTP_01, URL: s.url("/chal/http"), Token: "tok-http", Status: STATUS_PENDING},
+			},
+		}
+		if s.valid {
+			authz.Status = STATUS_VALID
+		}
+		json.NewEncoder(w).Encode(authz)
+	case "/chal/http":
+		s.valid = true
+		json.NewEncoder(w).Encode(Challenge{Type: CHALLENGE_HTTP_01, Status: STATUS_PROCESSING})
+	case "/finalize":
+		req := map[string]string{}
+		json.Unmarshal(payload, &req)
+		der, _ := base64.RawURLEncoding.DecodeString(req["csr"])
+		s.csr, err = x509.ParseCertificateRequest(der)
+		if err != nil {
+			s.t.Errorf("parse csr: %s", err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: s.csr.Subject.CommonName},
+			DNSNames:     s.csr.DNSNames,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		certDER, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, s.csr.PublicKey, s.caKey)
+		s.certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+		order.Status = STATUS_PROCESSING
+		json.NewEncoder(w).Encode(order)
+	case "/cert":
+		w.Write(s.certPEM)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// verify checks JWS signature of the request and returns the payload
+func (s *fakeAcmeServer) verify(r *http.Request) ([]byte, error) {
+	body, _ := ioutil.ReadAll(r.Body)
+	jws := map[string]string{}
+	if err := json.Unmarshal(body, &jws); err != nil {
+		return nil, err
+	}
+	protectedBytes, _ := base64.RawURLEncoding.DecodeString(jws["protected"])
+	protected := struct {
+		Alg   string
+		Nonce string
+		Url   string
+		Kid   string
+		Jwk   map[string]string
+	}{}
+	if err := json.Unmarshal(protectedBytes, &protected); err != nil {
+		return nil, err
+	}
+	if protected.Url != s.url(r.URL.Path) {
+		return nil, fmt.Errorf("url mismatch: %s", protected.Url)
+	}
+	if protected.Jwk != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.Jwk["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.Jwk["y"])
+		s.key = &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+	} else if protected.Kid != s.url("/account/1") {
+		return nil, fmt.Errorf("unexpected kid %q", protected.Kid)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(jws["signature"])
+	if len(sig) != 64 {
+		return nil, fmt.Errorf("bad signature length %d", len(sig))
+	}
+	digest := sha256.Sum256([]byte(jws["protected"] + "." + jws["payload"]))
+	if !ecdsa.Verify(s.key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, fmt.Errorf("bad signature")
+	}
+	return base64.RawURLEncoding.DecodeString(jws["payload"])
+}
+
+func TestClient(t *testing.T) {
+	s := newFakeAcmeServer(t)
+	defer s.srv.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c := NewClient(s.url("/dir"), key, nil)
+	c.PollInterval = time.Millisecond
+	ctx := context.Background()
+
+	if err := c.Register(ctx, "admin@example.com"); err != nil {
+		t.Fatalf("register: %s", err)
+	}
+	order, err := c.NewOrder(ctx, []string{"example.com", "www.example.com"})
+	if err != nil {
+		t.Fatalf("new order: %s", err)
+	}
+	authz, err := c.GetAuthorization(ctx, order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("get authz: %s", err)
+	}
+	chal := authz.Challenge(CHALLENGE_HTTP_01)
+	if chal == nil || chal.Token != "tok-http" {
+		t.Fatalf("http-01 challenge not found: %#v", authz.Challenges)
+	}
+	keyAuth := c.HTTP01KeyAuthorization(chal.Token)
+	if want := "tok-http." + JWKThumbprint(&key.PublicKey); keyAuth != want {
+		t.Errorf("key authorization: want %s, got %s", want, keyAuth)
+	}
+	if err := c.Accept(ctx, chal); err != nil {
+		t.Fatalf("accept: %s", err)
+	}
+	if _, err := c.WaitAuthorization(ctx, authz.URL); err != nil {
+		t.Fatalf("wait authz: %s", err)
+	}
+
+	certKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	csr, err := NewCSR(certKey, []string{"example.com", "www.example.com"})
+	if err != nil {
+		t.Fatalf("csr: %s", err)
+	}
+	order, err = c.Finalize(ctx, order, csr)
+	if err != nil {
+		t.Fatalf("finalize: %s", err)
+	}
+	certPEM, err := c.FetchCertificate(ctx, order.Certificate)
+	if err != nil {
+		t.Fatalf("fetch cert: %s", err)
+	}
+	p, _ := pem.Decode(certPEM)
+	if p == nil {
+		t.Fatalf("bad cert pem: %s", certPEM)
+	}
+	cert, err := x509.ParseCertificate(p.Bytes)
+	if err != nil {
+		t.Fatalf("parse cert: %s", err)
+	}
+	if cert.Subject.CommonName != "example.com" || len(cert.DNSNames) != 2 {
+		t.Errorf("unexpected cert subject %s, names %v", cert.Subject.CommonName, cert.DNSNames)
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	x, _ := base64.RawURLEncoding.DecodeString("f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU")
+	y, _ := base64.RawURLEncoding.DecodeString("x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0")
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	// sha256 of {"crv":"P-256","kty":"EC","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}
+	d := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"}`))
+	want := base64.RawURLEncoding.EncodeToString(d[:])
+	if got := JWKThumbprint(pub); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aliyun
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	billing_api "yunion.io/x/onecloud/pkg/apis/billing"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+type SDBInstance struct {
+	region *SRegion
+
+	DBInstanceId          string
+	DBInstanceDescription string
+	DBInstanceStatus      string
+	DBInstanceType        string
+	DBInstanceClass       string
+	DBInstanceCPU         string
+	DBInstanceMemory      int
+	DBInstanceStorage     int
+	DBInstanceStorageType string
+	DBInstanceNetType     string
+	InstanceNetworkType   string
+	Category              string
+	Engine                string
+	EngineVersion         string
+	PayType               string
+	ZoneId                string
+	VpcId                 string
+	VSwitchId             string
+	ConnectionString      string
+	Port                  string
+	MaintainTime          string
+	CreateTime            time.Time
+	ExpireTime            time.Time
+}
+
+func (rds *SDBInstance) GetName() string {
+	if len(rds.DBInstanceDescription) > 0 {
+		return rds.DBInstanceDescription
+	}
+	return rds.DBInstanceId
+}
+
+func (rds *SDBInstance) GetId() string {
+	return rds.DBInstanceId
+}
+
+func (rds *SDBInstance) GetGlobalId() string {
+	return rds.DBInstanceId
+}
+
+func (rds *SDBInstance) GetStatus() string {
+	switch rds.DBInstanceStatus {
+	case "Creating", "Restoring", "Importing", "ImportingFromOthers":
+		return api.DBINSTANCE_STATUS_DEPLOYING
+	case "Running":
+		return api.DBINSTANCE_STATUS_RUNNING
+	case "Rebooting":
+		return api.DBINSTANCE_STATUS_REBOOTING
+	case "DBInstanceClassChanging", "DBInstanceNetTypeChanging", "EngineVersionUpgrading", "TransingToOthers":
+		return api.DBINSTANCE_STATUS_CHANGE_CONFIG
+	case "Deleting":
+		return api.DBINSTANCE_STATUS_DELETING
+	case "Stopping":
+		return api.DBINSTANCE_STATUS_STOPPING
+	case "Stopped":
+		return api.DBINSTANCE_STATUS_READY
+	case "Starting":
+		return api.DBINSTANCE_STATUS_STARTING
+	default:
+		return api.DBINSTANCE_STATUS_UNKNOWN
+	}
+}
+
+func (rds *SDBInstance) GetMetadata() *jsonutils.JSONDict {
+	return nil
+}
+
+func (rds *SDBInstance) IsEmulated() bool {
+	return false
+}
+
+func (rds *SDBInstance) GetProjectId() string {
+	return ""
+}
+
+func (rds *SDBInstance) Refresh() error {
+	instance, err := rds.region.GetDBInstanceDetail(rds.DBInstanceId)
+	if err != nil {
+		return err
+	}
+	return jsonutils.Update(rds, instance)
+}
+
+func (rds *SDBInstance) GetBillingType() string {
+	if rds.PayType == "Prepaid" {
+		return billing_api.BILLING_TYPE_PREPAID
+	}
+	return billing_api.BILLING_TYPE_POSTPAID
+}
+
+func (rds *SDBInstance) GetCreatedAt() time.Time {
+	return rds.CreateTime
+}
+
+func (rds *SDBInstance) GetExpiredAt() time.Time {
+	return convertExpiredAt(rds.ExpireTime)
+}
+
+func (rds *SDBInstance) GetIRegion() cloudprovider.ICloudRegion {
+	return rds.region
+}
+
+func (rds *SDBInstance) GetEngine() string {
+	return rds.Engine
+}
+
+func (rds *SDBInstance) GetEngineVersion() string {
+	return rds.EngineVersion
+}
+
+func (rds *SDBInstance) GetInstanceType() string {
+	return rds.DBInstanceClass
+}
+
+func (rds *SDBInstance) GetCategory() string {
+	return rds.Category
+}
+
+// fetchAttribute fill cpu, port and connection info which is absent in the
+// result of DescribeDBInstances
+func (rds *SDBInstance) fetchAttribute() {
+	if len(rds.DBInstanceCPU) > 0 {
+		return
+	}
+	if err := rds.Refresh(); err != nil {
+		log.Errorf("failed to fetch attribute of dbinstance %s: %v", rds.DBInstanceId, err)
+	}
+}
+
+func (rds *SDBInstance) GetVcpuCount() int {
+	rds.fetchAttribute()
+	cpu, _ := strconv.Atoi(rds.DBInstanceCPU)
+	return cpu
+}
+
+func (rds *SDBInstance) GetVmemSizeMB() int {
+	rds.fetchAttribute()
+	return rds.DBInstanceMemory
+}
+
+func (rds *SDBInstance) GetDiskSizeGB() int {
+	rds.fetchAttribute()
+	return rds.DBInstanceStorage
+}
+
+func (rds *SDBInstance) GetStorageType() string {
+	rds.fetchAttribute()
+	return rds.DBInstanceStorageType
+}
+
+func (rds *SDBInstance) GetPort() int {
+	rds.fetchAttribute()
+	port, _ := strconv.Atoi(rds.Port)
+	return port
+}
+
+func (rds *SDBInstance) GetMaintainTime() string {
+	rds.fetchAttribute()
+	return rds.MaintainTime
+}
+
+func (rds *SDBInstance) getNetInfos() ([]SDBInstanceNetInfo, error) {
+	params := map[string]string{}
+	params["RegionId"] = rds.region.RegionId
+	params["DBInstanceId"] = rds.DBInstanceId
+	body, err := rds.region.rdsRequest("DescribeDBInstanceNetInfo", params)
+	if err != nil {
+		return nil, err
+	}
+	netInfos := []SDBInstanceNetInfo{}
+	return netInfos, body.Unmarshal(&netInfos, "DBInstanceNetInfos", "DBInstanceNetInfo")
+}
+
+func (rds *SDBInstance) getConnectionStr(ipType string) string {
+	netInfos, err := rds.getNetInfos()
+	if err != nil {
+		log.Errorf("failed to get net info of dbinstance %s: %v", rds.DBInstanceId, err)
+		return ""
+	}
+	for _, netInfo := range netInfos {
+		if netInfo.IPType == ipType {
+			return netInfo.ConnectionString
+		}
+	}
+	return ""
+}
+
+func (rds *SDBInstance) GetConnectionStr() string {
+	return rds.getConnectionStr("Public")
+}
+
+func (rds *SDBInstance) GetInternalConnectionStr() string {
+	for _, ipType := range []string{"Private", "Inner"} {
+		if str := rds.getConnectionStr(ipType); len(str) > 0 {
+			return str
+		}
+	}
+	rds.fetchAttribute()
+	return rds.ConnectionString
+}
+
+func (rds *SDBInstance) GetIZoneId() string {
+	// multi zone instance has zone id like cn-hangzhou-MAZ5(b,c)
+	zone, err := rds.region.getZoneById(rds.ZoneId)
+	if err != nil {
+		log.Errorf("failed to find zone %s for dbinstance %s: %v", rds.ZoneId, rds.DBInstanceId, err)
+		return ""
+	}
+	return zone.GetGlobalId()
+}
+
+func (rds *SDBInstance) GetIVpcId() string {
+	return rds.VpcId
+}
+
+func (rds *SDBInstance) GetDBNetwork() (*cloudprovider.SDBInstanceNetwork, error) {
+	if len(rds.VSwitchId) == 0 {
+		return nil, nil
+	}
+	netInfos, err := rds.getNetInfos()
+	if err != nil {
+		return nil, err
+	}
+	for _, netInfo := range netInfos {
+		if netInfo.IPType == "Private" && netInfo.VSwitchId == rds.VSwitchId {
+			return &cloudprovider.SDBInstanceNetwork{IP: netInfo.IPAddress, NetworkId: rds.VSwitchId}, nil
+		}
+	}
+	return &cloudprovider.SDBInstanceNetwork{NetworkId: rds.VSwitchId}, nil
+}
+
+func (rds *SDBInstance) GetIDBInstanceAccounts() ([]cloudprovider.ICloudDBInstanceAccount, error) {
+	params := map[string]string{}
+	params["RegionId"] = rds.region.RegionId
+	params["DBInstanceId"] = rds.DBInstanceId
+	body, err := rds.region.rdsRequest("DescribeAccounts", params)
+	if err != nil {
+		return nil, err
+	}
+	accounts := []SDBInstanceAccount{}
+	if err := body.Unmarshal(&accounts, "Accounts", "DBInstanceAccount"); err != nil {
+		return nil, err
+	}
+	ret := []cloudprovider.ICloudDBInstanceAccount{}
+	for i := 0; i < len(accounts); i++ {
+		ret = append(ret, &accounts[i])
+	}
+	return ret, nil
+}
+
+func (rds *SDBInstance) GetIDBInstanceDatabases() ([]cloudprovider.ICloudDBInstanceDatabase, error) {
+	params := map[string]string{}
+	params["RegionId"] = rds.region.RegionId
+	params["DBInstanceId"] = rds.DBInstanceId
+	body, err := rds.region.rdsRequest("DescribeDatabases", params)
+	if err != nil {
+		return nil, err
+	}
+	databases := []SDBInstanceDatabase{}
+	if err := body.Unmarshal(&databases, "Databases", "Database"); err != nil {
+		return nil, err
+	}
+	ret := []cloudprovider.ICloudDBInstanceDatabase{}
+	for i := 0; i < len(databases); i++ {
+		ret = append(ret, &databases[i])
+	}
+	return ret, nil
+}
+
+// GetIDBInstanceBackups list backups of the recent week, the default
+// retention period of aliyun rds
+func (rds *SDBInstance) GetIDBInstanceBackups() ([]cloudprovider.ICloudDBInstanceBackup, error) {
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+	backups := []SDBInstanceBackup{}
+	for {
+		params := map[string]string{}
+		params["RegionId"] = rds.region.RegionId
+		params["DBInstanceId"] = rds.DBInstanceId
+		params["StartTime"] = start.Format("2006-01-02T15:04Z")
+		params["EndTime"] = end.Format("2006-01-02T15:04Z")
+		params["PageSize"] = "100"
+		params["PageNumber"] = fmt.Sprintf("%d", len(backups)/100+1)
+		body, err := rds.region.rdsRequest("DescribeBackups", params)
+		if err != nil {
+			return nil, err
+		}
+		parts := []SDBInstanceBackup{}
+		if err := body.Unmarshal(&parts, "Items", "Backup"); err != nil {
+			return nil, err
+		}
+		backups = append(backups, parts...)
+		total, _ := body.Int("TotalRecordCount")
+		if len(parts) == 0 || int64(len(backups)) >= total {
+			break
+		}
+	}
+	ret := []cloudprovider.ICloudDBInstanceBackup{}
+	for i := 0; i < len(backups); i++ {
+		ret = append(ret, &backups[i])
+	}
+	return ret, nil
+}
+
+func (rds *SDBInstance) simpleAction(action string) error {
+	params := map[string]string{}
+	params["RegionId"] = rds.region.RegionId
+	params["DBInstanceId"] = rds.DBInstanceId
+	_, err := rds.region.rdsRequest(action, params)
+	return err
+}
+
+func (rds *SDBInstance) Start() error {
+	return rds.simpleAction("StartDBInstance")
+}
+
+func (rds *SDBInstance) Stop() error {
+	return rds.simpleAction("StopDBInstance")
+}
+
+func (rds *SDBInstance) Reboot() error {
+	return rds.simpleAction("RestartDBInstance")
+}
+
+func (rds *SDBInstance) Delete() error {
+	return rds.simpleAction("DeleteDBInstance")
+}
+
+func (rds *SDBInstance) ChangeConfig(ctx context.Context, config *cloudprovider.SDBInstanceChangeConfig) error {
+	params := map[string]string{}
+	params["RegionId"] = rds.region.RegionId
+	params["DBInstanceId"] = rds.DBInstanceId
+	params["PayType"] = rds.PayType
+	if len(config.InstanceType) > 0 {
+		params["DBInstanceClass"] = config.InstanceType
+	}
+	if config.DiskSizeGB > 0 {
+		params["DBInstanceStorage"] = fmt.Sprintf("%d", config.DiskSizeGB)
+	}
+	if len(config.StorageType) > 0 {
+		params["DBInstanceStorageType"] = config.StorageType
+	}
+	if len(params) == 3 {
+		return fmt.Errorf("aliyun dbinstance only support change instance type, disk size or storage type")
+	}
+	_, err := rds.region.rdsRequest("ModifyDBInstanceSpec", params)
+	return err
+}
+
+type SDBInstanceNetInfo struct {
+	ConnectionString string
+	IPAddress        string
+	IPType           string
+	Port             string
+	VpcId            string
+	VSwitchId        string
+}
+
+type SDatabasePrivilege struct {
+	DBName           string
+	AccountPrivilege string
+}
+
+type SDBInstanceAccount struct {
+	AccountName        string
+	AccountStatus      string
+	AccountDescription string
+	DatabasePrivileges struct {
+		DatabasePrivilege []SDatabasePrivilege
+	}
+}
+
+func (account *SDBInstanceAccount) GetName() string {
+	return account.AccountName
+}
+
+func (account *SDBInstanceAccount) GetStatus() string {
+	return strings.ToLower(account.AccountStatus)
+}
+
+func (account *SDBInstanceAccount) GetDescription() string {
+	return account.AccountDescription
+}
+
+func (account *SDBInstanceAccount) GetPrivileges() map[string]string {
+	privileges := map[string]string{}
+	for _, privilege := range account.DatabasePrivileges.DatabasePrivilege {
+		privileges[privilege.DBName] = privilege.AccountPrivilege
+	}
+	return privileges
+}
+
+type SDBInstanceDatabase struct {
+	DBName           string
+	DBStatus         string
+	DBDescription    string
+	CharacterSetName string
+}
+
+func (database *SDBInstanceDatabase) GetName() string {
+	return database.DBName
+}
+
+func (database *SDBInstanceDatabase) GetStatus() string {
+	return strings.ToLower(database.DBStatus)
+}
+
+func (database *SDBInstanceDatabase) GetCharacterSet() string {
+	return database.CharacterSetName
+}
+
+func (database *SDBInstanceDatabase) GetDescription() string {
+	return database.DBDescription
+}
+
+type SDBInstanceBackup struct {
+	BackupId        string
+	BackupStatus    string
+	BackupMode      string
+	BackupSize      int64
+	BackupDBNames   string
+	BackupStartTime time.Time
+	BackupEndTime   time.Time
+}
+
+func (backup *SDBInstanceBackup) GetGlobalId() string {
+	return backup.BackupId
+}
+
+func (backup *SDBInstanceBackup) GetStatus() string {
+	return strings.ToLower(backup.BackupStatus)
+}
+
+func (backup *SDBInstanceBackup) GetBackupMode() string {
+	return strings.ToLower(backup.BackupMode)
+}
+
+func (backup *SDBInstanceBackup) GetBackupSizeMb() int {
+	return int(backup.BackupSize / 1024 / 1024)
+}
+
+func (backup *SDBInstanceBackup) GetDatabases() []string {
+	if len(backup.BackupDBNames) == 0 {
+		return []string{}
+	}
+	return strings.Split(backup.BackupDBNames, ",")
+}
+
+func (backup *SDBInstanceBackup) GetStartTime() time.Time {
+	return backup.BackupStartTime
+}
+
+func (backup *SDBInstanceBackup) GetEndTime() time.Time {
+	return backup.BackupEndTime
+}
+
+func (region *SRegion) GetDBInstances(offset int, limit int) ([]SDBInstance, int, error) {
+	if limit > 100 || limit <= 0 {
+		limit = 100
+	}
+	params := map[string]string{}
+	params["RegionId"] = region.RegionId
+	params["PageSize"] = fmt.Sprintf("%d", limit)
+	params["PageNumber"] = fmt.Sprintf("%d", (offset/limit)+1)
+	body, err := region.rdsRequest("DescribeDBInstances", params)
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := []SDBInstance{}
+	if err := body.Unmarshal(&instances, "Items", "DBInstance"); err != nil {
+		return nil, 0, err
+	}
+	total, _ := body.Int("TotalRecordCount")
+	for i := 0; i < len(instances); i++ {
+		instances[i].region = region
+	}
+	return instances, int(total), nil
+}
+
+func (region *SRegion) GetDBInstanceDetail(instanceId string) (*SDBInstance, error) {
+	params := map[string]string{}
+	params["RegionId"] = region.RegionId
+	params["DBInstanceId"] = instanceId
+	body, err := region.rdsRequest("DescribeDBInstanceAttribute", params)
+	if err != nil {
+		if strings.Contains(err.Error(), "InvalidDBInstanceId.NotFound") {
+			return nil, cloudprovider.ErrNotFound
+		}
+		return nil, err
+	}
+	instances := []SDBInstance{}
+	if err := body.Unmarshal(&instances, "Items", "DBInstanceAttribute"); err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, cloudprovider.ErrNotFound
+	}
+	instances[0].region = region
+	return &instances[0], nil
+}
+
+func (region *SRegion) GetIDBInstances() ([]cloudprovider.ICloudDBInstance, error) {
+	instances, total, err := region.GetDBInstances(0, 100)
+	if err != nil {
+		return nil, err
+	}
+	for len(instances) < total {
+		var parts []SDBInstance
+		parts, total, err = region.GetDBInstances(len(instances), 100)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			break
+		}
+		instances = append(instances, parts...)
+	}
+	ret := []cloudprovider.ICloudDBInstance{}
+	for i := 0; i < len(instances); i++ {
+		ret = append(ret, &instances[i])
+	}
+	return ret, nil
+}
+
+func (region *SRegion) GetIDBInstanceById(instanceId string) (cloudprovider.ICloudDBInstance, error) {
+	return region.GetDBInstanceDetail(instanceId)
+}
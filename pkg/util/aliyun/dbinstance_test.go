@@ -0,0 +1,93 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package aliyun
+
+import (
+	"testing"
+
+	billing_api "yunion.io/x/onecloud/pkg/apis/billing"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestDBInstanceStatus(t *testing.T) {
+	cases := []struct {
+		status string
+		want   string
+	}{
+		{"Creating", api.DBINSTANCE_STATUS_DEPLOYING},
+		{"Restoring", api.DBINSTANCE_STATUS_DEPLOYING},
+		{"Running", api.DBINSTANCE_STATUS_RUNNING},
+		{"Rebooting", api.DBINSTANCE_STATUS_REBOOTING},
+		{"DBInstanceClassChanging", api.DBINSTANCE_STATUS_CHANGE_CONFIG},
+		{"Deleting", api.DBINSTANCE_STATUS_DELETING},
+		{"Stopping", api.DBINSTANCE_STATUS_STOPPING},
+		{"Stopped", api.DBINSTANCE_STATUS_READY},
+		{"Starting", api.DBINSTANCE_STATUS_STARTING},
+		{"Locked", api.DBINSTANCE_STATUS_UNKNOWN},
+	}
+	for _, c := range cases {
+		rds := &SDBInstance{DBInstanceStatus: c.status}
+		if got := rds.GetStatus(); got != c.want {
+			t.Errorf("status %s: want %s got %s", c.status, c.want, got)
+		}
+	}
+}
+
+func TestDBInstanceBillingType(t *testing.T) {
+	cases := []struct {
+		payType string
+		want    string
+	}{
+		{"Prepaid", billing_api.BILLING_TYPE_PREPAID},
+		{"Postpaid", billing_api.BILLING_TYPE_POSTPAID},
+	}
+	for _, c := range cases {
+		rds := &SDBInstance{PayType: c.payType}
+		if got := rds.GetBillingType(); got != c.want {
+			t.Errorf("pay type %s: want %s got %s", c.payType, c.want, got)
+		}
+	}
+}
+
+func TestDBInstanceAccountPrivileges(t *testing.T) {
+	account := SDBInstanceAccount{AccountName: "app", AccountStatus: "Available"}
+	account.DatabasePrivileges.DatabasePrivilege = []SDatabasePrivilege{
+		{DBName: "orders", AccountPrivilege: "ReadWrite"},
+		{DBName: "report", AccountPrivilege: "ReadOnly"},
+	}
+	if got := account.GetStatus(); got != "available" {
+		t.Errorf("invalid account status %s", got)
+	}
+	privileges := account.GetPrivileges()
+	if len(privileges) != 2 || privileges["orders"] != "ReadWrite" || privileges["report"] != "ReadOnly" {
+		t.Errorf("invalid privileges %v", privileges)
+	}
+}
+
+func TestDBInstanceBackupDatabases(t *testing.T) {
+	cases := []struct {
+		names string
+		want  int
+	}{
+		{"", 0},
+		{"orders", 1},
+		{"orders,report", 2},
+	}
+	for _, c := range cases {
+		backup := &SDBInstanceBackup{BackupDBNames: c.names}
+		if got := backup.GetDatabases(); len(got) != c.want {
+			t.Errorf("databases %q: want %d got %v", c.names, c.want, got)
+		}
+	}
+}
@@ -118,6 +118,14 @@ func (self *SRegion) vpcRequest(action string, params map[string]string) (jsonut
 	return jsonRequest(client, "vpc.aliyuncs.com", ALIYUN_API_VERSION_VPC, action, params, self.Debug)
 }
 
+func (self *SRegion) rdsRequest(action string, params map[string]string) (jsonutils.JSONObject, error) {
+	client, err := self.getSdkClient()
+	if err != nil {
+		return nil, err
+	}
+	return jsonRequest(client, "rds.aliyuncs.com", ALIYUN_API_VERSION_RDS, action, params, self.Debug)
+}
+
 type LBRegion struct {
 	RegionEndpoint string
 	RegionId       string
@@ -910,6 +918,22 @@ func (region *SRegion) CreateILoadBalancerAcl(acl *cloudprovider.SLoadbalancerAc
 	return iAcl, region.AddAccessControlListEntry(aclId, acl.Entrys)
 }
 
+func (region *SRegion) GetIBuckets() ([]cloudprovider.ICloudBucket, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
+func (region *SRegion) GetIBucketById(name string) (cloudprovider.ICloudBucket, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
+func (region *SRegion) CreateIBucket(name string, storageClassStr string, acl string) error {
+	return cloudprovider.ErrNotImplemented
+}
+
+func (region *SRegion) DeleteIBucket(name string) error {
+	return cloudprovider.ErrNotImplemented
+}
+
 func (region *SRegion) GetSkus(zoneId string) ([]cloudprovider.ICloudSku, error) {
 	return nil, cloudprovider.ErrNotImplemented
 }
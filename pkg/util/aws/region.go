@@ -30,6 +30,7 @@ import (
 	api "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudprovider"
 	"yunion.io/x/onecloud/pkg/multicloud"
+	"yunion.io/x/onecloud/pkg/util/objectstore"
 )
 
 var RegionLocations = map[string]string{
@@ -517,6 +518,54 @@ func (region *SRegion) CreateILoadBalancerAcl(acl *cloudprovider.SLoadbalancerAc
 	return nil, cloudprovider.ErrNotImplemented
 }
 
+func (region *SRegion) getBucketStore() (*objectstore.SBucketStore, error) {
+	client, err := region.GetS3Client()
+	if err != nil {
+		return nil, err
+	}
+	return objectstore.NewBucketStore(region, client, region.RegionId), nil
+}
+
+func (region *SRegion) GetIBuckets() ([]cloudprovider.ICloudBucket, error) {
+	store, err := region.getBucketStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetIBuckets()
+}
+
+func (region *SRegion) GetIBucketById(name string) (cloudprovider.ICloudBucket, error) {
+	store, err := region.getBucketStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetIBucketById(name)
+}
+
+func (region *SRegion) CreateIBucket(name string, storageClassStr string, acl string) error {
+	store, err := region.getBucketStore()
+	if err != nil {
+		return err
+	}
+	return store.CreateIBucket(name, storageClassStr, acl)
+}
+
+func (region *SRegion) DeleteIBucket(name string) error {
+	store, err := region.getBucketStore()
+	if err != nil {
+		return err
+	}
+	return store.DeleteIBucket(name)
+}
+
+func (region *SRegion) GetIDBInstances() ([]cloudprovider.ICloudDBInstance, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
+func (region *SRegion) GetIDBInstanceById(instanceId string) (cloudprovider.ICloudDBInstance, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
 func (region *SRegion) GetSkus(zoneId string) ([]cloudprovider.ICloudSku, error) {
 	return nil, cloudprovider.ErrNotImplemented
 }
@@ -511,6 +511,7 @@ type CGroupCPUSetTask struct {
 	*CGroupTask
 
 	cpuset string
+	mems   string
 }
 
 const (
@@ -523,6 +524,9 @@ func (c *CGroupCPUSetTask) Module() string {
 }
 
 func (c *CGroupCPUSetTask) GetStaticConfig() map[string]string {
+	if len(c.mems) > 0 {
+		return map[string]string{CPUSET_MEMS: c.mems}
+	}
 	return map[string]string{CPUSET_MEMS: GetRootParam(c.Module(), CPUSET_MEMS, "")}
 }
 
@@ -539,6 +543,17 @@ func NewCGroupCPUSetTask(pid string, coreNum int, cpuset string) CGroupCPUSetTas
 	return task
 }
 
+// NewCGroupCPUSetMemsTask bind both cpus and memory nodes of process
+func NewCGroupCPUSetMemsTask(pid string, coreNum int, cpuset string, mems string) CGroupCPUSetTask {
+	task := CGroupCPUSetTask{
+		CGroupTask: NewCGroupTask(pid, coreNum),
+		cpuset:     cpuset,
+		mems:       mems,
+	}
+	task.SetHand(&task)
+	return task
+}
+
 func Init() bool {
 	for _, hand := range []ICGroupTask{&CGroupTask{}, &CGroupCPUTask{}, &CGroupIOTask{}} {
 		if !hand.init() {
@@ -576,7 +591,7 @@ func CgroupDestroy(pid string) bool {
 		&CGroupCPUTask{&CGroupTask{}},
 		&CGroupIOTask{&CGroupTask{}},
 		&CGroupMemoryTask{&CGroupTask{}},
-		&CGroupCPUSetTask{&CGroupTask{}, ""},
+		&CGroupCPUSetTask{CGroupTask: &CGroupTask{}},
 		&CGroupIOHardlimitTask{CGroupIOTask: &CGroupIOTask{&CGroupTask{}}},
 	}
 	for _, hand := range tasks {
@@ -18,12 +18,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/fernet/fernet-go"
 
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"github.com/pkg/errors"
 	"yunion.io/x/onecloud/pkg/util/fileutils2"
@@ -88,6 +90,20 @@ func (m *SFernetKeyManager) Decrypt(tok []byte, ttl time.Duration) []byte {
 	return fernet.VerifyAndDecrypt(tok, ttl, m.keys)
 }
 
+// Timestamp returns when a token was encrypted, which is trustworthy only
+// after the token has been verified by Decrypt
+func Timestamp(tok []byte) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(tok), "="))
+	if err != nil {
+		return time.Time{}, errors.WithMessage(err, "base64 decode")
+	}
+	// version byte 0x80 followed by a 64-bit big-endian unix timestamp
+	if len(raw) < 9 || raw[0] != 0x80 {
+		return time.Time{}, errors.New("malformed fernet token")
+	}
+	return time.Unix(int64(binary.BigEndian.Uint64(raw[1:9])), 0), nil
+}
+
 func (m *SFernetKeyManager) InitKeys(path string, cnt int) error {
 	m.keys = make([]*fernet.Key, cnt)
 	for i := 0; i < cnt; i += 1 {
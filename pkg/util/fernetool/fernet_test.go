@@ -47,3 +47,27 @@ func TestFernetKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestTimestamp(t *testing.T) {
+	m := SFernetKeyManager{}
+	err := m.InitKeys("", 1)
+	if err != nil {
+		t.Fatalf("fail to initkeys %s", err)
+	}
+	now := time.Now()
+	tok, err := m.Encrypt([]byte("message"))
+	if err != nil {
+		t.Fatalf("fail to encrypt %s", err)
+	}
+	ts, err := Timestamp(tok)
+	if err != nil {
+		t.Fatalf("fail to get timestamp %s", err)
+	}
+	if ts.Unix() < now.Unix() || ts.Unix() > now.Unix()+1 {
+		t.Errorf("timestamp %s, want %s", ts, now)
+	}
+	_, err = Timestamp([]byte("not a token"))
+	if err == nil {
+		t.Errorf("malformed token should fail")
+	}
+}
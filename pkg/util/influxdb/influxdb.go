@@ -42,14 +42,23 @@ func NewInfluxdb(accessUrl string) *SInfluxdb {
 	return &inst
 }
 
-type dbResult struct {
+type SSeries struct {
 	Name    string
+	Tags    map[string]string
 	Columns []string
 	Values  [][]jsonutils.JSONObject
 }
 
-func (db *SInfluxdb) query(sql string) ([][]dbResult, error) {
+// Query execute a read only statement, return series of each statement
+func (db *SInfluxdb) Query(sql string) ([][]SSeries, error) {
+	return db.query(sql)
+}
+
+func (db *SInfluxdb) query(sql string) ([][]SSeries, error) {
 	nurl := fmt.Sprintf("%s/query?q=%s", db.accessUrl, url.QueryEscape(sql))
+	if len(db.dbName) > 0 {
+		nurl = fmt.Sprintf("%s&db=%s", nurl, url.QueryEscape(db.dbName))
+	}
 	_, body, err := httputils.JSONRequest(db.client, context.Background(), "POST", nurl, nil, nil, false)
 	if err != nil {
 		return nil, err
@@ -59,11 +68,11 @@ func (db *SInfluxdb) query(sql string) ([][]dbResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	rets := make([][]dbResult, len(results))
+	rets := make([][]SSeries, len(results))
 	for i := range results {
 		series, err := results[i].Get("series")
 		if err == nil {
-			ret := make([]dbResult, 0)
+			ret := make([]SSeries, 0)
 			err = series.Unmarshal(&ret)
 			if err != nil {
 				return nil, err
@@ -153,6 +153,11 @@ const (
 
 	ACT_HOST_IMPORT_LIBVIRT_SERVERS = "libvirt托管虚拟机导入"
 	ACT_GUEST_CREATE_FROM_IMPORT    = "导入虚拟机创建"
+
+	ACT_CERT_RENEW = "续期证书"
+
+	ACT_TRAFFIC_SHIFT          = "流量切换"
+	ACT_TRAFFIC_SHIFT_ROLLBACK = "流量切换回滚"
 )
 
 // golang 不支持 const 的string array, http://t.cn/EzAvbw8
@@ -0,0 +1,262 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nbd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// A minimal client of the fixed newstyle nbd protocol, only simple
+// replies are used, which is enough for reading from qemu built-in nbd
+// server and writing to qemu-nbd.
+// https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md
+
+const (
+	NBD_MAGIC       = 0x4e42444d41474943
+	NBD_OPTS_MAGIC  = 0x49484156454F5054
+	NBD_REQ_MAGIC   = 0x25609513
+	NBD_REPLY_MAGIC = 0x67446698
+
+	NBD_FLAG_FIXED_NEWSTYLE = 1 << 0
+	NBD_FLAG_NO_ZEROES      = 1 << 1
+
+	NBD_FLAG_READ_ONLY = 1 << 1
+
+	NBD_OPT_EXPORT_NAME = 1
+
+	NBD_CMD_READ  = 0
+	NBD_CMD_WRITE = 1
+	NBD_CMD_DISC  = 2
+	NBD_CMD_FLUSH = 3
+
+	// qemu nbd server refuse requests larger than 32M
+	NBD_MAX_REQUEST_SIZE = 32 * 1024 * 1024
+)
+
+type Client struct {
+	conn    net.Conn
+	mutex   *sync.Mutex
+	handle  uint64
+	timeout time.Duration
+
+	size  int64
+	flags uint16
+}
+
+// Connect to nbd server and negotiate the export, network is tcp or unix
+func Connect(network, address, exportName string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	cli := &Client{
+		conn:    conn,
+		mutex:   &sync.Mutex{},
+		timeout: timeout,
+	}
+	if err := cli.handshake(exportName); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cli, nil
+}
+
+func (cli *Client) setDeadline() {
+	if cli.timeout > 0 {
+		cli.conn.SetDeadline(time.Now().Add(cli.timeout))
+	}
+}
+
+func (cli *Client) handshake(exportName string) error {
+	cli.setDeadline()
+	var greeting struct {
+		Magic     uint64
+		OptsMagic uint64
+		Flags     uint16
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &greeting); err != nil {
+		return fmt.Errorf("read greeting: %s", err)
+	}
+	if greeting.Magic != NBD_MAGIC || greeting.OptsMagic != NBD_OPTS_MAGIC {
+		return fmt.Errorf("server is not fixed newstyle nbd")
+	}
+	var clientFlags uint32 = NBD_FLAG_FIXED_NEWSTYLE
+	noZeroes := greeting.Flags&NBD_FLAG_NO_ZEROES > 0
+	if noZeroes {
+		clientFlags |= NBD_FLAG_NO_ZEROES
+	}
+	if err := binary.Write(cli.conn, binary.BigEndian, clientFlags); err != nil {
+		return err
+	}
+
+	opt := struct {
+		Magic  uint64
+		Option uint32
+		Length uint32
+	}{NBD_OPTS_MAGIC, NBD_OPT_EXPORT_NAME, uint32(len(exportName))}
+	if err := binary.Write(cli.conn, binary.BigEndian, opt); err != nil {
+		return err
+	}
+	if _, err := cli.conn.Write([]byte(exportName)); err != nil {
+		return err
+	}
+
+	var export struct {
+		Size  uint64
+		Flags uint16
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &export); err != nil {
+		return fmt.Errorf("export %q not available: %s", exportName, err)
+	}
+	if !noZeroes {
+		if _, err := io.ReadFull(cli.conn, make([]byte, 124)); err != nil {
+			return err
+		}
+	}
+	cli.size = int64(export.Size)
+	cli.flags = export.Flags
+	cli.conn.SetDeadline(time.Time{})
+	return nil
+}
+
+func (cli *Client) Size() int64 {
+	return cli.size
+}
+
+func (cli *Client) IsReadOnly() bool {
+	return cli.flags&NBD_FLAG_READ_ONLY > 0
+}
+
+func (cli *Client) request(cmd uint16, offset int64, length int, data []byte, ret []byte) error {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+
+	cli.handle += 1
+	req := struct {
+		Magic  uint32
+		Flags  uint16
+		Type   uint16
+		Handle uint64
+		Offset uint64
+		Length uint32
+	}{NBD_REQ_MAGIC, 0, cmd, cli.handle, uint64(offset), uint32(length)}
+	cli.setDeadline()
+	if err := binary.Write(cli.conn, binary.BigEndian, req); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if _, err := cli.conn.Write(data); err != nil {
+			return err
+		}
+	}
+	if cmd == NBD_CMD_DISC {
+		return nil
+	}
+
+	var reply struct {
+		Magic  uint32
+		Error  uint32
+		Handle uint64
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &reply); err != nil {
+		return err
+	}
+	if reply.Magic != NBD_REPLY_MAGIC {
+		return fmt.Errorf("invalid reply magic %x", reply.Magic)
+	}
+	if reply.Handle != cli.handle {
+		return fmt.Errorf("reply handle %d mismatch request %d", reply.Handle, cli.handle)
+	}
+	if reply.Error != 0 {
+		return fmt.Errorf("nbd request error %d", reply.Error)
+	}
+	if ret != nil {
+		if _, err := io.ReadFull(cli.conn, ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cli *Client) checkRange(offset int64, length int) error {
+	if offset < 0 || offset+int64(length) > cli.size {
+		return fmt.Errorf("range %d+%d out of export size %d", offset, length, cli.size)
+	}
+	if length > NBD_MAX_REQUEST_SIZE {
+		return fmt.Errorf("request size %d exceed %d", length, NBD_MAX_REQUEST_SIZE)
+	}
+	return nil
+}
+
+func (cli *Client) ReadAt(buf []byte, offset int64) (int, error) {
+	if err := cli.checkRange(offset, len(buf)); err != nil {
+		return 0, err
+	}
+	if err := cli.request(NBD_CMD_READ, offset, len(buf), nil, buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (cli *Client) WriteAt(buf []byte, offset int64) (int, error) {
+	if cli.IsReadOnly() {
+		return 0, fmt.Errorf("export is read only")
+	}
+	if err := cli.checkRange(offset, len(buf)); err != nil {
+		return 0, err
+	}
+	if err := cli.request(NBD_CMD_WRITE, offset, len(buf), buf, nil); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (cli *Client) Flush() error {
+	return cli.request(NBD_CMD_FLUSH, 0, 0, nil, nil)
+}
+
+// Close send disconnect request and close the connection
+func (cli *Client) Close() error {
+	cli.request(NBD_CMD_DISC, 0, 0, nil, nil)
+	return cli.conn.Close()
+}
+
+// CopyRange copy length bytes at offset from src to dst in chunks
+func CopyRange(dst, src *Client, offset, length int64, chunkSize int) error {
+	if chunkSize <= 0 || chunkSize > NBD_MAX_REQUEST_SIZE {
+		chunkSize = NBD_MAX_REQUEST_SIZE
+	}
+	buf := make([]byte, chunkSize)
+	for length > 0 {
+		size := int64(chunkSize)
+		if size > length {
+			size = length
+		}
+		if _, err := src.ReadAt(buf[:size], offset); err != nil {
+			return fmt.Errorf("read %d+%d: %s", offset, size, err)
+		}
+		if _, err := dst.WriteAt(buf[:size], offset); err != nil {
+			return fmt.Errorf("write %d+%d: %s", offset, size, err)
+		}
+		offset += size
+		length -= size
+	}
+	return nil
+}
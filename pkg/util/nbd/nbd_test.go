@@ -0,0 +1,134 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nbd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveMemory serve a single export backed by data on the listener
+func serveMemory(t *testing.T, l net.Listener, data []byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	binary.Write(conn, binary.BigEndian, struct {
+		Magic     uint64
+		OptsMagic uint64
+		Flags     uint16
+	}{NBD_MAGIC, NBD_OPTS_MAGIC, NBD_FLAG_FIXED_NEWSTYLE | NBD_FLAG_NO_ZEROES})
+	var clientFlags uint32
+	binary.Read(conn, binary.BigEndian, &clientFlags)
+	var opt struct {
+		Magic  uint64
+		Option uint32
+		Length uint32
+	}
+	binary.Read(conn, binary.BigEndian, &opt)
+	io.ReadFull(conn, make([]byte, opt.Length))
+	binary.Write(conn, binary.BigEndian, struct {
+		Size  uint64
+		Flags uint16
+	}{uint64(len(data)), 0})
+
+	for {
+		var req struct {
+			Magic  uint32
+			Flags  uint16
+			Type   uint16
+			Handle uint64
+			Offset uint64
+			Length uint32
+		}
+		if err := binary.Read(conn, binary.BigEndian, &req); err != nil {
+			return
+		}
+		if req.Magic != NBD_REQ_MAGIC {
+			t.Errorf("invalid request magic %x", req.Magic)
+			return
+		}
+		reply := struct {
+			Magic  uint32
+			Error  uint32
+			Handle uint64
+		}{NBD_REPLY_MAGIC, 0, req.Handle}
+		switch req.Type {
+		case NBD_CMD_READ:
+			binary.Write(conn, binary.BigEndian, reply)
+			conn.Write(data[req.Offset : req.Offset+uint64(req.Length)])
+		case NBD_CMD_WRITE:
+			io.ReadFull(conn, data[req.Offset:req.Offset+uint64(req.Length)])
+			binary.Write(conn, binary.BigEndian, reply)
+		case NBD_CMD_FLUSH:
+			binary.Write(conn, binary.BigEndian, reply)
+		case NBD_CMD_DISC:
+			return
+		}
+	}
+}
+
+func listenMemory(t *testing.T, data []byte) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		serveMemory(t, l, data)
+	}()
+	return l.Addr().String()
+}
+
+func TestCopyRange(t *testing.T) {
+	src := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	dst := make([]byte, len(src))
+
+	srcCli, err := Connect("tcp", listenMemory(t, src), "drive_0", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srcCli.Close()
+	dstCli, err := Connect("tcp", listenMemory(t, dst), "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcCli.Size() != int64(len(src)) {
+		t.Fatalf("size %d != %d", srcCli.Size(), len(src))
+	}
+
+	if err := CopyRange(dstCli, srcCli, 100, 500, 64); err != nil {
+		t.Fatal(err)
+	}
+	if err := dstCli.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	dstCli.Close()
+
+	if !bytes.Equal(dst[100:600], src[100:600]) {
+		t.Errorf("copied range mismatch")
+	}
+	if dst[99] != 0 || dst[600] != 0 {
+		t.Errorf("data copied out of range")
+	}
+	if _, err := srcCli.ReadAt(make([]byte, 16), int64(len(src))-8); err == nil {
+		t.Errorf("expect out of range error")
+	}
+}
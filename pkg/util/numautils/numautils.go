@@ -0,0 +1,207 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package numautils
+
+import (
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
+)
+
+const (
+	NODE_UNKNOWN = -1
+)
+
+// SRequest is the resource a guest bound to a single NUMA node asks for.
+// A dedicated guest exclusively occupy pCPUs and is backed by hugepages,
+// while a shared guest only shares cpus of the node with overcommit.
+type SRequest struct {
+	CpuCount  int
+	MemSizeMb int
+	Dedicated bool
+}
+
+// SGuestUsage is the request of a guest already placed on host, NodeId is
+// NODE_UNKNOWN if the guest has not been started yet
+type SGuestUsage struct {
+	SRequest
+	NodeId int
+}
+
+type SNode struct {
+	NodeId            int
+	CpuCount          int
+	MemSizeMb         int
+	HugepageMemSizeMb int
+
+	DedicatedCpuCount int
+	DedicatedMemMb    int
+	SharedCpuCount    int
+	SharedMemMb       int
+}
+
+func NewNodes(topology []*types.SNumaNode) []*SNode {
+	nodes := make([]*SNode, 0, len(topology))
+	for _, t := range topology {
+		nodes = append(nodes, &SNode{
+			NodeId:            t.NodeId,
+			CpuCount:          len(t.Cpus),
+			MemSizeMb:         t.MemSizeMb,
+			HugepageMemSizeMb: t.GetHugepageMemSizeMb(),
+		})
+	}
+	return nodes
+}
+
+// FreeCpuCount of shared guests is overcommitted by cpuCmtbound, a non
+// positive cpuCmtbound means cpu of shared guests is not limited
+func (n *SNode) FreeCpuCount(dedicated bool, cpuCmtbound float32) int {
+	if dedicated {
+		return n.CpuCount - n.DedicatedCpuCount
+	}
+	if cpuCmtbound <= 0 {
+		return n.CpuCount - n.DedicatedCpuCount
+	}
+	return int(float32(n.CpuCount-n.DedicatedCpuCount)*cpuCmtbound) - n.SharedCpuCount
+}
+
+// FreeMemMb of dedicated guests come from hugepages, the others from the
+// rest memory of node
+func (n *SNode) FreeMemMb(dedicated bool) int {
+	if dedicated {
+		return n.HugepageMemSizeMb - n.DedicatedMemMb
+	}
+	return n.MemSizeMb - n.HugepageMemSizeMb - n.SharedMemMb
+}
+
+func (n *SNode) Fit(req SRequest, cpuCmtbound float32) bool {
+	if !req.Dedicated && cpuCmtbound <= 0 {
+		// cpu not limited, but the guest must not be larger than node
+		if req.CpuCount > n.CpuCount-n.DedicatedCpuCount {
+			return false
+		}
+	} else if n.FreeCpuCount(req.Dedicated, cpuCmtbound) < req.CpuCount {
+		return false
+	}
+	return n.FreeMemMb(req.Dedicated) >= req.MemSizeMb
+}
+
+// FitCount return how many guests of req could be placed into this node
+func (n *SNode) FitCount(req SRequest, cpuCmtbound float32) int {
+	if !n.Fit(req, cpuCmtbound) {
+		return 0
+	}
+	count := -1
+	if req.Dedicated || cpuCmtbound > 0 {
+		if req.CpuCount > 0 {
+			count = n.FreeCpuCount(req.Dedicated, cpuCmtbound) / req.CpuCount
+		}
+	}
+	if req.MemSizeMb > 0 {
+		memCount := n.FreeMemMb(req.Dedicated) / req.MemSizeMb
+		if count < 0 || memCount < count {
+			count = memCount
+		}
+	}
+	if count < 0 {
+		// request nothing
+		count = 1
+	}
+	return count
+}
+
+func (n *SNode) Add(req SRequest) {
+	if req.Dedicated {
+		n.DedicatedCpuCount += req.CpuCount
+		n.DedicatedMemMb += req.MemSizeMb
+	} else {
+		n.SharedCpuCount += req.CpuCount
+		n.SharedMemMb += req.MemSizeMb
+	}
+}
+
+// LeftRatio is the fraction of resource left on node if req is placed
+func (n *SNode) LeftRatio(req SRequest) float64 {
+	ratio := 0.0
+	// cpus of shared guests are overcommitted, only memory matters
+	if req.Dedicated && n.CpuCount > 0 {
+		ratio += float64(n.FreeCpuCount(true, 0)-req.CpuCount) / float64(n.CpuCount)
+	}
+	memTotal := n.MemSizeMb - n.HugepageMemSizeMb
+	if req.Dedicated {
+		memTotal = n.HugepageMemSizeMb
+	}
+	if memTotal > 0 {
+		ratio += float64(n.FreeMemMb(req.Dedicated)-req.MemSizeMb) / float64(memTotal)
+	}
+	return ratio
+}
+
+// BestFit return the node fitting req with least resource left, which keeps
+// large free blocks for later large guests. nil is returned if no node fit.
+func BestFit(nodes []*SNode, req SRequest, cpuCmtbound float32) *SNode {
+	var (
+		best      *SNode
+		bestRatio float64
+	)
+	for _, n := range nodes {
+		if !n.Fit(req, cpuCmtbound) {
+			continue
+		}
+		ratio := n.LeftRatio(req)
+		if best == nil || ratio < bestRatio {
+			best = n
+			bestRatio = ratio
+		}
+	}
+	return best
+}
+
+// FitCount return how many guests of req could be placed into nodes
+func FitCount(nodes []*SNode, req SRequest, cpuCmtbound float32) int {
+	count := 0
+	for _, n := range nodes {
+		count += n.FitCount(req, cpuCmtbound)
+	}
+	return count
+}
+
+func GetNode(nodes []*SNode, nodeId int) *SNode {
+	for _, n := range nodes {
+		if n.NodeId == nodeId {
+			return n
+		}
+	}
+	return nil
+}
+
+// PlaceGuests account guests to nodes, guests with known node are counted
+// first, then the others are placed with BestFit, the same way host does
+// when they are started. Guests could not be placed are ignored.
+func PlaceGuests(nodes []*SNode, guests []SGuestUsage, cpuCmtbound float32) {
+	pending := make([]SGuestUsage, 0)
+	for _, g := range guests {
+		if g.NodeId == NODE_UNKNOWN {
+			pending = append(pending, g)
+			continue
+		}
+		if n := GetNode(nodes, g.NodeId); n != nil {
+			n.Add(g.SRequest)
+		}
+	}
+	for _, g := range pending {
+		if n := BestFit(nodes, g.SRequest, cpuCmtbound); n != nil {
+			n.Add(g.SRequest)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package numautils
+
+import (
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
+)
+
+func newTestNodes() []*SNode {
+	return NewNodes([]*types.SNumaNode{
+		{NodeId: 0, Cpus: []int{0, 1, 2, 3, 4, 5, 6, 7}, MemSizeMb: 32768, HugepageSizeKb: 2048, HugepagesTotal: 8192},
+		{NodeId: 1, Cpus: []int{8, 9, 10, 11, 12, 13, 14, 15}, MemSizeMb: 32768, HugepageSizeKb: 2048, HugepagesTotal: 8192},
+	})
+}
+
+func TestNodeFit(t *testing.T) {
+	nodes := newTestNodes()
+	n := nodes[0]
+	if n.HugepageMemSizeMb != 16384 {
+		t.Fatalf("unexpected hugepage memory %d", n.HugepageMemSizeMb)
+	}
+	dedicated := SRequest{CpuCount: 4, MemSizeMb: 8192, Dedicated: true}
+	if got := n.FitCount(dedicated, 4); got != 2 {
+		t.Errorf("expect 2 dedicated guests fit, got %d", got)
+	}
+	if n.Fit(SRequest{CpuCount: 9, MemSizeMb: 1024, Dedicated: true}, 4) {
+		t.Errorf("guest larger than node should not fit")
+	}
+	if n.Fit(SRequest{CpuCount: 2, MemSizeMb: 16385, Dedicated: true}, 4) {
+		t.Errorf("guest larger than hugepages should not fit")
+	}
+
+	n.Add(dedicated)
+	shared := SRequest{CpuCount: 8, MemSizeMb: 4096}
+	// 4 cpus left for shared guests, overcommitted by 4
+	if got := n.FitCount(shared, 4); got != 2 {
+		t.Errorf("expect 2 shared guests fit, got %d", got)
+	}
+	if n.Fit(shared, 0) {
+		t.Errorf("shared guest larger than unpinned cpus should not fit")
+	}
+	if !n.Fit(SRequest{CpuCount: 4, MemSizeMb: 16384}, 0) {
+		t.Errorf("shared guest should fit when cpu not limited")
+	}
+}
+
+func TestBestFitAndPlace(t *testing.T) {
+	nodes := newTestNodes()
+	PlaceGuests(nodes, []SGuestUsage{
+		{SRequest: SRequest{CpuCount: 4, MemSizeMb: 8192, Dedicated: true}, NodeId: 1},
+		{SRequest: SRequest{CpuCount: 2, MemSizeMb: 4096, Dedicated: true}, NodeId: NODE_UNKNOWN},
+		{SRequest: SRequest{CpuCount: 2, MemSizeMb: 1024}, NodeId: 3},
+	}, 4)
+	// unknown guest goes to node 1 which is the fullest
+	if nodes[1].DedicatedCpuCount != 6 || nodes[1].DedicatedMemMb != 12288 {
+		t.Errorf("unexpected node1 %#v", nodes[1])
+	}
+	if nodes[0].DedicatedCpuCount != 0 || nodes[0].SharedCpuCount != 0 {
+		t.Errorf("unexpected node0 %#v", nodes[0])
+	}
+
+	req := SRequest{CpuCount: 4, MemSizeMb: 4096, Dedicated: true}
+	if n := BestFit(nodes, req, 4); n == nil || n.NodeId != 0 {
+		t.Errorf("expect node 0 best fit, got %#v", n)
+	}
+	req = SRequest{CpuCount: 2, MemSizeMb: 4096, Dedicated: true}
+	if n := BestFit(nodes, req, 4); n == nil || n.NodeId != 1 {
+		t.Errorf("expect node 1 best fit, got %#v", n)
+	}
+	if got := FitCount(nodes, req, 4); got != 5 {
+		t.Errorf("expect 5 guests fit, got %d", got)
+	}
+	if n := BestFit(nodes, SRequest{CpuCount: 10, MemSizeMb: 1024, Dedicated: true}, 4); n != nil {
+		t.Errorf("expect no node fit, got %#v", n)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+const (
+	GRANTEE_ALL_USERS           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	GRANTEE_AUTHENTICATED_USERS = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+
+	DEFAULT_STORAGE_CLASS = "STANDARD"
+)
+
+type SBucket struct {
+	store *SBucketStore
+
+	Name      string
+	CreatedAt time.Time
+	Location  string
+}
+
+func (b *SBucket) GetId() string {
+	return b.Name
+}
+
+func (b *SBucket) GetName() string {
+	return b.Name
+}
+
+// bucket name is unique across the whole object store
+func (b *SBucket) GetGlobalId() string {
+	return b.Name
+}
+
+func (b *SBucket) GetStatus() string {
+	return api.BUCKET_STATUS_READY
+}
+
+func (b *SBucket) Refresh() error {
+	_, err := b.store.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(b.Name)})
+	if isNotFound(err) {
+		return cloudprovider.ErrNotFound
+	}
+	return err
+}
+
+func (b *SBucket) IsEmulated() bool {
+	return false
+}
+
+func (b *SBucket) GetMetadata() *jsonutils.JSONDict {
+	return nil
+}
+
+func (b *SBucket) GetProjectId() string {
+	return ""
+}
+
+func (b *SBucket) GetIRegion() cloudprovider.ICloudRegion {
+	return b.store.region
+}
+
+func (b *SBucket) GetCreateAt() time.Time {
+	return b.CreatedAt
+}
+
+func (b *SBucket) GetStorageClass() string {
+	return DEFAULT_STORAGE_CLASS
+}
+
+func (b *SBucket) GetLocation() string {
+	return b.Location
+}
+
+func aclFromGrants(grants []*s3.Grant) cloudprovider.TBucketACLType {
+	allRead, allWrite, authRead := false, false, false
+	for _, grant := range grants {
+		if grant.Grantee == nil || aws.StringValue(grant.Grantee.Type) != s3.TypeGroup {
+			continue
+		}
+		perm := aws.StringValue(grant.Permission)
+		switch aws.StringValue(grant.Grantee.URI) {
+		case GRANTEE_ALL_USERS:
+			switch perm {
+			case s3.PermissionRead:
+				allRead = true
+			case s3.PermissionWrite:
+				allWrite = true
+			case s3.PermissionFullControl:
+				allRead, allWrite = true, true
+			}
+		case GRANTEE_AUTHENTICATED_USERS:
+			if perm == s3.PermissionRead || perm == s3.PermissionFullControl {
+				authRead = true
+			}
+		}
+	}
+	switch {
+	case allRead && allWrite:
+		return cloudprovider.ACLPublicReadWrite
+	case allRead:
+		return cloudprovider.ACLPublicRead
+	case authRead:
+		return cloudprovider.ACLAuthRead
+	default:
+		return cloudprovider.ACLPrivate
+	}
+}
+
+func (b *SBucket) GetAcl() cloudprovider.TBucketACLType {
+	resp, err := b.store.client.GetBucketAcl(&s3.GetBucketAclInput{Bucket: aws.String(b.Name)})
+	if err != nil {
+		log.Errorf("get acl of bucket %s fail %s", b.Name, err)
+		return cloudprovider.ACLUnknown
+	}
+	return aclFromGrants(resp.Grants)
+}
+
+func (b *SBucket) SetAcl(acl cloudprovider.TBucketACLType) error {
+	_, err := b.store.client.PutBucketAcl(&s3.PutBucketAclInput{
+		Bucket: aws.String(b.Name),
+		ACL:    aws.String(string(acl)),
+	})
+	return err
+}
+
+// GetStats sum up size of objects in bucket, counting stops at
+// cloudprovider.BUCKET_STATS_MAX_KEY objects to bound the cost
+func (b *SBucket) GetStats() cloudprovider.SBucketStats {
+	stats := cloudprovider.SBucketStats{}
+	input := &s3.ListObjectsInput{Bucket: aws.String(b.Name)}
+	err := b.store.client.ListObjectsPages(input, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			stats.SizeBytes += aws.Int64Value(obj.Size)
+			stats.ObjectCount += 1
+		}
+		return stats.ObjectCount < cloudprovider.BUCKET_STATS_MAX_KEY
+	})
+	if err != nil {
+		log.Errorf("list objects of bucket %s fail %s", b.Name, err)
+	}
+	return stats
+}
+
+func (b *SBucket) GetAccessUrls() []cloudprovider.SBucketAccessUrl {
+	endpoint, err := url.Parse(b.store.client.Endpoint)
+	if err != nil {
+		log.Errorf("invalid endpoint %s: %s", b.store.client.Endpoint, err)
+		return nil
+	}
+	ret := []cloudprovider.SBucketAccessUrl{
+		{
+			Url:         fmt.Sprintf("%s://%s/%s", endpoint.Scheme, endpoint.Host, b.Name),
+			Description: "path style",
+		},
+	}
+	if !aws.BoolValue(b.store.client.Config.S3ForcePathStyle) {
+		ret = append(ret, cloudprovider.SBucketAccessUrl{
+			Url:         fmt.Sprintf("%s://%s.%s", endpoint.Scheme, b.Name, endpoint.Host),
+			Description: "virtual host style",
+		})
+	}
+	return ret
+}
+
+func (b *SBucket) ListObjects(prefix string, marker string, delimiter string, maxCount int) (cloudprovider.SListObjectResult, error) {
+	result := cloudprovider.SListObjectResult{}
+	if maxCount <= 0 {
+		maxCount = cloudprovider.DEFAULT_MAX_KEYS
+	}
+	input := &s3.ListObjectsInput{
+		Bucket:  aws.String(b.Name),
+		MaxKeys: aws.Int64(int64(maxCount)),
+	}
+	if len(prefix) > 0 {
+		input.Prefix = aws.String(prefix)
+	}
+	if len(marker) > 0 {
+		input.Marker = aws.String(marker)
+	}
+	if len(delimiter) > 0 {
+		input.Delimiter = aws.String(delimiter)
+	}
+	resp, err := b.store.client.ListObjects(input)
+	if err != nil {
+		return result, err
+	}
+	result.Objects = make([]cloudprovider.ICloudObject, 0, len(resp.Contents))
+	for _, obj := range resp.Contents {
+		result.Objects = append(result.Objects, &SObject{
+			bucket:       b,
+			Key:          aws.StringValue(obj.Key),
+			SizeBytes:    aws.Int64Value(obj.Size),
+			LastModified: aws.TimeValue(obj.LastModified),
+			StorageClass: aws.StringValue(obj.StorageClass),
+			ETag:         aws.StringValue(obj.ETag),
+		})
+	}
+	for _, p := range resp.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, aws.StringValue(p.Prefix))
+	}
+	result.IsTruncated = aws.BoolValue(resp.IsTruncated)
+	if result.IsTruncated {
+		// NextMarker is only returned when delimiter is specified
+		result.NextMarker = aws.StringValue(resp.NextMarker)
+		if len(result.NextMarker) == 0 && len(resp.Contents) > 0 {
+			result.NextMarker = aws.StringValue(resp.Contents[len(resp.Contents)-1].Key)
+		}
+	}
+	return result, nil
+}
+
+func (b *SBucket) PutObject(ctx context.Context, key string, body io.Reader, sizeBytes int64, contentType string, acl cloudprovider.TBucketACLType) error {
+	uploader := s3manager.NewUploaderWithClient(b.store.client)
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.Name),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if len(contentType) > 0 {
+		input.ContentType = aws.String(contentType)
+	}
+	if len(acl) > 0 {
+		input.ACL = aws.String(string(acl))
+	}
+	_, err := uploader.UploadWithContext(ctx, input)
+	return err
+}
+
+func (b *SBucket) DeleteObject(ctx context.Context, key string) error {
+	_, err := b.store.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.Name),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (b *SBucket) GetTempUrl(method string, key string, expire time.Duration) (string, error) {
+	var req *request.Request
+	switch method {
+	case http.MethodGet:
+		req, _ = b.store.client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(b.Name), Key: aws.String(key)})
+	case http.MethodPut:
+		req, _ = b.store.client.PutObjectRequest(&s3.PutObjectInput{Bucket: aws.String(b.Name), Key: aws.String(key)})
+	case http.MethodDelete:
+		req, _ = b.store.client.DeleteObjectRequest(&s3.DeleteObjectInput{Bucket: aws.String(b.Name), Key: aws.String(key)})
+	default:
+		return "", fmt.Errorf("unsupported method %s", method)
+	}
+	return req.Presign(expire)
+}
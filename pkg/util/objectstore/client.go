@@ -0,0 +1,161 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/multicloud"
+)
+
+const (
+	CLOUD_PROVIDER_S3 = api.CLOUD_PROVIDER_S3
+
+	// S3 compatible storage usually accept any region for signature
+	S3_DEFAULT_SIGNING_REGION = "us-east-1"
+	S3_DEFAULT_REGION         = "default"
+)
+
+// SObjectStoreClient is a S3 compatible object storage, e.g. MinIO or Ceph
+// RGW, exposed as a single region which only supports buckets
+type SObjectStoreClient struct {
+	cloudprovider.SFakeOnPremiseRegion
+	multicloud.SRegion
+
+	providerId   string
+	providerName string
+	endpoint     string
+	accessKey    string
+	secret       string
+
+	store *SBucketStore
+
+	debug bool
+}
+
+func NewObjectStoreClient(providerId string, providerName string, endpoint string, accessKey string, secret string, isDebug bool) (*SObjectStoreClient, error) {
+	cli := &SObjectStoreClient{
+		providerId:   providerId,
+		providerName: providerName,
+		endpoint:     endpoint,
+		accessKey:    accessKey,
+		secret:       secret,
+		debug:        isDebug,
+	}
+	client, err := cli.newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	cli.store = NewBucketStore(cli, client, "")
+	// validate endpoint and credential
+	_, err = client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	return cli, nil
+}
+
+func (cli *SObjectStoreClient) newS3Client() (*s3.S3, error) {
+	u, err := url.Parse(cli.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %s: %s", cli.endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid endpoint %s: scheme http or https required", cli.endpoint)
+	}
+	cfg := &aws.Config{
+		Endpoint:         aws.String(cli.endpoint),
+		Region:           aws.String(S3_DEFAULT_SIGNING_REGION),
+		Credentials:      credentials.NewStaticCredentials(cli.accessKey, cli.secret, ""),
+		S3ForcePathStyle: aws.Bool(true),
+		DisableSSL:       aws.Bool(u.Scheme == "http"),
+	}
+	if cli.debug {
+		cfg.LogLevel = aws.LogLevel(aws.LogDebugWithHTTPBody)
+	}
+	s, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(s), nil
+}
+
+func (cli *SObjectStoreClient) GetCloudRegionExternalIdPrefix() string {
+	return fmt.Sprintf("%s/%s", CLOUD_PROVIDER_S3, cli.providerId)
+}
+
+func (cli *SObjectStoreClient) GetSubAccounts() ([]cloudprovider.SSubAccount, error) {
+	subAccount := cloudprovider.SSubAccount{
+		Account:      cli.accessKey,
+		Name:         cli.providerName,
+		HealthStatus: api.CLOUD_PROVIDER_HEALTH_NORMAL,
+	}
+	return []cloudprovider.SSubAccount{subAccount}, nil
+}
+
+func (cli *SObjectStoreClient) GetIRegions() []cloudprovider.ICloudRegion {
+	return []cloudprovider.ICloudRegion{cli}
+}
+
+func (cli *SObjectStoreClient) GetIRegionById(id string) (cloudprovider.ICloudRegion, error) {
+	if id == cli.GetGlobalId() {
+		return cli, nil
+	}
+	return nil, cloudprovider.ErrNotFound
+}
+
+func (cli *SObjectStoreClient) GetId() string {
+	return S3_DEFAULT_REGION
+}
+
+func (cli *SObjectStoreClient) GetName() string {
+	return cli.providerName
+}
+
+func (cli *SObjectStoreClient) GetGlobalId() string {
+	return cli.GetCloudRegionExternalIdPrefix()
+}
+
+func (cli *SObjectStoreClient) IsEmulated() bool {
+	return false
+}
+
+func (cli *SObjectStoreClient) GetProvider() string {
+	return CLOUD_PROVIDER_S3
+}
+
+func (cli *SObjectStoreClient) GetIBuckets() ([]cloudprovider.ICloudBucket, error) {
+	return cli.store.GetIBuckets()
+}
+
+func (cli *SObjectStoreClient) GetIBucketById(name string) (cloudprovider.ICloudBucket, error) {
+	return cli.store.GetIBucketById(name)
+}
+
+func (cli *SObjectStoreClient) CreateIBucket(name string, storageClassStr string, acl string) error {
+	return cli.store.CreateIBucket(name, storageClassStr, acl)
+}
+
+func (cli *SObjectStoreClient) DeleteIBucket(name string) error {
+	return cli.store.DeleteIBucket(name)
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+func (cli *SObjectStoreClient) GetISnapshots() ([]cloudprovider.ICloudSnapshot, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetISnapshotById(snapshotId string) (cloudprovider.ICloudSnapshot, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIHosts() ([]cloudprovider.ICloudHost, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIHostById(id string) (cloudprovider.ICloudHost, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIStorages() ([]cloudprovider.ICloudStorage, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIStorageById(id string) (cloudprovider.ICloudStorage, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIStoragecaches() ([]cloudprovider.ICloudStoragecache, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
+
+func (cli *SObjectStoreClient) GetIStoragecacheById(id string) (cloudprovider.ICloudStoragecache, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+type SObject struct {
+	bucket *SBucket
+
+	Key          string
+	SizeBytes    int64
+	LastModified time.Time
+	StorageClass string
+	ETag         string
+	ContentType  string
+}
+
+func (o *SObject) GetIBucket() cloudprovider.ICloudBucket {
+	return o.bucket
+}
+
+func (o *SObject) GetKey() string {
+	return o.Key
+}
+
+func (o *SObject) GetSizeBytes() int64 {
+	return o.SizeBytes
+}
+
+func (o *SObject) GetLastModified() time.Time {
+	return o.LastModified
+}
+
+func (o *SObject) GetStorageClass() string {
+	return o.StorageClass
+}
+
+func (o *SObject) GetETag() string {
+	return o.ETag
+}
+
+// GetContentType fetch content type with a HEAD request on first call, as
+// listing objects does not return it
+func (o *SObject) GetContentType() string {
+	if len(o.ContentType) == 0 {
+		resp, err := o.bucket.store.client.HeadObject(&s3.HeadObjectInput{
+			Bucket: aws.String(o.bucket.Name),
+			Key:    aws.String(o.Key),
+		})
+		if err != nil {
+			log.Errorf("head object %s/%s fail %s", o.bucket.Name, o.Key, err)
+			return ""
+		}
+		o.ContentType = aws.StringValue(resp.ContentType)
+	}
+	return o.ContentType
+}
+
+func (o *SObject) GetAcl() cloudprovider.TBucketACLType {
+	resp, err := o.bucket.store.client.GetObjectAcl(&s3.GetObjectAclInput{
+		Bucket: aws.String(o.bucket.Name),
+		Key:    aws.String(o.Key),
+	})
+	if err != nil {
+		log.Errorf("get acl of object %s/%s fail %s", o.bucket.Name, o.Key, err)
+		return cloudprovider.ACLUnknown
+	}
+	return aclFromGrants(resp.Grants)
+}
+
+func (o *SObject) SetAcl(acl cloudprovider.TBucketACLType) error {
+	_, err := o.bucket.store.client.PutObjectAcl(&s3.PutObjectAclInput{
+		Bucket: aws.String(o.bucket.Name),
+		Key:    aws.String(o.Key),
+		ACL:    aws.String(string(acl)),
+	})
+	return err
+}
@@ -0,0 +1,260 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+// fakeS3 is a minimal in memory stand-in of a path style S3 service
+type fakeS3 struct {
+	lock    sync.Mutex
+	buckets map[string]map[string][]byte
+	acls    map[string]string
+
+	listBucketsCount int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		buckets: map[string]map[string][]byte{},
+		acls:    map[string]string{},
+	}
+}
+
+const fakeS3AllUsersReadGrant = `<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>`
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	parts := strings.SplitN(path, "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	_, hasAcl := r.URL.Query()["acl"]
+
+	if len(bucket) == 0 {
+		f.listBucketsCount++
+		fmt.Fprint(w, `<ListAllMyBucketsResult><Buckets>`)
+		for _, name := range f.sortedBuckets() {
+			fmt.Fprintf(w, `<Bucket><Name>%s</Name><CreationDate>2019-01-01T00:00:00.000Z</CreationDate></Bucket>`, name)
+		}
+		fmt.Fprint(w, `</Buckets></ListAllMyBucketsResult>`)
+		return
+	}
+	objects, exists := f.buckets[bucket]
+	if !exists && !(r.Method == http.MethodPut && len(key) == 0 && !hasAcl) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchBucket</Code></Error>`)
+		return
+	}
+	switch {
+	case hasAcl && r.Method == http.MethodPut:
+		f.acls[bucket] = r.Header.Get("x-amz-acl")
+	case hasAcl:
+		grants := ""
+		if f.acls[bucket] == string(cloudprovider.ACLPublicRead) {
+			grants = fakeS3AllUsersReadGrant
+		}
+		fmt.Fprintf(w, `<AccessControlPolicy><AccessControlList>%s</AccessControlList></AccessControlPolicy>`, grants)
+	case len(key) == 0 && r.Method == http.MethodPut:
+		f.buckets[bucket] = map[string][]byte{}
+	case len(key) == 0 && r.Method == http.MethodDelete:
+		if len(objects) > 0 {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `<Error><Code>BucketNotEmpty</Code></Error>`)
+			return
+		}
+		delete(f.buckets, bucket)
+		w.WriteHeader(http.StatusNoContent)
+	case len(key) == 0 && r.Method == http.MethodHead:
+	case len(key) == 0:
+		prefix := r.URL.Query().Get("prefix")
+		fmt.Fprintf(w, `<ListBucketResult><Name>%s</Name><IsTruncated>false</IsTruncated>`, bucket)
+		keys := make([]string, 0)
+		for k := range objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><ETag>"etag"</ETag><StorageClass>STANDARD</StorageClass><LastModified>2019-01-01T00:00:00.000Z</LastModified></Contents>`, k, len(objects[k]))
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	case r.Method == http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) getListBucketsCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.listBucketsCount
+}
+
+func (f *fakeS3) sortedBuckets() []string {
+	names := make([]string, 0, len(f.buckets))
+	for name := range f.buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestObjectStoreClient(t *testing.T) {
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cli, err := NewObjectStoreClient("provider-id", "minio", server.URL, "access", "secret", false)
+	if err != nil {
+		t.Fatalf("NewObjectStoreClient: %s", err)
+	}
+	if cli.GetGlobalId() != "S3/provider-id" {
+		t.Errorf("unexpected region global id %s", cli.GetGlobalId())
+	}
+
+	err = cli.CreateIBucket("bucket1", "", string(cloudprovider.ACLPrivate))
+	if err != nil {
+		t.Fatalf("CreateIBucket: %s", err)
+	}
+	buckets, err := cli.GetIBuckets()
+	if err != nil {
+		t.Fatalf("GetIBuckets: %s", err)
+	}
+	if len(buckets) != 1 || buckets[0].GetGlobalId() != "bucket1" {
+		t.Fatalf("unexpected buckets %#v", buckets)
+	}
+	listBucketsCount := fake.getListBucketsCount()
+	bucket, err := cli.GetIBucketById("bucket1")
+	if err != nil {
+		t.Fatalf("GetIBucketById: %s", err)
+	}
+	if _, err := cli.GetIBucketById("bucket2"); err != cloudprovider.ErrNotFound {
+		t.Errorf("GetIBucketById of absent bucket expect ErrNotFound, got %v", err)
+	}
+	if fake.getListBucketsCount() != listBucketsCount {
+		t.Errorf("GetIBucketById should not list buckets")
+	}
+
+	ctx := context.Background()
+	for _, key := range []string{"dir/a.txt", "dir/b.txt", "c.txt"} {
+		err = bucket.PutObject(ctx, key, strings.NewReader("hello"), 5, "text/plain", "")
+		if err != nil {
+			t.Fatalf("PutObject %s: %s", key, err)
+		}
+	}
+	result, err := bucket.ListObjects("dir/", "", "", 0)
+	if err != nil {
+		t.Fatalf("ListObjects: %s", err)
+	}
+	if len(result.Objects) != 2 || result.Objects[0].GetKey() != "dir/a.txt" || result.Objects[0].GetSizeBytes() != 5 {
+		t.Errorf("unexpected objects %#v", result.Objects)
+	}
+	stats := bucket.GetStats()
+	if stats.ObjectCount != 3 || stats.SizeBytes != 15 {
+		t.Errorf("unexpected stats %#v", stats)
+	}
+
+	if acl := bucket.GetAcl(); acl != cloudprovider.ACLPrivate {
+		t.Errorf("expect private acl, got %s", acl)
+	}
+	if err := bucket.SetAcl(cloudprovider.ACLPublicRead); err != nil {
+		t.Fatalf("SetAcl: %s", err)
+	}
+	if acl := bucket.GetAcl(); acl != cloudprovider.ACLPublicRead {
+		t.Errorf("expect public-read acl, got %s", acl)
+	}
+
+	tmpUrl, err := bucket.GetTempUrl(http.MethodGet, "c.txt", time.Hour)
+	if err != nil {
+		t.Fatalf("GetTempUrl: %s", err)
+	}
+	if !strings.HasPrefix(tmpUrl, server.URL+"/bucket1/c.txt?") || !strings.Contains(tmpUrl, "X-Amz-Signature=") {
+		t.Errorf("unexpected presigned url %s", tmpUrl)
+	}
+	if _, err := bucket.GetTempUrl("POST", "c.txt", time.Hour); err == nil {
+		t.Errorf("presign POST should fail")
+	}
+
+	if err := cli.DeleteIBucket("bucket1"); err == nil {
+		t.Errorf("delete non-empty bucket should fail")
+	}
+	for _, key := range []string{"dir/a.txt", "dir/b.txt", "c.txt"} {
+		if err := bucket.DeleteObject(ctx, key); err != nil {
+			t.Fatalf("DeleteObject %s: %s", key, err)
+		}
+	}
+	if err := cli.DeleteIBucket("bucket1"); err != nil {
+		t.Fatalf("DeleteIBucket: %s", err)
+	}
+	if err := bucket.Refresh(); err != cloudprovider.ErrNotFound {
+		t.Errorf("Refresh of deleted bucket expect ErrNotFound, got %v", err)
+	}
+}
+
+func TestAclFromGrants(t *testing.T) {
+	group := func(uri string, perm string) *s3.Grant {
+		return &s3.Grant{
+			Grantee:    &s3.Grantee{Type: aws.String(s3.TypeGroup), URI: aws.String(uri)},
+			Permission: aws.String(perm),
+		}
+	}
+	owner := &s3.Grant{
+		Grantee:    &s3.Grantee{Type: aws.String(s3.TypeCanonicalUser), ID: aws.String("owner")},
+		Permission: aws.String(s3.PermissionFullControl),
+	}
+	cases := []struct {
+		grants []*s3.Grant
+		want   cloudprovider.TBucketACLType
+	}{
+		{[]*s3.Grant{owner}, cloudprovider.ACLPrivate},
+		{[]*s3.Grant{owner, group(GRANTEE_AUTHENTICATED_USERS, s3.PermissionRead)}, cloudprovider.ACLAuthRead},
+		{[]*s3.Grant{owner, group(GRANTEE_ALL_USERS, s3.PermissionRead)}, cloudprovider.ACLPublicRead},
+		{[]*s3.Grant{owner, group(GRANTEE_ALL_USERS, s3.PermissionRead), group(GRANTEE_ALL_USERS, s3.PermissionWrite)}, cloudprovider.ACLPublicReadWrite},
+		{[]*s3.Grant{group(GRANTEE_ALL_USERS, s3.PermissionFullControl)}, cloudprovider.ACLPublicReadWrite},
+	}
+	for _, c := range cases {
+		if got := aclFromGrants(c.grants); got != c.want {
+			t.Errorf("aclFromGrants expect %s, got %s", c.want, got)
+		}
+	}
+}
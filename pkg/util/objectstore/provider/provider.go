@@ -0,0 +1,148 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/objectstore"
+)
+
+type SObjectStoreProviderFactory struct {
+}
+
+func (self *SObjectStoreProviderFactory) GetId() string {
+	return objectstore.CLOUD_PROVIDER_S3
+}
+
+func (self *SObjectStoreProviderFactory) GetName() string {
+	return objectstore.CLOUD_PROVIDER_S3
+}
+
+func (self *SObjectStoreProviderFactory) ValidateChangeBandwidth(instanceId string, bandwidth int64) error {
+	return nil
+}
+
+func (self *SObjectStoreProviderFactory) IsPublicCloud() bool {
+	return false
+}
+
+func (self *SObjectStoreProviderFactory) IsOnPremise() bool {
+	return false
+}
+
+func (self *SObjectStoreProviderFactory) IsSupportPrepaidResources() bool {
+	return false
+}
+
+// object storage has no zone, so syncing skus from cloud is a no-op, which
+// avoids syncing skus of the region from the public sku source
+func (self *SObjectStoreProviderFactory) NeedSyncSkuFromCloud() bool {
+	return true
+}
+
+func (self *SObjectStoreProviderFactory) ValidateCreateCloudaccountData(ctx context.Context, userCred mcclient.TokenCredential, data *jsonutils.JSONDict) error {
+	accessKeyId, _ := data.GetString("access_key_id")
+	if len(accessKeyId) == 0 {
+		return httperrors.NewMissingParameterError("access_key_id")
+	}
+	accessKeySecret, _ := data.GetString("access_key_secret")
+	if len(accessKeySecret) == 0 {
+		return httperrors.NewMissingParameterError("access_key_secret")
+	}
+	endpoint, _ := data.GetString("endpoint")
+	if len(endpoint) == 0 {
+		return httperrors.NewMissingParameterError("endpoint")
+	}
+	data.Set("account", jsonutils.NewString(accessKeyId))
+	data.Set("secret", jsonutils.NewString(accessKeySecret))
+	data.Set("access_url", jsonutils.NewString(endpoint))
+	return nil
+}
+
+func (self *SObjectStoreProviderFactory) ValidateUpdateCloudaccountCredential(ctx context.Context, userCred mcclient.TokenCredential, data jsonutils.JSONObject, cloudaccount string) (*cloudprovider.SCloudaccount, error) {
+	accessKeyId, _ := data.GetString("access_key_id")
+	if len(accessKeyId) == 0 {
+		accessKeyId = cloudaccount
+	}
+	accessKeySecret, _ := data.GetString("access_key_secret")
+	if len(accessKeySecret) == 0 {
+		return nil, httperrors.NewMissingParameterError("access_key_secret")
+	}
+	account := &cloudprovider.SCloudaccount{
+		Account: accessKeyId,
+		Secret:  accessKeySecret,
+	}
+	return account, nil
+}
+
+func (self *SObjectStoreProviderFactory) GetProvider(providerId, providerName, url, account, secret string) (cloudprovider.ICloudProvider, error) {
+	client, err := objectstore.NewObjectStoreClient(providerId, providerName, url, account, secret, false)
+	if err != nil {
+		return nil, err
+	}
+	return &SObjectStoreProvider{
+		SBaseProvider: cloudprovider.NewBaseProvider(self),
+		client:        client,
+	}, nil
+}
+
+func init() {
+	factory := SObjectStoreProviderFactory{}
+	cloudprovider.RegisterFactory(&factory)
+}
+
+type SObjectStoreProvider struct {
+	cloudprovider.SBaseProvider
+	client *objectstore.SObjectStoreClient
+}
+
+func (self *SObjectStoreProvider) GetVersion() string {
+	return ""
+}
+
+func (self *SObjectStoreProvider) GetSysInfo() (jsonutils.JSONObject, error) {
+	return jsonutils.NewDict(), nil
+}
+
+func (self *SObjectStoreProvider) GetSubAccounts() ([]cloudprovider.SSubAccount, error) {
+	return self.client.GetSubAccounts()
+}
+
+func (self *SObjectStoreProvider) GetIRegions() []cloudprovider.ICloudRegion {
+	return self.client.GetIRegions()
+}
+
+func (self *SObjectStoreProvider) GetIRegionById(extId string) (cloudprovider.ICloudRegion, error) {
+	return self.client.GetIRegionById(extId)
+}
+
+func (self *SObjectStoreProvider) GetBalance() (float64, string, error) {
+	return 0.0, api.CLOUD_PROVIDER_HEALTH_UNKNOWN, cloudprovider.ErrNotSupported
+}
+
+func (self *SObjectStoreProvider) GetCloudRegionExternalIdPrefix() string {
+	return self.client.GetCloudRegionExternalIdPrefix()
+}
+
+func (self *SObjectStoreProvider) GetIProjects() ([]cloudprovider.ICloudProject, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+// SBucketStore list and manage buckets of a region through a S3 client,
+// buckets located in other regions are skipped if location is given
+type SBucketStore struct {
+	region   cloudprovider.ICloudRegion
+	client   *s3.S3
+	location string
+}
+
+func NewBucketStore(region cloudprovider.ICloudRegion, client *s3.S3, location string) *SBucketStore {
+	return &SBucketStore{
+		region:   region,
+		client:   client,
+		location: location,
+	}
+}
+
+func (store *SBucketStore) GetClient() *s3.S3 {
+	return store.client
+}
+
+func (store *SBucketStore) getBucketLocation(name string) (string, error) {
+	resp, err := store.client.GetBucketLocation(&s3.GetBucketLocationInput{Bucket: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	return s3.NormalizeBucketLocation(aws.StringValue(resp.LocationConstraint)), nil
+}
+
+func (store *SBucketStore) GetIBuckets() ([]cloudprovider.ICloudBucket, error) {
+	resp, err := store.client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]cloudprovider.ICloudBucket, 0)
+	for _, b := range resp.Buckets {
+		bucket := &SBucket{
+			store:     store,
+			Name:      aws.StringValue(b.Name),
+			CreatedAt: aws.TimeValue(b.CreationDate),
+			Location:  store.location,
+		}
+		if len(store.location) > 0 {
+			location, err := store.getBucketLocation(bucket.Name)
+			if err != nil {
+				// a bucket left out would be taken as removed by sync
+				return nil, fmt.Errorf("get location of bucket %s fail %s", bucket.Name, err)
+			}
+			if location != store.location {
+				continue
+			}
+		}
+		ret = append(ret, bucket)
+	}
+	return ret, nil
+}
+
+// GetIBucketById looks up the named bucket alone, listing all buckets and
+// their locations costs a round trip for each bucket of the account
+func (store *SBucketStore) GetIBucketById(name string) (cloudprovider.ICloudBucket, error) {
+	_, err := store.client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(name)})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, cloudprovider.ErrNotFound
+		}
+		return nil, err
+	}
+	if len(store.location) > 0 {
+		location, err := store.getBucketLocation(name)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, cloudprovider.ErrNotFound
+			}
+			return nil, err
+		}
+		if location != store.location {
+			return nil, cloudprovider.ErrNotFound
+		}
+	}
+	return &SBucket{
+		store:    store,
+		Name:     name,
+		Location: store.location,
+	}, nil
+}
+
+// CreateIBucket create a bucket in location of store, storage class is set
+// per object by S3, so storageClassStr is ignored
+func (store *SBucketStore) CreateIBucket(name string, storageClassStr string, acl string) error {
+	input := &s3.CreateBucketInput{
+		Bucket: aws.String(name),
+	}
+	// us-east-1 is the default location and must not be specified
+	if len(store.location) > 0 && store.location != "us-east-1" {
+		input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{
+			LocationConstraint: aws.String(store.location),
+		}
+	}
+	if len(acl) > 0 {
+		input.ACL = aws.String(acl)
+	}
+	_, err := store.client.CreateBucket(input)
+	return err
+}
+
+func (store *SBucketStore) DeleteIBucket(name string) error {
+	_, err := store.client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(name)})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func isNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if aerr, ok := err.(awserr.RequestFailure); ok && aerr.StatusCode() == 404 {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
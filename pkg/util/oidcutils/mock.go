@@ -0,0 +1,180 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oidcutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// SMockProvider is an in-process OpenID provider for tests. Its authorization
+// endpoint logs in Claims without any interaction and redirects back with a
+// code at once.
+type SMockProvider struct {
+	Server *httptest.Server
+
+	ClientId     string
+	ClientSecret string
+	Claims       map[string]interface{}
+
+	key *rsa.PrivateKey
+	kid string
+
+	lock  sync.Mutex
+	codes map[string]string
+}
+
+func NewMockProvider(clientId, clientSecret string, claims map[string]interface{}) (*SMockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &SMockProvider{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Claims:       claims,
+		key:          key,
+		kid:          "mock",
+		codes:        make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(WELL_KNOWN_CONFIGURATION, p.handleConfiguration)
+	mux.HandleFunc("/authorize", p.handleAuthorize)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/userinfo", p.handleUserinfo)
+	mux.HandleFunc("/jwks", p.handleJwks)
+	p.Server = httptest.NewServer(mux)
+	return p, nil
+}
+
+func (p *SMockProvider) Issuer() string {
+	return p.Server.URL
+}
+
+func (p *SMockProvider) Close() {
+	p.Server.Close()
+}
+
+func writeJson(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(obj)
+}
+
+func (p *SMockProvider) handleConfiguration(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, SOIDCConfiguration{
+		Issuer:                p.Issuer(),
+		AuthorizationEndpoint: p.Issuer() + "/authorize",
+		TokenEndpoint:         p.Issuer() + "/token",
+		UserinfoEndpoint:      p.Issuer() + "/userinfo",
+		JwksUri:               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *SMockProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != p.ClientId || query.Get("response_type") != "code" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	code := hex.EncodeToString(buf)
+	p.lock.Lock()
+	p.codes[code] = query.Get("nonce")
+	p.lock.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *SMockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientId = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientId != p.ClientId || clientSecret != p.ClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeJson(w, map[string]string{"error": "invalid_client"})
+		return
+	}
+	code := r.PostForm.Get("code")
+	p.lock.Lock()
+	nonce, ok := p.codes[code]
+	delete(p.codes, code)
+	p.lock.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJson(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	idToken, err := p.SignIdToken(nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, map[string]interface{}{
+		"access_token": code,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// SignIdToken issues an id token for Claims
+func (p *SMockProvider) SignIdToken(nonce string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = p.Issuer()
+	claims["aud"] = p.ClientId
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(5 * time.Minute).Unix()
+	if len(nonce) > 0 {
+		claims["nonce"] = nonce
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	return token.SignedString(p.key)
+}
+
+func (p *SMockProvider) handleUserinfo(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, p.Claims)
+}
+
+func (p *SMockProvider) handleJwks(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, SJsonWebKeySet{
+		Keys: []SJsonWebKey{NewRSAJsonWebKey(p.kid, &p.key.PublicKey)},
+	})
+}
@@ -0,0 +1,303 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oidcutils
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/util/httputils"
+)
+
+const (
+	WELL_KNOWN_CONFIGURATION = "/.well-known/openid-configuration"
+
+	SCOPE_OPENID = "openid"
+)
+
+// SOIDCConfiguration is the subset of the OpenID provider metadata used by
+// the authorization code flow
+type SOIDCConfiguration struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type SJsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type SJsonWebKeySet struct {
+	Keys []SJsonWebKey `json:"keys"`
+}
+
+type SOIDCClient struct {
+	Config SOIDCConfiguration
+
+	ClientId     string
+	ClientSecret string
+	RedirectUri  string
+	Scopes       []string
+
+	httpClient *http.Client
+
+	keysLock sync.Mutex
+	keys     map[string]*rsa.PublicKey
+}
+
+func NewOIDCClient(clientId, clientSecret, redirectUri string, scopes []string, httpClient *http.Client) *SOIDCClient {
+	if !utils.IsInStringArray(SCOPE_OPENID, scopes) {
+		scopes = append([]string{SCOPE_OPENID}, scopes...)
+	}
+	if httpClient == nil {
+		httpClient = httputils.GetDefaultClient()
+	}
+	return &SOIDCClient{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectUri:  redirectUri,
+		Scopes:       scopes,
+		httpClient:   httpClient,
+	}
+}
+
+// FetchConfiguration loads the provider metadata from the discovery document
+// of issuer; endpoints already set in Config are kept
+func (cli *SOIDCClient) FetchConfiguration(ctx context.Context, issuer string) error {
+	confUrl := strings.TrimRight(issuer, "/") + WELL_KNOWN_CONFIGURATION
+	_, resp, err := httputils.JSONRequest(cli.httpClient, ctx, httputils.GET, confUrl, nil, nil, false)
+	if err != nil {
+		return errors.Wrap(err, "fetch openid configuration")
+	}
+	conf := SOIDCConfiguration{}
+	err = resp.Unmarshal(&conf)
+	if err != nil {
+		return errors.Wrap(err, "Unmarshal openid configuration")
+	}
+	if conf.Issuer != issuer {
+		return fmt.Errorf("issuer mismatch, expect %s got %s", issuer, conf.Issuer)
+	}
+	if len(cli.Config.AuthorizationEndpoint) > 0 {
+		conf.AuthorizationEndpoint = cli.Config.AuthorizationEndpoint
+	}
+	if len(cli.Config.TokenEndpoint) > 0 {
+		conf.TokenEndpoint = cli.Config.TokenEndpoint
+	}
+	if len(cli.Config.UserinfoEndpoint) > 0 {
+		conf.UserinfoEndpoint = cli.Config.UserinfoEndpoint
+	}
+	if len(cli.Config.JwksUri) > 0 {
+		conf.JwksUri = cli.Config.JwksUri
+	}
+	cli.Config = conf
+	return nil
+}
+
+func (cli *SOIDCClient) oauth2Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cli.ClientId,
+		ClientSecret: cli.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  cli.Config.AuthorizationEndpoint,
+			TokenURL: cli.Config.TokenEndpoint,
+		},
+		RedirectURL: cli.RedirectUri,
+		Scopes:      cli.Scopes,
+	}
+}
+
+// AuthCodeUrl returns the url of the authorization endpoint the user agent is
+// redirected to
+func (cli *SOIDCClient) AuthCodeUrl(state string, nonce string) string {
+	return cli.oauth2Config().AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce))
+}
+
+// Authenticate exchanges an authorization code for tokens, verifies the id
+// token and returns its claims, merged with those of the userinfo endpoint
+func (cli *SOIDCClient) Authenticate(ctx context.Context, code string, nonce string) (*jsonutils.JSONDict, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, cli.httpClient)
+	token, err := cli.oauth2Config().Exchange(ctx, code)
+	if err != nil {
+		return nil, errors.Wrap(err, "Exchange")
+	}
+	rawIdToken, _ := token.Extra("id_token").(string)
+	if len(rawIdToken) == 0 {
+		return nil, fmt.Errorf("no id_token in token response")
+	}
+	claims, err := cli.VerifyIdToken(ctx, rawIdToken, nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "VerifyIdToken")
+	}
+	if len(cli.Config.UserinfoEndpoint) > 0 && len(token.AccessToken) > 0 {
+		header := http.Header{}
+		header.Set("Authorization", "Bearer "+token.AccessToken)
+		_, userinfo, err := httputils.JSONRequest(cli.httpClient, ctx, httputils.GET, cli.Config.UserinfoEndpoint, header, nil, false)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetch userinfo")
+		}
+		sub, _ := userinfo.GetString("sub")
+		idSub, _ := claims.GetString("sub")
+		if sub != idSub {
+			return nil, fmt.Errorf("userinfo subject mismatch")
+		}
+		userDict, _ := userinfo.(*jsonutils.JSONDict)
+		if userDict != nil {
+			userDict.Update(claims)
+			claims = userDict
+		}
+	}
+	return claims, nil
+}
+
+// VerifyIdToken checks the signature, issuer, audience, validity period and
+// nonce of an id token
+func (cli *SOIDCClient) VerifyIdToken(ctx context.Context, rawIdToken string, nonce string) (*jsonutils.JSONDict, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIdToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unsupported signing method %s", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return cli.getKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseWithClaims")
+	}
+	if !claims.VerifyIssuer(cli.Config.Issuer, true) {
+		return nil, fmt.Errorf("invalid issuer")
+	}
+	if !verifyAudience(claims["aud"], cli.ClientId) {
+		return nil, fmt.Errorf("invalid audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("missing exp")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	return jsonutils.Marshal(map[string]interface{}(claims)).(*jsonutils.JSONDict), nil
+}
+
+func verifyAudience(aud interface{}, clientId string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientId
+	case []interface{}:
+		for i := range v {
+			if s, _ := v[i].(string); s == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cli *SOIDCClient) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	cli.keysLock.Lock()
+	defer cli.keysLock.Unlock()
+
+	if key := cli.findKey(kid); key != nil {
+		return key, nil
+	}
+	// keys may have been rotated, refresh once
+	keys, err := cli.fetchKeys(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetchKeys")
+	}
+	cli.keys = keys
+	if key := cli.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %s not found", kid)
+}
+
+func (cli *SOIDCClient) findKey(kid string) *rsa.PublicKey {
+	if len(kid) == 0 && len(cli.keys) == 1 {
+		for _, key := range cli.keys {
+			return key
+		}
+	}
+	return cli.keys[kid]
+}
+
+func (cli *SOIDCClient) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	_, resp, err := httputils.JSONRequest(cli.httpClient, ctx, httputils.GET, cli.Config.JwksUri, nil, nil, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch jwks")
+	}
+	set := SJsonWebKeySet{}
+	err = resp.Unmarshal(&set)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal jwks")
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (len(jwk.Use) > 0 && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.RSAPublicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %s", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk SJsonWebKey) RSAPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode n")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode e")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
+
+// NewRSAJsonWebKey encodes the public part of key, as served by a jwks_uri
+func NewRSAJsonWebKey(kid string, key *rsa.PublicKey) SJsonWebKey {
+	return SJsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package oidcutils
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func mockLogin(t *testing.T, cli *SOIDCClient, state, nonce string) string {
+	noRedirect := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := noRedirect.Get(cli.AuthCodeUrl(state, nonce))
+	if err != nil {
+		t.Fatalf("authorize %s", err)
+	}
+	resp.Body.Close()
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("invalid redirect %s", err)
+	}
+	if loc.Query().Get("state") != state {
+		t.Fatalf("state mismatch %s", loc.Query().Get("state"))
+	}
+	return loc.Query().Get("code")
+}
+
+func TestAuthCodeFlow(t *testing.T) {
+	idp, err := NewMockProvider("onecloud", "secret", map[string]interface{}{
+		"sub":                "u-1001",
+		"preferred_username": "alice",
+		"groups":             []string{"dev", "ops"},
+	})
+	if err != nil {
+		t.Fatalf("NewMockProvider %s", err)
+	}
+	defer idp.Close()
+
+	ctx := context.Background()
+	cli := NewOIDCClient("onecloud", "secret", "http://localhost/callback", []string{"profile"}, nil)
+	err = cli.FetchConfiguration(ctx, idp.Issuer())
+	if err != nil {
+		t.Fatalf("FetchConfiguration %s", err)
+	}
+
+	code := mockLogin(t, cli, "state-1", "nonce-1")
+	claims, err := cli.Authenticate(ctx, code, "nonce-1")
+	if err != nil {
+		t.Fatalf("Authenticate %s", err)
+	}
+	if name, _ := claims.GetString("preferred_username"); name != "alice" {
+		t.Errorf("unexpected username %s", name)
+	}
+	if groups, _ := claims.GetArray("groups"); len(groups) != 2 {
+		t.Errorf("unexpected groups %s", claims)
+	}
+
+	// codes are single use
+	_, err = cli.Authenticate(ctx, code, "nonce-1")
+	if err == nil {
+		t.Errorf("code reused")
+	}
+
+	code = mockLogin(t, cli, "state-2", "nonce-2")
+	_, err = cli.Authenticate(ctx, code, "nonce-other")
+	if err == nil {
+		t.Errorf("nonce mismatch accepted")
+	}
+}
+
+func TestVerifyIdToken(t *testing.T) {
+	idp, err := NewMockProvider("onecloud", "secret", map[string]interface{}{"sub": "u-1"})
+	if err != nil {
+		t.Fatalf("NewMockProvider %s", err)
+	}
+	defer idp.Close()
+	other, err := NewMockProvider("onecloud", "secret", map[string]interface{}{"sub": "u-1"})
+	if err != nil {
+		t.Fatalf("NewMockProvider %s", err)
+	}
+	defer other.Close()
+
+	ctx := context.Background()
+	cli := NewOIDCClient("onecloud", "secret", "http://localhost/callback", nil, nil)
+	err = cli.FetchConfiguration(ctx, idp.Issuer())
+	if err != nil {
+		t.Fatalf("FetchConfiguration %s", err)
+	}
+
+	token, _ := idp.SignIdToken("n")
+	if _, err := cli.VerifyIdToken(ctx, token, "n"); err != nil {
+		t.Errorf("valid token rejected: %s", err)
+	}
+	// signed by a key unknown to the issuer
+	token, _ = other.SignIdToken("n")
+	if _, err := cli.VerifyIdToken(ctx, token, "n"); err == nil {
+		t.Errorf("token of another issuer accepted")
+	}
+
+	cli.ClientId = "another-client"
+	token, _ = idp.SignIdToken("n")
+	if _, err := cli.VerifyIdToken(ctx, token, "n"); err == nil {
+		t.Errorf("token for another audience accepted")
+	}
+}
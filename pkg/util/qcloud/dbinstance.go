@@ -0,0 +1,576 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package qcloud
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/timeutils"
+
+	billing_api "yunion.io/x/onecloud/pkg/apis/billing"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+const (
+	// Status of DescribeDBInstances
+	CDB_STATUS_CREATING  = 0
+	CDB_STATUS_RUNNING   = 1
+	CDB_STATUS_ISOLATING = 4
+	CDB_STATUS_ISOLATED  = 5
+
+	// TaskStatus of DescribeDBInstances
+	CDB_TASK_STATUS_NONE      = 0
+	CDB_TASK_STATUS_UPGRADING = 1
+	CDB_TASK_STATUS_IMPORTING = 2
+	CDB_TASK_STATUS_RESTART   = 4
+)
+
+// SDBInstance is an instance of TencentDB for MySQL, the only engine
+// served by cdb api
+type SDBInstance struct {
+	region *SRegion
+
+	InstanceId    string
+	InstanceName  string
+	Status        int
+	TaskStatus    int
+	InstanceType  int
+	DeviceType    string
+	Cpu           int
+	Memory        int
+	Volume        int
+	EngineVersion string
+	Vip           string
+	Vport         int
+	WanDomain     string
+	WanPort       int
+	WanStatus     int
+	Zone          string
+	UniqVpcId     string
+	UniqSubnetId  string
+	PayType       int
+	CreateTime    string
+	DeadlineTime  string
+}
+
+func (rds *SDBInstance) GetName() string {
+	if len(rds.InstanceName) > 0 {
+		return rds.InstanceName
+	}
+	return rds.InstanceId
+}
+
+func (rds *SDBInstance) GetId() string {
+	return rds.InstanceId
+}
+
+func (rds *SDBInstance) GetGlobalId() string {
+	return rds.InstanceId
+}
+
+func (rds *SDBInstance) GetStatus() string {
+	switch rds.Status {
+	case CDB_STATUS_CREATING:
+		return api.DBINSTANCE_STATUS_DEPLOYING
+	case CDB_STATUS_ISOLATING, CDB_STATUS_ISOLATED:
+		return api.DBINSTANCE_STATUS_DELETING
+	case CDB_STATUS_RUNNING:
+		switch rds.TaskStatus {
+		case CDB_TASK_STATUS_NONE:
+			return api.DBINSTANCE_STATUS_RUNNING
+		case CDB_TASK_STATUS_UPGRADING:
+			return api.DBINSTANCE_STATUS_CHANGE_CONFIG
+		case CDB_TASK_STATUS_RESTART:
+			return api.DBINSTANCE_STATUS_REBOOTING
+		default:
+			// importing, backup restoring and other maintenance tasks
+			// do not stop the instance from serving
+			return api.DBINSTANCE_STATUS_RUNNING
+		}
+	default:
+		return api.DBINSTANCE_STATUS_UNKNOWN
+	}
+}
+
+func (rds *SDBInstance) GetMetadata() *jsonutils.JSONDict {
+	return nil
+}
+
+func (rds *SDBInstance) IsEmulated() bool {
+	return false
+}
+
+func (rds *SDBInstance) GetProjectId() string {
+	return ""
+}
+
+func (rds *SDBInstance) Refresh() error {
+	instance, err := rds.region.GetDBInstance(rds.InstanceId)
+	if err != nil {
+		return err
+	}
+	return jsonutils.Update(rds, instance)
+}
+
+func (rds *SDBInstance) GetBillingType() string {
+	if rds.PayType == 0 {
+		return billing_api.BILLING_TYPE_PREPAID
+	}
+	return billing_api.BILLING_TYPE_POSTPAID
+}
+
+// parseCdbTime parse time returned by cdb api, postpaid instances
+// have 0000-00-00 00:00:00 as deadline
+func parseCdbTime(str string) time.Time {
+	if len(str) == 0 || strings.HasPrefix(str, "0000") {
+		return time.Time{}
+	}
+	tm, err := timeutils.ParseTimeStr(str)
+	if err != nil {
+		log.Errorf("invalid cdb time %s: %v", str, err)
+		return time.Time{}
+	}
+	return tm
+}
+
+func (rds *SDBInstance) GetCreatedAt() time.Time {
+	return parseCdbTime(rds.CreateTime)
+}
+
+func (rds *SDBInstance) GetExpiredAt() time.Time {
+	if rds.GetBillingType() != billing_api.BILLING_TYPE_PREPAID {
+		return time.Time{}
+	}
+	return parseCdbTime(rds.DeadlineTime)
+}
+
+func (rds *SDBInstance) GetIRegion() cloudprovider.ICloudRegion {
+	return rds.region
+}
+
+func (rds *SDBInstance) GetEngine() string {
+	return api.DBINSTANCE_ENGINE_MYSQL
+}
+
+func (rds *SDBInstance) GetEngineVersion() string {
+	return rds.EngineVersion
+}
+
+func (rds *SDBInstance) GetInstanceType() string {
+	return rds.DeviceType
+}
+
+// GetCategory return role of the instance, master, readonly or disaster recovery
+func (rds *SDBInstance) GetCategory() string {
+	switch rds.InstanceType {
+	case 2:
+		return "readonly"
+	case 3:
+		return "disaster"
+	default:
+		return "master"
+	}
+}
+
+func (rds *SDBInstance) GetVcpuCount() int {
+	return rds.Cpu
+}
+
+func (rds *SDBInstance) GetVmemSizeMB() int {
+	return rds.Memory
+}
+
+func (rds *SDBInstance) GetDiskSizeGB() int {
+	return rds.Volume
+}
+
+func (rds *SDBInstance) GetStorageType() string {
+	if rds.DeviceType == "CLOUD" {
+		return "cloud_ssd"
+	}
+	return "local_ssd"
+}
+
+func (rds *SDBInstance) GetPort() int {
+	return rds.Vport
+}
+
+func (rds *SDBInstance) GetMaintainTime() string {
+	return ""
+}
+
+func (rds *SDBInstance) GetConnectionStr() string {
+	if rds.WanStatus != 1 || len(rds.WanDomain) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", rds.WanDomain, rds.WanPort)
+}
+
+func (rds *SDBInstance) GetInternalConnectionStr() string {
+	if len(rds.Vip) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", rds.Vip, rds.Vport)
+}
+
+func (rds *SDBInstance) GetIZoneId() string {
+	zone, err := rds.region.getZoneById(rds.Zone)
+	if err != nil {
+		log.Errorf("failed to find zone %s for dbinstance %s: %v", rds.Zone, rds.InstanceId, err)
+		return ""
+	}
+	return zone.GetGlobalId()
+}
+
+func (rds *SDBInstance) GetIVpcId() string {
+	return rds.UniqVpcId
+}
+
+func (rds *SDBInstance) GetDBNetwork() (*cloudprovider.SDBInstanceNetwork, error) {
+	if len(rds.UniqSubnetId) == 0 {
+		return nil, nil
+	}
+	return &cloudprovider.SDBInstanceNetwork{IP: rds.Vip, NetworkId: rds.UniqSubnetId}, nil
+}
+
+func (rds *SDBInstance) GetIDBInstanceAccounts() ([]cloudprovider.ICloudDBInstanceAccount, error) {
+	accounts := []SDBInstanceAccount{}
+	for {
+		params := map[string]string{}
+		params["InstanceId"] = rds.InstanceId
+		params["Offset"] = fmt.Sprintf("%d", len(accounts))
+		params["Limit"] = "100"
+		body, err := rds.region.cdbRequest("DescribeAccounts", params)
+		if err != nil {
+			return nil, err
+		}
+		parts := []SDBInstanceAccount{}
+		if err := body.Unmarshal(&parts, "Items"); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, parts...)
+		total, _ := body.Int("TotalCount")
+		if len(parts) == 0 || int64(len(accounts)) >= total {
+			break
+		}
+	}
+	ret := []cloudprovider.ICloudDBInstanceAccount{}
+	for i := 0; i < len(accounts); i++ {
+		accounts[i].instance = rds
+		ret = append(ret, &accounts[i])
+	}
+	return ret, nil
+}
+
+func (rds *SDBInstance) GetIDBInstanceDatabases() ([]cloudprovider.ICloudDBInstanceDatabase, error) {
+	databases := []SDBInstanceDatabase{}
+	for {
+		params := map[string]string{}
+		params["InstanceId"] = rds.InstanceId
+		params["Offset"] = fmt.Sprintf("%d", len(databases))
+		params["Limit"] = "100"
+		body, err := rds.region.cdbRequest("DescribeDatabases", params)
+		if err != nil {
+			return nil, err
+		}
+		parts := []SDBInstanceDatabase{}
+		if err := body.Unmarshal(&parts, "DatabaseList"); err != nil {
+			return nil, err
+		}
+		databases = append(databases, parts...)
+		total, _ := body.Int("TotalCount")
+		if len(parts) == 0 || int64(len(databases)) >= total {
+			break
+		}
+	}
+	ret := []cloudprovider.ICloudDBInstanceDatabase{}
+	for i := 0; i < len(databases); i++ {
+		ret = append(ret, &databases[i])
+	}
+	return ret, nil
+}
+
+func (rds *SDBInstance) GetIDBInstanceBackups() ([]cloudprovider.ICloudDBInstanceBackup, error) {
+	backups := []SDBInstanceBackup{}
+	for {
+		params := map[string]string{}
+		params["InstanceId"] = rds.InstanceId
+		params["Offset"] = fmt.Sprintf("%d", len(backups))
+		params["Limit"] = "100"
+		body, err := rds.region.cdbRequest("DescribeBackups", params)
+		if err != nil {
+			return nil, err
+		}
+		parts := []SDBInstanceBackup{}
+		if err := body.Unmarshal(&parts, "Items"); err != nil {
+			return nil, err
+		}
+		backups = append(backups, parts...)
+		total, _ := body.Int("TotalCount")
+		if len(parts) == 0 || int64(len(backups)) >= total {
+			break
+		}
+	}
+	ret := []cloudprovider.ICloudDBInstanceBackup{}
+	for i := 0; i < len(backups); i++ {
+		ret = append(ret, &backups[i])
+	}
+	return ret, nil
+}
+
+// Start is not supported, TencentDB for MySQL can not be stopped
+func (rds *SDBInstance) Start() error {
+	return cloudprovider.ErrNotSupported
+}
+
+func (rds *SDBInstance) Stop() error {
+	return cloudprovider.ErrNotSupported
+}
+
+func (rds *SDBInstance) Reboot() error {
+	params := map[string]string{}
+	params["InstanceIds.0"] = rds.InstanceId
+	_, err := rds.region.cdbRequest("RestartDBInstances", params)
+	return err
+}
+
+// Delete isolate the instance and then release it, instead of keeping
+// it in the recycle bin
+func (rds *SDBInstance) Delete() error {
+	params := map[string]string{}
+	params["InstanceId"] = rds.InstanceId
+	if _, err := rds.region.cdbRequest("IsolateDBInstance", params); err != nil {
+		return err
+	}
+	for start := time.Now(); rds.Status != CDB_STATUS_ISOLATED; {
+		if time.Now().Sub(start) > 10*time.Minute {
+			return fmt.Errorf("timeout waiting dbinstance %s isolated", rds.InstanceId)
+		}
+		time.Sleep(10 * time.Second)
+		if err := rds.Refresh(); err != nil {
+			return err
+		}
+	}
+	params = map[string]string{}
+	params["InstanceIds.0"] = rds.InstanceId
+	_, err := rds.region.cdbRequest("OfflineIsolatedInstances", params)
+	return err
+}
+
+// ChangeConfig upgrade memory, volume or cpu, memory and volume are both
+// required by cdb api so current values are kept if not changed
+func (rds *SDBInstance) ChangeConfig(ctx context.Context, config *cloudprovider.SDBInstanceChangeConfig) error {
+	if config.VmemSizeMb <= 0 && config.DiskSizeGB <= 0 && config.VcpuCount <= 0 {
+		return fmt.Errorf("qcloud dbinstance only support change cpu, memory or disk size")
+	}
+	params := map[string]string{}
+	params["InstanceId"] = rds.InstanceId
+	params["Memory"] = fmt.Sprintf("%d", rds.Memory)
+	params["Volume"] = fmt.Sprintf("%d", rds.Volume)
+	if config.VmemSizeMb > 0 {
+		params["Memory"] = fmt.Sprintf("%d", config.VmemSizeMb)
+	}
+	if config.DiskSizeGB > 0 {
+		params["Volume"] = fmt.Sprintf("%d", config.DiskSizeGB)
+	}
+	if config.VcpuCount > 0 {
+		params["Cpu"] = fmt.Sprintf("%d", config.VcpuCount)
+	}
+	_, err := rds.region.cdbRequest("UpgradeDBInstance", params)
+	return err
+}
+
+type SDBInstanceAccount struct {
+	instance *SDBInstance
+
+	User  string
+	Host  string
+	Notes string
+}
+
+func (account *SDBInstanceAccount) GetName() string {
+	return fmt.Sprintf("%s@%s", account.User, account.Host)
+}
+
+func (account *SDBInstanceAccount) GetStatus() string {
+	return "available"
+}
+
+func (account *SDBInstanceAccount) GetDescription() string {
+	return account.Notes
+}
+
+type SDatabasePrivilege struct {
+	Database   string
+	Privileges []string
+}
+
+func (account *SDBInstanceAccount) GetPrivileges() map[string]string {
+	privileges := map[string]string{}
+	params := map[string]string{}
+	params["InstanceId"] = account.instance.InstanceId
+	params["User"] = account.User
+	params["Host"] = account.Host
+	body, err := account.instance.region.cdbRequest("DescribeAccountPrivileges", params)
+	if err != nil {
+		log.Errorf("failed to get privileges of account %s: %v", account.GetName(), err)
+		return privileges
+	}
+	dbPrivileges := []SDatabasePrivilege{}
+	if err := body.Unmarshal(&dbPrivileges, "DatabasePrivileges"); err != nil {
+		log.Errorf("invalid privileges of account %s: %v", account.GetName(), err)
+		return privileges
+	}
+	for _, privilege := range dbPrivileges {
+		privileges[privilege.Database] = strings.Join(privilege.Privileges, ",")
+	}
+	return privileges
+}
+
+type SDBInstanceDatabase struct {
+	DatabaseName string
+	CharacterSet string
+}
+
+func (database *SDBInstanceDatabase) GetName() string {
+	return database.DatabaseName
+}
+
+func (database *SDBInstanceDatabase) GetStatus() string {
+	return "running"
+}
+
+func (database *SDBInstanceDatabase) GetCharacterSet() string {
+	return database.CharacterSet
+}
+
+func (database *SDBInstanceDatabase) GetDescription() string {
+	return ""
+}
+
+type SDBInstanceBackup struct {
+	BackupId   int64
+	Name       string
+	Size       int64
+	Type       string
+	Way        string
+	Status     string
+	Date       string
+	StartTime  string
+	FinishTime string
+}
+
+func (backup *SDBInstanceBackup) GetGlobalId() string {
+	return fmt.Sprintf("%d", backup.BackupId)
+}
+
+func (backup *SDBInstanceBackup) GetStatus() string {
+	return strings.ToLower(backup.Status)
+}
+
+// GetBackupMode return automated or manual
+func (backup *SDBInstanceBackup) GetBackupMode() string {
+	if strings.ToLower(backup.Way) == "automatic" {
+		return "automated"
+	}
+	return strings.ToLower(backup.Way)
+}
+
+func (backup *SDBInstanceBackup) GetBackupSizeMb() int {
+	return int(backup.Size / 1024 / 1024)
+}
+
+func (backup *SDBInstanceBackup) GetDatabases() []string {
+	return []string{}
+}
+
+func (backup *SDBInstanceBackup) GetStartTime() time.Time {
+	if len(backup.StartTime) > 0 {
+		return parseCdbTime(backup.StartTime)
+	}
+	return parseCdbTime(backup.Date)
+}
+
+func (backup *SDBInstanceBackup) GetEndTime() time.Time {
+	return parseCdbTime(backup.FinishTime)
+}
+
+func (region *SRegion) GetDBInstances(instanceIds []string, offset int, limit int) ([]SDBInstance, int, error) {
+	if limit > 100 || limit <= 0 {
+		limit = 100
+	}
+	params := map[string]string{}
+	params["Offset"] = fmt.Sprintf("%d", offset)
+	params["Limit"] = fmt.Sprintf("%d", limit)
+	for i, id := range instanceIds {
+		params[fmt.Sprintf("InstanceIds.%d", i)] = id
+	}
+	body, err := region.cdbRequest("DescribeDBInstances", params)
+	if err != nil {
+		return nil, 0, err
+	}
+	instances := []SDBInstance{}
+	if err := body.Unmarshal(&instances, "Items"); err != nil {
+		return nil, 0, err
+	}
+	total, _ := body.Int("TotalCount")
+	for i := 0; i < len(instances); i++ {
+		instances[i].region = region
+	}
+	return instances, int(total), nil
+}
+
+func (region *SRegion) GetDBInstance(instanceId string) (*SDBInstance, error) {
+	instances, _, err := region.GetDBInstances([]string{instanceId}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, cloudprovider.ErrNotFound
+	}
+	return &instances[0], nil
+}
+
+func (region *SRegion) GetIDBInstances() ([]cloudprovider.ICloudDBInstance, error) {
+	instances, total, err := region.GetDBInstances(nil, 0, 100)
+	if err != nil {
+		return nil, err
+	}
+	for len(instances) < total {
+		var parts []SDBInstance
+		parts, total, err = region.GetDBInstances(nil, len(instances), 100)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			break
+		}
+		instances = append(instances, parts...)
+	}
+	ret := []cloudprovider.ICloudDBInstance{}
+	for i := 0; i < len(instances); i++ {
+		ret = append(ret, &instances[i])
+	}
+	return ret, nil
+}
+
+func (region *SRegion) GetIDBInstanceById(instanceId string) (cloudprovider.ICloudDBInstance, error) {
+	return region.GetDBInstance(instanceId)
+}
@@ -0,0 +1,124 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package qcloud
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	billing_api "yunion.io/x/onecloud/pkg/apis/billing"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestDBInstanceStatus(t *testing.T) {
+	cases := []struct {
+		status     int
+		taskStatus int
+		want       string
+	}{
+		{CDB_STATUS_CREATING, CDB_TASK_STATUS_NONE, api.DBINSTANCE_STATUS_DEPLOYING},
+		{CDB_STATUS_RUNNING, CDB_TASK_STATUS_NONE, api.DBINSTANCE_STATUS_RUNNING},
+		{CDB_STATUS_RUNNING, CDB_TASK_STATUS_UPGRADING, api.DBINSTANCE_STATUS_CHANGE_CONFIG},
+		{CDB_STATUS_RUNNING, CDB_TASK_STATUS_RESTART, api.DBINSTANCE_STATUS_REBOOTING},
+		{CDB_STATUS_RUNNING, CDB_TASK_STATUS_IMPORTING, api.DBINSTANCE_STATUS_RUNNING},
+		{CDB_STATUS_ISOLATING, CDB_TASK_STATUS_NONE, api.DBINSTANCE_STATUS_DELETING},
+		{CDB_STATUS_ISOLATED, CDB_TASK_STATUS_NONE, api.DBINSTANCE_STATUS_DELETING},
+		{9, CDB_TASK_STATUS_NONE, api.DBINSTANCE_STATUS_UNKNOWN},
+	}
+	for _, c := range cases {
+		rds := &SDBInstance{Status: c.status, TaskStatus: c.taskStatus}
+		if got := rds.GetStatus(); got != c.want {
+			t.Errorf("status %d task status %d: want %s got %s", c.status, c.taskStatus, c.want, got)
+		}
+	}
+}
+
+func TestDBInstanceAttributes(t *testing.T) {
+	body := jsonutils.Marshal(map[string]interface{}{
+		"InstanceId":   "cdb-7ghaiocc",
+		"InstanceName": "",
+		"Status":       1,
+		"Vip":          "10.0.0.12",
+		"Vport":        3306,
+		"WanDomain":    "bj-cdb-7ghaiocc.sql.tencentcdb.com",
+		"WanPort":      63921,
+		"WanStatus":    1,
+		"PayType":      1,
+		"DeviceType":   "CLOUD",
+		"CreateTime":   "2019-08-01 10:20:30",
+		"DeadlineTime": "0000-00-00 00:00:00",
+		"UniqSubnetId": "subnet-3lzrkspo",
+	})
+	rds := SDBInstance{}
+	if err := body.Unmarshal(&rds); err != nil {
+		t.Fatalf("unmarshal dbinstance: %s", err)
+	}
+	if got := rds.GetName(); got != "cdb-7ghaiocc" {
+		t.Errorf("instance without name should use id as name, got %s", got)
+	}
+	if got := rds.GetBillingType(); got != billing_api.BILLING_TYPE_POSTPAID {
+		t.Errorf("want postpaid got %s", got)
+	}
+	if got := rds.GetExpiredAt(); !got.IsZero() {
+		t.Errorf("postpaid instance should not expire, got %s", got)
+	}
+	if got := rds.GetCreatedAt(); !got.Equal(time.Date(2019, 8, 1, 10, 20, 30, 0, time.UTC)) {
+		t.Errorf("invalid create time %s", got)
+	}
+	if got := rds.GetConnectionStr(); got != "bj-cdb-7ghaiocc.sql.tencentcdb.com:63921" {
+		t.Errorf("invalid connection string %s", got)
+	}
+	if got := rds.GetInternalConnectionStr(); got != "10.0.0.12:3306" {
+		t.Errorf("invalid internal connection string %s", got)
+	}
+	if got := rds.GetStorageType(); got != "cloud_ssd" {
+		t.Errorf("invalid storage type %s", got)
+	}
+	network, _ := rds.GetDBNetwork()
+	if network == nil || network.IP != "10.0.0.12" || network.NetworkId != "subnet-3lzrkspo" {
+		t.Errorf("invalid network %#v", network)
+	}
+	rds.WanStatus = 0
+	if got := rds.GetConnectionStr(); got != "" {
+		t.Errorf("connection string of instance without public access should be empty, got %s", got)
+	}
+}
+
+func TestDBInstanceBackup(t *testing.T) {
+	backup := SDBInstanceBackup{
+		BackupId:   105748,
+		Size:       5 * 1024 * 1024,
+		Way:        "automatic",
+		Status:     "SUCCESS",
+		Date:       "2019-08-01 02:00:00",
+		FinishTime: "2019-08-01 02:03:00",
+	}
+	if got := backup.GetGlobalId(); got != "105748" {
+		t.Errorf("invalid backup id %s", got)
+	}
+	if got := backup.GetBackupMode(); got != "automated" {
+		t.Errorf("invalid backup mode %s", got)
+	}
+	if got := backup.GetStatus(); got != "success" {
+		t.Errorf("invalid backup status %s", got)
+	}
+	if got := backup.GetBackupSizeMb(); got != 5 {
+		t.Errorf("invalid backup size %d", got)
+	}
+	if got := backup.GetEndTime().Sub(backup.GetStartTime()); got != 3*time.Minute {
+		t.Errorf("invalid backup duration %s", got)
+	}
+}
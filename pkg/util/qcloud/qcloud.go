@@ -41,6 +41,7 @@ const (
 	QCLOUD_API_VERSION         = "2017-03-12"
 	QCLOUD_CLB_API_VERSION     = "2018-03-17"
 	QCLOUD_BILLING_API_VERSION = "2018-07-09"
+	QCLOUD_CDB_API_VERSION     = "2017-03-20"
 )
 
 type SQcloudClient struct {
@@ -94,6 +95,11 @@ func cbsRequest(client *common.Client, apiName string, params map[string]string,
 	return _jsonRequest(client, domain, QCLOUD_API_VERSION, apiName, params, debug, true)
 }
 
+func cdbRequest(client *common.Client, apiName string, params map[string]string, debug bool) (jsonutils.JSONObject, error) {
+	domain := apiDomain("cdb", params)
+	return _jsonRequest(client, domain, QCLOUD_CDB_API_VERSION, apiName, params, debug, true)
+}
+
 func accountRequest(client *common.Client, apiName string, params map[string]string, debug bool) (jsonutils.JSONObject, error) {
 	domain := "account.api.qcloud.com"
 	return _phpJsonRequest(client, &wssJsonResponse{}, domain, "/v2/index.php", "", apiName, params, debug)
@@ -331,6 +337,14 @@ func (client *SQcloudClient) cbsRequest(apiName string, params map[string]string
 	return cbsRequest(cli, apiName, params, client.Debug)
 }
 
+func (client *SQcloudClient) cdbRequest(apiName string, params map[string]string) (jsonutils.JSONObject, error) {
+	cli, err := client.getDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return cdbRequest(cli, apiName, params, client.Debug)
+}
+
 func (client *SQcloudClient) accountRequestRequest(apiName string, params map[string]string) (jsonutils.JSONObject, error) {
 	cli, err := client.getDefaultClient()
 	if err != nil {
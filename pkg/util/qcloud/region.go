@@ -51,6 +51,22 @@ type SRegion struct {
 	fetchLocation bool
 }
 
+func (self *SRegion) GetIBuckets() ([]cloudprovider.ICloudBucket, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
+func (self *SRegion) GetIBucketById(name string) (cloudprovider.ICloudBucket, error) {
+	return nil, cloudprovider.ErrNotImplemented
+}
+
+func (self *SRegion) CreateIBucket(name string, storageClassStr string, acl string) error {
+	return cloudprovider.ErrNotImplemented
+}
+
+func (self *SRegion) DeleteIBucket(name string) error {
+	return cloudprovider.ErrNotImplemented
+}
+
 func (self *SRegion) GetSkus(zoneId string) ([]cloudprovider.ICloudSku, error) {
 	return nil, cloudprovider.ErrNotImplemented
 }
@@ -638,6 +654,11 @@ func (self *SRegion) lbRequest(apiName string, params map[string]string) (jsonut
 	return self.client.lbRequest(apiName, params)
 }
 
+func (self *SRegion) cdbRequest(apiName string, params map[string]string) (jsonutils.JSONObject, error) {
+	params["Region"] = self.Region
+	return self.client.cdbRequest(apiName, params)
+}
+
 func (self *SRegion) wssRequest(apiName string, params map[string]string) (jsonutils.JSONObject, error) {
 	return self.client.wssRequest(apiName, params)
 }
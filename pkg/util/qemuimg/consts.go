@@ -27,10 +27,15 @@ const (
 	VHD   = TImageFormat("vhd")
 	ISO   = TImageFormat("iso")
 	RAW   = TImageFormat("raw")
+	VHDX  = TImageFormat("vhdx")
+
+	// OVA is a tar of an OVF descriptor and a streamOptimized vmdk,
+	// it can only be a conversion target
+	OVA = TImageFormat("ova")
 )
 
 var supportedImageFormats = []TImageFormat{
-	QCOW2, VMDK, VHD, ISO, RAW,
+	QCOW2, VMDK, VHD, ISO, RAW, VHDX,
 }
 
 func IsSupportedImageFormat(fmtStr string) bool {
@@ -42,6 +47,10 @@ func IsSupportedImageFormat(fmtStr string) bool {
 	return false
 }
 
+func IsSupportedTargetImageFormat(fmtStr string) bool {
+	return IsSupportedImageFormat(fmtStr) || fmtStr == string(OVA)
+}
+
 func (fmt TImageFormat) String() string {
 	switch string(fmt) {
 	case "vhd":
@@ -63,6 +72,10 @@ func String2ImageFormat(fmt string) TImageFormat {
 		return ISO
 	case "raw":
 		return RAW
+	case "vhdx":
+		return VHDX
+	case "ova":
+		return OVA
 	}
 	// log.Fatalf("unknown image format!!! %s", fmt)
 	return TImageFormat(fmt)
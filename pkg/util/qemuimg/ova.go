@@ -0,0 +1,235 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemuimg
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/utils"
+)
+
+// percent of OVA progress taken by the vmdk conversion, the rest by packing
+const ovaConvertProgressRatio = 0.9
+
+const ovfTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <References>
+    <File ovf:href="{{.DiskFile}}" ovf:id="file1" ovf:size="{{.DiskFileSize}}"/>
+  </References>
+  <DiskSection>
+    <Info>Virtual disk information</Info>
+    <Disk ovf:capacity="{{.Capacity}}" ovf:capacityAllocationUnits="byte" ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <VirtualSystem ovf:id="{{.Name}}">
+    <Info>A virtual machine</Info>
+    <Name>{{.Name}}</Name>
+    <VirtualHardwareSection>
+      <Info>Virtual hardware requirements</Info>
+      <System>
+        <vssd:ElementName>Virtual Hardware Family</vssd:ElementName>
+        <vssd:InstanceID>0</vssd:InstanceID>
+        <vssd:VirtualSystemIdentifier>{{.Name}}</vssd:VirtualSystemIdentifier>
+      </System>
+      <Item>
+        <rasd:Description>SCSI Controller</rasd:Description>
+        <rasd:ElementName>scsiController0</rasd:ElementName>
+        <rasd:InstanceID>1</rasd:InstanceID>
+        <rasd:ResourceSubType>lsilogic</rasd:ResourceSubType>
+        <rasd:ResourceType>6</rasd:ResourceType>
+      </Item>
+      <Item>
+        <rasd:AddressOnParent>0</rasd:AddressOnParent>
+        <rasd:ElementName>disk0</rasd:ElementName>
+        <rasd:HostResource>ovf:/disk/vmdisk1</rasd:HostResource>
+        <rasd:InstanceID>2</rasd:InstanceID>
+        <rasd:Parent>1</rasd:Parent>
+        <rasd:ResourceType>17</rasd:ResourceType>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>
+`
+
+type sOvfDescriptor struct {
+	Name         string
+	DiskFile     string
+	DiskFileSize int64
+	Capacity     int64
+}
+
+func (desc sOvfDescriptor) render() ([]byte, error) {
+	tmpl, err := template.New("ovf").Parse(ovfTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, desc)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cloneOva convert image to a streamOptimized vmdk, then pack it with an
+// OVF descriptor and a SHA256 manifest into an OVA archive
+func (img *SQemuImage) cloneOva(ctx context.Context, name string, progress ProgressFunc) (*SQemuImage, error) {
+	tmpDir := fmt.Sprintf("%s.%s", name, utils.GenRequestId(12))
+	err := os.MkdirAll(tmpDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	diskFile := base + "-disk1.vmdk"
+	var convertProgress ProgressFunc
+	if progress != nil {
+		convertProgress = func(percent float64) {
+			progress(percent * ovaConvertProgressRatio)
+		}
+	}
+	err = img.doConvert(ctx, filepath.Join(tmpDir, diskFile), VMDK, vmdkOptions(true), true, "", convertProgress)
+	if err != nil {
+		return nil, err
+	}
+	diskInfo, err := os.Stat(filepath.Join(tmpDir, diskFile))
+	if err != nil {
+		return nil, err
+	}
+	ovf, err := sOvfDescriptor{
+		Name:         base,
+		DiskFile:     diskFile,
+		DiskFileSize: diskInfo.Size(),
+		Capacity:     img.SizeBytes,
+	}.render()
+	if err != nil {
+		return nil, err
+	}
+	ovfFile := base + ".ovf"
+	err = writeFile(filepath.Join(tmpDir, ovfFile), ovf)
+	if err != nil {
+		return nil, err
+	}
+
+	// the descriptor must be the first file of an OVA archive
+	files := []string{ovfFile, diskFile}
+	manifest := &bytes.Buffer{}
+	for _, file := range files {
+		sum, err := sha256File(filepath.Join(tmpDir, file))
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(manifest, "SHA256(%s)= %s\n", file, sum)
+	}
+	mfFile := base + ".mf"
+	err = writeFile(filepath.Join(tmpDir, mfFile), manifest.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, mfFile)
+
+	err = packTar(ctx, name, tmpDir, files)
+	if err != nil {
+		log.Errorf("pack ova %s fail %s", name, err)
+		os.Remove(name)
+		return nil, err
+	}
+	if progress != nil {
+		progress(100)
+	}
+	ovaInfo, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &SQemuImage{
+		Path:            name,
+		Format:          OVA,
+		SizeBytes:       img.SizeBytes,
+		ActualSizeBytes: ovaInfo.Size(),
+		Subformat:       "streamOptimized",
+	}, nil
+}
+
+func writeFile(path string, content []byte) error {
+	fp, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = fp.Write(content)
+	return err
+}
+
+func sha256File(path string) (string, error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func packTar(ctx context.Context, output string, dir string, files []string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	tw := tar.NewWriter(out)
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := func() error {
+			fp, err := os.Open(filepath.Join(dir, file))
+			if err != nil {
+				return err
+			}
+			defer fp.Close()
+			info, err := fp.Stat()
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = file
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, fp)
+			return err
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
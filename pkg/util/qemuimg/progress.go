@@ -0,0 +1,89 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemuimg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProgressFunc is called with percent done of a conversion, from 0 to 100
+type ProgressFunc func(percent float64)
+
+// qemu-img -p print progress like "    (12.34/100%)\r"
+var progressRegexp = regexp.MustCompile(`\((\d+(?:\.\d+)?)/100%\)`)
+
+func parseProgress(line string) (float64, bool) {
+	matches := progressRegexp.FindStringSubmatch(line)
+	if len(matches) < 2 {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	return percent, true
+}
+
+// scanProgressLines split output by '\r' as well as '\n', as progress
+// is refreshed in place with carriage return
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func runWithProgress(cmd *exec.Cmd, progress ProgressFunc) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if progress == nil {
+		err := cmd.Run()
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		if percent, ok := parseProgress(scanner.Text()); ok {
+			progress(percent)
+		}
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -16,6 +16,8 @@ package qemuimg
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -183,7 +185,7 @@ func (img *SQemuImage) IsChained() bool {
 	return len(img.BackFilePath) > 0
 }
 
-func (img *SQemuImage) doConvert(name string, format TImageFormat, options []string, compact bool, password string) error {
+func (img *SQemuImage) doConvert(ctx context.Context, name string, format TImageFormat, options []string, compact bool, password string, progress ProgressFunc) error {
 	if !img.IsValid() {
 		return fmt.Errorf("self is not valid")
 	}
@@ -192,6 +194,9 @@ func (img *SQemuImage) doConvert(name string, format TImageFormat, options []str
 	if compact {
 		cmdline = append(cmdline, "-c")
 	}
+	if progress != nil {
+		cmdline = append(cmdline, "-p")
+	}
 	cmdline = append(cmdline, "-f", img.Format.String(), "-O", format.String())
 	if len(password) > 0 {
 		if options == nil {
@@ -204,7 +209,8 @@ func (img *SQemuImage) doConvert(name string, format TImageFormat, options []str
 	}
 	cmdline = append(cmdline, img.Path, name)
 	log.Infof("XXXX qemu-img command: %s", cmdline)
-	cmd := exec.Command("ionice", cmdline...)
+	// ionice exec qemu-img, so killing it on cancel stop the conversion
+	cmd := exec.CommandContext(ctx, "ionice", cmdline...)
 	if len(img.Password) > 0 || len(password) > 0 {
 		input := ""
 		if len(img.Password) > 0 {
@@ -215,7 +221,10 @@ func (img *SQemuImage) doConvert(name string, format TImageFormat, options []str
 		}
 		cmd.Stdin = bytes.NewBuffer([]byte(input))
 	}
-	err := cmd.Run()
+	err := runWithProgress(cmd, progress)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
 	if err != nil {
 		log.Errorf("clone fail %s", err)
 		os.Remove(name)
@@ -225,22 +234,37 @@ func (img *SQemuImage) doConvert(name string, format TImageFormat, options []str
 }
 
 func (img *SQemuImage) Clone(name string, format TImageFormat, compact bool) (*SQemuImage, error) {
+	return img.CloneWithContext(context.Background(), name, format, compact, nil)
+}
+
+// CloneWithContext convert image to name in format, progress is called with
+// percent done if not nil, the conversion is aborted when ctx is done and
+// ctx.Err() is returned
+func (img *SQemuImage) CloneWithContext(ctx context.Context, name string, format TImageFormat, compact bool, progress ProgressFunc) (*SQemuImage, error) {
 	switch format {
 	case QCOW2:
-		return img.CloneQcow2(name, compact)
+		options := make([]string, 0)
+		if !compact {
+			options = append(options, qcow2SparseOptions()...)
+		}
+		return img.clone(ctx, name, QCOW2, options, compact, "", progress)
 	case VMDK:
-		return img.CloneVmdk(name, compact)
+		return img.clone(ctx, name, VMDK, vmdkOptions(compact), compact, "", progress)
 	case RAW:
-		return img.CloneRaw(name)
+		return img.clone(ctx, name, RAW, nil, false, "", progress)
 	case VHD:
-		return img.CloneVhd(name)
+		return img.clone(ctx, name, VHD, nil, false, "", progress)
+	case VHDX:
+		return img.clone(ctx, name, VHDX, nil, false, "", progress)
+	case OVA:
+		return img.cloneOva(ctx, name, progress)
 	default:
 		return nil, ErrUnsupportedFormat
 	}
 }
 
-func (img *SQemuImage) clone(name string, format TImageFormat, options []string, compact bool, password string) (*SQemuImage, error) {
-	err := img.doConvert(name, format, options, compact, password)
+func (img *SQemuImage) clone(ctx context.Context, name string, format TImageFormat, options []string, compact bool, password string, progress ProgressFunc) (*SQemuImage, error) {
+	err := img.doConvert(ctx, name, format, options, compact, password, progress)
 	if err != nil {
 		return nil, err
 	}
@@ -248,8 +272,12 @@ func (img *SQemuImage) clone(name string, format TImageFormat, options []string,
 }
 
 func (img *SQemuImage) convert(format TImageFormat, options []string, compact bool, password string) error {
+	return img.convertWithContext(context.Background(), format, options, compact, password, nil)
+}
+
+func (img *SQemuImage) convertWithContext(ctx context.Context, format TImageFormat, options []string, compact bool, password string, progress ProgressFunc) error {
 	tmpPath := fmt.Sprintf("%s.%s", img.Path, utils.GenRequestId(36))
-	err := img.doConvert(tmpPath, format, options, compact, password)
+	err := img.doConvert(ctx, tmpPath, format, options, compact, password, progress)
 	if err != nil {
 		return err
 	}
@@ -267,7 +295,7 @@ func (img *SQemuImage) convert(format TImageFormat, options []string, compact bo
 func (img *SQemuImage) convertTo(
 	format TImageFormat, options []string, compact bool, password string, output string,
 ) error {
-	err := img.doConvert(output, format, options, compact, password)
+	err := img.doConvert(context.Background(), output, format, options, compact, password, nil)
 	if err != nil {
 		return err
 	}
@@ -325,6 +353,28 @@ func (img *SQemuImage) Convert2Raw() error {
 	return img.convert(RAW, nil, false, "")
 }
 
+func (img *SQemuImage) Convert2Vhdx() error {
+	return img.convert(VHDX, nil, false, "")
+}
+
+// ConvertWithContext convert image in place, see CloneWithContext
+func (img *SQemuImage) ConvertWithContext(ctx context.Context, format TImageFormat, compact bool, progress ProgressFunc) error {
+	switch format {
+	case QCOW2:
+		options := make([]string, 0)
+		if !compact {
+			options = append(options, qcow2SparseOptions()...)
+		}
+		return img.convertWithContext(ctx, QCOW2, options, compact, "", progress)
+	case VMDK:
+		return img.convertWithContext(ctx, VMDK, vmdkOptions(compact), compact, "", progress)
+	case RAW, VHD, VHDX:
+		return img.convertWithContext(ctx, format, nil, false, "", progress)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
+
 func (img *SQemuImage) IsRaw() bool {
 	return img.Format == RAW
 }
@@ -349,15 +399,7 @@ func (img *SQemuImage) Expand() error {
 }
 
 func (img *SQemuImage) CloneQcow2(name string, compact bool) (*SQemuImage, error) {
-	options := make([]string, 0)
-	//if len(backPath) > 0 {
-	//	options = append(options, fmt.Sprintf("backing_file=%s", backPath))
-	//} else
-	if !compact {
-		sparseOpts := qcow2SparseOptions()
-		options = append(options, sparseOpts...)
-	}
-	return img.clone(name, QCOW2, options, compact, "")
+	return img.CloneWithContext(context.Background(), name, QCOW2, compact, nil)
 }
 
 func vmdkOptions(compact bool) []string {
@@ -377,15 +419,19 @@ func vmdkOptions(compact bool) []string {
 // }
 
 func (img *SQemuImage) CloneVmdk(name string, compact bool) (*SQemuImage, error) {
-	return img.clone(name, VMDK, vmdkOptions(compact), compact, "")
+	return img.CloneWithContext(context.Background(), name, VMDK, compact, nil)
 }
 
 func (img *SQemuImage) CloneVhd(name string) (*SQemuImage, error) {
-	return img.clone(name, VHD, nil, false, "")
+	return img.CloneWithContext(context.Background(), name, VHD, false, nil)
+}
+
+func (img *SQemuImage) CloneVhdx(name string) (*SQemuImage, error) {
+	return img.CloneWithContext(context.Background(), name, VHDX, false, nil)
 }
 
 func (img *SQemuImage) CloneRaw(name string) (*SQemuImage, error) {
-	return img.clone(name, RAW, nil, false, "")
+	return img.CloneWithContext(context.Background(), name, RAW, false, nil)
 }
 
 func (img *SQemuImage) create(sizeMB int, format TImageFormat, options []string) error {
@@ -432,6 +478,10 @@ func (img *SQemuImage) CreateVhd(sizeMB int) error {
 	return img.create(sizeMB, VHD, nil)
 }
 
+func (img *SQemuImage) CreateVhdx(sizeMB int) error {
+	return img.create(sizeMB, VHDX, nil)
+}
+
 func (img *SQemuImage) CreateRaw(sizeMB int) error {
 	return img.create(sizeMB, RAW, nil)
 }
@@ -517,3 +567,31 @@ func (img *SQemuImage) WholeChainFormatIs(format string) (bool, error) {
 	}
 	return true, nil
 }
+
+type SImageExtent struct {
+	Start  int64 `json:"start"`
+	Length int64 `json:"length"`
+	Depth  int   `json:"depth"`
+	Zero   bool  `json:"zero"`
+	Data   bool  `json:"data"`
+}
+
+// MapNbdExport return the allocation map of an export of qemu nbd server.
+// If dirtyBitmap is given the map is taken from the bitmap instead,
+// and dirty extents are reported with Data false.
+func MapNbdExport(host string, port int, exportName, dirtyBitmap string) ([]SImageExtent, error) {
+	opts := fmt.Sprintf("driver=nbd,server.type=inet,server.host=%s,server.port=%d,export=%s",
+		host, port, exportName)
+	if len(dirtyBitmap) > 0 {
+		opts += ",x-dirty-bitmap=qemu:dirty-bitmap:" + dirtyBitmap
+	}
+	out, err := exec.Command(qemutils.GetQemuImg(), "map", "--output=json", "--image-opts", opts).Output()
+	if err != nil {
+		return nil, fmt.Errorf("qemu-img map %s: %s", opts, err)
+	}
+	var extents = make([]SImageExtent, 0)
+	if err := json.Unmarshal(out, &extents); err != nil {
+		return nil, fmt.Errorf("parse qemu-img map output: %s", err)
+	}
+	return extents, nil
+}
@@ -14,7 +14,11 @@
 
 package qemuimg
 
-import "testing"
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
 
 func TestGetQemuImgVersion(t *testing.T) {
 	verStr := `qemu-img version 1.5.3, Copyright (c) 2004-2008 Fabrice Bellard`
@@ -22,6 +26,27 @@ func TestGetQemuImgVersion(t *testing.T) {
 	t.Logf("%s", matches[1])
 }
 
+func TestParseProgress(t *testing.T) {
+	out := "    (0.00/100%)\r    (1.01/100%)\r    (55.5/100%)\r    (100.00/100%)\r\n"
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	scanner.Split(scanProgressLines)
+	percents := []float64{}
+	for scanner.Scan() {
+		if percent, ok := parseProgress(scanner.Text()); ok {
+			percents = append(percents, percent)
+		}
+	}
+	want := []float64{0, 1.01, 55.5, 100}
+	if len(percents) != len(want) {
+		t.Fatalf("got %v want %v", percents, want)
+	}
+	for i := range want {
+		if percents[i] != want[i] {
+			t.Errorf("got %v want %v", percents, want)
+		}
+	}
+}
+
 // TODO: rewrite TestQcow2
 /*
 func TestQcow2(t *testing.T) {
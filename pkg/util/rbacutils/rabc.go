@@ -61,6 +61,9 @@ type SRbacPolicy struct {
 	Rules     []SRbacRule
 	Projects  []string
 	Roles     []string
+	// auth methods, e.g. totp, every one of which the token must have
+	// been issued with for the policy to apply
+	AuthMethods []string
 }
 
 type SRbacRule struct {
@@ -237,6 +240,10 @@ func (policy *SRbacPolicy) Decode(policyJson jsonutils.JSONObject) error {
 		roleJson, _ := policyJson.GetArray("roles")
 		policy.Roles = jsonutils.JSONArray2StringArray(roleJson)
 	}
+	if policyJson.Contains("auth_methods") {
+		methodJson, _ := policyJson.GetArray("auth_methods")
+		policy.AuthMethods = jsonutils.JSONArray2StringArray(methodJson)
+	}
 
 	if len(policy.Projects) == 0 && len(policy.Roles) == 0 && len(policy.Condition) > 0 {
 		// XXX hack
@@ -413,6 +420,9 @@ func (policy *SRbacPolicy) Encode() (jsonutils.JSONObject, error) {
 	if len(policy.Roles) > 0 {
 		ret.Add(jsonutils.NewStringArray(policy.Roles), "roles")
 	}
+	if len(policy.AuthMethods) > 0 {
+		ret.Add(jsonutils.NewStringArray(policy.AuthMethods), "auth_methods")
+	}
 	ret.Add(rules, "policy")
 	return ret, nil
 }
@@ -450,8 +460,20 @@ func intersect(s1 []string, s2 []string) bool {
 	return false
 }
 
+func containsAll(s1 []string, s2 []string) bool {
+	for i := range s2 {
+		if !contains(s1, s2[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (policy *SRbacPolicy) Match(userCred mcclient.TokenCredential) bool {
 	if (len(policy.Projects) == 0 || (userCred != nil && contains(policy.Projects, userCred.GetProjectName()))) && (len(policy.Roles) == 0 || (userCred != nil && intersect(policy.Roles, userCred.GetRoles()))) {
+		if len(policy.AuthMethods) > 0 && (userCred == nil || !containsAll(userCred.GetAuthMethods(), policy.AuthMethods)) {
+			return false
+		}
 		return true
 	}
 	return false
@@ -326,6 +326,28 @@ func TestSRbacPolicyMatch(t *testing.T) {
 			nil,
 			false,
 		},
+		{
+			SRbacPolicy{
+				Roles:       []string{"admin"},
+				AuthMethods: []string{"totp"},
+			},
+			&mcclient.SSimpleToken{
+				Roles:       "admin",
+				AuthMethods: []string{"password"},
+			},
+			false,
+		},
+		{
+			SRbacPolicy{
+				Roles:       []string{"admin"},
+				AuthMethods: []string{"totp"},
+			},
+			&mcclient.SSimpleToken{
+				Roles:       "admin",
+				AuthMethods: []string{"password", "totp"},
+			},
+			true,
+		},
 	}
 	for _, c := range cases {
 		got := c.policy.Match(c.userCred)
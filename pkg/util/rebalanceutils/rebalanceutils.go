@@ -0,0 +1,268 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalanceutils
+
+import (
+	"sort"
+)
+
+// SHost is the resource usage of a host collected from scheduler cache,
+// hosts in different groups (e.g. zones) are never balanced against each other
+type SHost struct {
+	Id      string
+	GroupId string
+
+	CpuCount     int64
+	UsedCpuCount int64
+	MemSizeMb    int64
+	UsedMemMb    int64
+}
+
+// Load returns the utilization of the most loaded resource of host
+func (h *SHost) Load() float64 {
+	return loadOf(h.UsedCpuCount, h.CpuCount, h.UsedMemMb, h.MemSizeMb)
+}
+
+func (h *SHost) loadWith(cpu, mem int64) float64 {
+	return loadOf(h.UsedCpuCount+cpu, h.CpuCount, h.UsedMemMb+mem, h.MemSizeMb)
+}
+
+func loadOf(usedCpu, cpu, usedMem, mem int64) float64 {
+	var cpuLoad, memLoad float64
+	if cpu > 0 {
+		cpuLoad = float64(usedCpu) / float64(cpu)
+	}
+	if mem > 0 {
+		memLoad = float64(usedMem) / float64(mem)
+	}
+	if cpuLoad > memLoad {
+		return cpuLoad
+	}
+	return memLoad
+}
+
+// SGuest is a migratable guest running on one of the hosts
+type SGuest struct {
+	Id        string
+	HostId    string
+	CpuCount  int64
+	MemSizeMb int64
+}
+
+// SMove is a single step of a migration plan
+type SMove struct {
+	GuestId   string
+	SrcHostId string
+	DstHostId string
+	// load of source and destination host after the move
+	SrcLoad float64
+	DstLoad float64
+}
+
+// TCandidateFunc returns ids of hosts the guest is allowed to migrate to,
+// usually answered by scheduler so that schedtags and host resources are
+// respected
+type TCandidateFunc func(guest *SGuest) ([]string, error)
+
+type SPlanner struct {
+	// a host is considered overloaded if its load exceeds the average
+	// load of its group by Threshold
+	Threshold float64
+	// maximal moves of a plan, <= 0 means no move will be planned
+	MaxMoves int
+	// maximal moves out of a single host, <= 0 means unlimited
+	MaxMovesPerHost int
+}
+
+// Imbalance returns the difference between the maximal and the average
+// load of each group
+func Imbalance(hosts []*SHost) map[string]float64 {
+	ret := make(map[string]float64)
+	for gid, group := range groupHosts(hosts) {
+		ret[gid] = maxLoad(group) - avgLoad(group)
+	}
+	return ret
+}
+
+func groupHosts(hosts []*SHost) map[string][]*SHost {
+	groups := make(map[string][]*SHost)
+	for _, h := range hosts {
+		groups[h.GroupId] = append(groups[h.GroupId], h)
+	}
+	return groups
+}
+
+func avgLoad(hosts []*SHost) float64 {
+	if len(hosts) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, h := range hosts {
+		sum += h.Load()
+	}
+	return sum / float64(len(hosts))
+}
+
+func maxLoad(hosts []*SHost) float64 {
+	var max float64
+	for _, h := range hosts {
+		if l := h.Load(); l > max {
+			max = l
+		}
+	}
+	return max
+}
+
+// Plan produces at most MaxMoves moves, each one moves a guest from the most
+// overloaded host of a group to the candidate host which keeps the loads of
+// both hosts lowest. Usage of hosts is updated in place as moves are planned.
+func (p *SPlanner) Plan(hosts []*SHost, guests []*SGuest, candidates TCandidateFunc) ([]SMove, error) {
+	moves := make([]SMove, 0)
+	if p.MaxMoves <= 0 {
+		return moves, nil
+	}
+	hostMap := make(map[string]*SHost)
+	for _, h := range hosts {
+		hostMap[h.Id] = h
+	}
+	hostGuests := make(map[string][]*SGuest)
+	for _, g := range guests {
+		if _, ok := hostMap[g.HostId]; ok {
+			hostGuests[g.HostId] = append(hostGuests[g.HostId], g)
+		}
+	}
+	// smaller guests are cheaper to migrate, prefer them if moves are equal
+	for _, gs := range hostGuests {
+		sort.Slice(gs, func(i, j int) bool {
+			if gs[i].MemSizeMb != gs[j].MemSizeMb {
+				return gs[i].MemSizeMb < gs[j].MemSizeMb
+			}
+			return gs[i].CpuCount < gs[j].CpuCount
+		})
+	}
+
+	cache := make(map[string][]string)
+	getCandidates := func(g *SGuest) ([]string, error) {
+		if ids, ok := cache[g.Id]; ok {
+			return ids, nil
+		}
+		ids, err := candidates(g)
+		if err != nil {
+			return nil, err
+		}
+		cache[g.Id] = ids
+		return ids, nil
+	}
+
+	movedOut := make(map[string]int)
+	movedGuests := make(map[string]bool)
+	exhausted := make(map[string]bool)
+	groups := groupHosts(hosts)
+	groupIds := make([]string, 0, len(groups))
+	for gid := range groups {
+		groupIds = append(groupIds, gid)
+	}
+	sort.Strings(groupIds)
+
+	for len(moves) < p.MaxMoves {
+		var src *SHost
+		var srcAvg float64
+		for _, gid := range groupIds {
+			group := groups[gid]
+			avg := avgLoad(group)
+			for _, h := range group {
+				if exhausted[h.Id] || h.Load()-avg <= p.Threshold {
+					continue
+				}
+				if src == nil || h.Load()-avg > src.Load()-srcAvg {
+					src, srcAvg = h, avg
+				}
+			}
+		}
+		if src == nil {
+			break
+		}
+		move, err := p.bestMove(src, groups[src.GroupId], hostGuests[src.Id], movedGuests, getCandidates)
+		if err != nil {
+			return nil, err
+		}
+		if move == nil {
+			exhausted[src.Id] = true
+			continue
+		}
+		g := move.guest
+		src.UsedCpuCount -= g.CpuCount
+		src.UsedMemMb -= g.MemSizeMb
+		move.dst.UsedCpuCount += g.CpuCount
+		move.dst.UsedMemMb += g.MemSizeMb
+		movedGuests[g.Id] = true
+		movedOut[src.Id] += 1
+		if p.MaxMovesPerHost > 0 && movedOut[src.Id] >= p.MaxMovesPerHost {
+			exhausted[src.Id] = true
+		}
+		moves = append(moves, SMove{
+			GuestId:   g.Id,
+			SrcHostId: src.Id,
+			DstHostId: move.dst.Id,
+			SrcLoad:   src.Load(),
+			DstLoad:   move.dst.Load(),
+		})
+	}
+	return moves, nil
+}
+
+type sMoveCandidate struct {
+	guest *SGuest
+	dst   *SHost
+	peak  float64
+}
+
+func (p *SPlanner) bestMove(src *SHost, group []*SHost, guests []*SGuest, moved map[string]bool, candidates TCandidateFunc) (*sMoveCandidate, error) {
+	inGroup := make(map[string]*SHost)
+	for _, h := range group {
+		inGroup[h.Id] = h
+	}
+	srcLoad := src.Load()
+	var best *sMoveCandidate
+	for _, g := range guests {
+		if moved[g.Id] {
+			continue
+		}
+		ids, err := candidates(g)
+		if err != nil {
+			return nil, err
+		}
+		srcAfter := src.loadWith(-g.CpuCount, -g.MemSizeMb)
+		for _, id := range ids {
+			dst, ok := inGroup[id]
+			if !ok || dst.Id == src.Id {
+				continue
+			}
+			dstAfter := dst.loadWith(g.CpuCount, g.MemSizeMb)
+			// a move must not make the destination busier than the source was
+			if dstAfter >= srcLoad {
+				continue
+			}
+			peak := srcAfter
+			if dstAfter > peak {
+				peak = dstAfter
+			}
+			if best == nil || peak < best.peak {
+				best = &sMoveCandidate{guest: g, dst: dst, peak: peak}
+			}
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rebalanceutils
+
+import (
+	"testing"
+)
+
+func newTestHosts() []*SHost {
+	return []*SHost{
+		{Id: "h1", GroupId: "z1", CpuCount: 32, UsedCpuCount: 28, MemSizeMb: 65536, UsedMemMb: 57344},
+		{Id: "h2", GroupId: "z1", CpuCount: 32, UsedCpuCount: 4, MemSizeMb: 65536, UsedMemMb: 8192},
+		{Id: "h3", GroupId: "z1", CpuCount: 32, UsedCpuCount: 16, MemSizeMb: 65536, UsedMemMb: 32768},
+		{Id: "h4", GroupId: "z2", CpuCount: 32, UsedCpuCount: 0, MemSizeMb: 65536, UsedMemMb: 0},
+	}
+}
+
+func newTestGuests() []*SGuest {
+	return []*SGuest{
+		{Id: "g1", HostId: "h1", CpuCount: 8, MemSizeMb: 16384},
+		{Id: "g2", HostId: "h1", CpuCount: 4, MemSizeMb: 8192},
+		{Id: "g3", HostId: "h1", CpuCount: 16, MemSizeMb: 32768},
+		{Id: "g4", HostId: "h3", CpuCount: 16, MemSizeMb: 32768},
+	}
+}
+
+func allHosts(hosts []*SHost) TCandidateFunc {
+	return func(g *SGuest) ([]string, error) {
+		ids := make([]string, 0)
+		for _, h := range hosts {
+			if h.Id != g.HostId {
+				ids = append(ids, h.Id)
+			}
+		}
+		return ids, nil
+	}
+}
+
+func TestImbalance(t *testing.T) {
+	ret := Imbalance(newTestHosts())
+	if ret["z2"] != 0 {
+		t.Errorf("single host group should be balanced, got %f", ret["z2"])
+	}
+	if ret["z1"] <= 0.3 {
+		t.Errorf("z1 should be imbalanced, got %f", ret["z1"])
+	}
+}
+
+func TestPlan(t *testing.T) {
+	hosts := newTestHosts()
+	p := &SPlanner{Threshold: 0.1, MaxMoves: 5}
+	moves, err := p.Plan(hosts, newTestGuests(), allHosts(hosts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) == 0 {
+		t.Fatal("expect moves planned")
+	}
+	first := moves[0]
+	if first.SrcHostId != "h1" || first.DstHostId != "h2" {
+		t.Errorf("unexpected first move %#v", first)
+	}
+	for _, m := range moves {
+		if m.DstHostId == "h4" {
+			t.Errorf("move across group %#v", m)
+		}
+	}
+	if imb := Imbalance(hosts)["z1"]; imb > 0.1 {
+		t.Errorf("z1 still imbalanced after plan: %f", imb)
+	}
+}
+
+func TestPlanLimits(t *testing.T) {
+	hosts := newTestHosts()
+	p := &SPlanner{Threshold: 0.1, MaxMoves: 5, MaxMovesPerHost: 1}
+	moves, err := p.Plan(hosts, newTestGuests(), allHosts(hosts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]int)
+	for _, m := range moves {
+		out[m.SrcHostId] += 1
+	}
+	for id, cnt := range out {
+		if cnt > 1 {
+			t.Errorf("host %s moved out %d guests", id, cnt)
+		}
+	}
+
+	// no candidate allowed, e.g. schedtags forbid every host
+	hosts = newTestHosts()
+	none := func(g *SGuest) ([]string, error) { return nil, nil }
+	moves, err = p.Plan(hosts, newTestGuests(), none)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 0 {
+		t.Errorf("expect no move, got %d", len(moves))
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SMockIdP is an in-process SAML identity provider for tests. Its SSO
+// endpoint logs in NameId with Attributes without any interaction and
+// answers with an auto-submitting HTTP-POST form.
+type SMockIdP struct {
+	Server *httptest.Server
+
+	NameId     string
+	Attributes map[string][]string
+
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func NewMockIdP(nameId string, attrs map[string][]string) (*SMockIdP, error) {
+	key, cert, err := GenerateSelfSignedCert("mock-idp")
+	if err != nil {
+		return nil, err
+	}
+	p := &SMockIdP{
+		NameId:     nameId,
+		Attributes: attrs,
+		key:        key,
+		cert:       cert,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sso", p.handleSSO)
+	p.Server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// GenerateSelfSignedCert creates an RSA key with a self signed certificate
+func GenerateSelfSignedCert(cn string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+func (p *SMockIdP) EntityId() string {
+	return p.Server.URL + "/metadata"
+}
+
+func (p *SMockIdP) SsoUrl() string {
+	return p.Server.URL + "/sso"
+}
+
+func (p *SMockIdP) CertificatePem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.cert.Raw}))
+}
+
+func (p *SMockIdP) Close() {
+	p.Server.Close()
+}
+
+// BuildResponse returns a base64 encoded response with a signed assertion
+// answering requestId
+func (p *SMockIdP) BuildResponse(spEntityId, acsUrl, requestId string) (string, error) {
+	now := time.Now()
+	respId := GenerateId()
+	assertionId := GenerateId()
+	var attrs strings.Builder
+	for name, values := range p.Attributes {
+		attrs.WriteString(fmt.Sprintf(`<saml:Attribute Name="%s">`, html.EscapeString(name)))
+		for _, v := range values {
+			attrs.WriteString(`<saml:AttributeValue>` + html.EscapeString(v) + `</saml:AttributeValue>`)
+		}
+		attrs.WriteString(`</saml:Attribute>`)
+	}
+	resp := fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" InResponseTo="%s">`+
+		`<saml:Issuer>%s</saml:Issuer>`+
+		`<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>`+
+		`<saml:Assertion ID="%s" Version="2.0" IssueInstant="%s">`+
+		`<saml:Issuer>%s</saml:Issuer>`+
+		`<saml:Subject><saml:NameID Format="%s">%s</saml:NameID>`+
+		`<saml:SubjectConfirmation Method="%s"><saml:SubjectConfirmationData NotOnOrAfter="%s" Recipient="%s" InResponseTo="%s"/></saml:SubjectConfirmation>`+
+		`</saml:Subject>`+
+		`<saml:Conditions NotBefore="%s" NotOnOrAfter="%s"><saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction></saml:Conditions>`+
+		`<saml:AuthnStatement AuthnInstant="%s" SessionIndex="%s"/>`+
+		`<saml:AttributeStatement>%s</saml:AttributeStatement>`+
+		`</saml:Assertion></samlp:Response>`,
+		NS_SAML_PROTOCOL, NS_SAML_ASSERTION, respId, FormatTime(now), html.EscapeString(acsUrl), requestId,
+		html.EscapeString(p.EntityId()),
+		STATUS_SUCCESS,
+		assertionId, FormatTime(now),
+		html.EscapeString(p.EntityId()),
+		NAMEID_FORMAT_UNSPECIFIED, html.EscapeString(p.NameId),
+		CONFIRMATION_METHOD_BEARER, FormatTime(now.Add(5*time.Minute)), html.EscapeString(acsUrl), requestId,
+		FormatTime(now.Add(-time.Minute)), FormatTime(now.Add(5*time.Minute)), html.EscapeString(spEntityId),
+		FormatTime(now), assertionId,
+		attrs.String(),
+	)
+	root, err := parseXML([]byte(resp))
+	if err != nil {
+		return "", errors.Wrap(err, "parse response")
+	}
+	err = signElement(root, assertionId, p.key, p.cert)
+	if err != nil {
+		return "", errors.Wrap(err, "signElement")
+	}
+	return base64.StdEncoding.EncodeToString(root.Serialize()), nil
+}
+
+func (p *SMockIdP) handleSSO(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeAuthnRequest(r.URL.Query().Get("SAMLRequest"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := p.BuildResponse(req.Issuer, req.AssertionConsumerServiceURL, req.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprint(w, AutoPostForm(req.AssertionConsumerServiceURL, map[string]string{
+		"SAMLResponse": resp,
+		"RelayState":   r.URL.Query().Get("RelayState"),
+	}))
+}
+
+// AutoPostForm renders an HTML page posting fields to action on load, as
+// used by the HTTP-POST binding
+func AutoPostForm(action string, fields map[string]string) string {
+	var buf strings.Builder
+	buf.WriteString(`<html><body onload="document.forms[0].submit()">`)
+	buf.WriteString(`<form method="post" action="` + html.EscapeString(action) + `">`)
+	for k, v := range fields {
+		buf.WriteString(`<input type="hidden" name="` + html.EscapeString(k) + `" value="` + html.EscapeString(v) + `"/>`)
+	}
+	buf.WriteString(`<noscript><input type="submit" value="Continue"/></noscript></form></body></html>`)
+	return buf.String()
+}
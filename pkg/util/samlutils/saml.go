@@ -0,0 +1,387 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	NS_SAML_PROTOCOL  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	NS_SAML_ASSERTION = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	BINDING_HTTP_POST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	BINDING_HTTP_REDIRECT = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+	STATUS_SUCCESS = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+	NAMEID_FORMAT_UNSPECIFIED = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+
+	CONFIRMATION_METHOD_BEARER = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// tolerated clock difference between the SP and the IdP
+	CLOCK_SKEW = 3 * time.Minute
+)
+
+type SAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr,omitempty"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr,omitempty"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr,omitempty"`
+	Issuer                      string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *struct {
+		Format      string `xml:"Format,attr,omitempty"`
+		AllowCreate bool   `xml:"AllowCreate,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy"`
+}
+
+type sAttribute struct {
+	Name         string   `xml:"Name,attr"`
+	FriendlyName string   `xml:"FriendlyName,attr"`
+	Values       []string `xml:"AttributeValue"`
+}
+
+type sAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"NameID"`
+		SubjectConfirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+				Recipient    string `xml:"Recipient,attr"`
+				InResponseTo string `xml:"InResponseTo,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions *struct {
+		NotBefore            string `xml:"NotBefore,attr"`
+		NotOnOrAfter         string `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	AuthnStatements []struct {
+		SessionIndex string `xml:"SessionIndex,attr"`
+	} `xml:"AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []sAttribute `xml:"Attribute"`
+	} `xml:"AttributeStatement"`
+}
+
+// SAssertionInfo is the verified content of an assertion
+type SAssertionInfo struct {
+	NameId       string
+	NameIdFormat string
+	SessionIndex string
+	// attribute values keyed by both Name and FriendlyName
+	Attributes map[string][]string
+}
+
+// SServiceProvider validates SAML 2.0 Web Browser SSO with the HTTP-Redirect
+// binding for requests and the HTTP-POST binding for responses
+type SServiceProvider struct {
+	EntityId       string
+	AcsUrl         string
+	IdpEntityId    string
+	IdpSsoUrl      string
+	IdpCertificate *x509.Certificate
+}
+
+// ParseCertificate accepts a PEM encoded certificate or the bare base64 DER
+// content as found in IdP metadata
+func ParseCertificate(data string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := decodeBase64Text(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode certificate")
+	}
+	return x509.ParseCertificate(der)
+}
+
+func NewServiceProvider(entityId, acsUrl, idpEntityId, idpSsoUrl, idpCert string) (*SServiceProvider, error) {
+	cert, err := ParseCertificate(idpCert)
+	if err != nil {
+		return nil, errors.Wrap(err, "ParseCertificate")
+	}
+	return &SServiceProvider{
+		EntityId:       entityId,
+		AcsUrl:         acsUrl,
+		IdpEntityId:    idpEntityId,
+		IdpSsoUrl:      idpSsoUrl,
+		IdpCertificate: cert,
+	}, nil
+}
+
+func GenerateId() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return "_" + hex.EncodeToString(b)
+}
+
+func FormatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// AuthnRequestUrl returns the IdP URL the user agent should be redirected
+// to with an AuthnRequest of requestId, as generated by GenerateId
+func (sp *SServiceProvider) AuthnRequestUrl(requestId string, relayState string) (string, error) {
+	req := SAuthnRequest{
+		ID:                          requestId,
+		Version:                     "2.0",
+		IssueInstant:                FormatTime(time.Now()),
+		Destination:                 sp.IdpSsoUrl,
+		AssertionConsumerServiceURL: sp.AcsUrl,
+		ProtocolBinding:             BINDING_HTTP_POST,
+		Issuer:                      sp.EntityId,
+	}
+	req.NameIDPolicy = &struct {
+		Format      string `xml:"Format,attr,omitempty"`
+		AllowCreate bool   `xml:"AllowCreate,attr"`
+	}{
+		Format:      NAMEID_FORMAT_UNSPECIFIED,
+		AllowCreate: true,
+	}
+	data, err := xml.Marshal(req)
+	if err != nil {
+		return "", errors.Wrap(err, "xml.Marshal")
+	}
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+
+	query := url.Values{}
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if len(relayState) > 0 {
+		query.Set("RelayState", relayState)
+	}
+	sep := "?"
+	if strings.Contains(sp.IdpSsoUrl, "?") {
+		sep = "&"
+	}
+	return sp.IdpSsoUrl + sep + query.Encode(), nil
+}
+
+// DecodeAuthnRequest decodes the SAMLRequest parameter of the HTTP-Redirect
+// binding
+func DecodeAuthnRequest(samlRequest string) (*SAuthnRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(samlRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode")
+	}
+	data, err = ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "inflate")
+	}
+	req := SAuthnRequest{}
+	err = xml.Unmarshal(data, &req)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal")
+	}
+	return &req, nil
+}
+
+func checkTime(notBefore, notOnOrAfter string, now time.Time) error {
+	if len(notBefore) > 0 {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return errors.Wrap(err, "invalid NotBefore")
+		}
+		if now.Add(CLOCK_SKEW).Before(t) {
+			return fmt.Errorf("assertion not yet valid")
+		}
+	}
+	if len(notOnOrAfter) > 0 {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil {
+			return errors.Wrap(err, "invalid NotOnOrAfter")
+		}
+		if !now.Add(-CLOCK_SKEW).Before(t) {
+			return fmt.Errorf("assertion expired")
+		}
+	}
+	return nil
+}
+
+// ParseResponse verifies a base64 encoded SAMLResponse posted to the ACS
+// url. requestId is the ID of the AuthnRequest the response must answer
+func (sp *SServiceProvider) ParseResponse(samlResponse string, requestId string) (*SAssertionInfo, error) {
+	data, err := decodeBase64Text(samlResponse)
+	if err != nil {
+		return nil, errors.Wrap(err, "base64 decode")
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse response")
+	}
+	if root.Local != "Response" || root.Namespace() != NS_SAML_PROTOCOL {
+		return nil, fmt.Errorf("not a SAML response")
+	}
+	if dest := root.Attr("Destination"); len(dest) > 0 && dest != sp.AcsUrl {
+		return nil, fmt.Errorf("response destination %s mismatch", dest)
+	}
+	if irt := root.Attr("InResponseTo"); len(requestId) > 0 && irt != requestId {
+		return nil, fmt.Errorf("response is not in response to %s", requestId)
+	}
+	if issuer := root.FindChild(NS_SAML_ASSERTION, "Issuer"); issuer != nil && strings.TrimSpace(issuer.Text()) != sp.IdpEntityId {
+		return nil, fmt.Errorf("response issuer %s mismatch", issuer.Text())
+	}
+	status := root.FindChild(NS_SAML_PROTOCOL, "Status")
+	if status == nil {
+		return nil, fmt.Errorf("missing status")
+	}
+	statusCode := status.FindChild(NS_SAML_PROTOCOL, "StatusCode")
+	if statusCode == nil || statusCode.Attr("Value") != STATUS_SUCCESS {
+		msg := ""
+		if m := status.FindChild(NS_SAML_PROTOCOL, "StatusMessage"); m != nil {
+			msg = m.Text()
+		}
+		return nil, fmt.Errorf("authentication failed: %s", msg)
+	}
+
+	responseSigned := false
+	if root.FindChild(NS_DSIG, "Signature") != nil {
+		_, err := verifySignature(root, root.Attr("ID"), sp.IdpCertificate)
+		if err != nil {
+			return nil, errors.Wrap(err, "verify response signature")
+		}
+		responseSigned = true
+	}
+	if root.FindChild(NS_SAML_ASSERTION, "EncryptedAssertion") != nil {
+		return nil, fmt.Errorf("encrypted assertion not supported")
+	}
+	var assertionNode *sNode
+	for _, n := range root.ChildElements() {
+		if n.Local == "Assertion" && n.Namespace() == NS_SAML_ASSERTION {
+			if assertionNode != nil {
+				return nil, fmt.Errorf("multiple assertions not supported")
+			}
+			assertionNode = n
+		}
+	}
+	if assertionNode == nil {
+		return nil, fmt.Errorf("missing assertion")
+	}
+	if !responseSigned || assertionNode.FindChild(NS_DSIG, "Signature") != nil {
+		_, err := verifySignature(root, assertionNode.Attr("ID"), sp.IdpCertificate)
+		if err != nil {
+			return nil, errors.Wrap(err, "verify assertion signature")
+		}
+	}
+
+	assertion := sAssertion{}
+	err = xml.Unmarshal(assertionNode.Serialize(), &assertion)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal assertion")
+	}
+	return sp.validateAssertion(&assertion, requestId, time.Now())
+}
+
+func (sp *SServiceProvider) validateAssertion(assertion *sAssertion, requestId string, now time.Time) (*SAssertionInfo, error) {
+	if strings.TrimSpace(assertion.Issuer) != sp.IdpEntityId {
+		return nil, fmt.Errorf("assertion issuer %s mismatch", assertion.Issuer)
+	}
+	if assertion.Conditions != nil {
+		err := checkTime(assertion.Conditions.NotBefore, assertion.Conditions.NotOnOrAfter, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, restriction := range assertion.Conditions.AudienceRestrictions {
+			found := false
+			for _, aud := range restriction.Audiences {
+				if strings.TrimSpace(aud) == sp.EntityId {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("assertion not intended for %s", sp.EntityId)
+			}
+		}
+	}
+	confirmed := false
+	for _, conf := range assertion.Subject.SubjectConfirmations {
+		if conf.Method != CONFIRMATION_METHOD_BEARER {
+			continue
+		}
+		if len(conf.Data.Recipient) > 0 && conf.Data.Recipient != sp.AcsUrl {
+			continue
+		}
+		if len(requestId) > 0 && len(conf.Data.InResponseTo) > 0 && conf.Data.InResponseTo != requestId {
+			continue
+		}
+		if len(conf.Data.NotOnOrAfter) == 0 || checkTime("", conf.Data.NotOnOrAfter, now) != nil {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, fmt.Errorf("no valid bearer subject confirmation")
+	}
+	nameId := strings.TrimSpace(assertion.Subject.NameID.Value)
+	if len(nameId) == 0 {
+		return nil, fmt.Errorf("missing NameID")
+	}
+
+	info := SAssertionInfo{
+		NameId:       nameId,
+		NameIdFormat: assertion.Subject.NameID.Format,
+		Attributes:   make(map[string][]string),
+	}
+	if len(assertion.AuthnStatements) > 0 {
+		info.SessionIndex = assertion.AuthnStatements[0].SessionIndex
+	}
+	for _, stmt := range assertion.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			values := make([]string, len(attr.Values))
+			for i := range attr.Values {
+				values[i] = strings.TrimSpace(attr.Values[i])
+			}
+			if len(attr.Name) > 0 {
+				info.Attributes[attr.Name] = append(info.Attributes[attr.Name], values...)
+			}
+			if len(attr.FriendlyName) > 0 && attr.FriendlyName != attr.Name {
+				info.Attributes[attr.FriendlyName] = append(info.Attributes[attr.FriendlyName], values...)
+			}
+		}
+	}
+	return &info, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"encoding/base64"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var inputPattern = regexp.MustCompile(`name="([^"]+)" value="([^"]*)"`)
+
+func mockLogin(t *testing.T, sp *SServiceProvider, relayState string) (string, map[string]string) {
+	reqId := GenerateId()
+	loginUrl, err := sp.AuthnRequestUrl(reqId, relayState)
+	if err != nil {
+		t.Fatalf("AuthnRequestUrl %s", err)
+	}
+	resp, err := http.Get(loginUrl)
+	if err != nil {
+		t.Fatalf("sso %s", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("sso status %d %s", resp.StatusCode, body)
+	}
+	fields := make(map[string]string)
+	for _, m := range inputPattern.FindAllStringSubmatch(string(body), -1) {
+		fields[html.UnescapeString(m[1])] = html.UnescapeString(m[2])
+	}
+	return reqId, fields
+}
+
+func TestWebSSO(t *testing.T) {
+	idp, err := NewMockIdP("alice", map[string][]string{
+		"email":  {"alice@example.com"},
+		"groups": {"dev", "ops"},
+	})
+	if err != nil {
+		t.Fatalf("NewMockIdP %s", err)
+	}
+	defer idp.Close()
+
+	sp, err := NewServiceProvider("https://sp.example.com", "https://sp.example.com/acs", idp.EntityId(), idp.SsoUrl(), idp.CertificatePem())
+	if err != nil {
+		t.Fatalf("NewServiceProvider %s", err)
+	}
+
+	reqId, fields := mockLogin(t, sp, "relay-1")
+	if fields["RelayState"] != "relay-1" {
+		t.Errorf("relay state mismatch %s", fields["RelayState"])
+	}
+	info, err := sp.ParseResponse(fields["SAMLResponse"], reqId)
+	if err != nil {
+		t.Fatalf("ParseResponse %s", err)
+	}
+	if info.NameId != "alice" {
+		t.Errorf("unexpected NameID %s", info.NameId)
+	}
+	if len(info.Attributes["groups"]) != 2 || info.Attributes["email"][0] != "alice@example.com" {
+		t.Errorf("unexpected attributes %v", info.Attributes)
+	}
+
+	if _, err := sp.ParseResponse(fields["SAMLResponse"], "_another"); err == nil {
+		t.Errorf("response to another request accepted")
+	}
+
+	other := *sp
+	other.EntityId = "https://other.example.com"
+	if _, err := other.ParseResponse(fields["SAMLResponse"], reqId); err == nil {
+		t.Errorf("response for another audience accepted")
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(fields["SAMLResponse"])
+	tampered := strings.Replace(string(raw), ">alice<", ">mallory<", 1)
+	if _, err := sp.ParseResponse(base64.StdEncoding.EncodeToString([]byte(tampered)), reqId); err == nil {
+		t.Errorf("tampered response accepted")
+	}
+}
+
+func TestDecodeAuthnRequest(t *testing.T) {
+	sp := &SServiceProvider{
+		EntityId:  "https://sp.example.com",
+		AcsUrl:    "https://sp.example.com/acs",
+		IdpSsoUrl: "https://idp.example.com/sso?tenant=1",
+	}
+	reqId := GenerateId()
+	loginUrl, err := sp.AuthnRequestUrl(reqId, "")
+	if err != nil {
+		t.Fatalf("AuthnRequestUrl %s", err)
+	}
+	u, _ := url.Parse(loginUrl)
+	if u.Query().Get("tenant") != "1" {
+		t.Errorf("existing query lost %s", loginUrl)
+	}
+	req, err := DecodeAuthnRequest(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatalf("DecodeAuthnRequest %s", err)
+	}
+	if req.ID != reqId || req.Issuer != sp.EntityId || req.AssertionConsumerServiceURL != sp.AcsUrl {
+		t.Errorf("unexpected request %#v", req)
+	}
+}
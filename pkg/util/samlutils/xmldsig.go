@@ -0,0 +1,251 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	NS_DSIG = "http://www.w3.org/2000/09/xmldsig#"
+
+	ALGO_EXC_C14N            = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	ALGO_ENVELOPED_SIGNATURE = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	ALGO_RSA_SHA1            = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	ALGO_RSA_SHA256          = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	ALGO_SHA1                = "http://www.w3.org/2000/09/xmldsig#sha1"
+	ALGO_SHA256              = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+func digestHash(algo string) (crypto.Hash, error) {
+	switch algo {
+	case ALGO_SHA1:
+		return crypto.SHA1, nil
+	case ALGO_SHA256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("unsupported digest method %s", algo)
+}
+
+func signatureHash(algo string) (crypto.Hash, error) {
+	switch algo {
+	case ALGO_RSA_SHA1:
+		return crypto.SHA1, nil
+	case ALGO_RSA_SHA256:
+		return crypto.SHA256, nil
+	}
+	return 0, fmt.Errorf("unsupported signature method %s", algo)
+}
+
+func hashSum(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA1:
+		sum := sha1.Sum(data)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
+
+func decodeBase64Text(text string) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	return base64.StdEncoding.DecodeString(text)
+}
+
+func inclusivePrefixes(node *sNode) []string {
+	if node == nil {
+		return nil
+	}
+	incl := node.FindChild(ALGO_EXC_C14N, "InclusiveNamespaces")
+	if incl == nil {
+		return nil
+	}
+	return strings.Fields(incl.Attr("PrefixList"))
+}
+
+func countIds(node *sNode, id string) int {
+	cnt := 0
+	if node.Attr("ID") == id {
+		cnt += 1
+	}
+	for _, n := range node.ChildElements() {
+		cnt += countIds(n, id)
+	}
+	return cnt
+}
+
+// verifySignature checks the enveloped signature of the element identified
+// by id against cert and returns the signed element
+func verifySignature(root *sNode, id string, cert *x509.Certificate) (*sNode, error) {
+	if len(id) == 0 {
+		return nil, fmt.Errorf("signed element without ID")
+	}
+	if countIds(root, id) != 1 {
+		return nil, fmt.Errorf("ID %s is not unique", id)
+	}
+	elem := root.FindById(id)
+	if elem == nil {
+		return nil, fmt.Errorf("element %s not found", id)
+	}
+	sig := elem.FindChild(NS_DSIG, "Signature")
+	if sig == nil {
+		return nil, fmt.Errorf("element %s not signed", id)
+	}
+	signedInfo := sig.FindChild(NS_DSIG, "SignedInfo")
+	if signedInfo == nil {
+		return nil, fmt.Errorf("missing SignedInfo")
+	}
+	canonMethod := signedInfo.FindChild(NS_DSIG, "CanonicalizationMethod")
+	if canonMethod == nil || canonMethod.Attr("Algorithm") != ALGO_EXC_C14N {
+		return nil, fmt.Errorf("unsupported canonicalization method")
+	}
+	sigMethod := signedInfo.FindChild(NS_DSIG, "SignatureMethod")
+	if sigMethod == nil {
+		return nil, fmt.Errorf("missing SignatureMethod")
+	}
+	sigHash, err := signatureHash(sigMethod.Attr("Algorithm"))
+	if err != nil {
+		return nil, err
+	}
+
+	var ref *sNode
+	for _, n := range signedInfo.ChildElements() {
+		if n.Local == "Reference" && n.Namespace() == NS_DSIG {
+			if ref != nil {
+				return nil, fmt.Errorf("multiple references not supported")
+			}
+			ref = n
+		}
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("missing Reference")
+	}
+	if ref.Attr("URI") != "#"+id {
+		return nil, fmt.Errorf("reference %s does not match %s", ref.Attr("URI"), id)
+	}
+	var refPrefixes []string
+	if transforms := ref.FindChild(NS_DSIG, "Transforms"); transforms != nil {
+		for _, t := range transforms.ChildElements() {
+			switch t.Attr("Algorithm") {
+			case ALGO_ENVELOPED_SIGNATURE:
+			case ALGO_EXC_C14N:
+				refPrefixes = inclusivePrefixes(t)
+			default:
+				return nil, fmt.Errorf("unsupported transform %s", t.Attr("Algorithm"))
+			}
+		}
+	}
+	digestMethod := ref.FindChild(NS_DSIG, "DigestMethod")
+	digestValue := ref.FindChild(NS_DSIG, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return nil, fmt.Errorf("missing digest")
+	}
+	digHash, err := digestHash(digestMethod.Attr("Algorithm"))
+	if err != nil {
+		return nil, err
+	}
+	expectDigest, err := decodeBase64Text(digestValue.Text())
+	if err != nil {
+		return nil, errors.Wrap(err, "decode DigestValue")
+	}
+	digest := hashSum(digHash, canonicalize(elem, refPrefixes, sig))
+	if !bytes.Equal(digest, expectDigest) {
+		return nil, fmt.Errorf("digest mismatch")
+	}
+
+	sigValue := sig.FindChild(NS_DSIG, "SignatureValue")
+	if sigValue == nil {
+		return nil, fmt.Errorf("missing SignatureValue")
+	}
+	sigBytes, err := decodeBase64Text(sigValue.Text())
+	if err != nil {
+		return nil, errors.Wrap(err, "decode SignatureValue")
+	}
+	pubKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate without RSA public key")
+	}
+	hashed := hashSum(sigHash, canonicalize(signedInfo, inclusivePrefixes(canonMethod), nil))
+	err = rsa.VerifyPKCS1v15(pubKey, sigHash, hashed, sigBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+	return elem, nil
+}
+
+const signatureTemplate = `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+	`<ds:SignedInfo>` +
+	`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:CanonicalizationMethod>` +
+	`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"></ds:SignatureMethod>` +
+	`<ds:Reference URI="#%s">` +
+	`<ds:Transforms>` +
+	`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"></ds:Transform>` +
+	`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"></ds:Transform>` +
+	`</ds:Transforms>` +
+	`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"></ds:DigestMethod>` +
+	`<ds:DigestValue>%s</ds:DigestValue>` +
+	`</ds:Reference>` +
+	`</ds:SignedInfo>` +
+	`<ds:SignatureValue></ds:SignatureValue>` +
+	`<ds:KeyInfo><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo>` +
+	`</ds:Signature>`
+
+// signElement adds an enveloped RSA-SHA256 signature to the element
+// identified by id, placed right after its Issuer as SAML requires
+func signElement(root *sNode, id string, key *rsa.PrivateKey, cert *x509.Certificate) error {
+	elem := root.FindById(id)
+	if elem == nil {
+		return fmt.Errorf("element %s not found", id)
+	}
+	digest := sha256.Sum256(canonicalize(elem, nil, nil))
+	sig, err := parseXML([]byte(fmt.Sprintf(signatureTemplate, id,
+		base64.StdEncoding.EncodeToString(digest[:]),
+		base64.StdEncoding.EncodeToString(cert.Raw))))
+	if err != nil {
+		return errors.Wrap(err, "parse signature template")
+	}
+	pos := 0
+	for i, c := range elem.Children {
+		if n, ok := c.(*sNode); ok {
+			if n.Local == "Issuer" {
+				pos = i + 1
+			}
+			break
+		}
+	}
+	elem.insertChild(pos, sig)
+
+	signedInfo := sig.FindChild(NS_DSIG, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	sigBytes, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		elem.removeChild(sig)
+		return errors.Wrap(err, "rsa.SignPKCS1v15")
+	}
+	sigValue := sig.FindChild(NS_DSIG, "SignatureValue")
+	sigValue.Children = []interface{}{sText(base64.StdEncoding.EncodeToString(sigBytes))}
+	return nil
+}
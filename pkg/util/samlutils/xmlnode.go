@@ -0,0 +1,388 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	NS_XML = "http://www.w3.org/XML/1998/namespace"
+)
+
+// sNode is a minimal DOM keeping namespace prefixes as written, which
+// canonicalization and enveloped signatures require but encoding/xml does
+// not preserve
+type sNode struct {
+	Prefix   string
+	Local    string
+	Attrs    []xml.Attr
+	Children []interface{}
+	Parent   *sNode
+}
+
+type sText string
+
+type sProcInst xml.ProcInst
+
+func parseXML(data []byte) (*sNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *sNode
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &sNode{
+				Prefix: t.Name.Space,
+				Local:  t.Name.Local,
+				Attrs:  append([]xml.Attr{}, t.Attr...),
+				Parent: cur,
+			}
+			if cur == nil {
+				if root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				root = node
+			} else {
+				cur.Children = append(cur.Children, node)
+			}
+			cur = node
+		case xml.EndElement:
+			if cur == nil || cur.Prefix != t.Name.Space || cur.Local != t.Name.Local {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Children = append(cur.Children, sText(string(t)))
+			}
+		case xml.ProcInst:
+			if cur != nil {
+				cur.Children = append(cur.Children, sProcInst(t.Copy()))
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("empty document")
+	}
+	if cur != nil {
+		return nil, fmt.Errorf("unclosed element %s", cur.Local)
+	}
+	return root, nil
+}
+
+func isNsDecl(attr xml.Attr) (string, bool) {
+	if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+		return "", true
+	}
+	if attr.Name.Space == "xmlns" {
+		return attr.Name.Local, true
+	}
+	return "", false
+}
+
+// lookupNamespace resolves prefix in the scope of node
+func (node *sNode) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return NS_XML, true
+	}
+	for n := node; n != nil; n = n.Parent {
+		for _, attr := range n.Attrs {
+			if p, ok := isNsDecl(attr); ok && p == prefix {
+				return attr.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (node *sNode) Namespace() string {
+	ns, _ := node.lookupNamespace(node.Prefix)
+	return ns
+}
+
+func (node *sNode) Attr(local string) string {
+	for _, attr := range node.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (node *sNode) Text() string {
+	var buf strings.Builder
+	for _, c := range node.Children {
+		switch t := c.(type) {
+		case sText:
+			buf.WriteString(string(t))
+		case *sNode:
+			buf.WriteString(t.Text())
+		}
+	}
+	return buf.String()
+}
+
+func (node *sNode) ChildElements() []*sNode {
+	ret := make([]*sNode, 0)
+	for _, c := range node.Children {
+		if n, ok := c.(*sNode); ok {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+func (node *sNode) FindChild(ns, local string) *sNode {
+	for _, n := range node.ChildElements() {
+		if n.Local == local && n.Namespace() == ns {
+			return n
+		}
+	}
+	return nil
+}
+
+// FindById searches the subtree for the element whose ID attribute is id
+func (node *sNode) FindById(id string) *sNode {
+	if node.Attr("ID") == id {
+		return node
+	}
+	for _, n := range node.ChildElements() {
+		if found := n.FindById(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func (node *sNode) removeChild(child *sNode) {
+	for i := range node.Children {
+		if n, ok := node.Children[i].(*sNode); ok && n == child {
+			node.Children = append(node.Children[:i], node.Children[i+1:]...)
+			return
+		}
+	}
+}
+
+func (node *sNode) insertChild(pos int, child *sNode) {
+	child.Parent = node
+	node.Children = append(node.Children, nil)
+	copy(node.Children[pos+1:], node.Children[pos:])
+	node.Children[pos] = child
+}
+
+func qname(prefix, local string) string {
+	if len(prefix) == 0 {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", "\"", "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// Serialize writes the subtree as is, with the namespace declarations of
+// ancestors outside of the subtree added to its root
+func (node *sNode) Serialize() []byte {
+	var buf bytes.Buffer
+	node.serialize(&buf, true)
+	return buf.Bytes()
+}
+
+func (node *sNode) serialize(buf *bytes.Buffer, isRoot bool) {
+	buf.WriteString("<" + qname(node.Prefix, node.Local))
+	attrs := node.Attrs
+	if isRoot {
+		declared := make(map[string]bool)
+		for _, attr := range attrs {
+			if p, ok := isNsDecl(attr); ok {
+				declared[p] = true
+			}
+		}
+		for n := node.Parent; n != nil; n = n.Parent {
+			for _, attr := range n.Attrs {
+				if p, ok := isNsDecl(attr); ok && !declared[p] {
+					declared[p] = true
+					attrs = append(attrs, attr)
+				}
+			}
+		}
+	}
+	for _, attr := range attrs {
+		buf.WriteString(" " + qname(attr.Name.Space, attr.Name.Local) + "=\"" + attrEscaper.Replace(attr.Value) + "\"")
+	}
+	buf.WriteString(">")
+	for _, c := range node.Children {
+		switch t := c.(type) {
+		case sText:
+			buf.WriteString(textEscaper.Replace(string(t)))
+		case *sNode:
+			t.serialize(buf, false)
+		case sProcInst:
+			buf.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>")
+		}
+	}
+	buf.WriteString("</" + qname(node.Prefix, node.Local) + ">")
+}
+
+type sCanonicalizer struct {
+	inclusivePrefixes []string
+	exclude           *sNode
+	buf               bytes.Buffer
+}
+
+// canonicalize renders the subtree following Exclusive XML Canonicalization
+// 1.0 without comments, leaving out the exclude element
+func canonicalize(node *sNode, inclusivePrefixes []string, exclude *sNode) []byte {
+	c := &sCanonicalizer{
+		inclusivePrefixes: inclusivePrefixes,
+		exclude:           exclude,
+	}
+	c.element(node, map[string]string{})
+	return c.buf.Bytes()
+}
+
+type sNsDecl struct {
+	prefix string
+	uri    string
+}
+
+type sCanonAttr struct {
+	uri   string
+	name  string
+	value string
+}
+
+func (c *sCanonicalizer) element(node *sNode, rendered map[string]string) {
+	utilized := []string{node.Prefix}
+	for _, attr := range node.Attrs {
+		if _, ok := isNsDecl(attr); ok {
+			continue
+		}
+		if len(attr.Name.Space) > 0 && attr.Name.Space != "xml" {
+			utilized = append(utilized, attr.Name.Space)
+		}
+	}
+	for _, p := range c.inclusivePrefixes {
+		if p == "#default" {
+			p = ""
+		}
+		if _, ok := node.lookupNamespace(p); ok {
+			utilized = append(utilized, p)
+		}
+	}
+
+	decls := make([]sNsDecl, 0)
+	scope := rendered
+	seen := make(map[string]bool)
+	for _, p := range utilized {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		uri, _ := node.lookupNamespace(p)
+		prev, ok := rendered[p]
+		if ok && prev == uri {
+			continue
+		}
+		if !ok && len(p) == 0 && len(uri) == 0 {
+			// the empty default namespace is never declared unless undoing
+			// a default namespace of an output ancestor
+			continue
+		}
+		decls = append(decls, sNsDecl{prefix: p, uri: uri})
+	}
+	if len(decls) > 0 {
+		scope = make(map[string]string, len(rendered)+len(decls))
+		for k, v := range rendered {
+			scope[k] = v
+		}
+		for _, d := range decls {
+			scope[d.prefix] = d.uri
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	attrs := make([]sCanonAttr, 0)
+	for _, attr := range node.Attrs {
+		if _, ok := isNsDecl(attr); ok {
+			continue
+		}
+		uri := ""
+		if len(attr.Name.Space) > 0 {
+			uri, _ = node.lookupNamespace(attr.Name.Space)
+		}
+		attrs = append(attrs, sCanonAttr{
+			uri:   uri,
+			name:  qname(attr.Name.Space, attr.Name.Local),
+			value: attr.Value,
+		})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return localPart(attrs[i].name) < localPart(attrs[j].name)
+	})
+
+	c.buf.WriteString("<" + qname(node.Prefix, node.Local))
+	for _, d := range decls {
+		if len(d.prefix) == 0 {
+			c.buf.WriteString(" xmlns=\"" + attrEscaper.Replace(d.uri) + "\"")
+		} else {
+			c.buf.WriteString(" xmlns:" + d.prefix + "=\"" + attrEscaper.Replace(d.uri) + "\"")
+		}
+	}
+	for _, a := range attrs {
+		c.buf.WriteString(" " + a.name + "=\"" + attrEscaper.Replace(a.value) + "\"")
+	}
+	c.buf.WriteString(">")
+	for _, child := range node.Children {
+		switch t := child.(type) {
+		case sText:
+			c.buf.WriteString(textEscaper.Replace(string(t)))
+		case *sNode:
+			if t != c.exclude {
+				c.element(t, scope)
+			}
+		case sProcInst:
+			c.buf.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				c.buf.WriteString(" " + string(t.Inst))
+			}
+			c.buf.WriteString("?>")
+		}
+	}
+	c.buf.WriteString("</" + qname(node.Prefix, node.Local) + ">")
+}
+
+func localPart(name string) string {
+	if pos := strings.IndexByte(name, ':'); pos >= 0 {
+		return name[pos+1:]
+	}
+	return name
+}
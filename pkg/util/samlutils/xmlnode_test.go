@@ -0,0 +1,89 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package samlutils
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	doc := `<root xmlns="urn:a" xmlns:b="urn:b" xmlns:unused="urn:u"><b:child z="1" a="2" b:x="3">text &amp; more</b:child><c/></root>`
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatalf("parseXML %s", err)
+	}
+	cases := []struct {
+		node *sNode
+		want string
+	}{
+		{
+			node: root,
+			want: `<root xmlns="urn:a"><b:child xmlns:b="urn:b" a="2" z="1" b:x="3">text &amp; more</b:child><c></c></root>`,
+		},
+		{
+			node: root.ChildElements()[0],
+			want: `<b:child xmlns:b="urn:b" a="2" z="1" b:x="3">text &amp; more</b:child>`,
+		},
+		{
+			node: root.ChildElements()[1],
+			want: `<c xmlns="urn:a"></c>`,
+		},
+	}
+	for _, c := range cases {
+		got := string(canonicalize(c.node, nil, nil))
+		if got != c.want {
+			t.Errorf("canonicalize %s: want %s got %s", c.node.Local, c.want, got)
+		}
+	}
+	got := string(canonicalize(root.ChildElements()[1], []string{"unused"}, nil))
+	want := `<c xmlns="urn:a" xmlns:unused="urn:u"></c>`
+	if got != want {
+		t.Errorf("inclusive prefixes: want %s got %s", want, got)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	key, cert, err := GenerateSelfSignedCert("test")
+	if err != nil {
+		t.Fatalf("GenerateSelfSignedCert %s", err)
+	}
+	_, otherCert, err := GenerateSelfSignedCert("other")
+	if err != nil {
+		t.Fatalf("GenerateSelfSignedCert %s", err)
+	}
+	doc := `<p:Doc xmlns:p="urn:p" ID="_1"><p:Issuer>me</p:Issuer><p:Value attr="x">42</p:Value></p:Doc>`
+	root, _ := parseXML([]byte(doc))
+	err = signElement(root, "_1", key, cert)
+	if err != nil {
+		t.Fatalf("signElement %s", err)
+	}
+	signed := root.Serialize()
+
+	root, err = parseXML(signed)
+	if err != nil {
+		t.Fatalf("parse signed %s", err)
+	}
+	if _, err := verifySignature(root, "_1", cert); err != nil {
+		t.Errorf("valid signature rejected: %s", err)
+	}
+	if _, err := verifySignature(root, "_1", otherCert); err == nil {
+		t.Errorf("signature accepted with another certificate")
+	}
+
+	value := root.ChildElements()[2]
+	value.Children = []interface{}{sText("43")}
+	if _, err := verifySignature(root, "_1", cert); err == nil {
+		t.Errorf("tampered document accepted")
+	}
+}
@@ -97,6 +97,18 @@ func (ps PasswordStrength) Len() int {
 	return ps.Punctuats + ps.Uppercases + ps.Lowercases + ps.Digits
 }
 
+// CharClasses counts the kinds of characters, i.e. digits, lowercases,
+// uppercases and punctuations, in the password
+func (ps PasswordStrength) CharClasses() int {
+	cnt := 0
+	for _, n := range []int{ps.Digits, ps.Lowercases, ps.Uppercases, ps.Punctuats} {
+		if n > 0 {
+			cnt += 1
+		}
+	}
+	return cnt
+}
+
 func (ps PasswordStrength) MeetComplexity() bool {
 	if ps.Punctuats > 0 && ps.Digits > 0 && ps.Lowercases > 0 && ps.Uppercases > 0 && ps.Len() >= 12 {
 		return true
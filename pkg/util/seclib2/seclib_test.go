@@ -39,3 +39,22 @@ func TestMeetComplxity(t *testing.T) {
 		}
 	}
 }
+
+func TestPasswordStrength_CharClasses(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"123456", 1},
+		{"abc123", 2},
+		{"abcABC123", 3},
+		{"123abcABC!@#", 4},
+	}
+	for _, c := range cases {
+		got := AnalyzePasswordStrenth(c.in).CharClasses()
+		if got != c.want {
+			t.Errorf("%s: got %d want %d", c.in, got, c.want)
+		}
+	}
+}
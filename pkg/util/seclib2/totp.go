@@ -0,0 +1,124 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package seclib2
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TOTP_PERIOD = 30
+	TOTP_DIGITS = 6
+
+	// number of periods before and after the current one a passcode is
+	// still accepted, to tolerate clock skew between server and device
+	TOTP_SKEW = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTotpSecret returns a random base32 encoded secret of 160 bits,
+// the key length recommended by RFC 4226
+func GenerateTotpSecret() (string, error) {
+	key := make([]byte, 20)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+func decodeTotpSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+	return totpEncoding.DecodeString(secret)
+}
+
+func hotpCode(key []byte, counter uint64, digits int) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i += 1 {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%mod)
+}
+
+// TotpCode computes the RFC 6238 passcode of secret at time t
+func TotpCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTotpSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotpCode(key, uint64(t.Unix()/TOTP_PERIOD), TOTP_DIGITS), nil
+}
+
+// VerifyTotpCode checks passcode against secret at time t, allowing
+// TOTP_SKEW periods of clock drift
+func VerifyTotpCode(secret string, passcode string, t time.Time) error {
+	_, err := VerifyTotpCounter(secret, passcode, t)
+	return err
+}
+
+// VerifyTotpCounter is VerifyTotpCode returning the time step counter the
+// passcode matches, so that callers can refuse a passcode used before
+func VerifyTotpCounter(secret string, passcode string, t time.Time) (int64, error) {
+	key, err := decodeTotpSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	if len(passcode) != TOTP_DIGITS {
+		return 0, fmt.Errorf("invalid passcode")
+	}
+	counter := t.Unix() / TOTP_PERIOD
+	for i := -TOTP_SKEW; i <= TOTP_SKEW; i += 1 {
+		code := hotpCode(key, uint64(counter+int64(i)), TOTP_DIGITS)
+		if subtle.ConstantTimeCompare([]byte(code), []byte(passcode)) == 1 {
+			return counter + int64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid passcode")
+}
+
+// TotpProvisioningUri returns the otpauth:// URI understood by
+// authenticator apps, usually rendered as a QR code
+func TotpProvisioningUri(issuer string, account string, secret string) string {
+	label := url.PathEscape(account)
+	if len(issuer) > 0 {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	if len(issuer) > 0 {
+		params.Set("issuer", issuer)
+	}
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprintf("%d", TOTP_DIGITS))
+	params.Set("period", fmt.Sprintf("%d", TOTP_PERIOD))
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, params.Encode())
+}
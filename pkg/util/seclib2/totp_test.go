@@ -0,0 +1,99 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package seclib2
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTotpCode(t *testing.T) {
+	// test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, c := range cases {
+		got, err := TotpCode(secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Errorf("TotpCode %d: %s", c.unix, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("TotpCode %d: want %s got %s", c.unix, c.want, got)
+		}
+	}
+}
+
+func TestVerifyTotpCode(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatalf("GenerateTotpSecret %s", err)
+	}
+	now := time.Now()
+	code, _ := TotpCode(secret, now)
+	if err := VerifyTotpCode(secret, code, now); err != nil {
+		t.Errorf("current code rejected: %s", err)
+	}
+	if err := VerifyTotpCode(secret, code, now.Add(TOTP_PERIOD*time.Second)); err != nil {
+		t.Errorf("skewed code rejected: %s", err)
+	}
+	if err := VerifyTotpCode(secret, code, now.Add(5*TOTP_PERIOD*time.Second)); err == nil {
+		t.Errorf("stale code accepted")
+	}
+	if err := VerifyTotpCode(strings.ToLower(secret), code, now); err != nil {
+		t.Errorf("lower case secret rejected: %s", err)
+	}
+}
+
+func TestVerifyTotpCounter(t *testing.T) {
+	secret, err := GenerateTotpSecret()
+	if err != nil {
+		t.Fatalf("GenerateTotpSecret %s", err)
+	}
+	now := time.Unix(1234567890, 0)
+	counter := now.Unix() / TOTP_PERIOD
+	for i := int64(-TOTP_SKEW); i <= TOTP_SKEW; i += 1 {
+		code, _ := TotpCode(secret, now.Add(time.Duration(i*TOTP_PERIOD)*time.Second))
+		got, err := VerifyTotpCounter(secret, code, now)
+		if err != nil {
+			t.Errorf("code of step %d rejected: %s", i, err)
+			continue
+		}
+		if got != counter+i {
+			t.Errorf("code of step %d: want counter %d got %d", i, counter+i, got)
+		}
+	}
+	if _, err := VerifyTotpCounter(secret, "12345", now); err == nil {
+		t.Errorf("short code accepted")
+	}
+}
+
+func TestTotpProvisioningUri(t *testing.T) {
+	uri := TotpProvisioningUri("OneCloud", "alice@default", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/OneCloud:alice@default?algorithm=SHA1&digits=6&issuer=OneCloud&period=30&secret=JBSWY3DPEHPK3PXP"
+	if uri != want {
+		t.Errorf("want %s got %s", want, uri)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sysutils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/types"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+const (
+	DEFAULT_HUGEPAGE_SIZE_KB = 2048
+)
+
+var (
+	numaNodeSysPath = "/sys/devices/system/node"
+	procMeminfoPath = "/proc/meminfo"
+
+	numaNodeDirRegexp = regexp.MustCompile(`^node(\d+)$`)
+)
+
+// ParseCpuList parse kernel cpu list format, e.g. 0-3,8,10-11
+func ParseCpuList(cpuList string) ([]int, error) {
+	cpus := []int{}
+	cpuList = strings.TrimSpace(cpuList)
+	if len(cpuList) == 0 {
+		return cpus, nil
+	}
+	for _, seg := range strings.Split(cpuList, ",") {
+		seg = strings.TrimSpace(seg)
+		bounds := strings.SplitN(seg, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q: %s", cpuList, err)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpu list %q: %s", cpuList, err)
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid cpu list %q: range %s", cpuList, seg)
+		}
+		for i := start; i <= end; i++ {
+			cpus = append(cpus, i)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// FormatCpuList is the reverse of ParseCpuList
+func FormatCpuList(cpus []int) string {
+	sorted := make([]int, len(cpus))
+	copy(sorted, cpus)
+	sort.Ints(sorted)
+	segs := []string{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if j > i {
+			segs = append(segs, fmt.Sprintf("%d-%d", sorted[i], sorted[j]))
+		} else {
+			segs = append(segs, strconv.Itoa(sorted[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(segs, ",")
+}
+
+// meminfoValueKb fetch value of key from meminfo content, the unit is kB
+func meminfoValueKb(content string, key string) (int, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		pos := strings.Index(line, key+":")
+		if pos < 0 {
+			continue
+		}
+		fields := strings.Fields(line[pos+len(key)+1:])
+		if len(fields) == 0 {
+			return 0, false
+		}
+		val, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return 0, false
+		}
+		return val, true
+	}
+	return 0, false
+}
+
+func getDefaultHugepageSizeKb() int {
+	content, err := fileutils2.FileGetContents(procMeminfoPath)
+	if err == nil {
+		if size, ok := meminfoValueKb(content, "Hugepagesize"); ok && size > 0 {
+			return size
+		}
+	}
+	return DEFAULT_HUGEPAGE_SIZE_KB
+}
+
+func detectNumaNode(nodeId int, nodePath string, hugepageSizeKb int) (*types.SNumaNode, error) {
+	node := &types.SNumaNode{
+		NodeId:         nodeId,
+		HugepageSizeKb: hugepageSizeKb,
+	}
+	cpuList, err := fileutils2.FileGetContents(path.Join(nodePath, "cpulist"))
+	if err != nil {
+		return nil, err
+	}
+	node.Cpus, err = ParseCpuList(cpuList)
+	if err != nil {
+		return nil, err
+	}
+	meminfo, err := fileutils2.FileGetContents(path.Join(nodePath, "meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	if memTotal, ok := meminfoValueKb(meminfo, "MemTotal"); ok {
+		node.MemSizeMb = memTotal / 1024
+	}
+	nrHugepages, err := fileutils2.FileGetContents(path.Join(nodePath, "hugepages",
+		fmt.Sprintf("hugepages-%dkB", hugepageSizeKb), "nr_hugepages"))
+	if err == nil {
+		node.HugepagesTotal, _ = strconv.Atoi(strings.TrimSpace(nrHugepages))
+	}
+	return node, nil
+}
+
+// DetectNumaTopology read NUMA nodes of host from sysfs, nodes without
+// any cpu, e.g. memory only nodes, are ignored
+func DetectNumaTopology() ([]*types.SNumaNode, error) {
+	files, err := ioutil.ReadDir(numaNodeSysPath)
+	if err != nil {
+		return nil, err
+	}
+	hugepageSizeKb := getDefaultHugepageSizeKb()
+	nodes := []*types.SNumaNode{}
+	for _, f := range files {
+		m := numaNodeDirRegexp.FindStringSubmatch(f.Name())
+		if len(m) == 0 {
+			continue
+		}
+		nodeId, _ := strconv.Atoi(m[1])
+		node, err := detectNumaNode(nodeId, path.Join(numaNodeSysPath, f.Name()), hugepageSizeKb)
+		if err != nil {
+			return nil, fmt.Errorf("detect numa node %d: %s", nodeId, err)
+		}
+		if len(node.Cpus) == 0 {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].NodeId < nodes[j].NodeId
+	})
+	return nodes, nil
+}
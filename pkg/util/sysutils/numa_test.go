@@ -0,0 +1,110 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sysutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParseCpuList(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []int
+	}{
+		{"", []int{}},
+		{"0", []int{0}},
+		{"0-3\n", []int{0, 1, 2, 3}},
+		{"8,0-1,10-11", []int{0, 1, 8, 10, 11}},
+	}
+	for _, c := range cases {
+		got, err := ParseCpuList(c.in)
+		if err != nil {
+			t.Errorf("ParseCpuList(%q): %s", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseCpuList(%q) want %v, got %v", c.in, c.want, got)
+		}
+		if len(c.want) > 0 {
+			again, _ := ParseCpuList(FormatCpuList(got))
+			if !reflect.DeepEqual(again, got) {
+				t.Errorf("FormatCpuList(%v) = %q not reversible", got, FormatCpuList(got))
+			}
+		}
+	}
+	for _, in := range []string{"a", "3-1", "1-b"} {
+		if _, err := ParseCpuList(in); err == nil {
+			t.Errorf("ParseCpuList(%q) should fail", in)
+		}
+	}
+	if got := FormatCpuList([]int{5, 0, 1, 2, 7, 8}); got != "0-2,5,7-8" {
+		t.Errorf("FormatCpuList got %q", got)
+	}
+}
+
+func TestDetectNumaTopology(t *testing.T) {
+	root, err := ioutil.TempDir("", "numa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	writeFile := func(p string, content string) {
+		p = path.Join(root, p)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("meminfo", "MemTotal:       65536000 kB\nHugepagesize:       2048 kB\n")
+	writeFile("node/node0/cpulist", "0-3,8-11\n")
+	writeFile("node/node0/meminfo", "Node 0 MemTotal:       32768000 kB\nNode 0 MemFree:        1024 kB\n")
+	writeFile("node/node0/hugepages/hugepages-2048kB/nr_hugepages", "1024\n")
+	writeFile("node/node1/cpulist", "4-7,12-15\n")
+	writeFile("node/node1/meminfo", "Node 1 MemTotal:       32768000 kB\n")
+	// memory only node
+	writeFile("node/node2/cpulist", "\n")
+	writeFile("node/node2/meminfo", "Node 2 MemTotal:       1024000 kB\n")
+	writeFile("node/possible", "0-2\n")
+
+	oldNodePath, oldMeminfoPath := numaNodeSysPath, procMeminfoPath
+	numaNodeSysPath, procMeminfoPath = path.Join(root, "node"), path.Join(root, "meminfo")
+	defer func() {
+		numaNodeSysPath, procMeminfoPath = oldNodePath, oldMeminfoPath
+	}()
+
+	nodes, err := DetectNumaTopology()
+	if err != nil {
+		t.Fatalf("DetectNumaTopology: %s", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expect 2 nodes, got %d", len(nodes))
+	}
+	if nodes[0].NodeId != 0 || !reflect.DeepEqual(nodes[0].Cpus, []int{0, 1, 2, 3, 8, 9, 10, 11}) {
+		t.Errorf("unexpected node0 %#v", nodes[0])
+	}
+	if nodes[0].MemSizeMb != 32000 || nodes[0].GetHugepageMemSizeMb() != 2048 {
+		t.Errorf("unexpected node0 memory %#v", nodes[0])
+	}
+	if nodes[1].NodeId != 1 || nodes[1].HugepagesTotal != 0 || nodes[1].HugepageSizeKb != 2048 {
+		t.Errorf("unexpected node1 %#v", nodes[1])
+	}
+}